@@ -0,0 +1,109 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import "xfsgo/common"
+
+// accessList holds the addresses and the storage slots accessed during a transaction.
+// The slots of an address are nil until the first slot of the address is added.
+type accessList struct {
+	addresses map[common.Address]map[[32]byte]struct{}
+}
+
+func newAccessList() *accessList {
+	return &accessList{
+		addresses: make(map[common.Address]map[[32]byte]struct{}),
+	}
+}
+
+// containsAddress reports whether the address is in the list.
+func (al *accessList) containsAddress(addr common.Address) bool {
+	_, ok := al.addresses[addr]
+	return ok
+}
+
+// contains reports whether the address and the slot of the address are in the list.
+func (al *accessList) contains(addr common.Address, slot [32]byte) (addressOk bool, slotOk bool) {
+	slots, ok := al.addresses[addr]
+	if !ok {
+		return false, false
+	}
+	_, slotOk = slots[slot]
+	return true, slotOk
+}
+
+// addAddress adds the address to the list, it reports whether the address was added.
+func (al *accessList) addAddress(addr common.Address) bool {
+	if _, ok := al.addresses[addr]; ok {
+		return false
+	}
+	al.addresses[addr] = nil
+	return true
+}
+
+// addSlot adds the slot and its address to the list, it reports whether the address
+// and the slot were added.
+func (al *accessList) addSlot(addr common.Address, slot [32]byte) (addrAdded bool, slotAdded bool) {
+	slots, ok := al.addresses[addr]
+	if ok && slots != nil {
+		if _, exists := slots[slot]; exists {
+			return false, false
+		}
+	}
+	if slots == nil {
+		slots = make(map[[32]byte]struct{})
+		al.addresses[addr] = slots
+	}
+	slots[slot] = struct{}{}
+	return !ok, true
+}
+
+// deleteAddress removes the address added last, its slots must have been removed.
+func (al *accessList) deleteAddress(addr common.Address) {
+	delete(al.addresses, addr)
+}
+
+// deleteSlot removes the slot added last, the address remains in the list.
+func (al *accessList) deleteSlot(addr common.Address, slot [32]byte) {
+	slots, ok := al.addresses[addr]
+	if !ok {
+		return
+	}
+	delete(slots, slot)
+	if len(slots) == 0 {
+		al.addresses[addr] = nil
+	}
+}
+
+// AccessListEntry is an address and the storage slots of the address accessed.
+type AccessListEntry struct {
+	Address common.Address
+	Slots   [][32]byte
+}
+
+// entries returns the addresses of the list with their slots, in no particular order.
+func (al *accessList) entries() []AccessListEntry {
+	out := make([]AccessListEntry, 0, len(al.addresses))
+	for addr, slots := range al.addresses {
+		entry := AccessListEntry{Address: addr, Slots: make([][32]byte, 0, len(slots))}
+		for slot := range slots {
+			entry.Slots = append(entry.Slots, slot)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
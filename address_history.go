@@ -0,0 +1,227 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"xfsgo/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	addrIndexPre       = []byte("addrIdx:")
+	addrIndexHeightKey = []byte("AddrIndexHeight")
+)
+
+// Kinds of the balance affecting events of an account.
+const (
+	AccountEventSend     = "send"
+	AccountEventReceive  = "receive"
+	AccountEventCoinbase = "coinbase"
+)
+
+// AccountEvent is a balance affecting event of the account with the address in a block.
+// Amount is the value moved by the event and Fee the transaction fee paid by the account,
+// the balance changes by Amount for received value and rewards and by -(Amount+Fee) for
+// sent value. Value moved by contracts inside of a call is not indexed.
+type AccountEvent struct {
+	Address      common.Address `json:"address"`
+	Height       uint64         `json:"height"`
+	BlockHash    common.Hash    `json:"block_hash"`
+	Timestamp    uint64         `json:"timestamp"`
+	TxHash       common.Hash    `json:"tx_hash"`
+	Kind         string         `json:"kind"`
+	Counterparty common.Address `json:"counterparty"`
+	Amount       *big.Int       `json:"amount"`
+	Fee          *big.Int       `json:"fee"`
+	Status       uint32         `json:"status"`
+}
+
+func addrIndexKey(addr common.Address, height uint64, blockHash common.Hash, seq uint32) []byte {
+	// addrIdx:<addr><height_64bits><block_hash><seq_32bits> -> <event>
+	key := make([]byte, 0, len(addrIndexPre)+len(addr)+8+len(blockHash)+4)
+	key = append(key, addrIndexPre...)
+	key = append(key, addr[:]...)
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], height)
+	key = append(key, numBuf[:]...)
+	key = append(key, blockHash[:]...)
+	binary.BigEndian.PutUint32(numBuf[:4], seq)
+	return append(key, numBuf[:4]...)
+}
+
+// blockAccountEvents returns the account events of the block, the block rewards of the
+// chain config first and then the sent and received value of the transactions in the block order.
+func blockAccountEvents(config *ChainConfig, block *Block) []*AccountEvent {
+	header := block.Header
+	hash := header.HeaderHash()
+	newEvent := func(addr common.Address, kind string) *AccountEvent {
+		return &AccountEvent{
+			Address:   addr,
+			Height:    header.Height,
+			BlockHash: hash,
+			Timestamp: header.Timestamp,
+			Kind:      kind,
+			Amount:    new(big.Int),
+			Fee:       new(big.Int),
+			Status:    1,
+		}
+	}
+	events := make([]*AccountEvent, 0)
+	for _, r := range blockRewards(config, header) {
+		reward := newEvent(r.Address, AccountEventCoinbase)
+		reward.Amount = r.Amount
+		events = append(events, reward)
+	}
+	receipts := make(map[common.Hash]*Receipt, len(block.Receipts))
+	for _, r := range block.Receipts {
+		receipts[r.TxHash] = r
+	}
+	for _, tx := range block.Transactions {
+		txHash := tx.Hash()
+		receipt, exists := receipts[txHash]
+		if !exists {
+			continue
+		}
+		from, err := tx.FromAddr()
+		if err != nil {
+			continue
+		}
+		send := newEvent(from, AccountEventSend)
+		send.TxHash = txHash
+		send.Counterparty = tx.To
+		send.Status = receipt.Status
+		send.Fee.Mul(receipt.GasUsed, tx.GasPrice)
+		events = append(events, send)
+		// value only moves to the receiver of a successful transaction which neither
+		// creates a contract nor sets the extra data of the sender
+		if receipt.Status != 1 || TxToAddrNotSet(tx) || config.TxSetsExtra(tx, from, header.Height) ||
+			tx.Value == nil || tx.Value.Sign() <= 0 {
+			continue
+		}
+		send.Amount.Set(tx.Value)
+		receive := newEvent(tx.To, AccountEventReceive)
+		receive.TxHash = txHash
+		receive.Counterparty = from
+		receive.Amount.Set(tx.Value)
+		events = append(events, receive)
+	}
+	return events
+}
+
+// WriteAddressIndex indexes the account events of the block by the account addresses.
+// The entries carry the block hash, the entries of blocks which are not on the main chain
+// are skipped when the index is read so a reorg does not need to remove entries.
+func (db *extraDB) WriteAddressIndex(config *ChainConfig, block *Block) error {
+	if block.Height() == 0 {
+		return nil
+	}
+	for i, event := range blockAccountEvents(config, block) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		key := addrIndexKey(event.Address, event.Height, event.BlockHash, uint32(i))
+		if err = db.storage.SetData(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *extraDB) getAddressIndexHeight() uint64 {
+	val, err := db.storage.GetData(addrIndexHeightKey)
+	if err != nil || len(val) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(val)
+}
+
+func (db *extraDB) writeAddressIndexHeight(height uint64) error {
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], height)
+	return db.storage.SetData(addrIndexHeightKey, numBuf[:])
+}
+
+// catchUpAddressIndex indexes the main chain blocks up to the current block. Blocks are
+// indexed when they are written, this covers the blocks written before the index existed.
+func (bc *BlockChain) catchUpAddressIndex() error {
+	bc.addrIndexMu.Lock()
+	defer bc.addrIndexMu.Unlock()
+	head := bc.CurrentBHeader().Height
+	start := bc.extraDB.getAddressIndexHeight()
+	if start >= head {
+		return nil
+	}
+	for h := start + 1; h <= head; h++ {
+		block := bc.GetBlockByNumber(h)
+		if block == nil {
+			return ErrBlockNotFound
+		}
+		if err := bc.extraDB.WriteAddressIndex(bc.ChainConfig(), block); err != nil {
+			return err
+		}
+	}
+	logrus.Debugf("Extended address index: from=%d, to=%d", start+1, head)
+	return bc.extraDB.writeAddressIndexHeight(head)
+}
+
+// GetAccountHistory returns the events of the main chain changing the balance of the
+// account with the address in the block range from and to, both included, ordered by
+// height.
+func (bc *BlockChain) GetAccountHistory(addr common.Address, from, to uint64) ([]*AccountEvent, error) {
+	if err := bc.catchUpAddressIndex(); err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, 0, len(addrIndexPre)+len(addr))
+	prefix = append(prefix, addrIndexPre...)
+	prefix = append(prefix, addr[:]...)
+	canonical := make(map[uint64]common.Hash)
+	events := make([]*AccountEvent, 0)
+	err := bc.extraDB.storage.PrefixForeachData(prefix, func(k []byte, v []byte) error {
+		if len(k) < len(prefix)+8+len(common.Hash{}) {
+			return nil
+		}
+		height := binary.BigEndian.Uint64(k[len(prefix):])
+		if height < from || height > to {
+			return nil
+		}
+		blockHash := k[len(prefix)+8 : len(prefix)+8+len(common.Hash{})]
+		hash, exists := canonical[height]
+		if !exists {
+			hash, _ = bc.chainDB.getBlockHashByHeight(height)
+			canonical[height] = hash
+		}
+		if !bytes.Equal(hash[:], blockHash) {
+			return nil
+		}
+		event := new(AccountEvent)
+		if err := json.Unmarshal(v, event); err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
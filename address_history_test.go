@@ -0,0 +1,94 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+func TestBlockChain_GetAccountHistory(t *testing.T) {
+	bc, genesis := newTestChain(t)
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.DefaultPubKey2Addr(key.PublicKey)
+	recipient := common.Address{0x02}
+	miner := common.Address{0x03}
+	gasPrice := big.NewInt(10)
+	newBlock := func(height uint64, nonce uint32, value int64, status uint32) *Block {
+		header := *genesis.Header
+		header.Height = height
+		header.Nonce = nonce
+		header.Timestamp = genesis.Header.Timestamp + height
+		header.Coinbase = miner
+		tx := NewTransaction(recipient, common.TxGas, gasPrice, big.NewInt(value))
+		tx.Nonce = height
+		if err := tx.SignWithPrivateKey(key); err != nil {
+			t.Fatal(err)
+		}
+		receipt := &Receipt{TxHash: tx.Hash(), Status: status, GasUsed: common.TxGas}
+		return &Block{Header: &header, Transactions: []*Transaction{tx}, Receipts: []*Receipt{receipt}}
+	}
+	writeBlock := func(block *Block, canonical bool) {
+		if err := bc.WriteTransactions2ExtraDB(block.HeaderHash(), block.Height(), block.Transactions); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.WriteReceipts2ExtraDB(block.HeaderHash(), block.Receipts); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.WriteBHeader2ChainDBWithHash(block.Header); err != nil {
+			t.Fatal(err)
+		}
+		if canonical {
+			if err := bc.insertBHeader2Chain(block.Header); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// the first block is written without the index like blocks of an older node
+	block1 := newBlock(1, 1, 100, 1)
+	writeBlock(block1, true)
+	block2 := newBlock(2, 1, 50, 0)
+	writeBlock(block2, true)
+	if err = bc.extraDB.WriteAddressIndex(bc.ChainConfig(), block2); err != nil {
+		t.Fatal(err)
+	}
+	// a block of a fork is indexed but not part of the history
+	side := newBlock(2, 2, 7, 1)
+	writeBlock(side, false)
+	if err = bc.extraDB.WriteAddressIndex(bc.ChainConfig(), side); err != nil {
+		t.Fatal(err)
+	}
+
+	fee := new(big.Int).Mul(common.TxGas, gasPrice)
+	events, err := bc.GetAccountHistory(sender, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(events), 2)
+	assert.Equal(t, events[0].Kind, AccountEventSend)
+	assert.Equal(t, events[0].Counterparty, recipient)
+	assert.BigIntEqual(t, events[0].Amount, big.NewInt(100))
+	assert.BigIntEqual(t, events[0].Fee, fee)
+	assert.Equal(t, events[0].Timestamp, block1.Header.Timestamp)
+	// a failed transaction only pays the fee
+	assert.Equal(t, events[1].BlockHash, block2.HeaderHash())
+	assert.Equal(t, events[1].Status, uint32(0))
+	assert.BigIntEqual(t, events[1].Amount, big.NewInt(0))
+	assert.BigIntEqual(t, events[1].Fee, fee)
+
+	events, _ = bc.GetAccountHistory(recipient, 0, 2)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Kind, AccountEventReceive)
+	assert.Equal(t, events[0].Counterparty, sender)
+	assert.BigIntEqual(t, events[0].Amount, big.NewInt(100))
+	assert.BigIntEqual(t, events[0].Fee, big.NewInt(0))
+
+	events, _ = bc.GetAccountHistory(miner, 2, 2)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Kind, AccountEventCoinbase)
+	assert.BigIntEqual(t, events[0].Amount, bc.GetBlockReward(2))
+}
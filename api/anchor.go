@@ -0,0 +1,249 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"math/big"
+	"os"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/storage/badger"
+	"xfsgo/vm"
+)
+
+// anchorStoreGas is the gas anchoring a document needs in addition to the transaction
+// gas, it pays the event of the anchor.
+var anchorStoreGas = big.NewInt(10000)
+
+type AnchorAPIHandler struct {
+	StateDb       *badger.Storage
+	BlockChain    *xfsgo.BlockChain
+	Wallet        *xfsgo.Wallet
+	TxPendingPool *xfsgo.TxPool
+}
+
+type AnchorStoreArgs struct {
+	Contract string `json:"contract"`
+	// From is the wallet address sending the transaction and owning the anchor, the
+	// default address is used when it is empty.
+	From string `json:"from"`
+	// Hash is the hex encoded SHA256 hash of the document.
+	Hash     string `json:"hash"`
+	Metadata string `json:"metadata"`
+	GasLimit string `json:"gas_limit"`
+	GasPrice string `json:"gas_price"`
+}
+
+type AnchorFileArgs struct {
+	Contract string `json:"contract"`
+	From     string `json:"from"`
+	// Path is the path of the file on the host of the node.
+	Path     string `json:"path"`
+	Metadata string `json:"metadata"`
+	GasLimit string `json:"gas_limit"`
+	GasPrice string `json:"gas_price"`
+}
+
+type AnchorFileResp struct {
+	Hash        string `json:"hash"`
+	Transaction string `json:"transaction"`
+}
+
+type AnchorVerifyArgs struct {
+	Contract string `json:"contract"`
+	Hash     string `json:"hash"`
+	// Path is the path of a file on the host of the node verified instead of the hash.
+	Path string `json:"path"`
+}
+
+type AnchorRecordResp struct {
+	Hash      string `json:"hash"`
+	Owner     string `json:"owner"`
+	Height    uint64 `json:"height"`
+	BlockHash string `json:"block_hash"`
+	Timestamp uint64 `json:"timestamp"`
+	Metadata  string `json:"metadata"`
+}
+
+// hashFile returns the SHA256 hash of the content of the file.
+func hashFile(path string) (common.Hash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return common.Hash{}, xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return common.Hash{}, xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	return common.Bytes2Hash(h.Sum(nil)), nil
+}
+
+func parseDocumentHash(s string) (common.Hash, error) {
+	if s == "" {
+		return common.Hash{}, xfsgo.NewRPCError(-1006, "hash not be empty")
+	}
+	bs, err := decodeHexArg(s)
+	if err != nil || len(bs) != len(common.Hash{}) {
+		return common.Hash{}, xfsgo.NewRPCError(-1006, "invalid hash")
+	}
+	return common.Bytes2Hash(bs), nil
+}
+
+// Store sends a transaction anchoring the document hash to the anchor contract.
+func (handler *AnchorAPIHandler) Store(args AnchorStoreArgs, resp *string) error {
+	hash, err := parseDocumentHash(args.Hash)
+	if err != nil {
+		return err
+	}
+	txHash, err := handler.store("Anchor.Store", args.Contract, args.From, hash, args.Metadata, args.GasLimit, args.GasPrice)
+	if err != nil {
+		return err
+	}
+	*resp = txHash.Hex()
+	return nil
+}
+
+// AnchorFile hashes the local file and sends a transaction anchoring its hash to the
+// anchor contract.
+func (handler *AnchorAPIHandler) AnchorFile(args AnchorFileArgs, resp **AnchorFileResp) error {
+	if args.Path == "" {
+		return xfsgo.NewRPCError(-1006, "path not be empty")
+	}
+	hash, err := hashFile(args.Path)
+	if err != nil {
+		return err
+	}
+	txHash, err := handler.store("Anchor.AnchorFile", args.Contract, args.From, hash, args.Metadata, args.GasLimit, args.GasPrice)
+	if err != nil {
+		return err
+	}
+	*resp = &AnchorFileResp{
+		Hash:        hash.Hex(),
+		Transaction: txHash.Hex(),
+	}
+	return nil
+}
+
+func (handler *AnchorAPIHandler) store(origin, contract, from string, hash common.Hash, metadata, gasLimit, gasPrice string) (common.Hash, error) {
+	if err := checkSynced(handler.BlockChain); err != nil {
+		return common.Hash{}, err
+	}
+	anchor, err := parseContractAddress(contract)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	fromAddr := handler.Wallet.GetDefault()
+	if from != "" {
+		if err = common.AddrCalibrator(from); err != nil {
+			return common.Hash{}, xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		fromAddr = common.B58ToAddress([]byte(from))
+	}
+	privateKey, err := handler.Wallet.GetKeyByAddress(fromAddr)
+	if err != nil {
+		return common.Hash{}, xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	data, err := vm.EncodeCall("Store", vm.CTypeUint256(hash), vm.CTypeString(metadata))
+	if err != nil {
+		return common.Hash{}, xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	stdTx := &xfsgo.StdTransaction{
+		To:    anchor,
+		Data:  data,
+		Value: new(big.Int),
+	}
+	if gasLimit != "" {
+		stdTx.GasLimit = common.ParseString2BigInt(gasLimit)
+	} else {
+		stdTx.GasLimit = new(big.Int).Add(common.CalcTxInitialCost(data), anchorStoreGas)
+	}
+	if gasPrice != "" {
+		gaspriceBig, ok := new(big.Int).SetString(gasPrice, 10)
+		if !ok {
+			return common.Hash{}, xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		stdTx.GasPrice = common.NanoCoin2Atto(gaspriceBig)
+	} else {
+		stdTx.GasPrice = common.DefaultGasPrice()
+	}
+	wallet := &WalletHandler{
+		Wallet:        handler.Wallet,
+		BlockChain:    handler.BlockChain,
+		TxPendingPool: handler.TxPendingPool,
+	}
+	result, err := wallet.sendSigned(origin, fromAddr, "", stdTx, true, privateKey)
+	if err != nil {
+		return common.Hash{}, txError(-1006, err)
+	}
+	return result, nil
+}
+
+// Verify returns the anchor of the document hash, or of the hash of the local file, on
+// the current state.
+func (handler *AnchorAPIHandler) Verify(ctx context.Context, args AnchorVerifyArgs, resp **AnchorRecordResp) error {
+	anchor, err := parseContractAddress(args.Contract)
+	if err != nil {
+		return err
+	}
+	var hash common.Hash
+	if args.Path != "" {
+		hash, err = hashFile(args.Path)
+	} else {
+		hash, err = parseDocumentHash(args.Hash)
+	}
+	if err != nil {
+		return err
+	}
+	input, err := vm.EncodeCall("Verify", vm.CTypeUint256(hash))
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	contracts := &ContractAPIHandler{
+		StateDb:    handler.StateDb,
+		BlockChain: handler.BlockChain,
+	}
+	header := handler.BlockChain.CurrentBHeader()
+	stateTree := contracts.openState(ctx, header)
+	mVm := contracts.newVM(ctx, stateTree, header)
+	mVm.SetGas(header.GasLimit.Uint64())
+	if err = mVm.StaticCall(common.Address{}, anchor, input); err != nil {
+		return xfsgo.NewRPCErrorData(-1006, err, newVMErrorResp(err))
+	}
+	record, err := vm.DecodeAnchorRecord(hash, mVm.ReturnData())
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	result := &AnchorRecordResp{
+		Hash:      record.Hash.Hex(),
+		Owner:     record.Owner.B58String(),
+		Height:    record.Height,
+		Timestamp: record.Timestamp,
+		Metadata:  record.Metadata,
+	}
+	if block := handler.BlockChain.GetBlockHeaderByNumber(record.Height); block != nil {
+		blockHash := block.HeaderHash()
+		result.BlockHash = blockHash.Hex()
+	}
+	*resp = result
+	return nil
+}
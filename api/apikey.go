@@ -0,0 +1,104 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"sort"
+	"strconv"
+	"xfsgo"
+)
+
+// APIKeyHandler is the admin service managing the api keys of the RPC server.
+type APIKeyHandler struct {
+	Store *xfsgo.APIKeyStore
+}
+
+type CreateAPIKeyArgs struct {
+	Name string `json:"name"`
+	// Quotas maps method names to the number of calls allowed per day
+	Quotas map[string]string `json:"quotas"`
+}
+
+type APIKeyArgs struct {
+	Key string `json:"key"`
+}
+
+type APIKeyResp struct {
+	Key      string            `json:"key"`
+	Name     string            `json:"name"`
+	Created  int64             `json:"created"`
+	Revoked  bool              `json:"revoked"`
+	Quotas   map[string]uint64 `json:"quotas,omitempty"`
+	Usage    map[string]uint64 `json:"usage,omitempty"`
+	DayUsage map[string]uint64 `json:"day_usage,omitempty"`
+}
+
+func coverAPIKey2Resp(key *xfsgo.APIKey) *APIKeyResp {
+	return &APIKeyResp{
+		Key:      key.Key,
+		Name:     key.Name,
+		Created:  key.Created,
+		Revoked:  key.Revoked,
+		Quotas:   key.Quotas,
+		Usage:    key.Usage,
+		DayUsage: key.DayUsage,
+	}
+}
+
+func (handler *APIKeyHandler) Create(args CreateAPIKeyArgs, resp **APIKeyResp) error {
+	quotas := make(map[string]uint64, len(args.Quotas))
+	for method, quota := range args.Quotas {
+		n, err := strconv.ParseUint(quota, 10, 64)
+		if err != nil {
+			return xfsgo.NewRPCError(-32602, "invalid quota of method "+method)
+		}
+		quotas[method] = n
+	}
+	key, err := handler.Store.Create(args.Name, quotas)
+	if err != nil {
+		return errorcase(err)
+	}
+	*resp = coverAPIKey2Resp(key)
+	return nil
+}
+
+func (handler *APIKeyHandler) Revoke(args APIKeyArgs, resp *string) error {
+	return errorcase(handler.Store.Revoke(args.Key))
+}
+
+// Get returns the api key with its usage counters.
+func (handler *APIKeyHandler) Get(args APIKeyArgs, resp **APIKeyResp) error {
+	key, err := handler.Store.Get(args.Key)
+	if err != nil {
+		return errorcase(err)
+	}
+	*resp = coverAPIKey2Resp(key)
+	return nil
+}
+
+func (handler *APIKeyHandler) List(_ EmptyArgs, resp *[]*APIKeyResp) error {
+	keys := handler.Store.List()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Created < keys[j].Created
+	})
+	result := make([]*APIKeyResp, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, coverAPIKey2Resp(key))
+	}
+	*resp = result
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+package api
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"xfsgo"
+	"xfsgo/common"
+)
+
+// ResponseCache caches the results of expensive deterministic calls, every result
+// is keyed by the method and its parameters and belongs to the block it is read from.
+// The results of the blocks dropped from the canonical chain are invalidated.
+// A nil cache caches nothing.
+type ResponseCache struct {
+	mu      sync.Mutex
+	limit   int
+	lru     *list.List
+	entries map[string]*list.Element
+	blocks  map[common.Hash]map[string]struct{}
+	hits    uint64
+	misses  uint64
+}
+
+type responseCacheEntry struct {
+	key   string
+	block common.Hash
+	value interface{}
+}
+
+// NewResponseCache creates a cache keeping up to limit results, it returns nil if the
+// limit is not positive.
+func NewResponseCache(limit int) *ResponseCache {
+	if limit <= 0 {
+		return nil
+	}
+	return &ResponseCache{
+		limit:   limit,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		blocks:  make(map[common.Hash]map[string]struct{}),
+	}
+}
+
+// Watch invalidates the results of the blocks dropped by the reorgs published on the bus.
+func (c *ResponseCache) Watch(eventBus *xfsgo.EventBus) {
+	if c == nil {
+		return
+	}
+	go c.invalidateLoop(eventBus)
+}
+
+func (c *ResponseCache) invalidateLoop(eventBus *xfsgo.EventBus) {
+	reorgSub := eventBus.Subscript(xfsgo.ChainReorgEvent{})
+	defer reorgSub.Unsubscribe()
+	for e := range reorgSub.Chan() {
+		for _, hash := range e.(xfsgo.ChainReorgEvent).Dropped {
+			c.InvalidateBlock(hash)
+		}
+	}
+}
+
+func responseCacheKey(method string, args interface{}) string {
+	bs, _ := json.Marshal(args)
+	return method + ":" + string(bs)
+}
+
+func (c *ResponseCache) get(method string, args interface{}) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, exists := c.entries[responseCacheKey(method, args)]
+	if !exists {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*responseCacheEntry).value, true
+}
+
+func (c *ResponseCache) put(method string, args interface{}, block common.Hash, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := responseCacheKey(method, args)
+	if elem, exists := c.entries[key]; exists {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&responseCacheEntry{
+		key:   key,
+		block: block,
+		value: value,
+	})
+	keys, exists := c.blocks[block]
+	if !exists {
+		keys = make(map[string]struct{})
+		c.blocks[block] = keys
+	}
+	keys[key] = struct{}{}
+	for c.lru.Len() > c.limit {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *ResponseCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*responseCacheEntry)
+	delete(c.entries, entry.key)
+	if keys, exists := c.blocks[entry.block]; exists {
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(c.blocks, entry.block)
+		}
+	}
+}
+
+// InvalidateBlock removes the results read from the block.
+func (c *ResponseCache) InvalidateBlock(hash common.Hash) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.blocks[hash] {
+		c.remove(c.entries[key])
+	}
+}
+
+// Len returns the number of the cached results.
+func (c *ResponseCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Stats returns the number of the cache hits and misses.
+func (c *ResponseCache) Stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
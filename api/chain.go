@@ -18,7 +18,10 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"math/big"
 	"strconv"
 	"xfsgo"
@@ -31,15 +34,26 @@ import (
 type ChainAPIHandler struct {
 	BlockChain    *xfsgo.BlockChain
 	TxPendingPool *xfsgo.TxPool
-	number        int
+	// Cache caches the results read from blocks by hash if set
+	Cache  *ResponseCache
+	number int
 }
 
+// CancellableMethods lists the methods which stop reading the range at the end of the call.
+func (handler *ChainAPIHandler) CancellableMethods() []string {
+	return []string{"GetHeadersByRange"}
+}
+
+// GetBlockByNumArgs and GetBlockByHashArgs return the hashes of the transactions of the
+// block instead of the transactions with TxHashes set.
 type GetBlockByNumArgs struct {
-	Number string `json:"number"`
+	Number   string `json:"number"`
+	TxHashes bool   `json:"tx_hashes"`
 }
 
 type GetBlockByHashArgs struct {
-	Hash string `json:"hash"`
+	Hash     string `json:"hash"`
+	TxHashes bool   `json:"tx_hashes"`
 }
 
 type GetTxsByBlockNumArgs struct {
@@ -79,6 +93,35 @@ type GetBlocksArgs struct {
 	Blocks string `json:"blocks"`
 }
 
+type GetStatsArgs struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type ChainStatsResp struct {
+	From            uint64 `json:"from"`
+	To              uint64 `json:"to"`
+	Blocks          uint64 `json:"blocks"`
+	TxCount         uint64 `json:"tx_count"`
+	AvgBlockTime    string `json:"avg_block_time"`
+	TxPerSecond     string `json:"tx_per_second"`
+	AvgGasUsed      string `json:"avg_gas_used"`
+	StartDifficulty string `json:"start_difficulty"`
+	EndDifficulty   string `json:"end_difficulty"`
+	AvgDifficulty   string `json:"avg_difficulty"`
+	HashRate        string `json:"hash_rate"`
+}
+
+type GetNetworkHashRateArgs struct {
+	Window string `json:"window"`
+}
+
+// defaultHashRateWindow is the number of latest blocks GetNetworkHashRate covers by default.
+const defaultHashRateWindow = 120
+
+// defaultStatsBlocks is the number of latest blocks GetStats covers when no range is given.
+const defaultStatsBlocks = 100
+
 type ProgressBarArgs struct {
 	Number int `json:"number"`
 }
@@ -105,7 +148,7 @@ type GetBlockHashesArgs struct {
 	Count  string `json:"count"`
 }
 
-func (handler *ChainAPIHandler) GetBlockByNumber(args GetBlockByNumArgs, resp **BlockResp) error {
+func (handler *ChainAPIHandler) GetBlockByNumber(ctx context.Context, args GetBlockByNumArgs, resp **BlockResp) error {
 	var last uint64
 	if args.Number == "" {
 		last = handler.BlockChain.CurrentBHeader().Height
@@ -116,8 +159,25 @@ func (handler *ChainAPIHandler) GetBlockByNumber(args GetBlockByNumArgs, resp **
 		}
 		last = number.Uint64()
 	}
-	gotBlock := handler.BlockChain.GetBlockByNumber(last)
-	return coverBlock2Resp(gotBlock, resp)
+	var gotBlock *xfsgo.Block
+	_ = traced(ctx, "db.get_block", func() error {
+		gotBlock = handler.BlockChain.GetBlockByNumber(last)
+		return nil
+	})
+	if err := coverBlock2Resp(gotBlock, !args.TxHashes, resp); err != nil {
+		return err
+	}
+	handler.setCanonical(*resp)
+	return nil
+}
+
+// setCanonical fills the canonical fields of the block.
+func (handler *ChainAPIHandler) setCanonical(block *BlockResp) {
+	if block == nil {
+		return
+	}
+	block.CanonicalHash, _ = handler.BlockChain.GetCanonicalHash(block.Height)
+	block.Canonical = block.CanonicalHash == block.Hash
 }
 func (handler *ChainAPIHandler) GetBlockHashes(args GetBlockHashesArgs, resp *[]common.Hash) error {
 	start, _ := strconv.ParseUint(args.Number, 10, 64)
@@ -183,15 +243,33 @@ func (handler *ChainAPIHandler) GetBlockHeaderByHash(args GetBlockHeaderByHashAr
 	return coverBlockHeader2Resp(goBlock, resp)
 }
 
-func (handler *ChainAPIHandler) GetBlockByHash(args GetBlockByHashArgs, resp **BlockResp) error {
+func (handler *ChainAPIHandler) GetBlockByHash(ctx context.Context, args GetBlockByHashArgs, resp **BlockResp) error {
 	if args.Hash == "" {
 		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
 	}
 	if err := common.HashCalibrator(args.Hash); err != nil {
 		return xfsgo.NewRPCErrorCause(-32001, err)
 	}
-	gotBlock := handler.BlockChain.GetBlockByHash(common.Hex2Hash(args.Hash))
-	return coverBlock2Resp(gotBlock, resp)
+	hash := common.Hex2Hash(args.Hash)
+	if cached, ok := handler.Cache.get("GetBlockByHash", args); ok {
+		*resp = cached.(*BlockResp)
+		return nil
+	}
+	var gotBlock *xfsgo.Block
+	_ = traced(ctx, "db.get_block", func() error {
+		gotBlock = handler.BlockChain.GetBlockByHash(hash)
+		return nil
+	})
+	if err := coverBlock2Resp(gotBlock, !args.TxHashes, resp); err != nil {
+		return err
+	}
+	handler.setCanonical(*resp)
+	// the results of the blocks dropped by a reorg are invalidated, those of the blocks
+	// out of the main chain are not cached since a reorg could make them canonical
+	if *resp != nil && (*resp).Canonical {
+		handler.Cache.put("GetBlockByHash", args, hash, *resp)
+	}
+	return nil
 
 }
 
@@ -220,11 +298,20 @@ func (handler *ChainAPIHandler) GetTxsByBlockHash(args GetTxbyBlockHashArgs, res
 	if err := common.HashCalibrator(args.Hash); err != nil {
 		return xfsgo.NewRPCErrorCause(-32001, err)
 	}
-	blk := handler.BlockChain.GetBlockByHash(common.Hex2Hash(args.Hash))
+	hash := common.Hex2Hash(args.Hash)
+	if cached, ok := handler.Cache.get("GetTxsByBlockHash", hash); ok {
+		*resp = cached.(*TransactionsResp)
+		return nil
+	}
+	blk := handler.BlockChain.GetBlockByHash(hash)
 	if blk == nil {
 		return xfsgo.NewRPCError(-1006, "Not found block")
 	}
-	return coverTxs2Resp(blk.Transactions, resp)
+	if err := coverTxs2Resp(blk.Transactions, resp); err != nil {
+		return err
+	}
+	handler.Cache.put("GetTxsByBlockHash", hash, hash, *resp)
+	return nil
 }
 
 func (handler *ChainAPIHandler) GetReceiptByHash(args GetReceiptByHashArgs, resp **ReceiptResp) error {
@@ -234,14 +321,24 @@ func (handler *ChainAPIHandler) GetReceiptByHash(args GetReceiptByHashArgs, resp
 	if err := common.HashCalibrator(args.Hash); err != nil {
 		return xfsgo.NewRPCErrorCause(-32001, err)
 	}
-	dataReceipt := handler.BlockChain.GetReceiptByHash(common.Hex2Hash(args.Hash))
+	txHash := common.Hex2Hash(args.Hash)
+	if cached, ok := handler.Cache.get("GetReceiptByHash", txHash); ok {
+		*resp = cached.(*ReceiptResp)
+		return nil
+	}
+	dataReceipt := handler.BlockChain.GetReceiptByHash(txHash)
 	if dataReceipt == nil {
 		return xfsgo.NewRPCError(-1006, "Not found")
 	}
-	dataReceiptIndex := handler.BlockChain.GetReceiptByHashIndex(common.Hex2Hash(args.Hash))
+	dataReceiptIndex := handler.BlockChain.GetReceiptByHashIndex(txHash)
 	if dataReceiptIndex == nil {
 		return xfsgo.NewRPCError(-1006, "Not found")
 	}
+	// the receipts of the block carry the position of the logs in the chain
+	receipts := handler.BlockChain.GetBlockReceiptsByBHash(dataReceiptIndex.BlockHash)
+	if i := dataReceiptIndex.Index; i < uint64(len(receipts)) && receipts[i].TxHash == txHash {
+		dataReceipt = receipts[i]
+	}
 	data := &ReceiptResp{
 		Version:    dataReceipt.Version,
 		Status:     dataReceipt.Status,
@@ -250,9 +347,15 @@ func (handler *ChainAPIHandler) GetReceiptByHash(args GetReceiptByHashArgs, resp
 		BlockHash:  dataReceiptIndex.BlockHash,
 		BlockIndex: dataReceiptIndex.BlockIndex,
 		TxIndex:    dataReceiptIndex.Index,
+		VMError:    dataReceipt.VMError,
+		Logs:       coverLogs2Resp(dataReceipt.Logs),
+		Bloom:      dataReceipt.Bloom,
 	}
-
-	return coverReceipt(data, resp)
+	if err := coverReceipt(data, resp); err != nil {
+		return err
+	}
+	handler.Cache.put("GetReceiptByHash", txHash, dataReceiptIndex.BlockHash, *resp)
+	return nil
 }
 
 func (handler *ChainAPIHandler) GetTransaction(args GetTransactionArgs, resp **TransactionResp) error {
@@ -380,6 +483,64 @@ func (handler *ChainAPIHandler) ImportBlock(args GetBlocksArgs, resp *string) er
 	return nil
 }
 
+// GetStats returns statistics about block time, throughput, gas usage and difficulty
+// over the range of blocks from from to to inclusive, by default the latest blocks.
+func (handler *ChainAPIHandler) GetStats(args GetStatsArgs, resp **ChainStatsResp) error {
+	current := handler.BlockChain.CurrentBHeader().Height
+	to := current
+	if args.To != "" {
+		num, ok := new(big.Int).SetString(args.To, 0)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		to = num.Uint64()
+	}
+	var from uint64
+	if to >= defaultStatsBlocks {
+		from = to - defaultStatsBlocks + 1
+	}
+	if args.From != "" {
+		num, ok := new(big.Int).SetString(args.From, 0)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		from = num.Uint64()
+	}
+	stats, err := handler.BlockChain.GetStats(from, to)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	*resp = &ChainStatsResp{
+		From:            stats.From,
+		To:              stats.To,
+		Blocks:          stats.Blocks,
+		TxCount:         stats.TxCount,
+		AvgBlockTime:    fmt.Sprintf("%.2f", stats.AvgBlockTime),
+		TxPerSecond:     fmt.Sprintf("%.4f", stats.TxPerSecond),
+		AvgGasUsed:      stats.AvgGasUsed.Text(10),
+		StartDifficulty: fmt.Sprintf("%.4f", stats.StartDifficulty),
+		EndDifficulty:   fmt.Sprintf("%.4f", stats.EndDifficulty),
+		AvgDifficulty:   fmt.Sprintf("%.4f", stats.AvgDifficulty),
+		HashRate:        fmt.Sprintf("%.2f", float64(stats.HashRate)),
+	}
+	return nil
+}
+
+// GetNetworkHashRate returns the network hash rate estimated from the difficulty bits and
+// timestamps of the trailing window of blocks.
+func (handler *ChainAPIHandler) GetNetworkHashRate(args GetNetworkHashRateArgs, resp *string) error {
+	window := uint64(defaultHashRateWindow)
+	if args.Window != "" {
+		num, err := strconv.ParseUint(args.Window, 10, 64)
+		if err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+		window = num
+	}
+	*resp = fmt.Sprintf("%.2f", float64(handler.BlockChain.NetworkHashRate(window)))
+	return nil
+}
+
 func (handler *ChainAPIHandler) ProgressBar(_ EmptyArgs, resp *string) error {
 	total := strconv.Itoa(handler.number)
 	*resp = total
@@ -447,3 +608,476 @@ func (handler *ChainAPIHandler) GetBlockTxByNumAndIndex(args GetBlockTxByNumAndI
 	tx := gotBlock.Transactions[args.Index]
 	return coverTx2Resp(tx, &resp)
 }
+
+type GetHeaderCommitmentArgs struct {
+	Number string `json:"number"`
+}
+
+type GetAncestorProofArgs struct {
+	Number string `json:"number"`
+	Head   string `json:"head"`
+}
+
+type HeaderCommitmentResp struct {
+	Height uint64 `json:"height"`
+	Hash   string `json:"hash"`
+	Root   string `json:"root"`
+}
+
+type AncestorProofResp struct {
+	Number   uint64                `json:"number"`
+	Hash     string                `json:"hash"`
+	Head     *HeaderCommitmentResp `json:"head"`
+	Size     uint64                `json:"size"`
+	Siblings []string              `json:"siblings"`
+	Peaks    []string              `json:"peaks"`
+}
+
+func coverHeaderCommitment2Resp(c *xfsgo.HeaderCommitment) *HeaderCommitmentResp {
+	return &HeaderCommitmentResp{
+		Height: c.Height,
+		Hash:   c.Hash.Hex(),
+		Root:   c.Root.Hex(),
+	}
+}
+
+func hashes2Hex(hashes [][]byte) []string {
+	result := make([]string, len(hashes))
+	for i, hash := range hashes {
+		h := common.Bytes2Hash(hash)
+		result[i] = h.Hex()
+	}
+	return result
+}
+
+// parseNumberOrHead parses a block number, the number of the head block is returned
+// when it is empty.
+func (handler *ChainAPIHandler) parseNumberOrHead(s string) (uint64, error) {
+	if s == "" {
+		return handler.BlockChain.CurrentBHeader().Height, nil
+	}
+	number, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return 0, xfsgo.NewRPCError(-1006, "string to big.Int error")
+	}
+	return number.Uint64(), nil
+}
+
+// GetHeaderCommitment returns the root of the merkle mountain range over the main chain
+// headers from the genesis block to the block with the given number.
+func (handler *ChainAPIHandler) GetHeaderCommitment(args GetHeaderCommitmentArgs, resp **HeaderCommitmentResp) error {
+	number, err := handler.parseNumberOrHead(args.Number)
+	if err != nil {
+		return err
+	}
+	commitment, err := handler.BlockChain.GetHeaderCommitment(number)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	*resp = coverHeaderCommitment2Resp(commitment)
+	return nil
+}
+
+// GetAncestorProof returns the proof that the main chain block with the given number is
+// an ancestor of the head block, verified against the header commitment of head.
+func (handler *ChainAPIHandler) GetAncestorProof(args GetAncestorProofArgs, resp **AncestorProofResp) error {
+	if args.Number == "" {
+		return xfsgo.NewRPCError(-1006, "number not be empty")
+	}
+	number, err := handler.parseNumberOrHead(args.Number)
+	if err != nil {
+		return err
+	}
+	head, err := handler.parseNumberOrHead(args.Head)
+	if err != nil {
+		return err
+	}
+	proof, err := handler.BlockChain.ProveAncestor(number, head)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	*resp = &AncestorProofResp{
+		Number:   proof.Number,
+		Hash:     proof.Hash.Hex(),
+		Head:     coverHeaderCommitment2Resp(proof.Head),
+		Size:     proof.Proof.Size,
+		Siblings: hashes2Hex(proof.Proof.Siblings),
+		Peaks:    hashes2Hex(proof.Proof.Peaks),
+	}
+	return nil
+}
+
+type GetAccountHistoryArgs struct {
+	Address string `json:"address"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+type AccountEventResp struct {
+	Height       uint64 `json:"height"`
+	BlockHash    string `json:"block_hash"`
+	Timestamp    uint64 `json:"timestamp"`
+	TxHash       string `json:"tx_hash,omitempty"`
+	Kind         string `json:"kind"`
+	Counterparty string `json:"counterparty,omitempty"`
+	Amount       string `json:"amount"`
+	Fee          string `json:"fee"`
+	Status       uint32 `json:"status"`
+}
+
+// AccountHistoryResp is the ledger of an account, the totals are the sums of the
+// amounts of the events by kind and of the fees paid.
+type AccountHistoryResp struct {
+	Address  string              `json:"address"`
+	From     uint64              `json:"from"`
+	To       uint64              `json:"to"`
+	Received string              `json:"received"`
+	Sent     string              `json:"sent"`
+	Fees     string              `json:"fees"`
+	Rewards  string              `json:"rewards"`
+	Events   []*AccountEventResp `json:"events"`
+}
+
+func coverAccountEvent2Resp(e *xfsgo.AccountEvent) *AccountEventResp {
+	result := &AccountEventResp{
+		Height:    e.Height,
+		BlockHash: e.BlockHash.Hex(),
+		Timestamp: e.Timestamp,
+		Kind:      e.Kind,
+		Amount:    e.Amount.Text(10),
+		Fee:       e.Fee.Text(10),
+		Status:    e.Status,
+	}
+	if e.Kind != xfsgo.AccountEventCoinbase {
+		result.TxHash = e.TxHash.Hex()
+		result.Counterparty = e.Counterparty.B58String()
+	}
+	return result
+}
+
+// GetAccountHistory returns the main chain events changing the balance of the address
+// in the block range from and to: sent and received transaction value, the fees paid and
+// the coinbase rewards, with the block timestamps. The range defaults to the whole chain.
+func (handler *ChainAPIHandler) GetAccountHistory(args GetAccountHistoryArgs, resp **AccountHistoryResp) error {
+	if args.Address == "" {
+		return xfsgo.NewRPCError(-1006, "address not be empty")
+	}
+	if err := common.AddrCalibrator(args.Address); err != nil {
+		return xfsgo.NewRPCErrorCause(-6001, err)
+	}
+	addr := common.B58ToAddress([]byte(args.Address))
+	var from uint64
+	if args.From != "" {
+		number, ok := new(big.Int).SetString(args.From, 0)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		from = number.Uint64()
+	}
+	to, err := handler.parseNumberOrHead(args.To)
+	if err != nil {
+		return err
+	}
+	events, err := handler.BlockChain.GetAccountHistory(addr, from, to)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	received, sent, fees, rewards := new(big.Int), new(big.Int), new(big.Int), new(big.Int)
+	result := &AccountHistoryResp{
+		Address: args.Address,
+		From:    from,
+		To:      to,
+		Events:  make([]*AccountEventResp, len(events)),
+	}
+	for i, e := range events {
+		switch e.Kind {
+		case xfsgo.AccountEventReceive:
+			received.Add(received, e.Amount)
+		case xfsgo.AccountEventSend:
+			sent.Add(sent, e.Amount)
+		case xfsgo.AccountEventCoinbase:
+			rewards.Add(rewards, e.Amount)
+		}
+		fees.Add(fees, e.Fee)
+		result.Events[i] = coverAccountEvent2Resp(e)
+	}
+	result.Received = received.Text(10)
+	result.Sent = sent.Text(10)
+	result.Fees = fees.Text(10)
+	result.Rewards = rewards.Text(10)
+	*resp = result
+	return nil
+}
+
+type GetBlockRewardArgs struct {
+	Number string `json:"number"`
+}
+
+type BlockRewardResp struct {
+	Height   uint64                `json:"height"`
+	Reward   string                `json:"reward"`
+	Schedule *xfsgo.RewardSchedule `json:"schedule"`
+}
+
+// GetBlockReward returns the subsidy of the block with the given number by the reward
+// schedule of the chain config, the number defaults to the next block.
+func (handler *ChainAPIHandler) GetBlockReward(args GetBlockRewardArgs, resp **BlockRewardResp) error {
+	var number uint64
+	if args.Number == "" {
+		number = handler.BlockChain.CurrentBHeader().Height + 1
+	} else {
+		n, ok := new(big.Int).SetString(args.Number, 0)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		number = n.Uint64()
+	}
+	*resp = &BlockRewardResp{
+		Height:   number,
+		Reward:   handler.BlockChain.GetBlockReward(number).Text(10),
+		Schedule: handler.BlockChain.ChainConfig().Reward,
+	}
+	return nil
+}
+
+type GetRandomnessArgs struct {
+	Number string `json:"number"`
+}
+
+type RandomnessResp struct {
+	Height     uint64      `json:"height"`
+	Randomness common.Hash `json:"randomness"`
+}
+
+// GetRandomness returns the randomness the contracts of the block with the given number
+// are executed with, the number defaults to the next block. It is mixed from the headers
+// of the previous blocks and the miners can bias it, it only suits low stakes uses.
+func (handler *ChainAPIHandler) GetRandomness(args GetRandomnessArgs, resp **RandomnessResp) error {
+	var number uint64
+	if args.Number == "" {
+		number = handler.BlockChain.CurrentBHeader().Height + 1
+	} else {
+		n, ok := new(big.Int).SetString(args.Number, 0)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		number = n.Uint64()
+	}
+	randomness, exists := handler.BlockChain.GetRandomness(number)
+	if !exists {
+		return xfsgo.NewRPCError(-1006, "block not found")
+	}
+	*resp = &RandomnessResp{
+		Height:     number,
+		Randomness: randomness,
+	}
+	return nil
+}
+
+type GetBlockWitnessArgs struct {
+	Hash string `json:"hash"`
+}
+
+type WitnessNodeResp struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type BlockWitnessResp struct {
+	Block      common.Hash        `json:"block"`
+	Root       common.Hash        `json:"root"`
+	Randomness common.Hash        `json:"randomness"`
+	Size       int                `json:"size"`
+	Verified   bool               `json:"verified"`
+	Nodes      []*WitnessNodeResp `json:"nodes"`
+}
+
+// GetBlockWitness returns the state witness of the block, every state node read while
+// executing the block on the state of its parent. The witness is verified by executing
+// the block against the witness only.
+func (handler *ChainAPIHandler) GetBlockWitness(args GetBlockWitnessArgs, resp **BlockWitnessResp) error {
+	if args.Hash == "" {
+		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
+	}
+	if err := common.HashCalibrator(args.Hash); err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	hash := common.Hex2Hash(args.Hash)
+	if cached, ok := handler.Cache.get("GetBlockWitness", hash); ok {
+		*resp = cached.(*BlockWitnessResp)
+		return nil
+	}
+	block := handler.BlockChain.GetBlockByHash(hash)
+	if block == nil {
+		return xfsgo.NewRPCError(-1006, "block not found")
+	}
+	witness, err := handler.BlockChain.GetBlockWitness(hash)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	result := &BlockWitnessResp{
+		Block:      witness.Block,
+		Root:       witness.Root,
+		Randomness: witness.Randomness,
+		Size:       witness.Size(),
+		Verified:   xfsgo.VerifyWitness(handler.BlockChain.ChainConfig(), witness, block) == nil,
+		Nodes:      make([]*WitnessNodeResp, 0, len(witness.Nodes)),
+	}
+	for _, node := range witness.Nodes {
+		result.Nodes = append(result.Nodes, &WitnessNodeResp{
+			Key:   "0x" + hex.EncodeToString(node.Key),
+			Value: "0x" + hex.EncodeToString(node.Value),
+		})
+	}
+	handler.Cache.put("GetBlockWitness", hash, hash, result)
+	*resp = result
+	return nil
+}
+
+// GetBlockReceiptsArgs selects a block by its hash or number, the head block when empty.
+type GetBlockReceiptsArgs struct {
+	Block string `json:"block"`
+}
+
+// GetBlockReceipts returns the receipts of all transactions of a block in the order of
+// the transactions.
+func (handler *ChainAPIHandler) GetBlockReceipts(args GetBlockReceiptsArgs, resp *[]*ReceiptResp) error {
+	var block *xfsgo.Block
+	if common.HashCalibrator(args.Block) == nil {
+		block = handler.BlockChain.GetBlockByHash(common.Hex2Hash(args.Block))
+	} else {
+		number, err := handler.parseNumberOrHead(args.Block)
+		if err != nil {
+			return err
+		}
+		block = handler.BlockChain.GetBlockByNumber(number)
+	}
+	if block == nil {
+		return xfsgo.NewRPCError(-1006, "block not found")
+	}
+	hash := block.HeaderHash()
+	if cached, ok := handler.Cache.get("GetBlockReceipts", hash); ok {
+		*resp = cached.([]*ReceiptResp)
+		return nil
+	}
+	receipts := handler.BlockChain.GetBlockReceiptsByBHash(hash)
+	result := make([]*ReceiptResp, 0, len(receipts))
+	for i, receipt := range receipts {
+		result = append(result, &ReceiptResp{
+			Version:    receipt.Version,
+			Status:     receipt.Status,
+			TxHash:     receipt.TxHash,
+			GasUsed:    receipt.GasUsed,
+			BlockHash:  hash,
+			BlockIndex: block.Height(),
+			TxIndex:    uint64(i),
+			VMError:    receipt.VMError,
+			Logs:       coverLogs2Resp(receipt.Logs),
+			Bloom:      receipt.Bloom,
+		})
+	}
+	handler.Cache.put("GetBlockReceipts", hash, hash, result)
+	*resp = result
+	return nil
+}
+
+// maxHeadersRange is the maximum number of headers returned by GetHeadersByRange.
+const maxHeadersRange = 1024
+
+// chainSubscriptionNewHeads notifies the header of every new head block.
+const chainSubscriptionNewHeads = "newHeads"
+
+type GetHeadersByRangeArgs struct {
+	Start string `json:"start"`
+	Count string `json:"count"`
+}
+
+type ChainSubscribeArgs struct {
+	Kind string `json:"kind"`
+}
+
+type ChainUnsubscribeArgs struct {
+	Subscription string `json:"subscription"`
+}
+
+// GetHeadersByRange returns the headers of count main chain blocks from the start
+// height, without the bodies of the blocks. The range ends at the head block and is
+// capped to maxHeadersRange headers.
+func (handler *ChainAPIHandler) GetHeadersByRange(ctx context.Context, args GetHeadersByRangeArgs, resp *[]*BlockHeaderResp) error {
+	if args.Start == "" {
+		return xfsgo.NewRPCError(-1006, "start not be empty")
+	}
+	start, err := strconv.ParseUint(args.Start, 10, 64)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	count := uint64(maxHeadersRange)
+	if args.Count != "" {
+		if count, err = strconv.ParseUint(args.Count, 10, 64); err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+		if count > maxHeadersRange {
+			return xfsgo.NewRPCError(-1006, "count exceeds the maximum range")
+		}
+	}
+	result := make([]*BlockHeaderResp, 0)
+	head := handler.BlockChain.CurrentBHeader().Height
+	for number := start; number <= head && number-start < count; number++ {
+		if err = xfsgo.ContextError(ctx); err != nil {
+			return err
+		}
+		header := handler.BlockChain.GetBlockHeaderByNumber(number)
+		if header == nil {
+			break
+		}
+		var item *BlockHeaderResp
+		if err = coverHeader2Resp(header, &item); err != nil {
+			return err
+		}
+		result = append(result, item)
+	}
+	*resp = result
+	return nil
+}
+
+// Subscribe notifies the websocket client of the chain events of the kind, newHeads
+// delivers the header of every new head block. It returns the id of the subscription.
+func (handler *ChainAPIHandler) Subscribe(ctx context.Context, args ChainSubscribeArgs, resp *string) error {
+	notifier, ok := xfsgo.NotifierFromContext(ctx)
+	if !ok {
+		return xfsgo.ErrNotificationsUnsupported
+	}
+	if args.Kind != chainSubscriptionNewHeads {
+		return xfsgo.NewRPCError(-1006, "unknown subscription kind")
+	}
+	sub := handler.BlockChain.SubscribeChainHeadEvents()
+	*resp = notifier.Subscribe(func(notify xfsgo.NotifyFn, quit <-chan struct{}) {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case e := <-sub.Chan():
+				event := e.(xfsgo.ChainHeadEvent)
+				var header *BlockHeaderResp
+				if err := coverBlockHeader2Resp(event.Block, &header); err != nil || header == nil {
+					continue
+				}
+				if err := notify(header); err != nil {
+					return
+				}
+			case <-quit:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Unsubscribe ends a subscription made on the same connection.
+func (handler *ChainAPIHandler) Unsubscribe(ctx context.Context, args ChainUnsubscribeArgs, resp *bool) error {
+	notifier, ok := xfsgo.NotifierFromContext(ctx)
+	if !ok {
+		return xfsgo.ErrNotificationsUnsupported
+	}
+	*resp = notifier.Unsubscribe(args.Subscription)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"xfsgo"
+	"xfsgo/common"
+)
+
+// ClusterAPIHandler reports the status of the node among its sibling nodes, if the
+// cluster is enabled, and the panics recovered in the node.
+type ClusterAPIHandler struct {
+	Cluster    *xfsgo.Cluster
+	BlockChain *xfsgo.BlockChain
+	Crashes    *xfsgo.CrashReporter
+}
+
+type ClusterStatusResp struct {
+	Height   uint64                 `json:"height"`
+	Hash     common.Hash            `json:"hash"`
+	Syncing  bool                   `json:"syncing"`
+	Siblings []*xfsgo.SiblingStatus `json:"siblings"`
+	// Freshest is the url of the healthy sibling with the highest head which is not
+	// syncing, it is empty if there is none.
+	Freshest string `json:"freshest,omitempty"`
+}
+
+// GetClusterStatus returns the head of the node and the heads and health of its siblings
+// seen by their last poll.
+func (handler *ClusterAPIHandler) GetClusterStatus(_ EmptyArgs, resp **ClusterStatusResp) error {
+	if handler.Cluster == nil {
+		return xfsgo.NewRPCError(-1006, "cluster not enabled")
+	}
+	head := handler.BlockChain.CurrentBHeader()
+	result := &ClusterStatusResp{
+		Height:   head.Height,
+		Hash:     head.HeaderHash(),
+		Syncing:  handler.BlockChain.Syncing() != nil,
+		Siblings: handler.Cluster.Status(),
+	}
+	var best *xfsgo.SiblingStatus
+	for _, s := range result.Siblings {
+		if s.Healthy && !s.Syncing && (best == nil || s.Height > best.Height) {
+			best = s
+		}
+	}
+	if best != nil {
+		result.Freshest = best.URL
+	}
+	*resp = result
+	return nil
+}
+
+// GetCrashReports returns the recent panics recovered in the rpc calls and the supervised
+// loops of the node, the oldest first.
+func (handler *ClusterAPIHandler) GetCrashReports(_ EmptyArgs, resp *[]*xfsgo.CrashReport) error {
+	if handler.Crashes == nil {
+		*resp = make([]*xfsgo.CrashReport, 0)
+		return nil
+	}
+	*resp = handler.Crashes.Reports()
+	return nil
+}
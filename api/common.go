@@ -1,6 +1,30 @@
 package api
 
-import "xfsgo"
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"xfsgo"
+	"xfsgo/trace"
+)
+
+// checkSynced returns the node is syncing error with the sync progress while the node is
+// behind the network, the current state and head it would answer from are stale.
+func checkSynced(bc *xfsgo.BlockChain) error {
+	if bc == nil {
+		return nil
+	}
+	progress := bc.Syncing()
+	if progress == nil {
+		return nil
+	}
+	return xfsgo.NewRPCErrorData(errCodeSyncing, errNodeSyncing, &SyncProgressResp{
+		StartingBlock: strconv.FormatUint(progress.Origin, 10),
+		CurrentBlock:  strconv.FormatUint(progress.Current, 10),
+		HighestBlock:  strconv.FormatUint(progress.Highest, 10),
+		Progress:      fmt.Sprintf("%.2f", progress.Percent()),
+	})
+}
 
 func errorcasefn(errfn func() error) error {
 	if err := errfn(); err != nil {
@@ -15,3 +39,14 @@ func errorcase(err error) error {
 	}
 	return nil
 }
+
+// traced runs fn within a span named name which is a child of the span of ctx.
+func traced(ctx context.Context, name string, fn func() error) error {
+	_, span := trace.Start(ctx, name)
+	defer span.Finish()
+	err := fn()
+	if err != nil {
+		span.SetError(err)
+	}
+	return err
+}
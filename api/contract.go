@@ -0,0 +1,558 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strconv"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/crypto"
+	"xfsgo/storage/badger"
+	"xfsgo/trace"
+	"xfsgo/vm"
+)
+
+type ContractAPIHandler struct {
+	StateDb    *badger.Storage
+	BlockChain *xfsgo.BlockChain
+}
+
+// CancellableMethods lists the methods whose vm stops at the end of the call.
+func (handler *ContractAPIHandler) CancellableMethods() []string {
+	return []string{"Call", "SimulateBundle", "EstimateGas"}
+}
+
+type ContractCallArgs struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+	Data  string `json:"data"`
+	Gas   string `json:"gas"`
+	// Overrides are keyed by the address of the overridden account
+	Overrides map[string]StateOverrideArgs `json:"overrides"`
+	// Breakdown adds the gas breakdown of the execution to the result
+	Breakdown bool `json:"breakdown"`
+	// Block pins the call to the state and the block context of the block with the
+	// hash or number, the call runs on the head block when empty.
+	Block string `json:"block"`
+}
+
+// StateOverrideArgs replaces parts of an account on the temporary state a simulation
+// is executed on. Storage maps hex encoded slot keys to hex encoded values.
+type StateOverrideArgs struct {
+	Balance string            `json:"balance"`
+	Nonce   string            `json:"nonce"`
+	Code    string            `json:"code"`
+	Storage map[string]string `json:"storage"`
+}
+
+type SimulateBundleArgs struct {
+	Messages  []ContractCallArgs           `json:"messages"`
+	Overrides map[string]StateOverrideArgs `json:"overrides"`
+	// Block pins the bundle like the block of a call, the blocks of the messages are ignored
+	Block string `json:"block"`
+}
+
+// VMErrorResp is the data of the rpc error returned for a failed contract execution.
+type VMErrorResp struct {
+	Code    int    `json:"vm_error"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+type MessageResultResp struct {
+	Status          uint32            `json:"status"`
+	GasUsed         string            `json:"gas_used"`
+	ReturnData      string            `json:"return_data,omitempty"`
+	ContractAddress string            `json:"contract_address,omitempty"`
+	Error           *VMErrorResp      `json:"error,omitempty"`
+	Breakdown       *GasBreakdownResp `json:"breakdown,omitempty"`
+}
+
+// GasBreakdownResp splits the gas used by an execution. Refund is the gas of the limit
+// not used by the execution, which is returned to the sender.
+type GasBreakdownResp struct {
+	Intrinsic string         `json:"intrinsic"`
+	Execution string         `json:"execution"`
+	Refund    string         `json:"refund"`
+	Calls     []*CallGasResp `json:"calls,omitempty"`
+}
+
+// CallGasResp is the gas used by a contract call, including the gas of its nested calls.
+type CallGasResp struct {
+	Type    string         `json:"type"`
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Value   string         `json:"value,omitempty"`
+	Gas     string         `json:"gas"`
+	GasUsed string         `json:"gas_used"`
+	Error   *VMErrorResp   `json:"error,omitempty"`
+	Calls   []*CallGasResp `json:"calls,omitempty"`
+}
+
+// CallResultResp is the result of a call with the gas breakdown requested.
+type CallResultResp struct {
+	ReturnData string            `json:"return_data"`
+	GasUsed    string            `json:"gas_used"`
+	Breakdown  *GasBreakdownResp `json:"breakdown"`
+}
+
+// GasEstimateResp is the gas estimate with the breakdown of the execution at that gas.
+type GasEstimateResp struct {
+	Gas       string            `json:"gas"`
+	Breakdown *GasBreakdownResp `json:"breakdown"`
+}
+
+type contractMessage struct {
+	from      common.Address
+	to        common.Address
+	value     *big.Int
+	data      []byte
+	gas       uint64
+	overrides map[string]StateOverrideArgs
+	breakdown bool
+}
+
+var (
+	errMessageTransfer = errors.New("from balance is not enough")
+	errMessageExtraGas = errors.New("gas limit too low for the extra data")
+)
+
+func decodeHexArg(s string) ([]byte, error) {
+	if len(s) > 1 && s[0] == '0' && s[1] == 'x' {
+		s = s[2:]
+	}
+	return hex.DecodeString(s)
+}
+
+func newVMErrorResp(err error) *VMErrorResp {
+	code := vm.ErrorCode(err)
+	return &VMErrorResp{
+		Code:    code,
+		Name:    vm.ErrorCodeName(code),
+		Message: err.Error(),
+	}
+}
+
+func parseOptionalAddress(s string) (common.Address, error) {
+	if s == "" {
+		return common.Address{}, nil
+	}
+	if err := common.AddrCalibrator(s); err != nil {
+		return common.Address{}, xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	return common.B58ToAddress([]byte(s)), nil
+}
+
+func parseContractMessage(args ContractCallArgs, defaultGas uint64) (*contractMessage, error) {
+	var (
+		msg = &contractMessage{value: new(big.Int), gas: defaultGas}
+		err error
+	)
+	if msg.from, err = parseOptionalAddress(args.From); err != nil {
+		return nil, err
+	}
+	if msg.to, err = parseOptionalAddress(args.To); err != nil {
+		return nil, err
+	}
+	if args.Value != "" {
+		var ok bool
+		if msg.value, ok = new(big.Int).SetString(args.Value, 10); !ok {
+			return nil, xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+	}
+	if msg.data, err = decodeHexArg(args.Data); err != nil {
+		return nil, xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	if args.Gas != "" {
+		gasBig, ok := new(big.Int).SetString(args.Gas, 10)
+		if !ok {
+			return nil, xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		msg.gas = gasBig.Uint64()
+	}
+	msg.overrides = args.Overrides
+	msg.breakdown = args.Breakdown
+	return msg, nil
+}
+
+func applyStateOverrides(stateTree *xfsgo.StateTree, overrides map[string]StateOverrideArgs) error {
+	for addrStr, override := range overrides {
+		if err := common.AddrCalibrator(addrStr); err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, err)
+		}
+		addr := common.B58ToAddress([]byte(addrStr))
+		if override.Balance != "" {
+			balance, ok := new(big.Int).SetString(override.Balance, 10)
+			if !ok {
+				return xfsgo.NewRPCError(-1006, "string to big.Int error")
+			}
+			stateTree.GetOrNewStateObj(addr).SetBalance(balance)
+		}
+		if override.Nonce != "" {
+			nonce, err := strconv.ParseUint(override.Nonce, 10, 64)
+			if err != nil {
+				return xfsgo.NewRPCErrorCause(-1006, err)
+			}
+			stateTree.GetOrNewStateObj(addr).SetNonce(nonce)
+		}
+		if override.Code != "" {
+			code, err := decodeHexArg(override.Code)
+			if err != nil {
+				return xfsgo.NewRPCErrorCause(-1006, err)
+			}
+			stateTree.SetCode(addr, code)
+		}
+		for keyStr, valueStr := range override.Storage {
+			key, err := decodeHexArg(keyStr)
+			if err != nil || len(key) != len(common.Hash{}) {
+				return xfsgo.NewRPCError(-1006, "invalid storage key")
+			}
+			value, err := decodeHexArg(valueStr)
+			if err != nil {
+				return xfsgo.NewRPCErrorCause(-1006, err)
+			}
+			var slot [32]byte
+			copy(slot[:], key)
+			stateTree.SetState(addr, slot, value)
+		}
+	}
+	return nil
+}
+
+func (handler *ContractAPIHandler) openState(ctx context.Context, header *xfsgo.BlockHeader) *xfsgo.StateTree {
+	_, span := trace.Start(ctx, "state.open")
+	defer span.Finish()
+	span.SetAttribute("state_root", header.StateRoot.Hex())
+	return xfsgo.NewStateTree(handler.StateDb, header.StateRoot.Bytes())
+}
+
+// newVM creates the vm executing contracts in the block context of the header, the
+// contracts never see the clock of the node. The execution is aborted when the context
+// of the request is done.
+func (handler *ContractAPIHandler) newVM(ctx context.Context, stateTree *xfsgo.StateTree, header *xfsgo.BlockHeader) vm.VM {
+	mVm := vm.NewXVMWithContext(stateTree, handler.BlockChain.BlockContext(header))
+	mVm.SetDone(ctx.Done())
+	return mVm
+}
+
+// callHeader returns the header of the block a call is pinned to by its hash or number.
+// An unpinned call runs on the head block, which requires the node to be synced. The
+// state of a pinned block must not be pruned.
+func (handler *ContractAPIHandler) callHeader(block string) (*xfsgo.BlockHeader, error) {
+	if block == "" {
+		if err := checkSynced(handler.BlockChain); err != nil {
+			return nil, err
+		}
+		return handler.BlockChain.CurrentBHeader(), nil
+	}
+	var header *xfsgo.BlockHeader
+	if common.HashCalibrator(block) == nil {
+		header = handler.BlockChain.GetBlockHeaderByBHash(common.Hex2Hash(block))
+	} else {
+		number, err := strconv.ParseUint(block, 0, 64)
+		if err != nil {
+			return nil, xfsgo.NewRPCErrorCause(-1006, err)
+		}
+		header = handler.BlockChain.GetBlockHeaderByNumber(number)
+	}
+	if header == nil {
+		return nil, xfsgo.NewRPCError(-1006, "block not found")
+	}
+	if err := checkState(handler.BlockChain, header.StateRoot); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func traceCalls(mVm vm.VM) {
+	if tracer, ok := mVm.(vm.CallTracer); ok {
+		tracer.TraceCalls()
+	}
+}
+
+func newCallGasResps(frames []*vm.CallFrame) []*CallGasResp {
+	if len(frames) == 0 {
+		return nil
+	}
+	resps := make([]*CallGasResp, len(frames))
+	for i, frame := range frames {
+		resp := &CallGasResp{
+			Type:    frame.Type,
+			From:    frame.From.B58String(),
+			To:      frame.To.B58String(),
+			Gas:     new(big.Int).SetUint64(frame.Gas).Text(10),
+			GasUsed: new(big.Int).SetUint64(frame.GasUsed).Text(10),
+			Calls:   newCallGasResps(frame.Calls),
+		}
+		if frame.Value != nil && frame.Value.Sign() > 0 {
+			resp.Value = frame.Value.Text(10)
+		}
+		if frame.Err != nil {
+			resp.Error = newVMErrorResp(frame.Err)
+		}
+		resps[i] = resp
+	}
+	return resps
+}
+
+// newGasBreakdownResp returns the breakdown of the gas used of an execution with a gas
+// limit, the calls are those recorded by the vm if it traced them.
+func newGasBreakdownResp(mVm vm.VM, intrinsic, limit, used uint64) *GasBreakdownResp {
+	resp := &GasBreakdownResp{
+		Intrinsic: new(big.Int).SetUint64(intrinsic).Text(10),
+		Execution: "0",
+		Refund:    "0",
+	}
+	if used > intrinsic {
+		resp.Execution = new(big.Int).SetUint64(used - intrinsic).Text(10)
+	}
+	if limit > used {
+		resp.Refund = new(big.Int).SetUint64(limit - used).Text(10)
+	}
+	if tracer, ok := mVm.(vm.CallTracer); ok {
+		resp.Calls = newCallGasResps(tracer.CallTrace())
+	}
+	return resp
+}
+
+// applyMessage executes a message like a transaction of the sender: it creates a contract
+// when no receiver is given, sets the extra data of the sender, calls the contract of the
+// receiver or transfers value, as picked by the chain config for the block of the header.
+func (handler *ContractAPIHandler) applyMessage(ctx context.Context,
+	stateTree *xfsgo.StateTree, header *xfsgo.BlockHeader, msg *contractMessage) *MessageResultResp {
+	_, span := trace.Start(ctx, "vm.apply_message")
+	defer span.Finish()
+	result := &MessageResultResp{}
+	intrinsic := common.CalcTxInitialCost(msg.data).Uint64()
+	gasUsed := intrinsic
+	var (
+		err error
+		mVm vm.VM
+	)
+	config := handler.BlockChain.ChainConfig()
+	if msg.gas < intrinsic {
+		err = errors.New("gas limit too low")
+	} else {
+		switch config.MessageKind(stateTree, msg.from, msg.to, msg.data, header.Height) {
+		case xfsgo.MessageCreate:
+			mVm = handler.newVM(ctx, stateTree, header)
+			if msg.breakdown {
+				traceCalls(mVm)
+			}
+			mVm.SetGas(msg.gas - intrinsic)
+			caddr := crypto.CreateAddress(msg.from.Hash(), stateTree.GetNonce(msg.from))
+			if err = mVm.Create(msg.from, msg.data); err == nil {
+				result.ContractAddress = caddr.B58String()
+			}
+			gasUsed = msg.gas - mVm.GasLeft()
+		case xfsgo.MessageSetExtra:
+			if extra := common.CalcExtraGas(msg.data).Uint64(); msg.gas-intrinsic < extra {
+				err = errMessageExtraGas
+			} else {
+				gasUsed += extra
+				err = stateTree.SetExtra(msg.from, msg.data)
+			}
+		case xfsgo.MessageCall:
+			mVm = handler.newVM(ctx, stateTree, header)
+			if msg.breakdown {
+				traceCalls(mVm)
+			}
+			mVm.SetGas(msg.gas - intrinsic)
+			if err = mVm.Call(msg.from, msg.to, msg.value, msg.data); err == nil {
+				if ret := mVm.ReturnData(); len(ret) > 0 {
+					result.ReturnData = "0x" + hex.EncodeToString(ret)
+				}
+			}
+			gasUsed = msg.gas - mVm.GasLeft()
+		default:
+			balance := stateTree.GetBalance(msg.from)
+			if balance == nil || balance.Cmp(msg.value) < 0 {
+				err = errMessageTransfer
+			} else {
+				err = stateTree.Transfer(msg.from, msg.to, msg.value)
+			}
+		}
+	}
+	stateTree.AddNonce(msg.from, 1)
+	if err != nil {
+		result.Error = newVMErrorResp(err)
+	} else {
+		result.Status = 1
+	}
+	result.GasUsed = new(big.Int).SetUint64(gasUsed).Text(10)
+	if msg.breakdown {
+		result.Breakdown = newGasBreakdownResp(mVm, intrinsic, msg.gas, gasUsed)
+	}
+	span.SetAttribute("gas_used", gasUsed)
+	return result
+}
+
+// Call executes a read only contract call on top of the current state without creating
+// a transaction and returns the hex encoded return data. The call fails when the contract
+// tries to modify the state, to transfer value or to emit logs. The state overrides of
+// the call are applied on a temporary copy of the state before the execution. With the
+// breakdown requested the result is a CallResultResp instead, a call has no intrinsic gas.
+func (handler *ContractAPIHandler) Call(ctx context.Context, args ContractCallArgs, resp *interface{}) error {
+	if args.To == "" {
+		return xfsgo.NewRPCError(-1006, "to not be empty")
+	}
+	header, err := handler.callHeader(args.Block)
+	if err != nil {
+		return err
+	}
+	msg, err := parseContractMessage(args, header.GasLimit.Uint64())
+	if err != nil {
+		return err
+	}
+	if msg.value.Sign() > 0 {
+		return xfsgo.NewRPCError(-1006, "value transfer not allowed in call")
+	}
+	stateTree := handler.openState(ctx, header)
+	if err = applyStateOverrides(stateTree, msg.overrides); err != nil {
+		return err
+	}
+	mVm := handler.newVM(ctx, stateTree, header)
+	if msg.breakdown {
+		traceCalls(mVm)
+	}
+	mVm.SetGas(msg.gas)
+	if err = traced(ctx, "vm.static_call", func() error {
+		return mVm.StaticCall(msg.from, msg.to, msg.data)
+	}); err != nil {
+		return xfsgo.NewRPCErrorData(-1006, err, newVMErrorResp(err))
+	}
+	returnData := "0x" + hex.EncodeToString(mVm.ReturnData())
+	if !msg.breakdown {
+		*resp = returnData
+		return nil
+	}
+	gasUsed := msg.gas - mVm.GasLeft()
+	*resp = &CallResultResp{
+		ReturnData: returnData,
+		GasUsed:    new(big.Int).SetUint64(gasUsed).Text(10),
+		Breakdown:  newGasBreakdownResp(mVm, 0, msg.gas, gasUsed),
+	}
+	return nil
+}
+
+// SimulateBundle executes the messages in order on a single temporary copy of the current
+// state, each message sees the changes of the previous ones. The overrides of the bundle
+// are applied first, the overrides of a message right before it is executed. Nothing is
+// written to the chain state.
+func (handler *ContractAPIHandler) SimulateBundle(ctx context.Context, args SimulateBundleArgs, resp *[]*MessageResultResp) error {
+	if len(args.Messages) == 0 {
+		return xfsgo.NewRPCError(-1006, "messages not be empty")
+	}
+	header, err := handler.callHeader(args.Block)
+	if err != nil {
+		return err
+	}
+	msgs := make([]*contractMessage, len(args.Messages))
+	for i, item := range args.Messages {
+		msg, err := parseContractMessage(item, header.GasLimit.Uint64())
+		if err != nil {
+			return err
+		}
+		msgs[i] = msg
+	}
+	stateTree := handler.openState(ctx, header)
+	if err := applyStateOverrides(stateTree, args.Overrides); err != nil {
+		return err
+	}
+	results := make([]*MessageResultResp, len(msgs))
+	for i, msg := range msgs {
+		if err := xfsgo.ContextError(ctx); err != nil {
+			return err
+		}
+		if err := applyStateOverrides(stateTree, msg.overrides); err != nil {
+			return err
+		}
+		results[i] = handler.applyMessage(ctx, stateTree, header, msg)
+	}
+	*resp = results
+	return nil
+}
+
+// EstimateGas returns the lowest gas limit with which the message succeeds when sent as
+// a transaction on top of the current state with the state overrides applied. With the
+// breakdown requested the result is a GasEstimateResp with the breakdown of the execution
+// at the estimated gas.
+func (handler *ContractAPIHandler) EstimateGas(ctx context.Context, args ContractCallArgs, resp *interface{}) error {
+	header, err := handler.callHeader(args.Block)
+	if err != nil {
+		return err
+	}
+	msg, err := parseContractMessage(args, header.GasLimit.Uint64())
+	if err != nil {
+		return err
+	}
+	run := func(gas uint64) (*MessageResultResp, error) {
+		stateTree := handler.openState(ctx, header)
+		if err := applyStateOverrides(stateTree, msg.overrides); err != nil {
+			return nil, err
+		}
+		m := *msg
+		m.gas = gas
+		m.breakdown = false
+		return handler.applyMessage(ctx, stateTree, header, &m), nil
+	}
+	hi := msg.gas
+	result, err := run(hi)
+	if err != nil {
+		return err
+	}
+	if result.Status != 1 {
+		return xfsgo.NewRPCErrorData(-1006, errors.New(result.Error.Message), result.Error)
+	}
+	lo := common.CalcTxInitialCost(msg.data).Uint64() - 1
+	for lo+1 < hi {
+		if err = xfsgo.ContextError(ctx); err != nil {
+			return err
+		}
+		mid := lo + (hi-lo)/2
+		if result, err = run(mid); err != nil {
+			return err
+		}
+		if result.Status == 1 {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	gas := new(big.Int).SetUint64(hi).Text(10)
+	if !msg.breakdown {
+		*resp = gas
+		return nil
+	}
+	stateTree := handler.openState(ctx, header)
+	if err = applyStateOverrides(stateTree, msg.overrides); err != nil {
+		return err
+	}
+	m := *msg
+	m.gas = hi
+	result = handler.applyMessage(ctx, stateTree, header, &m)
+	*resp = &GasEstimateResp{
+		Gas:       gas,
+		Breakdown: result.Breakdown,
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"errors"
+	"strconv"
+	"xfsgo"
+)
+
+// Error codes of the structured errors, their data is documented in openrpc.json.
+const (
+	errCodeNonceTooLow       = -32010
+	errCodeInsufficientFunds = -32011
+	errCodeSyncing           = -32020
+)
+
+var errNodeSyncing = errors.New("node is syncing")
+
+// SyncProgressResp is the data of the node is syncing error.
+type SyncProgressResp struct {
+	StartingBlock string `json:"starting_block"`
+	CurrentBlock  string `json:"current_block"`
+	HighestBlock  string `json:"highest_block"`
+	Progress      string `json:"progress"`
+}
+
+// NonceTooLowResp is the data of the nonce too low error.
+type NonceTooLowResp struct {
+	Address string `json:"address"`
+	// Expected is the next nonce of the address after its pending transactions.
+	Expected string `json:"expected"`
+	Given    string `json:"given"`
+}
+
+// InsufficientFundsResp is the data of the insufficient funds error, amounts are in atto.
+type InsufficientFundsResp struct {
+	Address   string `json:"address"`
+	Required  string `json:"required"`
+	Available string `json:"available"`
+}
+
+// txError returns the structured error of a transaction refused for its nonce or the
+// funds of the sender, other errors get the code.
+func txError(code int, err error) error {
+	switch e := err.(type) {
+	case *xfsgo.NonceTooLowError:
+		return xfsgo.NewRPCErrorData(errCodeNonceTooLow, err, &NonceTooLowResp{
+			Address:  e.Address.B58String(),
+			Expected: strconv.FormatUint(e.Expected, 10),
+			Given:    strconv.FormatUint(e.Given, 10),
+		})
+	case *xfsgo.InsufficientFundsError:
+		return xfsgo.NewRPCErrorData(errCodeInsufficientFunds, err, &InsufficientFundsResp{
+			Address:   e.Address.B58String(),
+			Required:  e.Required.Text(10),
+			Available: e.Available.Text(10),
+		})
+	}
+	return xfsgo.NewRPCErrorCause(code, err)
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"context"
+	"math/big"
+	"xfsgo"
+	"xfsgo/common"
+)
+
+// FaucetAPIHandler sends test coins from the faucet account of the wallet, it is only
+// registered on dev and test networks with a faucet configured.
+type FaucetAPIHandler struct {
+	Faucet        *xfsgo.Faucet
+	Wallet        *xfsgo.Wallet
+	BlockChain    *xfsgo.BlockChain
+	TxPendingPool *xfsgo.TxPool
+}
+
+type FaucetRequestArgs struct {
+	Address string `json:"address"`
+	// Value is the amount in base coins, it defaults to the cap of the faucet.
+	Value string `json:"value"`
+}
+
+type FaucetRequestResp struct {
+	TxHash string `json:"tx_hash"`
+	// Value is the amount sent in atto.
+	Value string `json:"value"`
+}
+
+// Request sends coins of the faucet to the address. Each address may request once and
+// each client ip a limited number of times per interval of the faucet.
+func (handler *FaucetAPIHandler) Request(ctx context.Context, args FaucetRequestArgs, resp **FaucetRequestResp) error {
+	if err := checkSynced(handler.BlockChain); err != nil {
+		return err
+	}
+	if args.Address == "" {
+		return xfsgo.NewRPCError(-1006, "address not be empty")
+	}
+	if err := common.AddrCalibrator(args.Address); err != nil {
+		return xfsgo.NewRPCErrorCause(-6001, err)
+	}
+	to := common.B58ToAddress([]byte(args.Address))
+	config := handler.Faucet.Config()
+	amount := config.Amount
+	if args.Value != "" {
+		var err error
+		if amount, err = common.BaseCoin2Atto(args.Value); err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+		if amount.Sign() <= 0 {
+			return xfsgo.NewRPCError(-1006, "value must be positive")
+		}
+	}
+	privateKey, err := handler.Wallet.GetKeyByAddress(config.Account)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	cancel, err := handler.Faucet.Take(to, xfsgo.ClientIPFromContext(ctx), amount)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	stdTx := &xfsgo.StdTransaction{
+		To:       to,
+		Value:    amount,
+		GasLimit: new(big.Int).Set(common.TxGas),
+		GasPrice: common.DefaultGasPrice(),
+	}
+	wallet := &WalletHandler{
+		Wallet:        handler.Wallet,
+		BlockChain:    handler.BlockChain,
+		TxPendingPool: handler.TxPendingPool,
+	}
+	txHash, err := wallet.sendSigned("Faucet.Request", config.Account, "", stdTx, true, privateKey)
+	if err != nil {
+		cancel()
+		return txError(-1006, err)
+	}
+	*resp = &FaucetRequestResp{
+		TxHash: txHash.Hex(),
+		Value:  amount.Text(10),
+	}
+	return nil
+}
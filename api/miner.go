@@ -27,12 +27,14 @@ import (
 )
 
 type MinerAPIHandler struct {
-	Miner *miner.Miner
+	Miner      *miner.Miner
+	BlockChain *xfsgo.BlockChain
+	Wallet     *xfsgo.Wallet
 }
 
-// type MinerSetGasLimitArgs struct {
-// 	Value string `json:"value"`
-// }
+type MinerSetGasLimitArgs struct {
+	Value string `json:"value"`
+}
 
 type MinerSetGasPriceArgs struct {
 	Value string `json:"value"`
@@ -40,13 +42,37 @@ type MinerSetGasPriceArgs struct {
 
 type MinerSetCoinbaseArgs struct {
 	Coinbase string `json:"coinbase"`
+	// External allows a coinbase which is not an account of the wallet
+	External bool `json:"external"`
+}
+
+type CoinbaseChangeResp struct {
+	Time     string `json:"time"`
+	Height   uint64 `json:"height"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	External bool   `json:"external"`
 }
 
 type MinerSetWorkerArgs struct {
 	Num string `json:"num"`
 }
 
+type MinerRewardShareArgs struct {
+	Address string `json:"address"`
+	Percent string `json:"percent"`
+}
+
+type MinerSetRewardSplitArgs struct {
+	Shares []MinerRewardShareArgs `json:"shares"`
+}
+
+// Start starts mining with the number of workers, it is refused while the node is syncing
+// as the blocks would be mined on a stale head.
 func (handler *MinerAPIHandler) Start(args MinerStartArgs, resp *string) error {
+	if err := checkSynced(handler.BlockChain); err != nil {
+		return err
+	}
 	num, err := strconv.ParseUint(args.Num, 10, 32)
 	if err != nil {
 		return errorcase(err)
@@ -80,20 +106,76 @@ func (handler *MinerAPIHandler) SetGasPrice(args MinerSetGasPriceArgs, resp *str
 	return errorcase(handler.Miner.SetGasPrice(GasPrice))
 }
 
-// func (handler *MinerAPIHandler) SetGasLimit(args MinerSetGasLimitArgs, resp *string) error {
-// 	value, ok := new(big.Int).SetString(args.Value, 10)
-// 	if !ok {
-// 		return xfsgo.NewRPCError(-1006, "Number format err")
-// 	}
-// 	return errorcase(handler.Miner.SetGasLimit(value))
-// }
+// SetGasLimit sets the gas limit target the miner votes for in the blocks it mines.
+func (handler *MinerAPIHandler) SetGasLimit(args MinerSetGasLimitArgs, resp *string) error {
+	value, ok := new(big.Int).SetString(args.Value, 10)
+	if !ok {
+		return xfsgo.NewRPCError(-1006, "Number format err")
+	}
+	return errorcase(handler.Miner.SetGasLimit(value))
+}
+
+// SetCoinbase changes the address receiving the rewards of the blocks mined next, mining
+// goes on with the new coinbase. The address must be an account of the wallet unless it is
+// explicitly allowed to be external.
+func (handler *MinerAPIHandler) SetCoinbase(args MinerSetCoinbaseArgs, resp *string) error {
+	if err := common.AddrCalibrator(args.Coinbase); err != nil {
+		return xfsgo.NewRPCErrorCause(-6001, err)
+	}
+	coinbase := common.B58ToAddress([]byte(args.Coinbase))
+	if !args.External {
+		if _, err := handler.Wallet.GetKeyByAddress(coinbase); err != nil {
+			return xfsgo.NewRPCError(-1006, "coinbase is not an account of the wallet")
+		}
+	}
+	handler.Miner.SetCoinbase(coinbase, args.External)
+	*resp = coinbase.B58String()
+	return nil
+}
+
+// CoinbaseHistory returns the audit log of the last coinbase changes, the oldest first.
+func (handler *MinerAPIHandler) CoinbaseHistory(_ EmptyArgs, resp *[]*CoinbaseChangeResp) error {
+	history := handler.Miner.CoinbaseHistory()
+	result := make([]*CoinbaseChangeResp, 0, len(history))
+	for _, change := range history {
+		result = append(result, &CoinbaseChangeResp{
+			Time:     change.Time.Format(time.RFC3339),
+			Height:   change.Height,
+			From:     change.From.B58String(),
+			To:       change.To.B58String(),
+			External: change.External,
+		})
+	}
+	*resp = result
+	return nil
+}
+
+// SetRewardSplit sets the percentages of the block reward the miner pays to other
+// addresses than the coinbase, an empty list pays the whole reward to the coinbase.
+func (handler *MinerAPIHandler) SetRewardSplit(args MinerSetRewardSplitArgs, resp *string) error {
+	split := make([]xfsgo.RewardShare, 0, len(args.Shares))
+	for _, share := range args.Shares {
+		if err := common.AddrCalibrator(share.Address); err != nil {
+			return xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		percent, err := strconv.ParseUint(share.Percent, 10, 32)
+		if err != nil {
+			return errorcase(err)
+		}
+		split = append(split, xfsgo.RewardShare{
+			Address: common.B58ToAddress([]byte(share.Address)),
+			Percent: uint32(percent),
+		})
+	}
+	return errorcase(handler.Miner.SetRewardSplit(split))
+}
 
 func (handler *MinerAPIHandler) Status(_ EmptyArgs, resp *MinerStatusResp) error {
 	mMiner := handler.Miner
 	gasLimit := handler.Miner.GetGasLimit()
 	gasPrice := handler.Miner.GetGasPrice()
 	MinStartTime := handler.Miner.LastStartTime
-	MinCoinbase := handler.Miner.Coinbase
+	MinCoinbase := handler.Miner.GetCoinbase()
 	hashRate := handler.Miner.RunningHashRate()
 
 	MinWorkers := handler.Miner.GetWorkerNum()
@@ -109,6 +191,7 @@ func (handler *MinerAPIHandler) Status(_ EmptyArgs, resp *MinerStatusResp) error
 		Coinbase:         MinCoinbase.B58String(),
 		HashRate:         fmt.Sprintf("%.2f", float64(hashRate)),
 		Workers:          strconv.Itoa(int(MinWorkers)),
+		RewardSplit:      handler.Miner.GetRewardSplit(),
 	}
 	*resp = *result
 	return nil
@@ -8,6 +8,10 @@ import (
 
 type NetAPIHandler struct {
 	NetServer p2p.Server
+	// Propagation returns the peers ranked by how fast they announce new blocks
+	Propagation func() []*xfsgo.PeerPropagation
+	// Capture records the protocol messages of the peers, nil unless enabled
+	Capture *p2p.Capture
 }
 
 type AddPeerArgs struct {
@@ -28,6 +32,51 @@ func (net *NetAPIHandler) GetPeers(_ EmptyArgs, resp *[]string) error {
 	return nil
 }
 
+type PeerResp struct {
+	Node string `json:"node"`
+	*xfsgo.PeerPropagation
+}
+
+// Peers returns the peers ranked by how fast they announce new blocks, the best first.
+func (net *NetAPIHandler) Peers(_ EmptyArgs, resp *[]*PeerResp) error {
+	nodes := make(map[string]string)
+	for _, item := range net.NetServer.Peers() {
+		id := item.ID()
+		nodes[id.String()] = item.RemoteNode().String()
+	}
+	result := make([]*PeerResp, 0, len(nodes))
+	if net.Propagation != nil {
+		for _, p := range net.Propagation() {
+			result = append(result, &PeerResp{
+				Node:            nodes[p.ID],
+				PeerPropagation: p,
+			})
+		}
+	}
+	*resp = result
+	return nil
+}
+
+type DumpCaptureArgs struct {
+	Path string `json:"path"`
+}
+
+// DumpCapture writes the protocol messages kept by the capture ring to the file on the
+// node and returns the number of the messages captured so far.
+func (net *NetAPIHandler) DumpCapture(args DumpCaptureArgs, resp *uint64) error {
+	if net.Capture == nil {
+		return xfsgo.NewRPCError(-1006, "p2p capture not enabled")
+	}
+	if args.Path == "" {
+		return xfsgo.NewRPCError(-1006, "path not be empty")
+	}
+	if err := net.Capture.Dump(args.Path); err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	*resp = net.Capture.Count()
+	return nil
+}
+
 func (net *NetAPIHandler) AddPeer(args AddPeerArgs, resp *string) error {
 	if args.Url == "" {
 		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
@@ -0,0 +1,218 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"context"
+	"math/big"
+	"time"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/crypto"
+	"xfsgo/storage/badger"
+	"xfsgo/vm"
+)
+
+// oracleSubmitGas is the gas a data point submission needs in addition to the
+// transaction gas, it pays the event of the data point.
+var oracleSubmitGas = big.NewInt(10000)
+
+type OracleAPIHandler struct {
+	StateDb       *badger.Storage
+	BlockChain    *xfsgo.BlockChain
+	Wallet        *xfsgo.Wallet
+	TxPendingPool *xfsgo.TxPool
+}
+
+// CancellableMethods lists the methods whose vm stops at the end of the call.
+func (handler *OracleAPIHandler) CancellableMethods() []string {
+	return []string{"GetValue"}
+}
+
+type OracleSubmitArgs struct {
+	Contract string `json:"contract"`
+	// From is the wallet address sending the transaction, the default address is used
+	// when it is empty.
+	From string `json:"from"`
+	// Reporter is the wallet address signing the data point when no signature is
+	// given, it defaults to From.
+	Reporter  string `json:"reporter"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Timestamp string `json:"timestamp"`
+	// Signature is the hex encoded signature of a data point signed by a reporter
+	// outside of the node.
+	Signature string `json:"signature"`
+	GasLimit  string `json:"gas_limit"`
+	GasPrice  string `json:"gas_price"`
+}
+
+type OracleValueArgs struct {
+	Contract string `json:"contract"`
+	Key      string `json:"key"`
+}
+
+type OracleValueResp struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func parseContractAddress(s string) (common.Address, error) {
+	if s == "" {
+		return common.Address{}, xfsgo.NewRPCError(-1006, "contract not be empty")
+	}
+	if err := common.AddrCalibrator(s); err != nil {
+		return common.Address{}, xfsgo.NewRPCErrorCause(-6001, err)
+	}
+	return common.B58ToAddress([]byte(s)), nil
+}
+
+// Submit sends a transaction submitting a data point to the oracle contract. The data
+// point is signed with the wallet key of the reporter unless it carries the signature
+// of a reporter.
+func (handler *OracleAPIHandler) Submit(args OracleSubmitArgs, resp *string) error {
+	if err := checkSynced(handler.BlockChain); err != nil {
+		return err
+	}
+	oracle, err := parseContractAddress(args.Contract)
+	if err != nil {
+		return err
+	}
+	if args.Key == "" {
+		return xfsgo.NewRPCError(-1006, "key not be empty")
+	}
+	if args.Value == "" {
+		return xfsgo.NewRPCError(-1006, "value not be empty")
+	}
+	value, ok := new(big.Int).SetString(args.Value, 0)
+	if !ok || value.Sign() < 0 || value.BitLen() > 256 {
+		return xfsgo.NewRPCError(-1006, "invalid value")
+	}
+	timestamp := uint64(time.Now().Unix())
+	if args.Timestamp != "" {
+		ts, ok := new(big.Int).SetString(args.Timestamp, 0)
+		if !ok || !ts.IsUint64() {
+			return xfsgo.NewRPCError(-1006, "invalid timestamp")
+		}
+		timestamp = ts.Uint64()
+	}
+	fromAddr := handler.Wallet.GetDefault()
+	if args.From != "" {
+		if err = common.AddrCalibrator(args.From); err != nil {
+			return xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		fromAddr = common.B58ToAddress([]byte(args.From))
+	}
+	privateKey, err := handler.Wallet.GetKeyByAddress(fromAddr)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	var sig []byte
+	if args.Signature != "" {
+		if sig, err = decodeHexArg(args.Signature); err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+	} else {
+		reporterKey := privateKey
+		if args.Reporter != "" {
+			if err = common.AddrCalibrator(args.Reporter); err != nil {
+				return xfsgo.NewRPCErrorCause(-6001, err)
+			}
+			reporter := common.B58ToAddress([]byte(args.Reporter))
+			if reporterKey, err = handler.Wallet.GetKeyByAddress(reporter); err != nil {
+				return xfsgo.NewRPCErrorCause(-1006, err)
+			}
+		}
+		hash := vm.OracleDataHash(oracle, []byte(args.Key), value, timestamp)
+		if sig, err = crypto.ECDSASign(hash[:], reporterKey); err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+		reporter := crypto.DefaultPubKey2Addr(reporterKey.PublicKey)
+		if err = handler.Wallet.RecordSigning("Oracle.Submit", reporter, oracle, nil, hash); err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+	}
+	var v vm.CTypeUint256
+	value.FillBytes(v[:])
+	data, err := vm.EncodeCall("Submit",
+		vm.CTypeString(args.Key), v, vm.NewUint64(timestamp), vm.CTypeString(sig))
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	stdTx := &xfsgo.StdTransaction{
+		To:    oracle,
+		Data:  data,
+		Value: new(big.Int),
+	}
+	if args.GasLimit != "" {
+		stdTx.GasLimit = common.ParseString2BigInt(args.GasLimit)
+	} else {
+		stdTx.GasLimit = new(big.Int).Add(common.CalcTxInitialCost(data), oracleSubmitGas)
+	}
+	if args.GasPrice != "" {
+		gaspriceBig, ok := new(big.Int).SetString(args.GasPrice, 10)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		stdTx.GasPrice = common.NanoCoin2Atto(gaspriceBig)
+	} else {
+		stdTx.GasPrice = common.DefaultGasPrice()
+	}
+	wallet := &WalletHandler{
+		Wallet:        handler.Wallet,
+		BlockChain:    handler.BlockChain,
+		TxPendingPool: handler.TxPendingPool,
+	}
+	result, err := wallet.sendSigned("Oracle.Submit", fromAddr, "", stdTx, true, privateKey)
+	if err != nil {
+		return txError(-1006, err)
+	}
+	*resp = result.Hex()
+	return nil
+}
+
+// GetValue returns the value of the data feed of the oracle contract on the current
+// state, the median of the fresh data points of its reporters.
+func (handler *OracleAPIHandler) GetValue(ctx context.Context, args OracleValueArgs, resp **OracleValueResp) error {
+	oracle, err := parseContractAddress(args.Contract)
+	if err != nil {
+		return err
+	}
+	if args.Key == "" {
+		return xfsgo.NewRPCError(-1006, "key not be empty")
+	}
+	input, err := vm.EncodeCall("Value", vm.CTypeString(args.Key))
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	contracts := &ContractAPIHandler{
+		StateDb:    handler.StateDb,
+		BlockChain: handler.BlockChain,
+	}
+	header := handler.BlockChain.CurrentBHeader()
+	stateTree := contracts.openState(ctx, header)
+	mVm := contracts.newVM(ctx, stateTree, header)
+	mVm.SetGas(header.GasLimit.Uint64())
+	if err = mVm.StaticCall(common.Address{}, oracle, input); err != nil {
+		return xfsgo.NewRPCErrorData(-1006, err, newVMErrorResp(err))
+	}
+	*resp = &OracleValueResp{
+		Key:   args.Key,
+		Value: new(big.Int).SetBytes(mVm.ReturnData()).Text(10),
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"xfsgo"
+)
+
+// ReorgAlarmAPIHandler reports the deep reorgs seen by the reorg monitor of the node.
+type ReorgAlarmAPIHandler struct {
+	Monitor *xfsgo.ReorgMonitor
+}
+
+type ReorgAlarmsResp struct {
+	// Depth is the number of dropped blocks a reorg exceeds to raise an alarm.
+	Depth int `json:"depth"`
+	*xfsgo.ReorgAlarmStats
+}
+
+// GetReorgAlarms returns the counters of the reorgs and the last alarms raised.
+func (handler *ReorgAlarmAPIHandler) GetReorgAlarms(_ EmptyArgs, resp **ReorgAlarmsResp) error {
+	*resp = &ReorgAlarmsResp{
+		Depth:           handler.Monitor.Depth(),
+		ReorgAlarmStats: handler.Monitor.Stats(),
+	}
+	return nil
+}
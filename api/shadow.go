@@ -0,0 +1,33 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package api
+
+import (
+	"xfsgo"
+)
+
+// ShadowAPIHandler reports the divergences of the shadow execution of the new blocks.
+type ShadowAPIHandler struct {
+	Shadow *xfsgo.ShadowExecutor
+}
+
+// GetDivergences returns the counters of the blocks executed by the shadow state
+// transition and the last blocks it diverged on.
+func (handler *ShadowAPIHandler) GetDivergences(_ EmptyArgs, resp **xfsgo.ShadowStats) error {
+	*resp = handler.Shadow.Stats()
+	return nil
+}
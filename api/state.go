@@ -17,35 +17,196 @@
 package api
 
 import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strconv"
 	"xfsgo"
 	"xfsgo/common"
+	"xfsgo/common/rawencode"
 	"xfsgo/storage/badger"
+	"xfsgo/trace"
 )
 
+// errStatePruned is returned for the blocks whose state was deleted by the state pruning.
+var errStatePruned = xfsgo.NewRPCError(-32021, "state of the block is pruned")
+
+// checkState returns errStatePruned unless the state with the root is available, reading
+// a missing state fails deep in the state tree.
+func checkState(bc *xfsgo.BlockChain, root common.Hash) error {
+	if !bc.HasState(root) {
+		return errStatePruned
+	}
+	return nil
+}
+
 type StateAPIHandler struct {
-	StateDb    *badger.Storage
-	BlockChain *xfsgo.BlockChain
+	StateDb       *badger.Storage
+	BlockChain    *xfsgo.BlockChain
+	TxPendingPool *xfsgo.TxPool
 }
 
+// CancellableMethods lists the methods which stop iterating the state at the end of the call.
+func (state *StateAPIHandler) CancellableMethods() []string {
+	return []string{"GetStorageRange", "DumpAccounts"}
+}
+
+// State queries read the committed state of the current block unless pending is set,
+// which includes the transactions waiting in the tx pool.
 type GetAccountArgs struct {
 	RootHash string `json:"root_hash"`
 	Address  string `json:"address"`
+	Pending  string `json:"pending"`
 }
 
 type GetBalanceArgs struct {
 	RootHash string `json:"root_hash"`
 	Address  string `json:"address"`
+	Pending  string `json:"pending"`
+}
+
+type GetNonceArgs struct {
+	RootHash string `json:"root_hash"`
+	Number   string `json:"number"`
+	Address  string `json:"address"`
+	Pending  string `json:"pending"`
+}
+
+type GetPreimageArgs struct {
+	Hash string `json:"hash"`
+}
+
+type GetExtraArgs struct {
+	RootHash string `json:"root_hash"`
+	Number   string `json:"number"`
+	Address  string `json:"address"`
+}
+
+type GetStorageRangeArgs struct {
+	RootHash string `json:"root_hash"`
+	Number   string `json:"number"`
+	Address  string `json:"address"`
+	Start    string `json:"start"`
+	Limit    string `json:"limit"`
 }
 
-func (state *StateAPIHandler) GetBalance(args GetBalanceArgs, resp *string) error {
+type StorageEntryResp struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type StorageRangeResp struct {
+	Storage []*StorageEntryResp `json:"storage"`
+	// Next is the key to start the next page from, it is empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+type DumpAccountsArgs struct {
+	RootHash string `json:"root_hash"`
+	Number   string `json:"number"`
+	Start    string `json:"start"`
+	Limit    string `json:"limit"`
+	Storage  string `json:"storage"`
+}
+
+// DumpAccountResp is a dumped account, the key is the hash of its address.
+type DumpAccountResp struct {
+	Key       string              `json:"key"`
+	Address   string              `json:"address"`
+	Balance   string              `json:"balance"`
+	Nonce     uint64              `json:"nonce"`
+	CodeHash  common.Hash         `json:"code_hash"`
+	StateRoot common.Hash         `json:"state_root"`
+	Storage   []*StorageEntryResp `json:"storage,omitempty"`
+}
+
+type DumpAccountsResp struct {
+	Root     common.Hash        `json:"root"`
+	Accounts []*DumpAccountResp `json:"accounts"`
+	// Next is the key to start the next page from, it is empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+type GetProofArgs struct {
+	Number  string `json:"number"`
+	Address string `json:"address"`
+}
+
+// AccountProofResp holds the merkle proof of an account and the encoded header of the
+// block whose state root the proof is verified against, so clients don't need to trust
+// the node serving it.
+type AccountProofResp struct {
+	Address   string      `json:"address"`
+	Header    string      `json:"header"`
+	StateRoot common.Hash `json:"state_root"`
+	Proof     []string    `json:"proof"`
+}
+
+const (
+	defaultStorageRangeLimit = 100
+	maxStorageRangeLimit     = 1024
+	defaultDumpAccountsLimit = 100
+	maxDumpAccountsLimit     = 1024
+)
+
+// parsePending parses the pending flag of a state query, the pending state only
+// follows the current block and can not be combined with a state root or number.
+func parsePending(pending string, root, number string) (bool, error) {
+	if pending == "" {
+		return false, nil
+	}
+	ok, err := strconv.ParseBool(pending)
+	if err != nil {
+		return false, xfsgo.NewRPCError(-32602, "invalid pending flag")
+	}
+	if ok && (root != "" || number != "") {
+		return false, xfsgo.NewRPCError(-32602, "pending state is only available for the current block")
+	}
+	return ok, nil
+}
+
+// pendingBalance subtracts the cost of the pending transactions sent from the address.
+func (state *StateAPIHandler) pendingBalance(address common.Address, balance *big.Int) *big.Int {
+	result := new(big.Int).Set(balance)
+	if state.TxPendingPool == nil {
+		return result
+	}
+	result.Sub(result, state.TxPendingPool.PendingCost(address))
+	if result.Sign() < 0 {
+		result.SetInt64(0)
+	}
+	return result
+}
+
+// getStateObj reads the account of address from the state with the given root.
+func (state *StateAPIHandler) getStateObj(ctx context.Context, root []byte, address common.Address) *xfsgo.StateObj {
+	_, span := trace.Start(ctx, "state.get_account")
+	defer span.Finish()
+	rootHash := common.Bytes2Hash(root)
+	span.SetAttribute("state_root", rootHash.Hex())
+	stateTree := xfsgo.NewStateTree(state.StateDb, root)
+	return stateTree.GetStateObj(address)
+}
+
+func (state *StateAPIHandler) GetBalance(ctx context.Context, args GetBalanceArgs, resp *string) error {
+	pending, err := parsePending(args.Pending, args.RootHash, "")
+	if err != nil {
+		return err
+	}
 	var rootHash common.Hash
 	if args.RootHash == "" {
+		if err = checkSynced(state.BlockChain); err != nil {
+			return err
+		}
 		rootHash = state.BlockChain.CurrentBHeader().StateRoot
 	} else {
 		if err := common.HashCalibrator(args.RootHash); err != nil {
 			return xfsgo.NewRPCErrorCause(-32001, err)
 		}
 		rootHash = common.Hex2Hash(args.RootHash)
+		if err = checkState(state.BlockChain, rootHash); err != nil {
+			return err
+		}
 	}
 
 	if args.Address == "" {
@@ -57,25 +218,32 @@ func (state *StateAPIHandler) GetBalance(args GetBalanceArgs, resp *string) erro
 	}
 
 	rootHashByte := rootHash.Bytes()
-
-	stateTree := xfsgo.NewStateTree(state.StateDb, rootHashByte)
-
 	address := common.B58ToAddress([]byte(args.Address))
-
-	data := stateTree.GetStateObj(address)
+	data := state.getStateObj(ctx, rootHashByte, address)
 
 	if data == (&xfsgo.StateObj{}) || data == nil {
 		*resp = "0"
 		return nil
 	}
+	if pending {
+		*resp = state.pendingBalance(address, data.GetBalance()).String()
+		return nil
+	}
 	*resp = data.GetBalance().String()
 	return nil
 
 }
 
-func (state *StateAPIHandler) GetAccount(args GetAccountArgs, resp **StateObjResp) error {
+func (state *StateAPIHandler) GetAccount(ctx context.Context, args GetAccountArgs, resp **StateObjResp) error {
+	pending, err := parsePending(args.Pending, args.RootHash, "")
+	if err != nil {
+		return err
+	}
 	var statehash []byte
 	if args.RootHash == "" {
+		if err = checkSynced(state.BlockChain); err != nil {
+			return err
+		}
 		rootHash := state.BlockChain.CurrentBHeader().StateRoot
 		statehash = rootHash[:]
 	} else {
@@ -83,6 +251,9 @@ func (state *StateAPIHandler) GetAccount(args GetAccountArgs, resp **StateObjRes
 			return xfsgo.NewRPCErrorCause(-32001, err)
 		}
 		statehash = common.Hex2bytes(args.RootHash)
+		if err = checkState(state.BlockChain, common.Bytes2Hash(statehash)); err != nil {
+			return err
+		}
 	}
 	if args.Address == "" {
 		return xfsgo.NewRPCError(-32601, "Address not found")
@@ -92,10 +263,282 @@ func (state *StateAPIHandler) GetAccount(args GetAccountArgs, resp **StateObjRes
 		return xfsgo.NewRPCErrorCause(-32001, err)
 	}
 
-	stateTree := xfsgo.NewStateTree(state.StateDb, statehash)
+	address := common.B58ToAddress([]byte(args.Address))
+	data := state.getStateObj(ctx, statehash, address)
+	if err = coverState2Resp(data, resp); err != nil || !pending || *resp == nil {
+		return err
+	}
+	balance := state.pendingBalance(address, data.GetBalance()).Text(10)
+	(*resp).Balance = &balance
+	if state.TxPendingPool != nil {
+		(*resp).Nonce = state.TxPendingPool.PendingNonce(address)
+	}
+	return nil
+}
 
+// GetNonce returns the nonce of an account, the pending nonce is the nonce of the next
+// transaction sent from the account after those waiting in the tx pool.
+func (state *StateAPIHandler) GetNonce(args GetNonceArgs, resp *uint64) error {
+	pending, err := parsePending(args.Pending, args.RootHash, args.Number)
+	if err != nil {
+		return err
+	}
+	if args.Address == "" {
+		return xfsgo.NewRPCError(-32601, "Address not found")
+	}
+	if err = common.AddrCalibrator(args.Address); err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
 	address := common.B58ToAddress([]byte(args.Address))
+	if args.RootHash == "" && args.Number == "" {
+		if err = checkSynced(state.BlockChain); err != nil {
+			return err
+		}
+	}
+	if pending && state.TxPendingPool != nil {
+		*resp = state.TxPendingPool.PendingNonce(address)
+		return nil
+	}
+	rootHash, err := state.resolveStateRoot(args.RootHash, args.Number)
+	if err != nil {
+		return err
+	}
+	*resp = xfsgo.NewStateTree(state.StateDb, rootHash.Bytes()).GetNonce(address)
+	return nil
+}
 
-	data := stateTree.GetStateObj(address)
-	return coverState2Resp(data, resp)
+// GetExtra returns the hex encoded extra data of an account. The state is selected by root_hash,
+// or by the block number when only number is given, and defaults to the current block.
+// resolveStateRoot returns the given state root, the state root of the block with the
+// given number, or the current state root when neither is given.
+func (state *StateAPIHandler) resolveStateRoot(root, number string) (common.Hash, error) {
+	if root != "" {
+		if err := common.HashCalibrator(root); err != nil {
+			return common.Hash{}, xfsgo.NewRPCErrorCause(-32001, err)
+		}
+		rootHash := common.Hex2Hash(root)
+		if err := checkState(state.BlockChain, rootHash); err != nil {
+			return common.Hash{}, err
+		}
+		return rootHash, nil
+	}
+	if number != "" {
+		num, ok := new(big.Int).SetString(number, 10)
+		if !ok {
+			return common.Hash{}, xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		roots := state.BlockChain.GetBlockRootsByNumber(num.Uint64())
+		if roots == nil {
+			return common.Hash{}, xfsgo.NewRPCError(-1006, "block not found")
+		}
+		if err := checkState(state.BlockChain, roots.StateRoot); err != nil {
+			return common.Hash{}, err
+		}
+		return roots.StateRoot, nil
+	}
+	return state.BlockChain.CurrentBHeader().StateRoot, nil
+}
+
+func (state *StateAPIHandler) GetExtra(args GetExtraArgs, resp *string) error {
+	rootHash, err := state.resolveStateRoot(args.RootHash, args.Number)
+	if err != nil {
+		return err
+	}
+	if args.Address == "" {
+		return xfsgo.NewRPCError(-32601, "Address not found")
+	}
+	if err := common.AddrCalibrator(args.Address); err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	stateTree := xfsgo.NewStateTree(state.StateDb, rootHash.Bytes())
+	address := common.B58ToAddress([]byte(args.Address))
+	if extra := stateTree.GetExtra(address); len(extra) > 0 {
+		*resp = "0x" + hex.EncodeToString(extra)
+	}
+	return nil
+}
+
+// GetPreimage returns the hex encoded preimage of a hash computed by the vm, such as
+// the slot of a contract storage entry, it is empty if the preimage is unknown.
+func (state *StateAPIHandler) GetPreimage(args GetPreimageArgs, resp *string) error {
+	if args.Hash == "" {
+		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
+	}
+	if err := common.HashCalibrator(args.Hash); err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	if preimage := xfsgo.ReadPreimage(state.StateDb, common.Hex2Hash(args.Hash)); preimage != nil {
+		*resp = "0x" + hex.EncodeToString(preimage)
+	}
+	return nil
+}
+
+// GetStorageRange returns a page of the storage of the account in key order, starting
+// from the given hex encoded key. Keys are the hashed storage keys of the storage tree.
+func (state *StateAPIHandler) GetStorageRange(ctx context.Context, args GetStorageRangeArgs, resp **StorageRangeResp) error {
+	rootHash, err := state.resolveStateRoot(args.RootHash, args.Number)
+	if err != nil {
+		return err
+	}
+	if args.Address == "" {
+		return xfsgo.NewRPCError(-32601, "Address not found")
+	}
+	if err = common.AddrCalibrator(args.Address); err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	var start []byte
+	if args.Start != "" {
+		if start, err = decodeHexArg(args.Start); err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, err)
+		}
+	}
+	limit := defaultStorageRangeLimit
+	if args.Limit != "" {
+		if limit, err = strconv.Atoi(args.Limit); err != nil || limit <= 0 {
+			return xfsgo.NewRPCError(-1006, "invalid limit")
+		}
+		if limit > maxStorageRangeLimit {
+			limit = maxStorageRangeLimit
+		}
+	}
+	stateTree := xfsgo.NewStateTree(state.StateDb, rootHash.Bytes())
+	address := common.B58ToAddress([]byte(args.Address))
+	result := &StorageRangeResp{
+		Storage: make([]*StorageEntryResp, 0),
+	}
+	if obj := stateTree.GetStateObj(address); obj != nil {
+		obj.IterateStorage(start, func(key []byte, value []byte) bool {
+			if err = xfsgo.ContextError(ctx); err != nil {
+				return false
+			}
+			if len(result.Storage) == limit {
+				result.Next = "0x" + hex.EncodeToString(key)
+				return false
+			}
+			result.Storage = append(result.Storage, &StorageEntryResp{
+				Key:   "0x" + hex.EncodeToString(key),
+				Value: "0x" + hex.EncodeToString(value),
+			})
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	*resp = result
+	return nil
+}
+
+// DumpAccounts returns a page of the accounts of the state in key order, starting from
+// the given hex encoded key. Keys are the hashes of the addresses of the accounts, the
+// storage of the accounts is included when storage is set.
+func (state *StateAPIHandler) DumpAccounts(ctx context.Context, args DumpAccountsArgs, resp **DumpAccountsResp) error {
+	rootHash, err := state.resolveStateRoot(args.RootHash, args.Number)
+	if err != nil {
+		return err
+	}
+	conf := &xfsgo.DumpConfig{
+		Limit: defaultDumpAccountsLimit,
+	}
+	if args.Start != "" {
+		if conf.Start, err = decodeHexArg(args.Start); err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, err)
+		}
+	}
+	if args.Limit != "" {
+		if conf.Limit, err = strconv.Atoi(args.Limit); err != nil || conf.Limit <= 0 {
+			return xfsgo.NewRPCError(-1006, "invalid limit")
+		}
+		if conf.Limit > maxDumpAccountsLimit {
+			conf.Limit = maxDumpAccountsLimit
+		}
+	}
+	if args.Storage != "" {
+		if conf.Storage, err = strconv.ParseBool(args.Storage); err != nil {
+			return xfsgo.NewRPCError(-32602, "invalid storage flag")
+		}
+	}
+	if err = xfsgo.ContextError(ctx); err != nil {
+		return err
+	}
+	reader, err := xfsgo.OpenStateReader(state.StateDb, rootHash)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	dump, err := reader.Dump(conf)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	result := &DumpAccountsResp{
+		Root:     dump.Root,
+		Accounts: make([]*DumpAccountResp, len(dump.Accounts)),
+	}
+	for i, account := range dump.Accounts {
+		item := &DumpAccountResp{
+			Key:       "0x" + hex.EncodeToString(account.Key),
+			Address:   account.Address.B58String(),
+			Balance:   account.Balance.Text(10),
+			Nonce:     account.Nonce,
+			CodeHash:  account.CodeHash,
+			StateRoot: account.StateRoot,
+		}
+		for _, slot := range account.Storage {
+			item.Storage = append(item.Storage, &StorageEntryResp{
+				Key:   "0x" + hex.EncodeToString(slot.Key),
+				Value: "0x" + hex.EncodeToString(slot.Value),
+			})
+		}
+		result.Accounts[i] = item
+	}
+	if dump.Next != nil {
+		result.Next = "0x" + hex.EncodeToString(dump.Next)
+	}
+	*resp = result
+	return nil
+}
+
+// GetProof returns the merkle proof of the account in the state of the block with the
+// given number, or of the current block.
+func (state *StateAPIHandler) GetProof(args GetProofArgs, resp **AccountProofResp) error {
+	if args.Address == "" {
+		return xfsgo.NewRPCError(-32601, "Address not found")
+	}
+	if err := common.AddrCalibrator(args.Address); err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	header := state.BlockChain.CurrentBHeader()
+	if args.Number != "" {
+		num, ok := new(big.Int).SetString(args.Number, 10)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		block := state.BlockChain.GetBlockByNumber(num.Uint64())
+		if block == nil {
+			return xfsgo.NewRPCError(-1006, "block not found")
+		}
+		header = block.Header
+	}
+	if err := checkState(state.BlockChain, header.StateRoot); err != nil {
+		return err
+	}
+	headerEnc, err := rawencode.Encode(header)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	stateTree := xfsgo.NewStateTree(state.StateDb, header.StateRoot.Bytes())
+	proof, err := stateTree.GetProof(common.B58ToAddress([]byte(args.Address)))
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	result := &AccountProofResp{
+		Address:   args.Address,
+		Header:    "0x" + hex.EncodeToString(headerEnc),
+		StateRoot: header.StateRoot,
+		Proof:     make([]string, len(proof)),
+	}
+	for i, node := range proof {
+		result.Proof[i] = "0x" + hex.EncodeToString(node)
+	}
+	*resp = result
+	return nil
 }
@@ -17,6 +17,7 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -30,6 +31,7 @@ import (
 
 type TxPoolHandler struct {
 	TxPool *xfsgo.TxPool
+	Wallet *xfsgo.Wallet
 }
 
 type GetTranByHashArgs struct {
@@ -49,6 +51,65 @@ type RawTransactionArgs struct {
 type RemoveTxHashArgs struct {
 	Hash string `json:"hash"`
 }
+type FeeHistogramArgs struct {
+	Gas string `json:"gas"`
+}
+
+type FeeBucketResp struct {
+	GasPrice      string `json:"gas_price"`
+	Count         int    `json:"count"`
+	Gas           string `json:"gas"`
+	CumulativeGas string `json:"cumulative_gas"`
+}
+
+type FeeHistogramResp struct {
+	Buckets       []*FeeBucketResp `json:"buckets"`
+	BlockGasLimit string           `json:"block_gas_limit"`
+	// GasPrice is the estimated gas price to get a transaction using gas into the next block
+	GasPrice string `json:"gas_price"`
+}
+
+// TxPoolSubscribeArgs filters the events of a subscription, empty fields match all
+// the transactions.
+type TxPoolSubscribeArgs struct {
+	// Address is the sender of the transactions
+	Address string `json:"address"`
+	Hash    string `json:"hash"`
+	// Wallet matches the transactions sent from or to the accounts of the wallet,
+	// the watch-only addresses included
+	Wallet bool `json:"wallet"`
+}
+
+type GetPendingBySenderArgs struct {
+	Address string `json:"address"`
+}
+
+// SenderTxResp is a transaction of the sender waiting in the pool, a speed-up sends a
+// transaction of the same nonce paying at least ReplacePrice.
+type SenderTxResp struct {
+	*TransactionResp
+	Queued       bool   `json:"queued"`
+	ReplacePrice string `json:"replace_price"`
+	Replaceable  bool   `json:"replaceable"`
+}
+
+type TxPoolUnsubscribeArgs struct {
+	Subscription string `json:"subscription"`
+}
+
+// TxPoolEventResp is the notification of a tx pool event, Reason is one of the
+// reason codes of dropped transactions.
+type TxPoolEventResp struct {
+	Kind       string `json:"kind"`
+	Hash       string `json:"hash"`
+	From       string `json:"from"`
+	Nonce      uint64 `json:"nonce"`
+	GasPrice   string `json:"gas_price"`
+	ReplacedBy string `json:"replaced_by,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
 type StringRawTransaction struct {
 	Version   string `json:"version"`
 	To        string `json:"to"`
@@ -70,12 +131,156 @@ func (tx *TxPoolHandler) GetQueue(_ EmptyArgs, resp **TransactionsResp) error {
 	return coverTxs2Resp(data, resp)
 }
 
+// GetPendingBySender returns the pending and queued transactions of the address ordered by nonce.
+func (tx *TxPoolHandler) GetPendingBySender(args GetPendingBySenderArgs, resp *[]*SenderTxResp) error {
+	if args.Address == "" {
+		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
+	}
+	if err := common.AddrCalibrator(args.Address); err != nil {
+		return xfsgo.NewRPCErrorCause(-6001, err)
+	}
+	addr := common.B58ToAddress([]byte(args.Address))
+	result := make([]*SenderTxResp, 0)
+	for _, stx := range tx.TxPool.GetPendingBySender(addr) {
+		item := &SenderTxResp{
+			Queued:       stx.Queued,
+			ReplacePrice: stx.ReplacePrice.Text(10),
+			Replaceable:  stx.Replaceable,
+		}
+		if err := coverTx2Resp(stx.Tx, &item.TransactionResp); err != nil {
+			return err
+		}
+		result = append(result, item)
+	}
+	*resp = result
+	return nil
+}
+
 func (tx *TxPoolHandler) GetPendingSize(_ EmptyArgs, resp *int) error {
 	data := tx.TxPool.GetTransactionsSize()
 	*resp = data
 	return nil
 }
 
+// FeeHistogram returns the distribution of gas prices among the pending transactions and
+// the gas price needed to get a transaction using the given gas into the next block.
+func (tx *TxPoolHandler) FeeHistogram(args FeeHistogramArgs, resp **FeeHistogramResp) error {
+	gas := common.TxGas
+	if args.Gas != "" {
+		var ok bool
+		if gas, ok = new(big.Int).SetString(args.Gas, 10); !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+	}
+	histogram, gasPrice := tx.TxPool.FeeHistogram(gas)
+	result := &FeeHistogramResp{
+		Buckets:       make([]*FeeBucketResp, 0, len(histogram)),
+		BlockGasLimit: tx.TxPool.GetGasLimit().Text(10),
+		GasPrice:      gasPrice.Text(10),
+	}
+	for _, bucket := range histogram {
+		result.Buckets = append(result.Buckets, &FeeBucketResp{
+			GasPrice:      bucket.GasPrice.Text(10),
+			Count:         bucket.Count,
+			Gas:           bucket.Gas.Text(10),
+			CumulativeGas: bucket.CumulativeGas.Text(10),
+		})
+	}
+	*resp = result
+	return nil
+}
+
+func coverTxPoolEvent2Resp(event xfsgo.TxPoolEvent) *TxPoolEventResp {
+	hash := event.Tx.Hash()
+	from, _ := event.Tx.FromAddr()
+	resp := &TxPoolEventResp{
+		Kind:     event.Kind,
+		Hash:     hash.Hex(),
+		From:     from.B58String(),
+		Nonce:    event.Tx.Nonce,
+		GasPrice: event.Tx.GasPrice.Text(10),
+		Reason:   event.Reason,
+		Error:    event.Error,
+	}
+	if event.Kind == xfsgo.TxPoolReplaced {
+		resp.ReplacedBy = event.ReplacedBy.Hex()
+	}
+	return resp
+}
+
+// Subscribe notifies the websocket client of the transactions accepted, replaced and
+// dropped by the pool, it returns the id of the subscription.
+func (tx *TxPoolHandler) Subscribe(ctx context.Context, args TxPoolSubscribeArgs, resp *string) error {
+	notifier, ok := xfsgo.NotifierFromContext(ctx)
+	if !ok {
+		return xfsgo.ErrNotificationsUnsupported
+	}
+	var (
+		from   common.Address
+		txHash common.Hash
+	)
+	if args.Address != "" {
+		if err := common.AddrCalibrator(args.Address); err != nil {
+			return xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		from = common.B58ToAddress([]byte(args.Address))
+	}
+	if args.Hash != "" {
+		if err := common.HashCalibrator(args.Hash); err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, err)
+		}
+		txHash = common.Hex2Hash(args.Hash)
+	}
+	sub := tx.TxPool.SubscribeEvents()
+	*resp = notifier.Subscribe(func(notify xfsgo.NotifyFn, quit <-chan struct{}) {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case e := <-sub.Chan():
+				event := e.(xfsgo.TxPoolEvent)
+				if args.Address != "" {
+					if sender, err := event.Tx.FromAddr(); err != nil || !sender.Equals(from) {
+						continue
+					}
+				}
+				if args.Hash != "" && event.Tx.Hash() != txHash && event.ReplacedBy != txHash {
+					continue
+				}
+				if args.Wallet && !tx.walletTx(event.Tx) {
+					continue
+				}
+				if err := notify(coverTxPoolEvent2Resp(event)); err != nil {
+					return
+				}
+			case <-quit:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// walletTx reports whether the transaction is sent from or to an account of the wallet.
+func (tx *TxPoolHandler) walletTx(t *xfsgo.Transaction) bool {
+	if tx.Wallet == nil {
+		return false
+	}
+	if sender, err := t.FromAddr(); err == nil && tx.Wallet.Owns(sender) {
+		return true
+	}
+	return tx.Wallet.Owns(t.To)
+}
+
+// Unsubscribe ends a subscription made on the same connection.
+func (tx *TxPoolHandler) Unsubscribe(ctx context.Context, args TxPoolUnsubscribeArgs, resp *bool) error {
+	notifier, ok := xfsgo.NotifierFromContext(ctx)
+	if !ok {
+		return xfsgo.ErrNotificationsUnsupported
+	}
+	*resp = notifier.Unsubscribe(args.Subscription)
+	return nil
+}
+
 func (tx *TxPoolHandler) RemoveTx(args RemoveTxHashArgs, resp *string) error {
 	if args.Hash == "" {
 		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
@@ -127,7 +332,7 @@ func (tx *TxPoolHandler) SendRawTransaction(args RawTransactionArgs, resp *strin
 		return xfsgo.NewRPCErrorCause(-32001, err)
 	}
 	if err := tx.TxPool.Add(txdata); err != nil {
-		return xfsgo.NewRPCErrorCause(-32001, err)
+		return txError(-32001, err)
 	}
 	txhash := txdata.Hash()
 	*resp = txhash.Hex()
@@ -22,6 +22,7 @@ import (
 	"math/big"
 	"xfsgo"
 	"xfsgo/common"
+	"xfsgo/core"
 )
 
 type EmptyArgs = interface{}
@@ -31,6 +32,8 @@ type StateObjResp struct {
 	Nonce     uint64       `json:"nonce"`
 	Extra     *string      `json:"extra"`
 	Code      *string      `json:"code"`
+	CodeHash  *common.Hash `json:"code_hash"`
+	CodeSize  int          `json:"code_size"`
 	StateRoot *common.Hash `json:"state_root"`
 }
 
@@ -47,10 +50,12 @@ type BlockHeaderResp struct {
 	GasLimit         *big.Int    `json:"gas_limit"`
 	GasUsed          *big.Int    `json:"gas_used"`
 	// pow
-	Bits       uint32      `json:"bits"`
-	Nonce      uint32      `json:"nonce"`
-	ExtraNonce uint64      `json:"extranonce"`
-	Hash       common.Hash `json:"hash"`
+	Bits        uint32              `json:"bits"`
+	Nonce       uint32              `json:"nonce"`
+	ExtraNonce  uint64              `json:"extranonce"`
+	ExtraData   string              `json:"extra_data,omitempty"`
+	RewardSplit []xfsgo.RewardShare `json:"reward_split,omitempty"`
+	Hash        common.Hash         `json:"hash"`
 }
 
 type BlockResp struct {
@@ -66,11 +71,20 @@ type BlockResp struct {
 	GasLimit         *big.Int    `json:"gas_limit"`
 	GasUsed          *big.Int    `json:"gas_used"`
 	// pow
-	Bits         uint32           `json:"bits"`
-	Nonce        uint32           `json:"nonce"`
-	ExtraNonce   uint64           `json:"extranonce"`
-	Hash         common.Hash      `json:"hash"`
-	Transactions TransactionsResp `json:"transactions"`
+	Bits        uint32              `json:"bits"`
+	Nonce       uint32              `json:"nonce"`
+	ExtraNonce  uint64              `json:"extranonce"`
+	ExtraData   string              `json:"extra_data,omitempty"`
+	RewardSplit []xfsgo.RewardShare `json:"reward_split,omitempty"`
+	Hash        common.Hash         `json:"hash"`
+	// Transactions holds the full transactions of the block, TransactionHashes only
+	// their hashes when the block is requested without the transactions.
+	Transactions      TransactionsResp `json:"transactions,omitempty"`
+	TransactionHashes []common.Hash    `json:"transaction_hashes,omitempty"`
+	// Canonical reports whether the block is in the main chain, CanonicalHash is the
+	// hash of the main chain block at its height, zero if the main chain is shorter.
+	Canonical     bool        `json:"canonical"`
+	CanonicalHash common.Hash `json:"canonical_hash"`
 }
 
 type TransactionResp struct {
@@ -83,6 +97,7 @@ type TransactionResp struct {
 	From     string         `json:"from"`
 	Hash     common.Hash    `json:"hash"`
 	Data     []byte         `json:"data"`
+	Size     int            `json:"size"`
 }
 
 type MinerStartArgs struct {
@@ -90,16 +105,17 @@ type MinerStartArgs struct {
 }
 
 type MinerStatusResp struct {
-	Status           bool   `json:"status"`
-	LastStartTime    string `json:"last_start_time"`
-	Workers          string `json:"workers"`
-	Coinbase         string `json:"coinbase"`
-	GasPrice         string `json:"gas_price"`
-	GasLimit         string `json:"gas_limit"`
-	TargetHeight     string `json:"target_height"`
-	TargetDifficulty string `json:"target_difficulty"`
-	TargetHashRate   string `json:"target_hash_rate"`
-	HashRate         string `json:"hash_rate"`
+	Status           bool                `json:"status"`
+	LastStartTime    string              `json:"last_start_time"`
+	Workers          string              `json:"workers"`
+	Coinbase         string              `json:"coinbase"`
+	GasPrice         string              `json:"gas_price"`
+	GasLimit         string              `json:"gas_limit"`
+	TargetHeight     string              `json:"target_height"`
+	TargetDifficulty string              `json:"target_difficulty"`
+	TargetHashRate   string              `json:"target_hash_rate"`
+	HashRate         string              `json:"hash_rate"`
+	RewardSplit      []xfsgo.RewardShare `json:"reward_split,omitempty"`
 }
 
 type ReceiptResp struct {
@@ -110,6 +126,22 @@ type ReceiptResp struct {
 	BlockHash  common.Hash `json:"block_hash"`
 	BlockIndex uint64      `json:"block_index"`
 	TxIndex    uint64      `json:"tx_index"`
+	VMError    uint32      `json:"vm_error,omitempty"`
+	Logs       []*LogResp  `json:"logs,omitempty"`
+	Bloom      *core.Bloom `json:"bloom,omitempty"`
+}
+
+// LogResp is a log of a receipt with its position in the chain, LogIndex is the index
+// of the log in the block.
+type LogResp struct {
+	Address     common.Address `json:"address"`
+	Topics      []common.Hash  `json:"topics"`
+	Data        []byte         `json:"data"`
+	BlockHeight uint64         `json:"block_height"`
+	BlockHash   common.Hash    `json:"block_hash"`
+	TxHash      common.Hash    `json:"tx_hash"`
+	TxIndex     uint           `json:"tx_index"`
+	LogIndex    uint           `json:"log_index"`
 }
 
 type ChainStatusResp struct {
@@ -177,7 +209,7 @@ func coverTxs2Resp(pending []*xfsgo.Transaction, dst **TransactionsResp) error {
 
 // }
 
-func coverBlock2Resp(block *xfsgo.Block, dst **BlockResp) error {
+func coverBlock2Resp(block *xfsgo.Block, fullTxs bool, dst **BlockResp) error {
 	if block == nil {
 		return nil
 	}
@@ -189,6 +221,15 @@ func coverBlock2Resp(block *xfsgo.Block, dst **BlockResp) error {
 		return err
 	}
 	result.Hash = block.HeaderHash()
+	result.ExtraData = string(block.Header.ExtraData)
+	if !fullTxs {
+		result.Transactions = nil
+		for _, item := range block.Transactions {
+			result.TransactionHashes = append(result.TransactionHashes, item.Hash())
+		}
+		*dst = result
+		return nil
+	}
 	txs := make([]*TransactionResp, 0)
 	for _, item := range block.Transactions {
 		var txres *TransactionResp
@@ -208,11 +249,19 @@ func coverBlockHeader2Resp(block *xfsgo.Block, dst **BlockHeaderResp) error {
 	if block == nil {
 		return nil
 	}
-	if err := common.Objcopy(block.Header, &dst); err != nil {
+	return coverHeader2Resp(block.Header, dst)
+}
+
+func coverHeader2Resp(header *xfsgo.BlockHeader, dst **BlockHeaderResp) error {
+	if header == nil {
+		return nil
+	}
+	if err := common.Objcopy(header, &dst); err != nil {
 		return err
 	}
 	result := *dst
-	result.Hash = block.HeaderHash()
+	result.Hash = header.HeaderHash()
+	result.ExtraData = string(header.ExtraData)
 	return nil
 }
 
@@ -231,8 +280,29 @@ func coverTx2Resp(tx *xfsgo.Transaction, dst **TransactionResp) error {
 		return err
 	}
 	result.From = from.B58String()
+	result.Size = tx.Size()
 	return nil
 }
+func coverLogs2Resp(logs []*core.Log) []*LogResp {
+	if len(logs) == 0 {
+		return nil
+	}
+	result := make([]*LogResp, len(logs))
+	for i, l := range logs {
+		result[i] = &LogResp{
+			Address:     l.Address,
+			Topics:      l.Topics,
+			Data:        l.Data,
+			BlockHeight: l.BlockHeight,
+			BlockHash:   l.BlockHash,
+			TxHash:      l.TxHash,
+			TxIndex:     l.TxIndex,
+			LogIndex:    l.Index,
+		}
+	}
+	return result
+}
+
 func coverReceipt(src *ReceiptResp, dst **ReceiptResp) error {
 	if src == nil {
 		return nil
@@ -255,12 +325,14 @@ func coverState2Resp(state *xfsgo.StateObj, dst **StateObjResp) error {
 	}
 	code := state.GetCode()
 	if code != nil {
-		codehex := hex.EncodeToString(state.GetExtra())
-		if codehex != "" {
-			codehex = "0x" + codehex
-			result.Code = &codehex
-		}
+		codehex := "0x" + hex.EncodeToString(code)
+		result.Code = &codehex
+	}
+	codeHash := state.GetCodeHash()
+	if !bytes.Equal(codeHash[:], common.HashZ[:]) {
+		result.CodeHash = &codeHash
 	}
+	result.CodeSize = len(code)
 	stateRoot := state.GetStateRoot()
 	if !bytes.Equal(stateRoot[:], common.HashZ[:]) {
 		result.StateRoot = &stateRoot
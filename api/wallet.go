@@ -18,11 +18,18 @@ package api
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"encoding/hex"
 	"math/big"
 	"sort"
+	"strconv"
+	"time"
 	"xfsgo"
 	"xfsgo/common"
+	"xfsgo/core"
+	"xfsgo/vm"
+
+	"github.com/sirupsen/logrus"
 )
 
 type WalletHandler struct {
@@ -57,6 +64,65 @@ type SendTransactionArgs struct {
 	GasPrice string `json:"gas_price"`
 	Value    string `json:"value"`
 	Nonce    string `json:"nonce"`
+	// Reservation is the id of a reservation the transaction spends.
+	Reservation string `json:"reservation"`
+}
+
+type SetAccountExtraArgs struct {
+	Address     string `json:"address"`
+	Extra       string `json:"extra"`
+	GasLimit    string `json:"gas_limit"`
+	GasPrice    string `json:"gas_price"`
+	Nonce       string `json:"nonce"`
+	Reservation string `json:"reservation"`
+}
+
+type ReserveArgs struct {
+	Address string `json:"address"`
+	Value   string `json:"value"`
+	// TTL is the lifetime of the reservation in seconds.
+	TTL string `json:"ttl"`
+}
+
+type ReservationArgs struct {
+	ID string `json:"id"`
+}
+
+type GetReservationsArgs struct {
+	Address string `json:"address"`
+}
+
+type ReservationResp struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Expires int64  `json:"expires"`
+	TxHash  string `json:"tx_hash,omitempty"`
+}
+
+// WalletTxResp is a transaction of the wallet history. Local is set for transactions
+// sent by this wallet, the others are sends of the address found on the chain.
+type WalletTxResp struct {
+	Hash          string                      `json:"hash"`
+	From          string                      `json:"from"`
+	To            string                      `json:"to"`
+	Value         string                      `json:"value"`
+	Nonce         uint64                      `json:"nonce"`
+	GasPrice      string                      `json:"gas_price,omitempty"`
+	Local         bool                        `json:"local"`
+	Submitted     int64                       `json:"submitted,omitempty"`
+	Status        string                      `json:"status"`
+	Transitions   []*xfsgo.WalletTxTransition `json:"transitions,omitempty"`
+	Replaces      string                      `json:"replaces,omitempty"`
+	ReplacedBy    string                      `json:"replaced_by,omitempty"`
+	BlockHeight   uint64                      `json:"block_height,omitempty"`
+	BlockHash     string                      `json:"block_hash,omitempty"`
+	Confirmations uint64                      `json:"confirmations"`
+}
+
+type GetSpendableBalanceArgs struct {
+	Address string `json:"address"`
+	MinConf string `json:"min_conf"`
 }
 
 type SetGasLimitArgs struct {
@@ -67,6 +133,275 @@ type SetGasPriceArgs struct {
 	GasPrice string `json:"gas_price"`
 }
 
+// GetSpendableBalance returns the balance of the address which has at least min_conf
+// confirmations and is not locked by pending transactions sent from the address.
+func (handler *WalletHandler) GetSpendableBalance(args GetSpendableBalanceArgs, resp *string) error {
+	var addr common.Address
+	if args.Address != "" {
+		if err := common.AddrCalibrator(args.Address); err != nil {
+			return xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		addr = common.B58ToAddress([]byte(args.Address))
+	} else {
+		addr = handler.Wallet.GetDefault()
+	}
+	minConf := uint64(1)
+	if args.MinConf != "" {
+		num, err := strconv.ParseUint(args.MinConf, 10, 64)
+		if err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+		minConf = num
+	}
+	balance := handler.BlockChain.GetConfirmedBalance(addr, minConf)
+	balance.Sub(balance, handler.TxPendingPool.PendingCost(addr))
+	if balance.Sign() < 0 {
+		balance.SetInt64(0)
+	}
+	*resp = balance.Text(10)
+	return nil
+}
+
+type GetTotalBalanceArgs struct {
+	MinConf string `json:"min_conf"`
+}
+
+type AccountBalanceResp struct {
+	Address   string `json:"address"`
+	Confirmed string `json:"confirmed"`
+	Pending   string `json:"pending"`
+	WatchOnly bool   `json:"watch_only"`
+}
+
+type TotalBalanceResp struct {
+	Confirmed string                `json:"confirmed"`
+	Pending   string                `json:"pending"`
+	Accounts  []*AccountBalanceResp `json:"accounts"`
+}
+
+// GetTotalBalance returns the balances of all the accounts of the wallet, the watch-only
+// addresses included, and their sums. The confirmed balance has at least min_conf
+// confirmations, the pending balance is the balance of the head after the pending
+// transactions sent from and to the account.
+func (handler *WalletHandler) GetTotalBalance(args GetTotalBalanceArgs, resp **TotalBalanceResp) error {
+	minConf := uint64(1)
+	if args.MinConf != "" {
+		num, err := strconv.ParseUint(args.MinConf, 10, 64)
+		if err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+		minConf = num
+	}
+	var (
+		confirmedSum = new(big.Int)
+		pendingSum   = new(big.Int)
+		head         = handler.BlockChain.CommittedState()
+	)
+	result := &TotalBalanceResp{
+		Accounts: make([]*AccountBalanceResp, 0),
+	}
+	for _, addr := range handler.Wallet.Accounts() {
+		confirmed := handler.BlockChain.GetConfirmedBalance(addr, minConf)
+		pending := new(big.Int)
+		if b := head.GetBalance(addr); b != nil {
+			pending.Set(b)
+		}
+		pending.Sub(pending, handler.TxPendingPool.PendingCost(addr))
+		pending.Add(pending, handler.TxPendingPool.PendingIncoming(addr))
+		if pending.Sign() < 0 {
+			pending.SetInt64(0)
+		}
+		confirmedSum.Add(confirmedSum, confirmed)
+		pendingSum.Add(pendingSum, pending)
+		result.Accounts = append(result.Accounts, &AccountBalanceResp{
+			Address:   addr.B58String(),
+			Confirmed: confirmed.Text(10),
+			Pending:   pending.Text(10),
+			WatchOnly: handler.Wallet.IsWatchOnly(addr),
+		})
+	}
+	sort.Slice(result.Accounts, func(i, j int) bool {
+		return result.Accounts[i].Address < result.Accounts[j].Address
+	})
+	result.Confirmed = confirmedSum.Text(10)
+	result.Pending = pendingSum.Text(10)
+	*resp = result
+	return nil
+}
+
+func coverReservation2Resp(r *xfsgo.Reservation) *ReservationResp {
+	resp := &ReservationResp{
+		ID:      r.ID,
+		Address: r.Address.B58String(),
+		Amount:  r.Amount.Text(10),
+		Expires: r.Expires,
+	}
+	if r.TxHash != (common.Hash{}) {
+		resp.TxHash = r.TxHash.Hex()
+	}
+	return resp
+}
+
+// Reserve earmarks value base coins of the address for ttl seconds. Only transactions
+// sent with the returned reservation id can spend the reserved funds.
+func (handler *WalletHandler) Reserve(args ReserveArgs, resp **ReservationResp) error {
+	var addr common.Address
+	if args.Address != "" {
+		if err := common.AddrCalibrator(args.Address); err != nil {
+			return xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		addr = common.B58ToAddress([]byte(args.Address))
+	} else {
+		addr = handler.Wallet.GetDefault()
+	}
+	if args.Value == "" {
+		return xfsgo.NewRPCError(-1006, "value not be empty")
+	}
+	amount, err := common.BaseCoin2Atto(args.Value)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	ttl, err := strconv.ParseUint(args.TTL, 10, 32)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	r, err := handler.Wallet.Reserve(addr, amount, time.Duration(ttl)*time.Second)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	*resp = coverReservation2Resp(r)
+	return nil
+}
+
+// ReleaseReservation removes a reservation before it expires.
+func (handler *WalletHandler) ReleaseReservation(args ReservationArgs, resp *string) error {
+	if err := handler.Wallet.Release(args.ID); err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	*resp = args.ID
+	return nil
+}
+
+// GetReservations returns the reservations of the address, or of every address of the
+// wallet if no address is given.
+func (handler *WalletHandler) GetReservations(args GetReservationsArgs, resp *[]*ReservationResp) error {
+	var addr common.Address
+	if args.Address != "" {
+		if err := common.AddrCalibrator(args.Address); err != nil {
+			return xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		addr = common.B58ToAddress([]byte(args.Address))
+	}
+	list := make([]*ReservationResp, 0)
+	for _, r := range handler.Wallet.Reservations(addr) {
+		list = append(list, coverReservation2Resp(r))
+	}
+	*resp = list
+	return nil
+}
+
+// chainConfirmation returns the main chain block including the transaction and its
+// number of confirmations, the header is nil if the transaction is not on the main chain.
+func (handler *WalletHandler) chainConfirmation(hash common.Hash, head uint64) (*xfsgo.BlockHeader, uint64) {
+	index := handler.BlockChain.GetReceiptByHashIndex(hash)
+	if index == nil {
+		return nil, 0
+	}
+	header := handler.BlockChain.GetBlockHeaderByNumber(index.BlockIndex)
+	if header == nil || header.HeaderHash() != index.BlockHash || header.Height > head {
+		return nil, 0
+	}
+	return header, head - header.Height + 1
+}
+
+func coverWalletTx2Resp(wtx *xfsgo.WalletTx) *WalletTxResp {
+	resp := &WalletTxResp{
+		Hash:        wtx.Hash.Hex(),
+		From:        wtx.From.B58String(),
+		To:          wtx.To.B58String(),
+		Value:       wtx.Value.Text(10),
+		Nonce:       wtx.Nonce,
+		GasPrice:    wtx.GasPrice.Text(10),
+		Local:       true,
+		Submitted:   wtx.Submitted,
+		Status:      wtx.Status,
+		Transitions: wtx.Transitions,
+	}
+	if wtx.Replaces != (common.Hash{}) {
+		resp.Replaces = wtx.Replaces.Hex()
+	}
+	if wtx.ReplacedBy != (common.Hash{}) {
+		resp.ReplacedBy = wtx.ReplacedBy.Hex()
+	}
+	return resp
+}
+
+// GetTransactionHistory returns the transactions sent from the address. Transactions sent
+// by the wallet carry their local metadata, the status and confirmations are taken from
+// the main chain, which also adds the sends of the address made elsewhere.
+func (handler *WalletHandler) GetTransactionHistory(args WalletByAddressArgs, resp *[]*WalletTxResp) error {
+	var addr common.Address
+	if args.Address != "" {
+		if err := common.AddrCalibrator(args.Address); err != nil {
+			return xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		addr = common.B58ToAddress([]byte(args.Address))
+	} else {
+		addr = handler.Wallet.GetDefault()
+	}
+	local, err := handler.Wallet.GetTransactionHistory(addr)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	head := handler.BlockChain.CurrentBHeader().Height
+	known := make(map[common.Hash]struct{}, len(local))
+	list := make([]*WalletTxResp, 0, len(local))
+	for _, wtx := range local {
+		known[wtx.Hash] = struct{}{}
+		item := coverWalletTx2Resp(wtx)
+		if header, confirmations := handler.chainConfirmation(wtx.Hash, head); header != nil {
+			blockHash := header.HeaderHash()
+			item.Status = xfsgo.WalletTxConfirmed
+			item.BlockHeight = header.Height
+			item.BlockHash = blockHash.Hex()
+			item.Confirmations = confirmations
+		} else if item.Status == xfsgo.WalletTxConfirmed {
+			// the block including the transaction left the main chain
+			item.Status = xfsgo.WalletTxPending
+		}
+		list = append(list, item)
+	}
+	events, err := handler.BlockChain.GetAccountHistory(addr, 0, head)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	for _, event := range events {
+		if event.Kind != xfsgo.AccountEventSend {
+			continue
+		}
+		if _, exists := known[event.TxHash]; exists {
+			continue
+		}
+		item := &WalletTxResp{
+			Hash:          event.TxHash.Hex(),
+			From:          addr.B58String(),
+			To:            event.Counterparty.B58String(),
+			Value:         event.Amount.Text(10),
+			Status:        xfsgo.WalletTxConfirmed,
+			BlockHeight:   event.Height,
+			BlockHash:     event.BlockHash.Hex(),
+			Confirmations: head - event.Height + 1,
+		}
+		if tx := handler.BlockChain.GetTransactionByTxHash(event.TxHash); tx != nil {
+			item.Nonce = tx.Nonce
+			item.GasPrice = tx.GasPrice.Text(10)
+		}
+		list = append(list, item)
+	}
+	*resp = list
+	return nil
+}
+
 func (handler *WalletHandler) Create(_ EmptyArgs, resp *string) error {
 	addr, err := handler.Wallet.AddByRandom()
 	if err != nil {
@@ -107,10 +442,8 @@ func (handler *WalletHandler) Del(args WalletByAddressArgs, resp *interface{}) e
 }
 
 func (handler *WalletHandler) List(_ EmptyArgs, resp *[]common.Address) error {
-	data := handler.Wallet.All()
 	var out Wallets
-	for addr, v := range data {
-		_ = v
+	for _, addr := range handler.Wallet.Accounts() {
 		r, err := handler.Wallet.GetWalletNewTime(addr)
 		if err != nil {
 			return err
@@ -132,6 +465,29 @@ func (handler *WalletHandler) List(_ EmptyArgs, resp *[]common.Address) error {
 	return nil
 }
 
+// ImportWatchOnly adds the address to the wallet without a private key, it is listed
+// and watched like the other accounts while signing for it is refused.
+func (handler *WalletHandler) ImportWatchOnly(args WalletByAddressArgs, resp *string) error {
+	if args.Address == "" {
+		return xfsgo.NewRPCError(-1006, "parameter cannot be empty")
+	}
+	if err := common.AddrCalibrator(args.Address); err != nil {
+		return xfsgo.NewRPCErrorCause(-6001, err)
+	}
+	addr := common.StrB58ToAddress(args.Address)
+	if err := handler.Wallet.AddWatchOnly(addr); err != nil {
+		return xfsgo.NewRPCErrorCause(-6001, err)
+	}
+	*resp = addr.B58String()
+	return nil
+}
+
+// ListWatchOnly returns the watch-only addresses of the wallet.
+func (handler *WalletHandler) ListWatchOnly(_ EmptyArgs, resp *[]common.Address) error {
+	*resp = handler.Wallet.WatchOnly()
+	return nil
+}
+
 func (handler *WalletHandler) GetDefaultAddress(_ EmptyArgs, resp *string) error {
 	address := handler.Wallet.GetDefault()
 	zero := [25]byte{0}
@@ -200,17 +556,35 @@ func (handler *WalletHandler) ImportByPrivateKey(args WalletImportArgs, resp *st
 }
 
 func (handler *WalletHandler) SendTransaction(args SendTransactionArgs, resp *string) error {
+	if err := checkSynced(handler.BlockChain); err != nil {
+		return err
+	}
+	fromAddr, stdTx, privateKey, err := handler.parseSendTransaction(args)
+	if err != nil {
+		return err
+	}
+	result, err := handler.sendSigned("Wallet.SendTransaction", fromAddr, args.Reservation, stdTx, args.Nonce == "", privateKey)
+	if err != nil {
+		return txError(-1006, err)
+	}
+	*resp = result.Hex()
+	return nil
+}
+
+// parseSendTransaction returns the sender, the unsigned transaction and the key of the
+// sender of the send transaction arguments.
+func (handler *WalletHandler) parseSendTransaction(args SendTransactionArgs) (common.Address, *xfsgo.StdTransaction, *ecdsa.PrivateKey, error) {
 	var (
 		err   error
 		stdTx = new(xfsgo.StdTransaction)
 	)
 	// Judgment target address cannot be empty
 	if args.To == "" {
-		return xfsgo.NewRPCError(-1006, "to addr not be empty")
+		return common.Address{}, nil, nil, xfsgo.NewRPCError(-1006, "to addr not be empty")
 	}
 	// Judge that the transfer amount cannot be blank
 	if args.Value == "" {
-		return xfsgo.NewRPCError(-1006, "value not be empty")
+		return common.Address{}, nil, nil, xfsgo.NewRPCError(-1006, "value not be empty")
 	}
 
 	// Get the wallet address of the initiating transaction
@@ -218,7 +592,7 @@ func (handler *WalletHandler) SendTransaction(args SendTransactionArgs, resp *st
 	if args.From != "" {
 		// from Verify address rules
 		if err := common.AddrCalibrator(args.From); err != nil {
-			return xfsgo.NewRPCErrorCause(-6001, err)
+			return common.Address{}, nil, nil, xfsgo.NewRPCErrorCause(-6001, err)
 		}
 		fromAddr = common.B58ToAddress([]byte(args.From))
 	} else {
@@ -228,11 +602,11 @@ func (handler *WalletHandler) SendTransaction(args SendTransactionArgs, resp *st
 	// Take out the private key according to the wallet address of the initiating transaction
 	privateKey, err := handler.Wallet.GetKeyByAddress(fromAddr)
 	if err != nil {
-		return xfsgo.NewRPCErrorCause(-1006, err)
+		return common.Address{}, nil, nil, xfsgo.NewRPCErrorCause(-1006, err)
 	}
 	// to Verify address rules
 	if err = common.AddrCalibrator(args.To); err != nil {
-		return xfsgo.NewRPCErrorCause(-6001, err)
+		return common.Address{}, nil, nil, xfsgo.NewRPCErrorCause(-6001, err)
 	}
 	stdTx.To = common.StrB58ToAddress(args.To)
 	if args.GasLimit != "" {
@@ -243,7 +617,7 @@ func (handler *WalletHandler) SendTransaction(args SendTransactionArgs, resp *st
 	if args.GasPrice != "" {
 		gaspriceBig, ok := new(big.Int).SetString(args.GasPrice, 10)
 		if !ok {
-			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+			return common.Address{}, nil, nil, xfsgo.NewRPCError(-1006, "string to big.Int error")
 		}
 		stdTx.GasPrice = common.NanoCoin2Atto(gaspriceBig)
 	} else {
@@ -251,28 +625,251 @@ func (handler *WalletHandler) SendTransaction(args SendTransactionArgs, resp *st
 	}
 	stdTx.Value, err = common.BaseCoin2Atto(args.Value)
 	if err != nil {
-		return xfsgo.NewRPCErrorCause(-1006, err)
+		return common.Address{}, nil, nil, xfsgo.NewRPCErrorCause(-1006, err)
 	}
 	if args.Nonce != "" {
 		nonceBig, ok := new(big.Int).SetString(args.Nonce, 10)
 		if !ok {
-			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+			return common.Address{}, nil, nil, xfsgo.NewRPCError(-1006, "string to big.Int error")
 		}
 		stdTx.Nonce = nonceBig.Uint64()
-	} else {
-		state := handler.TxPendingPool.State()
-		stdTx.Nonce = state.GetNonce(fromAddr)
+	}
+	return fromAddr, stdTx, privateKey, nil
+}
+
+type BalanceDeltaResp struct {
+	Address string `json:"address"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Delta   string `json:"delta"`
+}
+
+type TxPreviewResp struct {
+	TxHash  string              `json:"tx_hash"`
+	Status  uint32              `json:"status"`
+	GasUsed string              `json:"gas_used"`
+	Fee     string              `json:"fee"`
+	VMError *VMErrorResp        `json:"vm_error,omitempty"`
+	Logs    []*core.Log         `json:"logs,omitempty"`
+	Deltas  []*BalanceDeltaResp `json:"balance_deltas"`
+}
+
+// PreviewTransaction signs the transaction SendTransaction would send and applies it to
+// a copy of the pending state without broadcasting it. It returns the receipt the
+// transaction would produce with the balance changes of the accounts. The signed
+// transaction is discarded, a transaction the state rejects returns its error.
+func (handler *WalletHandler) PreviewTransaction(args SendTransactionArgs, resp **TxPreviewResp) error {
+	if err := checkSynced(handler.BlockChain); err != nil {
+		return err
+	}
+	fromAddr, stdTx, privateKey, err := handler.parseSendTransaction(args)
+	if err != nil {
+		return err
+	}
+	if args.Nonce == "" {
+		stdTx.Nonce = handler.TxPendingPool.PendingNonce(fromAddr)
 	}
 	tx := xfsgo.NewTransactionByStd(stdTx)
-	err = tx.SignWithPrivateKey(privateKey)
+	if err = tx.SignWithPrivateKey(privateKey); err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	preview, err := handler.BlockChain.PreviewTransaction(tx, handler.TxPendingPool.GetTransactions())
+	if err != nil {
+		return txError(-1006, err)
+	}
+	receipt := preview.Receipt
+	result := &TxPreviewResp{
+		TxHash:  receipt.TxHash.Hex(),
+		Status:  receipt.Status,
+		GasUsed: receipt.GasUsed.Text(10),
+		Fee:     preview.Fee.Text(10),
+		Logs:    receipt.Logs,
+		Deltas:  make([]*BalanceDeltaResp, len(preview.Deltas)),
+	}
+	if receipt.VMError != 0 {
+		code := int(receipt.VMError)
+		result.VMError = &VMErrorResp{Code: code, Name: vm.ErrorCodeName(code)}
+	}
+	for i, delta := range preview.Deltas {
+		result.Deltas[i] = &BalanceDeltaResp{
+			Address: delta.Address.B58String(),
+			Before:  delta.Before.Text(10),
+			After:   delta.After.Text(10),
+			Delta:   new(big.Int).Sub(delta.After, delta.Before).Text(10),
+		}
+	}
+	*resp = result
+	return nil
+}
+
+// SetAccountExtra sends a transaction from the account to itself which stores the given
+// hex encoded data as the extra data of the account. Besides the base transaction gas,
+// every byte of extra data costs common.ExtraGasPerByte.
+func (handler *WalletHandler) SetAccountExtra(args SetAccountExtraArgs, resp *string) error {
+	var (
+		err   error
+		stdTx = new(xfsgo.StdTransaction)
+	)
+	if err = checkSynced(handler.BlockChain); err != nil {
+		return err
+	}
+	if args.Extra == "" {
+		return xfsgo.NewRPCError(-1006, "extra not be empty")
+	}
+	extraEnc := args.Extra
+	if len(extraEnc) > 1 && extraEnc[0] == '0' && extraEnc[1] == 'x' {
+		extraEnc = extraEnc[2:]
+	}
+	extra, err := hex.DecodeString(extraEnc)
 	if err != nil {
 		return xfsgo.NewRPCErrorCause(-1006, err)
 	}
-	err = handler.TxPendingPool.Add(tx)
+	if len(extra) > common.MaxExtraSize {
+		return xfsgo.NewRPCErrorCause(-1006, xfsgo.ErrExtraTooLarge)
+	}
+	var addr common.Address
+	if args.Address != "" {
+		if err = common.AddrCalibrator(args.Address); err != nil {
+			return xfsgo.NewRPCErrorCause(-6001, err)
+		}
+		addr = common.B58ToAddress([]byte(args.Address))
+	} else {
+		addr = handler.Wallet.GetDefault()
+	}
+	privateKey, err := handler.Wallet.GetKeyByAddress(addr)
 	if err != nil {
 		return xfsgo.NewRPCErrorCause(-1006, err)
 	}
-	result := tx.Hash()
+	stdTx.To = addr
+	stdTx.Data = extra
+	stdTx.Value = new(big.Int)
+	if args.GasLimit != "" {
+		stdTx.GasLimit = common.ParseString2BigInt(args.GasLimit)
+	} else {
+		stdTx.GasLimit = new(big.Int).Add(common.CalcTxInitialCost(extra), common.CalcExtraGas(extra))
+	}
+	if args.GasPrice != "" {
+		gaspriceBig, ok := new(big.Int).SetString(args.GasPrice, 10)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		stdTx.GasPrice = common.NanoCoin2Atto(gaspriceBig)
+	} else {
+		stdTx.GasPrice = common.DefaultGasPrice()
+	}
+	if args.Nonce != "" {
+		nonceBig, ok := new(big.Int).SetString(args.Nonce, 10)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		stdTx.Nonce = nonceBig.Uint64()
+	}
+	result, err := handler.sendSigned("Wallet.SetAccountExtra", addr, args.Reservation, stdTx, args.Nonce == "", privateKey)
+	if err != nil {
+		return txError(-1006, err)
+	}
 	*resp = result.Hex()
 	return nil
 }
+
+// sendSigned signs the transaction and adds it to the pool as a spend of the wallet, which
+// checks the funds reserved for other sends. The pending nonce is read inside the spend so
+// concurrent sends from the address do not reuse a nonce. The signature is recorded to the
+// signing log of the wallet with the origin before the transaction leaves the wallet.
+func (handler *WalletHandler) sendSigned(origin string, from common.Address, reservation string,
+	stdTx *xfsgo.StdTransaction, pendingNonce bool, key *ecdsa.PrivateKey) (common.Hash, error) {
+	cost := new(big.Int).Mul(stdTx.GasLimit, stdTx.GasPrice)
+	cost.Add(cost, stdTx.Value)
+	hash, err := handler.Wallet.Spend(from, reservation, cost, func() (common.Hash, error) {
+		if pendingNonce {
+			stdTx.Nonce = handler.TxPendingPool.PendingNonce(from)
+		}
+		tx := xfsgo.NewTransactionByStd(stdTx)
+		if err := tx.SignWithPrivateKey(key); err != nil {
+			return common.Hash{}, err
+		}
+		if err := handler.Wallet.RecordSigning(origin, from, tx.To, tx.Value, tx.Hash()); err != nil {
+			return common.Hash{}, err
+		}
+		if err := handler.TxPendingPool.Add(tx); err != nil {
+			return common.Hash{}, err
+		}
+		if err := handler.Wallet.RecordTransaction(tx); err != nil {
+			logrus.Warnf("Failed to record wallet transaction: hash=%x, err=%s", tx.Hash(), err)
+		}
+		return tx.Hash(), nil
+	})
+	if err == xfsgo.ErrFundsReserved {
+		// the available balance excludes pending and reserved spends of the address
+		err = &xfsgo.InsufficientFundsError{
+			Address:   from,
+			Required:  cost,
+			Available: handler.Wallet.Available(from),
+		}
+	}
+	return hash, err
+}
+
+type GetSigningLogArgs struct {
+	Start string `json:"start"`
+	Limit string `json:"limit"`
+}
+
+type SigningRecordResp struct {
+	Seq    uint64 `json:"seq"`
+	Time   int64  `json:"time"`
+	Origin string `json:"origin"`
+	Signer string `json:"signer"`
+	To     string `json:"to"`
+	Value  string `json:"value"`
+	Hash   string `json:"hash"`
+}
+
+type SigningLogResp struct {
+	Total   uint64               `json:"total"`
+	Records []*SigningRecordResp `json:"records"`
+}
+
+const defaultSigningLogLimit = 100
+
+// GetSigningLog returns a page of the signing log of the wallet, up to limit signing
+// operations starting at the sequence start.
+func (handler *WalletHandler) GetSigningLog(args GetSigningLogArgs, resp **SigningLogResp) error {
+	var start uint64
+	if args.Start != "" {
+		num, err := strconv.ParseUint(args.Start, 10, 64)
+		if err != nil {
+			return xfsgo.NewRPCErrorCause(-1006, err)
+		}
+		start = num
+	}
+	limit := defaultSigningLogLimit
+	if args.Limit != "" {
+		num, err := strconv.Atoi(args.Limit)
+		if err != nil || num <= 0 {
+			return xfsgo.NewRPCError(-1006, "invalid limit")
+		}
+		limit = num
+	}
+	records, err := handler.Wallet.SigningLog(start, limit)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-1006, err)
+	}
+	result := &SigningLogResp{
+		Total:   handler.Wallet.SigningLogLen(),
+		Records: make([]*SigningRecordResp, 0, len(records)),
+	}
+	for _, record := range records {
+		result.Records = append(result.Records, &SigningRecordResp{
+			Seq:    record.Seq,
+			Time:   record.Time,
+			Origin: record.Origin,
+			Signer: record.Signer.B58String(),
+			To:     record.To.B58String(),
+			Value:  record.Value.Text(10),
+			Hash:   record.Hash.Hex(),
+		})
+	}
+	*resp = result
+	return nil
+}
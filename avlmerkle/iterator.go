@@ -0,0 +1,104 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package avlmerkle
+
+import (
+	"bytes"
+	"errors"
+)
+
+var errMissingNode = errors.New("missing tree node")
+
+// Iterator walks the leaves of a tree in key order. The nodes are loaded on demand and
+// dropped once visited, so it holds no more than a path of the tree in memory. The
+// iterator keeps the tree as it was when created, the later changes of the tree are
+// not visited. It must not be used concurrently with the accessors of the tree.
+type Iterator struct {
+	tree  *Tree
+	start []byte
+	stack []*TreeNode
+	key   []byte
+	value []byte
+	err   error
+}
+
+// NewIterator returns an iterator over the keys greater than or equal to start.
+func (t *Tree) NewIterator(start []byte) *Iterator {
+	it := &Iterator{tree: t, start: start}
+	if t.root != nil {
+		it.stack = append(it.stack, t.root)
+	}
+	return it
+}
+
+// Next moves the iterator to the next leaf, it returns false when the iteration is
+// over or failed, Error tells which.
+func (it *Iterator) Next() bool {
+	for it.err == nil && len(it.stack) > 0 {
+		n := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if n.isLeaf() {
+			if it.start != nil && bytes.Compare(n.key, it.start) < 0 {
+				continue
+			}
+			// the leaves after the first visited one are all greater than start
+			it.start = nil
+			it.key, it.value = n.key, n.value
+			return true
+		}
+		left := it.child(n.leftNode, n.left)
+		right := it.child(n.rightNode, n.right)
+		if it.err != nil {
+			break
+		}
+		it.stack = append(it.stack, right)
+		// the key of an inner node is the greatest key of its subtree
+		if it.start == nil || bytes.Compare(it.start, left.key) <= 0 {
+			it.stack = append(it.stack, left)
+		}
+	}
+	it.key, it.value = nil, nil
+	it.stack = nil
+	return false
+}
+
+// child returns the child node held by its parent, or loads it by id without attaching
+// it to the parent.
+func (it *Iterator) child(n *TreeNode, id []byte) *TreeNode {
+	if n != nil || it.err != nil {
+		return n
+	}
+	if n, it.err = it.tree.loadNode(id); it.err == nil && n == nil {
+		it.err = errMissingNode
+	}
+	return n
+}
+
+// Key returns the key of the current leaf.
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value of the current leaf.
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Error returns the error which stopped the iteration.
+func (it *Iterator) Error() error {
+	return it.err
+}
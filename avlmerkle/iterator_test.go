@@ -0,0 +1,77 @@
+package avlmerkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"xfsgo/storage/badger"
+)
+
+func TestTree_NewIterator(t *testing.T) {
+	db, err := badger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tree := NewTree(db, nil)
+	for i := 0; i < 50; i++ {
+		tree.Put([]byte(fmt.Sprintf("key%03d", i*2)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	if err := tree.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// a tree reopened from the db loads the nodes on demand
+	reopened, err := NewTreeN(db, tree.Checksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		start string
+		first int
+	}{
+		{start: "", first: 0},
+		{start: "key010", first: 5},
+		{start: "key011", first: 6},
+		{start: "key098", first: 49},
+		{start: "key099", first: 50},
+	}
+	for _, tr := range []*Tree{tree, reopened} {
+		for _, tt := range tests {
+			var start []byte
+			if tt.start != "" {
+				start = []byte(tt.start)
+			}
+			it := tr.NewIterator(start)
+			i := tt.first
+			for it.Next() {
+				want := fmt.Sprintf("key%03d", i*2)
+				if !bytes.Equal(it.Key(), []byte(want)) {
+					t.Fatalf("start %q: got key %s, want %s", tt.start, it.Key(), want)
+				}
+				if !bytes.Equal(it.Value(), []byte(fmt.Sprintf("value%d", i))) {
+					t.Fatalf("key %s: got value %s", it.Key(), it.Value())
+				}
+				i++
+			}
+			if it.Error() != nil {
+				t.Fatal(it.Error())
+			}
+			if i != 50 {
+				t.Fatalf("start %q: iteration stopped at %d", tt.start, i)
+			}
+		}
+	}
+	// the iterator keeps the tree as it was when created
+	it := tree.NewIterator(nil)
+	tree.Put([]byte("key001"), []byte("new"))
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 50 {
+		t.Fatalf("got %d keys, want 50", count)
+	}
+	if it := NewTree(db, nil).NewIterator(nil); it.Next() || it.Error() != nil {
+		t.Fatal("want empty iteration")
+	}
+}
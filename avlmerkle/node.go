@@ -26,6 +26,8 @@ import (
 	"xfsgo/common/rawencode"
 )
 
+var ErrNonCanonicalNode = errors.New("non-canonical tree node encoding")
+
 type TreeNode struct {
 	leftNode, rightNode *TreeNode
 	left, right         []byte
@@ -58,12 +60,18 @@ func encodeUncertainData(bs []byte, encode *[]byte) error {
 
 func decodeUncertainData(buf *bytes.Buffer, data *[]byte) error {
 	var lenBuf [4]byte
+	if buf.Len() < len(lenBuf) {
+		return ErrNonCanonicalNode
+	}
 	if _, err := buf.Read(lenBuf[:]); err != nil {
 		return err
 	}
 	keyLen := binary.LittleEndian.Uint32(lenBuf[:])
+	if uint64(keyLen) > uint64(buf.Len()) {
+		return ErrNonCanonicalNode
+	}
 	*data = make([]byte, keyLen)
-	if _, err := buf.Read(*data); err != nil {
+	if _, err := buf.Read(*data); err != nil && keyLen > 0 {
 		return err
 	}
 	return nil
@@ -90,8 +98,8 @@ func (n *TreeNode) Encode() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// Decode decodes a node encoded by Encode, truncated data and trailing bytes are rejected.
 func (n *TreeNode) Decode(data []byte) error {
-
 	buf := bytes.NewBuffer(data)
 
 	if b, err := buf.ReadByte(); err == nil {
@@ -103,6 +111,9 @@ func (n *TreeNode) Decode(data []byte) error {
 		return err
 	}
 	if !n.isLeaf() {
+		if buf.Len() < 64 {
+			return ErrNonCanonicalNode
+		}
 		n.left = make([]byte, 32)
 		n.right = make([]byte, 32)
 		if _, err := buf.Read(n.left); err != nil {
@@ -117,6 +128,9 @@ func (n *TreeNode) Decode(data []byte) error {
 			return err
 		}
 	}
+	if buf.Len() > 0 {
+		return ErrNonCanonicalNode
+	}
 	n.rehash()
 	return nil
 }
@@ -179,6 +193,48 @@ func (n *TreeNode) insert(t *Tree, k, v []byte) *TreeNode {
 	}).rebalance(t)
 }
 
+// remove deletes the key from the subtree of the node. It returns the new subtree,
+// which is nil when the node itself was the removed leaf, and whether the key existed.
+func (n *TreeNode) remove(t *Tree, k []byte) (*TreeNode, bool) {
+	if n.isLeaf() {
+		if bytes.Compare(k, n.key) == common.Zero {
+			return nil, true
+		}
+		return n, false
+	}
+
+	leftNode := t.mustLoadLeft(n)
+	rightNode := t.mustLoadRight(n)
+
+	if bytes.Compare(k, leftNode.key) <= common.Zero {
+		newLeft, removed := leftNode.remove(t, k)
+		if !removed {
+			return n, false
+		}
+		// The sibling replaces the node when its only left leaf is removed
+		if newLeft == nil {
+			return rightNode, true
+		}
+		return n.update(func(node *TreeNode) {
+			node.left = newLeft.id
+			node.leftNode = newLeft
+			node.sync(t, newLeft, rightNode)
+		}).rebalance(t), true
+	}
+	newRight, removed := rightNode.remove(t, k)
+	if !removed {
+		return n, false
+	}
+	if newRight == nil {
+		return leftNode, true
+	}
+	return n.update(func(node *TreeNode) {
+		node.right = newRight.id
+		node.rightNode = newRight
+		node.sync(t, leftNode, newRight)
+	}).rebalance(t), true
+}
+
 func (n *TreeNode) lookup(t *Tree, k []byte) ([]byte, bool) {
 	// Judge whether the current node is a leaf node
 	if n.isLeaf() {
@@ -302,6 +358,18 @@ func (n *TreeNode) clone() *TreeNode {
 	return &cloned
 }
 
+// deepClone clones the node with the children held in memory.
+func (n *TreeNode) deepClone() *TreeNode {
+	cloned := n.clone()
+	if n.leftNode != nil {
+		cloned.leftNode = n.leftNode.deepClone()
+	}
+	if n.rightNode != nil {
+		cloned.rightNode = n.rightNode.deepClone()
+	}
+	return cloned
+}
+
 func (n *TreeNode) update(fn func(node *TreeNode)) *TreeNode {
 	cpy := n.clone()
 	fn(cpy)
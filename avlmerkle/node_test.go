@@ -0,0 +1,47 @@
+package avlmerkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTreeNode_DecodeCanonical(t *testing.T) {
+	leaf := newLeafNode([]byte("key"), []byte("value"))
+	enc, err := leaf.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = new(TreeNode).Decode(enc); err != nil {
+		t.Fatal(err)
+	}
+	if err = new(TreeNode).Decode(append(enc, 0x00)); err != ErrNonCanonicalNode {
+		t.Fatalf("want err %v, got %v", ErrNonCanonicalNode, err)
+	}
+	if err = new(TreeNode).Decode(enc[:len(enc)-1]); err == nil {
+		t.Fatal("want error of truncated node")
+	}
+}
+
+// FuzzTreeNode_Decode checks every node accepted by the decoder has a single encoding,
+// the id of a node is the hash of its encoding.
+func FuzzTreeNode_Decode(f *testing.F) {
+	leaf := newLeafNode([]byte("key"), []byte("value"))
+	enc, _ := leaf.Encode()
+	f.Add(enc)
+	inner := &TreeNode{depth: 1, key: []byte("key"), left: leaf.id, right: leaf.id}
+	enc, _ = inner.Encode()
+	f.Add(enc)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		n := new(TreeNode)
+		if err := n.Decode(data); err != nil {
+			return
+		}
+		enc, err := n.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, data) {
+			t.Fatalf("non-canonical encoding accepted: %x, want %x", data, enc)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package avlmerkle
+
+import (
+	"bytes"
+	"errors"
+	"xfsgo/common"
+	"xfsgo/common/rawencode"
+)
+
+var ErrInvalidProof = errors.New("invalid merkle proof")
+
+// Prove returns the proof of the key, the encoded nodes on the lookup path of the key
+// from the root to a leaf. When the path descends to the right child, the left child
+// is included before it, its key shows the key can't be found on the left. The proof
+// shows the key is absent when the leaf has another key.
+func (t *Tree) Prove(k []byte) ([][]byte, error) {
+	proof := make([][]byte, 0)
+	if t.root == nil {
+		return proof, nil
+	}
+	n := t.root
+	for {
+		bs, err := rawencode.Encode(n)
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, bs)
+		if n.isLeaf() {
+			return proof, nil
+		}
+		left, err := t.loadLeft(n)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Compare(k, left.key) <= common.Zero {
+			n = left
+			continue
+		}
+		if bs, err = rawencode.Encode(left); err != nil {
+			return nil, err
+		}
+		proof = append(proof, bs)
+		if n, err = t.loadRight(n); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeProofNode(proof [][]byte, i int, id []byte) (*TreeNode, error) {
+	if i >= len(proof) {
+		return nil, ErrInvalidProof
+	}
+	n := &TreeNode{}
+	if err := rawencode.Decode(proof[i], n); err != nil {
+		return nil, ErrInvalidProof
+	}
+	if !bytes.Equal(n.id, id) {
+		return nil, ErrInvalidProof
+	}
+	return n, nil
+}
+
+// VerifyProof checks the proof of the key made by Prove against the root of a tree.
+// It returns the value of the key, or exists is false if the proof shows the key
+// is not in the tree.
+func VerifyProof(root, k []byte, proof [][]byte) (value []byte, exists bool, err error) {
+	var zero [32]byte
+	if len(root) == 0 || bytes.Equal(root, zero[:]) {
+		if len(proof) != 0 {
+			return nil, false, ErrInvalidProof
+		}
+		return nil, false, nil
+	}
+	n, err := decodeProofNode(proof, 0, root)
+	if err != nil {
+		return nil, false, err
+	}
+	i := 1
+	for !n.isLeaf() {
+		left, err := decodeProofNode(proof, i, n.left)
+		if err != nil {
+			return nil, false, err
+		}
+		i++
+		if bytes.Compare(k, left.key) <= common.Zero {
+			n = left
+			continue
+		}
+		if n, err = decodeProofNode(proof, i, n.right); err != nil {
+			return nil, false, err
+		}
+		i++
+	}
+	if i != len(proof) {
+		return nil, false, ErrInvalidProof
+	}
+	if !bytes.Equal(n.key, k) {
+		return nil, false, nil
+	}
+	return n.value, true, nil
+}
+
+// inRange reports whether the keys of a subtree, which are greater than lo and not
+// greater than hi, may be in the range [start, end]. A nil lo is lower than all the
+// keys, a nil start or end leaves the range open.
+func inRange(lo, hi, start, end []byte) bool {
+	if bytes.Compare(hi, start) < common.Zero {
+		return false
+	}
+	return lo == nil || end == nil || bytes.Compare(lo, end) < common.Zero
+}
+
+// ProveRange returns the proof of all the keys in the range [start, end], a nil start
+// or end leaves the range open. The proof holds the encoded nodes of the subtrees which
+// may have keys in the range, from the root in depth first order, together with the left
+// child of every expanded node as its key splits the keys of the node. The leaves next
+// to the range are included, they show no key is left out at the bounds.
+func (t *Tree) ProveRange(start, end []byte) ([][]byte, error) {
+	proof := make([][]byte, 0)
+	if t.root == nil {
+		return proof, nil
+	}
+	return t.proveRange(proof, t.root, nil, start, end)
+}
+
+func (t *Tree) proveRange(proof [][]byte, n *TreeNode, lo, start, end []byte) ([][]byte, error) {
+	bs, err := rawencode.Encode(n)
+	if err != nil {
+		return nil, err
+	}
+	proof = append(proof, bs)
+	if n.isLeaf() {
+		return proof, nil
+	}
+	left, err := t.loadLeft(n)
+	if err != nil {
+		return nil, err
+	}
+	if inRange(lo, left.key, start, end) {
+		if proof, err = t.proveRange(proof, left, lo, start, end); err != nil {
+			return nil, err
+		}
+	} else {
+		if bs, err = rawencode.Encode(left); err != nil {
+			return nil, err
+		}
+		proof = append(proof, bs)
+	}
+	if !inRange(left.key, n.key, start, end) {
+		return proof, nil
+	}
+	right, err := t.loadRight(n)
+	if err != nil {
+		return nil, err
+	}
+	return t.proveRange(proof, right, left.key, start, end)
+}
+
+// VerifyRangeProof checks the proof of the range [start, end] made by ProveRange against
+// the root of a tree. It returns the keys in the range in key order with their values,
+// the proof shows the tree has no other key in the range. More reports whether the tree
+// has keys greater than end.
+func VerifyRangeProof(root, start, end []byte, proof [][]byte) (keys, values [][]byte, more bool, err error) {
+	var zero [32]byte
+	if len(root) == 0 || bytes.Equal(root, zero[:]) {
+		if len(proof) != 0 {
+			return nil, nil, false, ErrInvalidProof
+		}
+		return nil, nil, false, nil
+	}
+	v := &rangeVerifier{proof: proof, start: start, end: end}
+	top, err := v.verify(root, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if v.i != len(proof) {
+		return nil, nil, false, ErrInvalidProof
+	}
+	more = end != nil && bytes.Compare(top.key, end) > common.Zero
+	return v.keys, v.values, more, nil
+}
+
+type rangeVerifier struct {
+	proof      [][]byte
+	i          int
+	start, end []byte
+	keys       [][]byte
+	values     [][]byte
+}
+
+// verify decodes the node of the id from the proof and descends into the children which
+// may have keys in the range, as ProveRange did.
+func (v *rangeVerifier) verify(id, lo []byte) (*TreeNode, error) {
+	n, err := decodeProofNode(v.proof, v.i, id)
+	if err != nil {
+		return nil, err
+	}
+	v.i++
+	if n.isLeaf() {
+		if bytes.Compare(n.key, v.start) >= common.Zero &&
+			(v.end == nil || bytes.Compare(n.key, v.end) <= common.Zero) {
+			v.keys = append(v.keys, n.key)
+			v.values = append(v.values, n.value)
+		}
+		return n, nil
+	}
+	var left *TreeNode
+	if left, err = decodeProofNode(v.proof, v.i, n.left); err != nil {
+		return nil, err
+	}
+	if inRange(lo, left.key, v.start, v.end) {
+		if _, err = v.verify(n.left, lo); err != nil {
+			return nil, err
+		}
+	} else {
+		v.i++
+	}
+	if !inRange(left.key, n.key, v.start, v.end) {
+		return n, nil
+	}
+	if _, err = v.verify(n.right, left.key); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
@@ -0,0 +1,93 @@
+package avlmerkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"xfsgo/test"
+)
+
+func newTestRangeTree(n int) *Tree {
+	tree := NewTree(test.NewMemStorage(), nil)
+	for i := 0; i < n; i++ {
+		tree.Put([]byte(fmt.Sprintf("key%03d", i*2)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	return tree
+}
+
+func TestTree_ProveRange(t *testing.T) {
+	tree := newTestRangeTree(50)
+	root := tree.Checksum()
+	tests := []struct {
+		start, end string
+		count      int
+		more       bool
+	}{
+		{start: "key010", end: "key020", count: 6, more: true},
+		{start: "key011", end: "key019", count: 4, more: true},
+		{start: "key011", end: "key011", count: 0, more: true},
+		{start: "", end: "key004", count: 3, more: true},
+		{start: "key090", end: "", count: 5},
+		{start: "key090", end: "key200", count: 5},
+		{start: "", end: "", count: 50},
+	}
+	for _, tt := range tests {
+		var start, end []byte
+		if tt.start != "" {
+			start = []byte(tt.start)
+		}
+		if tt.end != "" {
+			end = []byte(tt.end)
+		}
+		proof, err := tree.ProveRange(start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, values, more, err := VerifyRangeProof(root, start, end, proof)
+		if err != nil {
+			t.Fatalf("range [%s, %s]: %v", tt.start, tt.end, err)
+		}
+		if len(keys) != tt.count || more != tt.more {
+			t.Fatalf("range [%s, %s]: got %d keys, more %v, want %d keys, more %v",
+				tt.start, tt.end, len(keys), more, tt.count, tt.more)
+		}
+		for i, key := range keys {
+			want, _ := tree.Get(key)
+			if !bytes.Equal(values[i], want) {
+				t.Fatalf("key %s: got value %s, want %s", key, values[i], want)
+			}
+			if i > 0 && bytes.Compare(keys[i-1], key) >= 0 {
+				t.Fatalf("keys not in order")
+			}
+		}
+	}
+}
+
+func TestVerifyRangeProof_invalid(t *testing.T) {
+	tree := newTestRangeTree(50)
+	root := tree.Checksum()
+	start, end := []byte("key010"), []byte("key020")
+	proof, err := tree.ProveRange(start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every node of the proof is needed, a dropped leaf would hide a key
+	for i := range proof {
+		cut := append(append([][]byte{}, proof[:i]...), proof[i+1:]...)
+		if _, _, _, err = VerifyRangeProof(root, start, end, cut); err != ErrInvalidProof {
+			t.Fatalf("proof without node %d: want err %v, got %v", i, ErrInvalidProof, err)
+		}
+	}
+	if _, _, _, err = VerifyRangeProof(root, start, end, append(proof, proof[0])); err != ErrInvalidProof {
+		t.Fatalf("want err %v, got %v", ErrInvalidProof, err)
+	}
+	// the proof of a narrower range lacks the nodes of the wider one
+	narrow, _ := tree.ProveRange(start, []byte("key012"))
+	if _, _, _, err = VerifyRangeProof(root, start, end, narrow); err != ErrInvalidProof {
+		t.Fatalf("want err %v, got %v", ErrInvalidProof, err)
+	}
+	other := newTestRangeTree(51)
+	if _, _, _, err = VerifyRangeProof(other.Checksum(), start, end, proof); err != ErrInvalidProof {
+		t.Fatalf("want err %v, got %v", ErrInvalidProof, err)
+	}
+}
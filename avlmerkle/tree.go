@@ -35,6 +35,16 @@ type Tree struct {
 	cache *lru.Cache
 }
 
+// cacheSize is the number of nodes cached by a tree.
+var cacheSize = 2048
+
+// SetCacheSize sets the number of nodes cached by the trees created afterwards.
+func SetCacheSize(size int) {
+	if size > 0 {
+		cacheSize = size
+	}
+}
+
 // NewTree creates a trie with an existing db and a root node.
 // If the root exists and its format is correct, you need load the root node from the db
 // and store the datas in a cache.
@@ -43,7 +53,7 @@ func NewTree(db badger.IStorage, root []byte) *Tree {
 		db: newTreeDb(db),
 	}
 
-	t.cache = lru.NewCache(2048)
+	t.cache = lru.NewCache(cacheSize)
 	var zero [32]byte
 	if root != nil && len(root) == 32 && bytes.Compare(root, zero[:]) > common.Zero {
 		t.root = t.mustLoadNode(root)
@@ -57,7 +67,7 @@ func NewTreeN(db badger.IStorage, root []byte) (*Tree, error) {
 		db: newTreeDb(db),
 	}
 
-	t.cache = lru.NewCache(2048)
+	t.cache = lru.NewCache(cacheSize)
 	var zero [32]byte
 	if root != nil && len(root) == 32 && bytes.Compare(root, zero[:]) > common.Zero {
 		t.root, err = t.loadNode(root)
@@ -77,8 +87,26 @@ func (t *Tree) Put(k, v []byte) {
 	t.root = t.root.insert(t, k, v)
 }
 
+// Remove deletes the key from the tree, it reports whether the key existed.
+func (t *Tree) Remove(k []byte) bool {
+	if t.root == nil {
+		return false
+	}
+	root, removed := t.root.remove(t, k)
+	if removed {
+		t.root = root
+	}
+	return removed
+}
+
+// Copy returns a copy of the tree. The nodes held in memory are cloned, as the children
+// loaded lazily are set on their parents, so the trees can be used concurrently.
 func (t *Tree) Copy() *Tree {
-	return &Tree{db: t.db, root: t.root, cache: t.cache}
+	cpy := &Tree{db: t.db, cache: t.cache}
+	if t.root != nil {
+		cpy.root = t.root.deepClone()
+	}
+	return cpy
 }
 
 func (t *Tree) Checksum() []byte {
@@ -165,7 +193,7 @@ func (t *Tree) loadNode(id []byte) (*TreeNode, error) {
 		}
 		return tn, nil
 	}
-	tn, err := t.db.getTreeNodeByKey(append([]byte("tree:"), id...))
+	tn, err := t.db.getTreeNodeByKey(nodeKey(id))
 	if err != nil {
 		return nil, err
 	}
@@ -206,6 +234,68 @@ func (t *Tree) foreach(n *TreeNode, fn func(key []byte, value []byte)) {
 	t.foreach(t.mustLoadRight(n), fn)
 }
 
+// Iterate calls fn for every key greater than or equal to start in key order, the
+// iteration stops as soon as fn returns false.
+func (t *Tree) Iterate(start []byte, fn func(key []byte, value []byte) bool) {
+	if t.root == nil {
+		return
+	}
+	t.iterate(t.root, start, fn)
+}
+
+func (t *Tree) iterate(n *TreeNode, start []byte, fn func(key []byte, value []byte) bool) bool {
+	if n.isLeaf() {
+		if bytes.Compare(n.key, start) < common.Zero {
+			return true
+		}
+		return fn(n.key, n.value)
+	}
+	// The key of an inner node is the greatest key of its subtree, the left
+	// subtree can be skipped when all its keys are lower than start.
+	left := t.mustLoadLeft(n)
+	if bytes.Compare(start, left.key) <= common.Zero {
+		if !t.iterate(left, start, fn) {
+			return false
+		}
+	}
+	return t.iterate(t.mustLoadRight(n), start, fn)
+}
+
+// WalkNodes calls fn with the id of every stored node of the tree and the value of the
+// leaves, the value of an inner node is nil. The children of a node are skipped when fn
+// returns false for it. The loaded nodes are not kept by the tree.
+func (t *Tree) WalkNodes(fn func(id, value []byte) bool) error {
+	if t.root == nil {
+		return nil
+	}
+	return t.walkNodes(t.root, fn)
+}
+
+func (t *Tree) walkNodes(n *TreeNode, fn func(id, value []byte) bool) error {
+	if n.isLeaf() {
+		fn(n.id, n.value)
+		return nil
+	}
+	if !fn(n.id, nil) {
+		return nil
+	}
+	if err := t.walkChild(n.leftNode, n.left, fn); err != nil {
+		return err
+	}
+	return t.walkChild(n.rightNode, n.right, fn)
+}
+
+// walkChild walks the child node, it is loaded by id unless it is held by its parent.
+func (t *Tree) walkChild(child *TreeNode, id []byte, fn func(id, value []byte) bool) error {
+	if child == nil {
+		var err error
+		if child, err = t.loadNode(id); err != nil {
+			return err
+		}
+	}
+	return t.walkNodes(child, fn)
+}
+
 func (t *Tree) Commit() error {
 	if t.root == nil {
 		return nil
@@ -215,13 +305,12 @@ func (t *Tree) Commit() error {
 	err := t.root.dfsCall(t, func(node *TreeNode) error {
 		root := t.Checksum()
 		_ = root
-		key := append([]byte("tree:"), node.id...)
+		key := nodeKey(node.id)
 
 		bs, err := rawencode.Encode(node)
 		if err != nil {
 			return err
 		}
-		// return batch.Put(append([]byte("tree:"), node.id...), bs)
 		if len(root) == 0 || len(key) == 0 || len(bs) == 0 {
 			return errors.New("root or key or bs not null")
 		}
@@ -22,6 +22,16 @@ import (
 	"xfsgo/storage/badger"
 )
 
+// NodeKeyPrefix is the key prefix of the tree nodes, which are stored once per node id.
+var NodeKeyPrefix = []byte("tree:")
+
+func nodeKey(id []byte) []byte {
+	return append(append([]byte{}, NodeKeyPrefix...), id...)
+}
+
+// pruneBatchSize is the number of nodes deleted by a write batch of PruneNodes.
+const pruneBatchSize = 1024
+
 //treeDb stores the tree to the db.
 type treeDb struct {
 	storage   badger.IStorage
@@ -44,6 +54,45 @@ func (db *treeDb) commitBatch(batch *badger.StorageWriteBatch) error {
 	return db.storage.CommitWriteBatch(batch)
 }
 
+// HasNode reports whether the node with the id is stored in the db.
+func HasNode(db badger.IStorage, id []byte) bool {
+	val, err := db.GetData(nodeKey(id))
+	return err == nil && len(val) > 0
+}
+
+// PruneNodes deletes the nodes of the db whose id keep returns false for, it returns the
+// number of deleted nodes. The nodes written while the db is pruned may be deleted, so
+// no tree must be committed to the db meanwhile.
+func PruneNodes(db badger.IStorage, keep func(id []byte) bool) (int, error) {
+	keys := make([][]byte, 0)
+	err := db.PrefixForeachData(NodeKeyPrefix, func(k []byte, _ []byte) error {
+		if !keep(k[len(NodeKeyPrefix):]) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for start := 0; start < len(keys); start += pruneBatchSize {
+		end := start + pruneBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := db.NewWriteBatch()
+		for _, key := range keys[start:end] {
+			if err = batch.Delete(key); err != nil {
+				batch.Destroy()
+				return start, err
+			}
+		}
+		if err = db.CommitWriteBatch(batch); err != nil {
+			return start, err
+		}
+	}
+	return len(keys), nil
+}
+
 func (db *treeDb) getTreeNodeByKey(key []byte) (*TreeNode, error) {
 	val, err := db.storage.GetData(key)
 	if err != nil {
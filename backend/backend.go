@@ -21,11 +21,14 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"time"
 	"xfsgo"
+	"xfsgo/avlmerkle"
 	"xfsgo/common"
 	"xfsgo/miner"
 	"xfsgo/node"
 	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
 	"xfsgo/storage/badger"
 
 	"github.com/sirupsen/logrus"
@@ -35,6 +38,14 @@ var (
 	ErrInitialGenesis    = errors.New("initial genesis block fail")
 	ErrMainNetDisabled   = errors.New("main net disabled")
 	ErrWriteGenesisBlock = errors.New("write genesis block err")
+	ErrFaucetMainNet     = errors.New("faucet not allowed on main net")
+)
+
+const (
+	lowMemTreeCacheSize = 256
+	lowMemHashesFetch   = uint64(128)
+	lowMemBlocksFetch   = uint64(32)
+	lowMemNumWorkers    = uint32(1)
 )
 
 // Backend represents the backend server of the xfs and implements the xfs full node service.
@@ -47,6 +58,10 @@ type Backend struct {
 	eventBus   *xfsgo.EventBus
 	txPool     *xfsgo.TxPool
 	syncMgr    *syncMgr
+	cluster    *xfsgo.Cluster
+	reorgAlarm *xfsgo.ReorgMonitor
+	shadow     *xfsgo.ShadowExecutor
+	pruner     *xfsgo.StatePruner
 }
 
 type Params struct {
@@ -57,6 +72,38 @@ type Params struct {
 	ProtocolVersion uint32
 	Debug           bool
 	MinGasPrice     *big.Int
+	// GasLimit is the gas limit target voted by the miner
+	GasLimit *big.Int
+	// ExtraData is the extra data put into the headers of mined blocks
+	ExtraData string
+	// Recommit is the minimum interval between the refreshes of the block templates
+	// of the miner when better paying transactions arrive
+	Recommit time.Duration
+	// TxOrder is the order the miner selects the pending transactions in
+	TxOrder string
+	// LowMem shrinks the state caches and sync batches and limits the miner
+	// to a single worker for devices with little memory
+	LowMem bool
+	// Faucet enables the faucet service on dev and test networks
+	Faucet *xfsgo.FaucetConfig
+	// Cluster enables the status of the sibling nodes serving the same clients
+	Cluster *xfsgo.ClusterConfig
+	// ServeLimits overrides the limits of the chain data served to the peers
+	ServeLimits *ServeLimits
+	// Witnesses is the number of state witnesses of the last accepted blocks kept
+	// for debugging, no witness is recorded if it is 0
+	Witnesses int
+	// AuditSecret is the secret the signing log of the wallet is encrypted with
+	AuditSecret string
+	// KeyBackup enables the encrypted backup of the keys created or imported
+	KeyBackup *xfsgo.KeyBackupConfig
+	// ReorgAlarm enables the alarm raised on reorgs deeper than its depth
+	ReorgAlarm *xfsgo.ReorgAlarmConfig
+	// Shadow is the name of the state transition every new block is executed with a
+	// second time to report its divergences, no block is shadowed if it is empty
+	Shadow string
+	// StatePrune enables the pruning of the states of the old blocks
+	StatePrune *xfsgo.StatePruneConfig
 }
 
 // Config contains the configuration options of the Backend.
@@ -67,14 +114,53 @@ type Config struct {
 	StateDB *badger.Storage
 	ExtraDB *badger.Storage
 }
-type chainSyncProtocol struct {
+
+// SyncProtocol is the protocol synchronising blocks and transactions with the peers.
+type SyncProtocol struct {
 	syncMgr *syncMgr
 }
 
-func (c *chainSyncProtocol) Run(p p2p.Peer) error {
+// NewSyncProtocol creates the sync protocol of a blockchain. The backend binds it to the
+// p2p server, it can also be run on peers of other transports.
+func NewSyncProtocol(version, network uint32, chain *xfsgo.BlockChain,
+	eventBus *xfsgo.EventBus, txPool *xfsgo.TxPool) *SyncProtocol {
+	return &SyncProtocol{
+		syncMgr: newSyncMgr(version, network, chain, eventBus, txPool),
+	}
+}
+
+// Run runs the protocol on the peer until the peer is closed.
+func (c *SyncProtocol) Run(p p2p.Peer) error {
 	return c.syncMgr.onNewPeer(p)
 }
 
+// SetServeLimits sets the limits of the chain data served to the peers.
+func (c *SyncProtocol) SetServeLimits(limits ServeLimits) {
+	c.syncMgr.serving.setLimits(limits)
+}
+
+// Start starts broadcasting and synchronising with the peers.
+func (c *SyncProtocol) Start() {
+	c.syncMgr.Start()
+}
+
+// HasPeer reports whether the peer with the given id has completed the handshake.
+func (c *SyncProtocol) HasPeer(id discover.NodeId) bool {
+	return c.syncMgr.peers.get(id) != nil
+}
+
+// setLowMemProfile applies the low memory profile before the chain and sync are set up.
+func setLowMemProfile(params *Params) {
+	avlmerkle.SetCacheSize(lowMemTreeCacheSize)
+	maxHashesFetch = lowMemHashesFetch
+	maxBlocksFetch = lowMemBlocksFetch
+	queueBlockSize = maxHashesFetch * 8
+	blockCacheLimit = maxBlocksFetch * 8
+	if params.Numworkers > lowMemNumWorkers {
+		params.Numworkers = lowMemNumWorkers
+	}
+}
+
 // NewBackend constructs and returns a Backend instance by a note in network and config.
 // This method is for daemon whick should be started firstly when xfs blockchain runs.
 //
@@ -84,6 +170,9 @@ func NewBackend(stack *node.Node, config *Config) (*Backend, error) {
 		config:    config,
 		p2pServer: stack.P2PServer(),
 	}
+	if config.LowMem {
+		setLowMemProfile(config.Params)
+	}
 	back.eventBus = xfsgo.NewEventBus()
 	if config.NetworkID == uint32(1) {
 		if xfsgo.VersionMajor() != 1 {
@@ -117,11 +206,24 @@ func NewBackend(stack *node.Node, config *Config) (*Backend, error) {
 		config.Debug); err != nil {
 		return nil, err
 	}
+	if config.Witnesses > 0 {
+		back.blockchain.SetWitnessRecording(config.Witnesses)
+	}
 	back.wallet = xfsgo.NewWallet(back.config.KeysDB)
+	if config.AuditSecret != "" {
+		back.wallet.SetAuditSecret([]byte(config.AuditSecret))
+	}
+	if config.KeyBackup != nil {
+		if err = back.wallet.SetKeyBackup(config.KeyBackup); err != nil {
+			return nil, err
+		}
+	}
 	back.txPool = xfsgo.NewTxPool(
 		back.blockchain.CurrentStateTree,
 		back.blockchain.LatestGasLimit,
-		back.config.MinGasPrice, back.eventBus)
+		back.config.MinGasPrice, back.blockchain.ChainConfig(), back.eventBus)
+	back.wallet.EnableReservations(back.spendableBalance, back.eventBus)
+	back.wallet.TrackTransactions(back.eventBus)
 	coinbase := config.Coinbase
 	addrdef := back.wallet.GetDefault()
 	if !coinbase.Equals(common.Address{}) || addrdef.Equals(common.Address{}) {
@@ -133,41 +235,129 @@ func NewBackend(stack *node.Node, config *Config) (*Backend, error) {
 			return nil, err
 		}
 	}
+	extraData := []byte(config.ExtraData)
+	if err = xfsgo.VerifyExtraData(extraData); err != nil {
+		return nil, err
+	}
+	if err = xfsgo.VerifyTxOrder(config.TxOrder); err != nil {
+		return nil, err
+	}
 	//constructs Miner instance.
 	minerconfig := &miner.Config{
 		Coinbase:   back.wallet.GetDefault(),
 		Numworkers: config.Numworkers,
+		ExtraData:  extraData,
+		Schedule:   back.blockchain.Schedule(),
+		Recommit:   config.Recommit,
+		TxOrder:    config.TxOrder,
+	}
+	gasLimit := config.GasLimit
+	if gasLimit == nil {
+		gasLimit = common.TxPoolGasLimit
 	}
 	back.miner = miner.NewMiner(minerconfig,
 		back.config.StateDB, back.blockchain,
 		back.eventBus, back.txPool,
-		config.MinGasPrice, common.TxPoolGasLimit)
+		config.MinGasPrice, gasLimit)
 
 	logrus.Debugf("Initial miner: coinbase=%s, gasPrice=%s, gasLimit=%s",
-		minerconfig.Coinbase.B58String(), config.MinGasPrice, common.TxPoolGasLimit)
+		minerconfig.Coinbase.B58String(), config.MinGasPrice, gasLimit)
 	//Node resgisters apis of baclend on the node  for RPC service.
 	if err = stack.RegisterBackend(
 		back.config.StateDB,
 		back.blockchain,
 		back.miner,
 		back.wallet,
-		back.txPool); err != nil {
+		back.txPool,
+		back.eventBus); err != nil {
 		return nil, err
 	}
-	back.syncMgr = newSyncMgr(
+	if config.Faucet != nil {
+		if err = back.enableFaucet(stack, config.Faucet); err != nil {
+			return nil, err
+		}
+	}
+	if config.Cluster != nil {
+		back.cluster = xfsgo.NewCluster(*config.Cluster, func() bool {
+			return back.blockchain.Syncing() != nil
+		})
+		if err = stack.EnableCluster(back.cluster, back.blockchain); err != nil {
+			return nil, err
+		}
+	}
+	if config.ReorgAlarm != nil {
+		back.reorgAlarm = xfsgo.NewReorgMonitor(*config.ReorgAlarm, back.eventBus, back.wallet.Owns)
+		if err = stack.EnableReorgAlarm(back.reorgAlarm); err != nil {
+			return nil, err
+		}
+	}
+	if config.Shadow != "" {
+		if back.shadow, err = xfsgo.NewShadowExecutor(back.blockchain, config.Shadow); err != nil {
+			return nil, err
+		}
+		if err = stack.EnableShadow(back.shadow); err != nil {
+			return nil, err
+		}
+	}
+	if config.StatePrune != nil {
+		back.pruner = xfsgo.NewStatePruner(back.blockchain, *config.StatePrune)
+	}
+	protocol := NewSyncProtocol(
 		back.config.ProtocolVersion, back.config.NetworkID,
 		back.blockchain, back.eventBus, back.txPool)
-	back.p2pServer.Bind(&chainSyncProtocol{
-		syncMgr: back.syncMgr,
-	})
+	if config.ServeLimits != nil {
+		protocol.SetServeLimits(*config.ServeLimits)
+	}
+	back.syncMgr = protocol.syncMgr
+	stack.SetPeerPropagation(back.syncMgr.PeerPropagation)
+	back.p2pServer.Bind(protocol)
 	return back, nil
 }
 
+// enableFaucet registers the faucet service of the node, the account of the faucet
+// defaults to the default address of the wallet.
+func (b *Backend) enableFaucet(stack *node.Node, config *xfsgo.FaucetConfig) error {
+	if b.config.NetworkID == uint32(1) {
+		return ErrFaucetMainNet
+	}
+	if config.Account.Equals(common.Address{}) {
+		config.Account = b.wallet.GetDefault()
+	}
+	if _, err := b.wallet.GetKeyByAddress(config.Account); err != nil {
+		return err
+	}
+	logrus.Infof("Enable faucet: account=%s, amount=%s", config.Account.B58String(), config.Amount)
+	return stack.EnableFaucet(xfsgo.NewFaucet(*config), b.blockchain, b.wallet, b.txPool)
+}
+
 func (b *Backend) Start() error {
 	b.syncMgr.Start()
+	if b.cluster != nil {
+		b.cluster.Start()
+	}
+	if b.reorgAlarm != nil {
+		b.reorgAlarm.Start()
+	}
+	if b.shadow != nil {
+		b.shadow.Start()
+	}
+	if b.pruner != nil {
+		b.pruner.Start()
+	}
 	return nil
 }
 
+// spendableBalance returns the balance of the address which is not spent by the
+// transactions of the pool.
+func (b *Backend) spendableBalance(addr common.Address) *big.Int {
+	balance := new(big.Int).Set(b.blockchain.CurrentStateTree().GetBalance(addr))
+	balance.Sub(balance, b.txPool.PendingCost(addr))
+	if balance.Sign() < 0 {
+		balance.SetInt64(0)
+	}
+	return balance
+}
+
 func (b *Backend) BlockChain() *xfsgo.BlockChain {
 	return b.blockchain
 }
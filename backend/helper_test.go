@@ -350,6 +350,11 @@ func (t *testChainMgr) writeBlock(block *xfsgo.Block) error {
 func (t *testChainMgr) SetBoundaries(syncStatsOrigin, syncStatsHeight uint64) error {
 	return nil
 }
+func (t *testChainMgr) SetSyncing(syncing bool) {}
+
+func (t *testChainMgr) ForkFilter() *xfsgo.ForkFilter {
+	return xfsgo.NewForkFilter(t.GenesisBHeader().HeaderHash(), xfsgo.MainNetChainConfig)
+}
 
 func newTestChainMgr(genesis *xfsgo.Block, coinbase common.Address) *testChainMgr {
 	mgr := &testChainMgr{
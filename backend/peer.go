@@ -25,6 +25,7 @@ import (
 	"time"
 	"xfsgo"
 	"xfsgo/common"
+	"xfsgo/common/rawencode"
 	"xfsgo/p2p"
 	"xfsgo/p2p/discover"
 )
@@ -70,6 +71,8 @@ type peer struct {
 	knownBlocks     map[common.Hash]struct{}
 	knownTxsLock    sync.RWMutex
 	knownTxs        map[common.Hash]struct{}
+	// forks checks the fork id of the peer in the handshake when it is set
+	forks *xfsgo.ForkFilter
 }
 
 const (
@@ -178,6 +181,8 @@ type statusData struct {
 	Head    common.Hash `json:"head"`
 	Height  uint64      `json:"height"`
 	Genesis common.Hash `json:"genesis"`
+	// ForkID is left out by peers of earlier versions
+	ForkID *xfsgo.ForkID `json:"fork_id,omitempty"`
 }
 
 type getBlockHashesFromNumberData struct {
@@ -191,7 +196,10 @@ type AllSyncData struct {
 	Height uint64      `json:"height"`
 }
 
+// RemoteBlockHeader is the header of a block sent to peers, the hash comes first so that
+// fields of later header versions stay trailing when the header is decoded.
 type RemoteBlockHeader struct {
+	Hash          common.Hash    `json:"hash"`
 	Height        uint64         `json:"height"`
 	Version       uint32         `json:"version"`
 	HashPrevBlock common.Hash    `json:"hash_prev_block"`
@@ -204,14 +212,43 @@ type RemoteBlockHeader struct {
 	GasLimit         *big.Int    `json:"gas_limit"`
 	GasUsed          *big.Int    `json:"gas_used"`
 	// pow consensus.
-	Bits       uint32      `json:"bits"`
-	Nonce      uint32      `json:"nonce"`
-	ExtraNonce uint64      `json:"extranonce"`
-	Hash       common.Hash `json:"hash"`
+	Bits        uint32              `json:"bits"`
+	Nonce       uint32              `json:"nonce"`
+	ExtraNonce  uint64              `json:"extranonce"`
+	ExtraData   []byte              `json:"extra_data,omitempty"`
+	RewardSplit []xfsgo.RewardShare `json:"reward_split,omitempty"`
+	// fields of later header versions relayed unchanged
+	trailing []rawencode.Field
 }
+
+type remoteBlockHeaderJSON RemoteBlockHeader
+
+func (h *RemoteBlockHeader) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*remoteBlockHeaderJSON)(h))
+	if err != nil {
+		return nil, err
+	}
+	return rawencode.AppendFields(data, h.trailing)
+}
+
+func (h *RemoteBlockHeader) UnmarshalJSON(data []byte) error {
+	header := new(remoteBlockHeaderJSON)
+	if err := json.Unmarshal(data, header); err != nil {
+		return err
+	}
+	trailing, _, err := rawencode.SplitFields(data, header)
+	if err != nil {
+		return err
+	}
+	*h = RemoteBlockHeader(*header)
+	h.trailing = trailing
+	return nil
+}
+
 type RemoteBlockTx struct {
-	Version   uint32         `json:"version"`
+	Hash      common.Hash    `json:"hash"`
 	From      common.Address `json:"from"`
+	Version   uint32         `json:"version"`
 	To        common.Address `json:"to"`
 	GasPrice  *big.Int       `json:"gas_price"`
 	GasLimit  *big.Int       `json:"gas_limit"`
@@ -219,7 +256,32 @@ type RemoteBlockTx struct {
 	Nonce     uint64         `json:"nonce"`
 	Value     *big.Int       `json:"value"`
 	Signature []byte         `json:"signature"`
-	Hash      common.Hash    `json:"hash"`
+	// fields of later transaction versions relayed unchanged
+	trailing []rawencode.Field
+}
+
+type remoteBlockTxJSON RemoteBlockTx
+
+func (tx *RemoteBlockTx) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*remoteBlockTxJSON)(tx))
+	if err != nil {
+		return nil, err
+	}
+	return rawencode.AppendFields(data, tx.trailing)
+}
+
+func (tx *RemoteBlockTx) UnmarshalJSON(data []byte) error {
+	rtx := new(remoteBlockTxJSON)
+	if err := json.Unmarshal(data, rtx); err != nil {
+		return err
+	}
+	trailing, _, err := rawencode.SplitFields(data, rtx)
+	if err != nil {
+		return err
+	}
+	*tx = RemoteBlockTx(*rtx)
+	tx.trailing = trailing
+	return nil
 }
 
 type RemoteTxs []*RemoteBlockTx
@@ -292,14 +354,19 @@ func coverBlock2RemoteBlock(block *xfsgo.Block) (re *RemoteBlock) {
 // to verifies whether the peer matchs the prptocol that attempts to add the connection as a peer.
 func (p *peer) Handshake(head common.Hash, height uint64, genesis common.Hash) error {
 
+	status := &statusData{
+		Version: p.version,
+		Network: p.network,
+		Head:    head,
+		Height:  height,
+		Genesis: genesis,
+	}
+	if p.forks != nil {
+		forkID := p.forks.ID(height)
+		status.ForkID = &forkID
+	}
 	go func() {
-		if err := p2p.SendMsgData(p.p2pPeer, MsgCodeVersion, &statusData{
-			Version: p.version,
-			Network: p.network,
-			Head:    head,
-			Height:  height,
-			Genesis: genesis,
-		}); err != nil {
+		if err := p2p.SendMsgData(p.p2pPeer, MsgCodeVersion, status); err != nil {
 			return
 		}
 	}()
@@ -334,6 +401,14 @@ func (p *peer) Handshake(head common.Hash, height uint64, genesis common.Hash) e
 						p.network, status.Network, p.P2PPeer().RemoteNode().ID)
 					return errHandshakeFailed
 				}
+				if p.forks != nil && status.ForkID != nil {
+					if err := p.forks.Check(*status.ForkID, height); err != nil {
+						local := p.forks.ID(height)
+						logrus.Infof("Sync peer handshake failed: %s, localForkId=%x, localNext=%d, remoteForkId=%x, remoteNext=%d, from=%s",
+							err, local.Hash[:4], local.Next, status.ForkID.Hash[:4], status.ForkID.Next, p.P2PPeer().RemoteNode().ID)
+						return err
+					}
+				}
 				p.head = status.Head
 				p.height = status.Height
 				pid := p.P2PPeer().RemoteNode().ID
@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"net"
 	"testing"
+	"xfsgo"
 	"xfsgo/common"
 	"xfsgo/p2p/discover"
 	"xfsgo/test"
@@ -79,3 +80,35 @@ func TestPeer_Handshake(t *testing.T) {
 //func Test_a(t *testing.T) {
 //	t.Fatal("abc")
 //}
+
+func TestPeer_HandshakeForkID(t *testing.T) {
+	selfNodeId := genRandomTestNode()
+	remoteNodeId := genRandomTestNode()
+	remoteNode := discover.NewNode(net.IPv4(0xff, 0xff, 0xff, 0xff), uint16(1611), uint16(1611), remoteNodeId.nodeId)
+	genesis := common.Hash{0x01}
+	remote := *testStatusData[0]
+	remote.Genesis = genesis
+	handshakeFn := func(mType uint8, data []byte) (uint8, []byte, error) {
+		repbuf, err := json.Marshal(&remote)
+		return MsgCodeVersion, repbuf, err
+	}
+	np := test.NewBufferPeer(selfNodeId.nodeId, remoteNode, handshakeFn)
+	handshake := func() error {
+		p := newPeer(np, remote.Version, remote.Network)
+		p.forks = xfsgo.NewForkFilter(genesis, xfsgo.MainNetChainConfig)
+		return p.Handshake(common.Hash{}, 0, genesis)
+	}
+	// peers of earlier versions send no fork id
+	if err := handshake(); err != nil {
+		t.Fatal(err)
+	}
+	forkID := xfsgo.NewForkFilter(genesis, xfsgo.MainNetChainConfig).ID(0)
+	remote.ForkID = &forkID
+	if err := handshake(); err != nil {
+		t.Fatal(err)
+	}
+	remote.ForkID = &xfsgo.ForkID{Hash: common.Hash{0x02}}
+	if err := handshake(); err != xfsgo.ErrForkIDIncompatible {
+		t.Fatalf("want ErrForkIDIncompatible, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package backend
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/p2p/discover"
+)
+
+const (
+	// maxTrackedBlocks is the number of the last announced blocks whose first
+	// announcement is remembered
+	maxTrackedBlocks = 256
+	// propagationWeight is the weight of the last delay in the average delay of a peer
+	propagationWeight = 0.2
+)
+
+type peerPropagation struct {
+	announced uint64
+	first     uint64
+	avgDelay  time.Duration
+}
+
+// better reports whether the peer announces new blocks sooner than the other one, the
+// peers which announced no block rank last.
+func (p *peerPropagation) better(o *peerPropagation) bool {
+	if p.announced == 0 || o.announced == 0 {
+		return p.announced > o.announced
+	}
+	// compare the ratios of first announcements p.first/p.announced and o.first/o.announced
+	pr, or := p.first*o.announced, o.first*p.announced
+	if pr != or {
+		return pr > or
+	}
+	return p.avgDelay < o.avgDelay
+}
+
+// propagationTracker measures the delay of the block announcements of every peer after
+// the first announcement of the block and ranks the peers by it.
+type propagationTracker struct {
+	mu    sync.Mutex
+	seen  map[common.Hash]time.Time
+	order []common.Hash
+	peers map[discover.NodeId]*peerPropagation
+}
+
+func newPropagationTracker() *propagationTracker {
+	return &propagationTracker{
+		seen:  make(map[common.Hash]time.Time),
+		peers: make(map[discover.NodeId]*peerPropagation),
+	}
+}
+
+// announce records the announcement of the block by the peer at now.
+func (t *propagationTracker) announce(id discover.NodeId, hash common.Hash, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, exists := t.peers[id]
+	if !exists {
+		p = new(peerPropagation)
+		t.peers[id] = p
+	}
+	p.announced++
+	first, exists := t.seen[hash]
+	if !exists {
+		t.seen[hash] = now
+		t.order = append(t.order, hash)
+		if len(t.order) > maxTrackedBlocks {
+			delete(t.seen, t.order[0])
+			t.order = t.order[1:]
+		}
+		p.first++
+		first = now
+	}
+	delay := now.Sub(first)
+	if p.announced == 1 {
+		p.avgDelay = delay
+		return
+	}
+	p.avgDelay = time.Duration(float64(p.avgDelay)*(1-propagationWeight) + float64(delay)*propagationWeight)
+}
+
+func (t *propagationTracker) dropPeer(id discover.NodeId) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.peers, id)
+}
+
+func (t *propagationTracker) get(id discover.NodeId) *peerPropagation {
+	if p, exists := t.peers[id]; exists {
+		return p
+	}
+	return new(peerPropagation)
+}
+
+func (t *propagationTracker) less(a, b discover.NodeId) bool {
+	return t.get(a).better(t.get(b))
+}
+
+// sortPeers sorts the peers by their rank, the best first.
+func (t *propagationTracker) sortPeers(peers []syncpeer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sort.SliceStable(peers, func(i, j int) bool {
+		return t.less(peers[i].ID(), peers[j].ID())
+	})
+}
+
+// ranking returns the propagation of the peers by their rank.
+func (t *propagationTracker) ranking(ids []discover.NodeId) []*xfsgo.PeerPropagation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sort.SliceStable(ids, func(i, j int) bool {
+		return t.less(ids[i], ids[j])
+	})
+	result := make([]*xfsgo.PeerPropagation, 0, len(ids))
+	for i, id := range ids {
+		p := t.get(id)
+		result = append(result, &xfsgo.PeerPropagation{
+			ID:        id.String(),
+			Rank:      i + 1,
+			Announced: p.announced,
+			First:     p.first,
+			AvgDelay:  p.avgDelay.Milliseconds(),
+		})
+	}
+	return result
+}
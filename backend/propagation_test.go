@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"testing"
+	"time"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/p2p/discover"
+)
+
+func TestPropagationTracker_ranking(t *testing.T) {
+	tracker := newPropagationTracker()
+	fast, slow, idle := testNodes[0].nodeId, testNodes[1].nodeId, testNodes[2].nodeId
+	now := time.Unix(1000, 0)
+	for i := byte(0); i < 4; i++ {
+		hash := common.Hash{i}
+		first, second := fast, slow
+		if i == 3 {
+			// the slow peer is first once
+			first, second = slow, fast
+		}
+		tracker.announce(first, hash, now)
+		tracker.announce(second, hash, now.Add(100*time.Millisecond))
+		now = now.Add(time.Second)
+	}
+	ranking := tracker.ranking([]discover.NodeId{idle, slow, fast})
+	assert.Equal(t, len(ranking), 3)
+	assert.Equal(t, ranking[0].ID, fast.String())
+	assert.Equal(t, ranking[0].Announced, uint64(4))
+	assert.Equal(t, ranking[0].First, uint64(3))
+	assert.Equal(t, ranking[1].ID, slow.String())
+	assert.Equal(t, ranking[1].AvgDelay > ranking[0].AvgDelay, true)
+	assert.Equal(t, ranking[2].ID, idle.String())
+	assert.Equal(t, ranking[2].Rank, 3)
+
+	tracker.dropPeer(fast)
+	ranking = tracker.ranking([]discover.NodeId{fast, slow})
+	assert.Equal(t, ranking[0].ID, slow.String())
+	assert.Equal(t, ranking[1].Announced, uint64(0))
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package backend
+
+import (
+	"sync"
+	"time"
+	"xfsgo/p2p/discover"
+)
+
+// ServeLimits are the limits of the chain data the node serves to its peers, they keep
+// a peer requesting data as fast as it can from starving the node and the other peers.
+type ServeLimits struct {
+	// BytesPerSec is the rate of the response bytes served to a peer, a peer may
+	// burst up to a second of its rate.
+	BytesPerSec int
+	// MaxInFlight is the maximum number of requests of a peer served at once,
+	// MaxServing the maximum number of requests of all the peers.
+	MaxInFlight int
+	MaxServing  int
+	// MaxResponseSize caps the size of a single response.
+	MaxResponseSize int
+}
+
+// DefaultServeLimits are the serve limits of a full node.
+var DefaultServeLimits = ServeLimits{
+	BytesPerSec:     2 * 1024 * 1024,
+	MaxInFlight:     2,
+	MaxServing:      16,
+	MaxResponseSize: 2 * 1024 * 1024,
+}
+
+type servingQuota struct {
+	allowance float64
+	last      time.Time
+	inFlight  int
+}
+
+// servingBudget is the response size a request may use. Data on the canonical chain may
+// use all the allowance of the peer, other data only the allowance above the reserve
+// kept for canonical requests.
+type servingBudget struct {
+	canonical int
+	side      int
+	used      int
+}
+
+// fits reports whether an item of the size fits the budget and books it when it does.
+func (b *servingBudget) fits(size int, canonical bool) bool {
+	limit := b.side
+	if canonical {
+		limit = b.canonical
+	}
+	if b.used+size > limit {
+		return false
+	}
+	b.used += size
+	return true
+}
+
+type servingLimiter struct {
+	mu      sync.Mutex
+	limits  ServeLimits
+	peers   map[discover.NodeId]*servingQuota
+	serving int
+	now     func() time.Time
+}
+
+func newServingLimiter(limits ServeLimits) *servingLimiter {
+	return &servingLimiter{
+		limits: limits,
+		peers:  make(map[discover.NodeId]*servingQuota),
+		now:    time.Now,
+	}
+}
+
+func (l *servingLimiter) setLimits(limits ServeLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+func (l *servingLimiter) burst() float64 {
+	return float64(l.limits.BytesPerSec)
+}
+
+func (l *servingLimiter) quota(id discover.NodeId) *servingQuota {
+	now := l.now()
+	q, exists := l.peers[id]
+	if !exists {
+		q = &servingQuota{allowance: l.burst(), last: now}
+		l.peers[id] = q
+		return q
+	}
+	q.allowance += now.Sub(q.last).Seconds() * float64(l.limits.BytesPerSec)
+	if q.allowance > l.burst() {
+		q.allowance = l.burst()
+	}
+	q.last = now
+	return q
+}
+
+// begin admits a request of the peer and returns its response budget, ok is false
+// when the peer or the node is serving too many requests already.
+func (l *servingLimiter) begin(id discover.NodeId) (budget *servingBudget, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	q := l.quota(id)
+	if q.inFlight >= l.limits.MaxInFlight || l.serving >= l.limits.MaxServing {
+		return nil, false
+	}
+	q.inFlight += 1
+	l.serving += 1
+	budget = &servingBudget{
+		canonical: int(q.allowance),
+		side:      int(q.allowance - l.burst()/2),
+	}
+	if max := l.limits.MaxResponseSize; budget.canonical > max {
+		budget.canonical = max
+	}
+	if budget.side > budget.canonical {
+		budget.side = budget.canonical
+	}
+	return budget, true
+}
+
+// finish ends a request admitted by begin and charges the peer the size of the response.
+func (l *servingLimiter) finish(id discover.NodeId, budget *servingBudget) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	q := l.quota(id)
+	q.allowance -= float64(budget.used)
+	q.inFlight -= 1
+	l.serving -= 1
+}
+
+func (l *servingLimiter) dropPeer(id discover.NodeId) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if q, exists := l.peers[id]; exists && q.inFlight == 0 {
+		delete(l.peers, id)
+	}
+}
@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+func newTestServingLimiter(limits ServeLimits) (*servingLimiter, *time.Time) {
+	now := time.Unix(1000, 0)
+	l := newServingLimiter(limits)
+	l.now = func() time.Time {
+		return now
+	}
+	return l, &now
+}
+
+func TestServingLimiter_quota(t *testing.T) {
+	l, now := newTestServingLimiter(ServeLimits{
+		BytesPerSec:     1000,
+		MaxInFlight:     1,
+		MaxServing:      2,
+		MaxResponseSize: 800,
+	})
+	id := testNodes[0].nodeId
+	budget, ok := l.begin(id)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, budget.canonical, 800)
+	assert.Equal(t, budget.side, 500)
+	// a peer has one request in flight, the node two
+	if _, ok = l.begin(id); ok {
+		t.Fatal("want request over the in flight limit of the peer refused")
+	}
+	other, ok := l.begin(testNodes[1].nodeId)
+	assert.Equal(t, ok, true)
+	if _, ok = l.begin(testNodes[2].nodeId); ok {
+		t.Fatal("want request over the serving limit refused")
+	}
+	l.finish(testNodes[1].nodeId, other)
+
+	// requests off the main chain are not served from the reserve
+	assert.Equal(t, budget.fits(400, false), true)
+	assert.Equal(t, budget.fits(200, false), false)
+	assert.Equal(t, budget.fits(400, true), true)
+	assert.Equal(t, budget.fits(1, true), false)
+	l.finish(id, budget)
+	budget, _ = l.begin(id)
+	assert.Equal(t, budget.canonical, 200)
+	assert.Equal(t, budget.side, -300)
+	l.finish(id, budget)
+
+	// the allowance refills at the rate up to a second of it
+	*now = now.Add(500 * time.Millisecond)
+	budget, _ = l.begin(id)
+	assert.Equal(t, budget.canonical, 700)
+	l.finish(id, budget)
+	*now = now.Add(time.Hour)
+	budget, _ = l.begin(id)
+	assert.Equal(t, budget.canonical, 800)
+	l.finish(id, budget)
+	l.dropPeer(id)
+	_, exists := l.peers[id]
+	assert.Equal(t, exists, false)
+}
+
+func TestSyncHandler_handleGetBlocksBudget(t *testing.T) {
+	chain := newTestChainMgr(testGenesis, common.Address{})
+	maxChain := chain.Copy()
+	maxChain.NewEmptyBlocks(10)
+	hashes := maxChain.GetBlockHashesFromHash(maxChain.last.HeaderHash(), 9)
+	block, err := json.Marshal(coverBlock2RemoteBlock(maxChain.GetBlockByHash(hashes[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := newServingLimiter(ServeLimits{
+		BytesPerSec:     1 << 20,
+		MaxInFlight:     1,
+		MaxServing:      1,
+		MaxResponseSize: 3*(len(block)+1) + 1,
+	})
+	handler := newSyncHandler(maxChain, limiter, nil, nil, nil, nil)
+	data, _ := json.Marshal(hashes)
+	var got RemoteBlocks
+	send := newResultCheckSender(func(tt uint8, data []byte) error {
+		assert.Equal(t, tt, BlocksMsg)
+		return json.Unmarshal(data, &got)
+	})
+	req := &request{peerId: testNodes[0].nodeId, data: data}
+	if err = handler.handleGetBlocks(req, send); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(got), 3)
+	assert.Equal(t, got[2].Header.Hash, hashes[2])
+}
@@ -1,11 +1,18 @@
 package backend
 
 import (
+	"bytes"
+	"encoding/json"
 	"xfsgo"
 	"xfsgo/common"
 	"xfsgo/p2p/discover"
+
+	"github.com/sirupsen/logrus"
 )
 
+// servedHashSize is the size of a hash in a response of block hashes.
+var servedHashSize = len(common.Hash{})*2 + 4
+
 type handlerHashesFn func(id discover.NodeId, hashes RemoteHashes)
 type handlerBlocksFn func(id discover.NodeId, hashes RemoteBlocks)
 type handlerNewBlockFn func(id discover.NodeId, block *RemoteBlock) error
@@ -13,17 +20,19 @@ type handlerTransactionsFn func(id discover.NodeId, txs RemoteTxs) error
 
 type syncHandler struct {
 	chain                chainMgr
+	serving              *servingLimiter
 	handlerHashesFn      handlerHashesFn
 	handlerBlocksFn      handlerBlocksFn
 	handlerNewBlockFn    handlerNewBlockFn
 	handlerTransactionFn handlerTransactionsFn
 }
 
-func newSyncHandler(chain chainMgr, hashesFn handlerHashesFn,
+func newSyncHandler(chain chainMgr, serving *servingLimiter, hashesFn handlerHashesFn,
 	blocksFn handlerBlocksFn, newBlockFn handlerNewBlockFn,
 	transactionsFn handlerTransactionsFn) *syncHandler {
 	return &syncHandler{
 		chain:                chain,
+		serving:              serving,
 		handlerHashesFn:      hashesFn,
 		handlerBlocksFn:      blocksFn,
 		handlerNewBlockFn:    newBlockFn,
@@ -31,11 +40,33 @@ func newSyncHandler(chain chainMgr, hashesFn handlerHashesFn,
 	}
 }
 
+// canonical reports whether the block is on the main chain. Requests of data on the
+// main chain are served first, they are what peers syncing to the head need.
+func (handler *syncHandler) canonical(block *xfsgo.Block) bool {
+	main := handler.chain.GetBlockByNumber(block.Height())
+	return main != nil && main.HeaderHash() == block.HeaderHash()
+}
+
 func (handler *syncHandler) handleGetBlockHashes(req *request, p sender) error {
 	var args *getBlockHashesFromNumberData
 	if err := req.jsonObj(&args); err != nil {
 		return err
 	}
+	budget, ok := handler.serving.begin(req.peerId)
+	if !ok {
+		logrus.Debugf("Refuse block hashes request: peerId=%x", req.peerId[len(req.peerId)-4:])
+		return p.SendObject(BlockHashesMsg, nil)
+	}
+	defer handler.serving.finish(req.peerId, budget)
+	if args.Count > maxHashesFetch {
+		args.Count = maxHashesFetch
+	}
+	if max := uint64(budget.canonical / servedHashSize); args.Count > max {
+		args.Count = max
+	}
+	if args.Count == 0 {
+		return p.SendObject(BlockHashesMsg, nil)
+	}
 	last := handler.chain.GetBlockByNumber(args.From + args.Count - 1)
 	if last == nil {
 		bHeader := handler.chain.CurrentBHeader()
@@ -51,6 +82,7 @@ func (handler *syncHandler) handleGetBlockHashes(req *request, p sender) error {
 	for i := 0; i < len(hashes)/2; i++ {
 		hashes[i], hashes[len(hashes)-1-i] = hashes[len(hashes)-1-i], hashes[i]
 	}
+	budget.used += len(hashes) * servedHashSize
 	return p.SendObject(BlockHashesMsg, &hashes)
 }
 
@@ -68,16 +100,36 @@ func (handler *syncHandler) handleGetBlocks(req *request, p sender) error {
 	if err := req.jsonObj(&args); err != nil {
 		return err
 	}
-	blocks := make(RemoteBlocks, 0)
-	for _, hash := range args {
+	budget, ok := handler.serving.begin(req.peerId)
+	if !ok {
+		logrus.Debugf("Refuse blocks request: peerId=%x", req.peerId[len(req.peerId)-4:])
+		return p.SendObject(BlocksMsg, RemoteBlocks{})
+	}
+	defer handler.serving.finish(req.peerId, budget)
+	if uint64(len(args)) > maxBlocksFetch {
+		args = args[:maxBlocksFetch]
+	}
+	// the blocks are encoded one by one to stop at the size the budget allows
+	buf := bytes.NewBufferString("[")
+	for i, hash := range args {
 		block := handler.chain.GetBlockByHashWithoutRec(hash)
 		if block == nil {
 			break
 		}
-		newBlock := coverBlock2RemoteBlock(block)
-		blocks = append(blocks, newBlock)
+		data, err := json.Marshal(coverBlock2RemoteBlock(block))
+		if err != nil {
+			return err
+		}
+		if !budget.fits(len(data)+1, handler.canonical(block)) {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(data)
 	}
-	return p.SendObject(BlocksMsg, &blocks)
+	buf.WriteByte(']')
+	return p.SendData(BlocksMsg, buf.Bytes())
 }
 
 func (handler *syncHandler) handleGotBlocks(req *request, _ sender) error {
@@ -111,11 +163,25 @@ func (handler *syncHandler) handleGetReceipts(req *request, p sender) error {
 	if err := req.jsonObj(&args); err != nil {
 		return err
 	}
+	budget, ok := handler.serving.begin(req.peerId)
+	if !ok {
+		return p.SendObject(ReceiptsData, ReceiptsSet{})
+	}
+	defer handler.serving.finish(req.peerId, budget)
 	data := make(ReceiptsSet, 0)
 	for _, item := range args {
-		if val := handler.chain.GetReceiptByHash(item); val != nil {
-			data = append(data, val)
+		val := handler.chain.GetReceiptByHash(item)
+		if val == nil {
+			continue
+		}
+		bs, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		if !budget.fits(len(bs)+1, true) {
+			break
 		}
+		data = append(data, val)
 	}
 	return p.SendObject(ReceiptsData, &data)
 }
@@ -44,6 +44,8 @@ type chainMgr interface {
 	GetBlockByHash(hash common.Hash) *xfsgo.Block
 	InsertChain(block *xfsgo.Block) error
 	SetBoundaries(syncStatsOrigin, syncStatsHeight uint64) error
+	SetSyncing(syncing bool)
+	ForkFilter() *xfsgo.ForkFilter
 }
 type hashPack struct {
 	peerId discover.NodeId
@@ -78,6 +80,9 @@ type syncMgr struct {
 	processLock   sync.Mutex
 	cancelLock    sync.RWMutex
 	queue         *syncQueue
+	serving       *servingLimiter
+	propagation   *propagationTracker
+	forks         *xfsgo.ForkFilter
 	reportMu      sync.RWMutex
 	lastReport    time.Time
 	synchronising int32
@@ -103,9 +108,12 @@ func newSyncMgr(
 		processCh:   make(chan bool, 1),
 		cancelCh:    make(chan struct{}),
 		queue:       newSyncQueue(),
+		serving:     newServingLimiter(DefaultServeLimits),
+		propagation: newPropagationTracker(),
+		forks:       chain.ForkFilter(),
 	}
 	hm := newHandlerMgr()
-	syncHanlder := newSyncHandler(chain, mgr.handleHashes,
+	syncHanlder := newSyncHandler(chain, mgr.serving, mgr.handleHashes,
 		mgr.handleBlocks, mgr.handleNewBlock, mgr.handleTransactions)
 	hm.Handle(GetBlockHashesFromNumberMsg, syncHanlder.handleGetBlockHashes)
 	hm.Handle(BlockHashesMsg, syncHanlder.handleGotBlockHashes)
@@ -125,6 +133,7 @@ func (mgr *syncMgr) Handler() handlerMgr {
 
 func (mgr *syncMgr) onNewPeer(p2ppeer p2p.Peer) error {
 	p := newPeer(p2ppeer, mgr.version, mgr.network)
+	p.forks = mgr.forks
 	return mgr.handlePeer(p)
 }
 func (mgr *syncMgr) handleTransactions(p discover.NodeId, txs RemoteTxs) error {
@@ -167,6 +176,7 @@ func (mgr *syncMgr) handleNewBlock(p discover.NodeId, block *RemoteBlock) error
 	if pn == nil {
 		return errUnKnowPeer
 	}
+	mgr.propagation.announce(p, blockHash, time.Now())
 	if blockHeight > pn.Height() {
 		mgr.peers.setHeight(p, blockHeight)
 		mgr.peers.setHead(p, blockHash)
@@ -177,6 +187,12 @@ func (mgr *syncMgr) handleNewBlock(p discover.NodeId, block *RemoteBlock) error
 	return nil
 }
 
+// syncing reports whether the node is synchronising. Blocks and transactions are not
+// gossiped meanwhile, the node cannot validate them against its stale head.
+func (mgr *syncMgr) syncing() bool {
+	return atomic.LoadInt32(&mgr.synchronising) == 1
+}
+
 func (mgr *syncMgr) handleBlocks(p discover.NodeId, blocks RemoteBlocks) {
 	mgr.cancelLock.RLock()
 	cancel := mgr.cancelCh
@@ -202,6 +218,8 @@ func (mgr *syncMgr) handlePeer(p syncpeer) error {
 	mgr.peers.appendPeer(p)
 	mgr.newPeerCh <- p
 	defer mgr.peers.dropPeer(p.ID())
+	defer mgr.serving.dropPeer(p.ID())
+	defer mgr.propagation.dropPeer(p.ID())
 	// Send local transaction to remote synchronization
 	mgr.syncTransactions(p)
 	for {
@@ -550,7 +568,7 @@ func (mgr *syncMgr) fetchBlocks(from uint64) error {
 				}
 				break
 			}
-			for _, p := range mgr.peers.listAndShort() {
+			for _, p := range mgr.rankedPeers() {
 				if mgr.queue.Throttle() {
 					break
 				}
@@ -595,8 +613,10 @@ func (mgr *syncMgr) syncWithPeer(p syncpeer) error {
 		pId = p.ID()
 		err error
 	)
+	mgr.chain.SetSyncing(true)
 	mgr.eventBus.Publish(xfsgo.SyncStartEvent{})
 	defer func() {
+		mgr.chain.SetSyncing(false)
 		if err != nil {
 			mgr.cancel()
 			mgr.eventBus.Publish(xfsgo.SyncFailedEvent{Error: err})
@@ -647,6 +667,7 @@ func (mgr *syncMgr) synchronise(pid discover.NodeId) error {
 }
 
 func (mgr *syncMgr) Synchronise(p syncpeer) {
+	defer xfsgo.Recover("sync")
 	if p == nil {
 		return
 	}
@@ -665,6 +686,36 @@ func (mgr *syncMgr) Synchronise(p syncpeer) {
 	}
 }
 
+// rankedPeers returns the peers sorted by how fast they announce new blocks, the block
+// requests go to the first ones.
+func (mgr *syncMgr) rankedPeers() []syncpeer {
+	peers := mgr.peers.listAndShort()
+	mgr.propagation.sortPeers(peers)
+	return peers
+}
+
+// bestPeer returns the peer with the highest head, of the peers with the same height the
+// one announcing new blocks first.
+func (mgr *syncMgr) bestPeer() syncpeer {
+	var best syncpeer
+	for _, p := range mgr.rankedPeers() {
+		if best == nil || p.Height() > best.Height() {
+			best = p
+		}
+	}
+	return best
+}
+
+// PeerPropagation returns how fast the peers announce new blocks by their rank.
+func (mgr *syncMgr) PeerPropagation() []*xfsgo.PeerPropagation {
+	peers := mgr.peers.peerList()
+	ids := make([]discover.NodeId, 0, len(peers))
+	for _, p := range peers {
+		ids = append(ids, p.ID())
+	}
+	return mgr.propagation.ranking(ids)
+}
+
 func (mgr *syncMgr) syncer() {
 	forceSync := time.NewTicker(10 * time.Second)
 	defer forceSync.Stop()
@@ -674,9 +725,9 @@ func (mgr *syncMgr) syncer() {
 			if mgr.peers.count() < 5 {
 				break
 			}
-			go mgr.Synchronise(mgr.peers.basePeer())
+			go mgr.Synchronise(mgr.bestPeer())
 		case <-forceSync.C:
-			go mgr.Synchronise(mgr.peers.basePeer())
+			go mgr.Synchronise(mgr.bestPeer())
 		}
 	}
 }
@@ -712,6 +763,9 @@ func (mgr *syncMgr) txSyncLoop() {
 }
 
 func (mgr *syncMgr) BroadcastBlock(block *RemoteBlock) {
+	if mgr.syncing() {
+		return
+	}
 	for _, p := range mgr.peers.peerList() {
 		if p.HasBlock(block.Header.Hash) {
 			continue
@@ -736,6 +790,9 @@ func (mgr *syncMgr) txBroadcastLoop() {
 	}
 }
 func (mgr *syncMgr) BroadcastTx(tx *RemoteBlockTx) {
+	if mgr.syncing() {
+		return
+	}
 	mHeader := mgr.chain.CurrentBHeader()
 	mHeight := mHeader.Height
 	for _, p := range mgr.peers.peerList() {
@@ -765,11 +822,11 @@ func (mgr *syncMgr) minedBroadcastLoop() {
 }
 func (mgr *syncMgr) Start() {
 	// start broadcasing transaction
-	go mgr.txBroadcastLoop()
+	go xfsgo.Supervise("sync.txbroadcast", xfsgo.DefaultRestartPolicy, mgr.txBroadcastLoop)
 	// start broadcasing block
-	go mgr.minedBroadcastLoop()
+	go xfsgo.Supervise("sync.blockbroadcast", xfsgo.DefaultRestartPolicy, mgr.minedBroadcastLoop)
 	// start syncmgrronising block
-	go mgr.syncer()
+	go xfsgo.Supervise("sync", xfsgo.DefaultRestartPolicy, mgr.syncer)
 	// start syncmgrronising transaction
-	go mgr.txSyncLoop()
+	go xfsgo.Supervise("sync.txsync", xfsgo.DefaultRestartPolicy, mgr.txSyncLoop)
 }
@@ -0,0 +1,87 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"xfsgo/common"
+)
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrBalanceOverflow     = errors.New("balance overflow")
+	ErrNegativeAmount      = errors.New("negative amount")
+)
+
+// addBalance returns a new integer holding balance + amount, the arguments are never
+// modified. A nil balance is zero, the result must not exceed common.BigMaxUint256.
+func addBalance(balance, amount *big.Int) (*big.Int, error) {
+	if amount.Sign() < 0 {
+		return nil, ErrNegativeAmount
+	}
+	result := new(big.Int).Set(amount)
+	if balance != nil {
+		result.Add(result, balance)
+	}
+	if result.Cmp(common.BigMaxUint256) > 0 {
+		return nil, ErrBalanceOverflow
+	}
+	return result, nil
+}
+
+// subBalance returns a new integer holding balance - amount, the arguments are never
+// modified. A nil balance is zero, the result must not be negative.
+func subBalance(balance, amount *big.Int) (*big.Int, error) {
+	if amount.Sign() < 0 {
+		return nil, ErrNegativeAmount
+	}
+	result := new(big.Int).Neg(amount)
+	if balance != nil {
+		result.Add(result, balance)
+	}
+	if result.Sign() < 0 {
+		return nil, ErrInsufficientBalance
+	}
+	return result, nil
+}
+
+// Transfer moves the amount from the balance of an account to another one, the balances
+// are unchanged if an error is returned.
+func (st *StateTree) Transfer(from, to common.Address, amount *big.Int) error {
+	if amount == nil || amount.Sign() == 0 {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sender := st.getOrNewStateObj(from)
+	senderBalance, err := subBalance(sender.GetBalance(), amount)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	recipient := st.getOrNewStateObj(to)
+	recipientBalance, err := addBalance(recipient.GetBalance(), amount)
+	if err != nil {
+		return err
+	}
+	sender.SetBalance(senderBalance)
+	recipient.SetBalance(recipientBalance)
+	return nil
+}
@@ -0,0 +1,85 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"testing/quick"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+// balanceValue makes a non negative amount of at most 256 bits from random words.
+func balanceValue(words [4]uint64) *big.Int {
+	v := new(big.Int)
+	for _, w := range words {
+		v.Lsh(v, 64)
+		v.Or(v, new(big.Int).SetUint64(w))
+	}
+	return v
+}
+
+func TestBalanceArithmetic_properties(t *testing.T) {
+	// add and sub don't modify their arguments and sub reverts add
+	inverse := func(x, y [4]uint64) bool {
+		a, b := balanceValue(x), balanceValue(y)
+		a0, b0 := new(big.Int).Set(a), new(big.Int).Set(b)
+		sum, err := addBalance(a, b)
+		if err != nil {
+			return new(big.Int).Add(a, b).Cmp(common.BigMaxUint256) > 0
+		}
+		diff, err := subBalance(sum, b)
+		return err == nil && diff.Cmp(a) == 0 && a.Cmp(a0) == 0 && b.Cmp(b0) == 0 && sum.Cmp(a) >= 0
+	}
+	if err := quick.Check(inverse, nil); err != nil {
+		t.Fatal(err)
+	}
+	// sub fails exactly when the amount exceeds the balance
+	insufficient := func(x, y [4]uint64) bool {
+		a, b := balanceValue(x), balanceValue(y)
+		diff, err := subBalance(a, b)
+		if a.Cmp(b) < 0 {
+			return err == ErrInsufficientBalance && diff == nil
+		}
+		return err == nil && diff.Sign() >= 0
+	}
+	if err := quick.Check(insufficient, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := addBalance(common.BigMaxUint256, common.Big1)
+	assert.Equal(t, err, ErrBalanceOverflow)
+	_, err = addBalance(nil, big.NewInt(-1))
+	assert.Equal(t, err, ErrNegativeAmount)
+	_, err = subBalance(nil, big.NewInt(-1))
+	assert.Equal(t, err, ErrNegativeAmount)
+}
+
+func TestStateTree_Transfer(t *testing.T) {
+	st := NewStateTree(newTestStateDB(t), nil)
+	from, to := common.Address{0x01}, common.Address{0x02}
+	if err := st.AddBalance(from, big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+	// the balance returned is a copy
+	st.GetBalance(from).SetInt64(0)
+	assert.BigIntEqual(t, st.GetBalance(from), big.NewInt(100))
+
+	amount := big.NewInt(60)
+	if err := st.Transfer(from, to, amount); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, amount, big.NewInt(60))
+	assert.BigIntEqual(t, st.GetBalance(from), big.NewInt(40))
+	assert.BigIntEqual(t, st.GetBalance(to), big.NewInt(60))
+	assert.Equal(t, st.Transfer(from, to, big.NewInt(41)), ErrInsufficientBalance)
+	assert.Equal(t, st.SubBalance(from, big.NewInt(41)), ErrInsufficientBalance)
+	assert.BigIntEqual(t, st.GetBalance(from), big.NewInt(40))
+	assert.BigIntEqual(t, st.GetBalance(to), big.NewInt(60))
+
+	// the sender is not debited when the recipient overflows
+	if err := st.AddBalance(to, new(big.Int).Sub(common.BigMaxUint256, big.NewInt(60))); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, st.Transfer(from, to, big.NewInt(1)), ErrBalanceOverflow)
+	assert.BigIntEqual(t, st.GetBalance(from), big.NewInt(40))
+	assert.BigIntEqual(t, st.GetBalance(to), common.BigMaxUint256)
+}
@@ -14,12 +14,14 @@
 // You should have received a copy of the MIT Lesser General Public License
 // along with the xfsgo library. If not, see <https://mit-license.org/>.
 
-//
 package xfsgo
 
 import (
 	"encoding/json"
+	"errors"
 	"math/big"
+	"unicode"
+	"unicode/utf8"
 	"xfsgo/avlmerkle"
 	"xfsgo/common"
 	"xfsgo/common/ahash"
@@ -33,6 +35,28 @@ var (
 
 const version0 = uint32(0)
 
+const (
+	// MaxExtraDataSize is the maximum size of the extra data of a block header.
+	MaxExtraDataSize = 32
+	// MaxRewardShares is the maximum number of addresses the block reward can be split to.
+	MaxRewardShares = 8
+	// versionReservedMask covers the bits of the header version reserved for future
+	// consensus upgrades, they must be zero.
+	versionReservedMask = uint32(0xffff0000)
+	// HeaderEncodingVersion is the latest header version whose fields are all known.
+	HeaderEncodingVersion = version0
+)
+
+var (
+	ErrExtraDataTooLarge     = errors.New("extra data too large")
+	ErrInvalidExtraData      = errors.New("extra data must be printable utf-8 text")
+	ErrExtraDataBeforeFork   = errors.New("extra data set before the header checks fork")
+	ErrInvalidBlockVersion   = errors.New("invalid block version")
+	ErrTooManyRewardShares   = errors.New("too many reward shares")
+	ErrInvalidRewardSplit    = errors.New("invalid reward split")
+	ErrRewardSplitBeforeFork = errors.New("reward split set before the reward split fork")
+)
+
 // BlockHeader represents a block header in the xfs blockchain.
 // It is importance to note that the BlockHeader includes StateRoot,TransactionsRoot
 // and ReceiptsRoot fields which implement the state management of the xfs blockchain.
@@ -52,6 +76,63 @@ type BlockHeader struct {
 	Bits       uint32 `json:"bits"`
 	Nonce      uint32 `json:"nonce"`
 	ExtraNonce uint64 `json:"extranonce"`
+	// ExtraData is the free-form data set by the miner, such as a pool tag.
+	ExtraData []byte `json:"extra_data,omitempty"`
+	// RewardSplit pays shares of the block reward to other addresses than the
+	// coinbase, which receives the remainder.
+	RewardSplit []RewardShare `json:"reward_split,omitempty"`
+	// fields added by later header versions, kept so the header is encoded
+	// and hashed unchanged.
+	trailing []rawencode.Field
+}
+
+type blockHeaderJSON BlockHeader
+
+// RewardShare is the percentage of the block reward paid to an address.
+type RewardShare struct {
+	Address common.Address `json:"address"`
+	Percent uint32         `json:"percent"`
+}
+
+// VerifyExtraData checks that the extra data of a header is no larger than
+// MaxExtraDataSize and consists of printable text.
+func VerifyExtraData(data []byte) error {
+	if len(data) > MaxExtraDataSize {
+		return ErrExtraDataTooLarge
+	}
+	if !utf8.Valid(data) {
+		return ErrInvalidExtraData
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) {
+			return ErrInvalidExtraData
+		}
+	}
+	return nil
+}
+
+// VerifyRewardSplit checks that a reward split has at most MaxRewardShares shares
+// of distinct addresses, each at least one percent and at most 100 percent in total.
+func VerifyRewardSplit(split []RewardShare) error {
+	if len(split) > MaxRewardShares {
+		return ErrTooManyRewardShares
+	}
+	total := uint32(0)
+	seen := make(map[common.Address]struct{}, len(split))
+	for _, share := range split {
+		if share.Percent < 1 || share.Percent > 100 {
+			return ErrInvalidRewardSplit
+		}
+		if _, exists := seen[share.Address]; exists {
+			return ErrInvalidRewardSplit
+		}
+		seen[share.Address] = struct{}{}
+		total += share.Percent
+	}
+	if total > 100 {
+		return ErrInvalidRewardSplit
+	}
+	return nil
 }
 
 // BlockHeader hash
@@ -71,8 +152,56 @@ func (bHead *BlockHeader) Encode() ([]byte, error) {
 	return json.Marshal(bHead)
 }
 
+// Decode decodes a stored header. Unknown fields are rejected unless the header
+// has a version later than HeaderEncodingVersion and they follow the known fields.
 func (bHead *BlockHeader) Decode(data []byte) error {
-	return json.Unmarshal(data, bHead)
+	return bHead.decode(data, true)
+}
+
+func (bHead *BlockHeader) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*blockHeaderJSON)(bHead))
+	if err != nil {
+		return nil, err
+	}
+	return rawencode.AppendFields(data, bHead.trailing)
+}
+
+func (bHead *BlockHeader) UnmarshalJSON(data []byte) error {
+	return bHead.decode(data, false)
+}
+
+func (bHead *BlockHeader) decode(data []byte, strict bool) error {
+	h := new(blockHeaderJSON)
+	if err := json.Unmarshal(data, h); err != nil {
+		return err
+	}
+	trailing, err := decodeTrailingFields(data, h, h.Version&^versionReservedMask > HeaderEncodingVersion, strict)
+	if err != nil {
+		return err
+	}
+	*bHead = BlockHeader(*h)
+	bHead.trailing = trailing
+	return nil
+}
+
+// decodeTrailingFields returns the unknown trailing fields of the encoded object data
+// which are kept if the object has a later version than known to this node. When strict
+// is set, unknown fields of known versions and unknown fields before known fields are rejected.
+func decodeTrailingFields(data []byte, v interface{}, later, strict bool) ([]rawencode.Field, error) {
+	trailing, misplaced, err := rawencode.SplitFields(data, v)
+	if err != nil {
+		return nil, err
+	}
+	if strict && misplaced {
+		return nil, rawencode.ErrMisplacedFields
+	}
+	if !later {
+		if strict && len(trailing) > 0 {
+			return nil, rawencode.ErrUnknownField
+		}
+		return nil, nil
+	}
+	return trailing, nil
 }
 func (bHead *BlockHeader) clone() *BlockHeader {
 	p := *bHead
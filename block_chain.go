@@ -21,40 +21,29 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/core"
+	"xfsgo/params"
 	"xfsgo/storage/badger"
 	"xfsgo/vm"
 
 	"github.com/sirupsen/logrus"
 )
 
-var zeroBigN = new(big.Int).SetInt64(0)
-
 const (
-	// blocks can be created per second(in seconds)
-	// adjustment factor
-	adjustmentFactor    = int64(2)
-	maxOrphanBlocks     = 100
-	targetTimePerBlock  = int64(time.Minute * 3 / time.Second)
-	targetTimespanPreV4 = int64(time.Hour * 1 / time.Second)
-	targetTimespanV4    = int64(time.Minute * 57 / time.Second)
-	endTimeV2           = int64(time.Hour * 1008 / time.Second)
-	endTimeV3           = int64(time.Hour * 168 / time.Second)
-	endTimeV4           = int64(time.Hour * 538 / time.Second)
-	totalblocksv2       = endTimeV2 / targetTimePerBlock
-	totalblocksv3       = endTimeV3 / targetTimePerBlock
-	totalblocksv4       = endTimeV4 / targetTimePerBlock
-	totalblocks         = endTimeV2/targetTimePerBlock + endTimeV3/targetTimePerBlock + endTimeV4/targetTimePerBlock
-	//targetTimePerBlock = int64(time.Minute * 1 / time.Second)
-	//targetTimespan  = int64(time.Minute * 10 / time.Second)
-	//endTimeV1 = int64(time.Minute * 10 / time.Second)
+	maxOrphanBlocks    = 100
+	targetTimePerBlock = params.TargetTimePerBlock
+	totalblocksv2      = params.EndTimeV2 / targetTimePerBlock
+	totalblocksv3      = params.EndTimeV3 / targetTimePerBlock
+	totalblocksv4      = params.EndTimeV4 / targetTimePerBlock
+	totalblocks        = totalblocksv2 + totalblocksv3 + totalblocksv4
 )
 
 var (
-	baseSubsidy, _        = new(big.Int).SetString("93755722410000000000", 10)
-	baseTestSubsidy, _    = common.BaseCoin2Atto("14")
 	GasPoolOutErr         = errors.New("gas pool out err")
 	ErrBlockIgnored       = errors.New("block hash ignore")
 	ErrBadBlock           = errors.New("bad block")
@@ -62,6 +51,12 @@ var (
 	ErrWriteBlock         = errors.New("write block err")
 	ErrOrphansBlock       = errors.New("block is orphans")
 	ErrDifficultyOverflow = errors.New("difficulty overflow")
+	ErrInvalidGasLimit    = errors.New("invalid gas limit")
+	ErrTimeTooOld         = errors.New("block timestamp not after median time past")
+	ErrTimeTooNew         = errors.New("block timestamp too far in the future")
+	// ErrTransferBalance is the error of a transfer whose value exceeds the balance of
+	// the sender, its message is part of the state transition test vectors
+	ErrTransferBalance = errors.New("from balance is not enough")
 )
 
 type orphanBlock struct {
@@ -90,6 +85,7 @@ type IBlockChain interface {
 	GetHead() *Block
 	GetBalance(addr common.Address) *big.Int
 	WriteBlock(block *Block) error
+	WriteBlockWithState(block *Block, stateTree *StateTree) error
 	writeBlock(block *Block) error
 	WriteReceipts2ExtraDB(bHash common.Hash, receipts []*Receipt) error
 	WriteTransactions2ExtraDB(bHash common.Hash, height uint64, transactions []*Transaction) error
@@ -115,6 +111,13 @@ type IBlockChain interface {
 	CalcNextRequiredDifficulty() (uint32, error)
 	CalcNextRequiredBitsByHeight(height uint64) (uint32, error)
 	CurrentStateTree() *StateTree
+	NetworkHashRate(window uint64) common.HashRate
+	CalcPastMedianTime(parent *BlockHeader) uint64
+	MinimumTimestamp(parent *BlockHeader) uint64
+	CalcDifficultyByBits(bits uint32) float64
+	CalcWorkloadByBits(bits uint32) *big.Int
+	AccumulateRewards(stateTree *StateTree, header *BlockHeader)
+	ChainConfig() *ChainConfig
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -131,7 +134,11 @@ type BlockChain struct {
 	stateTree      *StateTree
 	mu             sync.RWMutex
 	chainmu        sync.RWMutex
-	eventBus       *EventBus
+	// mmrMu protects the header commitments
+	mmrMu sync.Mutex
+	// addrIndexMu serializes the catch up of the address index
+	addrIndexMu sync.Mutex
+	eventBus    *EventBus
 	// orphans
 	orphans      map[common.Hash]*orphanBlock
 	prevOrphans  map[common.Hash][]*orphanBlock
@@ -141,6 +148,15 @@ type BlockChain struct {
 	syncStatsOrigin uint64       // Origin block number where syncing started at
 	syncStatsHeight uint64       // Highest block number known when syncing started
 	syncStatsLock   sync.RWMutex // Lock protecting the sync stats fields
+	syncing         bool         // Whether a synchronisation is running
+	// witnesses keeps the state witnesses of the accepted blocks if recording is set
+	witnesses *witnessCache
+	// config and schedule are set by the genesis of the chain
+	config   *ChainConfig
+	schedule *BlockSchedule
+	// randomness is the randomness of the contracts of the state transitions run without
+	// the chain, which has no headers to mix it from
+	randomness common.Hash
 }
 
 func NewBlockChainN(stateDB, chainDB, extraDB badger.IStorage, eventBus *EventBus, debug bool) (*BlockChain, error) {
@@ -159,6 +175,14 @@ func NewBlockChainN(stateDB, chainDB, extraDB badger.IStorage, eventBus *EventBu
 	}
 
 	bc.genesisBHeader = genesisBlock.Header
+	// the config and schedule set by the genesis written last are kept by the chain,
+	// so several chains can be opened one after another in a process
+	bc.config = genesisChainConfig(GenesisConfig, bc.genesisBHeader.Bits)
+	bc.schedule = GenesisSchedule
+	// the rewards of processed blocks are checked against the reward schedule
+	if err := bc.config.Verify(); err != nil {
+		return nil, err
+	}
 
 	if err := bc.setLastState(); err != nil {
 		return nil, err
@@ -169,9 +193,17 @@ func NewBlockChainN(stateDB, chainDB, extraDB badger.IStorage, eventBus *EventBu
 }
 
 func (bc *BlockChain) GetNonce(addr common.Address) uint64 {
+	return bc.CommittedState().GetNonce(addr)
+}
+
+// CommittedState returns a state tree of the state root of the current block. The tree
+// is read from the committed state and shares no state objects with other readers, so
+// it is not affected by blocks being mined or imported meanwhile.
+func (bc *BlockChain) CommittedState() *StateTree {
 	bc.mu.RLock()
-	defer bc.mu.RUnlock()
-	return bc.stateTree.GetNonce(addr)
+	root := bc.currentBHeader.StateRoot
+	bc.mu.RUnlock()
+	return NewStateTree(bc.stateDB, root.Bytes())
 }
 
 // getBlockByNumber get Block's Info about the Optimum chain
@@ -181,6 +213,13 @@ func (bc *BlockChain) GetBlockByNumber(num uint64) *Block {
 	return bc.getBlockByNumber(num)
 }
 
+// GetBlockHeaderByNumber returns the header of the main chain block at the height.
+func (bc *BlockChain) GetBlockHeaderByNumber(num uint64) *BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.chainDB.GetBlockHeaderByHeight(num)
+}
+
 // getBlockByNumber get Block's Info about the Optimum chain
 func (bc *BlockChain) getBlockByNumber(num uint64) *Block {
 	blockHeader := bc.chainDB.GetBlockHeaderByHeight(num)
@@ -192,12 +231,30 @@ func (bc *BlockChain) getBlockByNumber(num uint64) *Block {
 
 	transantions := bc.extraDB.GetBlockTransactionsByBHash(blockHeader.HeaderHash())
 
+	DeriveLogFields(receipts, blockHeader.HeaderHash(), blockHeader.Height)
 	block := &Block{Header: blockHeader, Transactions: transantions, Receipts: receipts}
 
 	return block
 
 }
 
+// GetCanonicalHash returns the hash of the main chain block at the height, it is false
+// if the main chain doesn't reach the height.
+func (bc *BlockChain) GetCanonicalHash(height uint64) (common.Hash, bool) {
+	return bc.chainDB.GetBlockHashByHeight(height)
+}
+
+// IsCanonical reports whether the block of the hash is in the main chain, rather than
+// in a side chain or dropped by a reorg.
+func (bc *BlockChain) IsCanonical(hash common.Hash) bool {
+	header := bc.chainDB.GetBlockHeaderByHash(hash)
+	if header == nil {
+		return false
+	}
+	canonical, exists := bc.GetCanonicalHash(header.Height)
+	return exists && canonical == hash
+}
+
 func (bc *BlockChain) GetBlockHeaderByBHash(hash common.Hash) *BlockHeader {
 	return bc.chainDB.GetBlockHeaderByHash(hash)
 }
@@ -209,6 +266,7 @@ func (bc *BlockChain) GetBlockByHash(hash common.Hash) *Block {
 	}
 	transactions := bc.extraDB.GetBlockTransactionsByBHash(hash)
 	receipts := bc.extraDB.GetBlockReceiptsByBHash(hash)
+	DeriveLogFields(receipts, hash, blockHeader.Height)
 	block := &Block{Header: blockHeader, Transactions: transactions, Receipts: receipts}
 
 	return block
@@ -296,9 +354,19 @@ func (bc *BlockChain) setLastState() error {
 	return nil
 }
 
+// SubscribeChainHeadEvents subscribes to the ChainHeadEvent published for every new
+// head block of the main chain.
+func (bc *BlockChain) SubscribeChainHeadEvents() *Subscription {
+	return bc.eventBus.Subscript(ChainHeadEvent{})
+}
+
 // GetBlockReceiptsByBHash get Receipts by blockheader hash
 func (bc *BlockChain) GetBlockReceiptsByBHash(Hash common.Hash) []*Receipt {
-	return bc.extraDB.GetBlockReceiptsByBHash(Hash)
+	receipts := bc.extraDB.GetBlockReceiptsByBHash(Hash)
+	if header := bc.chainDB.GetBlockHeaderByHash(Hash); header != nil {
+		DeriveLogFields(receipts, Hash, header.Height)
+	}
+	return receipts
 }
 
 // GetTransactionByHash get Transaction by Transaction hash
@@ -332,6 +400,63 @@ func (bc *BlockChain) GetBalance(addr common.Address) *big.Int {
 
 }
 
+// StateTreeByNumber returns the state tree after the main chain block with the given height.
+func (bc *BlockChain) StateTreeByNumber(num uint64) *StateTree {
+	roots := bc.GetBlockRootsByNumber(num)
+	if roots == nil {
+		return nil
+	}
+	return NewStateTree(bc.stateDB, roots.StateRoot.Bytes())
+}
+
+// GetBlockRootsByNumber returns the state root and receipts root of the main chain block
+// with the given height. Blocks written before the root index existed are looked up by
+// their header once and added to the index.
+func (bc *BlockChain) GetBlockRootsByNumber(num uint64) *BlockRoots {
+	if roots := bc.chainDB.GetBlockRootsByHeight(num); roots != nil {
+		return roots
+	}
+	header := bc.chainDB.GetBlockHeaderByHeight(num)
+	if header == nil {
+		return nil
+	}
+	if err := bc.chainDB.WriteBlockRootsWithHeight(header); err != nil {
+		logrus.Warnf("Failed to index block roots: height=%d, err=%s", num, err)
+	}
+	return &BlockRoots{
+		StateRoot:    header.StateRoot,
+		ReceiptsRoot: header.ReceiptsRoot,
+	}
+}
+
+// GetConfirmedBalance returns the balance of the account excluding the value received in
+// the latest minConf - 1 blocks, which have less than minConf confirmations.
+func (bc *BlockChain) GetConfirmedBalance(addr common.Address, minConf uint64) *big.Int {
+	bc.mu.RLock()
+	current := bc.currentBHeader
+	bc.mu.RUnlock()
+	balance := new(big.Int)
+	if b := NewStateTree(bc.stateDB, current.StateRoot.Bytes()).GetBalance(addr); b != nil {
+		balance.Set(b)
+	}
+	if minConf <= 1 {
+		return balance
+	}
+	if current.Height+1 < minConf {
+		return new(big.Int)
+	}
+	confirmed := bc.StateTreeByNumber(current.Height + 1 - minConf)
+	if confirmed == nil {
+		return new(big.Int)
+	}
+	if b := confirmed.GetBalance(addr); b == nil {
+		return new(big.Int)
+	} else if b.Cmp(balance) < 0 {
+		balance.Set(b)
+	}
+	return balance
+}
+
 func (bc *BlockChain) WriteBlock(block *Block) error {
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
@@ -339,6 +464,18 @@ func (bc *BlockChain) WriteBlock(block *Block) error {
 	return bc.writeBlock(block)
 }
 
+// WriteBlockWithState commits the state of the block and stores the block. The state is
+// committed under the lock of the chain, so it is not pruned meanwhile.
+func (bc *BlockChain) WriteBlockWithState(block *Block, stateTree *StateTree) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	if err := stateTree.Commit(); err != nil {
+		return err
+	}
+	return bc.writeBlock(block)
+}
+
 // WriteBlock stores the block inputed to the local database.
 func (bc *BlockChain) writeBlock(block *Block) error {
 	bc.mu.RLock()
@@ -348,6 +485,7 @@ func (bc *BlockChain) writeBlock(block *Block) error {
 	if bHeader == nil {
 		return fmt.Errorf("current chain has no head")
 	}
+	DeriveLogFields(block.Receipts, block.HeaderHash(), block.Height())
 
 	if block.Height() > bHeader.Height {
 		curHash := bHeader.HeaderHash()
@@ -377,6 +515,9 @@ func (bc *BlockChain) writeBlock(block *Block) error {
 	if err := bc.WriteReceipts2ExtraDB(block.HeaderHash(), block.Receipts); err != nil {
 		return err
 	}
+	if err := bc.extraDB.WriteAddressIndex(bc.ChainConfig(), block); err != nil {
+		return err
+	}
 
 	return bc.WriteBHeader2ChainDBWithHash(block.Header)
 }
@@ -466,10 +607,23 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *Block) error {
 
 	// Delete transactions with difference between the side chain and the main chain
 	// publish these transtions to txpool
-	for _, tx := range TxDifference(deletedTxs, addedTxs) {
+	orphaned := TxDifference(deletedTxs, addedTxs)
+	for _, tx := range orphaned {
 		go bc.eventBus.Publish(TxPreEvent{Tx: tx})
 		_ = bc.DelTransactionByTxHash(tx.Hash())
 	}
+	event := ChainReorgEvent{
+		Dropped:  make([]common.Hash, 0, len(deletedBlocks)),
+		Added:    make([]common.Hash, 0, len(newBlocks)),
+		Orphaned: orphaned,
+	}
+	for _, block := range deletedBlocks {
+		event.Dropped = append(event.Dropped, block.HeaderHash())
+	}
+	for _, block := range newBlocks {
+		event.Added = append(event.Added, block.HeaderHash())
+	}
+	bc.eventBus.Publish(event)
 	return nil
 }
 
@@ -522,6 +676,17 @@ func (bc *BlockChain) WriteBHeader2Chain(blockHeader *BlockHeader) error {
 		return err
 	}
 
+	if err := bc.chainDB.WriteBlockRootsWithHeight(blockHeader); err != nil {
+		return err
+	}
+
+	bc.mmrMu.Lock()
+	err := bc.chainDB.truncateHeaderMMR(blockHeader.Height)
+	bc.mmrMu.Unlock()
+	if err != nil {
+		return err
+	}
+
 	if err := bc.chainDB.WriteLastBHash(blockHeader.HeaderHash()); err != nil {
 		return err
 	}
@@ -583,19 +748,63 @@ func (bc *BlockChain) DelBHeaderByBHash(hash common.Hash) error {
 // 	return rec
 // }
 
-func calcBlockSubsidy(height uint64) *big.Int {
-	if GenesisBits == TestNetGenesisBits {
-		return baseTestSubsidy
+// blockReward is the part of the block reward paid to an address.
+type blockReward struct {
+	Address common.Address
+	Amount  *big.Int
+}
+
+// blockRewards splits the subsidy of the block by the reward split of the header,
+// every share is rounded down and the coinbase receives the remainder.
+func blockRewards(config *ChainConfig, header *BlockHeader) []*blockReward {
+	subsidy := config.BlockReward(header.Height)
+	rest := new(big.Int).Set(subsidy)
+	rewards := make([]*blockReward, 0, len(header.RewardSplit)+1)
+	for _, share := range header.RewardSplit {
+		amount := new(big.Int).Mul(subsidy, new(big.Int).SetUint64(uint64(share.Percent)))
+		amount.Div(amount, big.NewInt(100))
+		rest.Sub(rest, amount)
+		rewards = append(rewards, &blockReward{Address: share.Address, Amount: amount})
 	}
-	return new(big.Int).Rsh(baseSubsidy, uint(height/480))
+	return append([]*blockReward{{Address: header.Coinbase, Amount: rest}}, rewards...)
+}
+
+// GetBlockReward returns the block subsidy at the height by the reward schedule of the chain.
+func (bc *BlockChain) GetBlockReward(height uint64) *big.Int {
+	return bc.ChainConfig().BlockReward(height)
 }
 
-// AccumulateRewards calculates the rewards and add it to the miner's account.
-func AccumulateRewards(stateTree *StateTree, header *BlockHeader) {
-	subsidy := calcBlockSubsidy(header.Height)
+// ChainConfig returns the config of the chain set by the genesis.
+func (bc *BlockChain) ChainConfig() *ChainConfig {
+	return bc.config
+}
+
+// Schedule returns the block schedule of the chain set by the genesis, it is nil if
+// blocks are mined continuously.
+func (bc *BlockChain) Schedule() *BlockSchedule {
+	return bc.schedule
+}
+
+// AccumulateRewards pays the rewards of the block by the reward schedule of the chain and
+// charges the storage rent at the end of its epochs, if the chain enables it.
+func (bc *BlockChain) AccumulateRewards(stateTree *StateTree, header *BlockHeader) {
+	AccumulateRewards(bc.ChainConfig(), stateTree, header)
+}
 
+// AccumulateRewards calculates the rewards by the config and add it to the miner's account,
+// shares of the reward split are paid to their addresses.
+func AccumulateRewards(config *ChainConfig, stateTree *StateTree, header *BlockHeader) {
+	stateTree.SetForkRules(config, header.Height)
 	//logrus.Debugf("Current height of the blockchain %d, reward: %d", header.Height, subsidy)
-	stateTree.AddBalance(header.Coinbase, subsidy)
+	for _, reward := range blockRewards(config, header) {
+		if err := stateTree.AddBalance(reward.Address, reward.Amount); err != nil {
+			logrus.Warnf("Failed to pay block reward: height=%d, address=%s, err=%s",
+				header.Height, reward.Address.B58String(), err)
+		}
+	}
+	if config.StorageRent != nil {
+		chargeStorageRent(config.StorageRent, stateTree, header.Height)
+	}
 }
 
 func (bc *BlockChain) MaybeAcceptBlock(block *Block) error {
@@ -618,7 +827,14 @@ func (bc *BlockChain) maybeAcceptBlock(block *Block) error {
 	parentStateRoot := parent.StateRoot()
 	//logrus.Debugf("New state tree: parentHeight=%d, parentHash=%x, parentStateRoot=%x",
 	//	parent.Height(), parenthash[len(blockHash)-4:], parentStateRoot[len(parentStateRoot)-4:])
-	stateTree, err := NewStateTreeN(bc.stateDB, parentStateRoot.Bytes())
+	var stateDB badger.IStorage = bc.stateDB
+	var recorder *witnessRecorder
+	witnesses := bc.witnessCache()
+	if witnesses != nil {
+		recorder = newWitnessRecorder(bc.stateDB)
+		stateDB = recorder
+	}
+	stateTree, err := NewStateTreeN(stateDB, parentStateRoot.Bytes())
 	if err != nil {
 		logrus.Errorf("Accept block err: %v", err)
 		return ErrBadBlock
@@ -636,8 +852,11 @@ func (bc *BlockChain) maybeAcceptBlock(block *Block) error {
 	if !bytes.Equal(rsRoot[:], targetRsRoot[:]) {
 		return ErrBadBlock
 	}
-	AccumulateRewards(stateTree, header)
+	bc.AccumulateRewards(stateTree, header)
 	stateTree.UpdateAll()
+	if recorder != nil {
+		witnesses.add(recorder.witness(block.HeaderHash(), parentStateRoot, bc.CalcRandomness(parent.Header)))
+	}
 	if err = stateTree.Commit(); err != nil {
 		logrus.Errorf("Accept block err: %v", err)
 		return ErrWriteBlock
@@ -672,6 +891,48 @@ func (bc *BlockChain) SetBoundaries(syncStatsOrigin, syncStatsHeight uint64) err
 	return nil
 }
 
+// SetSyncing marks the start and the end of a synchronisation with a peer.
+func (bc *BlockChain) SetSyncing(syncing bool) {
+	bc.syncStatsLock.Lock()
+	defer bc.syncStatsLock.Unlock()
+	bc.syncing = syncing
+}
+
+// SyncProgress is the progress of a running synchronisation.
+type SyncProgress struct {
+	Origin  uint64
+	Current uint64
+	Highest uint64
+}
+
+// Percent returns the share of the blocks from origin to highest already imported.
+func (p *SyncProgress) Percent() float64 {
+	if p.Highest <= p.Origin {
+		return 100
+	}
+	return float64(p.Current-p.Origin) / float64(p.Highest-p.Origin) * 100
+}
+
+// Syncing returns the sync progress when a synchronisation is running and the head is
+// behind the highest block known from the peers, and nil when the node is in sync.
+func (bc *BlockChain) Syncing() *SyncProgress {
+	current := bc.CurrentBHeader().Height
+	bc.syncStatsLock.RLock()
+	defer bc.syncStatsLock.RUnlock()
+	if !bc.syncing || current >= bc.syncStatsHeight {
+		return nil
+	}
+	origin := bc.syncStatsOrigin
+	if origin > current {
+		origin = current
+	}
+	return &SyncProgress{
+		Origin:  origin,
+		Current: current,
+		Highest: bc.syncStatsHeight,
+	}
+}
+
 // InsertChain executes the actual chain insertion.
 func (bc *BlockChain) InsertChain(block *Block) error {
 	bc.chainmu.Lock()
@@ -819,6 +1080,7 @@ func (bc *BlockChain) ApplyTransactions(stateTree *StateTree, header *BlockHeade
 	totalUsedGas := big.NewInt(0)
 	mGasPool := (*GasPool)(new(big.Int).Set(header.GasLimit))
 	for _, tx := range txs {
+		stateTree.SetTxContext(tx.Hash(), len(receipts))
 		rec, err := bc.ApplyTransaction(stateTree, header, tx, mGasPool, totalUsedGas)
 		if err != nil {
 			txhash := tx.Hash()
@@ -833,6 +1095,41 @@ func (bc *BlockChain) ApplyTransactions(stateTree *StateTree, header *BlockHeade
 }
 
 func (bc *BlockChain) checkBlockHeaderSanity(prev, header *BlockHeader, blockHash common.Hash) error {
+	config := bc.ChainConfig()
+	if config.IsForkActive(ForkGasLimitBounds, header.Height) {
+		if !common.VerifyGasLimit(prev.GasLimit, header.GasLimit) {
+			return ErrInvalidGasLimit
+		}
+		if header.GasUsed == nil || header.GasUsed.Cmp(header.GasLimit) > 0 {
+			return ErrInvalidGasLimit
+		}
+	}
+	if config.IsForkActive(ForkHeaderChecks, header.Height) {
+		if header.Version&versionReservedMask != 0 {
+			return ErrInvalidBlockVersion
+		}
+		if err := VerifyExtraData(header.ExtraData); err != nil {
+			return err
+		}
+	} else if len(header.ExtraData) != 0 {
+		// the headers of earlier nodes have no extra data
+		return ErrExtraDataBeforeFork
+	}
+	if config.IsForkActive(ForkRewardSplit, header.Height) {
+		if err := VerifyRewardSplit(header.RewardSplit); err != nil {
+			return err
+		}
+	} else if len(header.RewardSplit) != 0 {
+		return ErrRewardSplitBeforeFork
+	}
+	if config.IsForkActive(ForkMedianTime, header.Height) {
+		if header.Timestamp <= bc.CalcPastMedianTime(prev) {
+			return ErrTimeTooOld
+		}
+		if int64(header.Timestamp) > time.Now().Unix()+config.TimeOffsetLimit() {
+			return ErrTimeTooNew
+		}
+	}
 	target := BitsUnzip(header.Bits)
 	if target.Sign() <= 0 {
 		return fmt.Errorf("bits must be a non-negative integer")
@@ -848,7 +1145,7 @@ func (bc *BlockChain) checkBlockHeaderSanity(prev, header *BlockHeader, blockHas
 		return fmt.Errorf("pow check err")
 	}
 
-	if header.Height <= 22180 {
+	if header.Height <= params.DifficultyCheckV3Height {
 		return nil
 	} else if header.Height < uint64(totalblocksv2+totalblocksv3) {
 		last, err := bc.calcNextRequiredBitsByHeight(prev.Height)
@@ -858,7 +1155,7 @@ func (bc *BlockChain) checkBlockHeaderSanity(prev, header *BlockHeader, blockHas
 		if last != header.Bits {
 			return fmt.Errorf("pow check err")
 		}
-	} else if header.Height <= 23555 {
+	} else if header.Height <= params.DifficultyCheckV4Height {
 		return nil
 	} else if header.Height <= uint64(totalblocks) {
 		last, err := bc.calcNextRequiredBitsByHeight(prev.Height)
@@ -875,11 +1172,71 @@ func (bc *BlockChain) checkBlockHeaderSanity(prev, header *BlockHeader, blockHas
 	return nil
 }
 
-func (bc *BlockChain) checkTransactionSanity(tx *Transaction) error {
+// CalcPastMedianTime returns the median timestamp of the parent block and the blocks
+// before it, up to the median time blocks of the chain config.
+func (bc *BlockChain) CalcPastMedianTime(parent *BlockHeader) uint64 {
+	span := bc.ChainConfig().MedianTimeSpan()
+	timestamps := make([]uint64, 0, span)
+	for header := parent; header != nil && len(timestamps) < span; {
+		timestamps = append(timestamps, header.Timestamp)
+		if header.Height == 0 {
+			break
+		}
+		header = bc.chainDB.GetBlockHeaderByHash(header.HashPrevBlock)
+	}
+	if len(timestamps) == 0 {
+		return 0
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	return timestamps[len(timestamps)/2]
+}
+
+// CalcRandomness returns the randomness of the contracts executed in the block following
+// parent, the hash of the header hashes of parent and its ancestors up to RandomnessBlocks
+// of them. The miners choose the nonces of their headers and can withhold the blocks
+// whose randomness they don't like, so it must only be relied on where such a bias is
+// acceptable.
+func (bc *BlockChain) CalcRandomness(parent *BlockHeader) common.Hash {
+	buf := make([]byte, 0, params.RandomnessBlocks*len(common.Hash{}))
+	for header, n := parent, 0; header != nil && n < params.RandomnessBlocks; n++ {
+		hash := header.HeaderHash()
+		buf = append(buf, hash[:]...)
+		if header.Height == 0 {
+			break
+		}
+		header = bc.chainDB.GetBlockHeaderByHash(header.HashPrevBlock)
+	}
+	return common.Bytes2Hash(ahash.SHA256(buf))
+}
+
+// GetRandomness returns the randomness of the contracts executed in the main chain block
+// with the given height, which is known once its parent is. The genesis has none.
+func (bc *BlockChain) GetRandomness(height uint64) (common.Hash, bool) {
+	if height == 0 {
+		return common.Hash{}, false
+	}
+	parent := bc.chainDB.GetBlockHeaderByHeight(height - 1)
+	if parent == nil {
+		return common.Hash{}, false
+	}
+	return bc.CalcRandomness(parent), true
+}
+
+// MinimumTimestamp returns the earliest timestamp a block following parent may have.
+func (bc *BlockChain) MinimumTimestamp(parent *BlockHeader) uint64 {
+	return bc.CalcPastMedianTime(parent) + 1
+}
+
+func (bc *BlockChain) checkTransactionSanity(tx *Transaction, height uint64) error {
 	if !tx.VerifySignature() {
 		return fmt.Errorf("VerifySignature err")
 	}
-	return nil
+	if !bc.ChainConfig().IsForkActive(ForkTxSizeLimits, height) {
+		return nil
+	}
+	return bc.ChainConfig().VerifyTxSize(tx)
 }
 
 // IntrinsicGas computes the 'intrisic gas' for a message
@@ -912,7 +1269,7 @@ func (gp *GasPool) SubGas(v *big.Int) error {
 	return nil
 }
 
-func buyGas(sender *StateObj, tx *Transaction, gp *GasPool, gas *big.Int) error {
+func buyGas(stateTree *StateTree, sender *StateObj, tx *Transaction, gp *GasPool, gas *big.Int) error {
 	mgval := new(big.Int).Mul(tx.GasPrice, tx.GasLimit)
 	if sender.GetBalance().Cmp(mgval) < 0 {
 		return fmt.Errorf("per-buy gas err, balance is not enough")
@@ -922,8 +1279,7 @@ func buyGas(sender *StateObj, tx *Transaction, gp *GasPool, gas *big.Int) error
 		return err
 	}
 	gas.Add(gas, tx.GasLimit)
-	sender.SubBalance(mgval)
-	return nil
+	return stateTree.SubBalance(sender.address, mgval)
 }
 
 func txPreCheck(stateTree *StateTree, tx *Transaction, gp *GasPool, gas *big.Int) (*StateObj, error) {
@@ -935,7 +1291,7 @@ func txPreCheck(stateTree *StateTree, tx *Transaction, gp *GasPool, gas *big.Int
 	if sender.GetNonce() != tx.Nonce {
 		return sender, fmt.Errorf("nonce err: want=%d, got=%d", sender.GetNonce(), tx.Nonce)
 	}
-	if err = buyGas(sender, tx, gp, gas); err != nil {
+	if err = buyGas(stateTree, sender, tx, gp, gas); err != nil {
 		return sender, err
 	}
 	return sender, nil
@@ -953,37 +1309,98 @@ func TxToAddrNotSet(tx *Transaction) bool {
 	return bytes.Equal(tx.To[:], common.ZeroAddr[:])
 }
 
+// TxSetsExtra reports whether the transaction updates the extra data of its sender.
+// Such a transaction is sent by an account to itself and carries the new extra data in its data field.
+func TxSetsExtra(tx *Transaction, from common.Address) bool {
+	return setsExtra(from, tx.To, tx.Data)
+}
+
+func setsExtra(from, to common.Address, data []byte) bool {
+	return len(data) > 0 && bytes.Equal(to[:], from[:])
+}
+
+// MessageKind is the state transition run by the message of a transaction.
+type MessageKind uint8
+
+const (
+	// MessageTransfer transfers the value to the receiver
+	MessageTransfer MessageKind = iota
+	// MessageCreate creates a contract with the code of the data
+	MessageCreate
+	// MessageSetExtra sets the data as the extra data of the sender
+	MessageSetExtra
+	// MessageCall calls the contract of the receiver with the data
+	MessageCall
+)
+
 func (bc *BlockChain) ApplyTransaction(
-	stateTree *StateTree, _ *BlockHeader,
+	stateTree *StateTree, header *BlockHeader,
 	tx *Transaction, gp *GasPool, totalGas *big.Int) (*Receipt, error) {
 	var (
-		err    error
-		sender *StateObj
-		gas    = new(big.Int).SetInt64(0)
-		status uint32
+		err     error
+		sender  *StateObj
+		gas     = new(big.Int).SetInt64(0)
+		status  uint32
+		vmError uint32
+		logs    []*core.Log
 	)
+	config := bc.ChainConfig()
+	stateTree.SetForkRules(config, header.Height)
 
-	if err = bc.checkTransactionSanity(tx); err != nil {
+	if err = bc.checkTransactionSanity(tx, header.Height); err != nil {
 		return nil, err
 	}
 	if sender, err = txPreCheck(stateTree, tx, gp, gas); err != nil {
 		return nil, err
 	}
+	if TxToAddrNotSet(tx) {
+		stateTree.PrepareAccessList(sender.address, nil)
+	} else {
+		to := tx.To
+		stateTree.PrepareAccessList(sender.address, &to)
+	}
 
 	if err = useGas(gas, common.CalcTxInitialCost(tx.Data)); err != nil {
 		return nil, err
 	}
-	if TxToAddrNotSet(tx) {
-		mVm := vm.NewXVM(stateTree)
+	switch config.MessageKind(stateTree, sender.address, tx.To, tx.Data, header.Height) {
+	case MessageCreate:
+		mVm := bc.newBlockVM(stateTree, header)
+		mVm.SetGas(gas.Uint64())
 		if err = mVm.Create(sender.address, tx.Data); err == nil {
 			status = 1
+			logs = mVm.Logs()
+		} else {
+			vmError = uint32(vm.ErrorCode(err))
 		}
-	} else {
+		gas.SetUint64(mVm.GasLeft())
+	case MessageSetExtra:
+		if err = useGas(gas, common.CalcExtraGas(tx.Data)); err != nil {
+			return nil, err
+		}
+		if err = stateTree.SetExtra(sender.address, tx.Data); err != nil {
+			return nil, err
+		}
+		status = 1
+	case MessageCall:
+		mVm := bc.newBlockVM(stateTree, header)
+		mVm.SetGas(gas.Uint64())
+		if err = mVm.Call(sender.address, tx.To, tx.Value, tx.Data); err == nil {
+			status = 1
+			logs = mVm.Logs()
+		} else {
+			vmError = uint32(vm.ErrorCode(err))
+		}
+		gas.SetUint64(mVm.GasLeft())
+	default:
 		fromaddr, _ := tx.FromAddr()
 		txhash := tx.Hash()
 		logrus.Debugf("Transfer: from=%s, to=%s, value=%s, txhash=%x", fromaddr.B58String(), tx.To.B58String(), tx.Value, txhash[len(txhash)-4:])
-		if err = bc.transfer(stateTree, sender, tx.To, tx.Value); err != nil {
-			return nil, err
+		// the transfers of negative values were no-ops before the fork
+		if tx.Value.Sign() >= 0 || config.IsForkActive(ForkNegativeValue, header.Height) {
+			if err = bc.transfer(stateTree, sender, tx.To, tx.Value); err != nil {
+				return nil, err
+			}
 		}
 		status = 1
 	}
@@ -991,9 +1408,14 @@ func (bc *BlockChain) ApplyTransaction(
 
 	// refundGas
 	remaining := new(big.Int).Mul(gas, tx.GasPrice)
-	sender.AddBalance(remaining)
+	if err = stateTree.AddBalance(sender.address, remaining); err != nil {
+		return nil, err
+	}
 	gp.AddGas(gas)
 	mgasused := new(big.Int).Sub(tx.GasLimit, gas)
+	for _, l := range logs {
+		stateTree.AddLog(l)
+	}
 	stateTree.UpdateAll()
 	totalGas.Add(totalGas, mgasused)
 	receipt := &Receipt{
@@ -1002,16 +1424,58 @@ func (bc *BlockChain) ApplyTransaction(
 		Status:  status,
 		GasUsed: mgasused,
 	}
+	if config.IsForkActive(ForkReceiptVMError, header.Height) {
+		receipt.VMError = vmError
+	}
+	receipt.SetLogs(logs)
 	return receipt, nil
 }
 
+// ApplyTransaction applies the transaction to the state as the processing of a block of a
+// chain with the config does, the contracts see the given randomness of the block. The
+// state transition doesn't depend on the chain otherwise, it is run on its own by the
+// state test vectors.
+func ApplyTransaction(config *ChainConfig, randomness common.Hash, stateTree *StateTree, header *BlockHeader, tx *Transaction, gp *GasPool, totalGas *big.Int) (*Receipt, error) {
+	return (&BlockChain{config: config, randomness: randomness}).ApplyTransaction(stateTree, header, tx, gp, totalGas)
+}
+
+func (bc *BlockChain) newBlockVM(stateTree *StateTree, header *BlockHeader) vm.VM {
+	return vm.NewXVMWithContext(stateTree, bc.BlockContext(header))
+}
+
+// BlockContext returns the block context of the contracts executed in the block of the
+// header on this chain, with the builtin contracts upgraded by its config, the rules of
+// the vm fixes from their fork on and the randomness of the block.
+func (bc *BlockChain) BlockContext(header *BlockHeader) vm.BlockContext {
+	ctx := NewBlockContext(header)
+	ctx.Builtins = bc.ChainConfig().BuiltinVersions(header.Height)
+	ctx.Legacy = !bc.ChainConfig().IsForkActive(ForkVMFixes, header.Height)
+	if bc.chainDB == nil {
+		ctx.Randomness = bc.randomness
+	} else if parent := bc.chainDB.GetBlockHeaderByHash(header.HashPrevBlock); parent != nil {
+		ctx.Randomness = bc.CalcRandomness(parent)
+	}
+	return ctx
+}
+
+// NewBlockContext returns the block context of the contracts executed in the block of the
+// header. The values are taken from the header only, so every node executing the block
+// sees the same ones.
+func NewBlockContext(header *BlockHeader) vm.BlockContext {
+	return vm.BlockContext{
+		Height:    header.Height,
+		Timestamp: header.Timestamp,
+		Coinbase:  header.Coinbase,
+	}
+}
+
 func (bc *BlockChain) transfer(st *StateTree, seder *StateObj, to common.Address, amount *big.Int) error {
-	toObj := st.GetOrNewStateObj(to)
-	if seder.balance.Cmp(amount) < 0 {
-		return errors.New("from balance is not enough")
+	if err := st.Transfer(seder.address, to, amount); err != nil {
+		if err == ErrInsufficientBalance {
+			return ErrTransferBalance
+		}
+		return err
 	}
-	seder.SubBalance(amount)
-	toObj.AddBalance(amount)
 	return nil
 }
 
@@ -1086,7 +1550,7 @@ func (bc *BlockChain) findAncestor(bHeader *BlockHeader, height uint64) *BlockHe
 	return indexFirst
 }
 func (bc *BlockChain) calcNextRequiredBitsByHeight(height uint64) (uint32, error) {
-	if height > 1 && GenesisBits == TestNetGenesisBits {
+	if height > 1 && bc.genesisBHeader.Bits == TestNetGenesisBits {
 		//logrus.Infof("total: %d, end: %d, pre: %d, height: %d", totalblocks, endTimeV1, targetTimePerBlock, int64(height))
 		if int64(height) >= totalblocks {
 			return 0, ErrDifficultyOverflow
@@ -1104,11 +1568,11 @@ func (bc *BlockChain) calcNextRequiredBitsByHeight(height uint64) (uint32, error
 
 	if height < uint64(totalblocksv2+totalblocksv3) {
 		// V3
-		targetTimespan = targetTimespanPreV4
+		targetTimespan = params.TargetTimespanPreV4
 		blocksPerRetarget = uint64(targetTimespan / targetTimePerBlock)
 	} else if height < uint64(totalblocksv2+totalblocksv3+totalblocksv4) {
 		// V4
-		targetTimespan = targetTimespanV4
+		targetTimespan = params.TargetTimespanV4
 		blocksPerRetarget = uint64(targetTimespan / targetTimePerBlock)
 	}
 
@@ -1124,6 +1588,7 @@ func (bc *BlockChain) calcNextRequiredBitsByHeight(height uint64) (uint32, error
 	//logrus.Infof("need aaa")
 	firstTime := first.Timestamp
 	lastTime := lastHeader.Timestamp
+	adjustmentFactor := bc.ChainConfig().RetargetAdjustment()
 	minRetargetTimespan := targetTimespan / adjustmentFactor
 	maxRetargetTimespan := targetTimespan * adjustmentFactor
 	actualTimespan := int64(lastTime - firstTime)
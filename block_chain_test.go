@@ -0,0 +1,689 @@
+package xfsgo
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/common/rawencode"
+	"xfsgo/crypto"
+	"xfsgo/params"
+	"xfsgo/test"
+)
+
+// newTestChain opens a chain on the test genesis block in new test dbs.
+func newTestChain(t *testing.T) (*BlockChain, *Block) {
+	stateDb, chainDb := newTestStateDB(t), newTestStateDB(t)
+	genesis, err := WriteTestGenesisBlock(test.TestGenesisBits, stateDb, chainDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, newTestStateDB(t), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc, genesis
+}
+
+func TestBlockChain_CalcPastMedianTime(t *testing.T) {
+	bc, _ := newTestChain(t)
+	genesis := bc.GetHead().Header
+	assert.Equal(t, bc.CalcPastMedianTime(genesis), genesis.Timestamp)
+	assert.Equal(t, bc.MinimumTimestamp(genesis), genesis.Timestamp+1)
+	assert.Equal(t, bc.CalcPastMedianTime(nil), uint64(0))
+}
+
+func TestBlockChain_checkBlockHeaderSanity_medianTimeFork(t *testing.T) {
+	bc, _ := newTestChain(t)
+	genesis := bc.GetHead().Header
+	header := &BlockHeader{
+		Height:    1,
+		Timestamp: genesis.Timestamp,
+		GasLimit:  genesis.GasLimit,
+		GasUsed:   common.Big0,
+		Bits:      genesis.Bits,
+	}
+	config := *bc.ChainConfig()
+	config.Forks = map[string]uint64{ForkMedianTime: 2}
+	bc.config = &config
+	// the timestamps of the blocks before the fork are not checked
+	err := bc.checkBlockHeaderSanity(genesis, header, common.Hash{})
+	assert.Equal(t, err != ErrTimeTooOld, true)
+	header.Height = 2
+	assert.Equal(t, bc.checkBlockHeaderSanity(genesis, header, common.Hash{}), ErrTimeTooOld)
+}
+
+func TestBlockChain_checkBlockHeaderSanity_headerChecksFork(t *testing.T) {
+	bc, _ := newTestChain(t)
+	genesis := bc.GetHead().Header
+	header := &BlockHeader{
+		Height:    1,
+		Version:   versionReservedMask,
+		Timestamp: genesis.Timestamp + 1,
+		GasLimit:  genesis.GasLimit,
+		GasUsed:   common.Big0,
+		Bits:      genesis.Bits,
+		ExtraData: []byte("tag\n"),
+	}
+	config := *bc.ChainConfig()
+	config.Forks = map[string]uint64{ForkHeaderChecks: 2}
+	bc.config = &config
+	// the version of the blocks before the fork is not checked, they have no extra data
+	assert.Equal(t, bc.checkBlockHeaderSanity(genesis, header, common.Hash{}), ErrExtraDataBeforeFork)
+	header.ExtraData = nil
+	err := bc.checkBlockHeaderSanity(genesis, header, common.Hash{})
+	assert.Equal(t, err != ErrInvalidBlockVersion && err != ErrExtraDataBeforeFork, true)
+	header.Height = 2
+	header.ExtraData = []byte("tag\n")
+	assert.Equal(t, bc.checkBlockHeaderSanity(genesis, header, common.Hash{}), ErrInvalidBlockVersion)
+	header.Version = 0
+	assert.Equal(t, bc.checkBlockHeaderSanity(genesis, header, common.Hash{}), ErrInvalidExtraData)
+}
+
+func TestBlockChain_checkBlockHeaderSanity_rewardSplitFork(t *testing.T) {
+	bc, _ := newTestChain(t)
+	genesis := bc.GetHead().Header
+	header := &BlockHeader{
+		Height:      1,
+		Timestamp:   genesis.Timestamp + 1,
+		GasLimit:    genesis.GasLimit,
+		GasUsed:     common.Big0,
+		Bits:        genesis.Bits,
+		RewardSplit: []RewardShare{{Address: common.Address{1}, Percent: 0}},
+	}
+	config := *bc.ChainConfig()
+	config.Forks = map[string]uint64{ForkRewardSplit: 2}
+	bc.config = &config
+	assert.Equal(t, bc.checkBlockHeaderSanity(genesis, header, common.Hash{}), ErrRewardSplitBeforeFork)
+	header.Height = 2
+	assert.Equal(t, bc.checkBlockHeaderSanity(genesis, header, common.Hash{}), ErrInvalidRewardSplit)
+}
+
+func TestBlockChain_checkBlockHeaderSanity_gasLimitFork(t *testing.T) {
+	bc, _ := newTestChain(t)
+	genesis := bc.GetHead().Header
+	header := &BlockHeader{
+		Height:    1,
+		Timestamp: genesis.Timestamp + 1,
+		GasLimit:  new(big.Int).Mul(genesis.GasLimit, big.NewInt(2)),
+		GasUsed:   common.Big0,
+		Bits:      genesis.Bits,
+	}
+	config := *bc.ChainConfig()
+	config.Forks = map[string]uint64{ForkGasLimitBounds: 2}
+	bc.config = &config
+	// the gas limit of the blocks before the fork is not bounded by the parent
+	assert.Equal(t, bc.checkBlockHeaderSanity(genesis, header, common.Hash{}) != ErrInvalidGasLimit, true)
+	header.Height = 2
+	assert.Equal(t, bc.checkBlockHeaderSanity(genesis, header, common.Hash{}), ErrInvalidGasLimit)
+}
+
+func TestVerifyExtraData(t *testing.T) {
+	assert.Equal(t, VerifyExtraData(nil), nil)
+	assert.Equal(t, VerifyExtraData([]byte("pool/xfs")), nil)
+	assert.Equal(t, VerifyExtraData(make([]byte, MaxExtraDataSize+1)), ErrExtraDataTooLarge)
+	assert.Equal(t, VerifyExtraData([]byte{0xff, 0xfe}), ErrInvalidExtraData)
+	assert.Equal(t, VerifyExtraData([]byte("tag\n")), ErrInvalidExtraData)
+}
+
+func TestVerifyRewardSplit(t *testing.T) {
+	assert.Equal(t, VerifyRewardSplit(nil), nil)
+	assert.Equal(t, VerifyRewardSplit([]RewardShare{{Address: common.Address{1}, Percent: 60}, {Address: common.Address{2}, Percent: 40}}), nil)
+	assert.Equal(t, VerifyRewardSplit([]RewardShare{{Address: common.Address{1}, Percent: 0}}), ErrInvalidRewardSplit)
+	assert.Equal(t, VerifyRewardSplit([]RewardShare{{Address: common.Address{1}, Percent: 60}, {Address: common.Address{2}, Percent: 41}}), ErrInvalidRewardSplit)
+	assert.Equal(t, VerifyRewardSplit([]RewardShare{{Address: common.Address{1}, Percent: 10}, {Address: common.Address{1}, Percent: 10}}), ErrInvalidRewardSplit)
+	split := make([]RewardShare, MaxRewardShares+1)
+	for i := range split {
+		split[i] = RewardShare{Address: common.Address{byte(i)}, Percent: 1}
+	}
+	assert.Equal(t, VerifyRewardSplit(split), ErrTooManyRewardShares)
+}
+
+func TestAccumulateRewards_rewardSplit(t *testing.T) {
+	coinbase, operator, owner := common.Address{1}, common.Address{2}, common.Address{3}
+	header := &BlockHeader{Height: 1, Coinbase: coinbase, GasLimit: common.MinGasLimit, GasUsed: common.Big0}
+	// headers without a reward split are encoded as before
+	data, err := header.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, strings.Contains(string(data), "reward_split"), false)
+
+	header.RewardSplit = []RewardShare{{Address: operator, Percent: 3}, {Address: owner, Percent: 90}}
+	st := NewStateTree(newTestStateDB(t), nil)
+	AccumulateRewards(MainNetChainConfig, st, header)
+	subsidy := MainNetChainConfig.BlockReward(header.Height)
+	percent := func(n int64) *big.Int {
+		v := new(big.Int).Mul(subsidy, big.NewInt(n))
+		return v.Div(v, big.NewInt(100))
+	}
+	rest := new(big.Int).Sub(subsidy, percent(3))
+	rest.Sub(rest, percent(90))
+	assert.BigIntEqual(t, st.GetBalance(operator), percent(3))
+	assert.BigIntEqual(t, st.GetBalance(owner), percent(90))
+	assert.BigIntEqual(t, st.GetBalance(coinbase), rest)
+}
+
+func TestBlockHeader_DecodeTrailingFields(t *testing.T) {
+	header := &BlockHeader{Version: 1, GasLimit: common.MinGasLimit, GasUsed: common.Big0}
+	data, err := header.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data[:len(data)-1], []byte(`,"base_fee":"10"}`)...)
+	got := new(BlockHeader)
+	if err = got.Decode(data); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := got.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(encoded), string(data))
+
+	header.Version = HeaderEncodingVersion
+	data, _ = header.Encode()
+	data = append(data[:len(data)-1], []byte(`,"base_fee":"10"}`)...)
+	if err = new(BlockHeader).Decode(data); err != rawencode.ErrUnknownField {
+		t.Fatalf("want err %v, got %v", rawencode.ErrUnknownField, err)
+	}
+	if err = json.Unmarshal(data, new(BlockHeader)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// FuzzBlockHeader_Decode checks a decoded header encodes to a fixed point, so the
+// hash of a header doesn't depend on the encoding it was received with.
+func FuzzBlockHeader_Decode(f *testing.F) {
+	header := &BlockHeader{Version: HeaderEncodingVersion, GasLimit: common.MinGasLimit, GasUsed: common.Big0}
+	data, _ := header.Encode()
+	f.Add(data)
+	f.Add([]byte(`{"version":1,"base_fee":"10"}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		first := new(BlockHeader)
+		if err := first.Decode(data); err != nil {
+			return
+		}
+		encoded, err := first.Encode()
+		if err != nil {
+			return
+		}
+		second := new(BlockHeader)
+		if err = second.Decode(encoded); err != nil {
+			t.Fatalf("re-decode %s: %v", encoded, err)
+		}
+		reencoded, err := second.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(reencoded), string(encoded))
+	})
+}
+
+// FuzzTransaction_Decode checks a decoded transaction encodes to a fixed point.
+func FuzzTransaction_Decode(f *testing.F) {
+	tx := NewTransaction(common.Address{}, common.MinGasLimit, common.Big0, common.Big0)
+	data, _ := tx.Encode()
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		first := new(Transaction)
+		if err := first.Decode(data); err != nil {
+			return
+		}
+		encoded, err := first.Encode()
+		if err != nil {
+			return
+		}
+		second := new(Transaction)
+		if err = second.Decode(encoded); err != nil {
+			t.Fatalf("re-decode %s: %v", encoded, err)
+		}
+		reencoded, err := second.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(reencoded), string(encoded))
+	})
+}
+
+func TestBlockChain_CommittedState(t *testing.T) {
+	bc, _ := newTestChain(t)
+	addr := common.Address{1}
+	// changes of the in-flight state are not visible until committed
+	bc.CurrentStateTree().AddNonce(addr, 3)
+	assert.Equal(t, bc.GetNonce(addr), uint64(0))
+	assert.Equal(t, bc.CurrentStateTree().GetNonce(addr), uint64(3))
+}
+
+func TestBlockChain_GetBlockRootsByNumber(t *testing.T) {
+	bc, genesis := newTestChain(t)
+	want := &BlockRoots{StateRoot: genesis.StateRoot(), ReceiptsRoot: genesis.ReceiptsRoot()}
+	assert.Equal(t, bc.chainDB.GetBlockRootsByHeight(0), want)
+	assert.Equal(t, bc.GetBlockRootsByNumber(0), want)
+	if bc.GetBlockRootsByNumber(1) != nil {
+		t.Fatal("want no roots of unknown block")
+	}
+	// blocks written before the index existed are indexed on first lookup
+	var numBuf [8]byte
+	_ = bc.chainDB.storage.DelData(append(blockRootsPre, numBuf[:]...))
+	assert.Equal(t, bc.chainDB.GetBlockRootsByHeight(0) == nil, true)
+	assert.Equal(t, bc.GetBlockRootsByNumber(0), want)
+	assert.Equal(t, bc.chainDB.GetBlockRootsByHeight(0), want)
+}
+
+func TestBlockChain_IsCanonical(t *testing.T) {
+	bc, genesis := newTestChain(t)
+	old, replaced := *genesis.Header, *genesis.Header
+	old.Height, replaced.Height = 1, 1
+	old.Nonce, replaced.Nonce = 1, 2
+	if err := bc.WriteBHeader2ChainDBWithHash(&old); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.WriteBHeader2Chain(&old); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, bc.IsCanonical(old.HeaderHash()), true)
+	if err := bc.WriteBHeader2ChainDBWithHash(&replaced); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.WriteBHeader2Chain(&replaced); err != nil {
+		t.Fatal(err)
+	}
+	// the replaced block is still found by its hash
+	if bc.GetBlockByHash(old.HeaderHash()) == nil {
+		t.Fatal("want replaced block")
+	}
+	assert.Equal(t, bc.IsCanonical(old.HeaderHash()), false)
+	assert.Equal(t, bc.IsCanonical(replaced.HeaderHash()), true)
+	hash, exists := bc.GetCanonicalHash(1)
+	assert.Equal(t, exists, true)
+	assert.Equal(t, hash, replaced.HeaderHash())
+	if _, exists = bc.GetCanonicalHash(2); exists {
+		t.Fatal("want no canonical hash above the head")
+	}
+}
+
+func TestBlockChain_GetRandomness(t *testing.T) {
+	bc, genesis := newTestChain(t)
+	parent := genesis.Header
+	for h := uint64(1); h <= params.RandomnessBlocks+2; h++ {
+		header := *genesis.Header
+		header.Height = h
+		header.HashPrevBlock = parent.HeaderHash()
+		if err := bc.WriteBHeader2ChainDBWithHash(&header); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.WriteBHeader2Chain(&header); err != nil {
+			t.Fatal(err)
+		}
+		parent = &header
+	}
+	if _, exists := bc.GetRandomness(0); exists {
+		t.Fatal("want no randomness of the genesis")
+	}
+	first, exists := bc.GetRandomness(1)
+	assert.Equal(t, exists, true)
+	genesisHash := genesis.HeaderHash()
+	assert.HashEqual(t, first, common.Bytes2Hash(ahash.SHA256(genesisHash[:])))
+	// the randomness of the block mixes the headers up to its parent
+	next := &BlockHeader{Height: parent.Height + 1, HashPrevBlock: parent.HeaderHash()}
+	randomness, exists := bc.GetRandomness(next.Height)
+	assert.Equal(t, exists, true)
+	assert.HashEqual(t, bc.BlockContext(next).Randomness, randomness)
+	prev, _ := bc.GetRandomness(parent.Height)
+	if randomness == prev || randomness == first {
+		t.Fatal("want randomness changing with the head")
+	}
+	if _, exists = bc.GetRandomness(next.Height + 1); exists {
+		t.Fatal("want no randomness above the next block")
+	}
+}
+
+func TestBlockChain_ProveAncestor(t *testing.T) {
+	bc, genesis := newTestChain(t)
+	writeChain := func(from, to uint64, nonce uint32) {
+		// headers are written from the highest like a reorg does
+		for h := to; h >= from; h-- {
+			header := *genesis.Header
+			header.Height = h
+			header.Nonce = nonce
+			if err := bc.WriteBHeader2Chain(&header); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeChain(1, 9, 1)
+	head, err := bc.GetHeaderCommitment(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := bc.ProveAncestor(3, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, proof.Head, head)
+	if err = VerifyAncestorProof(head.Root, proof); err != nil {
+		t.Fatal(err)
+	}
+	genesisProof, err := bc.ProveAncestor(0, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, genesisProof.Hash, genesis.HeaderHash())
+	if err = VerifyAncestorProof(head.Root, genesisProof); err != nil {
+		t.Fatal(err)
+	}
+	oldProof, err := bc.ProveAncestor(7, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChain(5, 9, 2)
+	newHead, err := bc.GetHeaderCommitment(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newHead.Root == head.Root {
+		t.Fatal("want new commitment of replaced headers")
+	}
+	if err = VerifyAncestorProof(newHead.Root, oldProof); err != ErrNotAncestor {
+		t.Fatalf("want ErrNotAncestor of replaced block, got %v", err)
+	}
+	newProof, err := bc.ProveAncestor(7, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyAncestorProof(newHead.Root, newProof); err != nil {
+		t.Fatal(err)
+	}
+	// the headers below the replaced ones keep their proofs
+	if proof, err = bc.ProveAncestor(3, 4); err != nil {
+		t.Fatal(err)
+	}
+	prefix, err := bc.GetHeaderCommitment(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyAncestorProof(prefix.Root, proof); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.ProveAncestor(10, 9); err != ErrNotAncestor {
+		t.Fatalf("want ErrNotAncestor, got %v", err)
+	}
+}
+
+func TestBlockChain_Syncing(t *testing.T) {
+	bc, _ := newTestChain(t)
+	_ = bc.SetBoundaries(0, 40)
+	// boundaries left by a finished synchronisation do not mark the node as behind
+	assert.Equal(t, bc.Syncing() == nil, true)
+	bc.SetSyncing(true)
+	progress := bc.Syncing()
+	if progress == nil {
+		t.Fatal("want sync progress")
+	}
+	assert.Equal(t, *progress, SyncProgress{Origin: 0, Current: 0, Highest: 40})
+	assert.Equal(t, progress.Percent(), float64(0))
+	bc.SetSyncing(false)
+	assert.Equal(t, bc.Syncing() == nil, true)
+}
+
+func TestApplyTransaction_dataSize(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	st := NewStateTree(newTestStateDB(t), nil)
+	st.AddBalance(crypto.DefaultPubKey2Addr(key.PublicKey), common.NanoCoin2Atto(big.NewInt(1000000)))
+	tx := NewTransactionByStd(&StdTransaction{
+		To:       common.Address{0x01},
+		GasPrice: big.NewInt(10),
+		GasLimit: big.NewInt(1000000),
+		Value:    new(big.Int),
+		Data:     make([]byte, DefaultMaxTxDataSize+1),
+	})
+	_ = tx.SignWithPrivateKey(key)
+	config := &ChainConfig{Forks: map[string]uint64{ForkTxSizeLimits: 2}}
+	// the size limits only invalidate the transactions of blocks from the fork on
+	gp := (*GasPool)(big.NewInt(1000000))
+	_, err := ApplyTransaction(config, common.Hash{}, st, &BlockHeader{Height: 1}, tx, gp, new(big.Int))
+	assert.Equal(t, err != ErrTxDataTooLarge, true)
+	gp = (*GasPool)(big.NewInt(1000000))
+	_, err = ApplyTransaction(config, common.Hash{}, st, &BlockHeader{Height: 2}, tx, gp, new(big.Int))
+	assert.Equal(t, err, ErrTxDataTooLarge)
+}
+
+func TestApplyTransaction_accountExtraFork(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	config := &ChainConfig{Forks: map[string]uint64{ForkAccountExtra: 2}}
+	st := NewStateTree(newTestStateDB(t), nil)
+	st.AddBalance(addr, common.NanoCoin2Atto(big.NewInt(1000000)))
+	for nonce, height := range []uint64{1, 2} {
+		tx := NewTransactionByStd(&StdTransaction{
+			To:       addr,
+			GasPrice: big.NewInt(10),
+			GasLimit: big.NewInt(1000000),
+			Value:    new(big.Int),
+			Data:     []byte("extra"),
+			Nonce:    uint64(nonce),
+		})
+		_ = tx.SignWithPrivateKey(key)
+		gp := (*GasPool)(big.NewInt(1000000))
+		if _, err := ApplyTransaction(config, common.Hash{}, st, &BlockHeader{Height: height}, tx, gp, new(big.Int)); err != nil {
+			t.Fatal(err)
+		}
+		// a transaction to the sender is a transfer before the fork
+		if height < 2 {
+			assert.Equal(t, len(st.GetExtra(addr)), 0)
+		}
+	}
+	assert.BytesEqual(t, st.GetExtra(addr), []byte("extra"))
+}
+
+func TestApplyTransaction_contractCallFork(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	addr, contract := crypto.DefaultPubKey2Addr(key.PublicKey), common.Address{0x01}
+	config := &ChainConfig{Forks: map[string]uint64{ForkContractCall: 2}}
+	st := NewStateTree(newTestStateDB(t), nil)
+	st.AddBalance(addr, common.NanoCoin2Atto(big.NewInt(1000000)))
+	// xvm code of no contract, calling it fails
+	st.SetCode(contract, []byte{0xd0, 0x23, 0x00})
+	var receipts []*Receipt
+	for nonce, height := range []uint64{1, 2} {
+		tx := NewTransactionByStd(&StdTransaction{
+			To:       contract,
+			GasPrice: big.NewInt(10),
+			GasLimit: big.NewInt(1000000),
+			Value:    big.NewInt(1),
+			Data:     []byte("call"),
+			Nonce:    uint64(nonce),
+		})
+		_ = tx.SignWithPrivateKey(key)
+		gp := (*GasPool)(big.NewInt(1000000))
+		receipt, err := ApplyTransaction(config, common.Hash{}, st, &BlockHeader{Height: height}, tx, gp, new(big.Int))
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	// the transaction before the fork is a transfer, the one after it a failed call
+	assert.Equal(t, receipts[0].Status, uint32(1))
+	assert.Equal(t, receipts[1].Status, uint32(0))
+	assert.BigIntEqual(t, st.GetBalance(contract), big.NewInt(1))
+}
+
+func TestApplyTransaction_receiptVMErrorFork(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	config := &ChainConfig{Forks: map[string]uint64{ForkReceiptVMError: 2}}
+	st := NewStateTree(newTestStateDB(t), nil)
+	st.AddBalance(addr, common.NanoCoin2Atto(big.NewInt(1000000)))
+	var receipts []*Receipt
+	for nonce, height := range []uint64{1, 2} {
+		// xvm code of no contract, creating it fails
+		tx := NewTransactionByStd(&StdTransaction{
+			GasPrice: big.NewInt(10),
+			GasLimit: big.NewInt(1000000),
+			Data:     []byte{0xd0, 0x23, 0x00},
+			Nonce:    uint64(nonce),
+		})
+		_ = tx.SignWithPrivateKey(key)
+		gp := (*GasPool)(big.NewInt(1000000))
+		receipt, err := ApplyTransaction(config, common.Hash{}, st, &BlockHeader{Height: height}, tx, gp, new(big.Int))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, receipt.Status, uint32(0))
+		receipts = append(receipts, receipt)
+	}
+	// the receipts only carry the error code from the fork on
+	assert.Equal(t, receipts[0].VMError, uint32(0))
+	assert.Equal(t, receipts[1].VMError != 0, true)
+}
+
+func TestApplyTransaction_accessList(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	st := NewStateTree(newTestStateDB(t), nil)
+	st.AddBalance(addr, common.NanoCoin2Atto(big.NewInt(1000000)))
+	st.AddAddressToAccessList(common.Address{0x09})
+	tx := NewTransactionByStd(&StdTransaction{
+		GasPrice: big.NewInt(10),
+		GasLimit: big.NewInt(1000000),
+		Data:     []byte("hello, world"),
+	})
+	_ = tx.SignWithPrivateKey(key)
+	gp := (*GasPool)(big.NewInt(1000000))
+	if _, err := ApplyTransaction(MainNetChainConfig, common.Hash{}, st, &BlockHeader{}, tx, gp, new(big.Int)); err != nil {
+		t.Fatal(err)
+	}
+	// the list of the transaction holds its sender and the contract it created
+	assert.Equal(t, st.AddressInAccessList(common.Address{0x09}), false)
+	assert.Equal(t, st.AddressInAccessList(addr), true)
+	assert.Equal(t, st.AddressInAccessList(crypto.CreateAddress(addr.Hash(), 0)), true)
+}
+
+func TestChainConfig_MessageKind(t *testing.T) {
+	from, contract := common.Address{0x01}, common.Address{0x02}
+	config := &ChainConfig{Forks: map[string]uint64{ForkAccountExtra: 2, ForkContractCall: 2}}
+	st := NewStateTree(newTestStateDB(t), nil)
+	st.SetCode(contract, []byte{0xd0, 0x23, 0x00})
+	tests := []struct {
+		to     common.Address
+		data   []byte
+		height uint64
+		want   MessageKind
+	}{
+		{common.ZeroAddr, []byte("code"), 1, MessageCreate},
+		{from, []byte("extra"), 1, MessageTransfer},
+		{from, []byte("extra"), 2, MessageSetExtra},
+		{from, nil, 2, MessageTransfer},
+		{contract, []byte("call"), 1, MessageTransfer},
+		{contract, []byte("call"), 2, MessageCall},
+		{contract, nil, 2, MessageTransfer},
+	}
+	for i, tt := range tests {
+		if got := config.MessageKind(st, from, tt.to, tt.data, tt.height); got != tt.want {
+			t.Fatalf("%d: got kind %d, want %d", i, got, tt.want)
+		}
+	}
+}
+
+func TestApplyTransaction_negativeValueFork(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	addr, to := crypto.DefaultPubKey2Addr(key.PublicKey), common.Address{0x01}
+	config := &ChainConfig{Forks: map[string]uint64{ForkNegativeValue: 2}}
+	st := NewStateTree(newTestStateDB(t), nil)
+	st.AddBalance(addr, common.NanoCoin2Atto(big.NewInt(1000000)))
+	st.AddBalance(to, big.NewInt(10))
+	apply := func(nonce, height uint64) (*Receipt, error) {
+		tx := NewTransactionByStd(&StdTransaction{
+			To:       to,
+			GasPrice: big.NewInt(10),
+			GasLimit: big.NewInt(1000000),
+			Value:    big.NewInt(-5),
+			Nonce:    nonce,
+		})
+		_ = tx.SignWithPrivateKey(key)
+		gp := (*GasPool)(big.NewInt(1000000))
+		return ApplyTransaction(config, common.Hash{}, st, &BlockHeader{Height: height}, tx, gp, new(big.Int))
+	}
+	// the transfer of a negative value is a no-op before the fork
+	receipt, err := apply(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, receipt.Status, uint32(1))
+	assert.BigIntEqual(t, st.GetBalance(to), big.NewInt(10))
+	_, err = apply(1, 2)
+	assert.Equal(t, err, ErrNegativeAmount)
+}
+
+func TestBlockChain_configPerChain(t *testing.T) {
+	defer func() {
+		GenesisSchedule = nil
+		GenesisConfig = nil
+	}()
+	open := func(genesis string) *BlockChain {
+		stateDb, chainDb := newTestStateDB(t), newTestStateDB(t)
+		if _, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(genesis)); err != nil {
+			t.Fatal(err)
+		}
+		bc, err := NewBlockChainN(stateDb, chainDb, newTestStateDB(t), NewEventBus(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bc
+	}
+	a := open(`{"bits": 4278190109, "schedule": {"period": 5}, "config": {"reward": {"initial_reward": 500}}}`)
+	b := open(`{"bits": 534773790}`)
+	// the chain opened first keeps the genesis it was opened with
+	assert.BigIntEqual(t, a.GetBlockReward(1), big.NewInt(500))
+	assert.Equal(t, a.Schedule(), &BlockSchedule{Period: 5})
+	assert.Equal(t, a.CalcDifficultyByBits(4278190109), float64(1))
+	assert.BigIntEqual(t, b.GetBlockReward(1), MainNetChainConfig.BlockReward(1))
+	assert.Equal(t, b.Schedule() == nil, true)
+	assert.Equal(t, b.CalcDifficultyByBits(534773790), float64(1))
+}
+
+func TestChainConfig_BuiltinVersions(t *testing.T) {
+	config := &ChainConfig{
+		Reward: &RewardSchedule{InitialReward: big.NewInt(1)},
+		BuiltinUpgrades: []*BuiltinUpgrade{
+			{Id: 0x01, Version: 2, Height: 20},
+			{Id: 0x01, Version: 1, Height: 10},
+			{Id: 0x02, Version: 1, Height: 15},
+		},
+	}
+	if config.BuiltinVersions(9) != nil {
+		t.Fatal("want no upgrades before the first height")
+	}
+	assert.Equal(t, config.BuiltinVersions(10), map[uint8]uint8{0x01: 1})
+	assert.Equal(t, config.BuiltinVersions(20), map[uint8]uint8{0x01: 2, 0x02: 1})
+	assert.Equal(t, config.ForkHeights(), []uint64{10, 15, 20})
+	// upgrades to versions not registered with the vm are refused
+	if err := config.Verify(); err != ErrInvalidBuiltinUpgrade {
+		t.Fatalf("got err %v, want %v", err, ErrInvalidBuiltinUpgrade)
+	}
+}
+
+func TestNewBlockContext(t *testing.T) {
+	header := &BlockHeader{Height: 42, Timestamp: 1600000000, Coinbase: common.Address{0x07}}
+	ctx := NewBlockContext(header)
+	assert.Equal(t, ctx.Height, uint64(42))
+	assert.Equal(t, ctx.Timestamp, uint64(1600000000))
+	assert.AddressEq(t, ctx.Coinbase, header.Coinbase)
+}
+
+func TestBlockChain_BlockContextRandomness(t *testing.T) {
+	header := &BlockHeader{Height: 42}
+	// the state transition run without a chain is given the randomness of the block
+	bc := &BlockChain{config: MainNetChainConfig, randomness: common.Hash{0x05}}
+	assert.HashEqual(t, bc.BlockContext(header).Randomness, common.Hash{0x05})
+}
+
+func TestBlockChain_BlockContextVMFixes(t *testing.T) {
+	bc := &BlockChain{config: &ChainConfig{Forks: map[string]uint64{ForkVMFixes: 2}}}
+	assert.Equal(t, bc.BlockContext(&BlockHeader{Height: 1}).Legacy, true)
+	assert.Equal(t, bc.BlockContext(&BlockHeader{Height: 2}).Legacy, false)
+}
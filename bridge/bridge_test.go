@@ -0,0 +1,265 @@
+package bridge
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+// testBits is an easy target passed by about half of the header hashes.
+const testBits = uint32(0x7fffff20)
+
+func newTestPoWVerifier(t *testing.T) Verifier {
+	config, _ := json.Marshal(&PoWConfig{MaxBits: testBits})
+	v, err := NewVerifier(PoWVerifier, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// mineHeader returns a child of the parent passing the proof of work of testBits.
+func mineHeader(parent *Header, root common.Hash) *Header {
+	h := &Header{
+		Height:        parent.Height + 1,
+		ParentHash:    parent.Hash(),
+		TransfersRoot: root,
+		Timestamp:     parent.Timestamp + 1,
+		Bits:          testBits,
+	}
+	target := BitsToTarget(testBits)
+	for {
+		hash := h.Hash()
+		if new(big.Int).SetBytes(hash[:]).Cmp(target) <= 0 {
+			return h
+		}
+		h.Nonce++
+	}
+}
+
+func TestPoWVerifier(t *testing.T) {
+	v := newTestPoWVerifier(t)
+	genesis := &Header{Bits: testBits}
+	header := mineHeader(genesis, common.Hash{})
+	if err := VerifyChild(v, genesis, header); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChild(v, header, genesis); err != ErrInvalidHeader {
+		t.Fatalf("want ErrInvalidHeader, got %v", err)
+	}
+	// find a nonce failing the proof of work
+	for {
+		header.Nonce++
+		if err := VerifyChild(v, genesis, header); err != nil {
+			if err != ErrInsufficientWork {
+				t.Fatalf("want ErrInsufficientWork, got %v", err)
+			}
+			break
+		}
+	}
+	easier := mineHeader(genesis, common.Hash{})
+	easier.Bits = 0x7fffff21
+	if err := VerifyChild(v, genesis, easier); err != ErrInsufficientWork {
+		t.Fatalf("want ErrInsufficientWork of target above max, got %v", err)
+	}
+}
+
+func TestPoSVerifier(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	validators := make([]string, 3)
+	for i := range keys {
+		key, err := crypto.GenPrvKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+		validators[i] = addr.B58String()
+	}
+	config, _ := json.Marshal(&PoSConfig{Validators: validators, Threshold: 2})
+	v, err := NewVerifier(PoSVerifier, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := &Header{}
+	header := &Header{Height: 1, ParentHash: genesis.Hash()}
+	sign := func(key *ecdsa.PrivateKey) {
+		hash := header.Hash()
+		sig, err := crypto.ECDSASign(hash[:], key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header.Signatures = append(header.Signatures, sig)
+	}
+	sign(keys[0])
+	// a signature counts once per validator
+	sign(keys[0])
+	if err = VerifyChild(v, genesis, header); err != ErrNotEnoughSigners {
+		t.Fatalf("want ErrNotEnoughSigners, got %v", err)
+	}
+	outsider, _ := crypto.GenPrvKey()
+	sign(outsider)
+	if err = VerifyChild(v, genesis, header); err != ErrNotEnoughSigners {
+		t.Fatalf("want ErrNotEnoughSigners, got %v", err)
+	}
+	sign(keys[2])
+	if err = VerifyChild(v, genesis, header); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewVerifier(PoSVerifier, []byte(`{"validators":[],"threshold":1}`)); err != ErrInvalidConfig {
+		t.Fatalf("want ErrInvalidConfig, got %v", err)
+	}
+	if _, err = NewVerifier("unknown", nil); err != ErrUnknownVerifier {
+		t.Fatalf("want ErrUnknownVerifier, got %v", err)
+	}
+}
+
+func testTransfers(n int) []*Transfer {
+	transfers := make([]*Transfer, n)
+	for i := range transfers {
+		transfers[i] = &Transfer{
+			ID:        common.Hash{byte(i), 0x01},
+			Recipient: common.Address{byte(i)},
+			Amount:    big.NewInt(int64(i + 1)),
+		}
+	}
+	return transfers
+}
+
+func TestProveTransfer(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		transfers := testTransfers(n)
+		root := TransfersRoot(transfers)
+		for i := 0; i < n; i++ {
+			proof, err := ProveTransfer(common.Hash{}, transfers, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := proof.Encode()
+			if proof, err = DecodeTransferProof(data); err != nil {
+				t.Fatal(err)
+			}
+			if err = proof.Verify(root); err != nil {
+				t.Fatalf("transfer %d of %d: %v", i, n, err)
+			}
+			proof.Transfer.Amount = big.NewInt(100)
+			if err = proof.Verify(root); err != ErrInvalidTransferProof {
+				t.Fatalf("want ErrInvalidTransferProof of changed amount, got %v", err)
+			}
+		}
+	}
+	if _, err := DecodeTransferProof([]byte(`{"transfer":{"amount":0}}`)); err != ErrInvalidTransferProof {
+		t.Fatalf("want ErrInvalidTransferProof of zero amount, got %v", err)
+	}
+}
+
+type testChain struct {
+	headers []*Header
+}
+
+func (c *testChain) HeadHeight() (uint64, error) {
+	return uint64(len(c.headers) - 1), nil
+}
+
+func (c *testChain) HeaderByHeight(height uint64) (*Header, error) {
+	if height >= uint64(len(c.headers)) {
+		return nil, errors.New("unknown height")
+	}
+	return c.headers[height], nil
+}
+
+// testSink keeps the submitted headers like the bridge contract does.
+type testSink struct {
+	t         *testing.T
+	verifier  Verifier
+	headers   map[common.Hash]*Header
+	canonical map[uint64]common.Hash
+	head      *Header
+}
+
+func newTestSink(t *testing.T, genesis *Header) *testSink {
+	s := &testSink{
+		t:         t,
+		verifier:  newTestPoWVerifier(t),
+		headers:   make(map[common.Hash]*Header),
+		canonical: make(map[uint64]common.Hash),
+	}
+	s.headers[genesis.Hash()] = genesis
+	s.canonical[0] = genesis.Hash()
+	s.head = genesis
+	return s
+}
+
+func (s *testSink) HeadHeight() (uint64, error) {
+	return s.head.Height, nil
+}
+
+func (s *testSink) CanonicalHash(height uint64) (common.Hash, error) {
+	return s.canonical[height], nil
+}
+
+func (s *testSink) HasHeader(hash common.Hash) (bool, error) {
+	_, ok := s.headers[hash]
+	return ok, nil
+}
+
+func (s *testSink) SubmitHeader(header *Header) error {
+	if err := VerifyChild(s.verifier, s.headers[header.ParentHash], header); err != nil {
+		return err
+	}
+	s.headers[header.Hash()] = header
+	if header.Height > s.head.Height {
+		s.head = header
+		for h := header; h != nil && s.canonical[h.Height] != h.Hash(); h = s.headers[h.ParentHash] {
+			s.canonical[h.Height] = h.Hash()
+		}
+	}
+	return nil
+}
+
+func extendChain(headers []*Header, n int, salt byte) []*Header {
+	for i := 0; i < n; i++ {
+		headers = append(headers, mineHeader(headers[len(headers)-1], common.Hash{salt}))
+	}
+	return headers
+}
+
+func TestRelay_Sync(t *testing.T) {
+	genesis := &Header{Bits: testBits}
+	chain := &testChain{headers: extendChain([]*Header{genesis}, 5, 0)}
+	sink := newTestSink(t, genesis)
+	relay := NewRelay(chain, sink, 3)
+	n, err := relay.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || sink.head.Height != 3 {
+		t.Fatalf("want 3 headers relayed, got %d", n)
+	}
+	if _, err = relay.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if sink.head != chain.headers[5] {
+		t.Fatal("want bridge head at foreign head")
+	}
+	// the foreign chain reorgs to a longer fork from height 2
+	fork := extendChain(append([]*Header{}, chain.headers[:3]...), 5, 1)
+	chain.headers = fork
+	for i := 0; i < 3; i++ {
+		if _, err = relay.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sink.head != fork[7] {
+		t.Fatalf("want bridge head at fork head, got %d", sink.head.Height)
+	}
+	for h, header := range fork {
+		if sink.canonical[uint64(h)] != header.Hash() {
+			t.Fatalf("want fork header %d on bridge main chain", h)
+		}
+	}
+}
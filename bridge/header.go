@@ -0,0 +1,120 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+// Package bridge implements a light client of a foreign chain. Headers of the foreign
+// chain are checked by a verifier of its consensus, transfers are proven against the
+// transfers root of a confirmed header.
+package bridge
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+var (
+	ErrUnknownVerifier = errors.New("unknown header verifier")
+	ErrInvalidHeader   = errors.New("invalid foreign header")
+	ErrUnknownParent   = errors.New("unknown parent of foreign header")
+)
+
+// Header is the header of a foreign chain block as submitted to the bridge. TransfersRoot
+// is the merkle root of the transfers to xfs the block contains.
+type Header struct {
+	Height        uint64      `json:"height"`
+	ParentHash    common.Hash `json:"parent_hash"`
+	TransfersRoot common.Hash `json:"transfers_root"`
+	Timestamp     uint64      `json:"timestamp"`
+	// Bits and Nonce are the proof of work of the header.
+	Bits  uint32 `json:"bits,omitempty"`
+	Nonce uint64 `json:"nonce,omitempty"`
+	// Signatures are the signatures of the validators over the header hash.
+	Signatures [][]byte `json:"signatures,omitempty"`
+}
+
+// Hash returns the hash of the header, the signatures are not part of it.
+func (h *Header) Hash() common.Hash {
+	buf := make([]byte, 0, 8+32+32+8+4+8)
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], h.Height)
+	buf = append(buf, numBuf[:]...)
+	buf = append(buf, h.ParentHash[:]...)
+	buf = append(buf, h.TransfersRoot[:]...)
+	binary.BigEndian.PutUint64(numBuf[:], h.Timestamp)
+	buf = append(buf, numBuf[:]...)
+	binary.BigEndian.PutUint32(numBuf[:4], h.Bits)
+	buf = append(buf, numBuf[:4]...)
+	binary.BigEndian.PutUint64(numBuf[:], h.Nonce)
+	buf = append(buf, numBuf[:]...)
+	return common.Bytes2Hash(ahash.SHA256(buf))
+}
+
+func (h *Header) Encode() ([]byte, error) {
+	return json.Marshal(h)
+}
+
+func DecodeHeader(data []byte) (*Header, error) {
+	h := new(Header)
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Verifier checks a header follows the consensus rules of the foreign chain.
+type Verifier interface {
+	// VerifyHeader checks the header extending the parent.
+	VerifyHeader(parent, header *Header) error
+}
+
+// NewVerifierFn constructs a verifier from its JSON config.
+type NewVerifierFn func(config []byte) (Verifier, error)
+
+var verifiers = map[string]NewVerifierFn{
+	PoWVerifier: newPoWVerifier,
+	PoSVerifier: newPoSVerifier,
+}
+
+// RegisterVerifier adds a verifier of another consensus. It must be called before any
+// bridge is used, registering an existing name replaces the verifier.
+func RegisterVerifier(name string, fn NewVerifierFn) {
+	verifiers[name] = fn
+}
+
+// NewVerifier returns the verifier with the given name configured by config.
+func NewVerifier(name string, config []byte) (Verifier, error) {
+	fn, exists := verifiers[name]
+	if !exists {
+		return nil, ErrUnknownVerifier
+	}
+	return fn(config)
+}
+
+// VerifyChild checks the header is the child of the parent and passes the verifier.
+func VerifyChild(v Verifier, parent, header *Header) error {
+	if parent == nil {
+		return ErrUnknownParent
+	}
+	if header.Height != parent.Height+1 || header.ParentHash != parent.Hash() {
+		return ErrInvalidHeader
+	}
+	if header.Timestamp < parent.Timestamp {
+		return ErrInvalidHeader
+	}
+	return v.VerifyHeader(parent, header)
+}
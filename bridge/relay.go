@@ -0,0 +1,142 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package bridge
+
+import (
+	"time"
+	"xfsgo/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultRelayBatch is the maximum number of headers a relay submits in one sync.
+const defaultRelayBatch = 64
+
+// Source reads the main chain headers of the foreign chain.
+type Source interface {
+	HeadHeight() (uint64, error)
+	HeaderByHeight(height uint64) (*Header, error)
+}
+
+// Sink is the bridge contract headers are relayed to.
+type Sink interface {
+	HeadHeight() (uint64, error)
+	// CanonicalHash returns the hash of the header with the height on the main chain
+	// of the bridge.
+	CanonicalHash(height uint64) (common.Hash, error)
+	// HasHeader returns whether the header was submitted, on the main chain or a fork.
+	HasHeader(hash common.Hash) (bool, error)
+	SubmitHeader(header *Header) error
+}
+
+// Relay submits the headers of the foreign chain to the bridge.
+type Relay struct {
+	source   Source
+	sink     Sink
+	maxBatch int
+}
+
+// NewRelay returns a relay submitting at most maxBatch headers per sync, the default
+// batch is used when maxBatch is 0.
+func NewRelay(source Source, sink Sink, maxBatch int) *Relay {
+	if maxBatch <= 0 {
+		maxBatch = defaultRelayBatch
+	}
+	return &Relay{
+		source:   source,
+		sink:     sink,
+		maxBatch: maxBatch,
+	}
+}
+
+// forkPoint returns the height of the highest header the bridge shares with the main
+// chain of the foreign chain, looking back at most maxBatch headers from the bridge head.
+func (r *Relay) forkPoint(head uint64) (uint64, error) {
+	height := head
+	for i := 0; i < r.maxBatch; i++ {
+		have, err := r.sink.CanonicalHash(height)
+		if err != nil {
+			return 0, err
+		}
+		header, err := r.source.HeaderByHeight(height)
+		if err != nil {
+			return 0, err
+		}
+		if header.Hash() == have || height == 0 {
+			return height, nil
+		}
+		height--
+	}
+	return height, nil
+}
+
+// Sync submits the foreign headers above the bridge head, it returns the number of
+// submitted headers. A fork of the bridge from the foreign main chain is replaced by
+// submitting the main chain headers from the fork point.
+func (r *Relay) Sync() (int, error) {
+	head, err := r.sink.HeadHeight()
+	if err != nil {
+		return 0, err
+	}
+	foreignHead, err := r.source.HeadHeight()
+	if err != nil {
+		return 0, err
+	}
+	from := head
+	if foreignHead < head {
+		from = foreignHead
+	}
+	if from, err = r.forkPoint(from); err != nil {
+		return 0, err
+	}
+	submitted := 0
+	for height := from + 1; height <= foreignHead && submitted < r.maxBatch; height++ {
+		header, err := r.source.HeaderByHeight(height)
+		if err != nil {
+			return submitted, err
+		}
+		// the headers of a fork longer than a batch are already known on the next sync
+		if known, err := r.sink.HasHeader(header.Hash()); err != nil {
+			return submitted, err
+		} else if known {
+			continue
+		}
+		if err = r.sink.SubmitHeader(header); err != nil {
+			return submitted, err
+		}
+		submitted++
+	}
+	return submitted, nil
+}
+
+// Run syncs the bridge every interval until quit is closed.
+func (r *Relay) Run(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := r.Sync(); err != nil {
+			logrus.Warnf("Failed to relay foreign headers: %s", err)
+		} else if n > 0 {
+			logrus.Infof("Relayed foreign headers: count=%d", n)
+		}
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+const (
+	leafPrefix = byte(0x00)
+	nodePrefix = byte(0x01)
+)
+
+var ErrInvalidTransferProof = errors.New("invalid transfer proof")
+
+// Transfer is a transfer from the foreign chain to an xfs address, ID identifies it
+// on the foreign chain so it is paid out once.
+type Transfer struct {
+	ID        common.Hash    `json:"id"`
+	Recipient common.Address `json:"recipient"`
+	Amount    *big.Int       `json:"amount"`
+}
+
+// Hash returns the leaf hash of the transfer in the transfers tree.
+func (t *Transfer) Hash() common.Hash {
+	var amount [32]byte
+	if t.Amount != nil {
+		t.Amount.FillBytes(amount[:])
+	}
+	buf := make([]byte, 0, 1+32+len(t.Recipient)+32)
+	buf = append(buf, leafPrefix)
+	buf = append(buf, t.ID[:]...)
+	buf = append(buf, t.Recipient[:]...)
+	buf = append(buf, amount[:]...)
+	return common.Bytes2Hash(ahash.SHA256(buf))
+}
+
+// TransferProof proves a transfer is included in the block with the header hash.
+type TransferProof struct {
+	Header   common.Hash   `json:"header"`
+	Transfer *Transfer     `json:"transfer"`
+	Index    uint64        `json:"index"`
+	Count    uint64        `json:"count"`
+	Siblings []common.Hash `json:"siblings"`
+}
+
+func (p *TransferProof) Encode() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func DecodeTransferProof(data []byte) (*TransferProof, error) {
+	p := new(TransferProof)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if p.Transfer == nil {
+		return nil, ErrInvalidTransferProof
+	}
+	if amount := p.Transfer.Amount; amount == nil || amount.Sign() <= 0 || amount.BitLen() > 256 {
+		return nil, ErrInvalidTransferProof
+	}
+	return p, nil
+}
+
+func hashNode(left, right common.Hash) common.Hash {
+	buf := make([]byte, 0, 65)
+	buf = append(buf, nodePrefix)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+	return common.Bytes2Hash(ahash.SHA256(buf))
+}
+
+// nextLevel hashes the nodes of a tree level in pairs, an odd last node is moved up
+// unchanged.
+func nextLevel(nodes []common.Hash) []common.Hash {
+	next := make([]common.Hash, 0, (len(nodes)+1)/2)
+	for i := 0; i < len(nodes); i += 2 {
+		if i+1 == len(nodes) {
+			next = append(next, nodes[i])
+			continue
+		}
+		next = append(next, hashNode(nodes[i], nodes[i+1]))
+	}
+	return next
+}
+
+// TransfersRoot returns the merkle root of the transfers of a block.
+func TransfersRoot(transfers []*Transfer) common.Hash {
+	if len(transfers) == 0 {
+		return common.Hash{}
+	}
+	nodes := make([]common.Hash, len(transfers))
+	for i, t := range transfers {
+		nodes[i] = t.Hash()
+	}
+	for len(nodes) > 1 {
+		nodes = nextLevel(nodes)
+	}
+	return nodes[0]
+}
+
+// ProveTransfer returns the proof of the transfer with the index in the transfers of the
+// block with the header hash.
+func ProveTransfer(header common.Hash, transfers []*Transfer, index int) (*TransferProof, error) {
+	if index < 0 || index >= len(transfers) {
+		return nil, ErrInvalidTransferProof
+	}
+	p := &TransferProof{
+		Header:   header,
+		Transfer: transfers[index],
+		Index:    uint64(index),
+		Count:    uint64(len(transfers)),
+		Siblings: make([]common.Hash, 0),
+	}
+	nodes := make([]common.Hash, len(transfers))
+	for i, t := range transfers {
+		nodes[i] = t.Hash()
+	}
+	for i := index; len(nodes) > 1; i /= 2 {
+		if sibling := i ^ 1; sibling < len(nodes) {
+			p.Siblings = append(p.Siblings, nodes[sibling])
+		}
+		nodes = nextLevel(nodes)
+	}
+	return p, nil
+}
+
+// Verify checks the transfer of the proof is included in the tree with the root.
+func (p *TransferProof) Verify(root common.Hash) error {
+	if p.Transfer == nil || p.Index >= p.Count {
+		return ErrInvalidTransferProof
+	}
+	hash := p.Transfer.Hash()
+	siblings := p.Siblings
+	for i, n := p.Index, p.Count; n > 1; i, n = i/2, (n+1)/2 {
+		if i^1 >= n {
+			// the last node of an odd level has no sibling
+			continue
+		}
+		if len(siblings) == 0 {
+			return ErrInvalidTransferProof
+		}
+		if i&1 == 0 {
+			hash = hashNode(hash, siblings[0])
+		} else {
+			hash = hashNode(siblings[0], hash)
+		}
+		siblings = siblings[1:]
+	}
+	if len(siblings) != 0 || hash != root {
+		return ErrInvalidTransferProof
+	}
+	return nil
+}
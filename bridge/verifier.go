@@ -0,0 +1,147 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+const (
+	PoWVerifier = "pow"
+	PoSVerifier = "pos"
+)
+
+var (
+	ErrInsufficientWork = errors.New("insufficient proof of work")
+	ErrNotEnoughSigners = errors.New("not enough validator signatures")
+	ErrInvalidConfig    = errors.New("invalid verifier config")
+)
+
+// PoWConfig configures the verifier of a proof of work chain. The target of a header
+// given by its bits can't be above the target of MaxBits, and may change by at most
+// a factor of MaxAdjust from the parent.
+type PoWConfig struct {
+	MaxBits   uint32 `json:"max_bits"`
+	MaxAdjust uint64 `json:"max_adjust"`
+}
+
+type powVerifier struct {
+	maxTarget *big.Int
+	maxAdjust *big.Int
+}
+
+func newPoWVerifier(config []byte) (Verifier, error) {
+	c := new(PoWConfig)
+	if err := json.Unmarshal(config, c); err != nil {
+		return nil, err
+	}
+	if c.MaxBits == 0 {
+		return nil, ErrInvalidConfig
+	}
+	if c.MaxAdjust == 0 {
+		c.MaxAdjust = 4
+	}
+	return &powVerifier{
+		maxTarget: BitsToTarget(c.MaxBits),
+		maxAdjust: new(big.Int).SetUint64(c.MaxAdjust),
+	}, nil
+}
+
+// BitsToTarget returns the target of compact bits, encoded like the bits of xfs blocks.
+func BitsToTarget(bits uint32) *big.Int {
+	mantissa := (bits & 0xffffff00) >> 8
+	e := uint(bits & 0xff)
+	if e <= 3 {
+		return big.NewInt(int64(mantissa >> (8 * (3 - e))))
+	}
+	return new(big.Int).Lsh(big.NewInt(int64(mantissa)), 8*(e-3))
+}
+
+func (v *powVerifier) VerifyHeader(parent, header *Header) error {
+	target := BitsToTarget(header.Bits)
+	if target.Sign() <= 0 || target.Cmp(v.maxTarget) > 0 {
+		return ErrInsufficientWork
+	}
+	parentTarget := BitsToTarget(parent.Bits)
+	if parentTarget.Sign() > 0 {
+		if target.Cmp(new(big.Int).Mul(parentTarget, v.maxAdjust)) > 0 ||
+			new(big.Int).Mul(target, v.maxAdjust).Cmp(parentTarget) < 0 {
+			return ErrInsufficientWork
+		}
+	}
+	hash := header.Hash()
+	if new(big.Int).SetBytes(hash[:]).Cmp(target) > 0 {
+		return ErrInsufficientWork
+	}
+	return nil
+}
+
+// PoSConfig configures the verifier of a chain finalized by a fixed set of validators,
+// a header needs the signatures of Threshold validators.
+type PoSConfig struct {
+	Validators []string `json:"validators"`
+	Threshold  int      `json:"threshold"`
+}
+
+type posVerifier struct {
+	validators map[common.Address]struct{}
+	threshold  int
+}
+
+func newPoSVerifier(config []byte) (Verifier, error) {
+	c := new(PoSConfig)
+	if err := json.Unmarshal(config, c); err != nil {
+		return nil, err
+	}
+	v := &posVerifier{
+		validators: make(map[common.Address]struct{}),
+		threshold:  c.Threshold,
+	}
+	for _, addr := range c.Validators {
+		if err := common.AddrCalibrator(addr); err != nil {
+			return nil, err
+		}
+		v.validators[common.StrB58ToAddress(addr)] = struct{}{}
+	}
+	if v.threshold <= 0 || v.threshold > len(v.validators) {
+		return nil, ErrInvalidConfig
+	}
+	return v, nil
+}
+
+func (v *posVerifier) VerifyHeader(_, header *Header) error {
+	hash := header.Hash()
+	signers := make(map[common.Address]struct{})
+	for _, sig := range header.Signatures {
+		pub, err := crypto.SigToPub(hash[:], sig)
+		if err != nil {
+			continue
+		}
+		addr := crypto.DefaultPubKey2Addr(*pub)
+		if _, exists := v.validators[addr]; exists {
+			signers[addr] = struct{}{}
+		}
+	}
+	if len(signers) < v.threshold {
+		return ErrNotEnoughSigners
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+	"xfsgo/common"
+	"xfsgo/params"
+	"xfsgo/vm"
+)
+
+var (
+	ErrInvalidRewardSchedule = errors.New("invalid reward schedule")
+	ErrTxDataTooLarge        = errors.New("transaction data too large")
+	ErrCodeTooLarge          = errors.New("contract code too large")
+	ErrInvalidBuiltinUpgrade = errors.New("invalid builtin contract upgrade")
+)
+
+const (
+	// DefaultMaxTxDataSize is the maximum size of the data of a transaction of chains
+	// without a limit in their config.
+	DefaultMaxTxDataSize = params.MaxTxDataSize
+	// DefaultMaxCodeSize is the maximum size of the code of a contract of chains
+	// without a limit in their config.
+	DefaultMaxCodeSize = params.MaxCodeSize
+	// ForkCodeStore is the fork from which the updated account records hold the hash of
+	// the contract code, which is kept in the code store, instead of the code.
+	ForkCodeStore = "code_store"
+	// ForkDeleteEmptyAccounts is the fork from which the accounts left empty by a
+	// transaction or a block are deleted from the state.
+	ForkDeleteEmptyAccounts = "delete_empty_accounts"
+	// ForkMedianTime is the fork from which block timestamps must be after the median
+	// time past and not too far in the future.
+	ForkMedianTime = "median_time"
+	// ForkHeaderChecks is the fork from which the reserved bits of the header version
+	// must be zero and the header extra data must be printable text.
+	ForkHeaderChecks = "header_checks"
+	// ForkAccountExtra is the fork from which a transaction sent by an account to itself
+	// with data sets the extra data of the account instead of transferring the value.
+	ForkAccountExtra = "account_extra"
+	// ForkContractCall is the fork from which a transaction with data to a contract calls
+	// the contract instead of transferring the value.
+	ForkContractCall = "contract_call"
+	// ForkNegativeValue is the fork from which a transaction transferring a negative value
+	// is invalid, such a transfer left the balances unchanged before.
+	ForkNegativeValue = "negative_value"
+	// ForkReceiptVMError is the fork from which the receipts of failed contract executions
+	// carry the vm error code, which is part of the receipts root.
+	ForkReceiptVMError = "receipt_vm_error"
+	// ForkVMFixes is the fork from which the builtin contracts decode their arguments
+	// exactly, and a contract creation fails on an address with a nonce or code and
+	// reverts its state when it fails.
+	ForkVMFixes = "vm_fixes"
+	// ForkTxSizeLimits is the fork from which the transactions of blocks are checked
+	// against the data and code size limits, the pool always checks them.
+	ForkTxSizeLimits = "tx_size_limits"
+	// ForkRewardSplit is the fork from which block headers may pay shares of the block
+	// reward to other addresses than the coinbase.
+	ForkRewardSplit = "reward_split"
+	// ForkGasLimitBounds is the fork from which the gas limit of a block may only move
+	// by 1/1024 of the gas limit of its parent and bounds the gas used.
+	ForkGasLimitBounds = "gas_limit_bounds"
+)
+
+var (
+	// MainNetChainConfig is the chain config of networks without one in the genesis.
+	MainNetChainConfig = &ChainConfig{
+		Reward: &RewardSchedule{
+			InitialReward:    params.MainNetInitialReward,
+			Interval:         params.RewardInterval,
+			ReductionPercent: params.RewardReductionPercent,
+		},
+	}
+	// TestNetChainConfig is the chain config of the test network, which pays a constant subsidy.
+	TestNetChainConfig = &ChainConfig{
+		Reward: &RewardSchedule{
+			InitialReward: params.TestNetReward,
+		},
+	}
+	// GenesisConfig is the chain config set by the genesis, the config of the
+	// network selected by GenesisBits is used if it is nil.
+	GenesisConfig *ChainConfig
+)
+
+// ChainConfig contains the consensus parameters of a chain set by its genesis.
+type ChainConfig struct {
+	Reward *RewardSchedule `json:"reward"`
+	// Forks holds the activation heights of the rule changes of the chain by name.
+	Forks map[string]uint64 `json:"forks,omitempty"`
+	// MaxTxDataSize and MaxCodeSize override the default size limits when they are set.
+	MaxTxDataSize uint64 `json:"max_tx_data_size,omitempty"`
+	MaxCodeSize   uint64 `json:"max_code_size,omitempty"`
+	// MaxTimeOffset, MedianTimeBlocks and RetargetFactor override the timestamp and
+	// difficulty parameters of the params package when they are set.
+	MaxTimeOffset    int64 `json:"max_time_offset,omitempty"`
+	MedianTimeBlocks int   `json:"median_time_blocks,omitempty"`
+	RetargetFactor   int64 `json:"retarget_factor,omitempty"`
+	// BuiltinUpgrades switch builtin contracts to new versions of their implementation.
+	BuiltinUpgrades []*BuiltinUpgrade `json:"builtin_upgrades,omitempty"`
+	// StorageRent enables the experimental rent of the contract storage.
+	StorageRent *StorageRent `json:"storage_rent,omitempty"`
+}
+
+// BuiltinUpgrade switches the builtin contracts with the id to the version of their
+// implementation from the block at the height on, keeping their storage. The version
+// must be registered with vm.RegisterBuiltinUpgrade. The bridge (0x02), oracle (0x03),
+// anchor (0x04), escrow (0x05) and subscription (0x06) contracts are activated by the
+// upgrade to their version 1.
+type BuiltinUpgrade struct {
+	Id      uint8  `json:"id"`
+	Version uint8  `json:"version"`
+	Height  uint64 `json:"height"`
+}
+
+// RewardSchedule configures the block subsidy, which starts at InitialReward and
+// is reduced by ReductionPercent every Interval blocks. A reduction of 50 percent
+// halves the subsidy, a zero Interval keeps it constant.
+type RewardSchedule struct {
+	InitialReward    *big.Int `json:"initial_reward"`
+	Interval         uint64   `json:"interval"`
+	ReductionPercent uint32   `json:"reduction_percent"`
+	// MinReward is the tail emission the subsidy is never reduced below.
+	MinReward *big.Int `json:"min_reward,omitempty"`
+}
+
+// Verify checks that the config is complete and the reward schedule is valid.
+func (c *ChainConfig) Verify() error {
+	if c.Reward == nil {
+		return ErrInvalidRewardSchedule
+	}
+	for _, upgrade := range c.BuiltinUpgrades {
+		if upgrade == nil || upgrade.Version == 0 || !vm.HasBuiltinVersion(upgrade.Id, upgrade.Version) {
+			return ErrInvalidBuiltinUpgrade
+		}
+	}
+	if c.StorageRent != nil {
+		if err := c.StorageRent.Verify(); err != nil {
+			return err
+		}
+	}
+	return c.Reward.Verify()
+}
+
+// BuiltinVersions returns the versions of the builtin contracts upgraded at the height,
+// an upgrade replaces those of the same builtin activated at lower heights.
+func (c *ChainConfig) BuiltinVersions(height uint64) map[uint8]uint8 {
+	var versions map[uint8]uint8
+	activated := make(map[uint8]uint64)
+	for _, upgrade := range c.BuiltinUpgrades {
+		if upgrade == nil || upgrade.Height > height {
+			continue
+		}
+		if at, exists := activated[upgrade.Id]; exists && at > upgrade.Height {
+			continue
+		}
+		if versions == nil {
+			versions = make(map[uint8]uint8)
+		}
+		activated[upgrade.Id] = upgrade.Height
+		versions[upgrade.Id] = upgrade.Version
+	}
+	return versions
+}
+
+// TxDataLimit returns the maximum size of the data of a transaction.
+func (c *ChainConfig) TxDataLimit() uint64 {
+	if c.MaxTxDataSize > 0 {
+		return c.MaxTxDataSize
+	}
+	return DefaultMaxTxDataSize
+}
+
+// CodeSizeLimit returns the maximum size of the code of a contract.
+func (c *ChainConfig) CodeSizeLimit() uint64 {
+	if c.MaxCodeSize > 0 {
+		return c.MaxCodeSize
+	}
+	return DefaultMaxCodeSize
+}
+
+// TimeOffsetLimit returns how far in the future a block timestamp may be, in seconds.
+func (c *ChainConfig) TimeOffsetLimit() int64 {
+	if c.MaxTimeOffset > 0 {
+		return c.MaxTimeOffset
+	}
+	return params.MaxTimeOffset
+}
+
+// MedianTimeSpan returns the number of blocks the median time past is calculated from.
+func (c *ChainConfig) MedianTimeSpan() int {
+	if c.MedianTimeBlocks > 0 {
+		return c.MedianTimeBlocks
+	}
+	return params.MedianTimeBlocks
+}
+
+// RetargetAdjustment returns the factor bounding the timespan of a retarget period.
+func (c *ChainConfig) RetargetAdjustment() int64 {
+	if c.RetargetFactor > 0 {
+		return c.RetargetFactor
+	}
+	return params.RetargetAdjustmentFactor
+}
+
+// VerifyTxSize checks the data of the transaction against the size limits. The code a
+// contract creation deploys is never larger than the data of its transaction, which is
+// checked against the code size limit.
+func (c *ChainConfig) VerifyTxSize(tx *Transaction) error {
+	size := uint64(len(tx.Data))
+	if size > c.TxDataLimit() {
+		return ErrTxDataTooLarge
+	}
+	if TxToAddrNotSet(tx) && size > c.CodeSizeLimit() {
+		return ErrCodeTooLarge
+	}
+	return nil
+}
+
+// ForkHeights returns the distinct activation heights of the forks, of the builtin
+// contract upgrades and of the storage rent in ascending order, those active from the
+// genesis are left out.
+func (c *ChainConfig) ForkHeights() []uint64 {
+	seen := make(map[uint64]struct{})
+	heights := make([]uint64, 0, len(c.Forks)+len(c.BuiltinUpgrades))
+	add := func(height uint64) {
+		if _, exists := seen[height]; exists || height == 0 {
+			return
+		}
+		seen[height] = struct{}{}
+		heights = append(heights, height)
+	}
+	for _, height := range c.Forks {
+		add(height)
+	}
+	for _, upgrade := range c.BuiltinUpgrades {
+		if upgrade != nil {
+			add(upgrade.Height)
+		}
+	}
+	if c.StorageRent != nil {
+		add(c.StorageRent.Height)
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] < heights[j]
+	})
+	return heights
+}
+
+// IsForkActive reports whether the fork with the name is active at the height.
+func (c *ChainConfig) IsForkActive(name string, height uint64) bool {
+	activation, exists := c.Forks[name]
+	return exists && height >= activation
+}
+
+// TxSetsExtra reports whether the transaction of the sender sets its extra data in the
+// block at the height, which is only the case from the ForkAccountExtra fork on.
+func (c *ChainConfig) TxSetsExtra(tx *Transaction, from common.Address, height uint64) bool {
+	return c.IsForkActive(ForkAccountExtra, height) && TxSetsExtra(tx, from)
+}
+
+// MessageKind returns the state transition run by a message of the sender to the receiver
+// with the data in the block at the height, by the forks active at the height.
+func (c *ChainConfig) MessageKind(stateTree *StateTree, from, to common.Address, data []byte, height uint64) MessageKind {
+	switch {
+	case bytes.Equal(to[:], common.ZeroAddr[:]):
+		return MessageCreate
+	case c.IsForkActive(ForkAccountExtra, height) && setsExtra(from, to, data):
+		return MessageSetExtra
+	case c.IsForkActive(ForkContractCall, height) && len(data) > 0 && stateTree.GetCodeSize(to) > 0:
+		return MessageCall
+	}
+	return MessageTransfer
+}
+
+// BlockReward returns the block subsidy paid at the height.
+func (c *ChainConfig) BlockReward(height uint64) *big.Int {
+	return c.Reward.BlockReward(height)
+}
+
+// Verify checks that the initial reward is set and the reduction is a percentage.
+func (s *RewardSchedule) Verify() error {
+	if s.InitialReward == nil || s.InitialReward.Sign() < 0 {
+		return ErrInvalidRewardSchedule
+	}
+	if s.Interval > 0 && (s.ReductionPercent < 1 || s.ReductionPercent > 100) {
+		return ErrInvalidRewardSchedule
+	}
+	if s.MinReward != nil && (s.MinReward.Sign() < 0 || s.MinReward.Cmp(s.InitialReward) > 0) {
+		return ErrInvalidRewardSchedule
+	}
+	return nil
+}
+
+// BlockReward returns the subsidy of the block at the height.
+func (s *RewardSchedule) BlockReward(height uint64) *big.Int {
+	reward := new(big.Int).Set(s.InitialReward)
+	if s.Interval > 0 {
+		reductions := height / s.Interval
+		if s.ReductionPercent == 50 {
+			if reductions > uint64(reward.BitLen()) {
+				reductions = uint64(reward.BitLen())
+			}
+			reward.Rsh(reward, uint(reductions))
+		} else {
+			keep := big.NewInt(int64(100 - s.ReductionPercent))
+			for i := uint64(0); i < reductions && reward.Sign() > 0; i++ {
+				reward.Mul(reward, keep)
+				reward.Div(reward, common.Big100)
+			}
+		}
+	}
+	if s.MinReward != nil && reward.Cmp(s.MinReward) < 0 {
+		reward.Set(s.MinReward)
+	}
+	return reward
+}
+
+// genesisChainConfig returns the config of a genesis, the config of the network selected
+// by the genesis bits is used if the genesis sets none.
+func genesisChainConfig(config *ChainConfig, bits uint32) *ChainConfig {
+	if config != nil {
+		return config
+	}
+	if bits == TestNetGenesisBits {
+		return TestNetChainConfig
+	}
+	return MainNetChainConfig
+}
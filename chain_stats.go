@@ -0,0 +1,139 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"xfsgo/common"
+)
+
+// MaxStatsRange is the maximum number of blocks GetStats computes statistics over.
+const MaxStatsRange = 10000
+
+var ErrInvalidStatsRange = errors.New("invalid block range")
+
+// ChainStats holds statistics computed over a range of blocks of the main chain.
+type ChainStats struct {
+	From         uint64
+	To           uint64
+	Blocks       uint64
+	TxCount      uint64
+	AvgBlockTime float64
+	TxPerSecond  float64
+	AvgGasUsed   *big.Int
+	// difficulty of the first and the last block and the average over the range
+	StartDifficulty float64
+	EndDifficulty   float64
+	AvgDifficulty   float64
+	// HashRate is the network hash rate estimated from the work done over the range
+	HashRate common.HashRate
+}
+
+// GetStats computes statistics of the main chain blocks with a height from from to to inclusive.
+func (bc *BlockChain) GetStats(from, to uint64) (*ChainStats, error) {
+	if from > to || to-from >= MaxStatsRange {
+		return nil, ErrInvalidStatsRange
+	}
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if to > bc.currentBHeader.Height {
+		return nil, ErrInvalidStatsRange
+	}
+	stats := &ChainStats{
+		From:       from,
+		To:         to,
+		AvgGasUsed: new(big.Int),
+	}
+	var (
+		first, last   *BlockHeader
+		difficultySum float64
+		work          = new(big.Int)
+	)
+	for height := from; height <= to; height++ {
+		header := bc.chainDB.GetBlockHeaderByHeight(height)
+		if header == nil {
+			return nil, ErrInvalidStatsRange
+		}
+		if first == nil {
+			first = header
+		}
+		last = header
+		stats.Blocks += 1
+		txs := bc.extraDB.GetBlockTransactionsByBHash(header.HeaderHash())
+		stats.TxCount += uint64(len(txs))
+		if header.GasUsed != nil {
+			stats.AvgGasUsed.Add(stats.AvgGasUsed, header.GasUsed)
+		}
+		difficultySum += bc.CalcDifficultyByBits(header.Bits)
+		if header != first {
+			work.Add(work, bc.CalcWorkloadByBits(header.Bits))
+		}
+	}
+	stats.AvgGasUsed.Div(stats.AvgGasUsed, new(big.Int).SetUint64(stats.Blocks))
+	stats.StartDifficulty = bc.CalcDifficultyByBits(first.Bits)
+	stats.EndDifficulty = bc.CalcDifficultyByBits(last.Bits)
+	stats.AvgDifficulty = difficultySum / float64(stats.Blocks)
+	if last.Timestamp > first.Timestamp && stats.Blocks > 1 {
+		elapsed := float64(last.Timestamp - first.Timestamp)
+		stats.AvgBlockTime = elapsed / float64(stats.Blocks-1)
+		stats.TxPerSecond = float64(stats.TxCount) / elapsed
+		stats.HashRate = calcHashRate(first, last, work)
+	}
+	return stats, nil
+}
+
+// calcHashRate estimates the hash rate from the work of the blocks mined after first up to last.
+func calcHashRate(first, last *BlockHeader, work *big.Int) common.HashRate {
+	if last.Timestamp <= first.Timestamp {
+		return 0
+	}
+	elapsed := float64(last.Timestamp - first.Timestamp)
+	workf, _ := new(big.Float).SetInt(work).Float64()
+	return common.HashRate(workf / elapsed)
+}
+
+// NetworkHashRate estimates the network hash rate from the difficulty bits and timestamps
+// of the latest window blocks of the main chain.
+func (bc *BlockChain) NetworkHashRate(window uint64) common.HashRate {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	last := bc.currentBHeader
+	if window < 2 || last.Height == 0 {
+		return 0
+	}
+	if window > MaxStatsRange {
+		window = MaxStatsRange
+	}
+	if window > last.Height+1 {
+		window = last.Height + 1
+	}
+	work := new(big.Int)
+	first := last
+	for height := last.Height; height > last.Height+1-window; height-- {
+		header := bc.chainDB.GetBlockHeaderByHeight(height)
+		if header == nil {
+			return 0
+		}
+		work.Add(work, bc.CalcWorkloadByBits(header.Bits))
+		first = bc.chainDB.GetBlockHeaderByHeight(height - 1)
+		if first == nil {
+			return 0
+		}
+	}
+	return calcHashRate(first, last, work)
+}
@@ -0,0 +1,33 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/test"
+)
+
+func TestBlockChain_GetStats(t *testing.T) {
+	bc, _ := newTestChain(t)
+	stats, err := bc.GetStats(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, stats.Blocks, uint64(1))
+	assert.Equal(t, stats.TxCount, uint64(0))
+	assert.Equal(t, stats.StartDifficulty, CalcDifficultyByBits(test.TestGenesisBits, test.TestGenesisBits))
+	if _, err = bc.GetStats(0, 1); err != ErrInvalidStatsRange {
+		t.Fatalf("want err %v, got %v", ErrInvalidStatsRange, err)
+	}
+	if _, err = bc.GetStats(1, 0); err != ErrInvalidStatsRange {
+		t.Fatalf("want err %v, got %v", ErrInvalidStatsRange, err)
+	}
+}
+
+func TestCalcHashRate(t *testing.T) {
+	first := &BlockHeader{Timestamp: 100}
+	last := &BlockHeader{Timestamp: 110}
+	assert.Equal(t, calcHashRate(first, last, big.NewInt(1000)), common.HashRate(100))
+	assert.Equal(t, calcHashRate(last, first, big.NewInt(1000)), common.HashRate(0))
+}
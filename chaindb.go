@@ -30,9 +30,18 @@ var (
 	blockHashPre       = []byte("bh:")
 	blockHeightPre     = []byte("bn:")
 	blockHeightHashPre = []byte("bnh:")
+	blockRootsPre      = []byte("br:")
 	lastBlockKey       = []byte("LastBlock")
 )
 
+const blockRootsLen = 2 * len(common.Hash{})
+
+// BlockRoots holds the state root and receipts root of a main chain block.
+type BlockRoots struct {
+	StateRoot    common.Hash
+	ReceiptsRoot common.Hash
+}
+
 type chainDB struct {
 	storage badger.IStorage
 	debug   bool
@@ -62,15 +71,39 @@ func (db *chainDB) GetBlockHeaderByHash(hash common.Hash) *BlockHeader {
 
 // Get blockHeader from height
 func (db *chainDB) GetBlockHeaderByHeight(height uint64) *BlockHeader {
+	hash, exists := db.GetBlockHashByHeight(height)
+	if !exists {
+		return nil
+	}
+	return db.GetBlockHeaderByHash(hash)
+}
+
+// GetBlockHashByHeight returns the hash of the main chain block with the given height.
+func (db *chainDB) GetBlockHashByHeight(height uint64) (common.Hash, bool) {
 	var numBuf [8]byte
 	binary.LittleEndian.PutUint64(numBuf[:], height)
 	key := append(blockHeightPre, numBuf[:]...)
 	val, err := db.storage.GetData(key)
 	if err != nil {
+		return common.Hash{}, false
+	}
+	return common.Bytes2Hash(val), true
+}
+
+// GetBlockRootsByHeight returns the roots of the main chain block with the given height
+// from the root index, without decoding the block header.
+func (db *chainDB) GetBlockRootsByHeight(height uint64) *BlockRoots {
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], height)
+	key := append(blockRootsPre, numBuf[:]...)
+	val, err := db.storage.GetData(key)
+	if err != nil || len(val) != blockRootsLen {
 		return nil
 	}
-	hash := common.Bytes2Hash(val)
-	return db.GetBlockHeaderByHash(hash)
+	return &BlockRoots{
+		StateRoot:    common.Bytes2Hash(val[:blockRootsLen/2]),
+		ReceiptsRoot: common.Bytes2Hash(val[blockRootsLen/2:]),
+	}
 }
 
 // Get Current Optimum height's BlockHeader
@@ -109,6 +142,27 @@ func (db *chainDB) GetBlocksByNumber(num uint64) []*BlockHeader {
 	return blks
 }
 
+// GetBlockHeadersByHeight returns the headers of the main and the side chain blocks at
+// the height.
+func (db *chainDB) GetBlockHeadersByHeight(height uint64) ([]*BlockHeader, error) {
+	var heightbytes = make([]byte, 8)
+	binary.BigEndian.PutUint64(heightbytes, height)
+	prefix := append(append([]byte{}, blockHeightHashPre...), heightbytes...)
+	headers := make([]*BlockHeader, 0)
+	err := db.storage.PrefixForeachData(prefix, func(_ []byte, v []byte) error {
+		header := &BlockHeader{}
+		if err := rawencode.Decode(v, header); err != nil {
+			return err
+		}
+		headers = append(headers, header)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
 // Write BlockHeader links Hash to chainDB
 func (db *chainDB) WriteBHeaderWithHash(blockHeader *BlockHeader) error {
 	hash := blockHeader.HeaderHash()
@@ -139,6 +193,22 @@ func (db *chainDB) WriteBHeaderHashWithHeight(height uint64, headerHash common.H
 	return nil
 }
 
+// WriteBlockRootsWithHeight write the roots of BlockHeader links height to chainDB
+func (db *chainDB) WriteBlockRootsWithHeight(blockHeader *BlockHeader) error {
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], blockHeader.Height)
+	key := append(blockRootsPre, numBuf[:]...)
+	// br:<height_64bits> -> <state_root><receipts_root>
+	val := make([]byte, 0, blockRootsLen)
+	val = append(val, blockHeader.StateRoot.Bytes()...)
+	val = append(val, blockHeader.ReceiptsRoot.Bytes()...)
+	if err := db.storage.SetData(key, val); err != nil {
+		logrus.Errorf("Write block roots with number err: %s", err)
+		return err
+	}
+	return nil
+}
+
 // Write BlockHeader links height and hash to chainDB
 func (db *chainDB) WriteBHeaderWithHeightAndHash(blockHeader *BlockHeader) error {
 	height := blockHeader.Height
@@ -175,6 +245,14 @@ func (db *chainDB) WriteBHeader2Chain(blockHeader *BlockHeader) error {
 		return err
 	}
 
+	if err := db.WriteBlockRootsWithHeight(blockHeader); err != nil {
+		return err
+	}
+
+	if err := db.truncateHeaderMMR(blockHeader.Height); err != nil {
+		return err
+	}
+
 	if err := db.WriteLastBHash(blockHeader.HeaderHash()); err != nil {
 		return err
 	}
@@ -0,0 +1,243 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xfsgo/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultClusterInterval = 10 * time.Second
+	// clusterCallTimeout bounds the polls and proxied calls made to a sibling
+	clusterCallTimeout = "5s"
+)
+
+// ClusterConfig configures the sibling nodes serving the same clients as the node.
+type ClusterConfig struct {
+	// Siblings are the RPC urls of the sibling nodes.
+	Siblings []string
+	// Interval is the time between two polls of the siblings.
+	Interval time.Duration
+	// ProxyReads forwards read calls to the freshest sibling while the node is syncing.
+	ProxyReads bool
+}
+
+// SiblingStatus is the health and head of a sibling node seen by the last poll.
+type SiblingStatus struct {
+	URL     string      `json:"url"`
+	Healthy bool        `json:"healthy"`
+	Error   string      `json:"error,omitempty"`
+	Height  uint64      `json:"height"`
+	Hash    common.Hash `json:"hash"`
+	Syncing bool        `json:"syncing"`
+	// Checked is the unix time of the last poll and Latency its duration in milliseconds.
+	Checked int64 `json:"checked"`
+	Latency int64 `json:"latency"`
+}
+
+// clusterCaller calls the RPC methods of a sibling.
+type clusterCaller interface {
+	CallMethod(id int, methodname string, params interface{}, out interface{}) error
+}
+
+type sibling struct {
+	caller clusterCaller
+	status SiblingStatus
+}
+
+// Cluster polls the sibling nodes of the node and proxies read calls to them while the
+// node is syncing.
+type Cluster struct {
+	config   ClusterConfig
+	syncing  func() bool
+	mu       sync.RWMutex
+	siblings []*sibling
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewCluster creates the cluster of the siblings of the config, syncing reports whether
+// the node itself is syncing.
+func NewCluster(config ClusterConfig, syncing func() bool) *Cluster {
+	if config.Interval <= 0 {
+		config.Interval = defaultClusterInterval
+	}
+	c := &Cluster{
+		config:  config,
+		syncing: syncing,
+		quit:    make(chan struct{}),
+	}
+	for _, url := range config.Siblings {
+		c.siblings = append(c.siblings, &sibling{
+			caller: NewClient(url, clusterCallTimeout),
+			status: SiblingStatus{URL: url},
+		})
+	}
+	return c
+}
+
+// Start polls the siblings until the cluster is stopped.
+func (c *Cluster) Start() {
+	go func() {
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		for {
+			c.poll()
+			select {
+			case <-ticker.C:
+			case <-c.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Cluster) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.quit)
+	})
+}
+
+func (c *Cluster) poll() {
+	var wg sync.WaitGroup
+	for _, s := range c.siblings {
+		wg.Add(1)
+		go func(s *sibling) {
+			defer wg.Done()
+			c.pollSibling(s)
+		}(s)
+	}
+	wg.Wait()
+}
+
+type siblingSyncStatus struct {
+	Status       bool   `json:"status"`
+	CurrentBlock string `json:"current_block"`
+	HighestBlock string `json:"highest_block"`
+}
+
+type siblingHead struct {
+	Height uint64      `json:"height"`
+	Hash   common.Hash `json:"hash"`
+}
+
+func (c *Cluster) pollSibling(s *sibling) {
+	start := time.Now()
+	status := SiblingStatus{URL: s.status.URL, Checked: start.Unix()}
+	head := new(siblingHead)
+	syncStatus := new(siblingSyncStatus)
+	err := s.caller.CallMethod(1, "Chain.Head", nil, &head)
+	if err == nil {
+		err = s.caller.CallMethod(1, "Chain.GetSyncStatus", nil, syncStatus)
+	}
+	status.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Healthy = true
+		status.Height = head.Height
+		status.Hash = head.Hash
+		// the sync status of the sibling counts unless it caught up with the highest block
+		current, _ := strconv.ParseUint(syncStatus.CurrentBlock, 10, 64)
+		highest, _ := strconv.ParseUint(syncStatus.HighestBlock, 10, 64)
+		status.Syncing = syncStatus.Status && current < highest
+	}
+	c.mu.Lock()
+	s.status = status
+	c.mu.Unlock()
+}
+
+// Status returns the statuses of the siblings in the order of the config.
+func (c *Cluster) Status() []*SiblingStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]*SiblingStatus, 0, len(c.siblings))
+	for _, s := range c.siblings {
+		status := s.status
+		result = append(result, &status)
+	}
+	return result
+}
+
+// freshest returns the healthy sibling which is not syncing with the highest head.
+func (c *Cluster) freshest() *sibling {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var best *sibling
+	for _, s := range c.siblings {
+		if !s.status.Healthy || s.status.Syncing {
+			continue
+		}
+		if best == nil || s.status.Height > best.status.Height {
+			best = s
+		}
+	}
+	return best
+}
+
+func (c *Cluster) markUnhealthy(s *sibling, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.status.Healthy = false
+	s.status.Error = err.Error()
+}
+
+// isClusterReadMethod reports whether the method only reads the chain or the state, which
+// any synced sibling answers the same way.
+func isClusterReadMethod(method string) bool {
+	parts := strings.Split(method, ".")
+	if len(parts) != 2 {
+		return false
+	}
+	switch parts[0] {
+	case "Chain", "State":
+		return parts[1] == "Head" || strings.HasPrefix(parts[1], "Get")
+	case "Contract":
+		return parts[1] == "Call" || parts[1] == "EstimateGas"
+	}
+	return false
+}
+
+// ProxyRead forwards the read call to the freshest sibling while the node is syncing,
+// proxied is false if the node should answer the call itself. Errors returned by the
+// sibling are the errors of the call.
+func (c *Cluster) ProxyRead(method string, params interface{}) (result interface{}, proxied bool, err error) {
+	if !c.config.ProxyReads || !isClusterReadMethod(method) || c.syncing == nil || !c.syncing() {
+		return nil, false, nil
+	}
+	s := c.freshest()
+	if s == nil {
+		return nil, false, nil
+	}
+	var raw json.RawMessage
+	if err = s.caller.CallMethod(1, method, params, &raw); err != nil {
+		if rpcErr, ok := err.(*RPCError); ok {
+			return nil, true, rpcErr
+		}
+		logrus.Warnf("Failed to proxy call to sibling: url=%s, method=%s, err=%s", s.status.URL, method, err)
+		c.markUnhealthy(s, err)
+		return nil, false, nil
+	}
+	return raw, true, nil
+}
@@ -0,0 +1,88 @@
+package xfsgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"xfsgo/assert"
+)
+
+type testSiblingCaller struct {
+	height  uint64
+	syncing bool
+	err     error
+	calls   []string
+}
+
+func (c *testSiblingCaller) CallMethod(id int, method string, params interface{}, out interface{}) error {
+	c.calls = append(c.calls, method)
+	if c.err != nil {
+		return c.err
+	}
+	var result interface{}
+	switch method {
+	case "Chain.Head":
+		result = map[string]interface{}{"height": c.height}
+	case "Chain.GetSyncStatus":
+		highest := c.height
+		if c.syncing {
+			highest++
+		}
+		result = map[string]interface{}{
+			"status":        c.syncing,
+			"current_block": fmt.Sprint(c.height),
+			"highest_block": fmt.Sprint(highest),
+		}
+	default:
+		result = c.height
+	}
+	js, _ := json.Marshal(result)
+	return json.Unmarshal(js, out)
+}
+
+func TestCluster_ProxyRead(t *testing.T) {
+	syncing := false
+	c := NewCluster(ClusterConfig{ProxyReads: true}, func() bool { return syncing })
+	callers := []*testSiblingCaller{
+		{height: 10},
+		{height: 12},
+		{height: 20, syncing: true},
+	}
+	for i, caller := range callers {
+		c.siblings = append(c.siblings, &sibling{
+			caller: caller,
+			status: SiblingStatus{URL: fmt.Sprint(i)},
+		})
+	}
+	c.poll()
+	status := c.Status()
+	assert.Equal(t, status[1].Healthy, true)
+	assert.Equal(t, status[1].Height, uint64(12))
+	assert.Equal(t, status[2].Syncing, true)
+
+	if _, proxied, _ := c.ProxyRead("Chain.GetBlockByNumber", nil); proxied {
+		t.Fatal("proxied call of synced node")
+	}
+	syncing = true
+	if _, proxied, _ := c.ProxyRead("Wallet.SendTransaction", nil); proxied {
+		t.Fatal("proxied write call")
+	}
+	result, proxied, err := c.ProxyRead("State.GetBalance", nil)
+	if err != nil || !proxied {
+		t.Fatalf("want proxied call, got %v", err)
+	}
+	assert.Equal(t, string(result.(json.RawMessage)), "12")
+
+	callers[1].err = NewRPCError(-6001, "bad address")
+	if _, proxied, err = c.ProxyRead("State.GetBalance", nil); !proxied || err != callers[1].err {
+		t.Fatalf("want error of sibling, got %v", err)
+	}
+	callers[1].err = errors.New("connection refused")
+	if _, proxied, _ = c.ProxyRead("State.GetBalance", nil); proxied {
+		t.Fatal("proxied call of failed sibling")
+	}
+	assert.Equal(t, c.Status()[1].Healthy, false)
+	result, _, _ = c.ProxyRead("Chain.GetBlockByNumber", nil)
+	assert.Equal(t, string(result.(json.RawMessage)), "10")
+}
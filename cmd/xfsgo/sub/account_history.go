@@ -0,0 +1,127 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+	"xfsgo"
+	"xfsgo/common"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyFormat string
+	historyOutput string
+	historyFrom   string
+	historyTo     string
+	historyCmd    = &cobra.Command{
+		Use:                   "export-account-history [options] <address>",
+		DisableFlagsInUseLine: true,
+		SilenceUsage:          true,
+		Short:                 "Export the balance changing events of an account as a CSV or JSON ledger, amounts in atto",
+		RunE:                  exportAccountHistory,
+	}
+)
+
+var accountHistoryHeader = []string{
+	"height", "time", "timestamp", "block_hash", "tx_hash",
+	"kind", "counterparty", "amount", "fee", "status",
+}
+
+func writeAccountHistoryCSV(w io.Writer, history *accountHistoryResp) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(accountHistoryHeader); err != nil {
+		return err
+	}
+	for _, e := range history.Events {
+		record := []string{
+			strconv.FormatUint(e.Height, 10),
+			time.Unix(int64(e.Timestamp), 0).UTC().Format(time.RFC3339),
+			strconv.FormatUint(e.Timestamp, 10),
+			e.BlockHash,
+			e.TxHash,
+			e.Kind,
+			e.Counterparty,
+			e.Amount,
+			e.Fee,
+			strconv.FormatUint(uint64(e.Status), 10),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportAccountHistory(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return cmd.Help()
+	}
+	if historyFormat != "csv" && historyFormat != "json" {
+		return fmt.Errorf("unknown format: %s", historyFormat)
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &getAccountHistoryArgs{
+		Address: args[0],
+		From:    historyFrom,
+		To:      historyTo,
+	}
+	history := new(accountHistoryResp)
+	if err = cli.CallMethod(1, "Chain.GetAccountHistory", req, &history); err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if historyOutput != "" {
+		f, err := os.Create(historyOutput)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+	if historyFormat == "csv" {
+		return writeAccountHistoryCSV(w, history)
+	}
+	bs, err := common.MarshalIndent(history)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(bs))
+	return err
+}
+
+func init() {
+	mFlags := historyCmd.Flags()
+	mFlags.StringVarP(&historyFormat, "format", "f", "csv", "Set output format, csv or json")
+	mFlags.StringVarP(&historyOutput, "output", "o", "", "Write the ledger to file instead of stdout")
+	mFlags.StringVarP(&historyFrom, "from", "", "", "Set first block number")
+	mFlags.StringVarP(&historyTo, "to", "", "", "Set last block number, defaults to the head")
+	rootCmd.AddCommand(historyCmd)
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"fmt"
+	"xfsgo"
+	"xfsgo/common"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	anchorMetadata string
+	anchorIsFile   bool
+	anchorCommand  = &cobra.Command{
+		Use:                   "anchor <command> [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Document anchoring operations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	anchorStoreCommand = &cobra.Command{
+		Use:                   "store [options] <contract> <hash>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Anchor a document hash to an anchor contract",
+		RunE:                  anchorStore,
+	}
+	anchorFileCommand = &cobra.Command{
+		Use:                   "file [options] <contract> <path>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Hash a file on the node host and anchor its hash",
+		RunE:                  anchorFile,
+	}
+	anchorVerifyCommand = &cobra.Command{
+		Use:                   "verify [options] <contract> <hash>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Get the anchor of a document hash",
+		RunE:                  anchorVerify,
+	}
+)
+
+func anchorStore(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &anchorStoreArgs{
+		Contract: args[0],
+		Hash:     args[1],
+		From:     fromAddr,
+		Metadata: anchorMetadata,
+		GasLimit: gasLimit,
+		GasPrice: gasPrice,
+	}
+	var result string
+	if err = cli.CallMethod(1, "Anchor.Store", req, &result); err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	fmt.Println(result)
+	return nil
+}
+
+func anchorFile(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &anchorFileArgs{
+		Contract: args[0],
+		Path:     args[1],
+		From:     fromAddr,
+		Metadata: anchorMetadata,
+		GasLimit: gasLimit,
+		GasPrice: gasPrice,
+	}
+	var result map[string]interface{}
+	if err = cli.CallMethod(1, "Anchor.AnchorFile", req, &result); err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func anchorVerify(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &anchorVerifyArgs{
+		Contract: args[0],
+	}
+	if anchorIsFile {
+		req.Path = args[1]
+	} else {
+		req.Hash = args[1]
+	}
+	var result map[string]interface{}
+	if err = cli.CallMethod(1, "Anchor.Verify", req, &result); err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func init() {
+	anchorCommand.AddCommand(anchorStoreCommand)
+	anchorCommand.AddCommand(anchorFileCommand)
+	anchorCommand.AddCommand(anchorVerifyCommand)
+	for _, c := range []*cobra.Command{anchorStoreCommand, anchorFileCommand} {
+		mFlags := c.Flags()
+		mFlags.StringVarP(&fromAddr, "address", "a", "", "Set from address")
+		mFlags.StringVarP(&anchorMetadata, "metadata", "m", "", "Set document metadata")
+		mFlags.StringVarP(&gasPrice, "gasprice", "", "", "Set transaction gas price")
+		mFlags.StringVarP(&gasLimit, "gaslimit", "", "", "Set transaction gas limit")
+	}
+	anchorVerifyCommand.Flags().BoolVarP(&anchorIsFile, "file", "f", false, "Verify the hash of a file on the node host")
+	rootCmd.AddCommand(anchorCommand)
+}
@@ -0,0 +1,169 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+	"xfsgo"
+	"xfsgo/common/rawencode"
+	"xfsgo/crypto"
+	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayPeer     string
+	replaySpeed    float64
+	replayListen   string
+	replayTimeout  time.Duration
+	captureCommand = &cobra.Command{
+		Use:                   "capture <command> [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Dump and replay the p2p messages captured by a node",
+	}
+	captureDumpCommand = &cobra.Command{
+		Use:                   "dump [options] <path>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Write the messages kept by the capture ring of the node to <path> on the node",
+		Args:                  cobra.ExactArgs(1),
+		RunE:                  runCaptureDump,
+	}
+	captureReplayCommand = &cobra.Command{
+		Use:                   "replay [options] <capture> <node>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Replay the messages a peer sent in <capture> to the node url <node>",
+		Args:                  cobra.ExactArgs(2),
+		RunE:                  runCaptureReplay,
+	}
+)
+
+func runCaptureDump(_ *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &dumpCaptureArgs{
+		Path: args[0],
+	}
+	var count uint64
+	if err = cli.CallMethod(1, "Net.DumpCapture", &req, &count); err != nil {
+		return err
+	}
+	fmt.Printf("Captured messages: %d\n", count)
+	return nil
+}
+
+// replayRecords returns the records of the peer, the first peer of the capture if peer
+// is empty.
+func replayRecords(records []*p2p.CaptureRecord, peer string) []*p2p.CaptureRecord {
+	result := make([]*p2p.CaptureRecord, 0, len(records))
+	for _, r := range records {
+		if !r.Inbound {
+			continue
+		}
+		if peer == "" {
+			peer = r.Peer
+		}
+		if r.Peer == peer {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+func runCaptureReplay(_ *cobra.Command, args []string) error {
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	records, err := p2p.ReadCapture(file)
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+	records = replayRecords(records, replayPeer)
+	if len(records) == 0 {
+		return fmt.Errorf("no inbound messages to replay")
+	}
+	target, err := discover.ParseNode(args[1])
+	if err != nil {
+		return err
+	}
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		return err
+	}
+	dbPath, err := ioutil.TempDir("", "xfsgo-replay")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(dbPath)
+	}()
+	srv := p2p.NewServer(p2p.Config{
+		Encoder:     new(rawencode.StdEncoder),
+		ListenAddr:  replayListen,
+		Key:         key,
+		StaticNodes: []*discover.Node{target},
+		Discover:    true,
+		MaxPeers:    1,
+		NodeDBPath:  dbPath,
+		Logger:      logrus.StandardLogger(),
+	})
+	replay := p2p.NewReplayProtocol(records, replaySpeed, logrus.StandardLogger())
+	srv.Bind(replay)
+	if err = srv.Start(); err != nil {
+		return err
+	}
+	defer srv.Stop()
+	fmt.Printf("Replay %d messages of peer %s to %s\n", len(records), records[0].Peer, target)
+	select {
+	case <-replay.Done():
+	case <-time.After(replayTimeout):
+		return fmt.Errorf("replay timeout")
+	}
+	sent, received := replay.Stats()
+	fmt.Printf("Sent messages: %d\n", sent)
+	types := make([]int, 0, len(received))
+	for t := range received {
+		types = append(types, int(t))
+	}
+	sort.Ints(types)
+	for _, t := range types {
+		fmt.Printf("Received messages: type=%d, count=%d\n", t, received[uint8(t)])
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(captureCommand)
+	captureCommand.AddCommand(captureDumpCommand)
+	captureCommand.AddCommand(captureReplayCommand)
+	mFlags := captureReplayCommand.Flags()
+	mFlags.StringVarP(&replayPeer, "peer", "", "", "Replay the messages of the peer id, the first peer of the capture by default")
+	mFlags.Float64VarP(&replaySpeed, "speed", "", 1, "Divide the gaps between the messages by the speed, 0 sends them at once")
+	mFlags.StringVarP(&replayListen, "listen", "", "127.0.0.1:0", "Set P2P listen address of the replaying peer")
+	mFlags.DurationVarP(&replayTimeout, "timeout", "", 10*time.Minute, "Abort the replay after the timeout")
+}
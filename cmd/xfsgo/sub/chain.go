@@ -26,6 +26,9 @@ import (
 
 // var fileType string = ".car"
 var (
+	// blockTxHashes queries blocks with the hashes of their transactions only
+	blockTxHashes bool
+
 	chainCommand = &cobra.Command{
 		Use:                   "chain <command> [options]",
 		DisableFlagsInUseLine: true,
@@ -72,12 +75,36 @@ var (
 		Short:                 "query the transaction information of the specified transaction hash value",
 		RunE:                  getTransaction,
 	}
+	chainGetAncestorProofCommand = &cobra.Command{
+		Use:                   "getancestorproof [options] <number> [head]",
+		DisableFlagsInUseLine: true,
+		Short:                 "get the proof that block <number> is an ancestor of the head block",
+		RunE:                  getAncestorProof,
+	}
+	chainGetBlockRewardCommand = &cobra.Command{
+		Use:                   "getblockreward [options] [number]",
+		DisableFlagsInUseLine: true,
+		Short:                 "get the block subsidy at <number> by the reward schedule, defaults to the next block",
+		RunE:                  getBlockReward,
+	}
 	chainGetReceiptByHashCommand = &cobra.Command{
 		Use:                   "getreceiptbytxhash [options] <transaction_hash> ",
 		DisableFlagsInUseLine: true,
 		Short:                 "query receipt information of specified transaction hash value",
 		RunE:                  getReceiptByTxHash,
 	}
+	chainGetBlockReceiptsCommand = &cobra.Command{
+		Use:                   "getblockreceipts [options] [hash|number]",
+		DisableFlagsInUseLine: true,
+		Short:                 "query the receipts of all transactions of a block, defaults to the head block",
+		RunE:                  getBlockReceipts,
+	}
+	chainGetHeadersCommand = &cobra.Command{
+		Use:                   "getheaders [options] <start> [count]",
+		DisableFlagsInUseLine: true,
+		Short:                 "query the headers of a range of blocks from the start height",
+		RunE:                  getHeadersByRange,
+	}
 	chainSyncStatusCommand = &cobra.Command{
 		Use:                   "syncstatus [options]",
 		DisableFlagsInUseLine: true,
@@ -127,7 +154,8 @@ func getBlockByNum(cmd *cobra.Command, args []string) error {
 	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
 	var result *common.BlocksMap
 	req := &getBlockByNumArgs{
-		Number: args[0],
+		Number:   args[0],
+		TxHashes: blockTxHashes,
 	}
 	err = cli.CallMethod(1, "Chain.GetBlockByNumber", &req, &result)
 	if err != nil {
@@ -159,7 +187,8 @@ func getBlockByHash(cmd *cobra.Command, args []string) error {
 	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
 	var block *common.BlocksMap
 	req := &getBlockByHashArgs{
-		Hash: args[0],
+		Hash:     args[0],
+		TxHashes: blockTxHashes,
 	}
 	err = cli.CallMethod(1, "Chain.GetBlockByHash", &req, &block)
 	if err != nil {
@@ -329,6 +358,104 @@ func getSyncStatus(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func getAncestorProof(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	req := &getAncestorProofArgs{
+		Number: args[0],
+	}
+	if len(args) > 1 {
+		req.Head = args[1]
+	}
+	result := make(map[string]interface{})
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Chain.GetAncestorProof", &req, &result); err != nil {
+		return err
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func getBlockReward(_ *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	req := &getBlockRewardArgs{}
+	if len(args) > 0 {
+		req.Number = args[0]
+	}
+	result := make(map[string]interface{})
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Chain.GetBlockReward", &req, &result); err != nil {
+		return err
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func getBlockReceipts(_ *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	req := &getBlockReceiptsArgs{}
+	if len(args) > 0 {
+		req.Block = args[0]
+	}
+	result := make([]map[string]interface{}, 0)
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Chain.GetBlockReceipts", &req, &result); err != nil {
+		return err
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func getHeadersByRange(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	req := &getHeadersByRangeArgs{
+		Start: args[0],
+	}
+	if len(args) > 1 {
+		req.Count = args[1]
+	}
+	result := make([]map[string]interface{}, 0)
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Chain.GetHeadersByRange", &req, &result); err != nil {
+		return err
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
 func init() {
 
 	rootCmd.AddCommand(chainCommand)
@@ -340,4 +467,10 @@ func init() {
 	chainCommand.AddCommand(chainGetTxsByBlockHashCommond)
 	chainCommand.AddCommand(chainGetTxsByBlockNumCommond)
 	chainCommand.AddCommand(chainSyncStatusCommand)
+	chainCommand.AddCommand(chainGetAncestorProofCommand)
+	chainCommand.AddCommand(chainGetBlockRewardCommand)
+	chainCommand.AddCommand(chainGetBlockReceiptsCommand)
+	chainCommand.AddCommand(chainGetHeadersCommand)
+	chainGetBlockByNumCommond.Flags().BoolVarP(&blockTxHashes, "tx-hashes", "", false, "Show the hashes of the transactions only")
+	chainGetBlockByHashCommond.Flags().BoolVarP(&blockTxHashes, "tx-hashes", "", false, "Show the hashes of the transactions only")
 }
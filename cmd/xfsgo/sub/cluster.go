@@ -0,0 +1,66 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"fmt"
+	"xfsgo"
+	"xfsgo/common"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	clusterCommand = &cobra.Command{
+		Use:                   "cluster <command> [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Sibling nodes of the node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	clusterStatusCommand = &cobra.Command{
+		Use:                   "status",
+		DisableFlagsInUseLine: true,
+		Short:                 "Get heads and health of the node and its siblings",
+		RunE:                  clusterStatus,
+	}
+)
+
+func clusterStatus(cmd *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	result := make(map[string]interface{})
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Node.GetClusterStatus", nil, &result); err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func init() {
+	clusterCommand.AddCommand(clusterStatusCommand)
+	rootCmd.AddCommand(clusterCommand)
+}
@@ -28,6 +28,7 @@ import (
 	"xfsgo/backend"
 	"xfsgo/common"
 	"xfsgo/node"
+	"xfsgo/p2p"
 
 	"github.com/spf13/viper"
 )
@@ -42,12 +43,17 @@ const (
 	defaultNodesDir          = "nodes"
 	defaultRPCClientAPIHost  = "127.0.0.1:9012"
 	defaultNodeRPCListenAddr = "127.0.0.1:9012"
+	defaultNodeRPCTimeout    = 60 * time.Second
 	defaultNodeP2PListenAddr = "0.0.0.0:9011"
 	defaultNetworkId         = uint32(1)
 	defaultTestNetworkId     = uint32(2)
 	defaultProtocolVersion   = uint32(1)
 	defaultLoggerLevel       = "INFO"
 	defaultCliTimeOut        = "180s"
+	defaultTracingService    = "xfsgo"
+	defaultFaucetAmount      = "10"
+	defaultFaucetInterval    = 24 * time.Hour
+	defaultFaucetIPRequests  = 5
 )
 
 var defaultMinGasPrice = common.DefaultGasPrice()
@@ -67,11 +73,20 @@ type loggerParams struct {
 	level string
 }
 
+type tracingParams struct {
+	// otlpEndpoint is the OTLP/HTTP collector spans are exported to
+	otlpEndpoint string
+	serviceName  string
+}
+
 type daemonConfig struct {
 	loggerParams  loggerParams
+	tracingParams tracingParams
 	storageParams storageParams
 	nodeConfig    node.Config
 	backendParams backend.Params
+	// chains lists the config files of the chains run in the process
+	chains []string
 }
 
 type clientConfig struct {
@@ -106,6 +121,16 @@ func parseConfigLoggerParams(v *viper.Viper) loggerParams {
 	return params
 }
 
+func parseConfigTracingParams(v *viper.Viper) tracingParams {
+	params := tracingParams{}
+	params.otlpEndpoint = v.GetString("tracing.otlp")
+	params.serviceName = v.GetString("tracing.service")
+	if params.serviceName == "" {
+		params.serviceName = defaultTracingService
+	}
+	return params
+}
+
 func setupDataDir(params *storageParams, datadir string) {
 	if datadir != "" && params.dataDir != datadir {
 		np := new(storageParams)
@@ -180,10 +205,27 @@ func parseConfigNodeParams(v *viper.Viper, netid uint32) node.Config {
 		RPCConfig: new(xfsgo.RPCConfig),
 	}
 	config.RPCConfig.ListenAddr = v.GetString("rpcserver.listen")
+	config.RPCConfig.APIKeys = v.GetBool("rpcserver.apikeys")
+	config.RPCConfig.AdminKey = v.GetString("rpcserver.adminkey")
+	config.RPCConfig.Namespace = v.GetString("rpcserver.namespace")
+	config.RPCConfig.Timeout = defaultNodeRPCTimeout
+	if v.IsSet("rpcserver.timeout") {
+		config.RPCConfig.Timeout = v.GetDuration("rpcserver.timeout")
+	}
+	config.RPCConfig.MethodTimeouts = parseConfigMethodTimeouts(v)
+	config.RPCConfig.Confirm = parseConfigConfirm(v)
+	config.RPCCacheSize = v.GetInt("rpcserver.cachesize")
 	config.P2PListenAddress = v.GetString("p2pnode.listen")
 	config.P2PBootstraps = v.GetStringSlice("p2pnode.bootstrap")
 	config.P2PStaticNodes = v.GetStringSlice("p2pnode.static")
 	config.ProtocolVersion = uint8(v.GetUint64("protocol.version"))
+	if path := v.GetString("debug.p2pcapture.path"); path != "" {
+		config.P2PCapture = &p2p.CaptureConfig{
+			Path:           path,
+			RingSize:       v.GetInt("debug.p2pcapture.ring"),
+			MaxMessageSize: v.GetInt("debug.p2pcapture.maxsize"),
+		}
+	}
 	if config.RPCConfig.ListenAddr == "" {
 		config.RPCConfig.ListenAddr = defaultNodeRPCListenAddr
 	}
@@ -196,6 +238,53 @@ func parseConfigNodeParams(v *viper.Viper, netid uint32) node.Config {
 	return config
 }
 
+// parseConfigMethodTimeouts returns the timeouts of the rpc methods, which are
+// listed like Contract.EstimateGas=10s. The invalid entries are ignored.
+func parseConfigMethodTimeouts(v *viper.Viper) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, item := range v.GetStringSlice("rpcserver.method_timeouts") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if timeout, err := time.ParseDuration(strings.TrimSpace(kv[1])); err == nil {
+			timeouts[strings.TrimSpace(kv[0])] = timeout
+		}
+	}
+	return timeouts
+}
+
+// parseConfigConfirm returns the confirmation policies of the dangerous rpc methods,
+// which are listed like Wallet.ExportByAddress=cosign+1m. A policy is made of cosign,
+// a delay or both. The invalid entries are ignored.
+func parseConfigConfirm(v *viper.Viper) map[string]xfsgo.ConfirmPolicy {
+	policies := make(map[string]xfsgo.ConfirmPolicy)
+	for _, item := range v.GetStringSlice("rpcserver.confirm") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var (
+			policy xfsgo.ConfirmPolicy
+			valid  = true
+		)
+		for _, part := range strings.Split(kv[1], "+") {
+			part = strings.TrimSpace(part)
+			if part == "cosign" {
+				policy.Cosign = true
+			} else if delay, err := time.ParseDuration(part); err == nil && delay > 0 {
+				policy.Delay = delay
+			} else {
+				valid = false
+			}
+		}
+		if valid {
+			policies[strings.TrimSpace(kv[0])] = policy
+		}
+	}
+	return policies
+}
+
 func parseConfigBackendParams(v *viper.Viper) backend.Params {
 	config := backend.Params{}
 	mCoinbase := v.GetString("miner.coinbase")
@@ -212,6 +301,13 @@ func parseConfigBackendParams(v *viper.Viper) backend.Params {
 		minGasPrice = defaultMinGasPrice
 	}
 	config.MinGasPrice = minGasPrice
+	if gasLimit, ok := new(big.Int).SetString(v.GetString("miner.gaslimit"), 10); ok && gasLimit.Cmp(common.MinGasLimit) >= 0 {
+		config.GasLimit = gasLimit
+	}
+	config.ExtraData = v.GetString("miner.extradata")
+	config.Recommit = v.GetDuration("miner.recommit")
+	config.TxOrder = v.GetString("miner.txorder")
+	config.LowMem = v.GetBool("storage.lowmem")
 	if config.Numworkers == uint32(0) {
 		config.Numworkers = defaultNumWorkers
 	}
@@ -223,9 +319,131 @@ func parseConfigBackendParams(v *viper.Viper) backend.Params {
 		config.NetworkID = defaultNetworkId
 	}
 	config.GenesisFile = v.GetString("protocol.genesisfile")
+	config.Faucet = parseConfigFaucetParams(v)
+	config.Cluster = parseConfigClusterParams(v)
+	config.ServeLimits = parseConfigServeParams(v)
+	config.Witnesses = v.GetInt("debug.witnesses")
+	config.AuditSecret = v.GetString("wallet.auditsecret")
+	config.KeyBackup = parseConfigKeyBackupParams(v)
+	config.ReorgAlarm = parseConfigReorgAlarmParams(v)
+	config.Shadow = v.GetString("debug.shadow")
+	config.StatePrune = parseConfigStatePruneParams(v)
 	return config
 }
 
+// parseConfigFaucetParams returns the faucet config, it is nil unless the faucet is enabled.
+func parseConfigFaucetParams(v *viper.Viper) *xfsgo.FaucetConfig {
+	if !v.GetBool("faucet.enable") {
+		return nil
+	}
+	config := &xfsgo.FaucetConfig{
+		Interval:   v.GetDuration("faucet.interval"),
+		IPRequests: v.GetInt("faucet.iprequests"),
+	}
+	if account := v.GetString("faucet.account"); account != "" {
+		config.Account = common.StrB58ToAddress(account)
+	}
+	amount := v.GetString("faucet.amount")
+	if amount == "" {
+		amount = defaultFaucetAmount
+	}
+	var err error
+	if config.Amount, err = common.BaseCoin2Atto(amount); err != nil || config.Amount.Sign() <= 0 {
+		config.Amount, _ = common.BaseCoin2Atto(defaultFaucetAmount)
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultFaucetInterval
+	}
+	if config.IPRequests <= 0 {
+		config.IPRequests = defaultFaucetIPRequests
+	}
+	return config
+}
+
+// parseConfigKeyBackupParams returns the key backup config, it is nil unless a backup
+// directory or bucket is set.
+func parseConfigKeyBackupParams(v *viper.Viper) *xfsgo.KeyBackupConfig {
+	config := &xfsgo.KeyBackupConfig{
+		Passphrase: v.GetString("wallet.backup.passphrase"),
+		Dir:        v.GetString("wallet.backup.dir"),
+	}
+	if endpoint := v.GetString("wallet.backup.s3.endpoint"); endpoint != "" {
+		config.S3 = &xfsgo.S3BackupConfig{
+			Endpoint:  endpoint,
+			Bucket:    v.GetString("wallet.backup.s3.bucket"),
+			Prefix:    v.GetString("wallet.backup.s3.prefix"),
+			Region:    v.GetString("wallet.backup.s3.region"),
+			AccessKey: v.GetString("wallet.backup.s3.accesskey"),
+			SecretKey: v.GetString("wallet.backup.s3.secretkey"),
+			Timeout:   v.GetDuration("wallet.backup.s3.timeout"),
+		}
+	}
+	if config.Dir == "" && config.S3 == nil {
+		return nil
+	}
+	return config
+}
+
+// parseConfigReorgAlarmParams returns the reorg alarm config, it is nil unless the alarm
+// depth is set.
+// parseConfigStatePruneParams returns the state pruning config, it is nil unless enabled.
+func parseConfigStatePruneParams(v *viper.Viper) *xfsgo.StatePruneConfig {
+	if !v.GetBool("storage.prune") {
+		return nil
+	}
+	return &xfsgo.StatePruneConfig{
+		Retention: v.GetUint64("storage.pruneretention"),
+		Interval:  v.GetUint64("storage.pruneinterval"),
+	}
+}
+
+func parseConfigReorgAlarmParams(v *viper.Viper) *xfsgo.ReorgAlarmConfig {
+	depth := v.GetInt("monitor.reorgdepth")
+	if depth <= 0 {
+		return nil
+	}
+	return &xfsgo.ReorgAlarmConfig{
+		Depth:   depth,
+		Webhook: v.GetString("monitor.reorgwebhook"),
+		Timeout: v.GetDuration("monitor.reorgwebhooktimeout"),
+	}
+}
+
+// parseConfigClusterParams returns the cluster config, it is nil unless siblings are set.
+func parseConfigClusterParams(v *viper.Viper) *xfsgo.ClusterConfig {
+	siblings := v.GetStringSlice("cluster.siblings")
+	if len(siblings) == 0 {
+		return nil
+	}
+	return &xfsgo.ClusterConfig{
+		Siblings:   siblings,
+		Interval:   v.GetDuration("cluster.interval"),
+		ProxyReads: v.GetBool("cluster.proxyreads"),
+	}
+}
+
+// parseConfigServeParams returns the serve limits, it is nil unless one of them is set.
+// The limits not set keep their default.
+func parseConfigServeParams(v *viper.Viper) *backend.ServeLimits {
+	if !v.IsSet("protocol.serve") {
+		return nil
+	}
+	limits := backend.DefaultServeLimits
+	if n := v.GetInt("protocol.serve.bytespersec"); n > 0 {
+		limits.BytesPerSec = n
+	}
+	if n := v.GetInt("protocol.serve.maxinflight"); n > 0 {
+		limits.MaxInFlight = n
+	}
+	if n := v.GetInt("protocol.serve.maxserving"); n > 0 {
+		limits.MaxServing = n
+	}
+	if n := v.GetInt("protocol.serve.maxresponsesize"); n > 0 {
+		limits.MaxResponseSize = n
+	}
+	return &limits
+}
+
 func parseDaemonConfig(configFilePath string) (daemonConfig, error) {
 	config := viper.New()
 	if err := readFromConfigPath(config, configFilePath); err != nil && configFilePath != "" {
@@ -234,13 +452,16 @@ func parseDaemonConfig(configFilePath string) (daemonConfig, error) {
 	mStorageParams := parseConfigStorageParams(config)
 	mBackendParams := parseConfigBackendParams(config)
 	mLoggerParams := parseConfigLoggerParams(config)
+	mTracingParams := parseConfigTracingParams(config)
 	nodeParams := parseConfigNodeParams(config, mBackendParams.NetworkID)
 	nodeParams.NodeDBPath = mStorageParams.nodesDir
 	return daemonConfig{
 		loggerParams:  mLoggerParams,
+		tracingParams: mTracingParams,
 		storageParams: mStorageParams,
 		nodeConfig:    nodeParams,
 		backendParams: mBackendParams,
+		chains:        config.GetStringSlice("daemon.chains"),
 	}, nil
 }
 
@@ -0,0 +1,54 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"fmt"
+	"xfsgo"
+	"xfsgo/common"
+
+	"github.com/spf13/cobra"
+)
+
+var crashesCommand = &cobra.Command{
+	Use:                   "crashes",
+	DisableFlagsInUseLine: true,
+	Short:                 "List the recent panics recovered by the node",
+	RunE:                  getCrashReports,
+}
+
+func getCrashReports(_ *cobra.Command, _ []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	result := make([]map[string]interface{}, 0)
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Node.GetCrashReports", nil, &result); err != nil {
+		return err
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(crashesCommand)
+}
@@ -17,14 +17,21 @@
 package sub
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"xfsgo"
 	"xfsgo/backend"
 	"xfsgo/log"
 	"xfsgo/node"
+	"xfsgo/p2p"
+	"xfsgo/service"
 	"xfsgo/storage/badger"
+	"xfsgo/trace"
 
 	"github.com/sirupsen/logrus"
 
@@ -40,13 +47,19 @@ var (
 	debug            bool
 	disableBootstrap bool
 	netid            int
+	extraData        string
+	otlpEndpoint     string
+	lowmem           bool
+	pidFile          string
+	p2pCapture       string
+	chains           string
 	daemonCmd        = &cobra.Command{
 		Use:                   "daemon [options]",
 		DisableFlagsInUseLine: true,
 		SilenceUsage:          true,
 		Short:                 "Start a xfsgo daemon process",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runDaemon()
+			return runDaemon(nil)
 		},
 	}
 )
@@ -77,86 +90,265 @@ func resetConfig(config *daemonConfig) {
 			config.nodeConfig.P2PBootstraps = defaultBootstrapNodes(defaultTestNetworkId)
 		}
 	}
+	if extraData != "" {
+		config.backendParams.ExtraData = extraData
+	}
+	if otlpEndpoint != "" {
+		config.tracingParams.otlpEndpoint = otlpEndpoint
+	}
+	if lowmem {
+		config.backendParams.LowMem = true
+	}
+	if p2pCapture != "" {
+		if config.nodeConfig.P2PCapture == nil {
+			config.nodeConfig.P2PCapture = new(p2p.CaptureConfig)
+		}
+		config.nodeConfig.P2PCapture.Path = p2pCapture
+	}
 	if disableBootstrap {
 		config.nodeConfig.P2PBootstraps = make([]string, 0)
 	} else if bootstrap != "" {
 		config.nodeConfig.P2PBootstraps = strings.Split(bootstrap, ",")
 	}
 }
-func runDaemon() error {
-	var (
-		err   error            = nil
-		stack *node.Node       = nil
-		back  *backend.Backend = nil
-	)
 
+// chain is a chain instance run by the daemon, with its node, backend and databases.
+type chain struct {
+	name    string
+	stack   *node.Node
+	back    *backend.Backend
+	closers []func() error
+}
+
+func (c *chain) close() {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		safeclose(c.closers[i])
+	}
+}
+
+// loadChainConfigs returns the configs of the chains run by the daemon. Several chains
+// are run if the chain config files are listed by the chains flag or the daemon.chains
+// config, the flags setting the addresses and directories of a chain are ignored then.
+func loadChainConfigs() ([]daemonConfig, error) {
 	config, err := parseDaemonConfig(cfgFile) // default config
 	if err != nil {
-		return err
+		return nil, err
 	}
-	resetConfig(&config) // input config
-	loglevel, err := logrus.ParseLevel(config.loggerParams.level)
-	if err != nil {
-		return err
+	files := config.chains
+	if chains != "" {
+		files = strings.Split(chains, ",")
+	}
+	if len(files) == 0 {
+		resetConfig(&config) // input config
+		return []daemonConfig{config}, nil
+	}
+	configs := make([]daemonConfig, 0, len(files))
+	for _, file := range files {
+		c, err := parseDaemonConfig(file)
+		if err != nil {
+			return nil, fmt.Errorf("chain config %s: %v", file, err)
+		}
+		if c.nodeConfig.RPCConfig.Namespace == "" {
+			c.nodeConfig.RPCConfig.Namespace = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		if otlpEndpoint != "" {
+			c.tracingParams.otlpEndpoint = otlpEndpoint
+		}
+		if lowmem {
+			c.backendParams.LowMem = true
+		}
+		configs = append(configs, c)
 	}
+	if err = checkChainConfigs(configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
 
-	logrus.SetFormatter(&log.Formatter{})
-	logrus.SetLevel(loglevel)
+// checkChainConfigs checks the chains do not share data directories, p2p addresses or
+// rpc namespaces.
+func checkChainConfigs(configs []daemonConfig) error {
+	used := make(map[string]string)
+	use := func(name, kind, value string) error {
+		key := kind + " " + value
+		if other, exists := used[key]; exists {
+			return fmt.Errorf("chains %s and %s use the same %s: %s", other, name, kind, value)
+		}
+		used[key] = name
+		return nil
+	}
+	for _, c := range configs {
+		name := c.nodeConfig.RPCConfig.Namespace
+		if strings.Contains(name, "/") {
+			return fmt.Errorf("invalid rpc namespace: %s", name)
+		}
+		dirs := []string{
+			c.storageParams.chainDir, c.storageParams.stateDir, c.storageParams.keysDir,
+			c.storageParams.extraDir, c.storageParams.nodesDir,
+		}
+		for _, dir := range dirs {
+			if err := use(name, "data directory", filepath.Clean(dir)); err != nil {
+				return err
+			}
+		}
+		if err := use(name, "p2p address", c.nodeConfig.P2PListenAddress); err != nil {
+			return err
+		}
+		if err := use(name, "rpc namespace", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startChain opens the databases of the chain and starts its node and backend. The
+// chains are started one after another as the genesis of a chain is read when its
+// blockchain is opened.
+func startChain(config *daemonConfig) (c *chain, err error) {
+	c = &chain{name: config.nodeConfig.RPCConfig.Namespace}
+	defer func() {
+		if err != nil {
+			c.close()
+		}
+	}()
 	nodeConf := &config.nodeConfig
 	nodeConf.RPCConfig.Logger = logrus.StandardLogger()
-	if stack, err = node.New(nodeConf); err != nil {
-		return err
+	if c.stack, err = node.New(nodeConf); err != nil {
+		return nil, err
+	}
+	if capture := c.stack.Capture(); capture != nil {
+		c.closers = append(c.closers, func() error {
+			if err := capture.Close(); err != nil {
+				logrus.Warnf("Failed to close p2p capture: %s", err)
+			}
+			return nil
+		})
 	}
-	chainDb, err := badger.New(config.storageParams.chainDir)
+	profile := badger.DefaultProfile
+	if config.backendParams.LowMem {
+		profile = badger.LowMemProfile
+		logrus.Infof("Enable low memory mode")
+	}
+	open := func(dir string) (*badger.Storage, error) {
+		db, err := badger.NewWithProfile(dir, profile)
+		if err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, db.Close)
+		return db, nil
+	}
+	chainDb, err := open(config.storageParams.chainDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	keysDb, err := badger.New(config.storageParams.keysDir)
+	keysDb, err := open(config.storageParams.keysDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	stateDB, err := badger.New(config.storageParams.stateDir)
+	stateDB, err := open(config.storageParams.stateDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	extraDB, err := badger.New(config.storageParams.extraDir)
+	extraDB, err := open(config.storageParams.extraDir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if nodeConf.RPCConfig.APIKeys {
+		if nodeConf.RPCConfig.AdminKey == "" {
+			return nil, errors.New("rpcserver.adminkey is required to enable api keys")
+		}
+		apiKeys, err := xfsgo.NewAPIKeyStore(extraDB, nodeConf.RPCConfig.AdminKey)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.stack.EnableAPIKeys(apiKeys); err != nil {
+			return nil, err
+		}
 	}
-	defer func() {
-		safeclose(chainDb.Close)
-		safeclose(keysDb.Close)
-		safeclose(stateDB.Close)
-		safeclose(extraDB.Close)
-	}()
 	backparams := &config.backendParams
 	backparams.Debug = debug
-	if backparams.Debug {
-		logrus.SetLevel(logrus.DebugLevel)
-		logrus.Debugf("Set debug mode")
-	}
-	if back, err = backend.NewBackend(stack, &backend.Config{
+	if c.back, err = backend.NewBackend(c.stack, &backend.Config{
 		Params:  backparams,
 		ChainDB: chainDb,
 		KeysDB:  keysDb,
 		StateDB: stateDB,
 		ExtraDB: extraDB,
 	}); err != nil {
+		return nil, err
+	}
+	if err = backend.StartNodeAndBackend(c.stack, c.back); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// runDaemon runs the node until a termination signal is received or stop is closed.
+func runDaemon(stop <-chan struct{}) error {
+	configs, err := loadChainConfigs()
+	if err != nil {
 		return err
 	}
-	if err = backend.StartNodeAndBackend(stack, back); err != nil {
+	config := configs[0]
+	loglevel, err := logrus.ParseLevel(config.loggerParams.level)
+	if err != nil {
 		return err
 	}
-	c := make(chan os.Signal)
+
+	logrus.SetFormatter(&log.Formatter{})
+	logrus.SetLevel(loglevel)
+	if pidFile != "" {
+		if err = service.WritePIDFile(pidFile); err != nil {
+			return err
+		}
+		defer func() {
+			_ = service.RemovePIDFile(pidFile)
+		}()
+	}
+	if endpoint := config.tracingParams.otlpEndpoint; endpoint != "" {
+		exporter := trace.NewOTLPExporter(endpoint, config.tracingParams.serviceName)
+		trace.SetExporter(exporter)
+		defer exporter.Stop()
+		logrus.Infof("Export traces to: %s", endpoint)
+	}
+	if debug {
+		logrus.SetLevel(logrus.DebugLevel)
+		logrus.Debugf("Set debug mode")
+	}
+	running := make([]*chain, 0, len(configs))
+	defer func() {
+		for i := len(running) - 1; i >= 0; i-- {
+			running[i].close()
+		}
+	}()
+	for i := range configs {
+		c, err := startChain(&configs[i])
+		if err != nil {
+			if len(configs) > 1 {
+				return fmt.Errorf("chain %s: %v", configs[i].nodeConfig.RPCConfig.Namespace, err)
+			}
+			return err
+		}
+		if len(configs) > 1 {
+			logrus.Infof("Started chain %s", c.name)
+		}
+		running = append(running, c)
+	}
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-out:
+	defer signal.Stop(c)
+	if _, err = service.Notify("READY=1"); err != nil {
+		logrus.Warnf("Failed to notify systemd: %s", err)
+	}
+	quit := make(chan struct{})
+	defer close(quit)
+	go service.RunWatchdog(quit)
 	select {
 	case s := <-c:
-		switch s {
-		case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
-			break out
-		}
+		logrus.Infof("Received signal %s, shutting down", s)
+	case <-stop:
+		logrus.Infof("Service stopped, shutting down")
 	}
+	_, _ = service.Notify("STOPPING=1")
 	return nil
 }
 
@@ -170,5 +362,11 @@ func init() {
 	mFlags.BoolVarP(&disableBootstrap, "dbootstrap", "", false, "Disable Bootstrap")
 	mFlags.BoolVarP(&debug, "debug", "", false, "Enable debug")
 	mFlags.IntVarP(&netid, "netid", "n", 0, "Explicitly set network id")
+	mFlags.StringVarP(&extraData, "extradata", "", "", "Set extra data of mined blocks")
+	mFlags.StringVarP(&otlpEndpoint, "otlp", "", "", "Export traces to an OTLP/HTTP collector")
+	mFlags.BoolVarP(&lowmem, "lowmem", "", false, "Reduce memory usage for devices with little RAM")
+	mFlags.StringVarP(&pidFile, "pidfile", "", "", "Write the process id to the file")
+	mFlags.StringVarP(&p2pCapture, "p2pcapture", "", "", "Debug: capture the p2p messages of the peers to the file")
+	mFlags.StringVarP(&chains, "chains", "", "", "Run a chain of each of the config files in the process, separated by commas")
 	rootCmd.AddCommand(daemonCmd)
 }
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 	"xfsgo"
 	"xfsgo/common"
 
@@ -28,8 +29,9 @@ import (
 )
 
 var (
-	workers      string
-	minerCommand = &cobra.Command{
+	workers          string
+	externalCoinbase bool
+	minerCommand     = &cobra.Command{
 		Use:                   "miner <command> [options]",
 		DisableFlagsInUseLine: true,
 		Short:                 "miner serve info",
@@ -61,6 +63,30 @@ var (
 		Short:                 "Miner set gas price",
 		RunE:                  setGasPrice,
 	}
+	minerSetGasLimitCommand = &cobra.Command{
+		Use:                   "setgaslimit [options] <limit>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Miner set target gas limit",
+		RunE:                  setGasLimit,
+	}
+	minerSetRewardSplitCommand = &cobra.Command{
+		Use:                   "setrewardsplit [options] [<address>:<percent>...]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Miner split the block reward to other addresses than the coinbase",
+		RunE:                  setRewardSplit,
+	}
+	minerSetCoinbaseCommand = &cobra.Command{
+		Use:                   "setcoinbase [options] <address>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Miner set the address receiving the block rewards",
+		RunE:                  setCoinbase,
+	}
+	minerCoinbaseHistoryCommand = &cobra.Command{
+		Use:                   "coinbasehistory [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Get the last coinbase changes of the miner",
+		RunE:                  getCoinbaseHistory,
+	}
 	minerGetStatusCommand = &cobra.Command{
 		Use:                   "status [options]",
 		DisableFlagsInUseLine: true,
@@ -137,6 +163,91 @@ func setGasPrice(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func setGasLimit(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("value err")
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	req := &MinerSetGasLimitArgs{
+		Value: args[0],
+	}
+	var res *string = nil
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	err = cli.CallMethod(1, "Miner.SetGasLimit", &req, &res)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setRewardSplit(cmd *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	req := &minerSetRewardSplitArgs{
+		Shares: make([]minerRewardShareArgs, 0, len(args)),
+	}
+	for _, arg := range args {
+		i := strings.LastIndex(arg, ":")
+		if i < 0 {
+			return fmt.Errorf("share must be <address>:<percent>: %s", arg)
+		}
+		req.Shares = append(req.Shares, minerRewardShareArgs{
+			Address: arg[:i],
+			Percent: arg[i+1:],
+		})
+	}
+	var res *string = nil
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	err = cli.CallMethod(1, "Miner.SetRewardSplit", &req, &res)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func setCoinbase(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("address err")
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	req := &MinSetCoinbaseArgs{
+		Coinbase: args[0],
+		External: externalCoinbase,
+	}
+	var res *string = nil
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Miner.SetCoinbase", &req, &res); err != nil {
+		return err
+	}
+	fmt.Printf("Coinbase: %s\n", *res)
+	return nil
+}
+
+func getCoinbaseHistory(_ *cobra.Command, _ []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	res := make([]map[string]interface{}, 0)
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Miner.CoinbaseHistory", nil, &res); err != nil {
+		return err
+	}
+	for _, change := range res {
+		fmt.Printf("%v height=%v %v -> %v external=%v\n",
+			change["time"], change["height"], change["from"], change["to"], change["external"])
+	}
+	return nil
+}
+
 func getStatus(_ *cobra.Command, _ []string) error {
 	config, err := parseClientConfig(cfgFile)
 	if err != nil {
@@ -180,6 +291,12 @@ func getStatus(_ *cobra.Command, _ []string) error {
 	fmt.Printf("TargetDifficulty: %s\n", targetDifficulty)
 	fmt.Printf("TargetHashRate: %s\n", targethashrate)
 	fmt.Printf("HashRate: %s\n", hashrate)
+	if split, ok := res["reward_split"].([]interface{}); ok {
+		for _, item := range split {
+			share, _ := item.(map[string]interface{})
+			fmt.Printf("RewardShare: %v %v%%\n", share["address"], share["percent"])
+		}
+	}
 	return nil
 }
 func init() {
@@ -188,7 +305,11 @@ func init() {
 	mFlags.StringVarP(&workers, "workers", "", "0", "Set number of workers")
 	minerCommand.AddCommand(minerStopCommand)
 	minerCommand.AddCommand(minerSetGasPriceCommand)
-	// minerCommand.AddCommand(minerSetGasLimitCommand)
+	minerCommand.AddCommand(minerSetGasLimitCommand)
+	minerCommand.AddCommand(minerSetRewardSplitCommand)
+	minerCommand.AddCommand(minerSetCoinbaseCommand)
+	minerSetCoinbaseCommand.Flags().BoolVarP(&externalCoinbase, "external", "", false, "Allow an address which is not an account of the wallet")
+	minerCommand.AddCommand(minerCoinbaseHistoryCommand)
 	minerCommand.AddCommand(minerGetStatusCommand)
 	minerCommand.AddCommand(minerSetWorkersCommand)
 	rootCmd.AddCommand(minerCommand)
@@ -22,6 +22,12 @@ var (
 		Short:                 "View established peer-to-peer links",
 		RunE:                  getPeers,
 	}
+	getPeerRankingCommand = &cobra.Command{
+		Use:                   "ranking [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "View the peers ranked by how fast they announce new blocks",
+		RunE:                  getPeerRanking,
+	}
 	addPeerCommand = &cobra.Command{
 		Use:                   "addpeer [options] <url>",
 		DisableFlagsInUseLine: true,
@@ -62,6 +68,28 @@ func getPeers(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func getPeerRanking(_ *cobra.Command, _ []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	var res []map[string]interface{}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	if err = cli.CallMethod(1, "Net.Peers", nil, &res); err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		fmt.Println("Not found peers")
+		return nil
+	}
+	fmt.Println("Rank  Announced  First      AvgDelay(ms)  Node")
+	for _, peer := range res {
+		fmt.Printf("%-6v%-11v%-11v%-14v%v\n", peer["rank"], peer["announced"],
+			peer["first"], peer["avg_delay"], peer["node"])
+	}
+	return nil
+}
+
 func addPeer(cmd *cobra.Command, args []string) error {
 	if len(args) < 1 {
 		return cmd.Help()
@@ -120,6 +148,7 @@ func getNodeId(cmd *cobra.Command, args []string) error {
 func init() {
 	rootCmd.AddCommand(netCommand)
 	netCommand.AddCommand(getPeersCommand)
+	netCommand.AddCommand(getPeerRankingCommand)
 	netCommand.AddCommand(addPeerCommand)
 	netCommand.AddCommand(delPeerCommand)
 	netCommand.AddCommand(getNodeIdCommand)
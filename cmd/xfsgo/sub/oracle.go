@@ -0,0 +1,119 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"fmt"
+	"xfsgo"
+	"xfsgo/common"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	oracleReporter  string
+	oracleTimestamp string
+	oracleSignature string
+	oracleCommand   = &cobra.Command{
+		Use:                   "oracle <command> [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Oracle data feed operations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	oracleSubmitCommand = &cobra.Command{
+		Use:                   "submit [options] <contract> <key> <value>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Submit a signed data point to an oracle contract",
+		RunE:                  oracleSubmit,
+	}
+	oracleValueCommand = &cobra.Command{
+		Use:                   "value <contract> <key>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Get the value of a data feed of an oracle contract",
+		RunE:                  oracleValue,
+	}
+)
+
+func oracleSubmit(cmd *cobra.Command, args []string) error {
+	if len(args) < 3 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &oracleSubmitArgs{
+		Contract:  args[0],
+		Key:       args[1],
+		Value:     args[2],
+		From:      fromAddr,
+		Reporter:  oracleReporter,
+		Timestamp: oracleTimestamp,
+		Signature: oracleSignature,
+		GasLimit:  gasLimit,
+		GasPrice:  gasPrice,
+	}
+	var result string
+	if err = cli.CallMethod(1, "Oracle.Submit", req, &result); err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	fmt.Println(result)
+	return nil
+}
+
+func oracleValue(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &oracleValueArgs{
+		Contract: args[0],
+		Key:      args[1],
+	}
+	var result map[string]interface{}
+	if err = cli.CallMethod(1, "Oracle.GetValue", req, &result); err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	bs, err := common.MarshalIndent(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func init() {
+	oracleCommand.AddCommand(oracleSubmitCommand)
+	oracleCommand.AddCommand(oracleValueCommand)
+	mFlags := oracleSubmitCommand.Flags()
+	mFlags.StringVarP(&fromAddr, "address", "a", "", "Set from address")
+	mFlags.StringVarP(&oracleReporter, "reporter", "", "", "Set wallet address signing the data point")
+	mFlags.StringVarP(&oracleTimestamp, "timestamp", "", "", "Set data point timestamp")
+	mFlags.StringVarP(&oracleSignature, "signature", "", "", "Set signature of a reporter")
+	mFlags.StringVarP(&gasPrice, "gasprice", "", "", "Set transaction gas price")
+	mFlags.StringVarP(&gasLimit, "gaslimit", "", "", "Set transaction gas limit")
+	rootCmd.AddCommand(oracleCommand)
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"fmt"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/storage/badger"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneDatadir   string
+	pruneRetention uint64
+	pruneStateCmd  = &cobra.Command{
+		Use:                   "prune-state [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Delete the states of the old blocks, the daemon must be stopped",
+		RunE:                  runPruneState,
+	}
+)
+
+func runPruneState(_ *cobra.Command, _ []string) error {
+	config, err := parseDaemonConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	if pruneDatadir != "" {
+		setupDataDir(&config.storageParams, pruneDatadir)
+	}
+	chainDb, err := badger.New(config.storageParams.chainDir)
+	if err != nil {
+		return err
+	}
+	defer safeclose(chainDb.Close)
+	stateDb, err := badger.New(config.storageParams.stateDir)
+	if err != nil {
+		return err
+	}
+	defer safeclose(stateDb.Close)
+	stats, err := xfsgo.PruneStateDB(stateDb, chainDb, pruneRetention)
+	if err != nil {
+		return err
+	}
+	bs, err := common.MarshalIndent(stats)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func init() {
+	mFlags := pruneStateCmd.Flags()
+	mFlags.StringVarP(&pruneDatadir, "datadir", "d", "", "Set Data directory")
+	mFlags.Uint64VarP(&pruneRetention, "retention", "", xfsgo.DefaultStateRetention, "Number of the last blocks whose state is kept")
+	rootCmd.AddCommand(pruneStateCmd)
+}
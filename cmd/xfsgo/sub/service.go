@@ -0,0 +1,109 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"xfsgo/service"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceName     string
+	serviceWatchdog int
+	serviceCmd      = &cobra.Command{
+		Use:                   "service <command> [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Manage the xfsgo daemon as a system service",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	serviceInstallCmd = &cobra.Command{
+		Use:                   "install [options] [-- <daemon options>]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Install the daemon as a systemd or Windows service",
+		RunE:                  installService,
+	}
+	serviceUninstallCmd = &cobra.Command{
+		Use:                   "uninstall [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Stop and uninstall the service",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := service.Uninstall(serviceName); err != nil {
+				return err
+			}
+			fmt.Printf("Service %s uninstalled\n", serviceName)
+			return nil
+		},
+	}
+	serviceRunCmd = &cobra.Command{
+		Use:                   "run [options]",
+		DisableFlagsInUseLine: true,
+		SilenceUsage:          true,
+		Short:                 "Run the daemon under the service manager",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return service.Run(serviceName, runDaemon)
+		},
+	}
+)
+
+func installService(cmd *cobra.Command, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	runArgs := []string{"service", "run", "--name", serviceName}
+	if cfgFile != "" {
+		// the service manager starts the daemon in another working directory
+		configPath, err := filepath.Abs(cfgFile)
+		if err != nil {
+			return err
+		}
+		runArgs = append(runArgs, "--config", configPath)
+	}
+	runArgs = append(runArgs, args...)
+	if err = service.Install(&service.Config{
+		Name:        serviceName,
+		Description: "xfsgo full node",
+		Executable:  exe,
+		Args:        runArgs,
+		WatchdogSec: serviceWatchdog,
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Service %s installed\n", serviceName)
+	return nil
+}
+
+func init() {
+	serviceFlags := serviceCmd.PersistentFlags()
+	serviceFlags.StringVarP(&serviceName, "name", "", service.DefaultName, "Set service name")
+	serviceInstallCmd.Flags().IntVarP(&serviceWatchdog, "watchdog", "", 60, "Set systemd watchdog timeout in seconds, 0 to disable")
+	// run accepts the options of the daemon
+	serviceRunCmd.Flags().AddFlagSet(daemonCmd.PersistentFlags())
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	serviceCmd.AddCommand(serviceRunCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
@@ -26,6 +26,7 @@ import (
 
 var (
 	roothash        string
+	pendingState    bool
 	getStateCommand = &cobra.Command{
 		Use:                   "state <command> [options]",
 		DisableFlagsInUseLine: true,
@@ -65,6 +66,7 @@ func GetAccount(cmd *cobra.Command, args []string) error {
 	req := &getAccountArgs{
 		RootHash: rootHash,
 		Address:  address,
+		Pending:  pendingFlag(pendingState),
 	}
 	err = cli.CallMethod(1, "State.GetAccount", &req, &result)
 	if err != nil {
@@ -96,6 +98,7 @@ func GetBalance(cmd *cobra.Command, args []string) error {
 	req := &getAccountArgs{
 		RootHash: rootHash,
 		Address:  address,
+		Pending:  pendingFlag(pendingState),
 	}
 	err = cli.CallMethod(1, "State.GetBalance", &req, &result)
 	if err != nil {
@@ -110,12 +113,21 @@ func GetBalance(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func pendingFlag(pending bool) string {
+	if pending {
+		return "true"
+	}
+	return ""
+}
+
 func init() {
 	rootCmd.AddCommand(getStateCommand)
 	getAccountCommandFlags := getAccountCommand.PersistentFlags()
 	getAccountCommandFlags.StringVarP(&roothash, "root", "r", "", "Set state tree root hash")
+	getAccountCommandFlags.BoolVarP(&pendingState, "pending", "p", false, "Include the pending transactions of the pool")
 	getStateCommand.AddCommand(getAccountCommand)
 	getBalanceCommandFlags := getBalanceCommand.PersistentFlags()
 	getBalanceCommandFlags.StringVarP(&roothash, "root", "r", "", "Set state tree root hash")
+	getBalanceCommandFlags.BoolVarP(&pendingState, "pending", "p", false, "Include the pending transactions of the pool")
 	getStateCommand.AddCommand(getBalanceCommand)
 }
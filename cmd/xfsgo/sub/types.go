@@ -22,7 +22,8 @@ import (
 )
 
 type getBlockByHashArgs struct {
-	Hash string `json:"hash"`
+	Hash     string `json:"hash"`
+	TxHashes bool   `json:"tx_hashes"`
 }
 
 type getTransactionArgs struct {
@@ -44,12 +45,22 @@ type getTxsByBlockHashArgs struct {
 type getAccountArgs struct {
 	RootHash string `json:"root_hash"`
 	Address  string `json:"address"`
+	Pending  string `json:"pending"`
 }
 
 type getWalletByAddressArgs struct {
 	Address string `json:"address"`
 }
 
+type dumpCaptureArgs struct {
+	Path string `json:"path"`
+}
+
+type getSigningLogArgs struct {
+	Start string `json:"start"`
+	Limit string `json:"limit"`
+}
+
 type walletImportArgs struct {
 	Key string `json:"key"`
 }
@@ -65,12 +76,48 @@ type sendTransactionArgs struct {
 	GasPrice string `json:"gas_price"`
 	Value    string `json:"value"`
 	Nonce    string `json:"nonce"`
+	// Reservation is the id of a reservation the transaction spends.
+	Reservation string `json:"reservation"`
 }
 
-type getBlockByNumArgs struct {
+type reserveArgs struct {
+	Address string `json:"address"`
+	Value   string `json:"value"`
+	TTL     string `json:"ttl"`
+}
+
+type reservationArgs struct {
+	ID string `json:"id"`
+}
+
+type getAncestorProofArgs struct {
+	Number string `json:"number"`
+	Head   string `json:"head"`
+}
+
+type getBlockRewardArgs struct {
 	Number string `json:"number"`
 }
 
+type getBlockReceiptsArgs struct {
+	Block string `json:"block"`
+}
+
+type getHeadersByRangeArgs struct {
+	Start string `json:"start"`
+	Count string `json:"count"`
+}
+
+type faucetRequestArgs struct {
+	Address string `json:"address"`
+	Value   string `json:"value"`
+}
+
+type getBlockByNumArgs struct {
+	Number   string `json:"number"`
+	TxHashes bool   `json:"tx_hashes"`
+}
+
 type GetBlocksArgs struct {
 	Blocks string `json:"blocks"`
 }
@@ -82,12 +129,22 @@ type MinerSetGasLimitArgs struct {
 	Value string `json:"value"`
 }
 
+type minerRewardShareArgs struct {
+	Address string `json:"address"`
+	Percent string `json:"percent"`
+}
+
+type minerSetRewardSplitArgs struct {
+	Shares []minerRewardShareArgs `json:"shares"`
+}
+
 type MinerWorkerArgs struct {
 	Num string `json:"num"`
 }
 
 type MinSetCoinbaseArgs struct {
 	Coinbase string `json:"coinbase"`
+	External bool   `json:"external"`
 }
 
 type GasLimitArgs struct {
@@ -144,3 +201,73 @@ type TransactionResp struct {
 type TransactionsResp []*TransactionResp
 
 // type DataSet []*map[string]interface{}
+
+type oracleSubmitArgs struct {
+	Contract  string `json:"contract"`
+	From      string `json:"from"`
+	Reporter  string `json:"reporter"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
+	GasLimit  string `json:"gas_limit"`
+	GasPrice  string `json:"gas_price"`
+}
+
+type oracleValueArgs struct {
+	Contract string `json:"contract"`
+	Key      string `json:"key"`
+}
+
+type anchorStoreArgs struct {
+	Contract string `json:"contract"`
+	From     string `json:"from"`
+	Hash     string `json:"hash"`
+	Metadata string `json:"metadata"`
+	GasLimit string `json:"gas_limit"`
+	GasPrice string `json:"gas_price"`
+}
+
+type anchorFileArgs struct {
+	Contract string `json:"contract"`
+	From     string `json:"from"`
+	Path     string `json:"path"`
+	Metadata string `json:"metadata"`
+	GasLimit string `json:"gas_limit"`
+	GasPrice string `json:"gas_price"`
+}
+
+type anchorVerifyArgs struct {
+	Contract string `json:"contract"`
+	Hash     string `json:"hash"`
+	Path     string `json:"path"`
+}
+
+type getAccountHistoryArgs struct {
+	Address string `json:"address"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+type accountEventResp struct {
+	Height       uint64 `json:"height"`
+	BlockHash    string `json:"block_hash"`
+	Timestamp    uint64 `json:"timestamp"`
+	TxHash       string `json:"tx_hash,omitempty"`
+	Kind         string `json:"kind"`
+	Counterparty string `json:"counterparty,omitempty"`
+	Amount       string `json:"amount"`
+	Fee          string `json:"fee"`
+	Status       uint32 `json:"status"`
+}
+
+type accountHistoryResp struct {
+	Address  string              `json:"address"`
+	From     uint64              `json:"from"`
+	To       uint64              `json:"to"`
+	Received string              `json:"received"`
+	Sent     string              `json:"sent"`
+	Fees     string              `json:"fees"`
+	Rewards  string              `json:"rewards"`
+	Events   []*accountEventResp `json:"events"`
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package sub
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"xfsgo/test/vectors"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	vectorsOutput string
+	vectorsCmd    = &cobra.Command{
+		Use:                   "vectors <command> [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Generate and run state transition test vectors",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	vectorsGenerateCmd = &cobra.Command{
+		Use:                   "generate [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Write the state transition test vectors as JSON",
+		RunE:                  generateVectors,
+	}
+	vectorsRunCmd = &cobra.Command{
+		Use:                   "run <file>",
+		DisableFlagsInUseLine: true,
+		SilenceUsage:          true,
+		Short:                 "Execute the test vectors of a file and compare the results",
+		RunE:                  runVectors,
+	}
+)
+
+func generateVectors(cmd *cobra.Command, args []string) error {
+	vs, err := vectors.Generate()
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if vectorsOutput != "" {
+		f, err := os.Create(vectorsOutput)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+	return vectors.Write(w, vs)
+}
+
+func runVectors(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return cmd.Help()
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	vs, err := vectors.Read(f)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range vectors.Run(vs) {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", r.Name, r.Err)
+			continue
+		}
+		fmt.Printf("PASS %s\n", r.Name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d vectors failed", failed, len(vs))
+	}
+	return nil
+}
+
+func init() {
+	vectorsGenerateCmd.Flags().StringVarP(&vectorsOutput, "output", "o", "", "Write the vectors to file instead of stdout")
+	vectorsCmd.AddCommand(vectorsGenerateCmd)
+	vectorsCmd.AddCommand(vectorsRunCmd)
+	rootCmd.AddCommand(vectorsCmd)
+}
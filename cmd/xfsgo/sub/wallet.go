@@ -17,9 +17,13 @@
 package sub
 
 import (
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"time"
 	"xfsgo"
 	"xfsgo/common"
+	"xfsgo/crypto"
 
 	"github.com/spf13/cobra"
 )
@@ -29,6 +33,9 @@ var (
 	gasLimit      string
 	gasPrice      string
 	nonce         string
+	reservation   string
+	passphrase    string
+	preview       bool
 	walletCommand = &cobra.Command{
 		Use:                   "wallet <command> [options]",
 		DisableFlagsInUseLine: true,
@@ -85,12 +92,61 @@ var (
 		Short:                 "[options] import wallet <key>",
 		RunE:                  runWalletImport,
 	}
+	walletRestoreCommand = &cobra.Command{
+		Use:                   "restore [options] <archive>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Import the key of the encrypted backup <archive>",
+		Args:                  cobra.ExactArgs(1),
+		RunE:                  runWalletRestore,
+	}
+	walletWatchCommand = &cobra.Command{
+		Use:                   "watch [options] <address>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Import the address as watch-only, the wallet does not sign for it",
+		RunE:                  runWalletWatch,
+	}
+	walletTotalCommand = &cobra.Command{
+		Use:                   "total [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Get the summed balances of all the wallet accounts",
+		RunE:                  getWalletTotalBalance,
+	}
+	walletSigningLogCommand = &cobra.Command{
+		Use:                   "signinglog [options] [start] [limit]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Page through the signing operations of the wallet",
+		RunE:                  getWalletSigningLog,
+	}
 	walletTransferCommand = &cobra.Command{
 		Use:                   "transfer [options] <address> <value>",
 		DisableFlagsInUseLine: true,
 		Short:                 "Send the transaction to the specified destination address",
 		RunE:                  sendTransaction,
 	}
+	walletReserveCommand = &cobra.Command{
+		Use:                   "reserve [options] <value> <ttl>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Reserve <value> of the wallet balance for <ttl> seconds",
+		RunE:                  walletReserve,
+	}
+	walletReleaseCommand = &cobra.Command{
+		Use:                   "release [options] <id>",
+		DisableFlagsInUseLine: true,
+		Short:                 "Release the reservation <id>",
+		RunE:                  walletRelease,
+	}
+	walletReservationsCommand = &cobra.Command{
+		Use:                   "reservations [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "get reservations of wallet balance",
+		RunE:                  getWalletReservations,
+	}
+	walletTxHistoryCommand = &cobra.Command{
+		Use:                   "txhistory [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "get history of transactions sent from wallet address",
+		RunE:                  getWalletTxHistory,
+	}
 )
 
 func sendTransaction(cmd *cobra.Command, args []string) error {
@@ -123,6 +179,22 @@ func sendTransaction(cmd *cobra.Command, args []string) error {
 	if nonce != "" {
 		req.Nonce = nonce
 	}
+	if reservation != "" {
+		req.Reservation = reservation
+	}
+	if preview {
+		var previewResult map[string]interface{}
+		if err = cli.CallMethod(1, "Wallet.PreviewTransaction", req, &previewResult); err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		bs, err := common.MarshalIndent(previewResult)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bs))
+		return nil
+	}
 	err = cli.CallMethod(1, "Wallet.SendTransaction", req, &result)
 	if err != nil {
 		fmt.Println(err)
@@ -132,6 +204,87 @@ func sendTransaction(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func walletReserve(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &reserveArgs{
+		Address: fromAddr,
+		Value:   args[0],
+		TTL:     args[1],
+	}
+	result := make(map[string]interface{})
+	err = cli.CallMethod(1, "Wallet.Reserve", req, &result)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	fmt.Println(result["id"])
+	return nil
+}
+
+func walletRelease(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return cmd.Help()
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	var r *string = nil
+	err = cli.CallMethod(1, "Wallet.ReleaseReservation", &reservationArgs{ID: args[0]}, &r)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	fmt.Println("Successfully released reservation")
+	return nil
+}
+
+func getWalletReservations(cmd *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	list := make([]map[string]interface{}, 0)
+	err = cli.CallMethod(1, "Wallet.GetReservations", &getWalletByAddressArgs{Address: fromAddr}, &list)
+	if err != nil {
+		return err
+	}
+	bs, err := common.MarshalIndent(list)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+func getWalletTxHistory(cmd *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	list := make([]map[string]interface{}, 0)
+	err = cli.CallMethod(1, "Wallet.GetTransactionHistory", &getWalletByAddressArgs{Address: fromAddr}, &list)
+	if err != nil {
+		return err
+	}
+	bs, err := common.MarshalIndent(list)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
 func walletNew() error {
 	config, err := parseClientConfig(cfgFile)
 	if err != nil {
@@ -206,6 +359,85 @@ func runWalletImport(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runWalletRestore(_ *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	// the archive is decrypted locally, only the key is sent to the node
+	key, err := xfsgo.OpenKeyBackup(data, passphrase)
+	if err != nil {
+		return err
+	}
+	req := &walletImportArgs{
+		Key: "0x" + hex.EncodeToString(crypto.DefaultEncodePrivateKey(key)),
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	var r *string = nil
+	if err = cli.CallMethod(1, "Wallet.ImportByPrivateKey", &req, &r); err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", *r)
+	return nil
+}
+
+func getWalletTotalBalance(_ *cobra.Command, _ []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	res := make(map[string]interface{})
+	if err = cli.CallMethod(1, "Wallet.GetTotalBalance", nil, &res); err != nil {
+		return err
+	}
+	coin := func(v interface{}) float64 {
+		s, _ := v.(string)
+		result, err := common.Atto2BaseRatCoin(s)
+		if err != nil {
+			return 0
+		}
+		rat, _ := result.Float64()
+		return rat
+	}
+	fmt.Println("Address                            Confirmed                     Pending")
+	accounts, _ := res["accounts"].([]interface{})
+	for _, item := range accounts {
+		account, _ := item.(map[string]interface{})
+		fmt.Printf("%-35v%-30.9f%-30.9f", account["address"], coin(account["confirmed"]), coin(account["pending"]))
+		if watchOnly, _ := account["watch_only"].(bool); watchOnly {
+			fmt.Print("watch-only")
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%-35v%-30.9f%-30.9f\n", "Total", coin(res["confirmed"]), coin(res["pending"]))
+	return nil
+}
+
+func runWalletWatch(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("address err")
+	}
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	req := &getWalletByAddressArgs{
+		Address: args[0],
+	}
+	var r *string = nil
+	if err = cli.CallMethod(1, "Wallet.ImportWatchOnly", req, &r); err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", *r)
+	return nil
+}
+
 func setWalletAddrDef(cmd *cobra.Command, args []string) error {
 	config, err := parseClientConfig(cfgFile)
 	if err != nil {
@@ -265,6 +497,14 @@ func getWalletList() error {
 		return err
 	}
 	var balance string
+	watchOnly := make([]common.Address, 0)
+	if err = cli.CallMethod(1, "Wallet.ListWatchOnly", nil, &watchOnly); err != nil {
+		return err
+	}
+	watched := make(map[common.Address]bool, len(watchOnly))
+	for _, addr := range watchOnly {
+		watched[addr] = true
+	}
 	fmt.Print("Address                            Balance                       Default")
 	fmt.Println()
 	for _, w := range walletAddress {
@@ -288,17 +528,54 @@ func getWalletList() error {
 
 		if w == defAddr {
 			fmt.Printf("%-10v", "x")
+		} else if watched[w] {
+			fmt.Printf("%-10v", "watch-only")
 		}
 		fmt.Println()
 	}
 	return nil
 }
+func getWalletSigningLog(_ *cobra.Command, args []string) error {
+	config, err := parseClientConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	req := &getSigningLogArgs{}
+	if len(args) > 0 {
+		req.Start = args[0]
+	}
+	if len(args) > 1 {
+		req.Limit = args[1]
+	}
+	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	res := make(map[string]interface{})
+	if err = cli.CallMethod(1, "Wallet.GetSigningLog", &req, &res); err != nil {
+		return err
+	}
+	records, _ := res["records"].([]interface{})
+	fmt.Printf("Total: %v\n", res["total"])
+	fmt.Println("Seq     Time                 Origin                   Signer                             To                                 Value")
+	for _, item := range records {
+		record, _ := item.(map[string]interface{})
+		seconds, _ := record["time"].(float64)
+		fmt.Printf("%-8v%-21v%-25v%-35v%-35v%v\n", record["seq"],
+			time.Unix(int64(seconds), 0).Format("2006-01-02 15:04:05"),
+			record["origin"], record["signer"], record["to"], record["value"])
+		fmt.Printf("        %v\n", record["hash"])
+	}
+	return nil
+}
 
 func init() {
 	walletCommand.AddCommand(walletListCommand)
 	walletCommand.AddCommand(walletNewCommand)
 	walletCommand.AddCommand(walletDelCommand)
 	walletCommand.AddCommand(walletImportCommand)
+	walletCommand.AddCommand(walletWatchCommand)
+	walletCommand.AddCommand(walletRestoreCommand)
+	walletRestoreCommand.Flags().StringVarP(&passphrase, "passphrase", "p", "", "Set passphrase of the backup archive")
+	walletCommand.AddCommand(walletTotalCommand)
+	walletCommand.AddCommand(walletSigningLogCommand)
 	walletCommand.AddCommand(walletExportCommand)
 	walletCommand.AddCommand(walletGetAddrDefCommand)
 	walletCommand.AddCommand(walletTransferCommand)
@@ -307,6 +584,15 @@ func init() {
 	mFlags.StringVarP(&gasPrice, "gasprice", "", "", "Set transaction gas price")
 	mFlags.StringVarP(&gasLimit, "gaslimit", "", "", "Set transaction gas limit")
 	mFlags.StringVarP(&nonce, "nonce", "", "", "Set transaction nonce")
+	mFlags.StringVarP(&reservation, "reservation", "", "", "Spend the reservation id")
+	mFlags.BoolVarP(&preview, "preview", "", false, "Preview the receipt of the transaction without sending it")
+	walletCommand.AddCommand(walletReserveCommand)
+	walletCommand.AddCommand(walletReleaseCommand)
+	walletCommand.AddCommand(walletReservationsCommand)
+	walletReserveCommand.Flags().StringVarP(&fromAddr, "address", "a", "", "Set address of the reserved balance")
+	walletReservationsCommand.Flags().StringVarP(&fromAddr, "address", "a", "", "Set address of the reservations")
+	walletCommand.AddCommand(walletTxHistoryCommand)
+	walletTxHistoryCommand.Flags().StringVarP(&fromAddr, "address", "a", "", "Set address of the transactions")
 	walletCommand.AddCommand(walletSetAddrDefCommand)
 	rootCmd.AddCommand(walletCommand)
 }
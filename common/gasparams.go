@@ -1,21 +1,67 @@
 package common
 
-import "math/big"
+import (
+	"math/big"
+	"xfsgo/params"
+)
 
-var TxGas = big.NewInt(25000)
+var TxGas = params.TxGas
 var TxGasPrice = big.NewInt(10)
 
-// var GasLimitBoundDivisor = big.NewInt(1024)
-var GenesisGasLimit = new(big.Int).Mul(TxGas, Big100)
-var MinGasLimit = TxGas
+// GasLimitBoundDivisor bounds the change of the gas limit between two blocks, a block
+// may move the gas limit of its parent by at most parent / GasLimitBoundDivisor.
+var GasLimitBoundDivisor = params.GasLimitBoundDivisor
+var GenesisGasLimit = params.GenesisGasLimit
+var MinGasLimit = params.MinGasLimit
 
 var TxPoolGasLimit = new(big.Int).Mul(TxGas, Big100)
 
+// ExtraGasPerByte is the gas charged for each byte written into the extra data of an account.
+var ExtraGasPerByte = params.ExtraGasPerByte
+
+// MaxExtraSize is the maximum size in bytes of the extra data of an account.
+const MaxExtraSize = params.MaxExtraSize
+
 func CalcTxInitialCost(data []byte) *big.Int {
 	igas := new(big.Int).Set(TxGas)
 	return igas
 }
 
+// CalcExtraGas returns the gas required to store the given extra data.
+func CalcExtraGas(extra []byte) *big.Int {
+	return new(big.Int).Mul(ExtraGasPerByte, big.NewInt(int64(len(extra))))
+}
+
+// CalcGasLimit returns the gas limit of a block following the parent one, moving the
+// parent gas limit toward the target as far as the bound allows.
+func CalcGasLimit(parent, target *big.Int) *big.Int {
+	limit := new(big.Int).Set(parent)
+	if target == nil || target.Cmp(MinGasLimit) < 0 {
+		target = MinGasLimit
+	}
+	bound := new(big.Int).Div(parent, GasLimitBoundDivisor)
+	diff := new(big.Int).Sub(target, parent)
+	if diff.CmpAbs(bound) > 0 {
+		diff.Mul(bound, big.NewInt(int64(diff.Sign())))
+	}
+	limit.Add(limit, diff)
+	if limit.Cmp(MinGasLimit) < 0 {
+		limit.Set(MinGasLimit)
+	}
+	return limit
+}
+
+// VerifyGasLimit reports whether the gas limit of a block is within the allowed bound
+// of the parent gas limit.
+func VerifyGasLimit(parent, limit *big.Int) bool {
+	if parent == nil || limit == nil || limit.Cmp(MinGasLimit) < 0 {
+		return false
+	}
+	bound := new(big.Int).Div(parent, GasLimitBoundDivisor)
+	diff := new(big.Int).Sub(limit, parent)
+	return diff.CmpAbs(bound) <= 0
+}
+
 func DefaultGasPrice() *big.Int {
 	return NanoCoin2Atto(TxGasPrice)
 }
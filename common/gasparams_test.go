@@ -0,0 +1,37 @@
+package common
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCalcGasLimit(t *testing.T) {
+	parent := big.NewInt(1024000)
+	tests := []struct {
+		target *big.Int
+		want   *big.Int
+	}{
+		{big.NewInt(1024000), big.NewInt(1024000)},
+		{big.NewInt(1024500), big.NewInt(1024500)},
+		{big.NewInt(2048000), big.NewInt(1025000)},
+		{big.NewInt(0), big.NewInt(1023000)},
+	}
+	for _, tt := range tests {
+		got := CalcGasLimit(parent, tt.target)
+		if got.Cmp(tt.want) != 0 {
+			t.Fatalf("target %s: got %s, want %s", tt.target, got, tt.want)
+		}
+		if !VerifyGasLimit(parent, got) {
+			t.Fatalf("gas limit %s not valid", got)
+		}
+	}
+	if VerifyGasLimit(parent, big.NewInt(1025001)) {
+		t.Fatalf("gas limit out of bound accepted")
+	}
+	if VerifyGasLimit(MinGasLimit, new(big.Int).Sub(MinGasLimit, Big1)) {
+		t.Fatalf("gas limit below minimum accepted")
+	}
+	if got := CalcGasLimit(MinGasLimit, big.NewInt(0)); got.Cmp(MinGasLimit) != 0 {
+		t.Fatalf("got %s, want %s", got, MinGasLimit)
+	}
+}
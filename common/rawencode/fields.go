@@ -0,0 +1,141 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package rawencode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrNotObject       = errors.New("encoded value is not an object")
+	ErrUnknownField    = errors.New("unknown field")
+	ErrMisplacedFields = errors.New("unknown field before known field")
+)
+
+// Field is a field of an encoded object which is unknown to the decoding type,
+// it is kept so the object can be encoded again without losing the field.
+type Field struct {
+	Name  string
+	Value json.RawMessage
+}
+
+// SplitFields returns the fields of the JSON object data which are unknown to the
+// struct type of v. Unknown fields following all known fields are returned as
+// trailing, misplaced reports whether an unknown field precedes a known one.
+func SplitFields(data []byte, v interface{}) (trailing []Field, misplaced bool, err error) {
+	known := knownFields(reflect.TypeOf(v))
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, false, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, false, ErrNotObject
+	}
+	for dec.More() {
+		if tok, err = dec.Token(); err != nil {
+			return nil, false, err
+		}
+		name, _ := tok.(string)
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, false, err
+		}
+		if isKnownField(known, name) {
+			if len(trailing) > 0 {
+				misplaced = true
+				trailing = nil
+			}
+			continue
+		}
+		trailing = append(trailing, Field{Name: name, Value: value})
+	}
+	return trailing, misplaced, nil
+}
+
+// AppendFields appends the fields to the encoded JSON object data.
+func AppendFields(data []byte, fields []Field) ([]byte, error) {
+	if len(fields) == 0 {
+		return data, nil
+	}
+	data = bytes.TrimRight(data, " \n")
+	if len(data) < 2 || data[len(data)-1] != '}' {
+		return nil, ErrNotObject
+	}
+	empty := len(bytes.TrimSpace(data[1:len(data)-1])) == 0
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+	buf.Write(data[:len(data)-1])
+	for _, field := range fields {
+		if !empty {
+			buf.WriteByte(',')
+		}
+		empty = false
+		name, err := json.Marshal(field.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(field.Value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func knownFields(t reflect.Type) map[string]struct{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	known := make(map[string]struct{})
+	if t.Kind() != reflect.Struct {
+		return known
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		known[name] = struct{}{}
+	}
+	return known
+}
+
+func isKnownField(known map[string]struct{}, name string) bool {
+	if _, ok := known[name]; ok {
+		return true
+	}
+	// field names are matched case-insensitively like encoding/json does
+	for k := range known {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,14 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
 )
 
+var ErrNonCanonicalMap = errors.New("non-canonical map encoding")
+
 func SortAndEncodeMap(data map[string]string) string {
 	mapkeys := make([]string, 0)
 	for k, _ := range data {
@@ -42,3 +45,27 @@ func StringDecodeMap(s string) map[string]string {
 	}
 	return result
 }
+
+// StringDecodeMapStrict decodes a map encoded by SortAndEncodeMap and rejects every
+// other encoding of it, the pairs must have non-empty keys and values and be in
+// strictly increasing key order.
+func StringDecodeMapStrict(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	if s == "" {
+		return result, nil
+	}
+	last := ""
+	for i, kv := range strings.Split(s, "&") {
+		mkv := strings.Split(kv, "=")
+		if len(mkv) != 2 || mkv[0] == "" || mkv[1] == "" {
+			return nil, ErrNonCanonicalMap
+		}
+		key, value := mkv[0], mkv[1]
+		if i > 0 && key <= last {
+			return nil, ErrNonCanonicalMap
+		}
+		result[key] = value
+		last = key
+	}
+	return result, nil
+}
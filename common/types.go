@@ -160,8 +160,11 @@ func (h *Hash) UnmarshalJSON(data []byte) error {
 		h.SetBytes([]byte{0})
 		return nil
 	}
-	hash := Hex2Hash(string(data[1 : len(data)-1]))
-	h.SetBytes(hash.Bytes())
+	bs := Hex2bytes(string(data[1 : len(data)-1]))
+	if len(bs) > hashLen {
+		return errors.New("parameter byte length rule failed")
+	}
+	h.SetBytes(bs)
 	return nil
 }
 
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"xfsgo/common/ahash"
+)
+
+const (
+	// BloomByteLength is the number of bytes of a log bloom filter.
+	BloomByteLength = 256
+	bloomBitLength  = 8 * BloomByteLength
+)
+
+var errInvalidBloom = errors.New("invalid bloom length")
+
+// Bloom is a 2048 bits bloom filter over the addresses and topics of logs.
+type Bloom [BloomByteLength]byte
+
+func bloomBits(data []byte) [3]uint {
+	h := ahash.Keccak256(data)
+	var bits [3]uint
+	for i := 0; i < 3; i++ {
+		bits[i] = (uint(h[2*i])<<8 | uint(h[2*i+1])) % bloomBitLength
+	}
+	return bits
+}
+
+func (b *Bloom) Add(data []byte) {
+	for _, bit := range bloomBits(data) {
+		b[BloomByteLength-1-bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Test reports whether the data may have been added to the bloom.
+func (b Bloom) Test(data []byte) bool {
+	for _, bit := range bloomBits(data) {
+		if b[BloomByteLength-1-bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Bloom) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b[:])), nil
+}
+
+func (b *Bloom) UnmarshalText(text []byte) error {
+	bs, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	if len(bs) != BloomByteLength {
+		return errInvalidBloom
+	}
+	copy(b[:], bs)
+	return nil
+}
+
+// CreateBloom returns the bloom of the addresses and topics of the logs.
+func CreateBloom(logs []*Log) Bloom {
+	var b Bloom
+	for _, l := range logs {
+		b.Add(l.Address[:])
+		for _, topic := range l.Topics {
+			b.Add(topic[:])
+		}
+	}
+	return b
+}
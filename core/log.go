@@ -0,0 +1,19 @@
+package core
+
+import "xfsgo/common"
+
+// Log represents a contract event emitted during the execution of a transaction.
+type Log struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    []byte         `json:"data"`
+
+	// The fields below are derived from the position of the log in the chain, they are
+	// not part of the receipt encoding.
+	BlockHeight uint64      `json:"-"`
+	BlockHash   common.Hash `json:"-"`
+	TxHash      common.Hash `json:"-"`
+	TxIndex     uint        `json:"-"`
+	// Index is the position of the log in the block
+	Index uint `json:"-"`
+}
@@ -9,8 +9,30 @@ type StateTree interface {
 	GetNonce(common.Address) uint64
 	AddNonce(addr common.Address, val uint64)
 	GetBalance(common.Address) *big.Int
+	AddBalance(common.Address, *big.Int) error
+	SubBalance(common.Address, *big.Int) error
 	GetCode(common.Address) []byte
+	GetCodeHash(common.Address) common.Hash
+	GetCodeSize(common.Address) int
 	SetState(common.Address, [32]byte, []byte)
 	GetStateValue(common.Address, [32]byte) []byte
 	SetCode(addr common.Address, code []byte)
+	Snapshot() int
+	RevertToSnapshot(int)
+}
+
+// AccessListState is implemented by the state trees tracking the addresses and the
+// storage slots accessed by a transaction, the vm adds the contracts it runs and the
+// storage slots they read and write. Accesses are not charged by it.
+type AccessListState interface {
+	AddAddressToAccessList(addr common.Address)
+	AddSlotToAccessList(addr common.Address, slot [32]byte)
+	AddressInAccessList(addr common.Address) bool
+	SlotInAccessList(addr common.Address, slot [32]byte) (addressOk bool, slotOk bool)
+}
+
+// PreimageState is implemented by the state trees recording the preimages of the hashes
+// computed by the vm, so hashed storage slots can be mapped back to what they derive from.
+type PreimageState interface {
+	AddPreimage(hash common.Hash, preimage []byte)
 }
@@ -0,0 +1,145 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultCrashReports is the number of the recent crash reports kept by the default reporter.
+const defaultCrashReports = 64
+
+// CrashReport is a panic recovered in a module of the node.
+type CrashReport struct {
+	Module string `json:"module"`
+	// Time is the unix time the panic was recovered at.
+	Time  int64  `json:"time"`
+	Error string `json:"error"`
+	Stack string `json:"stack"`
+	// Restarts is the number of times a supervised module was restarted before the panic.
+	Restarts int `json:"restarts"`
+}
+
+// CrashReporter keeps the recent panics recovered in the modules of the node.
+type CrashReporter struct {
+	mu      sync.Mutex
+	limit   int
+	reports []*CrashReport
+}
+
+// DefaultCrashReporter records the panics recovered by the rpc server and the
+// supervised loops of the process.
+var DefaultCrashReporter = NewCrashReporter(defaultCrashReports)
+
+// NewCrashReporter creates a reporter keeping the last limit reports.
+func NewCrashReporter(limit int) *CrashReporter {
+	return &CrashReporter{
+		limit:   limit,
+		reports: make([]*CrashReport, 0),
+	}
+}
+
+// Report records the recovered value of a panic of the module with the stack of the
+// panicking goroutine, it must be called from the deferred function recovering it.
+func (r *CrashReporter) Report(module string, recovered interface{}) *CrashReport {
+	return r.report(module, recovered, 0)
+}
+
+func (r *CrashReporter) report(module string, recovered interface{}, restarts int) *CrashReport {
+	report := &CrashReport{
+		Module:   module,
+		Time:     time.Now().Unix(),
+		Error:    fmt.Sprint(recovered),
+		Stack:    string(debug.Stack()),
+		Restarts: restarts,
+	}
+	logrus.Errorf("Recovered panic: module=%s, err=%s", module, report.Error)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, report)
+	if len(r.reports) > r.limit {
+		r.reports = r.reports[len(r.reports)-r.limit:]
+	}
+	return report
+}
+
+// Reports returns the recent crash reports, the oldest first.
+func (r *CrashReporter) Reports() []*CrashReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reports := make([]*CrashReport, len(r.reports))
+	for i, report := range r.reports {
+		cpy := *report
+		reports[i] = &cpy
+	}
+	return reports
+}
+
+// Recover recovers a panic of the goroutine of the module and records it with the
+// default reporter. It must be deferred directly: defer Recover(module).
+func Recover(module string) {
+	if r := recover(); r != nil {
+		DefaultCrashReporter.Report(module, r)
+	}
+}
+
+// RestartPolicy tells how a supervised loop is restarted after a panic. A negative
+// MaxRestarts restarts the loop without limit, Backoff is the wait before a restart.
+type RestartPolicy struct {
+	MaxRestarts int
+	Backoff     time.Duration
+}
+
+// DefaultRestartPolicy restarts the long running loops of the node after a second,
+// giving up once they panicked ten times.
+var DefaultRestartPolicy = RestartPolicy{
+	MaxRestarts: 10,
+	Backoff:     time.Second,
+}
+
+// Supervise runs the loop of the module until it returns, restarting it by the policy
+// when it panics. The panics are recorded by the default reporter, the module is left
+// stopped when the policy gives up.
+func Supervise(module string, policy RestartPolicy, loop func()) {
+	for restarts := 0; ; restarts++ {
+		if !runRecovered(module, loop, restarts) {
+			return
+		}
+		if policy.MaxRestarts >= 0 && restarts >= policy.MaxRestarts {
+			logrus.Errorf("Module stopped after panics: module=%s, restarts=%d", module, restarts)
+			return
+		}
+		time.Sleep(policy.Backoff)
+	}
+}
+
+// runRecovered runs the function and reports whether it panicked.
+func runRecovered(module string, fn func(), restarts int) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			DefaultCrashReporter.report(module, r, restarts)
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
@@ -0,0 +1,33 @@
+package xfsgo
+
+import (
+	"testing"
+	"xfsgo/assert"
+)
+
+func TestSupervise(t *testing.T) {
+	defer func(r *CrashReporter) {
+		DefaultCrashReporter = r
+	}(DefaultCrashReporter)
+	DefaultCrashReporter = NewCrashReporter(2)
+	runs := 0
+	Supervise("test", RestartPolicy{MaxRestarts: 5}, func() {
+		runs++
+		if runs < 3 {
+			panic("loop failed")
+		}
+	})
+	assert.Equal(t, runs, 3)
+	reports := DefaultCrashReporter.Reports()
+	assert.Equal(t, len(reports), 2)
+	assert.Equal(t, reports[1].Restarts, 1)
+
+	runs = 0
+	Supervise("test", RestartPolicy{MaxRestarts: 2}, func() {
+		runs++
+		panic("loop failed")
+	})
+	assert.Equal(t, runs, 3)
+	// the reporter keeps the last reports only
+	assert.Equal(t, len(DefaultCrashReporter.Reports()), 2)
+}
@@ -66,24 +66,34 @@ func BitsUnzip(bits uint32) *big.Int {
 	return bn
 }
 
-func CalcDifficultyByBits(bits uint32) float64 {
-	return float64(GenesisBits) / float64(bits)
+func CalcDifficultyByBits(genesisBits, bits uint32) float64 {
+	return float64(genesisBits) / float64(bits)
 }
 
-func CalcWorkloadByBits(bits uint32) *big.Int {
+func CalcWorkloadByBits(genesisBits, bits uint32) *big.Int {
 	target := BitsUnzip(bits)
-	max := BitsUnzip(GenesisBits)
+	max := BitsUnzip(genesisBits)
 	difficulty := new(big.Int).Div(max, target)
 	n1 := new(big.Int).Mul(difficulty, common.Big256Bits)
 	return new(big.Int).Div(n1, max)
 }
 
-func CalcHashRateByBits(bits uint32) common.HashRate {
-	df := CalcDifficultyByBits(bits)
+func CalcHashRateByBits(genesisBits, bits uint32) common.HashRate {
+	df := CalcDifficultyByBits(genesisBits, bits)
 	difficulty := new(big.Int).SetInt64(int64(df))
 	n1 := new(big.Int).Mul(difficulty, common.Big256Bits)
-	workload := new(big.Int).Div(n1, BitsUnzip(GenesisBits))
+	workload := new(big.Int).Div(n1, BitsUnzip(genesisBits))
 	workload64 := workload.Uint64()
 	rateN := float64(workload64) / float64(targetTimePerBlock)
 	return common.HashRate(rateN)
 }
+
+// CalcDifficultyByBits returns the difficulty of the bits relative to the genesis of the chain.
+func (bc *BlockChain) CalcDifficultyByBits(bits uint32) float64 {
+	return CalcDifficultyByBits(bc.genesisBHeader.Bits, bits)
+}
+
+// CalcWorkloadByBits returns the work of a block of the bits relative to the genesis of the chain.
+func (bc *BlockChain) CalcWorkloadByBits(bits uint32) *big.Int {
+	return CalcWorkloadByBits(bc.genesisBHeader.Bits, bits)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/big"
 	"testing"
+	"xfsgo/params"
 )
 
 func fullhex(a *big.Int) string {
@@ -34,7 +35,7 @@ func TestAccumulateRewards(t *testing.T) {
 func Test_mainnetG(t *testing.T) {
 	bign0 := BitsUnzip(4278190109)
 	t.Logf("target: %s", fullhex(bign0))
-	blocksPerRetarget := uint64(targetTimespanV4 / targetTimePerBlock)
+	blocksPerRetarget := uint64(params.TargetTimespanV4 / targetTimePerBlock)
 	t.Logf("blocksPerRetarget: %d", blocksPerRetarget)
 	//minRetargetTimespan := targetTimespan / adjustmentFactor
 	//maxRetargetTimespan := targetTimespan * adjustmentFactor
@@ -49,11 +50,11 @@ func Test_mainnetG(t *testing.T) {
 }
 
 func Test_mainnetA(t *testing.T) {
-	hr := CalcHashRateByBits(4278190109)
+	hr := CalcHashRateByBits(MainNetGenesisBits, 4278190109)
 	t.Logf("x: %s", hr.String())
-	bn := CalcWorkloadByBits(4278190109)
+	bn := CalcWorkloadByBits(MainNetGenesisBits, 4278190109)
 	t.Logf("x: %s", bn.Text(16))
-	n := CalcDifficultyByBits(4278190109)
+	n := CalcDifficultyByBits(MainNetGenesisBits, 4278190109)
 
 	t.Logf("n: %f", n)
 	//bign0 := BitsUnzip(4278190109)
@@ -24,28 +24,34 @@ import (
 // EventBus dispatches events to registered receivers. Receivers can be
 // registered to handle events of certain type.
 type EventBus struct {
-	subs map[reflect.Type][]chan interface{}
+	subs map[reflect.Type][]*Subscription
 	rw   sync.RWMutex
 }
 
 type Subscription struct {
-	eb    *EventBus
-	typ   reflect.Type
-	index int
-	c     chan interface{}
+	eb   *EventBus
+	typ  reflect.Type
+	c    chan interface{}
+	quit chan struct{}
+	once sync.Once
 }
 
 func (s *Subscription) Chan() chan interface{} {
 	return s.c
 }
 
+// Unsubscribe removes the subscription from the bus, events published but not yet
+// received are discarded.
 func (s *Subscription) Unsubscribe() {
-	s.eb.unsubscribe(s.typ, s.index)
+	s.once.Do(func() {
+		s.eb.unsubscribe(s)
+		close(s.quit)
+	})
 }
 
 func NewEventBus() *EventBus {
 	return &EventBus{
-		subs: make(map[reflect.Type][]chan interface{}),
+		subs: make(map[reflect.Type][]*Subscription),
 	}
 }
 
@@ -54,18 +60,12 @@ func (e *EventBus) Subscript(t interface{}) *Subscription {
 	defer e.rw.Unlock()
 	rtyp := reflect.TypeOf(t)
 	subtion := &Subscription{
-		typ: rtyp,
-		c:   make(chan interface{}),
-		eb:  e,
-	}
-	if prev, found := e.subs[rtyp]; found {
-		nextIndex := len(prev)
-		subtion.index = nextIndex
-		e.subs[rtyp] = append(prev, subtion.c)
-	} else {
-		subtion.index = 0
-		e.subs[rtyp] = append([]chan interface{}{}, subtion.c)
+		typ:  rtyp,
+		c:    make(chan interface{}),
+		quit: make(chan struct{}),
+		eb:   e,
 	}
+	e.subs[rtyp] = append(e.subs[rtyp], subtion)
 	return subtion
 }
 
@@ -73,20 +73,30 @@ func (e *EventBus) Publish(data interface{}) {
 	e.rw.RLock()
 	defer e.rw.RUnlock()
 	rtyp := reflect.TypeOf(data)
-	if cs, found := e.subs[rtyp]; found {
-		go func(d interface{}, cs []chan interface{}) {
-			for _, ch := range cs {
-				ch <- d
+	if subs, found := e.subs[rtyp]; found {
+		subs = append([]*Subscription{}, subs...)
+		go func(d interface{}, subs []*Subscription) {
+			for _, sub := range subs {
+				select {
+				case sub.c <- d:
+				case <-sub.quit:
+				}
 			}
-		}(data, cs)
+		}(data, subs)
 	}
 }
 
-func (e *EventBus) unsubscribe(data interface{}, index int) {
+func (e *EventBus) unsubscribe(sub *Subscription) {
 	e.rw.Lock()
 	defer e.rw.Unlock()
-	rtyp := reflect.TypeOf(data)
-	if old, found := e.subs[rtyp]; found {
-		e.subs[rtyp] = append(old[:index], old[index+1:]...)
+	old := e.subs[sub.typ]
+	for i, s := range old {
+		if s == sub {
+			e.subs[sub.typ] = append(old[:i:i], old[i+1:]...)
+			break
+		}
+	}
+	if len(e.subs[sub.typ]) == 0 {
+		delete(e.subs, sub.typ)
 	}
 }
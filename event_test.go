@@ -0,0 +1,29 @@
+package xfsgo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBus_Unsubscribe(t *testing.T) {
+	bus := NewEventBus()
+	a := bus.Subscript(TxPreEvent{})
+	b := bus.Subscript(TxPreEvent{})
+	a.Unsubscribe()
+	a.Unsubscribe()
+	bus.Publish(TxPreEvent{})
+	select {
+	case <-b.Chan():
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+	select {
+	case <-a.Chan():
+		t.Fatal("event received after unsubscribe")
+	case <-time.After(10 * time.Millisecond):
+	}
+	b.Unsubscribe()
+	if len(bus.subs) != 0 {
+		t.Fatalf("got %d subscribed types, want 0", len(bus.subs))
+	}
+}
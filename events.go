@@ -16,7 +16,10 @@
 
 package xfsgo
 
-import "math/big"
+import (
+	"math/big"
+	"xfsgo/common"
+)
 
 type SyncStartEvent struct{}
 type SyncDoneEvent struct{}
@@ -27,6 +30,34 @@ type TxPreEvent struct {
 	Tx *Transaction
 }
 
+// Kinds of the tx pool events.
+const (
+	TxPoolAccepted = "accepted"
+	TxPoolReplaced = "replaced"
+	TxPoolDropped  = "dropped"
+)
+
+// Reasons of the tx pool dropping a transaction.
+const (
+	TxDropUnderpriced = "underpriced"
+	TxDropExpired     = "expired"
+	TxDropInvalid     = "invalid"
+	TxDropQueueFull   = "queue_full"
+	// TxDropRejected is the reason of transactions rejected by an admission validator.
+	TxDropRejected = "rejected"
+)
+
+// TxPoolEvent is posted when the tx pool accepts, replaces or drops a transaction.
+type TxPoolEvent struct {
+	Kind string
+	Tx   *Transaction
+	// ReplacedBy is the hash of the transaction replacing a replaced transaction.
+	ReplacedBy common.Hash
+	// Reason and Error explain why a transaction was dropped.
+	Reason string
+	Error  string
+}
+
 type TxPostEvent struct {
 	Tx *Transaction
 }
@@ -35,6 +66,15 @@ type ChainHeadEvent struct {
 	Block *Block
 }
 
+// ChainReorgEvent is published when blocks are dropped from the canonical chain by a
+// reorg, Added holds the hashes of the blocks of the new canonical chain. Orphaned are
+// the transactions of the dropped blocks which the new chain does not include.
+type ChainReorgEvent struct {
+	Dropped  []common.Hash
+	Added    []common.Hash
+	Orphaned []*Transaction
+}
+
 type GasPriceChanged struct {
 	Price *big.Int
 }
@@ -0,0 +1,140 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+	"xfsgo/common"
+)
+
+// faucetPruneSize is the number of tracked addresses and ips above which
+// expired entries are dropped.
+const faucetPruneSize = 1024
+
+var (
+	ErrFaucetAddressLimited = errors.New("faucet already sent to the address recently")
+	ErrFaucetIPLimited      = errors.New("faucet request limit of the ip reached")
+	ErrFaucetAmountTooLarge = errors.New("faucet amount exceeds the cap")
+)
+
+// FaucetConfig configures the faucet of a dev or test network.
+type FaucetConfig struct {
+	// Account is the wallet address the faucet sends from.
+	Account common.Address
+	// Amount is the most a single request receives.
+	Amount *big.Int
+	// Interval is the time an address waits between two requests and the
+	// window the requests of an ip are counted in.
+	Interval time.Duration
+	// IPRequests is the number of requests allowed from an ip per Interval.
+	IPRequests int
+}
+
+// Faucet rate limits the requests of the faucet by the receiving address and the ip
+// of the client. The limits are kept in memory and reset when the node restarts.
+type Faucet struct {
+	config FaucetConfig
+	mu     sync.Mutex
+	addrs  map[common.Address]time.Time
+	ips    map[string][]time.Time
+	now    func() time.Time
+}
+
+func NewFaucet(config FaucetConfig) *Faucet {
+	return &Faucet{
+		config: config,
+		addrs:  make(map[common.Address]time.Time),
+		ips:    make(map[string][]time.Time),
+		now:    time.Now,
+	}
+}
+
+func (f *Faucet) Config() FaucetConfig {
+	return f.config
+}
+
+// Take takes a request of the amount to the address from the ip if both are within
+// their limits. The returned cancel func gives the request back when the transfer fails.
+func (f *Faucet) Take(addr common.Address, ip string, amount *big.Int) (cancel func(), err error) {
+	if amount.Cmp(f.config.Amount) > 0 {
+		return nil, ErrFaucetAmountTooLarge
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	since := now.Add(-f.config.Interval)
+	f.prune(since)
+	last, exists := f.addrs[addr]
+	if exists && last.After(since) {
+		return nil, ErrFaucetAddressLimited
+	}
+	requests := recentTimes(f.ips[ip], since)
+	if f.config.IPRequests > 0 && len(requests) >= f.config.IPRequests {
+		return nil, ErrFaucetIPLimited
+	}
+	f.addrs[addr] = now
+	// requests of unknown ips are only limited by the address
+	if ip != "" {
+		f.ips[ip] = append(requests, now)
+	}
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if exists {
+			f.addrs[addr] = last
+		} else {
+			delete(f.addrs, addr)
+		}
+		times := f.ips[ip]
+		for i := len(times) - 1; i >= 0; i-- {
+			if times[i].Equal(now) {
+				f.ips[ip] = append(times[:i], times[i+1:]...)
+				break
+			}
+		}
+	}, nil
+}
+
+func (f *Faucet) prune(since time.Time) {
+	if len(f.addrs) > faucetPruneSize {
+		for addr, last := range f.addrs {
+			if !last.After(since) {
+				delete(f.addrs, addr)
+			}
+		}
+	}
+	if len(f.ips) > faucetPruneSize {
+		for ip, times := range f.ips {
+			if len(recentTimes(times, since)) == 0 {
+				delete(f.ips, ip)
+			}
+		}
+	}
+}
+
+// recentTimes returns the times after since of the ascending times.
+func recentTimes(times []time.Time, since time.Time) []time.Time {
+	for i, t := range times {
+		if t.After(since) {
+			return times[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"time"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+func TestFaucet_Take(t *testing.T) {
+	f := NewFaucet(FaucetConfig{
+		Amount:     big.NewInt(100),
+		Interval:   time.Hour,
+		IPRequests: 2,
+	})
+	now := time.Unix(1000, 0)
+	f.now = func() time.Time { return now }
+	a, b, c := common.Address{1}, common.Address{2}, common.Address{3}
+	_, err := f.Take(a, "10.0.0.1", big.NewInt(101))
+	assert.Equal(t, err, ErrFaucetAmountTooLarge)
+	if _, err = f.Take(a, "10.0.0.1", big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Take(a, "10.0.0.2", big.NewInt(1))
+	assert.Equal(t, err, ErrFaucetAddressLimited)
+	cancel, err := f.Take(b, "10.0.0.1", big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Take(c, "10.0.0.1", big.NewInt(1))
+	assert.Equal(t, err, ErrFaucetIPLimited)
+	// a failed transfer gives the request back
+	cancel()
+	if _, err = f.Take(c, "10.0.0.1", big.NewInt(1)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour + time.Second)
+	if _, err = f.Take(a, "10.0.0.1", big.NewInt(1)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+var (
+	// ErrForkIDRemoteStale is returned for a peer which has not applied a fork the
+	// local chain passed, it runs an outdated rule set.
+	ErrForkIDRemoteStale = errors.New("remote fork id stale")
+	// ErrForkIDIncompatible is returned for a peer following other chain rules, a fork
+	// the local chain passed is unknown to it or it passed a fork unknown locally.
+	ErrForkIDIncompatible = errors.New("incompatible fork id")
+)
+
+// ForkID identifies the rules of a chain at a height. Hash is the checksum of the
+// genesis hash and the heights of the forks passed, Next is the height of the next
+// fork known to the node or zero.
+type ForkID struct {
+	Hash common.Hash `json:"hash"`
+	Next uint64      `json:"next"`
+}
+
+// ForkFilter computes the fork id of the local chain and checks the fork ids of peers.
+type ForkFilter struct {
+	forks []uint64
+	// sums holds the checksum of the genesis and the first i forks at index i
+	sums []common.Hash
+}
+
+func forkSum(sum common.Hash, height uint64) common.Hash {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], height)
+	return common.Bytes2Hash(ahash.SHA256(append(sum[:], buf[:]...)))
+}
+
+// NewForkFilter returns the fork filter of the chain of the genesis with the forks of
+// the chain config.
+func NewForkFilter(genesis common.Hash, config *ChainConfig) *ForkFilter {
+	return newForkFilter(genesis, config.ForkHeights())
+}
+
+// ForkFilter returns the fork filter of the chain with the forks of the chain config.
+func (bc *BlockChain) ForkFilter() *ForkFilter {
+	return NewForkFilter(bc.genesisBHeader.HeaderHash(), bc.ChainConfig())
+}
+
+func newForkFilter(genesis common.Hash, forks []uint64) *ForkFilter {
+	f := &ForkFilter{
+		forks: forks,
+		sums:  []common.Hash{common.Bytes2Hash(ahash.SHA256(genesis[:]))},
+	}
+	for i, height := range forks {
+		f.sums = append(f.sums, forkSum(f.sums[i], height))
+	}
+	return f
+}
+
+// passed returns the number of forks passed at the height.
+func (f *ForkFilter) passed(head uint64) int {
+	n := 0
+	for n < len(f.forks) && f.forks[n] <= head {
+		n++
+	}
+	return n
+}
+
+// ID returns the fork id of the local chain at the head height.
+func (f *ForkFilter) ID(head uint64) ForkID {
+	n := f.passed(head)
+	id := ForkID{Hash: f.sums[n]}
+	if n < len(f.forks) {
+		id.Next = f.forks[n]
+	}
+	return id
+}
+
+// Check verifies the fork id of a peer against the local chain at the head height. A
+// peer on an earlier rule set of the chain is accepted unless it does not know the
+// next fork, a peer ahead of the local chain is accepted as the local node may be the
+// one syncing.
+func (f *ForkFilter) Check(id ForkID, head uint64) error {
+	n := f.passed(head)
+	for i, sum := range f.sums {
+		if sum != id.Hash {
+			continue
+		}
+		switch {
+		case i == n:
+			// same rules, the peer announces a fork the local chain already passed
+			if id.Next != 0 && head >= id.Next {
+				return ErrForkIDIncompatible
+			}
+			return nil
+		case i < n:
+			// the peer is behind, it must know the fork it is about to reach
+			if id.Next != f.forks[i] {
+				return ErrForkIDRemoteStale
+			}
+			return nil
+		default:
+			// the peer passed forks known locally but not reached yet
+			return nil
+		}
+	}
+	return ErrForkIDIncompatible
+}
@@ -0,0 +1,48 @@
+package xfsgo
+
+import (
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+func TestChainConfig_ForkHeights(t *testing.T) {
+	c := &ChainConfig{Forks: map[string]uint64{"a": 200, "b": 100, "c": 0, "d": 200}}
+	assert.Equal(t, c.ForkHeights(), []uint64{100, 200})
+	assert.Equal(t, MainNetChainConfig.ForkHeights(), []uint64{})
+}
+
+func TestForkFilter_Check(t *testing.T) {
+	genesis := common.Hash{0x01}
+	local := newForkFilter(genesis, []uint64{100, 200})
+	assert.Equal(t, local.ID(0).Next, uint64(100))
+	assert.Equal(t, local.ID(150), ForkID{Hash: local.sums[1], Next: 200})
+	assert.Equal(t, local.ID(300), ForkID{Hash: local.sums[2]})
+	tests := []struct {
+		head uint64
+		id   ForkID
+		err  error
+	}{
+		// same rules and the same next fork
+		{150, ForkID{Hash: local.sums[1], Next: 200}, nil},
+		// the remote does not know the next fork yet, it is not reached
+		{150, ForkID{Hash: local.sums[1]}, nil},
+		// the remote announces a fork at a height the local chain passed without it
+		{150, ForkID{Hash: local.sums[1], Next: 120}, ErrForkIDIncompatible},
+		// the remote is syncing behind a fork it knows
+		{250, ForkID{Hash: local.sums[0], Next: 100}, nil},
+		// the remote is behind a fork it does not know
+		{250, ForkID{Hash: local.sums[1]}, ErrForkIDRemoteStale},
+		{250, ForkID{Hash: local.sums[1], Next: 210}, ErrForkIDRemoteStale},
+		// the remote passed forks the local chain did not reach
+		{50, ForkID{Hash: local.sums[2]}, nil},
+		// another genesis or fork history
+		{150, newForkFilter(common.Hash{0x02}, []uint64{100}).ID(150), ErrForkIDIncompatible},
+		{250, newForkFilter(genesis, []uint64{100, 201}).ID(250), ErrForkIDIncompatible},
+	}
+	for i, test := range tests {
+		if err := local.Check(test.id, test.head); err != test.err {
+			t.Fatalf("test %d: want %v, got %v", i, test.err, err)
+		}
+	}
+}
@@ -18,23 +18,49 @@ package xfsgo
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/big"
 	"strings"
 	"xfsgo/common"
+	"xfsgo/params"
 	"xfsgo/storage/badger"
 
 	"github.com/sirupsen/logrus"
 )
 
+var ErrInvalidBlockPeriod = errors.New("invalid block period")
+
 var (
-	MainNetGenesisBits = uint32(267386909)
-	TestNetGenesisBits = uint32(4278190109)
-	GenesisBits        = MainNetGenesisBits
+	MainNetGenesisBits = params.MainNetGenesisBits
+	TestNetGenesisBits = params.TestNetGenesisBits
+	// GenesisSchedule is the block schedule of the chain set by the genesis,
+	// blocks are mined continuously if it is nil.
+	GenesisSchedule *BlockSchedule
 )
 
+// BlockSchedule configures the block production of private chains, blocks are
+// produced in slots of a fixed period following the timestamp of the parent block.
+type BlockSchedule struct {
+	// Period is the time between two blocks in seconds.
+	Period uint64 `json:"period"`
+	// SkipEmpty skips the slots in which no transactions are pending.
+	SkipEmpty bool `json:"skip_empty"`
+}
+
+// NextSlot returns the timestamp of the first slot after the parent block which
+// is not before the given time.
+func (s *BlockSchedule) NextSlot(parent uint64, notBefore uint64) uint64 {
+	slot := parent + s.Period
+	if notBefore > slot {
+		missed := (notBefore - slot + s.Period - 1) / s.Period
+		slot += missed * s.Period
+	}
+	return slot
+}
+
 // WriteGenesisBlock constructs the genesis block for the blockchain and stores it in the hd.
 func WriteGenesisBlock(stateDB, chainDB badger.IStorage, reader io.Reader) (*Block, error) {
 	return WriteGenesisBlockN(stateDB, chainDB, reader, false)
@@ -57,17 +83,30 @@ func WriteGenesisBlockN(stateDB, chainDB badger.IStorage, reader io.Reader, debu
 		Accounts      map[string]struct {
 			Balance string `json:"balance"`
 		} `json:"accounts"`
+		Schedule *BlockSchedule `json:"schedule"`
+		Config   *ChainConfig   `json:"config"`
 	}
 	if err = json.Unmarshal(contents, &genesis); err != nil {
 		return nil, err
 	}
+	if genesis.Schedule != nil && genesis.Schedule.Period == 0 {
+		return nil, ErrInvalidBlockPeriod
+	}
+	if genesis.Config != nil {
+		if err = genesis.Config.Verify(); err != nil {
+			return nil, err
+		}
+	}
 	chaindb := newChainDBN(chainDB, debug)
 	stateTree := NewStateTree(stateDB, nil)
+	stateTree.SetForkRules(genesisChainConfig(genesis.Config, genesis.Bits), 0)
 	//logrus.Debugf("initialize genesis account count: %d", len(genesis.Accounts))
 	for addr, a := range genesis.Accounts {
 		address := common.B58ToAddress([]byte(addr))
 		balance := common.ParseString2BigInt(a.Balance)
-		stateTree.AddBalance(address, balance)
+		if err = stateTree.AddBalance(address, balance); err != nil {
+			return nil, err
+		}
 		//logrus.Debugf("initialize genesis account: %s, balance: %d", address, balance)
 	}
 	stateTree.UpdateAll()
@@ -76,7 +115,8 @@ func WriteGenesisBlockN(stateDB, chainDB badger.IStorage, reader io.Reader, debu
 	if genesis.Coinbase != "" {
 		coinbase = common.B58ToAddress([]byte(genesis.Coinbase))
 	}
-	GenesisBits = genesis.Bits
+	GenesisSchedule = genesis.Schedule
+	GenesisConfig = genesis.Config
 	rootHash := common.Bytes2Hash(stateTree.Root())
 	HashPrevBlock := common.Hex2Hash(genesis.HashPrevBlock)
 	block := NewBlock(&BlockHeader{
@@ -0,0 +1,91 @@
+package xfsgo
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/params"
+)
+
+func TestBlockSchedule_NextSlot(t *testing.T) {
+	s := &BlockSchedule{Period: 5}
+	assert.Equal(t, s.NextSlot(100, 0), uint64(105))
+	assert.Equal(t, s.NextSlot(100, 105), uint64(105))
+	assert.Equal(t, s.NextSlot(100, 106), uint64(110))
+	assert.Equal(t, s.NextSlot(100, 117), uint64(120))
+}
+
+func TestWriteGenesisBlock_schedule(t *testing.T) {
+	defer func() {
+		GenesisSchedule = nil
+	}()
+	genesis := `{"bits": 4278190109, "schedule": {"period": 5, "skip_empty": true}}`
+	if _, err := WriteGenesisBlock(newTestStateDB(t), newTestStateDB(t), strings.NewReader(genesis)); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, GenesisSchedule, &BlockSchedule{Period: 5, SkipEmpty: true})
+	genesis = `{"bits": 4278190109, "schedule": {"period": 0}}`
+	_, err := WriteGenesisBlock(newTestStateDB(t), newTestStateDB(t), strings.NewReader(genesis))
+	assert.Equal(t, err, ErrInvalidBlockPeriod)
+}
+
+func TestRewardSchedule_BlockReward(t *testing.T) {
+	assert.BigIntEqual(t, MainNetChainConfig.BlockReward(0), params.MainNetInitialReward)
+	assert.BigIntEqual(t, MainNetChainConfig.BlockReward(960), new(big.Int).Rsh(params.MainNetInitialReward, 2))
+	assert.BigIntEqual(t, TestNetChainConfig.BlockReward(1e9), params.TestNetReward)
+	s := &RewardSchedule{
+		InitialReward:    big.NewInt(1000),
+		Interval:         10,
+		ReductionPercent: 10,
+		MinReward:        big.NewInt(800),
+	}
+	assert.Equal(t, s.Verify(), nil)
+	assert.BigIntEqual(t, s.BlockReward(9), big.NewInt(1000))
+	assert.BigIntEqual(t, s.BlockReward(10), big.NewInt(900))
+	assert.BigIntEqual(t, s.BlockReward(25), big.NewInt(810))
+	assert.BigIntEqual(t, s.BlockReward(30), big.NewInt(800))
+	s.ReductionPercent = 0
+	assert.Equal(t, s.Verify(), ErrInvalidRewardSchedule)
+}
+
+func TestWriteGenesisBlock_config(t *testing.T) {
+	defer func() {
+		GenesisConfig = nil
+	}()
+	genesis := `{"bits": 4278190109, "config": {"reward": {"initial_reward": 500, "interval": 100, "reduction_percent": 50}}}`
+	if _, err := WriteGenesisBlock(newTestStateDB(t), newTestStateDB(t), strings.NewReader(genesis)); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, GenesisConfig.BlockReward(250), big.NewInt(125))
+	genesis = `{"bits": 4278190109, "config": {"reward": {"interval": 100}}}`
+	_, err := WriteGenesisBlock(newTestStateDB(t), newTestStateDB(t), strings.NewReader(genesis))
+	assert.Equal(t, err, ErrInvalidRewardSchedule)
+}
+
+func TestChainConfig_VerifyTxSize(t *testing.T) {
+	c := &ChainConfig{MaxTxDataSize: 100, MaxCodeSize: 10}
+	call := NewTransactionByStd(&StdTransaction{To: common.Address{0x01}, Data: make([]byte, 100)})
+	assert.Equal(t, c.VerifyTxSize(call), nil)
+	call.Data = make([]byte, 101)
+	assert.Equal(t, c.VerifyTxSize(call), ErrTxDataTooLarge)
+	create := NewTransactionByStd(&StdTransaction{Data: make([]byte, 11)})
+	assert.Equal(t, c.VerifyTxSize(create), ErrCodeTooLarge)
+	assert.Equal(t, MainNetChainConfig.CodeSizeLimit(), uint64(DefaultMaxCodeSize))
+}
+
+func TestChainConfig_params(t *testing.T) {
+	c := new(ChainConfig)
+	assert.Equal(t, c.TimeOffsetLimit(), params.MaxTimeOffset)
+	assert.Equal(t, c.MedianTimeSpan(), params.MedianTimeBlocks)
+	assert.Equal(t, c.RetargetAdjustment(), params.RetargetAdjustmentFactor)
+	assert.Equal(t, c.TxDataLimit(), uint64(params.MaxTxDataSize))
+	if err := json.Unmarshal([]byte(`{"max_time_offset": 60, "median_time_blocks": 3, "retarget_factor": 4}`), c); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, c.TimeOffsetLimit(), int64(60))
+	assert.Equal(t, c.MedianTimeSpan(), 3)
+	assert.Equal(t, c.RetargetAdjustment(), int64(4))
+}
@@ -0,0 +1,214 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"xfsgo/common"
+	"xfsgo/mmr"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	headerMMRPre     = []byte("hm:")
+	headerMMRSizeKey = []byte("HeaderMMRSize")
+)
+
+var (
+	ErrNotAncestor   = errors.New("block is not an ancestor of head")
+	ErrBlockNotFound = errors.New("main chain block not found")
+)
+
+// HeaderCommitment is the root of the merkle mountain range over the hashes of the main
+// chain headers from the genesis block to the block with the given height.
+type HeaderCommitment struct {
+	Height uint64
+	Hash   common.Hash
+	Root   common.Hash
+}
+
+// headerMMRStore stores the nodes of the header mountain range in the chain db.
+type headerMMRStore struct {
+	db *chainDB
+}
+
+func headerMMRKey(level uint8, index uint64) []byte {
+	// hm:<level_8bits><index_64bits> -> <hash>
+	key := make([]byte, 0, len(headerMMRPre)+9)
+	key = append(key, headerMMRPre...)
+	key = append(key, level)
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], index)
+	return append(key, numBuf[:]...)
+}
+
+func (s *headerMMRStore) GetNode(level uint8, index uint64) ([]byte, error) {
+	val, err := s.db.storage.GetData(headerMMRKey(level, index))
+	if err != nil {
+		return nil, nil
+	}
+	return val, nil
+}
+
+func (s *headerMMRStore) PutNode(level uint8, index uint64, hash []byte) error {
+	return s.db.storage.SetData(headerMMRKey(level, index), hash)
+}
+
+// getHeaderMMRSize returns the number of main chain headers in the mountain range.
+func (db *chainDB) getHeaderMMRSize() uint64 {
+	val, err := db.storage.GetData(headerMMRSizeKey)
+	if err != nil || len(val) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(val)
+}
+
+func (db *chainDB) writeHeaderMMRSize(size uint64) error {
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], size)
+	return db.storage.SetData(headerMMRSizeKey, numBuf[:])
+}
+
+// truncateHeaderMMR drops the headers from height on from the mountain range when the
+// main chain header of the height is replaced.
+func (db *chainDB) truncateHeaderMMR(height uint64) error {
+	if db.getHeaderMMRSize() <= height {
+		return nil
+	}
+	return db.writeHeaderMMRSize(height)
+}
+
+func (db *chainDB) getBlockHashByHeight(height uint64) (common.Hash, bool) {
+	var numBuf [8]byte
+	binary.LittleEndian.PutUint64(numBuf[:], height)
+	key := append(blockHeightPre, numBuf[:]...)
+	val, err := db.storage.GetData(key)
+	if err != nil || len(val) != len(common.Hash{}) {
+		return common.Hash{}, false
+	}
+	return common.Bytes2Hash(val), true
+}
+
+// headerMMR returns the mountain range of the main chain headers up to the height. The
+// range follows the main chain lazily, headers of the main chain are appended when the
+// range is used. It must be called with mmrMu held.
+func (bc *BlockChain) headerMMR(height uint64) (*mmr.MMR, error) {
+	m := mmr.New(&headerMMRStore{db: bc.chainDB}, bc.chainDB.getHeaderMMRSize())
+	if m.Size() > height {
+		return m, nil
+	}
+	start := m.Size()
+	for h := start; h <= height; h++ {
+		hash, ok := bc.chainDB.getBlockHashByHeight(h)
+		if !ok {
+			return nil, ErrBlockNotFound
+		}
+		if err := m.Append(hash.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := bc.chainDB.writeHeaderMMRSize(m.Size()); err != nil {
+		return nil, err
+	}
+	logrus.Debugf("Extended header commitments: from=%d, to=%d", start, height)
+	return m, nil
+}
+
+// GetHeaderCommitment returns the commitment to the main chain headers up to the height.
+func (bc *BlockChain) GetHeaderCommitment(height uint64) (*HeaderCommitment, error) {
+	bc.mmrMu.Lock()
+	defer bc.mmrMu.Unlock()
+	m, err := bc.headerMMR(height)
+	if err != nil {
+		return nil, err
+	}
+	root, err := m.RootAt(height + 1)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := m.Leaf(height)
+	if err != nil {
+		return nil, err
+	}
+	return &HeaderCommitment{
+		Height: height,
+		Hash:   common.Bytes2Hash(leaf),
+		Root:   common.Bytes2Hash(root),
+	}, nil
+}
+
+// AncestorProof proves the block with the hash is the main chain block with the number,
+// below the head of the commitment.
+type AncestorProof struct {
+	Number uint64
+	Hash   common.Hash
+	Head   *HeaderCommitment
+	Proof  *mmr.Proof
+}
+
+// ProveAncestor returns the proof that the main chain block with the given number is an
+// ancestor of the main chain block head, against the header commitment of head.
+func (bc *BlockChain) ProveAncestor(number, head uint64) (*AncestorProof, error) {
+	if number > head {
+		return nil, ErrNotAncestor
+	}
+	bc.mmrMu.Lock()
+	defer bc.mmrMu.Unlock()
+	m, err := bc.headerMMR(head)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := m.Prove(number, head+1)
+	if err != nil {
+		return nil, err
+	}
+	root, err := m.RootAt(head + 1)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := m.Leaf(number)
+	if err != nil {
+		return nil, err
+	}
+	headLeaf, err := m.Leaf(head)
+	if err != nil {
+		return nil, err
+	}
+	return &AncestorProof{
+		Number: number,
+		Hash:   common.Bytes2Hash(leaf),
+		Head: &HeaderCommitment{
+			Height: head,
+			Hash:   common.Bytes2Hash(headLeaf),
+			Root:   common.Bytes2Hash(root),
+		},
+		Proof: proof,
+	}, nil
+}
+
+// VerifyAncestorProof checks the proof against the root of a trusted header commitment.
+func VerifyAncestorProof(root common.Hash, p *AncestorProof) error {
+	if p == nil || p.Proof == nil || p.Proof.Index != p.Number {
+		return ErrNotAncestor
+	}
+	if err := mmr.VerifyProof(root.Bytes(), p.Hash.Bytes(), p.Proof); err != nil {
+		return ErrNotAncestor
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"xfsgo/common"
+)
+
+// journalEntry is a modification of the state which can be reverted.
+type journalEntry interface {
+	revert(st *StateTree)
+}
+
+type revision struct {
+	id    int
+	index int
+}
+
+// stateJournal records the modifications applied to the state objects of a StateTree,
+// so that the state can be rolled back to a snapshot taken earlier. dirties holds the
+// addresses of the objects modified since the last update of the tree.
+type stateJournal struct {
+	entries   []journalEntry
+	revisions []revision
+	nextId    int
+	dirties   map[common.Address]struct{}
+}
+
+func newStateJournal() *stateJournal {
+	return &stateJournal{
+		entries:   make([]journalEntry, 0),
+		revisions: make([]revision, 0),
+		dirties:   make(map[common.Address]struct{}),
+	}
+}
+
+func (j *stateJournal) markDirty(addr common.Address) {
+	j.dirties[addr] = struct{}{}
+}
+
+// sortedDirties returns the addresses of the modified objects in ascending order.
+func (j *stateJournal) sortedDirties() []common.Address {
+	addrs := make([]common.Address, 0, len(j.dirties))
+	for addr := range j.dirties {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, k int) bool {
+		return bytes.Compare(addrs[i][:], addrs[k][:]) < 0
+	})
+	return addrs
+}
+
+func (j *stateJournal) append(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+}
+
+func (j *stateJournal) snapshot() int {
+	id := j.nextId
+	j.nextId++
+	j.revisions = append(j.revisions, revision{id: id, index: len(j.entries)})
+	return id
+}
+
+func (j *stateJournal) revertToSnapshot(st *StateTree, id int) bool {
+	idx := sort.Search(len(j.revisions), func(i int) bool {
+		return j.revisions[i].id >= id
+	})
+	if idx == len(j.revisions) || j.revisions[idx].id != id {
+		return false
+	}
+	index := j.revisions[idx].index
+	for i := len(j.entries) - 1; i >= index; i-- {
+		j.entries[i].revert(st)
+	}
+	j.entries = j.entries[:index]
+	j.revisions = j.revisions[:idx]
+	return true
+}
+
+func (j *stateJournal) reset() {
+	j.entries = j.entries[:0]
+	j.revisions = j.revisions[:0]
+	j.dirties = make(map[common.Address]struct{})
+}
+
+type (
+	balanceChange struct {
+		obj  *StateObj
+		prev *big.Int
+	}
+	nonceChange struct {
+		obj  *StateObj
+		prev uint64
+	}
+	codeChange struct {
+		obj       *StateObj
+		prevCode  []byte
+		prevHash  common.Hash
+		prevDirty bool
+	}
+	storageChange struct {
+		obj     *StateObj
+		key     [32]byte
+		prev    []byte
+		existed bool
+	}
+	extraChange struct {
+		obj  *StateObj
+		prev []byte
+	}
+	suicideChange struct {
+		obj         *StateObj
+		prev        bool
+		prevBalance *big.Int
+	}
+	accessListAddAccountChange struct {
+		addr common.Address
+	}
+	accessListAddSlotChange struct {
+		addr common.Address
+		slot [32]byte
+	}
+	addLogChange struct {
+		txHash common.Hash
+	}
+	addPreimageChange struct {
+		hash common.Hash
+	}
+	// createObjectChange is the creation of an account, prev is the object it replaced
+	createObjectChange struct {
+		addr common.Address
+		prev *StateObj
+	}
+)
+
+func (ch balanceChange) revert(*StateTree) {
+	ch.obj.balance = ch.prev
+}
+
+func (ch nonceChange) revert(*StateTree) {
+	ch.obj.nonce = ch.prev
+}
+
+func (ch codeChange) revert(*StateTree) {
+	ch.obj.code = ch.prevCode
+	ch.obj.codeHash = ch.prevHash
+	ch.obj.dirtyCode = ch.prevDirty
+}
+
+func (ch storageChange) revert(*StateTree) {
+	if !ch.existed {
+		delete(ch.obj.cacheStorage, ch.key)
+		return
+	}
+	ch.obj.cacheStorage[ch.key] = ch.prev
+}
+
+func (ch extraChange) revert(*StateTree) {
+	ch.obj.extra = ch.prev
+}
+
+func (ch suicideChange) revert(*StateTree) {
+	ch.obj.suicided = ch.prev
+	ch.obj.balance = ch.prevBalance
+}
+
+func (ch accessListAddAccountChange) revert(st *StateTree) {
+	st.accessList.deleteAddress(ch.addr)
+}
+
+func (ch accessListAddSlotChange) revert(st *StateTree) {
+	st.accessList.deleteSlot(ch.addr, ch.slot)
+}
+
+func (ch addLogChange) revert(st *StateTree) {
+	logs := st.logs[ch.txHash]
+	if len(logs) == 1 {
+		delete(st.logs, ch.txHash)
+	} else {
+		st.logs[ch.txHash] = logs[:len(logs)-1]
+	}
+	st.logSize--
+}
+
+func (ch addPreimageChange) revert(st *StateTree) {
+	delete(st.preimages, ch.hash)
+}
+
+func (ch createObjectChange) revert(st *StateTree) {
+	if ch.prev == nil {
+		delete(st.objs, ch.addr)
+		return
+	}
+	st.objs[ch.addr] = ch.prev
+}
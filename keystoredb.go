@@ -27,6 +27,7 @@ import (
 var (
 	addrKeyPre        = []byte("addr:")
 	addNewTime        = []byte("newtime:")
+	watchAddrKeyPre   = []byte("watch:")
 	defaultAddressKey = []byte("default")
 )
 
@@ -142,3 +143,32 @@ func (db *keyStoreDB) DelDefault() error {
 
 	return nil
 }
+
+// PutWatchAddress stores the address watched without a private key.
+func (db *keyStoreDB) PutWatchAddress(addr common.Address) error {
+	newTimeKey := append(addNewTime, addr.Bytes()...)
+	newTime := time.Now().Unix()
+	if err := db.storage.SetData(newTimeKey, common.Int2Byte(int(newTime))); err != nil {
+		return err
+	}
+	return db.storage.SetData(append(watchAddrKeyPre, addr.Bytes()...), []byte{1})
+}
+
+func (db *keyStoreDB) HasWatchAddress(addr common.Address) bool {
+	data, err := db.storage.GetData(append(watchAddrKeyPre, addr.Bytes()...))
+	return err == nil && data != nil
+}
+
+func (db *keyStoreDB) ForeachWatchAddress(fn func(address common.Address)) {
+	_ = db.storage.PrefixForeachData(watchAddrKeyPre, func(k []byte, v []byte) error {
+		fn(common.Bytes2Address(k))
+		return nil
+	})
+}
+
+func (db *keyStoreDB) RemoveWatchAddress(addr common.Address) error {
+	if err := db.storage.DelData(append(watchAddrKeyPre, addr.Bytes()...)); err != nil {
+		return err
+	}
+	return db.storage.DelData(append(addNewTime, addr.Bytes()...))
+}
@@ -50,6 +50,20 @@ const (
 	// maxExtraNonce is the maximum value an extra nonce used in a coinbase
 	// transaction can be.
 	maxExtraNonce = ^uint64(0) // 2^64 - 1
+
+	// hashRateWindow is the number of latest blocks the network hash rate
+	// is estimated over.
+	hashRateWindow = 120
+	// maxCoinbaseHistory is the number of the coinbase changes kept
+	maxCoinbaseHistory = 64
+
+	// defaultRecommit is the default minimum interval between the refreshes of the
+	// block templates caused by better paying transactions.
+	defaultRecommit = 3 * time.Second
+
+	// recommitPriceBump is the percentage by which the gas price of a transaction
+	// must exceed the lowest gas price of the template to refresh the template.
+	recommitPriceBump = 10
 )
 
 var (
@@ -58,11 +72,24 @@ var (
 	maxWorkers              = uint32(255)
 	defaultNumWorkers       = uint32(runtime.NumCPU())
 	applyTransactionsErr    = errors.New("apply transaction err")
+	errWorkInterrupted      = errors.New("work interrupted")
 )
 
 type Config struct {
 	Coinbase   common.Address
 	Numworkers uint32
+	// ExtraData is put into the extra data field of mined block headers
+	ExtraData []byte
+	// RewardSplit pays shares of the block reward of mined blocks to other addresses
+	RewardSplit []xfsgo.RewardShare
+	// Schedule produces blocks in fixed slots instead of continuously
+	Schedule *xfsgo.BlockSchedule
+	// Recommit is the minimum interval between the refreshes of the block templates
+	// when better paying transactions arrive, defaultRecommit is used if it is zero
+	Recommit time.Duration
+	// TxOrder is the order the transactions of the pool are selected in, by gas
+	// price if it is empty
+	TxOrder string
 }
 
 // Miner creates blocks with transactions in tx pool and searches for proof-of-work values.
@@ -91,6 +118,18 @@ type Miner struct {
 	runningHashRate  chan common.HashRate
 	lastHashRate     common.HashRate
 	reportHashes     chan uint64
+	coinbaseHistory  []*CoinbaseChange
+	workLock         sync.Mutex
+	// workInterrupt is closed to make the workers drop their block templates
+	workInterrupt chan struct{}
+	work          *workInfo
+}
+
+// workInfo describes the block template sealed last, it tells whether a new
+// transaction pays enough better to refresh the template.
+type workInfo struct {
+	minPrice *big.Int // nil if the template has no transaction
+	gasLeft  *big.Int
 }
 
 func NewMiner(config *Config,
@@ -113,7 +152,7 @@ func NewMiner(config *Config,
 		reportHashes:     make(chan uint64, 1),
 		runningHashRate:  make(chan common.HashRate),
 	}
-	go m.mainLoop()
+	go xfsgo.Supervise("miner", xfsgo.DefaultRestartPolicy, m.mainLoop)
 	return m
 }
 
@@ -146,6 +185,9 @@ func (m *Miner) RunningHashRate() common.HashRate {
 	}
 	return m.lastHashRate
 }
+
+// SetGasLimit sets the gas limit target of the miner, the gas limit of mined blocks
+// moves toward it by at most 1/1024 of the parent gas limit per block.
 func (m *Miner) SetGasLimit(limit *big.Int) error {
 	m.rwmu.Lock()
 	defer m.rwmu.Unlock()
@@ -205,8 +247,69 @@ func (m *Miner) SetWorkers(num uint32) error {
 	m.numWorkers = num
 	return nil
 }
-func (m *Miner) SetCoinbase(address common.Address) {
+
+// CoinbaseChange is the entry of the audit log of the coinbase changes.
+type CoinbaseChange struct {
+	Time     time.Time      `json:"time"`
+	Height   uint64         `json:"height"`
+	From     common.Address `json:"from"`
+	To       common.Address `json:"to"`
+	External bool           `json:"external"`
+}
+
+// SetCoinbase changes the address receiving the rewards of the blocks mined next without
+// restarting the workers, external tells the address is not an account of the wallet.
+// The change is logged and appended to the coinbase history.
+func (m *Miner) SetCoinbase(address common.Address, external bool) {
+	m.rwmu.Lock()
+	defer m.rwmu.Unlock()
+	change := &CoinbaseChange{
+		Time:     time.Now(),
+		Height:   m.chain.CurrentBHeader().Height,
+		From:     m.Coinbase,
+		To:       address,
+		External: external,
+	}
 	m.Coinbase = address
+	m.coinbaseHistory = append(m.coinbaseHistory, change)
+	if len(m.coinbaseHistory) > maxCoinbaseHistory {
+		m.coinbaseHistory = m.coinbaseHistory[len(m.coinbaseHistory)-maxCoinbaseHistory:]
+	}
+	logrus.Warnf("Miner coinbase changed: from=%s, to=%s, external=%v, height=%d",
+		change.From.B58String(), change.To.B58String(), external, change.Height)
+}
+
+// GetCoinbase returns the address receiving the rewards of the blocks mined next.
+func (m *Miner) GetCoinbase() common.Address {
+	m.rwmu.RLock()
+	defer m.rwmu.RUnlock()
+	return m.Coinbase
+}
+
+// CoinbaseHistory returns the last changes of the coinbase, the oldest first.
+func (m *Miner) CoinbaseHistory() []*CoinbaseChange {
+	m.rwmu.RLock()
+	defer m.rwmu.RUnlock()
+	return append([]*CoinbaseChange(nil), m.coinbaseHistory...)
+}
+
+// SetRewardSplit sets the shares of the block reward paid to other addresses than the
+// coinbase in the blocks mined next, an empty split pays the whole reward to the coinbase.
+func (m *Miner) SetRewardSplit(split []xfsgo.RewardShare) error {
+	if err := xfsgo.VerifyRewardSplit(split); err != nil {
+		return err
+	}
+	m.rwmu.Lock()
+	defer m.rwmu.Unlock()
+	m.RewardSplit = append([]xfsgo.RewardShare(nil), split...)
+	return nil
+}
+
+// GetRewardSplit returns the reward split of the blocks mined next.
+func (m *Miner) GetRewardSplit() []xfsgo.RewardShare {
+	m.rwmu.RLock()
+	defer m.rwmu.RUnlock()
+	return m.RewardSplit
 }
 
 // mainLoop is the miner's main event loop, waiting for and reacting to synchronize events.
@@ -265,7 +368,7 @@ func (m *Miner) doRemove() {
 		delete(m.remove, tx.Hash())
 	}
 	if len(txs) != 0 {
-		m.pool.RemoveTransactions(txs)
+		m.pool.DropTransactions(txs, xfsgo.TxDropInvalid)
 	}
 }
 
@@ -275,12 +378,12 @@ func (m *Miner) TargetHeight() uint64 {
 
 func (m *Miner) NextDifficulty() float64 {
 	bits, _ := m.chain.CalcNextRequiredDifficulty()
-	return xfsgo.CalcDifficultyByBits(bits)
+	return m.chain.CalcDifficultyByBits(bits)
 }
 
+// TargetHashRate returns the network hash rate estimated over the latest blocks.
 func (m *Miner) TargetHashRate() common.HashRate {
-	bits, _ := m.chain.CalcNextRequiredDifficulty()
-	return xfsgo.CalcHashRateByBits(bits)
+	return m.chain.NetworkHashRate(hashRateWindow)
 }
 
 func (m *Miner) applyTransactions(
@@ -297,12 +400,12 @@ func (m *Miner) applyTransactions(
 	for _, tx := range txs {
 		txfrom, _ := tx.FromAddr()
 		txhash := tx.Hash()
-		_ = txhash
 		if _, exists := ignoreTxs[txfrom]; exists {
 			//logrus.Warnf("Tx exists ignore obj: hash=%x, from=%x",
 			//	txhash[len(txhash)-4:], txfrom)
 			continue
 		}
+		stateTree.SetTxContext(txhash, len(receipts))
 		rec, err := m.chain.ApplyTransaction(stateTree, header, tx, mGasPool, totalUsedGas)
 		if err != nil {
 			if err.Error() == xfsgo.GasPoolOutErr.Error() {
@@ -323,28 +426,107 @@ func (m *Miner) applyTransactions(
 	return totalUsedGas, receipts, nil
 }
 
+func (m *Miner) recommitInterval() time.Duration {
+	if m.Recommit > 0 {
+		return m.Recommit
+	}
+	return defaultRecommit
+}
+
+// currentInterrupt returns the channel closed when the block templates built from now
+// on become stale.
+func (m *Miner) currentInterrupt() chan struct{} {
+	m.workLock.Lock()
+	defer m.workLock.Unlock()
+	if m.workInterrupt == nil {
+		m.workInterrupt = make(chan struct{})
+	}
+	return m.workInterrupt
+}
+
+// interruptWork makes the workers drop the templates they are sealing and build new
+// ones on the current chain head with the current pending transactions.
+func (m *Miner) interruptWork(reason string) {
+	m.workLock.Lock()
+	defer m.workLock.Unlock()
+	if m.workInterrupt != nil {
+		close(m.workInterrupt)
+		m.workInterrupt = nil
+	}
+	m.work = nil
+	logrus.Debugf("Recommit miner work: reason=%s", reason)
+}
+
+// setWork records the template of the header with the transactions which is sealed.
+func (m *Miner) setWork(header *xfsgo.BlockHeader, txs []*xfsgo.Transaction) {
+	work := &workInfo{
+		gasLeft: new(big.Int).Sub(header.GasLimit, header.GasUsed),
+	}
+	for _, tx := range txs {
+		if work.minPrice == nil || tx.GasPrice.Cmp(work.minPrice) < 0 {
+			work.minPrice = tx.GasPrice
+		}
+	}
+	m.workLock.Lock()
+	defer m.workLock.Unlock()
+	m.work = work
+}
+
+// betterTx reports whether the transaction makes a better paying template than the
+// one sealed, either because it fits into the gas left in the template or because
+// its gas price exceeds the lowest one of the template by recommitPriceBump percent.
+func (m *Miner) betterTx(tx *xfsgo.Transaction) bool {
+	m.workLock.Lock()
+	defer m.workLock.Unlock()
+	if m.work == nil || tx.GasPrice == nil {
+		return false
+	}
+	if tx.GasLimit != nil && m.work.gasLeft.Cmp(tx.GasLimit) >= 0 {
+		return true
+	}
+	if m.work.minPrice == nil {
+		return false
+	}
+	bumped := new(big.Int).Mul(m.work.minPrice, big.NewInt(100+recommitPriceBump))
+	bumped.Div(bumped, big.NewInt(100))
+	return tx.GasPrice.Cmp(bumped) >= 0
+}
+
 func (m *Miner) mimeBlockWithParent(
 	stateTree *xfsgo.StateTree,
 	parentBlock *xfsgo.BlockHeader,
+	timestamp uint64,
 	coinbase common.Address,
 	txs []*xfsgo.Transaction,
 	quit chan struct{},
+	interrupt chan struct{},
 	ticker *time.Ticker,
 	fn reportFn) (*xfsgo.Block, error) {
 	if parentBlock == nil {
 		return nil, errors.New("parentBlock is nil")
 	}
 	//create a Blockheader which will be the header of the new block.
-	lastGenerated := time.Now().Unix()
+	lastGenerated := timestamp
+	// the timestamp must be after the median time past even if the local clock is behind
+	if minTime := m.chain.MinimumTimestamp(parentBlock); lastGenerated < minTime {
+		lastGenerated = minTime
+	}
 	header := &xfsgo.BlockHeader{
 		Height:        parentBlock.Height + 1,
 		HashPrevBlock: parentBlock.HeaderHash(),
-		Timestamp:     uint64(lastGenerated),
+		Timestamp:     lastGenerated,
 		Coinbase:      coinbase,
 	}
+	config := m.chain.ChainConfig()
+	if config.IsForkActive(xfsgo.ForkHeaderChecks, header.Height) {
+		header.ExtraData = m.ExtraData
+	}
+	if config.IsForkActive(xfsgo.ForkRewardSplit, header.Height) {
+		header.RewardSplit = m.GetRewardSplit()
+	}
 	header.GasUsed = new(big.Int)
 
-	header.GasLimit = common.TxPoolGasLimit
+	header.GasLimit = common.CalcGasLimit(parentBlock.GasLimit, m.GetGasLimit())
 	//calculate the next difficuty for hash value of next block.
 	var err error
 	header.Bits, err = m.chain.CalcNextRequiredDifficulty()
@@ -359,18 +541,19 @@ func (m *Miner) mimeBlockWithParent(
 		return nil, applyTransactionsErr
 	}
 	header.GasUsed = gasused
-	xfsgo.AccumulateRewards(stateTree, header)
+	m.chain.AccumulateRewards(stateTree, header)
 	stateTree.UpdateAll()
 	stateRootBytes := stateTree.Root()
 	stateRootHash := common.Bytes2Hash(stateRootBytes)
 	header.StateRoot = stateRootHash
 	//create a new block and execite the consensus algorithms
 	perBlock := xfsgo.NewBlock(header, committx, res)
-	return m.execPow(parentBlock, perBlock, quit, ticker, fn)
+	m.setWork(header, committx)
+	return m.execPow(parentBlock, perBlock, quit, interrupt, ticker, fn)
 }
 
-// run the consensus algorithms
-func (m *Miner) execPow(last *xfsgo.BlockHeader, perBlock *xfsgo.Block, quit chan struct{}, ticker *time.Ticker, report reportFn) (*xfsgo.Block, error) {
+// run the consensus algorithms, the search stops when the work is interrupted
+func (m *Miner) execPow(last *xfsgo.BlockHeader, perBlock *xfsgo.Block, quit chan struct{}, interrupt chan struct{}, ticker *time.Ticker, report reportFn) (*xfsgo.Block, error) {
 	targetDifficulty := xfsgo.BitsUnzip(perBlock.Bits())
 	target := targetDifficulty.Bytes()
 	targetHash := make([]byte, 32)
@@ -390,6 +573,8 @@ func (m *Miner) execPow(last *xfsgo.BlockHeader, perBlock *xfsgo.Block, quit cha
 			select {
 			case <-quit:
 				return nil, fmt.Errorf("no block")
+			case <-interrupt:
+				return nil, errWorkInterrupted
 			case <-ticker.C:
 				select {
 				case m.reportHashes <- hashesCompleted:
@@ -433,6 +618,34 @@ func (m *Miner) execPow(last *xfsgo.BlockHeader, perBlock *xfsgo.Block, quit cha
 
 type reportFn func(now time.Time, lastblock *xfsgo.BlockHeader)
 
+// waitSlot waits for the next slot of the block schedule after the parent block and
+// returns its timestamp with the pending transactions. Slots without transactions are
+// skipped if the schedule skips empty slots. It fails if the miner is stopped or the
+// chain moved past the parent block meanwhile.
+func (m *Miner) waitSlot(parent *xfsgo.BlockHeader, quit chan struct{}) (uint64, []*xfsgo.Transaction, bool) {
+	parentHash := parent.HeaderHash()
+	notBefore := uint64(time.Now().Unix())
+	for {
+		slot := m.Schedule.NextSlot(parent.Timestamp, notBefore)
+		timer := time.NewTimer(time.Until(time.Unix(int64(slot), 0)))
+		select {
+		case <-quit:
+			timer.Stop()
+			return 0, nil, false
+		case <-timer.C:
+		}
+		if head := m.chain.CurrentBHeader().HeaderHash(); !bytes.Equal(head[:], parentHash[:]) {
+			return 0, nil, false
+		}
+		txs := m.pool.GetTransactions()
+		if len(txs) > 0 || !m.Schedule.SkipEmpty {
+			return slot, txs, true
+		}
+		logrus.Debugf("Skip empty block slot: height=%d, timestamp=%d", parent.Height+1, slot)
+		notBefore = slot + 1
+	}
+}
+
 func (m *Miner) generateBlocks(num uint32, quit chan struct{}, report reportFn) {
 	ticker := time.NewTicker(time.Second * hashUpdateSecs)
 	defer ticker.Stop()
@@ -444,17 +657,29 @@ out:
 			break out
 		default:
 		}
-		txs := m.pool.GetTransactions()
+		// the interrupt is taken before the template is built, so that no
+		// refresh requested meanwhile is missed
+		interrupt := m.currentInterrupt()
+		lastBlock := m.chain.CurrentBHeader()
+		timestamp := uint64(time.Now().Unix())
+		var txs []*xfsgo.Transaction
+		if m.Schedule != nil {
+			var ok bool
+			if timestamp, txs, ok = m.waitSlot(lastBlock, quit); !ok {
+				continue out
+			}
+		} else {
+			txs = m.pool.GetTransactions()
+		}
 		//js,_ :=  json.Marshal(txs)
 		//logrus.Debugf("txs(un-sort): %s", js)
-		xfsgo.SortByPriceAndNonce(txs)
-		lastBlock := m.chain.CurrentBHeader()
+		xfsgo.SortTransactions(txs, m.TxOrder)
 		lastStateRoot := lastBlock.StateRoot
 		//lastBlockHash := lastBlock.Hash()
 		//logrus.Debugf("Generating block by parent height=%d, hash=0x%x...%x, workerId=%-3d", lastBlock.Height(), lastBlockHash[:4], lastBlockHash[len(lastBlockHash)-4:], num)
 		stateTree := xfsgo.NewStateTree(m.stateDb, lastStateRoot.Bytes())
 		startTime := time.Now()
-		block, err := m.mimeBlockWithParent(stateTree, lastBlock, m.Coinbase, txs, quit, ticker, report)
+		block, err := m.mimeBlockWithParent(stateTree, lastBlock, timestamp, m.GetCoinbase(), txs, quit, interrupt, ticker, report)
 		if err != nil {
 			switch err {
 			case applyTransactionsErr:
@@ -470,17 +695,13 @@ out:
 		}
 		timeused := time.Now().Sub(startTime)
 		hash := block.HeaderHash()
-		workload := xfsgo.CalcWorkloadByBits(block.Bits())
+		workload := m.chain.CalcWorkloadByBits(block.Bits())
 		workloadUint64 := workload.Uint64()
 		rate := float64(workloadUint64) / timeused.Seconds()
 		hashrate := common.HashRate(rate)
 		logrus.Infof("Sussessfully sealed new block: height=%d, hash=0x%x, txcount=%d, used=%fs, rate=%s",
 			block.Height(), hash[len(hash)-4:], len(block.Transactions), timeused.Seconds(), hashrate)
-		if err = stateTree.Commit(); err != nil {
-			logrus.Warnln("State tree commit err: ", err)
-			continue out
-		}
-		if err = m.chain.WriteBlock(block); err != nil {
+		if err = m.chain.WriteBlockWithState(block, stateTree); err != nil {
 			logrus.Warnln("Write block err: ", err)
 			continue out
 		}
@@ -491,7 +712,6 @@ out:
 		//logrus.Infof("current coinbase: %s, balance: %d", m.Coinbase.B58String(), balance)
 		m.eventBus.Publish(xfsgo.NewMinedBlockEvent{Block: block})
 	}
-	m.workerWg.Done()
 }
 func closeWorkers(cs []chan struct{}) {
 	for _, c := range cs {
@@ -548,7 +768,7 @@ func (m *Miner) miningWorkerController(worker uint32) {
 		}
 		targetHeight := lastblock.Height + 1
 		bits, _ := m.chain.CalcNextRequiredBitsByHeight(lastblock.Height)
-		workLoad := xfsgo.CalcWorkloadByBits(bits)
+		workLoad := m.chain.CalcWorkloadByBits(bits)
 		hashRate := m.RunningHashRate()
 		hashRateInt := new(big.Int).SetInt64(int64(hashRate))
 		estimateTimeStr := "long"
@@ -568,13 +788,25 @@ func (m *Miner) miningWorkerController(worker uint32) {
 			runningWorkers = append(runningWorkers, quit)
 			//logrus.Debugf("Start-up woker id=%-3d", i)
 			m.workerWg.Add(1)
-			go m.generateBlocks(i, quit, report)
+			go func(num uint32) {
+				defer m.workerWg.Done()
+				xfsgo.Supervise("miner.worker", xfsgo.DefaultRestartPolicy, func() {
+					m.generateBlocks(num, quit, report)
+				})
+			}(i)
 		}
 	}
 	runningWorkers = make([]chan struct{}, 0)
 	launchWorkers(worker)
 	txPreEventSub := m.eventBus.Subscript(xfsgo.TxPreEvent{})
 	defer txPreEventSub.Unsubscribe()
+	chainHeadSub := m.eventBus.Subscript(xfsgo.ChainHeadEvent{})
+	defer chainHeadSub.Unsubscribe()
+	// the templates are refreshed at most once per recommit interval for
+	// better paying transactions, but right away for a new chain head
+	recommitTicker := time.NewTicker(m.recommitInterval())
+	defer recommitTicker.Stop()
+	recommit := false
 out:
 	for {
 		select {
@@ -586,6 +818,17 @@ out:
 			event := e.(xfsgo.TxPreEvent)
 			Tx := event.Tx
 			_ = m.pool.Add(Tx)
+			if !recommit && m.betterTx(Tx) {
+				recommit = true
+			}
+		case <-recommitTicker.C:
+			if recommit {
+				m.interruptWork("better transactions")
+				recommit = false
+			}
+		case <-chainHeadSub.Chan():
+			m.interruptWork("new chain head")
+			recommit = false
 		case targetNum := <-m.updateNumWorkers:
 			numRunning := uint32(len(runningWorkers))
 			if targetNum == numRunning {
@@ -1,10 +1,12 @@
 package miner
 
 import (
+	"math/big"
 	"testing"
 	"time"
 	"xfsgo"
 	"xfsgo/common"
+	"xfsgo/storage/badger"
 	"xfsgo/test"
 )
 
@@ -58,7 +60,7 @@ func createMiner(t *testing.T) *Miner {
 		return nil
 	}
 
-	txPool := xfsgo.NewTxPool(bc.CurrentStateTree, bc.LatestGasLimit, test.TestTxPoolGasPrice, event)
+	txPool := xfsgo.NewTxPool(bc.CurrentStateTree, bc.LatestGasLimit, test.TestTxPoolGasPrice, bc.ChainConfig(), event)
 	config := &Config{
 		Coinbase:   common.Hex2Address(test.TestMinerCoinbase),
 		Numworkers: test.TestMinerWorkers,
@@ -67,3 +69,85 @@ func createMiner(t *testing.T) *Miner {
 	return NewMiner(config, stateDb, bc, event, txPool, test.TestTxPoolGasPrice, test.TestTxPoolGasLimit)
 
 }
+
+func newTestChain(t *testing.T) *xfsgo.BlockChain {
+	dbs := make([]*badger.Storage, 3)
+	for i := range dbs {
+		db, err := badger.New(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = db.Close()
+		})
+		dbs[i] = db
+	}
+	if _, err := xfsgo.WriteTestGenesisBlock(test.TestGenesisBits, dbs[0], dbs[1]); err != nil {
+		t.Fatal(err)
+	}
+	bc, err := xfsgo.NewBlockChainN(dbs[0], dbs[1], dbs[2], xfsgo.NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+func TestMiner_SetCoinbase(t *testing.T) {
+	m := &Miner{
+		Config: &Config{},
+		chain:  newTestChain(t),
+	}
+	for i := 0; i < maxCoinbaseHistory+1; i++ {
+		m.SetCoinbase(common.Address{byte(i)}, i%2 == 0)
+	}
+	if got := m.GetCoinbase(); got != (common.Address{maxCoinbaseHistory}) {
+		t.Fatalf("want coinbase changed, got %x", got)
+	}
+	history := m.CoinbaseHistory()
+	if len(history) != maxCoinbaseHistory {
+		t.Fatalf("want %d changes, got %d", maxCoinbaseHistory, len(history))
+	}
+	// the first change is dropped from the history
+	if history[0].From != (common.Address{0}) || history[0].To != (common.Address{1}) || history[0].External {
+		t.Fatalf("unexpected oldest change: %+v", history[0])
+	}
+}
+
+func TestMiner_Recommit(t *testing.T) {
+	m := &Miner{Config: &Config{}}
+	newTx := func(price, gas int64) *xfsgo.Transaction {
+		return &xfsgo.Transaction{GasPrice: big.NewInt(price), GasLimit: big.NewInt(gas)}
+	}
+	// nothing is sealed yet
+	if m.betterTx(newTx(100, 25000)) {
+		t.Fatalf("want no recommit without work")
+	}
+	interrupt := m.currentInterrupt()
+	header := &xfsgo.BlockHeader{GasLimit: big.NewInt(60000), GasUsed: big.NewInt(50000)}
+	m.setWork(header, []*xfsgo.Transaction{newTx(20, 25000), newTx(10, 25000)})
+	tests := []struct {
+		tx   *xfsgo.Transaction
+		want bool
+	}{
+		{newTx(1, 10000), true},
+		{newTx(10, 25000), false},
+		{newTx(11, 25000), true},
+	}
+	for i, tt := range tests {
+		if got := m.betterTx(tt.tx); got != tt.want {
+			t.Fatalf("tx %d: want %v, got %v", i, tt.want, got)
+		}
+	}
+	m.interruptWork("test")
+	select {
+	case <-interrupt:
+	default:
+		t.Fatalf("want work interrupted")
+	}
+	if m.currentInterrupt() == interrupt {
+		t.Fatalf("want a new interrupt")
+	}
+	if m.betterTx(newTx(100, 25000)) {
+		t.Fatalf("want no recommit after interrupt")
+	}
+}
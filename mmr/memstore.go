@@ -0,0 +1,40 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package mmr
+
+// MemStore is a node store kept in memory.
+type MemStore struct {
+	nodes map[uint8]map[uint64][]byte
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		nodes: make(map[uint8]map[uint64][]byte),
+	}
+}
+
+func (s *MemStore) GetNode(level uint8, index uint64) ([]byte, error) {
+	return s.nodes[level][index], nil
+}
+
+func (s *MemStore) PutNode(level uint8, index uint64, hash []byte) error {
+	if s.nodes[level] == nil {
+		s.nodes[level] = make(map[uint64][]byte)
+	}
+	s.nodes[level][index] = hash
+	return nil
+}
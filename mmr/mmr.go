@@ -0,0 +1,262 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+// Package mmr implements a merkle mountain range, an append only accumulator whose
+// root at every size commits to all leaves appended before. A leaf is proven against
+// the root of any size containing it with a logarithmic number of hashes.
+package mmr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"xfsgo/common/ahash"
+)
+
+// maxLevel is the number of levels of nodes, one for each bit of the size.
+const maxLevel = 64
+
+const (
+	nodePrefix = byte(0x01)
+	rootPrefix = byte(0x02)
+)
+
+var (
+	ErrIndexOutOfRange = errors.New("leaf index out of range")
+	ErrMissingNode     = errors.New("mountain range node not found")
+	ErrInvalidProof    = errors.New("invalid mountain range proof")
+)
+
+// Store persists the nodes of a mountain range. Level 0 holds the leaves, the node at
+// level l and index i is the parent of the nodes 2i and 2i+1 of level l-1.
+type Store interface {
+	GetNode(level uint8, index uint64) ([]byte, error)
+	PutNode(level uint8, index uint64, hash []byte) error
+}
+
+// MMR is a merkle mountain range backed by a node store.
+type MMR struct {
+	store Store
+	size  uint64
+}
+
+// Proof proves the leaf with the given index is contained in the range of the size.
+type Proof struct {
+	Index uint64 `json:"index"`
+	Size  uint64 `json:"size"`
+	// Siblings are the sibling hashes from the leaf up to its peak.
+	Siblings [][]byte `json:"siblings"`
+	// Peaks are the other peaks of the range, from the left to the right.
+	Peaks [][]byte `json:"peaks"`
+}
+
+// New returns the mountain range with the given number of leaves in the store.
+func New(store Store, size uint64) *MMR {
+	return &MMR{
+		store: store,
+		size:  size,
+	}
+}
+
+// Size returns the number of leaves.
+func (m *MMR) Size() uint64 {
+	return m.size
+}
+
+// Truncate drops the leaves from size on, the nodes are overwritten by later appends.
+func (m *MMR) Truncate(size uint64) {
+	if size < m.size {
+		m.size = size
+	}
+}
+
+func hashNode(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, nodePrefix)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	return ahash.SHA256(buf)
+}
+
+// bagPeaks returns the root of a range of the size with the given peaks, the root
+// commits to the size so ranges of different sizes never share a root.
+func bagPeaks(size uint64, peaks [][]byte) []byte {
+	var bagged []byte
+	for i := len(peaks) - 1; i >= 0; i-- {
+		if bagged == nil {
+			bagged = peaks[i]
+			continue
+		}
+		bagged = hashNode(peaks[i], bagged)
+	}
+	var sizeBuf [8]byte
+	binary.BigEndian.PutUint64(sizeBuf[:], size)
+	buf := append([]byte{rootPrefix}, sizeBuf[:]...)
+	return ahash.SHA256(append(buf, bagged...))
+}
+
+// peak is a complete subtree of a range, covering the leaves from offset on.
+type peak struct {
+	level  uint8
+	offset uint64
+}
+
+func peaksOf(size uint64) []peak {
+	peaks := make([]peak, 0)
+	offset := uint64(0)
+	for l := maxLevel - 1; l >= 0; l-- {
+		if size&(uint64(1)<<uint(l)) == 0 {
+			continue
+		}
+		peaks = append(peaks, peak{level: uint8(l), offset: offset})
+		offset += uint64(1) << uint(l)
+	}
+	return peaks
+}
+
+// peakIndexOf returns the position of the peak containing the leaf in the peaks of size.
+func peakIndexOf(index, size uint64) (int, peak) {
+	for i, p := range peaksOf(size) {
+		if index >= p.offset && index < p.offset+uint64(1)<<p.level {
+			return i, p
+		}
+	}
+	return -1, peak{}
+}
+
+func (m *MMR) node(level uint8, index uint64) ([]byte, error) {
+	hash, err := m.store.GetNode(level, index)
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		return nil, ErrMissingNode
+	}
+	return hash, nil
+}
+
+// Append adds a leaf and the parents it completes.
+func (m *MMR) Append(leaf []byte) error {
+	index := m.size
+	if err := m.store.PutNode(0, index, leaf); err != nil {
+		return err
+	}
+	hash := leaf
+	for level := uint8(0); index&1 == 1; level++ {
+		left, err := m.node(level, index-1)
+		if err != nil {
+			return err
+		}
+		hash = hashNode(left, hash)
+		index >>= 1
+		if err = m.store.PutNode(level+1, index, hash); err != nil {
+			return err
+		}
+	}
+	m.size++
+	return nil
+}
+
+// Leaf returns the leaf with the given index.
+func (m *MMR) Leaf(index uint64) ([]byte, error) {
+	if index >= m.size {
+		return nil, ErrIndexOutOfRange
+	}
+	return m.node(0, index)
+}
+
+// RootAt returns the root of the range when it had size leaves.
+func (m *MMR) RootAt(size uint64) ([]byte, error) {
+	if size > m.size {
+		return nil, ErrIndexOutOfRange
+	}
+	peaks := peaksOf(size)
+	hashes := make([][]byte, len(peaks))
+	for i, p := range peaks {
+		hash, err := m.node(p.level, p.offset>>p.level)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hash
+	}
+	return bagPeaks(size, hashes), nil
+}
+
+// Root returns the root of the range.
+func (m *MMR) Root() ([]byte, error) {
+	return m.RootAt(m.size)
+}
+
+// Prove returns the proof of the leaf with the given index against the root of the
+// range when it had size leaves.
+func (m *MMR) Prove(index, size uint64) (*Proof, error) {
+	if size > m.size || index >= size {
+		return nil, ErrIndexOutOfRange
+	}
+	pos, p := peakIndexOf(index, size)
+	proof := &Proof{
+		Index:    index,
+		Size:     size,
+		Siblings: make([][]byte, 0, p.level),
+		Peaks:    make([][]byte, 0),
+	}
+	for level := uint8(0); level < p.level; level++ {
+		sibling, err := m.node(level, (index>>level)^1)
+		if err != nil {
+			return nil, err
+		}
+		proof.Siblings = append(proof.Siblings, sibling)
+	}
+	for i, other := range peaksOf(size) {
+		if i == pos {
+			continue
+		}
+		hash, err := m.node(other.level, other.offset>>other.level)
+		if err != nil {
+			return nil, err
+		}
+		proof.Peaks = append(proof.Peaks, hash)
+	}
+	return proof, nil
+}
+
+// VerifyProof checks the proof shows the leaf is contained in the range with the root.
+func VerifyProof(root, leaf []byte, proof *Proof) error {
+	if proof == nil || proof.Index >= proof.Size {
+		return ErrInvalidProof
+	}
+	pos, p := peakIndexOf(proof.Index, proof.Size)
+	peaks := peaksOf(proof.Size)
+	if len(proof.Siblings) != int(p.level) || len(proof.Peaks) != len(peaks)-1 {
+		return ErrInvalidProof
+	}
+	hash := leaf
+	for level, sibling := range proof.Siblings {
+		if (proof.Index>>uint(level))&1 == 0 {
+			hash = hashNode(hash, sibling)
+		} else {
+			hash = hashNode(sibling, hash)
+		}
+	}
+	hashes := make([][]byte, 0, len(peaks))
+	hashes = append(hashes, proof.Peaks[:pos]...)
+	hashes = append(hashes, hash)
+	hashes = append(hashes, proof.Peaks[pos:]...)
+	if !bytes.Equal(bagPeaks(proof.Size, hashes), root) {
+		return ErrInvalidProof
+	}
+	return nil
+}
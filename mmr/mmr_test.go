@@ -0,0 +1,100 @@
+package mmr
+
+import (
+	"encoding/binary"
+	"testing"
+	"xfsgo/common/ahash"
+)
+
+func testLeaf(i uint64, salt byte) []byte {
+	var buf [9]byte
+	binary.BigEndian.PutUint64(buf[:8], i)
+	buf[8] = salt
+	return ahash.SHA256(buf[:])
+}
+
+func newTestMMR(t *testing.T, size uint64, salt byte) *MMR {
+	m := New(NewMemStore(), 0)
+	for i := uint64(0); i < size; i++ {
+		if err := m.Append(testLeaf(i, salt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestMMR_Prove(t *testing.T) {
+	const size = 37
+	m := newTestMMR(t, size, 0)
+	for n := uint64(1); n <= size; n++ {
+		root, err := m.RootAt(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the root of a prefix doesn't change with later appends
+		want, err := newTestMMR(t, n, 0).Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(root) != string(want) {
+			t.Fatalf("root of size %d changed", n)
+		}
+		for i := uint64(0); i < n; i++ {
+			proof, err := m.Prove(i, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = VerifyProof(root, testLeaf(i, 0), proof); err != nil {
+				t.Fatalf("proof of leaf %d in size %d: %v", i, n, err)
+			}
+			if err = VerifyProof(root, testLeaf(i, 1), proof); err != ErrInvalidProof {
+				t.Fatalf("want invalid proof of other leaf, got %v", err)
+			}
+		}
+	}
+	if _, err := m.Prove(size, size); err != ErrIndexOutOfRange {
+		t.Fatalf("want ErrIndexOutOfRange, got %v", err)
+	}
+}
+
+func TestMMR_ProveTampered(t *testing.T) {
+	m := newTestMMR(t, 11, 0)
+	root, _ := m.Root()
+	proof, err := m.Prove(4, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof.Index = 5
+	if err = VerifyProof(root, testLeaf(4, 0), proof); err != ErrInvalidProof {
+		t.Fatalf("want invalid proof of moved leaf, got %v", err)
+	}
+	proof.Index, proof.Size = 4, 12
+	if err = VerifyProof(root, testLeaf(4, 0), proof); err != ErrInvalidProof {
+		t.Fatalf("want invalid proof of other size, got %v", err)
+	}
+}
+
+func TestMMR_Truncate(t *testing.T) {
+	m := newTestMMR(t, 20, 0)
+	m.Truncate(13)
+	for i := uint64(13); i < 20; i++ {
+		if err := m.Append(testLeaf(i, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := New(NewMemStore(), 0)
+	for i := uint64(0); i < 20; i++ {
+		salt := byte(0)
+		if i >= 13 {
+			salt = 1
+		}
+		if err := want.Append(testLeaf(i, salt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _ := m.Root()
+	wantRoot, _ := want.Root()
+	if string(got) != string(wantRoot) {
+		t.Fatal("root after truncate and append differs")
+	}
+}
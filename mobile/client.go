@@ -0,0 +1,203 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package mobile
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strconv"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/common/rawencode"
+)
+
+var (
+	ErrInvalidHeader = errors.New("header proof of work check failed")
+	ErrInvalidProof  = errors.New("account proof check failed")
+)
+
+const defaultTimeout = "30s"
+
+// Client is a light client of a remote node.
+type Client struct {
+	cli *xfsgo.Client
+	// maxTarget is the target of the genesis bits, headers must not claim more
+	maxTarget *big.Int
+}
+
+// NewClient creates a client of the JSON-RPC endpoint of a main net node.
+func NewClient(url string) *Client {
+	return &Client{
+		cli:       xfsgo.NewClient(url, defaultTimeout),
+		maxTarget: xfsgo.BitsUnzip(xfsgo.MainNetGenesisBits),
+	}
+}
+
+// SetGenesisBits sets the difficulty bits of the genesis block of the network, which
+// bound the target of the headers accepted by the client.
+func (c *Client) SetGenesisBits(bits int64) {
+	c.maxTarget = xfsgo.BitsUnzip(uint32(bits))
+}
+
+// SetTestNet configures the client for the test network.
+func (c *Client) SetTestNet() {
+	c.SetGenesisBits(int64(xfsgo.TestNetGenesisBits))
+}
+
+// SetAPIKey sets the api key sent with every call.
+func (c *Client) SetAPIKey(key string) {
+	c.cli.SetAPIKey(key)
+}
+
+// Account is the verified state of an account at a block.
+type Account struct {
+	Address string
+	// Balance is the decimal balance in atto
+	Balance string
+	Nonce   int64
+	Height  int64
+	// BlockHash is the hex encoded hash of the block the account was verified at
+	BlockHash string
+}
+
+type accountProof struct {
+	Address string   `json:"address"`
+	Header  string   `json:"header"`
+	Proof   []string `json:"proof"`
+}
+
+// verifyHeader decodes the header and checks its proof of work.
+func (c *Client) verifyHeader(enc string) (*xfsgo.BlockHeader, error) {
+	bs, err := hex.DecodeString(trimHexPrefix(enc))
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+	header := &xfsgo.BlockHeader{}
+	if err = rawencode.Decode(bs, header); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	target := xfsgo.BitsUnzip(header.Bits)
+	if target.Sign() <= 0 || target.Cmp(c.maxTarget) > 0 {
+		return nil, ErrInvalidHeader
+	}
+	hash := header.HeaderHash()
+	if new(big.Int).SetBytes(hash[:]).Cmp(target) > 0 {
+		return nil, ErrInvalidHeader
+	}
+	return header, nil
+}
+
+func verifyAccount(header *xfsgo.BlockHeader, addr common.Address, result *accountProof) (*Account, error) {
+	proof := make([][]byte, len(result.Proof))
+	for i, node := range result.Proof {
+		bs, err := hex.DecodeString(trimHexPrefix(node))
+		if err != nil {
+			return nil, ErrInvalidProof
+		}
+		proof[i] = bs
+	}
+	obj, err := xfsgo.VerifyAccountProof(header.StateRoot, addr, proof)
+	if err != nil {
+		return nil, ErrInvalidProof
+	}
+	blockHash := header.HeaderHash()
+	account := &Account{
+		Address:   addr.B58String(),
+		Balance:   "0",
+		Height:    int64(header.Height),
+		BlockHash: blockHash.Hex(),
+	}
+	if obj != nil {
+		account.Balance = obj.GetBalance().Text(10)
+		account.Nonce = int64(obj.GetNonce())
+	}
+	return account, nil
+}
+
+// GetAccount returns the account at the current block, verified by its merkle proof
+// against the state root of the proof-of-work checked header.
+func (c *Client) GetAccount(address string) (*Account, error) {
+	return c.getAccount(address, "")
+}
+
+// GetAccountAt returns the verified account at the block with the given height.
+func (c *Client) GetAccountAt(address string, height int64) (*Account, error) {
+	return c.getAccount(address, strconv.FormatInt(height, 10))
+}
+
+func (c *Client) getAccount(address string, number string) (*Account, error) {
+	addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	req := map[string]string{
+		"address": address,
+		"number":  number,
+	}
+	result := &accountProof{}
+	if err = c.cli.CallMethod(1, "State.GetProof", &req, result); err != nil {
+		return nil, err
+	}
+	header, err := c.verifyHeader(result.Header)
+	if err != nil {
+		return nil, err
+	}
+	return verifyAccount(header, addr, result)
+}
+
+// GetBalance returns the verified decimal balance in atto of the account.
+func (c *Client) GetBalance(address string) (string, error) {
+	account, err := c.GetAccount(address)
+	if err != nil {
+		return "", err
+	}
+	return account.Balance, nil
+}
+
+// GetPendingNonce returns the nonce of the next transaction of the account, counting the
+// transactions waiting in the tx pool of the node.
+func (c *Client) GetPendingNonce(address string) (int64, error) {
+	if _, err := parseAddress(address); err != nil {
+		return 0, err
+	}
+	req := map[string]string{
+		"address": address,
+		"pending": "true",
+	}
+	var nonce uint64
+	if err := c.cli.CallMethod(1, "State.GetNonce", &req, &nonce); err != nil {
+		return 0, err
+	}
+	return int64(nonce), nil
+}
+
+// SendTransaction broadcasts the signed transaction and returns its hash.
+func (c *Client) SendTransaction(tx *Transaction) (string, error) {
+	raw, err := tx.EncodeRaw()
+	if err != nil {
+		return "", err
+	}
+	req := map[string]string{
+		"data": raw,
+	}
+	var hash string
+	if err = c.cli.CallMethod(1, "TxPool.SendRawTransaction", &req, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
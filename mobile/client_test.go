@@ -0,0 +1,139 @@
+package mobile
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"xfsgo"
+	"xfsgo/api"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/common/rawencode"
+	"xfsgo/storage/badger"
+)
+
+const testBits = uint32(0xffffff20)
+
+func newTestProof(t *testing.T, addr common.Address, balance int64) *accountProof {
+	db, err := badger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	st := xfsgo.NewStateTree(db, nil)
+	st.AddBalance(addr, big.NewInt(balance))
+	st.AddBalance(common.Bytes2Address([]byte{0x01}), big.NewInt(1))
+	st.UpdateAll()
+	if err = st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	header := &xfsgo.BlockHeader{
+		Height:    3,
+		StateRoot: common.Bytes2Hash(st.Root()),
+		GasLimit:  new(big.Int),
+		GasUsed:   new(big.Int),
+		Bits:      testBits,
+	}
+	target := xfsgo.BitsUnzip(testBits)
+	for hash := header.HeaderHash(); new(big.Int).SetBytes(hash[:]).Cmp(target) > 0; hash = header.HeaderHash() {
+		header.Nonce++
+	}
+	enc, err := rawencode.Encode(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := st.GetProof(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &accountProof{
+		Address: addr.B58String(),
+		Header:  "0x" + hex.EncodeToString(enc),
+	}
+	for _, node := range proof {
+		result.Proof = append(result.Proof, "0x"+hex.EncodeToString(node))
+	}
+	return result
+}
+
+func TestClient_verifyAccount(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := parseAddress(key.Address())
+	result := newTestProof(t, addr, 100)
+	c := NewClient("")
+	if _, err = c.verifyHeader(result.Header); err != ErrInvalidHeader {
+		t.Fatalf("want header above the main net target rejected, got %v", err)
+	}
+	c.SetGenesisBits(int64(testBits))
+	header, err := c.verifyHeader(result.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := verifyAccount(header, addr, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, account.Balance, "100")
+	assert.Equal(t, account.Height, int64(3))
+	// the proof doesn't hold for another state root
+	header.StateRoot = common.Hash{0x01}
+	if _, err = verifyAccount(header, addr, result); err != ErrInvalidProof {
+		t.Fatalf("want invalid proof, got %v", err)
+	}
+}
+
+func TestTransaction_EncodeRaw(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportKey(key.Export())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, imported.Address(), key.Address())
+	other, _ := NewKey()
+	tx, err := NewTransaction(other.Address(), "1000", "10", "25000", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.EncodeRaw(); err != ErrNotSigned {
+		t.Fatalf("want not signed, got %v", err)
+	}
+	if err = tx.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	from, err := tx.From()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, from, key.Address())
+	raw, err := tx.EncodeRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawtx := &api.StringRawTransaction{}
+	if err = json.Unmarshal(bs, rawtx); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := api.CoverTransaction(rawtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := decoded.Hash()
+	assert.Equal(t, hash.Hex(), tx.Hash())
+	if _, err = NewTransaction("bad", "1", "1", "1", 0, nil); err != ErrInvalidAddress {
+		t.Fatalf("want invalid address, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+// Package mobile provides a light client for wallets built with gomobile. Balances are
+// verified with merkle proofs against proof-of-work checked headers, so the remote node
+// serving them doesn't need to be trusted.
+//
+// Only the types supported by gomobile bind are exported: strings, []byte, int64, bool,
+// error and pointers to the structs of this package.
+package mobile
+
+import (
+	"encoding/hex"
+	"errors"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+// Key is a private key of an account.
+type Key struct {
+	key keyPair
+}
+
+// NewKey generates a new key.
+func NewKey() (*Key, error) {
+	k, err := crypto.GenPrvKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Key{key: keyPair{k}}, nil
+}
+
+// ImportKey imports a key exported by Export or by the wallet of the node.
+func ImportKey(hexKey string) (*Key, error) {
+	bs, err := hex.DecodeString(trimHexPrefix(hexKey))
+	if err != nil {
+		return nil, err
+	}
+	_, k, err := crypto.DecodePrivateKey(bs)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{key: keyPair{k}}, nil
+}
+
+// Address returns the base58 encoded address of the key.
+func (k *Key) Address() string {
+	addr := k.key.address()
+	return addr.B58String()
+}
+
+// Export returns the hex encoded key in the format of the wallet of the node.
+func (k *Key) Export() string {
+	return "0x" + hex.EncodeToString(crypto.DefaultEncodePrivateKey(k.key.PrivateKey))
+}
+
+// ValidateAddress reports whether the address is a valid base58 encoded address.
+func ValidateAddress(address string) bool {
+	return common.AddrCalibrator(address) == nil
+}
+
+func parseAddress(address string) (common.Address, error) {
+	if err := common.AddrCalibrator(address); err != nil {
+		return common.Address{}, ErrInvalidAddress
+	}
+	return common.B58ToAddress([]byte(address)), nil
+}
+
+func trimHexPrefix(s string) string {
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s[2:]
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package mobile
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+var (
+	ErrInvalidAmount = errors.New("invalid amount")
+	ErrNotSigned     = errors.New("transaction not signed")
+)
+
+type keyPair struct {
+	*ecdsa.PrivateKey
+}
+
+func (k keyPair) address() common.Address {
+	return crypto.DefaultPubKey2Addr(k.PublicKey)
+}
+
+// Transaction is a transaction to be signed and sent.
+type Transaction struct {
+	tx *xfsgo.Transaction
+}
+
+func parseAmount(s string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 {
+		return nil, ErrInvalidAmount
+	}
+	return n, nil
+}
+
+// NewTransaction creates a transaction sending value to the address, the value and
+// gas price are decimal amounts in atto. An empty address creates a contract from data.
+func NewTransaction(to string, value, gasPrice, gasLimit string, nonce int64, data []byte) (*Transaction, error) {
+	std := &xfsgo.StdTransaction{
+		Nonce: uint64(nonce),
+		Data:  data,
+	}
+	var err error
+	if to != "" {
+		if std.To, err = parseAddress(to); err != nil {
+			return nil, err
+		}
+	}
+	if std.Value, err = parseAmount(value); err != nil {
+		return nil, err
+	}
+	if std.GasPrice, err = parseAmount(gasPrice); err != nil {
+		return nil, err
+	}
+	if std.GasLimit, err = parseAmount(gasLimit); err != nil {
+		return nil, err
+	}
+	return &Transaction{tx: xfsgo.NewTransactionByStd(std)}, nil
+}
+
+// Sign signs the transaction with the key.
+func (t *Transaction) Sign(key *Key) error {
+	return t.tx.SignWithPrivateKey(key.key.PrivateKey)
+}
+
+// Hash returns the hex encoded hash of the transaction.
+func (t *Transaction) Hash() string {
+	hash := t.tx.Hash()
+	return hash.Hex()
+}
+
+// From returns the address of the signer.
+func (t *Transaction) From() (string, error) {
+	addr, err := t.tx.FromAddr()
+	if err != nil {
+		return "", err
+	}
+	return addr.B58String(), nil
+}
+
+// rawTransaction is the raw transaction accepted by TxPool.SendRawTransaction.
+type rawTransaction struct {
+	Version   string `json:"version"`
+	To        string `json:"to"`
+	Value     string `json:"value"`
+	Data      string `json:"data"`
+	GasLimit  string `json:"gas_limit"`
+	GasPrice  string `json:"gas_price"`
+	Signature string `json:"signature"`
+	Nonce     string `json:"nonce"`
+}
+
+// EncodeRaw returns the signed transaction encoded for TxPool.SendRawTransaction.
+func (t *Transaction) EncodeRaw() (string, error) {
+	if len(t.tx.Signature) == 0 {
+		return "", ErrNotSigned
+	}
+	raw := &rawTransaction{
+		Version:   strconv.FormatUint(uint64(t.tx.Version), 10),
+		Value:     t.tx.Value.Text(10),
+		GasLimit:  t.tx.GasLimit.Text(10),
+		GasPrice:  t.tx.GasPrice.Text(10),
+		Signature: hex.EncodeToString(t.tx.Signature),
+		Nonce:     strconv.FormatUint(t.tx.Nonce, 10),
+	}
+	if !t.tx.To.Equals(common.ZeroAddr) {
+		raw.To = t.tx.To.B58String()
+	}
+	if len(t.tx.Data) > 0 {
+		raw.Data = hex.EncodeToString(t.tx.Data)
+	}
+	bs, err := json.Marshal(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(bs), nil
+}
@@ -18,6 +18,7 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
@@ -36,12 +37,17 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+var errNodeNotRegistered = errors.New("node service not registered")
+
 // Node is a container on which services can be registered.
 type Node struct {
 	// *Opts
 	config    *Config
 	p2pServer p2p.Server
 	rpcServer *xfsgo.RPCServer
+	netAPI    *api.NetAPIHandler
+	nodeAPI   *api.ClusterAPIHandler
+	capture   *p2p.Capture
 }
 
 type Config struct {
@@ -51,6 +57,11 @@ type Config struct {
 	P2PStaticNodes   []string
 	NodeDBPath       string
 	RPCConfig        *xfsgo.RPCConfig
+	// RPCCacheSize is the number of results of the calls reading blocks by hash the
+	// rpc server caches, nothing is cached if it is 0
+	RPCCacheSize int
+	// P2PCapture records the protocol messages of the peers for debugging if set
+	P2PCapture *p2p.CaptureConfig
 }
 
 const datadirPrivateKey = "NODEKEY"
@@ -73,6 +84,14 @@ func New(config *Config) (*Node, error) {
 		}
 		staticNodes = append(staticNodes, node)
 	}
+	var capture *p2p.Capture
+	if config.P2PCapture != nil {
+		var err error
+		if capture, err = p2p.NewCapture(*config.P2PCapture); err != nil {
+			return nil, err
+		}
+		logrus.Warnf("Capture p2p messages to: %s", config.P2PCapture.Path)
+	}
 	enc := new(rawencode.StdEncoder)
 	//logrus.Infof("logger level: %s", logrus.GetLevel())
 	p2pServer := p2p.NewServer(p2p.Config{
@@ -86,10 +105,12 @@ func New(config *Config) (*Node, error) {
 		MaxPeers:       10,
 		NodeDBPath:     config.NodeDBPath,
 		Logger:         logrus.StandardLogger(),
+		Capture:        capture,
 	})
 	n := &Node{
 		config:    config,
 		p2pServer: p2pServer,
+		capture:   capture,
 	}
 	n.rpcServer = xfsgo.NewRPCServer(config.RPCConfig)
 	return n, nil
@@ -115,13 +136,19 @@ func (n *Node) RegisterBackend(
 	bc *xfsgo.BlockChain,
 	miner *miner.Miner,
 	wallet *xfsgo.Wallet,
-	txPool *xfsgo.TxPool) error {
+	txPool *xfsgo.TxPool,
+	eventBus *xfsgo.EventBus) error {
+	cache := api.NewResponseCache(n.config.RPCCacheSize)
+	cache.Watch(eventBus)
 	chainApiHandler := &api.ChainAPIHandler{
 		BlockChain:    bc,
 		TxPendingPool: txPool,
+		Cache:         cache,
 	}
 	minerApiHandler := &api.MinerAPIHandler{
-		Miner: miner,
+		Miner:      miner,
+		BlockChain: bc,
+		Wallet:     wallet,
 	}
 
 	walletApiHandler := &api.WalletHandler{
@@ -132,13 +159,37 @@ func (n *Node) RegisterBackend(
 
 	txPoolHandler := &api.TxPoolHandler{
 		TxPool: txPool,
+		Wallet: wallet,
 	}
 	stateHandler := &api.StateAPIHandler{
+		StateDb:       stateDb,
+		BlockChain:    bc,
+		TxPendingPool: txPool,
+	}
+	contractHandler := &api.ContractAPIHandler{
 		StateDb:    stateDb,
 		BlockChain: bc,
 	}
+	oracleHandler := &api.OracleAPIHandler{
+		StateDb:       stateDb,
+		BlockChain:    bc,
+		Wallet:        wallet,
+		TxPendingPool: txPool,
+	}
+	anchorHandler := &api.AnchorAPIHandler{
+		StateDb:       stateDb,
+		BlockChain:    bc,
+		Wallet:        wallet,
+		TxPendingPool: txPool,
+	}
 	netAPIHandler := &api.NetAPIHandler{
 		NetServer: n.P2PServer(),
+		Capture:   n.capture,
+	}
+	n.netAPI = netAPIHandler
+	n.nodeAPI = &api.ClusterAPIHandler{
+		BlockChain: bc,
+		Crashes:    xfsgo.DefaultCrashReporter,
 	}
 
 	if err := n.rpcServer.RegisterName("Chain", chainApiHandler); err != nil {
@@ -162,13 +213,92 @@ func (n *Node) RegisterBackend(
 		log.Fatalf("RPC service register error: %s", err)
 		return err
 	}
+	if err := n.rpcServer.RegisterName("Contract", contractHandler); err != nil {
+		log.Fatalf("RPC service register error: %s", err)
+		return err
+	}
+	if err := n.rpcServer.RegisterName("Oracle", oracleHandler); err != nil {
+		log.Fatalf("RPC service register error: %s", err)
+		return err
+	}
+	if err := n.rpcServer.RegisterName("Anchor", anchorHandler); err != nil {
+		log.Fatalf("RPC service register error: %s", err)
+		return err
+	}
 	if err := n.rpcServer.RegisterName("Net", netAPIHandler); err != nil {
 		log.Fatalf("RPC service register error: %s", err)
 		return err
 	}
+	if err := n.rpcServer.RegisterName("Node", n.nodeAPI); err != nil {
+		log.Fatalf("RPC service register error: %s", err)
+		return err
+	}
+	return nil
+}
+
+// EnableAPIKeys enforces the api keys of the store on RPC calls and registers
+// the admin service managing them.
+func (n *Node) EnableAPIKeys(store *xfsgo.APIKeyStore) error {
+	n.rpcServer.SetAPIKeyStore(store)
+	return n.rpcServer.RegisterName(xfsgo.APIKeyService, &api.APIKeyHandler{
+		Store: store,
+	})
+}
+
+// EnableFaucet registers the faucet service sending coins of the faucet account of the wallet.
+func (n *Node) EnableFaucet(
+	faucet *xfsgo.Faucet,
+	bc *xfsgo.BlockChain,
+	wallet *xfsgo.Wallet,
+	txPool *xfsgo.TxPool) error {
+	return n.rpcServer.RegisterName("Faucet", &api.FaucetAPIHandler{
+		Faucet:        faucet,
+		Wallet:        wallet,
+		BlockChain:    bc,
+		TxPendingPool: txPool,
+	})
+}
+
+// EnableCluster enables the reports of the status of the sibling nodes by the Node service,
+// the read calls are proxied to them while the node is syncing if the cluster asks for it.
+// It must be called after RegisterBackend.
+func (n *Node) EnableCluster(cluster *xfsgo.Cluster, bc *xfsgo.BlockChain) error {
+	n.rpcServer.SetReadProxy(cluster.ProxyRead)
+	if n.nodeAPI == nil {
+		return errNodeNotRegistered
+	}
+	n.nodeAPI.Cluster = cluster
+	n.nodeAPI.BlockChain = bc
 	return nil
 }
 
+// EnableReorgAlarm registers the service reporting the deep reorgs seen by the monitor.
+func (n *Node) EnableReorgAlarm(monitor *xfsgo.ReorgMonitor) error {
+	return n.rpcServer.RegisterName("Monitor", &api.ReorgAlarmAPIHandler{
+		Monitor: monitor,
+	})
+}
+
+// EnableShadow registers the service reporting the divergences of the shadow execution.
+func (n *Node) EnableShadow(shadow *xfsgo.ShadowExecutor) error {
+	return n.rpcServer.RegisterName("Shadow", &api.ShadowAPIHandler{
+		Shadow: shadow,
+	})
+}
+
+// SetPeerPropagation sets the source of the block propagation ranking of the peers
+// reported by the Net service, it must be called before the node is started.
+func (n *Node) SetPeerPropagation(fn func() []*xfsgo.PeerPropagation) {
+	if n.netAPI != nil {
+		n.netAPI.Propagation = fn
+	}
+}
+
+// Capture returns the capture of the p2p messages, nil if they are not captured.
+func (n *Node) Capture() *p2p.Capture {
+	return n.capture
+}
+
 func (n *Node) P2PServer() p2p.Server {
 	return n.p2pServer
 }
@@ -0,0 +1,154 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrNotificationsUnsupported is returned by subscription methods called without a
+// websocket connection.
+var ErrNotificationsUnsupported = NewRPCError(-32001, "notifications not supported")
+
+type notifierKey struct{}
+
+// NotifyFn sends a notification of a subscription to the client.
+type NotifyFn func(result interface{}) error
+
+// Notifier pushes the notifications of the subscriptions made on a websocket
+// connection, the subscriptions end when the connection is closed.
+type Notifier struct {
+	conn *websocket.Conn
+	// wmu serializes the writes of responses and notifications
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	subs    map[string]chan struct{}
+	pending []func()
+	closed  bool
+}
+
+func newNotifier(conn *websocket.Conn) *Notifier {
+	return &Notifier{
+		conn: conn,
+		subs: make(map[string]chan struct{}),
+	}
+}
+
+// NotifierFromContext returns the notifier of the connection of the RPC call, ok is
+// false if the call was not made on a websocket connection.
+func NotifierFromContext(ctx context.Context) (n *Notifier, ok bool) {
+	n, ok = ctx.Value(notifierKey{}).(*Notifier)
+	return
+}
+
+func newSubscriptionID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return "0x" + hex.EncodeToString(id[:])
+}
+
+// Subscribe creates a subscription and returns its id. The run function is started
+// once the response of the current call is written, it sends the notifications with
+// notify and returns when quit is closed.
+func (n *Notifier) Subscribe(run func(notify NotifyFn, quit <-chan struct{})) string {
+	id := newSubscriptionID()
+	quit := make(chan struct{})
+	notify := func(result interface{}) error {
+		return n.notify(id, result)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return id
+	}
+	n.subs[id] = quit
+	n.pending = append(n.pending, func() {
+		run(notify, quit)
+	})
+	return id
+}
+
+// Unsubscribe ends the subscription, it reports whether the subscription existed.
+func (n *Notifier) Unsubscribe(id string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	quit, exists := n.subs[id]
+	if !exists {
+		return false
+	}
+	delete(n.subs, id)
+	if !n.closed {
+		close(quit)
+	}
+	return true
+}
+
+func (n *Notifier) notify(id string, result interface{}) error {
+	outMap := make(map[string]interface{})
+	outMap["jsonrpc"] = jsonrpcVersion
+	outMap["method"] = "subscription"
+	outMap["params"] = map[string]interface{}{
+		"subscription": id,
+		"result":       result,
+	}
+	outBytes, err := json.Marshal(outMap)
+	if err != nil {
+		return err
+	}
+	return n.write(websocket.TextMessage, outBytes)
+}
+
+func (n *Notifier) write(t int, data []byte) error {
+	n.wmu.Lock()
+	defer n.wmu.Unlock()
+	return n.conn.WriteMessage(t, data)
+}
+
+// activate starts the subscriptions created since the last call.
+func (n *Notifier) activate() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, run := range n.pending {
+		go run()
+	}
+	n.pending = nil
+}
+
+// close ends all the subscriptions of the connection.
+func (n *Notifier) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	n.closed = true
+	for id, quit := range n.subs {
+		close(quit)
+		delete(n.subs, id)
+	}
+	// the pending subscriptions see quit closed and release their resources
+	for _, run := range n.pending {
+		go run()
+	}
+	n.pending = nil
+}
@@ -0,0 +1,285 @@
+package p2p
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"xfsgo/log"
+	"xfsgo/p2p/discover"
+)
+
+const (
+	// DefaultCaptureMaxMessageSize is the size the data of a captured message is cut to
+	DefaultCaptureMaxMessageSize = 1 << 20
+	// maxReplayGap caps the wait between two replayed messages
+	maxReplayGap = 10 * time.Second
+)
+
+// replayLinger is how long a replay keeps reading the responses of the peer after the
+// last message is sent.
+var replayLinger = 5 * time.Second
+
+var errCaptureNoPath = errors.New("capture path not be empty")
+
+// CaptureConfig configures the capture of the protocol messages of the peers.
+type CaptureConfig struct {
+	// Path is the file the messages are appended to. If RingSize is set, only the last
+	// RingSize messages are kept in memory and written to the file when the capture is
+	// closed or dumped.
+	Path     string
+	RingSize int
+	// MaxMessageSize is the size the data of a message is cut to, the original size is
+	// kept in the record.
+	MaxMessageSize int
+}
+
+// CaptureRecord is a protocol message sent to or received from a peer, a capture is
+// stored as a record per line in json.
+type CaptureRecord struct {
+	// Time is the unix time in nanoseconds the message was sent or received.
+	Time    int64  `json:"time"`
+	Peer    string `json:"peer"`
+	Inbound bool   `json:"inbound"`
+	Type    uint8  `json:"type"`
+	Size    int    `json:"size"`
+	Data    []byte `json:"data"`
+}
+
+// Truncated reports whether the data of the message was cut by the size cap.
+func (r *CaptureRecord) Truncated() bool {
+	return len(r.Data) < r.Size
+}
+
+// Capture records the protocol messages of the peers for debugging, the heartbeats of
+// the peers are not recorded. A nil capture records nothing.
+type Capture struct {
+	config CaptureConfig
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	ring   []*CaptureRecord
+	next   int
+	count  uint64
+}
+
+// NewCapture creates the capture of the config, the capture file is created unless the
+// messages are kept in the ring.
+func NewCapture(config CaptureConfig) (*Capture, error) {
+	if config.Path == "" {
+		return nil, errCaptureNoPath
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = DefaultCaptureMaxMessageSize
+	}
+	c := &Capture{config: config}
+	if config.RingSize > 0 {
+		c.ring = make([]*CaptureRecord, 0, config.RingSize)
+		return c, nil
+	}
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	c.file = file
+	c.enc = json.NewEncoder(file)
+	return c, nil
+}
+
+func (c *Capture) record(id discover.NodeId, inbound bool, mType uint8, data []byte) {
+	if c == nil {
+		return
+	}
+	size := len(data)
+	if size > c.config.MaxMessageSize {
+		data = data[:c.config.MaxMessageSize]
+	}
+	r := &CaptureRecord{
+		Time:    time.Now().UnixNano(),
+		Peer:    id.String(),
+		Inbound: inbound,
+		Type:    mType,
+		Size:    size,
+		Data:    append([]byte{}, data...),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+	if c.enc != nil {
+		_ = c.enc.Encode(r)
+		return
+	}
+	if len(c.ring) < c.config.RingSize {
+		c.ring = append(c.ring, r)
+		return
+	}
+	c.ring[c.next] = r
+	c.next = (c.next + 1) % len(c.ring)
+}
+
+// Count returns the number of the messages recorded.
+func (c *Capture) Count() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+// Records returns the messages kept in the ring, the oldest first.
+func (c *Capture) Records() []*CaptureRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	records := make([]*CaptureRecord, 0, len(c.ring))
+	records = append(records, c.ring[c.next:]...)
+	return append(records, c.ring[:c.next]...)
+}
+
+// Dump writes the messages kept in the ring to the file.
+func (c *Capture) Dump(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, r := range c.Records() {
+		if err = enc.Encode(r); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Close closes the capture file, the messages kept in the ring are written to it.
+func (c *Capture) Close() error {
+	if c.file != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.file.Close()
+	}
+	return c.Dump(c.config.Path)
+}
+
+// ReadCapture reads the records of a capture.
+func ReadCapture(r io.Reader) ([]*CaptureRecord, error) {
+	dec := json.NewDecoder(r)
+	records := make([]*CaptureRecord, 0)
+	for {
+		record := new(CaptureRecord)
+		if err := dec.Decode(record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// ReplayProtocol sends the inbound messages of a capture to the peer it runs on, with
+// the gaps between the messages of the capture divided by the speed. The messages of
+// the peer are read and counted meanwhile.
+type ReplayProtocol struct {
+	records  []*CaptureRecord
+	speed    float64
+	logger   log.Logger
+	once     sync.Once
+	done     chan struct{}
+	mu       sync.Mutex
+	sent     int
+	received map[uint8]int
+}
+
+// NewReplayProtocol creates the replay of the inbound records, a speed of 0 sends the
+// messages without waiting.
+func NewReplayProtocol(records []*CaptureRecord, speed float64, logger log.Logger) *ReplayProtocol {
+	inbound := make([]*CaptureRecord, 0, len(records))
+	for _, r := range records {
+		if r.Inbound {
+			inbound = append(inbound, r)
+		}
+	}
+	if logger == nil {
+		logger = log.DefaultLogger()
+	}
+	return &ReplayProtocol{
+		records:  inbound,
+		speed:    speed,
+		logger:   logger,
+		done:     make(chan struct{}),
+		received: make(map[uint8]int),
+	}
+}
+
+// Done is closed when the replay finished, the replay runs on the first peer only.
+func (r *ReplayProtocol) Done() <-chan struct{} {
+	return r.done
+}
+
+// Stats returns the number of the messages sent and the messages received by type.
+func (r *ReplayProtocol) Stats() (int, map[uint8]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	received := make(map[uint8]int, len(r.received))
+	for k, v := range r.received {
+		received[k] = v
+	}
+	return r.sent, received
+}
+
+func (r *ReplayProtocol) Run(p Peer) error {
+	first := false
+	r.once.Do(func() {
+		first = true
+	})
+	if !first {
+		return nil
+	}
+	defer close(r.done)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			ch, err := p.GetProtocolMsgCh()
+			if err != nil {
+				return
+			}
+			select {
+			case msg := <-ch:
+				r.mu.Lock()
+				r.received[msg.Type()]++
+				r.mu.Unlock()
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var last int64
+	for _, record := range r.records {
+		if last != 0 && r.speed > 0 {
+			gap := time.Duration(float64(record.Time-last) / r.speed)
+			if gap > maxReplayGap {
+				gap = maxReplayGap
+			}
+			time.Sleep(gap)
+		}
+		last = record.Time
+		if record.Truncated() {
+			r.logger.Warnf("Replay truncated message: type=%d, size=%d", record.Type, record.Size)
+		}
+		if err := p.WriteMessage(record.Type, record.Data); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.sent++
+		r.mu.Unlock()
+	}
+	time.Sleep(replayLinger)
+	return nil
+}
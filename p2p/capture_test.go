@@ -0,0 +1,95 @@
+package p2p
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"xfsgo/assert"
+	"xfsgo/p2p/discover"
+)
+
+func TestCapture_ring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	c, err := NewCapture(CaptureConfig{Path: path, RingSize: 2, MaxMessageSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := discover.NodeId{0x01}
+	c.record(id, true, 10, []byte{1})
+	c.record(id, false, 11, []byte{1, 2})
+	c.record(id, true, 12, []byte{1, 2, 3, 4, 5, 6})
+	assert.Equal(t, c.Count(), uint64(3))
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := ReadCapture(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(records), 2)
+	assert.Equal(t, records[0].Type, uint8(11))
+	assert.Equal(t, records[0].Inbound, false)
+	assert.Equal(t, records[1].Peer, id.String())
+	assert.Equal(t, records[1].Data, []byte{1, 2, 3, 4})
+	assert.Equal(t, records[1].Size, 6)
+	assert.Equal(t, records[1].Truncated(), true)
+}
+
+type replayTestPeer struct {
+	written []uint8
+	ch      chan MessageReader
+	closed  chan struct{}
+}
+
+func (p *replayTestPeer) Is(int) bool                { return false }
+func (p *replayTestPeer) ID() discover.NodeId        { return discover.NodeId{} }
+func (p *replayTestPeer) RemoteNode() *discover.Node { return nil }
+func (p *replayTestPeer) RemoteAddr() *net.TCPAddr   { return nil }
+func (p *replayTestPeer) Close()                     {}
+func (p *replayTestPeer) Run()                       {}
+func (p *replayTestPeer) WriteMessage(mType uint8, data []byte) error {
+	p.written = append(p.written, mType)
+	return nil
+}
+func (p *replayTestPeer) WriteMessageObj(uint8, interface{}) error { return nil }
+func (p *replayTestPeer) GetProtocolMsgCh() (chan MessageReader, error) {
+	select {
+	case <-p.closed:
+		return nil, io.EOF
+	default:
+	}
+	return p.ch, nil
+}
+
+func TestReplayProtocol_Run(t *testing.T) {
+	defer func(linger time.Duration) {
+		replayLinger = linger
+	}(replayLinger)
+	replayLinger = 10 * time.Millisecond
+	records := []*CaptureRecord{
+		{Time: 1, Inbound: true, Type: 10, Size: 1, Data: []byte{1}},
+		{Time: 2, Inbound: false, Type: 11},
+		{Time: 3, Inbound: true, Type: 12},
+	}
+	p := &replayTestPeer{ch: make(chan MessageReader, 1), closed: make(chan struct{})}
+	defer close(p.closed)
+	p.ch <- &messageReader{mType: 20, data: bytes.NewReader(nil)}
+	replay := NewReplayProtocol(records, 0, nil)
+	if err := replay.Run(p); err != nil {
+		t.Fatal(err)
+	}
+	<-replay.Done()
+	assert.Equal(t, p.written, []uint8{10, 12})
+	sent, received := replay.Stats()
+	assert.Equal(t, sent, 2)
+	assert.Equal(t, received[20], 1)
+}
@@ -41,10 +41,11 @@ type peer struct {
 	psCh     chan MessageReader
 	encoder  encoder
 	logger   log.Logger
+	capture  *Capture
 }
 
 // create peer [Peer to peer connection session,Network protocol]
-func newPeer(conn *peerConn, ps []Protocol, en encoder) Peer {
+func newPeer(conn *peerConn, ps []Protocol, en encoder, capture *Capture) Peer {
 	p := &peer{
 		conn:    conn,
 		id:      conn.id,
@@ -54,6 +55,7 @@ func newPeer(conn *peerConn, ps []Protocol, en encoder) Peer {
 		close:   make(chan struct{}),
 		psCh:    make(chan MessageReader),
 		encoder: en,
+		capture: capture,
 	}
 	now := time.Now()
 	p.lastTime = now.Unix()
@@ -110,6 +112,7 @@ func (p *peer) handle(msg MessageReader) {
 		now := time.Now()
 		p.lastTime = now.Unix()
 	default:
+		p.capture.record(p.id, true, msg.Type(), data)
 		bodyBs := msg.RawReader()
 		cpy := &messageReader{
 			raw:   bodyBs,
@@ -136,6 +139,7 @@ func (p *peer) WriteMessage(mType uint8, bs []byte) error {
 		return errors.New("peer closed")
 	default:
 	}
+	p.capture.record(p.id, false, mType, bs)
 	return p.conn.writeMessage(mType, bs)
 }
 
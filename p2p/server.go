@@ -71,6 +71,8 @@ type Config struct {
 	MaxPeers       int
 	Logger         log.Logger
 	Encoder        encoder
+	// Capture records the protocol messages of the peers if set
+	Capture *Capture
 }
 
 // NewServer Creates background service object
@@ -254,7 +256,7 @@ func (srv *server) run(dialer *dialstate) {
 			delete(srv.peers, n)
 		// add peer
 		case c := <-srv.addpeer:
-			p := newPeer(c, srv.protocols, srv.config.Encoder)
+			p := newPeer(c, srv.protocols, srv.config.Encoder, srv.config.Capture)
 			srv.peers[c.id] = p
 			srv.logger.Debugf("Successfully join peers: id=%s, from:%s", c.id, p.RemoteAddr())
 			go srv.runPeer(p)
@@ -0,0 +1,86 @@
+// Package params holds the consensus-critical constants of the chains. The chain config
+// falls back to them for the parameters a genesis does not set.
+package params
+
+import "math/big"
+
+// Difficulty retargeting, the times are in seconds.
+const (
+	// TargetTimePerBlock is the block time the difficulty is retargeted to.
+	TargetTimePerBlock = int64(3 * 60)
+	// TargetTimespanPreV4 and TargetTimespanV4 are the timespans of a retarget period
+	// before and after the V4 rules.
+	TargetTimespanPreV4 = int64(60 * 60)
+	TargetTimespanV4    = int64(57 * 60)
+	// EndTimeV2, EndTimeV3 and EndTimeV4 are the durations of the difficulty rules of
+	// the versions, which end after the blocks of their duration at the target time.
+	EndTimeV2 = int64(1008 * 60 * 60)
+	EndTimeV3 = int64(168 * 60 * 60)
+	EndTimeV4 = int64(538 * 60 * 60)
+	// RetargetAdjustmentFactor bounds the timespan of a retarget period to the target
+	// timespan divided or multiplied by it.
+	RetargetAdjustmentFactor = int64(2)
+	// DifficultyCheckV3Height and DifficultyCheckV4Height are the heights up to which
+	// the difficulty of the blocks of the V3 and V4 rules is not checked.
+	DifficultyCheckV3Height = uint64(22180)
+	DifficultyCheckV4Height = uint64(23555)
+)
+
+// Genesis difficulty bits of the networks.
+const (
+	MainNetGenesisBits = uint32(267386909)
+	TestNetGenesisBits = uint32(4278190109)
+)
+
+// Block timestamps.
+const (
+	// MedianTimeBlocks is the number of previous blocks the median time past of a block
+	// is calculated from.
+	MedianTimeBlocks = 11
+	// MaxTimeOffset is how far in the future a block timestamp may be relative to the
+	// local clock, in seconds.
+	MaxTimeOffset = int64(2 * 60 * 60)
+	// RandomnessBlocks is the number of previous blocks whose header hashes are mixed
+	// into the randomness of a block.
+	RandomnessBlocks = 16
+)
+
+// Transaction and account size caps.
+const (
+	// MaxTxDataSize is the maximum size of the data of a transaction.
+	MaxTxDataSize = 128 * 1024
+	// MaxCodeSize is the maximum size of the code of a contract.
+	MaxCodeSize = 24 * 1024
+	// MaxExtraSize is the maximum size in bytes of the extra data of an account.
+	MaxExtraSize = 256
+)
+
+// Block rewards.
+const (
+	// RewardInterval is the number of blocks after which the main network reduces the
+	// subsidy by RewardReductionPercent.
+	RewardInterval         = uint64(480)
+	RewardReductionPercent = uint32(50)
+)
+
+var (
+	// MainNetInitialReward is the subsidy of the first blocks of the main network.
+	MainNetInitialReward, _ = new(big.Int).SetString("93755722410000000000", 10)
+	// TestNetReward is the constant subsidy of the test network.
+	TestNetReward, _ = new(big.Int).SetString("14000000000000000000", 10)
+)
+
+// Gas.
+var (
+	// TxGas is the gas of a transaction.
+	TxGas = big.NewInt(25000)
+	// GasLimitBoundDivisor bounds the change of the gas limit between two blocks, a block
+	// may move the gas limit of its parent by at most parent / GasLimitBoundDivisor.
+	GasLimitBoundDivisor = big.NewInt(1024)
+	// GenesisGasLimit is the gas limit of the genesis block.
+	GenesisGasLimit = new(big.Int).Mul(TxGas, big.NewInt(100))
+	// MinGasLimit is the lowest gas limit of a block.
+	MinGasLimit = TxGas
+	// ExtraGasPerByte is the gas charged for each byte written into the extra data of an account.
+	ExtraGasPerByte = big.NewInt(200)
+)
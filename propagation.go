@@ -0,0 +1,29 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+// PeerPropagation is how fast a peer announces new blocks to the node. First is the
+// number of blocks the peer announced before any other peer, AvgDelay the moving average
+// of the delay in milliseconds of its announcements after the first one. Rank 1 is the
+// peer announcing new blocks first most often.
+type PeerPropagation struct {
+	ID        string `json:"id"`
+	Rank      int    `json:"rank"`
+	Announced uint64 `json:"announced"`
+	First     uint64 `json:"first"`
+	AvgDelay  int64  `json:"avg_delay"`
+}
@@ -22,6 +22,7 @@ import (
 	"xfsgo/common"
 	"xfsgo/common/ahash"
 	"xfsgo/common/rawencode"
+	"xfsgo/core"
 )
 
 type Receipt struct {
@@ -29,6 +30,39 @@ type Receipt struct {
 	Status  uint32      `json:"status"`
 	TxHash  common.Hash `json:"tx_hash"`
 	GasUsed *big.Int    `json:"gas_used"`
+	// VMError is the vm error code of a failed contract execution
+	VMError uint32 `json:"vm_error,omitempty"`
+	// Logs and Bloom are only present for transactions which emitted logs
+	Logs  []*core.Log `json:"logs,omitempty"`
+	Bloom *core.Bloom `json:"bloom,omitempty"`
+}
+
+// SetLogs attaches the logs emitted by the transaction and their bloom to the receipt.
+func (r *Receipt) SetLogs(logs []*core.Log) {
+	if len(logs) == 0 {
+		r.Logs = nil
+		r.Bloom = nil
+		return
+	}
+	bloom := core.CreateBloom(logs)
+	r.Logs = logs
+	r.Bloom = &bloom
+}
+
+// DeriveLogFields sets the block, the transaction and the index in the block of the
+// logs of the receipts of the block, the receipts are in the order of the transactions.
+func DeriveLogFields(receipts []*Receipt, blockHash common.Hash, height uint64) {
+	var index uint
+	for i, r := range receipts {
+		for _, l := range r.Logs {
+			l.BlockHeight = height
+			l.BlockHash = blockHash
+			l.TxHash = r.TxHash
+			l.TxIndex = uint(i)
+			l.Index = index
+			index++
+		}
+	}
 }
 
 func NewReceipt(txHash common.Hash) *Receipt {
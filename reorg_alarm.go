@@ -0,0 +1,201 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"xfsgo/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReorgWebhookTimeout = 10 * time.Second
+	// maxReorgAlarms is the number of the last alarms kept by the monitor
+	maxReorgAlarms = 32
+)
+
+// ReorgAlarmConfig configures the alarm raised on deep reorgs.
+type ReorgAlarmConfig struct {
+	// Depth is the number of dropped blocks a reorg must exceed to raise the alarm.
+	Depth int
+	// Webhook is the url the alarms are posted to as json, if set.
+	Webhook string
+	// Timeout bounds the webhook requests.
+	Timeout time.Duration
+}
+
+// ReorgAlarm is raised by a reorg dropping more than the configured number of blocks.
+// LocalTxs are the orphaned transactions sent from or to an account of the wallet.
+type ReorgAlarm struct {
+	Time     int64         `json:"time"`
+	Depth    int           `json:"depth"`
+	Dropped  []common.Hash `json:"dropped"`
+	Added    []common.Hash `json:"added"`
+	LocalTxs []common.Hash `json:"local_txs"`
+}
+
+// ReorgAlarmStats are the counters of the reorgs seen by the monitor.
+type ReorgAlarmStats struct {
+	Reorgs   uint64        `json:"reorgs"`
+	Alarms   uint64        `json:"alarms"`
+	MaxDepth int           `json:"max_depth"`
+	Recent   []*ReorgAlarm `json:"recent"`
+}
+
+// ReorgMonitor watches the reorgs of the chain and raises an alarm for the deep ones,
+// so clients can pause the operations relying on the confirmations.
+type ReorgMonitor struct {
+	config   ReorgAlarmConfig
+	eventBus *EventBus
+	// owns reports whether the address is an account of the local wallet
+	owns     func(addr common.Address) bool
+	client   *http.Client
+	mu       sync.Mutex
+	stats    ReorgAlarmStats
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReorgMonitor creates a monitor of the reorgs published to the event bus, owns may
+// be nil if the node has no wallet.
+func NewReorgMonitor(config ReorgAlarmConfig, eventBus *EventBus, owns func(addr common.Address) bool) *ReorgMonitor {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultReorgWebhookTimeout
+	}
+	return &ReorgMonitor{
+		config:   config,
+		eventBus: eventBus,
+		owns:     owns,
+		client:   &http.Client{Timeout: config.Timeout},
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start watches the reorgs until the monitor is stopped.
+func (m *ReorgMonitor) Start() {
+	sub := m.eventBus.Subscript(ChainReorgEvent{})
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case e := <-sub.Chan():
+				if alarm := m.handleReorg(e.(ChainReorgEvent)); alarm != nil && m.config.Webhook != "" {
+					go m.post(alarm)
+				}
+			case <-m.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (m *ReorgMonitor) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.quit)
+	})
+}
+
+// handleReorg counts the reorg and returns its alarm, nil unless it exceeds the depth.
+func (m *ReorgMonitor) handleReorg(e ChainReorgEvent) *ReorgAlarm {
+	depth := len(e.Dropped)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Reorgs++
+	if depth > m.stats.MaxDepth {
+		m.stats.MaxDepth = depth
+	}
+	if depth <= m.config.Depth {
+		return nil
+	}
+	alarm := &ReorgAlarm{
+		Time:     time.Now().Unix(),
+		Depth:    depth,
+		Dropped:  e.Dropped,
+		Added:    e.Added,
+		LocalTxs: make([]common.Hash, 0),
+	}
+	for _, tx := range e.Orphaned {
+		if m.isLocal(tx) {
+			alarm.LocalTxs = append(alarm.LocalTxs, tx.Hash())
+		}
+	}
+	m.stats.Alarms++
+	m.stats.Recent = append(m.stats.Recent, alarm)
+	if len(m.stats.Recent) > maxReorgAlarms {
+		m.stats.Recent = m.stats.Recent[len(m.stats.Recent)-maxReorgAlarms:]
+	}
+	logrus.WithFields(logrus.Fields{
+		"depth":    depth,
+		"dropped":  len(e.Dropped),
+		"added":    len(e.Added),
+		"localtxs": len(alarm.LocalTxs),
+	}).Errorf("Deep chain reorg: depth=%d, limit=%d", depth, m.config.Depth)
+	return alarm
+}
+
+func (m *ReorgMonitor) isLocal(tx *Transaction) bool {
+	if m.owns == nil {
+		return false
+	}
+	if m.owns(tx.To) {
+		return true
+	}
+	from, err := tx.FromAddr()
+	return err == nil && m.owns(from)
+}
+
+func (m *ReorgMonitor) post(alarm *ReorgAlarm) {
+	if err := m.postAlarm(alarm); err != nil {
+		logrus.Warnf("Failed to post reorg alarm: url=%s, err=%s", m.config.Webhook, err)
+	}
+}
+
+func (m *ReorgMonitor) postAlarm(alarm *ReorgAlarm) error {
+	data, err := json.Marshal(alarm)
+	if err != nil {
+		return err
+	}
+	res, err := m.client.Post(m.config.Webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// Stats returns the counters of the reorgs and the last alarms.
+func (m *ReorgMonitor) Stats() *ReorgAlarmStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.stats
+	stats.Recent = append(make([]*ReorgAlarm, 0, len(m.stats.Recent)), m.stats.Recent...)
+	return &stats
+}
+
+// Depth returns the number of dropped blocks a reorg must exceed to raise the alarm.
+func (m *ReorgMonitor) Depth() int {
+	return m.config.Depth
+}
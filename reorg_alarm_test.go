@@ -0,0 +1,64 @@
+package xfsgo
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+func TestReorgMonitor_alarm(t *testing.T) {
+	alarms := make(chan *ReorgAlarm, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alarm := new(ReorgAlarm)
+		if err := json.NewDecoder(r.Body).Decode(alarm); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		alarms <- alarm
+	}))
+	defer server.Close()
+
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := crypto.DefaultPubKey2Addr(key.PublicKey)
+	owns := func(addr common.Address) bool {
+		return addr == local
+	}
+	sent := NewTransactionByStd(&StdTransaction{To: common.Address{0x01}, Value: big.NewInt(1), GasPrice: big.NewInt(1), GasLimit: common.TxGas})
+	if err = sent.SignWithPrivateKey(key); err != nil {
+		t.Fatal(err)
+	}
+	other := NewTransactionByStd(&StdTransaction{To: common.Address{0x02}, Value: big.NewInt(1), GasPrice: big.NewInt(1), GasLimit: common.TxGas})
+
+	eventBus := NewEventBus()
+	m := NewReorgMonitor(ReorgAlarmConfig{Depth: 2, Webhook: server.URL}, eventBus, owns)
+	m.Start()
+	defer m.Stop()
+	assert.Equal(t, m.handleReorg(ChainReorgEvent{Dropped: []common.Hash{{1}, {2}}}) == nil, true)
+	eventBus.Publish(ChainReorgEvent{
+		Dropped:  []common.Hash{{1}, {2}, {3}},
+		Added:    []common.Hash{{4}, {5}, {6}, {7}},
+		Orphaned: []*Transaction{sent, other},
+	})
+	select {
+	case alarm := <-alarms:
+		assert.Equal(t, alarm.Depth, 3)
+		assert.Equal(t, alarm.Dropped, []common.Hash{{1}, {2}, {3}})
+		assert.Equal(t, alarm.LocalTxs, []common.Hash{sent.Hash()})
+	case <-time.After(5 * time.Second):
+		t.Fatal("alarm not posted")
+	}
+	stats := m.Stats()
+	assert.Equal(t, stats.Reorgs, uint64(2))
+	assert.Equal(t, stats.Alarms, uint64(1))
+	assert.Equal(t, stats.MaxDepth, 3)
+	assert.Equal(t, len(stats.Recent), 1)
+}
@@ -0,0 +1,235 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"xfsgo/storage/badger"
+)
+
+const (
+	// APIKeyService is the name of the admin service managing the api keys, it can
+	// only be called with the admin key.
+	APIKeyService = "APIKey"
+	// AllMethods is the method name of a quota limiting the calls of every method.
+	AllMethods = "*"
+	// apiKeyLen is the number of random bytes of a generated key.
+	apiKeyLen   = 16
+	secondsADay = int64(24 * time.Hour / time.Second)
+)
+
+var apiKeyPre = []byte("apikey:")
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRevoked  = errors.New("api key revoked")
+
+	errAPIKeyRequired  = NewRPCError(-32010, "api key required")
+	errInvalidAPIKey   = NewRPCError(-32010, "invalid api key")
+	errAPIKeyForbidden = NewRPCError(-32011, "method not allowed for api key")
+	errQuotaExceeded   = NewRPCError(-32012, "api key quota exceeded")
+)
+
+// APIKey is a key identifying a client of the RPC server and its usage.
+type APIKey struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Created int64  `json:"created"`
+	Revoked bool   `json:"revoked"`
+	// Quotas limits the calls of a method per day, the quota of AllMethods
+	// limits the calls of all methods together.
+	Quotas map[string]uint64 `json:"quotas,omitempty"`
+	// Usage counts the calls of each method since the key was created,
+	// DayUsage counts the calls of the day the quotas currently apply to.
+	Usage    map[string]uint64 `json:"usage,omitempty"`
+	Day      int64             `json:"day"`
+	DayUsage map[string]uint64 `json:"day_usage,omitempty"`
+}
+
+func (k *APIKey) Encode() ([]byte, error) {
+	return json.Marshal(k)
+}
+
+func (k *APIKey) Decode(data []byte) error {
+	return json.Unmarshal(data, k)
+}
+
+func (k *APIKey) copy() *APIKey {
+	cpy := *k
+	cpy.Quotas = copyCounters(k.Quotas)
+	cpy.Usage = copyCounters(k.Usage)
+	cpy.DayUsage = copyCounters(k.DayUsage)
+	return &cpy
+}
+
+func copyCounters(m map[string]uint64) map[string]uint64 {
+	if m == nil {
+		return nil
+	}
+	cpy := make(map[string]uint64, len(m))
+	for k, v := range m {
+		cpy[k] = v
+	}
+	return cpy
+}
+
+// APIKeyStore manages the api keys of the RPC server, keys and their usage
+// counters are persisted in the storage.
+type APIKeyStore struct {
+	mu       sync.Mutex
+	storage  badger.IStorage
+	adminKey string
+	keys     map[string]*APIKey
+}
+
+// NewAPIKeyStore loads the api keys from the storage. Requests carrying the admin key
+// may call every method, including those of the APIKeyService.
+func NewAPIKeyStore(storage badger.IStorage, adminKey string) (*APIKeyStore, error) {
+	s := &APIKeyStore{
+		storage:  storage,
+		adminKey: adminKey,
+		keys:     make(map[string]*APIKey),
+	}
+	err := storage.PrefixForeachData(apiKeyPre, func(k []byte, v []byte) error {
+		key := new(APIKey)
+		if err := key.Decode(v); err != nil {
+			return err
+		}
+		s.keys[key.Key] = key
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *APIKeyStore) put(key *APIKey) error {
+	data, err := key.Encode()
+	if err != nil {
+		return err
+	}
+	dbKey := append(append([]byte{}, apiKeyPre...), key.Key...)
+	return s.storage.SetData(dbKey, data)
+}
+
+// Create generates a new api key with the given per day method quotas.
+func (s *APIKeyStore) Create(name string, quotas map[string]uint64) (*APIKey, error) {
+	var buf [apiKeyLen]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	key := &APIKey{
+		Key:     hex.EncodeToString(buf[:]),
+		Name:    name,
+		Created: now,
+		Quotas:  copyCounters(quotas),
+		Day:     now / secondsADay,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.put(key); err != nil {
+		return nil, err
+	}
+	s.keys[key.Key] = key
+	return key.copy(), nil
+}
+
+// Revoke disables the api key, its usage is kept.
+func (s *APIKeyStore) Revoke(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, exists := s.keys[key]
+	if !exists {
+		return ErrAPIKeyNotFound
+	}
+	if k.Revoked {
+		return ErrAPIKeyRevoked
+	}
+	k.Revoked = true
+	return s.put(k)
+}
+
+// Get returns the api key with its usage.
+func (s *APIKeyStore) Get(key string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, exists := s.keys[key]
+	if !exists {
+		return nil, ErrAPIKeyNotFound
+	}
+	return k.copy(), nil
+}
+
+// List returns all api keys.
+func (s *APIKeyStore) List() []*APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k.copy())
+	}
+	return keys
+}
+
+// authorize checks whether the method may be called with the api key and
+// accounts the call to the key.
+func (s *APIKeyStore) authorize(key string, method string) error {
+	if s.adminKey != "" && key == s.adminKey {
+		return nil
+	}
+	if key == "" {
+		return errAPIKeyRequired
+	}
+	if strings.HasPrefix(method, APIKeyService+".") {
+		return errAPIKeyForbidden
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, exists := s.keys[key]
+	if !exists || k.Revoked {
+		return errInvalidAPIKey
+	}
+	if day := time.Now().Unix() / secondsADay; day != k.Day {
+		k.Day = day
+		k.DayUsage = nil
+	}
+	if quota, ok := k.Quotas[method]; ok && k.DayUsage[method] >= quota {
+		return errQuotaExceeded
+	}
+	if quota, ok := k.Quotas[AllMethods]; ok && k.DayUsage[AllMethods] >= quota {
+		return errQuotaExceeded
+	}
+	if k.Usage == nil {
+		k.Usage = make(map[string]uint64)
+	}
+	if k.DayUsage == nil {
+		k.DayUsage = make(map[string]uint64)
+	}
+	k.Usage[method] += 1
+	k.Usage[AllMethods] += 1
+	k.DayUsage[method] += 1
+	k.DayUsage[AllMethods] += 1
+	return s.put(k)
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+	"xfsgo/common/ahash"
+)
+
+const (
+	// confirmWindow is the time a delayed call can be confirmed once it is due.
+	confirmWindow = 5 * time.Minute
+	// confirmIdLen is the number of random bytes of a confirmation id.
+	confirmIdLen = 16
+)
+
+var (
+	errConfirmRequired = errors.New("confirmation required")
+
+	errCosignRequired    = NewRPCError(-32013, "second api key required")
+	errInvalidCosign     = NewRPCError(-32013, "invalid second api key")
+	errInvalidConfirm    = NewRPCError(-32014, "invalid confirmation")
+	errConfirmNotDue     = NewRPCError(-32014, "confirmation not due")
+	errCosignUnavailable = NewRPCError(-32013, "second api key requires api keys enabled")
+	errDelayUnavailable  = NewRPCError(-32014, "delayed confirmation requires api keys enabled")
+)
+
+// ConfirmPolicy is the confirmation a dangerous method requires before it is executed.
+// Cosign requires the call to carry a second api key, different from the one of the
+// caller. A delay requires the call to be made twice: the first call returns the id of
+// a confirmation, the second call carries it with the same api key and params once the
+// delay has passed. Both require api keys to be enabled.
+type ConfirmPolicy struct {
+	Cosign bool
+	Delay  time.Duration
+}
+
+// ConfirmRequiredData is the data of the error returned by the first call of a method
+// requiring a delayed confirmation.
+type ConfirmRequiredData struct {
+	Confirmation string `json:"confirmation"`
+	NotBefore    int64  `json:"not_before"`
+	Expires      int64  `json:"expires"`
+}
+
+type cosignKeyKey struct{}
+type confirmIdKey struct{}
+
+// confirmContext returns the context of a request carrying the second api key and the
+// confirmation id of the request.
+func confirmContext(ctx context.Context, r *http.Request) context.Context {
+	if key := r.Header.Get("X-API-Key-Cosign"); key != "" {
+		ctx = context.WithValue(ctx, cosignKeyKey{}, key)
+	}
+	confirmation := r.Header.Get("X-Confirmation")
+	if confirmation == "" {
+		confirmation = r.URL.Query().Get("confirmation")
+	}
+	if confirmation != "" {
+		ctx = context.WithValue(ctx, confirmIdKey{}, confirmation)
+	}
+	return ctx
+}
+
+type pendingConfirm struct {
+	method    string
+	apiKey    string
+	digest    []byte
+	notBefore time.Time
+	expires   time.Time
+}
+
+// rpcConfirmations holds the delayed calls waiting for their confirmation.
+type rpcConfirmations struct {
+	mu      sync.Mutex
+	pending map[string]*pendingConfirm
+}
+
+func newRPCConfirmations() *rpcConfirmations {
+	return &rpcConfirmations{
+		pending: make(map[string]*pendingConfirm),
+	}
+}
+
+// request registers a delayed call and returns the error carrying its confirmation id.
+func (c *rpcConfirmations) request(method, apiKey string, digest []byte, delay time.Duration) error {
+	var buf [confirmIdLen]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return err
+	}
+	now := time.Now()
+	p := &pendingConfirm{
+		method:    method,
+		apiKey:    apiKey,
+		digest:    digest,
+		notBefore: now.Add(delay),
+		expires:   now.Add(delay + confirmWindow),
+	}
+	id := hex.EncodeToString(buf[:])
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, v := range c.pending {
+		if now.After(v.expires) {
+			delete(c.pending, k)
+		}
+	}
+	c.pending[id] = p
+	return NewRPCErrorData(-32014, errConfirmRequired, &ConfirmRequiredData{
+		Confirmation: id,
+		NotBefore:    p.notBefore.Unix(),
+		Expires:      p.expires.Unix(),
+	})
+}
+
+// confirm consumes the confirmation of a delayed call, a confirmation is used once.
+func (c *rpcConfirmations) confirm(id, method, apiKey string, digest []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, exists := c.pending[id]
+	if !exists || p.method != method || p.apiKey != apiKey || string(p.digest) != string(digest) {
+		return errInvalidConfirm
+	}
+	now := time.Now()
+	if now.After(p.expires) {
+		delete(c.pending, id)
+		return errInvalidConfirm
+	}
+	if now.Before(p.notBefore) {
+		return errConfirmNotDue
+	}
+	delete(c.pending, id)
+	return nil
+}
+
+// confirm checks the call of the method satisfies the confirmation policy of the method.
+func (server *RPCServer) confirm(ctx context.Context, apiKey string, method string, params interface{}) error {
+	policy, exists := server.config.Confirm[method]
+	if !exists {
+		return nil
+	}
+	if policy.Cosign {
+		if server.apiKeys == nil {
+			return errCosignUnavailable
+		}
+		cosignKey, _ := ctx.Value(cosignKeyKey{}).(string)
+		if cosignKey == "" {
+			return errCosignRequired
+		}
+		if cosignKey == apiKey {
+			return errInvalidCosign
+		}
+		if err := server.apiKeys.authorize(cosignKey, method); err != nil {
+			return errInvalidCosign
+		}
+	}
+	if policy.Delay <= 0 {
+		return nil
+	}
+	// the confirmation is bound to the api key of the call, without api keys any
+	// client could confirm the call of another one
+	if server.apiKeys == nil {
+		return errDelayUnavailable
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	digest := ahash.SHA256(data)
+	if id, _ := ctx.Value(confirmIdKey{}).(string); id != "" {
+		return server.confirmations.confirm(id, method, apiKey, digest)
+	}
+	return server.confirmations.request(method, apiKey, digest, policy.Delay)
+}
@@ -17,6 +17,7 @@
 package xfsgo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -27,6 +28,7 @@ import (
 type Client struct {
 	hostUrl string
 	timeOut string
+	apiKey  string
 }
 
 type jsonRPCReq struct {
@@ -50,8 +52,19 @@ func NewClient(url, timeOut string) *Client {
 	}
 }
 
+// SetAPIKey sets the api key sent with every call.
+func (cli *Client) SetAPIKey(key string) {
+	cli.apiKey = key
+}
+
 // CallMethod executes a JSON-RPC call with the given psrameters,which is important to the rpc server.
 func (cli *Client) CallMethod(id int, methodname string, params interface{}, out interface{}) error {
+	return cli.CallMethodContext(context.Background(), id, methodname, params, out)
+}
+
+// CallMethodContext executes a JSON-RPC call like CallMethod, the call is abandoned when
+// the context is done before the timeout of the client.
+func (cli *Client) CallMethodContext(ctx context.Context, id int, methodname string, params interface{}, out interface{}) error {
 	client := resty.New()
 
 	timeDur, err := time.ParseDuration(cli.timeOut)
@@ -68,7 +81,9 @@ func (cli *Client) CallMethod(id int, methodname string, params interface{}, out
 	// The result must be a pointer so that response json can unmarshal into it.
 	var resp *jsonRPCResp = nil
 	r, err := client.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
+		SetHeader("X-API-Key", cli.apiKey).
 		SetBody(req).
 		SetResult(&resp). // or SetResult(AuthSuccess{}).
 		Post(cli.hostUrl)
@@ -19,8 +19,9 @@ package xfsgo
 import "fmt"
 
 type RPCError struct {
-	Code    int    `json:"code,omitempty"`
-	Message string `json:"message,omitempty"`
+	Code    int         `json:"code,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
 func NewRPCError(code int, message string) *RPCError {
@@ -37,6 +38,15 @@ func NewRPCErrorCause(code int, err error) *RPCError {
 	}
 }
 
+// NewRPCErrorData creates an RPCError carrying additional structured data about the error.
+func NewRPCErrorData(code int, err error, data interface{}) *RPCError {
+	return &RPCError{
+		Code:    code,
+		Message: err.Error(),
+		Data:    data,
+	}
+}
+
 func (e *RPCError) Error() string {
 	return fmt.Sprintf("%d: %s", e.Code, e.Message)
 }
@@ -18,6 +18,7 @@ package xfsgo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -29,7 +30,10 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"xfsgo/log"
+	"xfsgo/trace"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -44,7 +48,11 @@ var (
 	invalidRequestError = NewRPCError(-32600, "invalid request")
 	methodNotFoundError = NewRPCError(-32601, "method not found")
 	//invalidParamsError = NewRPCError(-32602, "invalid params")
-	//internalError = NewRPCError(-32603, "invalid params")
+	internalError = NewRPCError(-32603, "internal error")
+	// ErrRequestTimedOut and ErrRequestCancelled are returned for the calls which did
+	// not finish before the deadline of the request or whose client went away.
+	ErrRequestTimedOut  = NewRPCError(-32020, "request timed out")
+	ErrRequestCancelled = NewRPCError(-32021, "request cancelled")
 )
 
 type methodType struct {
@@ -52,6 +60,17 @@ type methodType struct {
 	ArgType   reflect.Type
 	ReplyType reflect.Type
 	numCalls  uint
+	// hasCtx is set for methods taking the context of the call as first argument
+	hasCtx bool
+	// cancellable is set for methods which stop their work when the context is done
+	cancellable bool
+}
+
+// CancellableService is implemented by the services whose listed methods take the
+// context of the call and stop their work when it is done. Only the calls of these
+// methods return at their timeout, the calls of the other methods run to completion.
+type CancellableService interface {
+	CancellableMethods() []string
 }
 
 type service struct {
@@ -67,15 +86,56 @@ type jsonRPCObj struct {
 	params  interface{}
 }
 type jsonRPCRespErr struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
 type RPCConfig struct {
 	ListenAddr string
 	Logger     log.Logger
+	// APIKeys enables api key enforcement, AdminKey is the key allowed to
+	// manage the api keys.
+	APIKeys  bool
+	AdminKey string
+	// Namespace serves the rpc at the path /<namespace> instead of the root, servers
+	// of different namespaces can share a listen address.
+	Namespace string
+	// Timeout bounds the execution of a call, MethodTimeouts overrides it for the
+	// methods named like Chain.GetBlockByHash. A zero timeout does not bound the call.
+	Timeout        time.Duration
+	MethodTimeouts map[string]time.Duration
+	// Confirm lists the dangerous methods which must be confirmed before they are executed.
+	Confirm map[string]ConfirmPolicy
+}
+
+// ContextError returns the rpc error of a done context, it is nil while the context
+// is not done. Handlers return it to stop the work of a timed out or cancelled call.
+func ContextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return ErrRequestTimedOut
+	}
+	return ErrRequestCancelled
+}
+
+var errRPCNamespaceServed = errors.New("rpc namespace already served")
+
+// sharedListener serves the rpc servers of several namespaces on one listen address.
+type sharedListener struct {
+	mux   *http.ServeMux
+	paths map[string]struct{}
+	done  chan struct{}
+	err   error
 }
 
+var (
+	sharedListenersMu sync.Mutex
+	sharedListeners   = make(map[string]*sharedListener)
+)
+
 // RPCServer is an RPC server.
 type RPCServer struct {
 	logger     log.Logger
@@ -83,8 +143,16 @@ type RPCServer struct {
 	ginEngine  *gin.Engine
 	upgrader   websocket.Upgrader
 	serviceMap map[string]*service
+	apiKeys    *APIKeyStore
+	readProxy  ReadProxyFn
+	// confirmations are the delayed calls waiting for their confirmation
+	confirmations *rpcConfirmations
 }
 
+// ReadProxyFn may answer a call in place of the server, proxied is false if the server
+// should execute the call itself.
+type ReadProxyFn func(method string, params interface{}) (result interface{}, proxied bool, err error)
+
 func ginlogger(log log.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if len(c.Errors) > 0 {
@@ -100,7 +168,7 @@ func ginCors() gin.HandlerFunc {
 		if origin != "" {
 			c.Header("Access-Control-Allow-Origin", "*")
 			c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, UPDATE")
-			c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization")
+			c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, X-API-Key")
 			c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Cache-Control, Content-Language, Content-Type")
 			c.Header("Access-Control-Allow-Credentials", "true")
 		}
@@ -113,9 +181,10 @@ func ginCors() gin.HandlerFunc {
 
 func NewRPCServer(config *RPCConfig) *RPCServer {
 	server := &RPCServer{
-		logger:     config.Logger,
-		config:     config,
-		serviceMap: make(map[string]*service),
+		logger:        config.Logger,
+		config:        config,
+		serviceMap:    make(map[string]*service),
+		confirmations: newRPCConfirmations(),
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -133,7 +202,31 @@ func NewRPCServer(config *RPCConfig) *RPCServer {
 	return server
 }
 
-func (s *service) callMethod(mtype *methodType, params interface{}) (interface{}, error) {
+func isStructuredKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Slice, reflect.Map, reflect.Struct, reflect.Ptr:
+		return true
+	}
+	return false
+}
+
+func decodeStructuredParam(value interface{}, field reflect.Value) error {
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, field.Addr().Interface())
+}
+
+// callMethod calls the method of the service, a panic of the method is recovered and
+// returned as an internal error so that it only fails the call.
+func (s *service) callMethod(ctx context.Context, mtype *methodType, params interface{}) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			DefaultCrashReporter.Report("rpc "+s.name+"."+mtype.method.Name, r)
+			result, err = nil, internalError
+		}
+	}()
 	function := mtype.method.Func
 	argIsValue := false
 	var argv reflect.Value
@@ -183,6 +276,11 @@ func (s *service) callMethod(mtype *methodType, params interface{}) (interface{}
 							if argv.FieldByName(fieldInfo.Name).Type() == reflect.TypeOf(data) {
 								argv.FieldByName(fieldInfo.Name).Set(reflect.ValueOf(data))
 							}
+						} else if isStructuredKind(fieldInfo.Type.Kind()) {
+							// Support structured types like lists and objects
+							if err := decodeStructuredParam(value, argv.FieldByName(fieldInfo.Name)); err != nil {
+								return nil, NewRPCError(-32602, "Invalid params")
+							}
 						}
 					}
 				}
@@ -196,7 +294,11 @@ func (s *service) callMethod(mtype *methodType, params interface{}) (interface{}
 	case reflect.Slice:
 		replyv.Elem().Set(reflect.MakeSlice(mtype.ReplyType.Elem(), 0, 0))
 	}
-	returnValues := function.Call([]reflect.Value{s.rcvr, argv, replyv})
+	in := []reflect.Value{s.rcvr, argv, replyv}
+	if mtype.hasCtx {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	returnValues := function.Call(in)
 	errInter := returnValues[0].Interface()
 	if errInter != nil {
 		e := errInter.(error)
@@ -204,6 +306,18 @@ func (s *service) callMethod(mtype *methodType, params interface{}) (interface{}
 	}
 	return replyv.Interface(), nil
 }
+
+// SetAPIKeyStore enables api key enforcement, every call must carry a valid key of the
+// store which is accounted for the call.
+func (server *RPCServer) SetAPIKeyStore(store *APIKeyStore) {
+	server.apiKeys = store
+}
+
+// SetReadProxy sets the proxy offered every call before the server executes it.
+func (server *RPCServer) SetReadProxy(proxy ReadProxyFn) {
+	server.readProxy = proxy
+}
+
 func (server *RPCServer) Register(rcvr interface{}) error {
 	return server.register(rcvr, "", false)
 }
@@ -222,7 +336,10 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 	return token.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
-var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
 
 func suitableMethods(typ reflect.Type) map[string]*methodType {
 	methods := make(map[string]*methodType)
@@ -233,14 +350,20 @@ func suitableMethods(typ reflect.Type) map[string]*methodType {
 		if method.PkgPath != "" {
 			continue
 		}
-		if mtype.NumIn() != 3 {
+		// methods may take the context of the call before the args
+		hasCtx := mtype.NumIn() == 4 && mtype.In(1) == typeOfContext
+		if mtype.NumIn() != 3 && !hasCtx {
 			continue
 		}
-		argType := mtype.In(1)
+		argIndex := 1
+		if hasCtx {
+			argIndex = 2
+		}
+		argType := mtype.In(argIndex)
 		if !isExportedOrBuiltinType(argType) {
 			continue
 		}
-		replyType := mtype.In(2)
+		replyType := mtype.In(argIndex + 1)
 		if replyType.Kind() != reflect.Ptr {
 			continue
 		}
@@ -254,6 +377,7 @@ func suitableMethods(typ reflect.Type) map[string]*methodType {
 			method:    method,
 			ArgType:   argType,
 			ReplyType: replyType,
+			hasCtx:    hasCtx,
 		}
 	}
 	return methods
@@ -275,6 +399,13 @@ func (server *RPCServer) register(rcvr interface{}, name string, useName bool) e
 	}
 	s.name = sname
 	s.methods = suitableMethods(s.typ)
+	if cs, ok := rcvr.(CancellableService); ok {
+		for _, mname := range cs.CancellableMethods() {
+			if mtype, exists := s.methods[mname]; exists && mtype.hasCtx {
+				mtype.cancellable = true
+			}
+		}
+	}
 	server.serviceMap[sname] = s
 
 	return nil
@@ -322,7 +453,55 @@ func (server *RPCServer) parseJsonRPCObj(jsonObjMap map[string]interface{}, obj
 	return nil
 }
 
-func (server *RPCServer) jsonRPCCall(data []byte, rpcId **int, w io.Writer) error {
+// apiKeyFromRequest returns the api key of the X-API-Key header. Keys are not read from
+// the url, which ends up in the logs of proxies and servers.
+func apiKeyFromRequest(r *http.Request) string {
+	return r.Header.Get("X-API-Key")
+}
+
+// traceContext returns the context of a request which continues the trace of the caller
+// given by the traceparent or X-Trace-Id header.
+func traceContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if traceID, parentID, ok := trace.ParseTraceparent(r.Header.Get("traceparent")); ok {
+		return trace.ContextWithRemoteParent(ctx, traceID, parentID)
+	}
+	if traceID, ok := trace.ParseTraceID(r.Header.Get("X-Trace-Id")); ok {
+		return trace.ContextWithRemoteParent(ctx, traceID, trace.SpanID{})
+	}
+	return ctx
+}
+
+type clientIPKey struct{}
+
+// requestContext returns the context of a request carrying the trace of the caller and
+// the ip of the client. The ip is the one of the connection, forwarding headers are
+// set by the client and not trusted.
+func requestContext(c *gin.Context) context.Context {
+	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		ip = ""
+	}
+	return confirmContext(context.WithValue(traceContext(c.Request), clientIPKey{}, ip), c.Request)
+}
+
+// ClientIPFromContext returns the ip of the client of the RPC call, it is empty if unknown.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// serveRequest executes the call of the request within the span and writes the response.
+func (server *RPCServer) serveRequest(ctx context.Context, span *trace.Span, data []byte, apiKey string, w io.Writer) {
+	defer span.Finish()
+	var rpcId *int
+	if err := server.jsonRPCCall(ctx, data, apiKey, &rpcId, w); err != nil {
+		span.SetError(err)
+		writeRPCError(err, rpcId, span.TraceID.String(), w)
+	}
+}
+
+func (server *RPCServer) jsonRPCCall(ctx context.Context, data []byte, apiKey string, rpcId **int, w io.Writer) error {
 	var personFromJSON interface{}
 	decoder := json.NewDecoder(bytes.NewReader(data))
 	decoder.UseNumber()
@@ -335,10 +514,22 @@ func (server *RPCServer) jsonRPCCall(data []byte, rpcId **int, w io.Writer) erro
 		return err
 	}
 	*rpcId = *&rpcObj.id
+	if span := trace.FromContext(ctx); span != nil {
+		span.SetName("rpc " + rpcObj.method)
+		span.SetAttribute("rpc.method", rpcObj.method)
+	}
 	s, t, err := server.getServiceAndMethodType(rpcObj.method)
 	if err != nil {
 		return err
 	}
+	if server.apiKeys != nil {
+		if err = server.apiKeys.authorize(apiKey, rpcObj.method); err != nil {
+			return err
+		}
+	}
+	if err = server.confirm(ctx, apiKey, rpcObj.method, rpcObj.params); err != nil {
+		return err
+	}
 
 	_, ok := rpcObj.params.(map[string]interface{})
 	if ok {
@@ -347,25 +538,92 @@ func (server *RPCServer) jsonRPCCall(data []byte, rpcId **int, w io.Writer) erro
 		}
 	}
 
-	rec, err := s.callMethod(t, rpcObj.params)
-	if err != nil {
-		return err
+	var (
+		rec     interface{}
+		proxied bool
+	)
+	if server.readProxy != nil {
+		if rec, proxied, err = server.readProxy(rpcObj.method, rpcObj.params); err != nil {
+			return err
+		}
+		if span := trace.FromContext(ctx); span != nil && proxied {
+			span.SetAttribute("rpc.proxied", true)
+		}
+	}
+	if !proxied {
+		if rec, err = server.callWithTimeout(ctx, s, t, rpcObj.method, rpcObj.params); err != nil {
+			return err
+		}
 	}
 	outMap := make(map[string]interface{})
 	outMap["jsonrpc"] = jsonrpcVersion
 	outMap["id"] = rpcObj.id
 	outMap["result"] = rec
+	if traceID := trace.TraceIDFromContext(ctx); traceID != "" {
+		outMap["trace_id"] = traceID
+	}
 	outBytes, _ := json.Marshal(outMap)
 	_, _ = w.Write(outBytes)
 	return nil
 }
 
+// methodTimeout returns the timeout of the calls of the method.
+func (server *RPCServer) methodTimeout(method string) time.Duration {
+	if timeout, exists := server.config.MethodTimeouts[method]; exists {
+		return timeout
+	}
+	return server.config.Timeout
+}
+
+// callWithTimeout calls the method within the timeout of the method. The call of a
+// cancellable method returns when its context is done, the method stops its work on the
+// done context. The other methods are called in place and run to completion, their
+// failure after the timeout is reported as the error of the context.
+func (server *RPCServer) callWithTimeout(ctx context.Context, s *service, t *methodType, method string, params interface{}) (interface{}, error) {
+	if timeout := server.methodTimeout(method); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if ctx.Done() == nil {
+		return s.callMethod(ctx, t, params)
+	}
+	if err := ContextError(ctx); err != nil {
+		return nil, err
+	}
+	if !t.cancellable {
+		result, err := s.callMethod(ctx, t, params)
+		if err != nil && ctx.Err() != nil {
+			return nil, ContextError(ctx)
+		}
+		return result, err
+	}
+	type callResult struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		result, err := s.callMethod(ctx, t, params)
+		done <- callResult{result, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() != nil {
+			return nil, ContextError(ctx)
+		}
+		return r.result, r.err
+	case <-ctx.Done():
+		return nil, ContextError(ctx)
+	}
+}
+
 func httperr(c *gin.Context, status int, err error) {
 	c.String(status, "%s", err)
 	c.Abort()
 }
 
-func writeRPCError(err error, reqId *int, w io.Writer) {
+func writeRPCError(err error, reqId *int, traceID string, w io.Writer) {
 	rpcErr, isRPCErr := err.(*RPCError)
 	e := jsonRPCRespErr{}
 	if !isRPCErr {
@@ -374,11 +632,15 @@ func writeRPCError(err error, reqId *int, w io.Writer) {
 	} else {
 		e.Code = rpcErr.Code
 		e.Message = rpcErr.Message
+		e.Data = rpcErr.Data
 	}
 	outMap := make(map[string]interface{})
 	outMap["jsonrpc"] = jsonrpcVersion
 	outMap["id"] = reqId
 	outMap["error"] = e
+	if traceID != "" {
+		outMap["trace_id"] = traceID
+	}
 	outBytes, _ := json.Marshal(outMap)
 	_, _ = w.Write(outBytes)
 }
@@ -389,10 +651,15 @@ func isWebsocketRequest(c *gin.Context) bool {
 	return connection == "Upgrade" && upgrade == "websocket"
 }
 func (server *RPCServer) handleWebsocket(c *gin.Context) error {
+	apiKey := apiKeyFromRequest(c.Request)
+	ctx := requestContext(c)
 	conn, err := server.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return err
 	}
+	notifier := newNotifier(conn)
+	defer notifier.close()
+	ctx = context.WithValue(ctx, notifierKey{}, notifier)
 	for {
 		t, msg, err := conn.ReadMessage()
 		if err != nil {
@@ -404,20 +671,57 @@ func (server *RPCServer) handleWebsocket(c *gin.Context) error {
 		//msgText := string(msg)
 
 		bs := bytes.NewBuffer(nil)
-		var rpcId *int
-		if err = server.jsonRPCCall(msg, &rpcId, bs); err != nil {
-			writeRPCError(err, nil, bs)
-		}
-		if err = conn.WriteMessage(t, bs.Bytes()); err != nil {
+		spanCtx, span := trace.Start(ctx, "rpc")
+		server.serveRequest(spanCtx, span, msg, apiKey, bs)
+		if err = notifier.write(t, bs.Bytes()); err != nil {
 			continue
 		}
+		// subscriptions made by the call notify after its response
+		notifier.activate()
 	}
 	return nil
 }
 
+// serveShared serves the handler at the path on the shared listener of the address, the
+// listener is opened by the first server of the address. It returns when the listener
+// is closed.
+func serveShared(addr, path string, handler http.Handler, logger log.Logger) error {
+	sharedListenersMu.Lock()
+	l, exists := sharedListeners[addr]
+	if !exists {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			sharedListenersMu.Unlock()
+			return err
+		}
+		l = &sharedListener{
+			mux:   http.NewServeMux(),
+			paths: make(map[string]struct{}),
+			done:  make(chan struct{}),
+		}
+		sharedListeners[addr] = l
+		logger.Infof("RPC Service listen on: %s", ln.Addr())
+		go func() {
+			l.err = http.Serve(ln, l.mux)
+			close(l.done)
+		}()
+	}
+	if _, served := l.paths[path]; served {
+		sharedListenersMu.Unlock()
+		return errRPCNamespaceServed
+	}
+	l.paths[path] = struct{}{}
+	l.mux.Handle(path, handler)
+	sharedListenersMu.Unlock()
+	logger.Infof("RPC Service namespace: %s", path)
+	<-l.done
+	return l.err
+}
+
 //Start starts rpc server.
 func (server *RPCServer) Start() error {
-	server.ginEngine.Any("/", func(c *gin.Context) {
+	path := "/" + server.config.Namespace
+	server.ginEngine.Any(path, func(c *gin.Context) {
 		//handle websocket request
 		if isWebsocketRequest(c) {
 			if err := server.handleWebsocket(c); err != nil {
@@ -446,15 +750,15 @@ func (server *RPCServer) Start() error {
 		}
 		c.Status(200)
 		c.Header("Content-Type", "application/json; charset=utf-8")
-		var rpcId *int = nil
-
-		if err = server.jsonRPCCall(body, &rpcId, c.Writer); err != nil {
-			writeRPCError(err, rpcId, c.Writer)
-			return
-		}
+		ctx, span := trace.Start(requestContext(c), "rpc")
+		c.Header("X-Trace-Id", span.TraceID.String())
+		c.Header("traceparent", span.Traceparent())
+		server.serveRequest(ctx, span, body, apiKeyFromRequest(c.Request), c.Writer)
 		c.Abort()
 	})
-
+	if server.config.Namespace != "" {
+		return serveShared(server.config.ListenAddr, path, server.ginEngine, server.logger)
+	}
 	ln, err := net.Listen("tcp", server.config.ListenAddr)
 	if err != nil {
 		return err
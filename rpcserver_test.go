@@ -0,0 +1,327 @@
+package xfsgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type EchoItem struct {
+	Name string `json:"name"`
+}
+
+type EchoArgs struct {
+	Name  string              `json:"name"`
+	Items []EchoItem          `json:"items"`
+	Attrs map[string]EchoItem `json:"attrs"`
+}
+
+type testRPCHandler struct{}
+
+func (h *testRPCHandler) Echo(args EchoArgs, resp *EchoArgs) error {
+	*resp = args
+	return nil
+}
+
+func (h *testRPCHandler) Panic(args EchoArgs, resp *EchoArgs) error {
+	panic("handler failed")
+}
+
+// Wait blocks until the call is done and returns the error of its context.
+func (h *testRPCHandler) Wait(ctx context.Context, args EchoArgs, resp *EchoArgs) error {
+	<-ctx.Done()
+	return ContextError(ctx)
+}
+
+// Sleep ignores the context of the call and echoes the args after a while.
+func (h *testRPCHandler) Sleep(ctx context.Context, args EchoArgs, resp *EchoArgs) error {
+	time.Sleep(30 * time.Millisecond)
+	*resp = args
+	return nil
+}
+
+func (h *testRPCHandler) CancellableMethods() []string {
+	return []string{"Wait", "Echo"}
+}
+
+func TestService_callMethodPanic(t *testing.T) {
+	defer func(r *CrashReporter) {
+		DefaultCrashReporter = r
+	}(DefaultCrashReporter)
+	DefaultCrashReporter = NewCrashReporter(10)
+	server := NewRPCServer(&RPCConfig{})
+	if err := server.RegisterName("Test", new(testRPCHandler)); err != nil {
+		t.Fatal(err)
+	}
+	s := server.serviceMap["Test"]
+	if _, err := s.callMethod(context.Background(), s.methods["Panic"], nil); err != internalError {
+		t.Fatalf("got err %v, want %v", err, internalError)
+	}
+	reports := DefaultCrashReporter.Reports()
+	if len(reports) != 1 || reports[0].Module != "rpc Test.Panic" || reports[0].Error != "handler failed" {
+		t.Fatalf("unexpected crash reports %v", reports)
+	}
+}
+
+func TestService_callMethodStructuredParams(t *testing.T) {
+	server := NewRPCServer(&RPCConfig{})
+	if err := server.RegisterName("Test", new(testRPCHandler)); err != nil {
+		t.Fatal(err)
+	}
+	s := server.serviceMap["Test"]
+	params := map[string]interface{}{
+		"name": "a",
+		"items": []interface{}{
+			map[string]interface{}{"name": "b"},
+		},
+		"attrs": map[string]interface{}{
+			"c": map[string]interface{}{"name": "d"},
+		},
+	}
+	got, err := s.callMethod(context.Background(), s.methods["Echo"], params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := EchoArgs{
+		Name:  "a",
+		Items: []EchoItem{{Name: "b"}},
+		Attrs: map[string]EchoItem{"c": {Name: "d"}},
+	}
+	if !reflect.DeepEqual(*got.(*EchoArgs), want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRPCServer_methodTimeout(t *testing.T) {
+	server := NewRPCServer(&RPCConfig{
+		MethodTimeouts: map[string]time.Duration{
+			"Test.Wait":  10 * time.Millisecond,
+			"Test.Sleep": 10 * time.Millisecond,
+		},
+	})
+	if err := server.RegisterName("Test", new(testRPCHandler)); err != nil {
+		t.Fatal(err)
+	}
+	s := server.serviceMap["Test"]
+	// only the listed methods taking the context are cancellable
+	if !s.methods["Wait"].cancellable || s.methods["Echo"].cancellable || s.methods["Sleep"].cancellable {
+		t.Fatalf("unexpected cancellable methods")
+	}
+	call := func(ctx context.Context, method string) error {
+		var rpcId *int
+		req := []byte(`{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":{"name":"a"}}`)
+		return server.jsonRPCCall(ctx, req, "", &rpcId, bytes.NewBuffer(nil))
+	}
+	if err := call(context.Background(), "Test.Wait"); err != ErrRequestTimedOut {
+		t.Fatalf("got err %v, want %v", err, ErrRequestTimedOut)
+	}
+	if err := call(context.Background(), "Test.Echo"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := call(ctx, "Test.Echo"); err != ErrRequestCancelled {
+		t.Fatalf("got err %v, want %v", err, ErrRequestCancelled)
+	}
+	// a method ignoring the context runs to completion past its timeout
+	start := time.Now()
+	if err := call(context.Background(), "Test.Sleep"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 30*time.Millisecond {
+		t.Fatalf("call returned before the method")
+	}
+}
+
+func TestRPCServer_apiKeys(t *testing.T) {
+	store, err := NewAPIKeyStore(newTestStateDB(t), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewRPCServer(&RPCConfig{})
+	if err = server.RegisterName("Test", new(testRPCHandler)); err != nil {
+		t.Fatal(err)
+	}
+	server.SetAPIKeyStore(store)
+	key, err := store.Create("test", map[string]uint64{"Test.Echo": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(apiKey string) error {
+		var rpcId *int
+		req := []byte(`{"jsonrpc":"2.0","id":1,"method":"Test.Echo","params":{"name":"a"}}`)
+		return server.jsonRPCCall(context.Background(), req, apiKey, &rpcId, bytes.NewBuffer(nil))
+	}
+	if err = call(""); err != errAPIKeyRequired {
+		t.Fatalf("want err %v, got %v", errAPIKeyRequired, err)
+	}
+	if err = call(key.Key); err != nil {
+		t.Fatal(err)
+	}
+	if err = call(key.Key); err != errQuotaExceeded {
+		t.Fatalf("want err %v, got %v", errQuotaExceeded, err)
+	}
+	if err = call("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.authorize(key.Key, APIKeyService+".List"); err != errAPIKeyForbidden {
+		t.Fatalf("want err %v, got %v", errAPIKeyForbidden, err)
+	}
+	if err = store.Revoke(key.Key); err != nil {
+		t.Fatal(err)
+	}
+	if err = call(key.Key); err != errInvalidAPIKey {
+		t.Fatalf("want err %v, got %v", errInvalidAPIKey, err)
+	}
+	reloaded, err := NewAPIKeyStore(store.storage, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reloaded.Get(key.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Revoked || got.Usage["Test.Echo"] != 1 {
+		t.Fatalf("got key %v", got)
+	}
+}
+
+func TestAPIKeyFromRequest(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://localhost/?apikey=query", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the key is only read from the header
+	if got := apiKeyFromRequest(r); got != "" {
+		t.Fatalf("got key %q from the url", got)
+	}
+	r.Header.Set("X-API-Key", "header")
+	if got := apiKeyFromRequest(r); got != "header" {
+		t.Fatalf("got key %q, want %q", got, "header")
+	}
+}
+
+func TestRPCServer_confirm(t *testing.T) {
+	store, err := NewAPIKeyStore(newTestStateDB(t), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewRPCServer(&RPCConfig{
+		Confirm: map[string]ConfirmPolicy{
+			"Test.Echo": {Cosign: true, Delay: 50 * time.Millisecond},
+		},
+	})
+	if err = server.RegisterName("Test", new(testRPCHandler)); err != nil {
+		t.Fatal(err)
+	}
+	server.SetAPIKeyStore(store)
+	key, err := store.Create("operator", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(cosign, confirmation, name string) error {
+		var rpcId *int
+		ctx := context.WithValue(context.Background(), cosignKeyKey{}, cosign)
+		ctx = context.WithValue(ctx, confirmIdKey{}, confirmation)
+		req := []byte(`{"jsonrpc":"2.0","id":1,"method":"Test.Echo","params":{"name":"` + name + `"}}`)
+		return server.jsonRPCCall(ctx, req, "admin", &rpcId, bytes.NewBuffer(nil))
+	}
+	if err = call("", "", "a"); err != errCosignRequired {
+		t.Fatalf("want err %v, got %v", errCosignRequired, err)
+	}
+	if err = call("admin", "", "a"); err != errInvalidCosign {
+		t.Fatalf("want err %v, got %v", errInvalidCosign, err)
+	}
+	err = call(key.Key, "", "a")
+	rpcErr, ok := err.(*RPCError)
+	if !ok || rpcErr.Message != errConfirmRequired.Error() {
+		t.Fatalf("want err %v, got %v", errConfirmRequired, err)
+	}
+	confirmation := rpcErr.Data.(*ConfirmRequiredData).Confirmation
+	if err = call(key.Key, confirmation, "a"); err != errConfirmNotDue {
+		t.Fatalf("want err %v, got %v", errConfirmNotDue, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	// the confirmation is bound to the params of the call
+	if err = call(key.Key, confirmation, "b"); err != errInvalidConfirm {
+		t.Fatalf("want err %v, got %v", errInvalidConfirm, err)
+	}
+	if err = call(key.Key, confirmation, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = call(key.Key, confirmation, "a"); err != errInvalidConfirm {
+		t.Fatalf("want err %v, got %v", errInvalidConfirm, err)
+	}
+}
+
+func TestRPCServer_confirmDelayWithoutKeys(t *testing.T) {
+	server := NewRPCServer(&RPCConfig{
+		Confirm: map[string]ConfirmPolicy{
+			"Test.Echo": {Delay: 50 * time.Millisecond},
+		},
+	})
+	if err := server.RegisterName("Test", new(testRPCHandler)); err != nil {
+		t.Fatal(err)
+	}
+	var rpcId *int
+	req := []byte(`{"jsonrpc":"2.0","id":1,"method":"Test.Echo","params":{"name":"a"}}`)
+	err := server.jsonRPCCall(context.Background(), req, "", &rpcId, bytes.NewBuffer(nil))
+	if err != errDelayUnavailable {
+		t.Fatalf("want err %v, got %v", errDelayUnavailable, err)
+	}
+}
+
+func TestRPCServer_namespaces(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	for _, name := range []string{"mainnet", "testnet"} {
+		server := NewRPCServer(&RPCConfig{ListenAddr: addr, Namespace: name})
+		if err = server.RegisterName(name, new(testRPCHandler)); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			_ = server.Start()
+		}()
+	}
+	call := func(path, method string) (map[string]interface{}, error) {
+		req := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":{"name":"a"}}`
+		resp, err := http.Post("http://"+addr+path, "application/json", strings.NewReader(req))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		return result, err
+	}
+	var result map[string]interface{}
+	for i := 0; i < 50; i++ {
+		if result, err = call("/mainnet", "mainnet.Echo"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil || result["error"] != nil {
+		t.Fatalf("got %v, err %v", result, err)
+	}
+	if result, err = call("/testnet", "mainnet.Echo"); err != nil || result["error"] == nil {
+		t.Fatalf("want method not found in other namespace, got %v, err %v", result, err)
+	}
+	if result, err = call("/testnet", "testnet.Echo"); err != nil || result["error"] != nil {
+		t.Fatalf("got %v, err %v", result, err)
+	}
+	server := NewRPCServer(&RPCConfig{ListenAddr: addr, Namespace: "testnet"})
+	if err = server.Start(); err != errRPCNamespaceServed {
+		t.Fatalf("want err %v, got %v", errRPCNamespaceServed, err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrAlreadyRunning = errors.New("another process is running with the pid file")
+
+// WritePIDFile writes the pid of the process to the file. It fails if the file holds
+// the pid of a process still running, a stale file is replaced.
+func WritePIDFile(pathname string) error {
+	if bs, err := ioutil.ReadFile(pathname); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(bs)))
+		if err == nil && pid != os.Getpid() && processExists(pid) {
+			return fmt.Errorf("%w: pid=%d", ErrAlreadyRunning, pid)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pathname, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// RemovePIDFile removes the pid file if it holds the pid of the process.
+func RemovePIDFile(pathname string) error {
+	bs, err := ioutil.ReadFile(pathname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if strings.TrimSpace(string(bs)) != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	return os.Remove(pathname)
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+// Package service runs the node as a service managed by systemd or the Windows
+// service control manager.
+package service
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const DefaultName = "xfsgo"
+
+var ErrUnsupported = errors.New("service management is not supported on this platform")
+
+// Config describes the installed service.
+type Config struct {
+	Name        string
+	Description string
+	// Executable is the path of the binary run by the service, Args are passed to it.
+	Executable string
+	Args       []string
+	// WatchdogSec is the watchdog timeout of systemd, 0 disables the watchdog.
+	WatchdogSec int
+}
+
+// Notify sends a state notification to systemd, such as "READY=1" or "STOPPING=1".
+// It reports false if the process was not started by systemd with notify support.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	conn, err := net.DialUnix(addr.Net, nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the watchdog timeout systemd expects pings within, or 0
+// if the watchdog is not enabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog pings the systemd watchdog at half of its timeout until quit is closed.
+func RunWatchdog(quit <-chan struct{}) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			_, _ = Notify("WATCHDOG=1")
+		}
+	}
+}
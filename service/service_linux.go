@@ -0,0 +1,111 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// unitDir is the directory systemd loads the units of system services from.
+var unitDir = "/etc/systemd/system"
+
+func unitPath(name string) string {
+	return filepath.Join(unitDir, name+".service")
+}
+
+// quoteArg quotes an argument of ExecStart as systemd splits the command line.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\$%;") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+func unitFile(config *Config) string {
+	args := make([]string, 0, len(config.Args)+1)
+	args = append(args, quoteArg(config.Executable))
+	for _, arg := range config.Args {
+		args = append(args, quoteArg(arg))
+	}
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", config.Description)
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=notify\n")
+	b.WriteString("NotifyAccess=main\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(args, " "))
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("KillSignal=SIGTERM\n")
+	b.WriteString("TimeoutStopSec=60\n")
+	if config.WatchdogSec > 0 {
+		fmt.Fprintf(&b, "WatchdogSec=%d\n", config.WatchdogSec)
+	}
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return b.String()
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Install writes the systemd unit of the service and enables it.
+func Install(config *Config) error {
+	pathname := unitPath(config.Name)
+	if _, err := os.Stat(pathname); err == nil {
+		return fmt.Errorf("service %s already installed: %s", config.Name, pathname)
+	}
+	if err := ioutil.WriteFile(pathname, []byte(unitFile(config)), 0644); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", config.Name)
+}
+
+// Uninstall stops and disables the service and removes its systemd unit.
+func Uninstall(name string) error {
+	pathname := unitPath(name)
+	if _, err := os.Stat(pathname); err != nil {
+		return fmt.Errorf("service %s not installed: %s", name, pathname)
+	}
+	if err := systemctl("disable", "--now", name); err != nil {
+		return err
+	}
+	if err := os.Remove(pathname); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
+
+// Run runs the service in the foreground, systemd stops it with a signal.
+func Run(name string, run func(stop <-chan struct{}) error) error {
+	return run(nil)
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"xfsgo/assert"
+)
+
+func TestUnitFile(t *testing.T) {
+	unit := unitFile(&Config{
+		Name:        "xfsgo",
+		Description: "xfsgo full node",
+		Executable:  "/usr/local/bin/xfsgo",
+		Args:        []string{"service", "run", "--datadir", "/var/lib/my node"},
+		WatchdogSec: 60,
+	})
+	for _, line := range []string{
+		"Type=notify",
+		`ExecStart=/usr/local/bin/xfsgo service run --datadir "/var/lib/my node"`,
+		"WatchdogSec=60",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(unit, line+"\n") {
+			t.Fatalf("want line %q in unit:\n%s", line, unit)
+		}
+	}
+	assert.Equal(t, quoteArg(`a"b`), `"a\"b"`)
+	assert.Equal(t, quoteArg("100%"), `"100%%"`)
+}
@@ -0,0 +1,35 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package service
+
+// Install is not supported on this platform.
+func Install(config *Config) error {
+	return ErrUnsupported
+}
+
+// Uninstall is not supported on this platform.
+func Uninstall(name string) error {
+	return ErrUnsupported
+}
+
+// Run runs the service in the foreground.
+func Run(name string, run func(stop <-chan struct{}) error) error {
+	return run(nil)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"xfsgo/assert"
+)
+
+func TestWritePIDFile(t *testing.T) {
+	pathname := filepath.Join(t.TempDir(), "run", "xfsgo.pid")
+	if err := WritePIDFile(pathname); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadFile(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, strings.TrimSpace(string(bs)), strconv.Itoa(os.Getpid()))
+	if err = RemovePIDFile(pathname); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(pathname); !os.IsNotExist(err) {
+		t.Fatal("want pid file removed")
+	}
+	// a stale pid file is replaced
+	if err = ioutil.WriteFile(pathname, []byte("999999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = WritePIDFile(pathname); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	os.Setenv("NOTIFY_SOCKET", "")
+	ok, err := Notify("READY=1")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, err, nil)
+	os.Setenv("NOTIFY_SOCKET", socket)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	if ok, err = Notify("READY=1"); !ok || err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(buf[:n]), "READY=1")
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	assert.Equal(t, WatchdogInterval(), 30*time.Second)
+	os.Setenv("WATCHDOG_PID", "1")
+	assert.Equal(t, WatchdogInterval(), time.Duration(0))
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	assert.Equal(t, WatchdogInterval(), 30*time.Second)
+	os.Setenv("WATCHDOG_USEC", "")
+	assert.Equal(t, WatchdogInterval(), time.Duration(0))
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Install registers the service with the service control manager to start automatically.
+func Install(config *Config) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = m.Disconnect()
+	}()
+	if s, err := m.OpenService(config.Name); err == nil {
+		_ = s.Close()
+		return fmt.Errorf("service %s already installed", config.Name)
+	}
+	s, err := m.CreateService(config.Name, config.Executable, mgr.Config{
+		DisplayName: config.Name,
+		Description: config.Description,
+		StartType:   mgr.StartAutomatic,
+	}, config.Args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	// restart the node when it fails, like Restart=on-failure of systemd
+	return s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	}, uint32((24 * time.Hour).Seconds()))
+}
+
+// Uninstall removes the service from the service control manager.
+func Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = m.Disconnect()
+	}()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s not installed", name)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	return s.Delete()
+}
+
+type handler struct {
+	run func(stop <-chan struct{}) error
+	err error
+}
+
+func (h *handler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	s <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run(stop)
+	}()
+	s <- svc.Status{State: svc.Running, Accepts: accepts}
+	for {
+		select {
+		case h.err = <-done:
+			s <- svc.Status{State: svc.StopPending}
+			if h.err != nil {
+				return true, 1
+			}
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				s <- svc.Status{State: svc.StopPending}
+				close(stop)
+				h.err = <-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// Run runs the service under the service control manager, or in the foreground when
+// the process was not started as a service.
+func Run(name string, run func(stop <-chan struct{}) error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return run(nil)
+	}
+	h := &handler{run: run}
+	if err = svc.Run(name, h); err != nil {
+		return err
+	}
+	return h.err
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+	"xfsgo/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ReferenceProcessor is the name of the state transition the chain itself uses,
+	// shadowing with it checks the shadow execution reproduces the chain.
+	ReferenceProcessor = "reference"
+	// maxShadowDivergences is the number of the last divergences kept by the executor
+	maxShadowDivergences = 32
+)
+
+var (
+	ErrUnknownProcessor = errors.New("unknown state processor")
+)
+
+// StateProcessor applies the transactions of the block of the header to the state and
+// returns the gas used with the receipts, like BlockChain.ApplyTransactions does.
+type StateProcessor func(stateTree *StateTree, header *BlockHeader, txs []*Transaction) (*big.Int, []*Receipt, error)
+
+var (
+	processorsMu sync.RWMutex
+	// the reference processor is the one of the chain shadowed, it is bound to the
+	// chain config by NewShadowExecutor
+	processors = map[string]StateProcessor{
+		ReferenceProcessor: nil,
+	}
+)
+
+// RegisterStateProcessor registers an experimental state transition under the name, so
+// a node can shadow the chain with it. A processor registered twice is replaced.
+func RegisterStateProcessor(name string, processor StateProcessor) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+	processors[name] = processor
+}
+
+// StateProcessors returns the names of the registered state transitions.
+func StateProcessors() []string {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+	names := make([]string, 0, len(processors))
+	for name := range processors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupStateProcessor(name string) (StateProcessor, error) {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+	processor, exists := processors[name]
+	if !exists {
+		return nil, ErrUnknownProcessor
+	}
+	return processor, nil
+}
+
+// ShadowDivergence is a block whose shadow execution didn't reproduce the header.
+type ShadowDivergence struct {
+	Time   int64       `json:"time"`
+	Height uint64      `json:"height"`
+	Block  common.Hash `json:"block"`
+	Reason string      `json:"reason"`
+	// Want is the value of the header, Got the one of the shadow execution
+	Want string `json:"want"`
+	Got  string `json:"got"`
+}
+
+// ShadowStats are the counters of the blocks executed by the shadow executor.
+type ShadowStats struct {
+	Processor   string              `json:"processor"`
+	Executed    uint64              `json:"executed"`
+	Diverged    uint64              `json:"diverged"`
+	Divergences []*ShadowDivergence `json:"divergences"`
+}
+
+// ShadowExecutor executes every new head block of the chain a second time with another
+// state transition and reports where its results diverge from the header. The shadow
+// state is never written, so the node keeps following the chain with its own state
+// transition and an experimental one can't split it from the network. Only the new
+// head is executed after a reorg.
+type ShadowExecutor struct {
+	chain     *BlockChain
+	name      string
+	processor StateProcessor
+	mu        sync.Mutex
+	stats     ShadowStats
+	quit      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewShadowExecutor creates an executor shadowing the chain with the state transition
+// registered under the name.
+func NewShadowExecutor(chain *BlockChain, name string) (*ShadowExecutor, error) {
+	processor, err := lookupStateProcessor(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == ReferenceProcessor {
+		processor = chain.ApplyTransactions
+	}
+	return &ShadowExecutor{
+		chain:     chain,
+		name:      name,
+		processor: processor,
+		stats:     ShadowStats{Processor: name},
+		quit:      make(chan struct{}),
+	}, nil
+}
+
+// Start executes the new head blocks until the executor is stopped.
+func (s *ShadowExecutor) Start() {
+	sub := s.chain.SubscribeChainHeadEvents()
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case e := <-sub.Chan():
+				s.handleBlock(e.(ChainHeadEvent).Block)
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (s *ShadowExecutor) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+	})
+}
+
+// handleBlock executes the block and records the divergence, if any.
+func (s *ShadowExecutor) handleBlock(block *Block) *ShadowDivergence {
+	divergence := s.execute(block)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Executed++
+	if divergence == nil {
+		return nil
+	}
+	s.stats.Diverged++
+	s.stats.Divergences = append(s.stats.Divergences, divergence)
+	if len(s.stats.Divergences) > maxShadowDivergences {
+		s.stats.Divergences = s.stats.Divergences[len(s.stats.Divergences)-maxShadowDivergences:]
+	}
+	hash := block.HeaderHash()
+	logrus.Errorf("Shadow execution diverged: processor=%s, height=%d, hash=%x, reason=%s, want=%s, got=%s",
+		s.name, divergence.Height, hash[len(hash)-4:], divergence.Reason, divergence.Want, divergence.Got)
+	return divergence
+}
+
+// execute applies the block to the state of its parent with the shadow state transition
+// and compares the gas used, the receipts and the state root with the header.
+func (s *ShadowExecutor) execute(block *Block) *ShadowDivergence {
+	header := block.GetHeader()
+	parent := s.chain.GetBlockHeaderByBHash(header.HashPrevBlock)
+	if parent == nil {
+		return newShadowDivergence(block, "parent", header.HashPrevBlock.Hex(), "not found")
+	}
+	return s.executeOn(parent.StateRoot, block)
+}
+
+func (s *ShadowExecutor) executeOn(root common.Hash, block *Block) (divergence *ShadowDivergence) {
+	header := block.GetHeader()
+	// an experimental state transition must not take the node down
+	defer func() {
+		if r := recover(); r != nil {
+			divergence = newShadowDivergence(block, "panic", "", r)
+		}
+	}()
+	stateTree, err := NewStateTreeN(readOnlyStorage{s.chain.stateDB}, root.Bytes())
+	if err != nil {
+		return newShadowDivergence(block, "state", root.Hex(), err)
+	}
+	gas, receipts, err := s.processor(stateTree, header, block.Transactions)
+	if err != nil {
+		return newShadowDivergence(block, "apply", "", err)
+	}
+	if gas.Cmp(header.GasUsed) != 0 {
+		return newShadowDivergence(block, "gas used", header.GasUsed, gas)
+	}
+	if got := CalcReceiptRootHash(receipts); got != header.ReceiptsRoot {
+		return newShadowDivergence(block, "receipts root", header.ReceiptsRoot.Hex(), got.Hex())
+	}
+	s.chain.AccumulateRewards(stateTree, header)
+	stateTree.UpdateAll()
+	if got := common.Bytes2Hash(stateTree.Root()); got != header.StateRoot {
+		return newShadowDivergence(block, "state root", header.StateRoot.Hex(), got.Hex())
+	}
+	return nil
+}
+
+func newShadowDivergence(block *Block, reason string, want, got interface{}) *ShadowDivergence {
+	return &ShadowDivergence{
+		Time:   time.Now().Unix(),
+		Height: block.Height(),
+		Block:  block.HeaderHash(),
+		Reason: reason,
+		Want:   fmt.Sprint(want),
+		Got:    fmt.Sprint(got),
+	}
+}
+
+// Stats returns the counters of the executed blocks and the last divergences.
+func (s *ShadowExecutor) Stats() *ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Divergences = append(make([]*ShadowDivergence, 0, len(s.stats.Divergences)), s.stats.Divergences...)
+	return &stats
+}
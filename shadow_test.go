@@ -0,0 +1,53 @@
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+func TestShadowExecutor_execute(t *testing.T) {
+	st, block := newTestWitnessBlock(t)
+	root := common.Bytes2Hash(st.Root())
+	RegisterStateProcessor("test-gas", func(stateTree *StateTree, header *BlockHeader, txs []*Transaction) (*big.Int, []*Receipt, error) {
+		gas, receipts, err := (&BlockChain{config: MainNetChainConfig}).ApplyTransactions(stateTree, header, txs)
+		if err != nil {
+			return nil, nil, err
+		}
+		return new(big.Int).Add(gas, common.Big1), receipts, nil
+	})
+	RegisterStateProcessor("test-panic", func(*StateTree, *BlockHeader, []*Transaction) (*big.Int, []*Receipt, error) {
+		panic("broken vm")
+	})
+	RegisterStateProcessor("test-error", func(*StateTree, *BlockHeader, []*Transaction) (*big.Int, []*Receipt, error) {
+		return nil, nil, errors.New("broken vm")
+	})
+	if _, err := NewShadowExecutor(nil, "unknown"); err != ErrUnknownProcessor {
+		t.Fatalf("got err %v, want %v", err, ErrUnknownProcessor)
+	}
+	tests := []struct {
+		processor string
+		reason    string
+	}{
+		{ReferenceProcessor, ""},
+		{"test-gas", "gas used"},
+		{"test-error", "apply"},
+		{"test-panic", "panic"},
+	}
+	for _, tt := range tests {
+		s, err := NewShadowExecutor(&BlockChain{stateDB: st.treeDB, config: MainNetChainConfig}, tt.processor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		divergence := s.executeOn(root, block)
+		if tt.reason == "" {
+			assert.Equal(t, divergence, (*ShadowDivergence)(nil))
+			continue
+		}
+		if divergence == nil || divergence.Reason != tt.reason {
+			t.Fatalf("%s: want divergence %q, got %+v", tt.processor, tt.reason, divergence)
+		}
+	}
+}
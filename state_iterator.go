@@ -0,0 +1,105 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"xfsgo/avlmerkle"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/common/rawencode"
+)
+
+// AccountIterator streams the accounts of a state in key order, the order of the hashes
+// of their addresses, loading the merkle tree on demand instead of the whole state. It
+// visits the accounts as they were at the last UpdateAll before its creation.
+type AccountIterator struct {
+	st  *StateTree
+	it  *avlmerkle.Iterator
+	obj *StateObj
+	err error
+}
+
+// NewAccountIterator returns an iterator over the accounts starting from the account
+// of startAddr, or from the first account if startAddr is nil. The account of startAddr
+// doesn't need to exist, the iteration starts from the next key then.
+func (st *StateTree) NewAccountIterator(startAddr *common.Address) *AccountIterator {
+	var start []byte
+	if startAddr != nil {
+		start = ahash.SHA256(startAddr[:])
+	}
+	return st.NewAccountIteratorAt(start)
+}
+
+// NewAccountIteratorAt returns an iterator over the accounts whose key is not lower
+// than start, it resumes an iteration from the key of a dump page.
+func (st *StateTree) NewAccountIteratorAt(start []byte) *AccountIterator {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return &AccountIterator{
+		st: st,
+		it: st.merkleTree.NewIterator(start),
+	}
+}
+
+// Next moves the iterator to the next account, it returns false when the iteration is
+// over or failed, Error tells which.
+func (it *AccountIterator) Next() bool {
+	it.obj = nil
+	if it.err != nil {
+		return false
+	}
+	it.st.mu.Lock()
+	defer it.st.mu.Unlock()
+	if !it.it.Next() {
+		it.err = it.it.Error()
+		return false
+	}
+	val := it.it.Value()
+	obj, err := it.st.loadStateObj(val)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	// the storage tree of an account updated but not committed is only in the cache, the
+	// cached object is used while it is the visited record and copied as the accessors
+	// of the tree change it
+	if cached, exists := it.st.objs[obj.address]; exists && !cached.dirty && len(cached.dirtyStorage) == 0 {
+		if enc, err := rawencode.Encode(cached); err == nil && bytes.Equal(enc, val) {
+			obj = cached.deepCopy(it.st)
+		}
+	}
+	obj.journal = nil
+	it.obj = obj
+	return true
+}
+
+// Key returns the key of the current account, the hash of its address.
+func (it *AccountIterator) Key() []byte {
+	return it.it.Key()
+}
+
+// Account returns the current account, it belongs to the iterator and the changes made
+// to it are not journaled by the state.
+func (it *AccountIterator) Account() *StateObj {
+	return it.obj
+}
+
+// Error returns the error which stopped the iteration.
+func (it *AccountIterator) Error() error {
+	return it.err
+}
@@ -0,0 +1,80 @@
+package xfsgo
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+func TestStateTree_NewAccountIterator(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	addrs := make([]common.Address, 20)
+	for i := range addrs {
+		addrs[i] = common.Bytes2Address([]byte{byte(i + 1)})
+		st.AddBalance(addrs[i], big.NewInt(int64(i+1)))
+	}
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenStateReader(db, common.Bytes2Hash(st.Root()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([][]byte, 0, len(addrs))
+	it := reader.NewAccountIterator(nil)
+	for it.Next() {
+		obj := it.Account()
+		addr := obj.GetAddress()
+		assert.BytesEqual(t, it.Key(), ahash.SHA256(addr[:]))
+		assert.BigIntEqual(t, obj.GetBalance(), big.NewInt(int64(addr[len(addr)-1])))
+		if len(keys) > 0 && bytes.Compare(keys[len(keys)-1], it.Key()) >= 0 {
+			t.Fatalf("accounts not in key order")
+		}
+		keys = append(keys, append([]byte{}, it.Key()...))
+	}
+	if it.Error() != nil {
+		t.Fatal(it.Error())
+	}
+	assert.Equal(t, len(keys), len(addrs))
+	if it.Next() || it.Account() != nil {
+		t.Fatal("want the iteration over")
+	}
+
+	// the iteration from an address starts from its key
+	it = reader.NewAccountIterator(&addrs[7])
+	count := 0
+	for it.Next() {
+		if count == 0 {
+			assert.Equal(t, it.Account().GetAddress(), addrs[7])
+		}
+		count++
+	}
+	start := ahash.SHA256(addrs[7][:])
+	for _, key := range keys {
+		if bytes.Compare(key, start) >= 0 {
+			count--
+		}
+	}
+	assert.Equal(t, count, 0)
+
+	// the accounts changed after the creation of the iterator are visited as they were
+	it = st.NewAccountIterator(nil)
+	for _, addr := range addrs {
+		st.AddBalance(addr, big.NewInt(100))
+	}
+	st.UpdateAll()
+	for it.Next() {
+		obj := it.Account()
+		addr := obj.GetAddress()
+		assert.BigIntEqual(t, obj.GetBalance(), big.NewInt(int64(addr[len(addr)-1])))
+		// the account belongs to the iterator
+		obj.SetBalance(big.NewInt(0))
+	}
+	assert.Equal(t, len(st.journal.dirties), 0)
+	assert.BigIntEqual(t, st.GetBalance(addrs[0]), big.NewInt(101))
+}
@@ -0,0 +1,313 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"xfsgo/avlmerkle"
+	"xfsgo/common"
+	"xfsgo/storage/badger"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultStateRetention is the number of the last blocks whose state is kept by default.
+	DefaultStateRetention = 128
+	// defaultPruneInterval is the number of blocks between two runs of the state pruner.
+	defaultPruneInterval = 1024
+)
+
+var (
+	ErrInvalidStateRetention = errors.New("invalid state retention")
+	ErrNoChainHead           = errors.New("chain has no head")
+)
+
+// PruneStats are the counters of a run of the state pruning.
+type PruneStats struct {
+	Height       uint64        `json:"height"`
+	Roots        int           `json:"roots"`
+	KeptNodes    int           `json:"kept_nodes"`
+	DeletedNodes int           `json:"deleted_nodes"`
+	DeletedCodes int           `json:"deleted_codes"`
+	Elapsed      time.Duration `json:"elapsed"`
+}
+
+// stateMarker marks the tree nodes and the contract code used by states.
+type stateMarker struct {
+	db    badger.IStorage
+	nodes map[[32]byte]struct{}
+	codes map[common.Hash]struct{}
+}
+
+func newStateMarker(db badger.IStorage) *stateMarker {
+	return &stateMarker{
+		db:    db,
+		nodes: make(map[[32]byte]struct{}),
+		codes: make(map[common.Hash]struct{}),
+	}
+}
+
+// markTree marks the nodes of the tree with the root and calls fn with the value of
+// every leaf not marked before. The subtrees marked by a previous tree are skipped, as
+// the trees of consecutive states share most of their nodes.
+func (m *stateMarker) markTree(root common.Hash, fn func(value []byte) error) error {
+	if root == common.HashZ {
+		return nil
+	}
+	tree, err := avlmerkle.NewTreeN(m.db, root[:])
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	err = tree.WalkNodes(func(id, value []byte) bool {
+		var key [32]byte
+		copy(key[:], id)
+		if _, marked := m.nodes[key]; marked {
+			return false
+		}
+		m.nodes[key] = struct{}{}
+		if value != nil && fn != nil {
+			fnErr = fn(value)
+		}
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// markState marks the state with the root, with the storage and the code of its accounts.
+func (m *stateMarker) markState(root common.Hash) error {
+	return m.markTree(root, func(value []byte) error {
+		obj, err := DecodeAccount(value)
+		if err != nil {
+			return err
+		}
+		if obj.codeHash != common.HashZ {
+			m.codes[obj.codeHash] = struct{}{}
+		}
+		return m.markStorage(obj)
+	})
+}
+
+// markStorage marks the storage of the account and the storage it evicted for the
+// rent, which is restored from the root held by the rent stub.
+func (m *stateMarker) markStorage(obj *StateObj) error {
+	if obj.stateRoot == common.HashZ {
+		return nil
+	}
+	if err := m.markTree(obj.stateRoot, nil); err != nil {
+		return err
+	}
+	obj.db = m.db
+	if stub := obj.GetCommittedState(rentStubKey); len(stub) == rentStubLen {
+		return m.markTree(common.Bytes2Hash(stub[:32]), nil)
+	}
+	return nil
+}
+
+func (m *stateMarker) keepNode(id []byte) bool {
+	var key [32]byte
+	copy(key[:], id)
+	_, marked := m.nodes[key]
+	return marked
+}
+
+// pruneCode deletes the contract code which none of the marked states uses.
+func (m *stateMarker) pruneCode() (int, error) {
+	keys := make([][]byte, 0)
+	err := m.db.PrefixForeachData(codePrefix, func(k []byte, _ []byte) error {
+		if _, marked := m.codes[common.Bytes2Hash(k[len(codePrefix):])]; !marked {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range keys {
+		if err = m.db.DelData(key); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
+
+// HasState reports whether the root node of the state with the root is stored in the db.
+func HasState(db badger.IStorage, root common.Hash) bool {
+	return root == common.HashZ || avlmerkle.HasNode(db, root[:])
+}
+
+// PruneState deletes the tree nodes and the contract code of the state db which none
+// of the states with the roots uses. The nodes written while the db is pruned may be
+// deleted, so no state must be committed to the db meanwhile.
+func PruneState(db badger.IStorage, roots []common.Hash) (*PruneStats, error) {
+	start := time.Now()
+	marker := newStateMarker(db)
+	for _, root := range roots {
+		if err := marker.markState(root); err != nil {
+			return nil, err
+		}
+	}
+	stats := &PruneStats{
+		Roots:     len(roots),
+		KeptNodes: len(marker.nodes),
+	}
+	var err error
+	if stats.DeletedNodes, err = avlmerkle.PruneNodes(db, marker.keepNode); err != nil {
+		return nil, err
+	}
+	if stats.DeletedCodes, err = marker.pruneCode(); err != nil {
+		return nil, err
+	}
+	stats.Elapsed = time.Since(start)
+	return stats, nil
+}
+
+// PruneStateDB prunes the state db of a chain which is not running, keeping the states
+// of the main and the side chain blocks among the last retention blocks.
+func PruneStateDB(stateDB, chainDB badger.IStorage, retention uint64) (*PruneStats, error) {
+	return pruneStateDB(stateDB, newChainDBN(chainDB, false), retention)
+}
+
+func pruneStateDB(stateDB badger.IStorage, chainDB *chainDB, retention uint64) (*PruneStats, error) {
+	if retention == 0 {
+		return nil, ErrInvalidStateRetention
+	}
+	head := chainDB.GetOptimumHeightBHeader()
+	if head == nil {
+		return nil, ErrNoChainHead
+	}
+	low := uint64(0)
+	if head.Height >= retention {
+		low = head.Height - retention + 1
+	}
+	roots := []common.Hash{head.StateRoot}
+	seen := map[common.Hash]struct{}{head.StateRoot: {}}
+	for height := low; height <= head.Height; height++ {
+		headers, err := chainDB.GetBlockHeadersByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		for _, header := range headers {
+			if _, exists := seen[header.StateRoot]; exists {
+				continue
+			}
+			seen[header.StateRoot] = struct{}{}
+			// the state of a side chain block may be missing when it was never executed
+			if HasState(stateDB, header.StateRoot) {
+				roots = append(roots, header.StateRoot)
+			}
+		}
+	}
+	stats, err := PruneState(stateDB, roots)
+	if err != nil {
+		return nil, err
+	}
+	stats.Height = head.Height
+	return stats, nil
+}
+
+// PruneState deletes the states of the blocks older than the last retention blocks,
+// the chain can't be reorganized deeper than retention blocks afterwards. No block is
+// written while the state is pruned.
+func (bc *BlockChain) PruneState(retention uint64) (*PruneStats, error) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+	return pruneStateDB(bc.stateDB, bc.chainDB, retention)
+}
+
+// HasState reports whether the state with the root is available, the states of the
+// blocks older than the retention of the state pruning are not.
+func (bc *BlockChain) HasState(root common.Hash) bool {
+	return HasState(bc.stateDB, root)
+}
+
+// StatePruneConfig enables the pruning of the states of the old blocks.
+type StatePruneConfig struct {
+	// Retention is the number of the last blocks whose state is kept, DefaultStateRetention
+	// is used if it is zero
+	Retention uint64
+	// Interval is the number of blocks between two runs of the pruner,
+	// defaultPruneInterval is used if it is zero
+	Interval uint64
+}
+
+// StatePruner prunes the state of the chain in the background every Interval blocks.
+type StatePruner struct {
+	chain    *BlockChain
+	config   StatePruneConfig
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewStatePruner creates a pruner of the state of the chain.
+func NewStatePruner(chain *BlockChain, config StatePruneConfig) *StatePruner {
+	if config.Retention == 0 {
+		config.Retention = DefaultStateRetention
+	}
+	if config.Interval == 0 {
+		config.Interval = defaultPruneInterval
+	}
+	return &StatePruner{
+		chain:  chain,
+		config: config,
+		quit:   make(chan struct{}),
+	}
+}
+
+// Start prunes the state every Interval blocks until the pruner is stopped.
+func (p *StatePruner) Start() {
+	sub := p.chain.SubscribeChainHeadEvents()
+	go func() {
+		defer sub.Unsubscribe()
+		next := uint64(0)
+		for {
+			select {
+			case e := <-sub.Chan():
+				height := e.(ChainHeadEvent).Block.Height()
+				if height < next {
+					continue
+				}
+				next = height + p.config.Interval
+				p.prune()
+			case <-p.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (p *StatePruner) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+	})
+}
+
+func (p *StatePruner) prune() {
+	stats, err := p.chain.PruneState(p.config.Retention)
+	if err != nil {
+		logrus.Warnf("Failed to prune state: %s", err)
+		return
+	}
+	logrus.Infof("Pruned state: height=%d, roots=%d, kept=%d, nodes=%d, codes=%d, elapsed=%s",
+		stats.Height, stats.Roots, stats.KeptNodes, stats.DeletedNodes, stats.DeletedCodes, stats.Elapsed)
+}
@@ -0,0 +1,74 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+func TestPruneState(t *testing.T) {
+	db := newTestStateDB(t)
+	user, contract, removed, evicted := common.Address{0x01}, common.Address{0x02}, common.Address{0x03}, common.Address{0x04}
+	key := ahash.SHA256Array([]byte("key"))
+	commit := func(st *StateTree) common.Hash {
+		st.UpdateAll()
+		if err := st.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return common.Bytes2Hash(st.Root())
+	}
+	st := NewStateTree(db, nil)
+	st.AddBalance(user, big.NewInt(100))
+	st.SetCode(contract, []byte("contract code"))
+	st.SetState(contract, key, []byte{0x01})
+	st.SetCode(removed, []byte("removed code"))
+	st.SetCode(evicted, []byte("evicted code"))
+	st.SetState(evicted, key, []byte{0x02})
+	old := commit(st)
+
+	st.AddBalance(user, big.NewInt(100))
+	st.SetState(contract, key, []byte{0x03})
+	st.Suicide(removed)
+	st.UpdateAll()
+	obj := st.GetStateObj(evicted)
+	evictedRoot := obj.GetStateRoot()
+	if err := obj.evictStorage(1); err != nil {
+		t.Fatal(err)
+	}
+	root := commit(st)
+
+	stats, err := PruneState(db, []common.Hash{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, stats.Roots, 1)
+	assert.Equal(t, stats.DeletedCodes, 1)
+	if stats.DeletedNodes == 0 {
+		t.Fatal("want nodes of the old state deleted")
+	}
+	if HasState(db, old) {
+		t.Fatal("want old state pruned")
+	}
+	if !HasState(db, evictedRoot) {
+		t.Fatal("want evicted storage kept")
+	}
+	st, err = NewStateTreeN(db, root[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, st.GetBalance(user), big.NewInt(200))
+	assert.BytesEqual(t, st.GetCode(contract), []byte("contract code"))
+	assert.BytesEqual(t, st.GetStateValue(contract, key), []byte{0x03})
+	assert.BytesEqual(t, st.GetCode(evicted), []byte("evicted code"))
+	if st.Exist(removed) {
+		t.Fatal("want removed account missing")
+	}
+	// pruning again keeps the same state
+	if stats, err = PruneState(db, []common.Hash{root}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, stats.DeletedNodes, 0)
+	assert.Equal(t, stats.DeletedCodes, 0)
+}
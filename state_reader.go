@@ -0,0 +1,151 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"xfsgo/common"
+	"xfsgo/storage/badger"
+)
+
+var ErrStateReadOnly = errors.New("state is read only")
+
+// StateReader is the read only view of the state at a root, analysis tools open it on
+// the state db of a node to inspect the accounts without copying the state internals.
+type StateReader interface {
+	Root() []byte
+	Exist(addr common.Address) bool
+	GetStateObj(addr common.Address) *StateObj
+	GetBalance(addr common.Address) *big.Int
+	GetNonce(addr common.Address) uint64
+	GetExtra(addr common.Address) []byte
+	GetCode(addr common.Address) []byte
+	GetCodeHash(addr common.Address) common.Hash
+	GetCodeSize(addr common.Address) int
+	GetStateValue(addr common.Address, key [32]byte) []byte
+	GetProof(addr common.Address) ([][]byte, error)
+	ForEachAccount(fn func(obj *StateObj) bool) error
+	IterateAccounts(start []byte, fn func(key []byte, obj *StateObj) bool) error
+	NewAccountIterator(startAddr *common.Address) *AccountIterator
+	NewAccountIteratorAt(start []byte) *AccountIterator
+	Dump(conf *DumpConfig) (*Dump, error)
+	ForEachStorage(addr common.Address, fn func(key []byte, value []byte) bool)
+}
+
+// OpenStateReader opens the state at the root read only, it fails if the root is not
+// in the db. The state is never written to the db, Commit of the returned state fails.
+func OpenStateReader(db badger.IStorage, root common.Hash) (StateReader, error) {
+	return NewStateTreeN(readOnlyStorage{db}, root.Bytes())
+}
+
+// DumpConfig selects the page of the accounts a dump returns. The page starts from the
+// account key Start, it holds up to Limit accounts, all of them if Limit is not positive.
+type DumpConfig struct {
+	Start   []byte
+	Limit   int
+	Storage bool
+}
+
+// DumpStorage is a storage slot of a dumped account, the key is the hashed storage key.
+type DumpStorage struct {
+	Key   []byte
+	Value []byte
+}
+
+// DumpAccount is an account of a dump, the key is the hash of the address of the
+// account which orders the accounts in the merkle tree.
+type DumpAccount struct {
+	Key       []byte
+	Address   common.Address
+	Balance   *big.Int
+	Nonce     uint64
+	CodeHash  common.Hash
+	StateRoot common.Hash
+	Storage   []*DumpStorage
+}
+
+// Dump is a page of the accounts of a state in key order. Next is the key to start the
+// next page from, it is nil on the last page.
+type Dump struct {
+	Root     common.Hash
+	Accounts []*DumpAccount
+	Next     []byte
+}
+
+// Dump walks the merkle tree and returns the page of the accounts selected by conf, with
+// their storage if conf.Storage is set. Accounts changed since the last UpdateAll are
+// dumped as they were.
+func (st *StateTree) Dump(conf *DumpConfig) (*Dump, error) {
+	if conf == nil {
+		conf = &DumpConfig{}
+	}
+	dump := &Dump{
+		Root:     common.Bytes2Hash(st.Root()),
+		Accounts: make([]*DumpAccount, 0),
+	}
+	it := st.NewAccountIteratorAt(conf.Start)
+	for it.Next() {
+		key, obj := it.Key(), it.Account()
+		if conf.Limit > 0 && len(dump.Accounts) == conf.Limit {
+			dump.Next = append([]byte{}, key...)
+			break
+		}
+		balance := new(big.Int)
+		if obj.GetBalance() != nil {
+			balance.Set(obj.GetBalance())
+		}
+		account := &DumpAccount{
+			Key:       append([]byte{}, key...),
+			Address:   obj.GetAddress(),
+			Balance:   balance,
+			Nonce:     obj.GetNonce(),
+			CodeHash:  obj.GetCodeHash(),
+			StateRoot: obj.GetStateRoot(),
+		}
+		if conf.Storage {
+			obj.IterateStorage(nil, func(key []byte, value []byte) bool {
+				account.Storage = append(account.Storage, &DumpStorage{
+					Key:   append([]byte{}, key...),
+					Value: append([]byte{}, value...),
+				})
+				return true
+			})
+		}
+		dump.Accounts = append(dump.Accounts, account)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return dump, nil
+}
+
+// readOnlyStorage refuses the writes to the state db, a state opened on it can't leak
+// into the state of the chain.
+type readOnlyStorage struct {
+	badger.IStorage
+}
+
+func (readOnlyStorage) Set(string, []byte) error { return ErrStateReadOnly }
+
+func (readOnlyStorage) SetData([]byte, []byte) error { return ErrStateReadOnly }
+
+func (readOnlyStorage) CommitWriteBatch(*badger.StorageWriteBatch) error { return ErrStateReadOnly }
+
+func (readOnlyStorage) Del(string) error { return ErrStateReadOnly }
+
+func (readOnlyStorage) DelData([]byte) error { return ErrStateReadOnly }
@@ -19,14 +19,61 @@ package xfsgo
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"math/big"
+	"sort"
+	"sync"
 	"xfsgo/avlmerkle"
 	"xfsgo/common"
 	"xfsgo/common/ahash"
 	"xfsgo/common/rawencode"
+	"xfsgo/core"
 	"xfsgo/storage/badger"
 )
 
+var (
+	ErrExtraTooLarge       = errors.New("account extra data too large")
+	ErrNonCanonicalAccount = errors.New("non-canonical account encoding")
+)
+
+// accountFields are the keys of the account map codec, code is the inline code of
+// the accounts written before the code store.
+var accountFields = map[string]struct{}{
+	"address":    {},
+	"balance":    {},
+	"nonce":      {},
+	"extra":      {},
+	"code":       {},
+	"code_hash":  {},
+	"state_root": {},
+}
+
+// nilBalanceText is the encoding of the balance of an account created without one.
+const nilBalanceText = "<nil>"
+
+// codePrefix is the key prefix of contract code, which is stored once per code hash.
+var codePrefix = []byte("code:")
+
+func codeKey(hash common.Hash) []byte {
+	return append(append([]byte{}, codePrefix...), hash[:]...)
+}
+
+// preimagePrefix is the key prefix of the preimages of the hashes computed by the vm.
+var preimagePrefix = []byte("preimage:")
+
+func preimageKey(hash common.Hash) []byte {
+	return append(append([]byte{}, preimagePrefix...), hash[:]...)
+}
+
+// ReadPreimage returns the preimage of the hash recorded by a committed state, or nil.
+func ReadPreimage(db badger.IStorage, hash common.Hash) []byte {
+	preimage, err := db.GetData(preimageKey(hash))
+	if err != nil || len(preimage) == 0 {
+		return nil
+	}
+	return preimage
+}
+
 //StateObj is an importment type which represents an xfs account that is being modified.
 // The flow of usage is as follows:
 // First, you need to obtain a StateObj object.
@@ -38,50 +85,128 @@ type StateObj struct {
 	balance      *big.Int
 	nonce        uint64
 	extra        []byte
-	code         []byte
+	code         []byte // lazily loaded from the code store
+	codeHash     common.Hash
+	dirtyCode    bool
 	stateRoot    common.Hash
 	cacheStorage map[[32]byte][]byte
-	db           badger.IStorage
+	// dirtyStorage holds the storage keys written since the last Update
+	dirtyStorage map[[32]byte]struct{}
+	// storageTree is the storage tree of stateRoot, it is loaded once and kept with the
+	// object, storageUpdated reports whether it holds nodes not yet committed
+	storageTree    *avlmerkle.Tree
+	storageUpdated bool
+	// inlineCode encodes the code in the account record instead of its hash, as the
+	// records written before the ForkCodeStore fork do
+	inlineCode bool
+	// dirty reports whether the account record must be written by the next Update
+	dirty bool
+	// suicided accounts are removed from the merkle tree by the next Update
+	suicided bool
+	db       badger.IStorage
+	journal  *stateJournal
 }
 
-func loadBytesByMapKey(m map[string]string, key string) (data []byte, rt bool) {
-	var str string
-	var err error
-	if str, rt = m[key]; rt {
-		if data, err = hex.DecodeString(str); err != nil {
-			rt = false
+// parseCanonicalUint parses a decimal number without sign and leading zeros.
+func parseCanonicalUint(s string) (*big.Int, bool) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return nil, false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return nil, false
 		}
 	}
-	return
+	return new(big.Int).SetString(s, 10)
 }
+
+// decodeCanonicalHex decodes lower case hex, it fails unless the data is encoded
+// back into the same string.
+func decodeCanonicalHex(s string) ([]byte, bool) {
+	bs, err := hex.DecodeString(s)
+	if err != nil || hex.EncodeToString(bs) != s {
+		return nil, false
+	}
+	return bs, true
+}
+
+// decodeCanonicalHash decodes the hex of a hash, the zero hash is never encoded.
+func decodeCanonicalHash(s string) (common.Hash, bool) {
+	bs, ok := decodeCanonicalHex(s)
+	if !ok || len(bs) != len(common.Hash{}) || bytes.Equal(bs, common.HashZ[:]) {
+		return common.Hash{}, false
+	}
+	return common.Bytes2Hash(bs), true
+}
+
+// Decode decodes an account encoded by Encode. Any other encoding of the account, with
+// unknown keys, unsorted keys or non-minimal values, is rejected so that every account
+// has a single encoding in the state tree.
 func (so *StateObj) Decode(data []byte) error {
-	r := common.StringDecodeMap(string(data))
-	if r == nil {
-		return nil
+	r, err := common.StringDecodeMapStrict(string(data))
+	if err != nil {
+		return err
+	}
+	for key := range r {
+		if _, known := accountFields[key]; !known {
+			return ErrNonCanonicalAccount
+		}
 	}
 	if address, ok := r["address"]; ok {
 		so.address = common.StrB58ToAddress(address)
+		if so.address.String() != address {
+			return ErrNonCanonicalAccount
+		}
+	}
+	// the balance and the nonce are always encoded
+	balance, ok := r["balance"]
+	if !ok {
+		return ErrNonCanonicalAccount
 	}
-	if balance, ok := r["balance"]; ok {
-		if num, ok := new(big.Int).
-			SetString(balance, 10); ok {
-			so.balance = num
+	if balance != nilBalanceText {
+		num, ok := parseCanonicalUint(balance)
+		if !ok {
+			return ErrNonCanonicalAccount
 		}
+		so.balance = num
 	}
-	if nonce, ok := r["nonce"]; ok {
-		if num, ok := new(big.Int).
-			SetString(nonce, 10); ok {
-			so.nonce = num.Uint64()
+	nonce, ok := r["nonce"]
+	if !ok {
+		return ErrNonCanonicalAccount
+	}
+	num, ok := parseCanonicalUint(nonce)
+	if !ok || !num.IsUint64() {
+		return ErrNonCanonicalAccount
+	}
+	so.nonce = num.Uint64()
+	if extra, ok := r["extra"]; ok {
+		if so.extra, ok = decodeCanonicalHex(extra); !ok {
+			return ErrNonCanonicalAccount
 		}
 	}
-	if bs, ok := loadBytesByMapKey(r, "extra"); ok {
-		so.extra = bs
+	if codeHash, ok := r["code_hash"]; ok {
+		if so.codeHash, ok = decodeCanonicalHash(codeHash); !ok {
+			return ErrNonCanonicalAccount
+		}
 	}
-	if bs, ok := loadBytesByMapKey(r, "code"); ok {
+	// accounts written before the code store keep their code inline, the code is added
+	// to the code store the next time the account is committed
+	if code, ok := r["code"]; ok {
+		bs, ok := decodeCanonicalHex(code)
+		if !ok {
+			return ErrNonCanonicalAccount
+		}
 		so.code = bs
+		so.inlineCode = true
+		if len(bs) > 0 {
+			so.codeHash = common.Bytes2Hash(ahash.Keccak256(bs))
+			so.dirtyCode = true
+		}
 	}
-	if bs, ok := loadBytesByMapKey(r, "state_root"); ok {
-		so.stateRoot = common.Bytes2Hash(bs)
+	if stateRoot, ok := r["state_root"]; ok {
+		if so.stateRoot, ok = decodeCanonicalHash(stateRoot); !ok {
+			return ErrNonCanonicalAccount
+		}
 	}
 	return nil
 }
@@ -93,8 +218,12 @@ func (so *StateObj) Encode() ([]byte, error) {
 		"nonce":   new(big.Int).SetUint64(so.nonce).Text(10),
 		"extra":   hex.EncodeToString(so.extra),
 	}
-	if so.code != nil {
-		objmap["code"] = hex.EncodeToString(so.code)
+	if so.inlineCode {
+		if code := so.GetCode(); code != nil {
+			objmap["code"] = hex.EncodeToString(code)
+		}
+	} else if !bytes.Equal(so.codeHash[:], common.HashZ[:]) {
+		objmap["code_hash"] = hex.EncodeToString(so.codeHash[:])
 	}
 	if !bytes.Equal(so.stateRoot[:], common.HashZ[:]) {
 		objmap["state_root"] = hex.EncodeToString(so.stateRoot[:])
@@ -119,43 +248,81 @@ func NewStateObj(address common.Address, tree *avlmerkle.Tree, db badger.IStorag
 		merkleTree:   tree,
 		db:           db,
 		cacheStorage: make(map[[32]byte][]byte),
+		dirtyStorage: make(map[[32]byte]struct{}),
+		dirty:        true,
 	}
 	return obj
 }
 
+// deepCopy returns a copy of the object belonging to the state.
+func (so *StateObj) deepCopy(st *StateTree) *StateObj {
+	cpy := *so
+	cpy.merkleTree = st.merkleTree
+	cpy.journal = st.journal
+	if so.balance != nil {
+		cpy.balance = new(big.Int).Set(so.balance)
+	}
+	cpy.cacheStorage = make(map[[32]byte][]byte, len(so.cacheStorage))
+	for k, v := range so.cacheStorage {
+		cpy.cacheStorage[k] = v
+	}
+	cpy.dirtyStorage = make(map[[32]byte]struct{}, len(so.dirtyStorage))
+	for k := range so.dirtyStorage {
+		cpy.dirtyStorage[k] = struct{}{}
+	}
+	if so.storageTree != nil {
+		cpy.storageTree = so.storageTree.Copy()
+	}
+	return &cpy
+}
+
 // AddBalance adds amount to StateObj's balance.
 // It is used to add funds to the destination account of a transfer.
-func (so *StateObj) AddBalance(val *big.Int) {
-	if val == nil || val.Sign() <= 0 {
-		return
+// The balance is unchanged if an error is returned.
+func (so *StateObj) AddBalance(val *big.Int) error {
+	if val == nil || val.Sign() == 0 {
+		return nil
 	}
-	oldBalance := so.balance
-	if oldBalance == nil {
-		oldBalance = zeroBigN
+	newBalance, err := addBalance(so.balance, val)
+	if err != nil {
+		return err
 	}
-	newBalance := new(big.Int).Add(oldBalance, val)
 	so.SetBalance(newBalance)
+	return nil
 }
 
 // SubBalance removes amount from StateObj's balance.
 // It is used to remove funds from the origin account of a transfer.
-func (so *StateObj) SubBalance(val *big.Int) {
-	if val == nil || val.Sign() <= 0 {
-		return
+// The balance is unchanged if an error is returned.
+func (so *StateObj) SubBalance(val *big.Int) error {
+	if val == nil || val.Sign() == 0 {
+		return nil
 	}
-	oldBalance := so.balance
-	if oldBalance == nil {
-		oldBalance = zeroBigN
+	newBalance, err := subBalance(so.balance, val)
+	if err != nil {
+		return err
 	}
-	newBalance := oldBalance.Sub(oldBalance, val)
 	so.SetBalance(newBalance)
+	return nil
 }
 
 func (so *StateObj) SetBalance(val *big.Int) {
 	if val == nil || val.Sign() < 0 {
 		return
 	}
+	if so.journal != nil {
+		so.journal.append(balanceChange{obj: so, prev: so.balance})
+	}
 	so.balance = val
+	so.markDirty()
+}
+
+// markDirty flags the account to be written to the state tree by the next update.
+func (so *StateObj) markDirty() {
+	so.dirty = true
+	if so.journal != nil {
+		so.journal.markDirty(so.address)
+	}
 }
 
 func (so *StateObj) GetBalance() *big.Int {
@@ -167,13 +334,17 @@ func (so *StateObj) GetAddress() common.Address {
 }
 
 func (so *StateObj) SetNonce(nonce uint64) {
+	if so.journal != nil {
+		so.journal.append(nonceChange{obj: so, prev: so.nonce})
+	}
 	so.nonce = nonce
+	so.markDirty()
 }
 func (so *StateObj) AddNonce(nonce uint64) {
-	so.nonce += nonce
+	so.SetNonce(so.nonce + nonce)
 }
 func (so *StateObj) SubNonce(nonce uint64) {
-	so.nonce -= nonce
+	so.SetNonce(so.nonce - nonce)
 }
 func (so *StateObj) GetNonce() uint64 {
 	return so.nonce
@@ -182,26 +353,175 @@ func (so *StateObj) GetExtra() []byte {
 	return so.extra
 }
 
+// SetExtra replaces the extra data of the account, the data can not be larger than common.MaxExtraSize.
+func (so *StateObj) SetExtra(extra []byte) error {
+	if len(extra) > common.MaxExtraSize {
+		return ErrExtraTooLarge
+	}
+	if so.journal != nil {
+		so.journal.append(extraChange{obj: so, prev: so.extra})
+	}
+	so.extra = append([]byte(nil), extra...)
+	so.markDirty()
+	return nil
+}
+
+// SetCode sets the contract code of the account, the code itself is written to
+// the code store keyed by its keccak hash when the state tree is committed.
 func (so *StateObj) SetCode(code []byte) {
+	if so.journal != nil {
+		so.journal.append(codeChange{
+			obj:       so,
+			prevCode:  so.code,
+			prevHash:  so.codeHash,
+			prevDirty: so.dirtyCode,
+		})
+	}
+	so.markDirty()
+	if len(code) == 0 {
+		so.code = nil
+		so.codeHash = common.Hash{}
+		return
+	}
 	so.code = code
+	so.codeHash = common.Bytes2Hash(ahash.Keccak256(code))
+	so.dirtyCode = true
 }
 func (so *StateObj) SetState(key [32]byte, value []byte) {
+	if so.journal != nil {
+		prev, existed := so.cacheStorage[key]
+		so.journal.append(storageChange{obj: so, key: key, prev: prev, existed: existed})
+	}
 	so.cacheStorage[key] = value
+	so.dirtyStorage[key] = struct{}{}
+	so.markDirty()
 }
 func (so *StateObj) GetCode() []byte {
+	if so.code != nil {
+		return so.code
+	}
+	if bytes.Equal(so.codeHash[:], common.HashZ[:]) || so.db == nil {
+		return nil
+	}
+	code, err := so.db.GetData(codeKey(so.codeHash))
+	if err != nil || len(code) == 0 {
+		return nil
+	}
+	so.code = code
 	return so.code
 }
+
+// GetCodeHash returns the keccak hash of the contract code, or the zero hash if the account has no code.
+func (so *StateObj) GetCodeHash() common.Hash {
+	return so.codeHash
+}
+
+func (so *StateObj) GetCodeSize() int {
+	return len(so.GetCode())
+}
+
+func (so *StateObj) commitCode() error {
+	if !so.dirtyCode || so.code == nil {
+		return nil
+	}
+	if err := so.db.SetData(codeKey(so.codeHash), so.code); err != nil {
+		return err
+	}
+	so.dirtyCode = false
+	return nil
+}
 func (so *StateObj) makeStateKey(key [32]byte) []byte {
 	return ahash.SHA256(append(so.address[:], key[:]...))
 }
 func (so *StateObj) getStateTree() *avlmerkle.Tree {
-	return avlmerkle.NewTree(so.db, so.stateRoot[:])
+	if so.storageTree == nil {
+		so.storageTree = avlmerkle.NewTree(so.db, so.stateRoot[:])
+	}
+	return so.storageTree
+}
+
+// IterateStorage calls fn with the hashed key and the value of every storage slot whose
+// hashed key is greater than or equal to start, in key order, until fn returns false.
+// Storage written since the last Update is not visited.
+func (so *StateObj) IterateStorage(start []byte, fn func(key []byte, value []byte) bool) {
+	if bytes.Equal(so.stateRoot[:], common.HashZ[:]) {
+		return
+	}
+	so.getStateTree().Iterate(start, fn)
+}
+
+// ForEachStorage calls fn with the hashed key and the value of every storage slot of the
+// account in key order, until fn returns false. Unlike IterateStorage the values written
+// since the last Update are visited, overriding the ones of the storage tree.
+func (so *StateObj) ForEachStorage(fn func(key []byte, value []byte) bool) {
+	dirty := make([][]byte, 0, len(so.cacheStorage))
+	values := make(map[string][]byte, len(so.cacheStorage))
+	for k, v := range so.cacheStorage {
+		hashed := so.makeStateKey(k)
+		dirty = append(dirty, hashed)
+		values[string(hashed)] = v
+	}
+	sort.Slice(dirty, func(i, j int) bool {
+		return bytes.Compare(dirty[i], dirty[j]) < 0
+	})
+	i, stopped := 0, false
+	so.IterateStorage(nil, func(key []byte, value []byte) bool {
+		for ; i < len(dirty) && bytes.Compare(dirty[i], key) < 0; i++ {
+			if !fn(dirty[i], values[string(dirty[i])]) {
+				stopped = true
+				return false
+			}
+		}
+		if i < len(dirty) && bytes.Equal(dirty[i], key) {
+			value = values[string(key)]
+			i++
+		}
+		if !fn(key, value) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if stopped {
+		return
+	}
+	for ; i < len(dirty); i++ {
+		if !fn(dirty[i], values[string(dirty[i])]) {
+			return
+		}
+	}
+}
+
+func (so *StateObj) commitStorage() error {
+	if !so.storageUpdated {
+		return nil
+	}
+	if err := so.storageTree.Commit(); err != nil {
+		return err
+	}
+	so.storageUpdated = false
+	return nil
 }
 
 func (so *StateObj) GetStateValue(key [32]byte) []byte {
 	if val, exists := so.cacheStorage[key]; exists {
 		return val
 	}
+	if bytes.Equal(so.stateRoot[:], common.HashZ[:]) {
+		return nil
+	}
+	if val, ok := so.getStateTree().Get(so.makeStateKey(key)); ok {
+		return val
+	}
+	return nil
+}
+
+// GetCommittedState returns the value of the storage slot as of the last Update, that
+// is before the writes of the running transaction, while GetStateValue returns the dirty one.
+func (so *StateObj) GetCommittedState(key [32]byte) []byte {
+	if bytes.Equal(so.stateRoot[:], common.HashZ[:]) {
+		return nil
+	}
 	if val, ok := so.getStateTree().Get(so.makeStateKey(key)); ok {
 		return val
 	}
@@ -212,30 +532,102 @@ func (so *StateObj) GetStateRoot() common.Hash {
 	return so.stateRoot
 }
 
+// Empty reports whether the account has a zero balance, a zero nonce and no code.
+func (so *StateObj) Empty() bool {
+	return (so.balance == nil || so.balance.Sign() == 0) &&
+		so.nonce == 0 &&
+		bytes.Equal(so.codeHash[:], common.HashZ[:])
+}
+
+// deletable reports whether the account has no balance, nonce, code, extra data and
+// storage, so removing it from the merkle tree is the same as keeping it.
+func (so *StateObj) deletable() bool {
+	return so.Empty() && len(so.extra) == 0 && so.stateRoot == common.HashZ
+}
+
+// HasSuicided reports whether the account is marked for deletion.
+func (so *StateObj) HasSuicided() bool {
+	return so.suicided
+}
+
+// Update writes the changes of the account into the merkle tree. Only the storage
+// written since the last update is put into the storage tree, and an unchanged
+// account is not put into the tree at all. A suicided account is removed from the tree.
 func (so *StateObj) Update() {
-	for k, v := range so.cacheStorage {
-		so.getStateTree().Put(so.makeStateKey(k), v)
+	if !so.dirty {
+		return
+	}
+	if so.suicided {
+		so.merkleTree.Remove(ahash.SHA256(so.address[:]))
+		so.dirtyStorage = make(map[[32]byte]struct{})
+		so.dirty = false
+		return
+	}
+	if len(so.dirtyStorage) > 0 {
+		tree := so.getStateTree()
+		keys := make([][32]byte, 0, len(so.dirtyStorage))
+		for k := range so.dirtyStorage {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i][:], keys[j][:]) < 0
+		})
+		for _, k := range keys {
+			// reverted writes of new keys are no longer cached
+			if v, exists := so.cacheStorage[k]; exists {
+				tree.Put(so.makeStateKey(k), v)
+			}
+		}
+		so.storageUpdated = true
+		so.stateRoot = common.Bytes2Hash(tree.Checksum())
+		so.dirtyStorage = make(map[[32]byte]struct{})
 	}
-	stateRoot := so.getStateTree().Checksum()
-	so.stateRoot = common.Bytes2Hash(stateRoot)
 	objRaw, _ := rawencode.Encode(so)
 	hash := ahash.SHA256(so.address[:])
 	so.merkleTree.Put(hash, objRaw)
-
+	so.dirty = false
 }
 
+// StateTree is the state of the accounts at a root. Its accessors and its writers can be
+// called from several goroutines at once, such as the rpc handlers reading the state of
+// the chain head while a block is processed. The state objects it hands out belong to the
+// tree, they must only be changed through the tree.
 type StateTree struct {
 	root       []byte
 	treeDB     badger.IStorage
 	merkleTree *avlmerkle.Tree
-	objs       map[common.Address]*StateObj
+	// mu serializes the accessors, which load the accounts and the nodes of the merkle
+	// trees into the caches of the tree, and the writers
+	mu      sync.Mutex
+	objs    map[common.Address]*StateObj
+	journal *stateJournal
+	// accessList holds the addresses and slots accessed by the current transaction
+	accessList *accessList
+	// preimages are the preimages of the hashes seen by the vm since the last Commit
+	preimages map[common.Hash][]byte
+	// thash and txIndex are the transaction the logs added are emitted by, logSize is
+	// the number of logs of the block so far
+	thash   common.Hash
+	txIndex int
+	logs    map[common.Hash][]*core.Log
+	logSize uint
+	// codeStore writes the hash of the contract code to the updated account records
+	// instead of the code, it is set by the ForkCodeStore fork
+	codeStore bool
+	// deleteEmpty deletes the accounts left empty from the merkle tree on update,
+	// it is set by the ForkDeleteEmptyAccounts fork
+	deleteEmpty bool
 }
 
 func NewStateTree(db badger.IStorage, root []byte) *StateTree {
 	st := &StateTree{
-		root:   root,
-		treeDB: db,
-		objs:   make(map[common.Address]*StateObj),
+		root:       root,
+		treeDB:     db,
+		objs:       make(map[common.Address]*StateObj),
+		journal:    newStateJournal(),
+		accessList: newAccessList(),
+		preimages:  make(map[common.Hash][]byte),
+		logs:       make(map[common.Hash][]*core.Log),
 	}
 	st.merkleTree = avlmerkle.NewTree(st.treeDB, root)
 	return st
@@ -243,55 +635,113 @@ func NewStateTree(db badger.IStorage, root []byte) *StateTree {
 func NewStateTreeN(db badger.IStorage, root []byte) (*StateTree, error) {
 	var err error
 	st := &StateTree{
-		root:   root,
-		treeDB: db,
-		objs:   make(map[common.Address]*StateObj),
+		root:       root,
+		treeDB:     db,
+		objs:       make(map[common.Address]*StateObj),
+		journal:    newStateJournal(),
+		accessList: newAccessList(),
+		preimages:  make(map[common.Hash][]byte),
+		logs:       make(map[common.Hash][]*core.Log),
 	}
 	st.merkleTree, err = avlmerkle.NewTreeN(st.treeDB, root)
 	return st, err
 }
 func (st *StateTree) HashAccount(addr common.Address) bool {
-	return st.GetStateObj(addr) != nil
+	return st.Exist(addr)
+}
+
+// Exist reports whether the account exists in the state, either cached or in the merkle
+// tree. Suicided accounts exist until the state is committed.
+func (st *StateTree) Exist(addr common.Address) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.getStateObj(addr) != nil
 }
 
+// Empty reports whether the account doesn't exist or has a zero balance, a zero nonce
+// and no code.
+func (st *StateTree) Empty(addr common.Address) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
+	return obj == nil || obj.Empty()
+}
+
+// GetBalance returns a copy of the balance of the account, which the caller may modify.
 func (st *StateTree) GetBalance(addr common.Address) *big.Int {
-	obj := st.GetStateObj(addr)
-	if obj != nil {
-		if obj.balance == nil {
-			return zeroBigN
-		}
-		return obj.balance
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
+	if obj == nil || obj.balance == nil {
+		return new(big.Int)
 	}
-	return zeroBigN
+	return new(big.Int).Set(obj.balance)
 }
 
+// Copy returns an independent copy of the state with its changes, the state objects
+// and the trees are copied so that the states can be changed and used concurrently.
+// The copy can't be reverted to the snapshots taken before.
 func (st *StateTree) Copy() *StateTree {
+	st.mu.Lock()
+	defer st.mu.Unlock()
 	cpy := new(StateTree)
-	copy(cpy.root, st.root)
+	if st.root != nil {
+		cpy.root = append([]byte{}, st.root...)
+	}
 	cpy.treeDB = st.treeDB
 	cpy.merkleTree = st.merkleTree.Copy()
 	cpy.objs = make(map[common.Address]*StateObj)
+	cpy.journal = newStateJournal()
+	cpy.accessList = newAccessList()
+	cpy.preimages = make(map[common.Hash][]byte, len(st.preimages))
+	cpy.thash, cpy.txIndex, cpy.logSize = st.thash, st.txIndex, st.logSize
+	cpy.codeStore, cpy.deleteEmpty = st.codeStore, st.deleteEmpty
+	cpy.logs = make(map[common.Hash][]*core.Log, len(st.logs))
+	for k, v := range st.logs {
+		cpy.logs[k] = append([]*core.Log{}, v...)
+	}
 	for k, v := range st.objs {
-		cpy.objs[k] = v
+		cpy.objs[k] = v.deepCopy(cpy)
+	}
+	for addr := range st.journal.dirties {
+		cpy.journal.markDirty(addr)
+	}
+	for k, v := range st.preimages {
+		cpy.preimages[k] = v
 	}
 	return cpy
 }
 func (st *StateTree) Set(snap *StateTree) *StateTree {
+	st.mu.Lock()
+	defer st.mu.Unlock()
 	st.root = snap.root
 	st.treeDB = snap.treeDB
 	st.merkleTree = snap.merkleTree
 	st.objs = snap.objs
+	st.journal = snap.journal
+	st.accessList = snap.accessList
+	st.preimages = snap.preimages
+	st.thash, st.txIndex = snap.thash, snap.txIndex
+	st.logs, st.logSize = snap.logs, snap.logSize
+	st.codeStore, st.deleteEmpty = snap.codeStore, snap.deleteEmpty
 	return st
 }
 
-func (st *StateTree) AddBalance(addr common.Address, val *big.Int) {
-	obj := st.GetOrNewStateObj(addr)
-	if obj != nil {
-		obj.AddBalance(val)
-	}
+func (st *StateTree) AddBalance(addr common.Address, val *big.Int) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.getOrNewStateObj(addr).AddBalance(val)
 }
+func (st *StateTree) SubBalance(addr common.Address, val *big.Int) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.getOrNewStateObj(addr).SubBalance(val)
+}
+
 func (st *StateTree) GetNonce(addr common.Address) uint64 {
-	obj := st.GetStateObj(addr)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
 	if obj != nil {
 		return obj.nonce
 	}
@@ -299,36 +749,111 @@ func (st *StateTree) GetNonce(addr common.Address) uint64 {
 }
 
 func (st *StateTree) AddNonce(addr common.Address, val uint64) {
-	obj := st.GetOrNewStateObj(addr)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getOrNewStateObj(addr)
 	if obj != nil {
 		obj.AddNonce(val)
 	}
 }
 
+// GetStateObj returns the account object of the tree, nil if the account doesn't exist.
+// The object is changed by the writers of the tree, readers running concurrently with
+// them use the accessors of the tree instead.
 func (st *StateTree) GetStateObj(addr common.Address) *StateObj {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.getStateObj(addr)
+}
+
+func (st *StateTree) getStateObj(addr common.Address) *StateObj {
 	if st.objs[addr] != nil {
 		return st.objs[addr]
 	}
 	hash := ahash.SHA256(addr.Bytes())
 	if val, has := st.merkleTree.Get(hash); has {
-		obj := &StateObj{}
-		if err := rawencode.Decode(val, obj); err != nil {
+		obj, err := st.loadStateObj(val)
+		if err != nil {
 			return nil
 		}
-		obj.merkleTree = st.merkleTree
 		st.objs[addr] = obj
 		return obj
 	}
 	return nil
 }
 
+// loadStateObj decodes an account record of the merkle tree into an object of the tree.
+func (st *StateTree) loadStateObj(val []byte) (*StateObj, error) {
+	obj, err := DecodeAccount(val)
+	if err != nil {
+		return nil, err
+	}
+	obj.merkleTree = st.merkleTree
+	obj.db = st.treeDB
+	obj.journal = st.journal
+	// records in an older encoding are only rewritten when the account is modified, so
+	// reading an account never changes the root
+	return obj, nil
+}
+
+// DecodeAccount decodes an account record of the state merkle tree. The code and the
+// storage of the account are only available from the objects of an opened state.
+func DecodeAccount(data []byte) (*StateObj, error) {
+	obj := &StateObj{}
+	if err := rawencode.Decode(data, obj); err != nil {
+		return nil, err
+	}
+	obj.cacheStorage = make(map[[32]byte][]byte)
+	obj.dirtyStorage = make(map[[32]byte]struct{})
+	return obj, nil
+}
+
+// ForEachAccount calls fn with every account of the merkle tree in the order of the
+// hashes of their addresses, until fn returns false. Accounts changed since the last
+// UpdateAll are visited as they were, the visited objects are not cached by the tree.
+func (st *StateTree) ForEachAccount(fn func(obj *StateObj) bool) error {
+	return st.IterateAccounts(nil, func(_ []byte, obj *StateObj) bool {
+		return fn(obj)
+	})
+}
+
+// IterateAccounts is ForEachAccount starting from the account whose key, the hash of
+// its address, is the first not lower than start. fn is called with the key, it must
+// not call the accessors of the tree.
+func (st *StateTree) IterateAccounts(start []byte, fn func(key []byte, obj *StateObj) bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var err error
+	st.merkleTree.Iterate(start, func(key []byte, value []byte) bool {
+		var obj *StateObj
+		if obj, err = st.loadStateObj(value); err != nil {
+			return false
+		}
+		// the storage tree of an account updated but not committed is only in the cache
+		if cached, exists := st.objs[obj.address]; exists && !cached.dirty && len(cached.dirtyStorage) == 0 {
+			obj = cached
+		}
+		return fn(key, obj)
+	})
+	return err
+}
+
 func (st *StateTree) newStateObj(address common.Address) *StateObj {
 	obj := NewStateObj(address, st.merkleTree, st.treeDB)
+	obj.journal = st.journal
+	st.journal.append(createObjectChange{addr: address, prev: st.objs[address]})
+	st.journal.markDirty(address)
 	st.objs[obj.address] = obj
 	return obj
 }
 func (st *StateTree) CreateAccount(addr common.Address) *StateObj {
-	old := st.GetStateObj(addr)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.createAccount(addr)
+}
+
+func (st *StateTree) createAccount(addr common.Address) *StateObj {
+	old := st.getStateObj(addr)
 	add := st.newStateObj(addr)
 	if old != nil {
 		add.balance = old.balance
@@ -337,53 +862,400 @@ func (st *StateTree) CreateAccount(addr common.Address) *StateObj {
 }
 
 func (st *StateTree) GetOrNewStateObj(addr common.Address) *StateObj {
-	stateObj := st.GetStateObj(addr)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.getOrNewStateObj(addr)
+}
+
+func (st *StateTree) getOrNewStateObj(addr common.Address) *StateObj {
+	stateObj := st.getStateObj(addr)
 	if stateObj == nil {
-		stateObj = st.CreateAccount(addr)
+		stateObj = st.createAccount(addr)
 	}
 	return stateObj
 }
 func (st *StateTree) SetState(addr common.Address, key [32]byte, value []byte) {
-	obj := st.GetOrNewStateObj(addr)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getOrNewStateObj(addr)
 	if obj != nil {
 		obj.SetState(key, value)
 	}
 }
 func (st *StateTree) SetCode(addr common.Address, code []byte) {
-	obj := st.GetOrNewStateObj(addr)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getOrNewStateObj(addr)
 	if obj != nil {
 		obj.SetCode(code)
 	}
 }
+func (st *StateTree) SetExtra(addr common.Address, extra []byte) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getOrNewStateObj(addr)
+	if obj != nil {
+		return obj.SetExtra(extra)
+	}
+	return nil
+}
+
+func (st *StateTree) GetExtra(addr common.Address) []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
+	if obj != nil {
+		return obj.GetExtra()
+	}
+	return nil
+}
+
 func (st *StateTree) GetCode(addr common.Address) []byte {
-	obj := st.GetOrNewStateObj(addr)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
 	if obj != nil {
 		return obj.GetCode()
 	}
 	return nil
 }
 
+func (st *StateTree) GetCodeHash(addr common.Address) common.Hash {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
+	if obj != nil {
+		return obj.GetCodeHash()
+	}
+	return common.Hash{}
+}
+
+func (st *StateTree) GetCodeSize(addr common.Address) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
+	if obj != nil {
+		return obj.GetCodeSize()
+	}
+	return 0
+}
+
 func (st *StateTree) GetStateValue(addr common.Address, key [32]byte) []byte {
-	obj := st.GetOrNewStateObj(addr)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
 	if obj != nil {
 		return obj.GetStateValue(key)
 	}
 	return nil
 }
+
+// ForEachStorage calls fn with the hashed key and the latest value of every storage slot
+// of the account in key order, until fn returns false. The slots are read before fn is
+// called, so fn may call the accessors of the tree.
+func (st *StateTree) ForEachStorage(addr common.Address, fn func(key []byte, value []byte) bool) {
+	var keys, values [][]byte
+	st.mu.Lock()
+	if obj := st.getStateObj(addr); obj != nil {
+		obj.ForEachStorage(func(key []byte, value []byte) bool {
+			keys = append(keys, key)
+			values = append(values, value)
+			return true
+		})
+	}
+	st.mu.Unlock()
+	for i := range keys {
+		if !fn(keys[i], values[i]) {
+			return
+		}
+	}
+}
+
+// GetCommittedState returns the value of the storage slot of the account as of the last UpdateAll.
+func (st *StateTree) GetCommittedState(addr common.Address, key [32]byte) []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
+	if obj != nil {
+		return obj.GetCommittedState(key)
+	}
+	return nil
+}
 func (st *StateTree) Root() []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
 	return st.merkleTree.Checksum()
 }
 
+// GetProof returns the merkle proof of the account record in the state tree.
+func (st *StateTree) GetProof(addr common.Address) ([][]byte, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.merkleTree.Prove(ahash.SHA256(addr.Bytes()))
+}
+
+// VerifyAccountProof checks the proof of the account made by GetProof against the state
+// root and returns the account, or nil if the proof shows the account doesn't exist.
+func VerifyAccountProof(root common.Hash, addr common.Address, proof [][]byte) (*StateObj, error) {
+	val, exists, err := avlmerkle.VerifyProof(root.Bytes(), ahash.SHA256(addr.Bytes()), proof)
+	if err != nil || !exists {
+		return nil, err
+	}
+	obj := &StateObj{}
+	if err = rawencode.Decode(val, obj); err != nil {
+		return nil, err
+	}
+	if obj.address != addr {
+		return nil, avlmerkle.ErrInvalidProof
+	}
+	if obj.balance == nil {
+		obj.balance = new(big.Int)
+	}
+	return obj, nil
+}
+
 func (st *StateTree) RootHex() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
 	return st.merkleTree.ChecksumHex()
 }
 
+// Suicide marks the account as suicided and clears its balance. The account stays
+// visible until the next UpdateAll removes it from the state tree, an account written
+// after that is a new one. It reports whether the account exists.
+func (st *StateTree) Suicide(addr common.Address) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
+	if obj == nil {
+		return false
+	}
+	st.journal.append(suicideChange{obj: obj, prev: obj.suicided, prevBalance: obj.balance})
+	obj.suicided = true
+	obj.balance = new(big.Int)
+	obj.markDirty()
+	return true
+}
+
+// HasSuicided reports whether the account is marked as suicided in this state.
+func (st *StateTree) HasSuicided(addr common.Address) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	obj := st.getStateObj(addr)
+	if obj != nil {
+		return obj.suicided
+	}
+	return false
+}
+
+// SetTxContext sets the hash and the index in the block of the transaction whose logs
+// are added next.
+func (st *StateTree) SetTxContext(thash common.Hash, ti int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.thash = thash
+	st.txIndex = ti
+}
+
+// AddLog collects a log emitted by the current transaction and assigns it its index
+// in the block, the block fields are set once the block is known.
+func (st *StateTree) AddLog(log *core.Log) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.journal.append(addLogChange{txHash: st.thash})
+	log.TxHash = st.thash
+	log.TxIndex = uint(st.txIndex)
+	log.Index = st.logSize
+	st.logs[st.thash] = append(st.logs[st.thash], log)
+	st.logSize++
+}
+
+// GetLogs returns the logs of the transaction with the block fields set.
+func (st *StateTree) GetLogs(thash common.Hash, blockHash common.Hash, height uint64) []*core.Log {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	logs := st.logs[thash]
+	for _, l := range logs {
+		l.BlockHash = blockHash
+		l.BlockHeight = height
+	}
+	return logs
+}
+
+// Logs returns the logs collected by the state tree.
+func (st *StateTree) Logs() []*core.Log {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	logs := make([]*core.Log, 0, st.logSize)
+	for _, lgs := range st.logs {
+		logs = append(logs, lgs...)
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Index < logs[j].Index
+	})
+	return logs
+}
+
+// AddPreimage records the preimage of a hash computed by the vm, it is written with
+// the state by Commit.
+func (st *StateTree) AddPreimage(hash common.Hash, preimage []byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, exists := st.preimages[hash]; exists {
+		return
+	}
+	st.journal.append(addPreimageChange{hash: hash})
+	st.preimages[hash] = append([]byte{}, preimage...)
+}
+
+// Preimages returns the preimages recorded since the last Commit.
+func (st *StateTree) Preimages() map[common.Hash][]byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	preimages := make(map[common.Hash][]byte, len(st.preimages))
+	for k, v := range st.preimages {
+		preimages[k] = v
+	}
+	return preimages
+}
+
+// PrepareAccessList clears the access list for a new transaction and adds the sender
+// and the destination of the transaction to it, dst is nil for contract creations.
+func (st *StateTree) PrepareAccessList(sender common.Address, dst *common.Address) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.accessList = newAccessList()
+	st.accessList.addAddress(sender)
+	if dst != nil {
+		st.accessList.addAddress(*dst)
+	}
+}
+
+// AddAddressToAccessList adds the address to the access list, the addition is
+// reverted with the state.
+func (st *StateTree) AddAddressToAccessList(addr common.Address) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.accessList.addAddress(addr) {
+		st.journal.append(accessListAddAccountChange{addr: addr})
+	}
+}
+
+// AddSlotToAccessList adds the storage slot of the address and the address itself
+// to the access list, the additions are reverted with the state.
+func (st *StateTree) AddSlotToAccessList(addr common.Address, slot [32]byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	addrAdded, slotAdded := st.accessList.addSlot(addr, slot)
+	if addrAdded {
+		st.journal.append(accessListAddAccountChange{addr: addr})
+	}
+	if slotAdded {
+		st.journal.append(accessListAddSlotChange{addr: addr, slot: slot})
+	}
+}
+
+// AddressInAccessList reports whether the address is in the access list.
+func (st *StateTree) AddressInAccessList(addr common.Address) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.accessList.containsAddress(addr)
+}
+
+// SlotInAccessList reports whether the address and the storage slot of the address
+// are in the access list.
+func (st *StateTree) SlotInAccessList(addr common.Address, slot [32]byte) (addressOk bool, slotOk bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.accessList.contains(addr, slot)
+}
+
+// AccessList returns the addresses and the storage slots in the access list.
+func (st *StateTree) AccessList() []AccessListEntry {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.accessList.entries()
+}
+
+// Snapshot returns an identifier of the current revision of the state.
+func (st *StateTree) Snapshot() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.journal.snapshot()
+}
+
+// RevertToSnapshot reverts all state changes made since the given revision.
+// Changes flushed into the merkle tree by UpdateAll can not be reverted.
+func (st *StateTree) RevertToSnapshot(id int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.journal.revertToSnapshot(st, id)
+}
+
+// SetForkRules sets the rules of the state which change with the forks of the chain with
+// the config active at the height.
+func (st *StateTree) SetForkRules(config *ChainConfig, height uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.codeStore = config.IsForkActive(ForkCodeStore, height)
+	st.deleteEmpty = config.IsForkActive(ForkDeleteEmptyAccounts, height)
+}
+
+// UpdateAll writes the accounts modified since the last update to the merkle tree. The
+// shape of the tree depends on the order of its writes, the accounts are written in the
+// order of their addresses so the root only depends on the modifications.
 func (st *StateTree) UpdateAll() {
-	for _, v := range st.objs {
-		v.Update()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, addr := range st.journal.sortedDirties() {
+		obj := st.objs[addr]
+		if obj == nil {
+			continue
+		}
+		if obj.dirty {
+			obj.inlineCode = !st.codeStore
+		}
+		obj.Update()
+		if obj.suicided {
+			// the account is gone from the tree, later writes start a new account
+			delete(st.objs, addr)
+			continue
+		}
+		if st.deleteEmpty && obj.deletable() {
+			st.merkleTree.Remove(ahash.SHA256(addr[:]))
+			delete(st.objs, addr)
+		}
 	}
+	st.journal.reset()
 }
 
 func (st *StateTree) Commit() error {
-	return st.merkleTree.Commit()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, v := range st.objs {
+		if v.suicided {
+			continue
+		}
+		if err := v.commitCode(); err != nil {
+			return err
+		}
+		if err := v.commitStorage(); err != nil {
+			return err
+		}
+	}
+	if err := st.merkleTree.Commit(); err != nil {
+		return err
+	}
+	for hash, preimage := range st.preimages {
+		if err := st.treeDB.SetData(preimageKey(hash), preimage); err != nil {
+			return err
+		}
+	}
+	st.preimages = make(map[common.Hash][]byte)
+	for addr, v := range st.objs {
+		if v.suicided {
+			delete(st.objs, addr)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,940 @@
+package xfsgo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/core"
+	"xfsgo/storage/badger"
+)
+
+func newTestStateDB(t *testing.T) *badger.Storage {
+	db, err := badger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestStateTree_CodeStore(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	st.codeStore = true
+	code := []byte("contract code")
+	a := common.Bytes2Address([]byte{0x01})
+	b := common.Bytes2Address([]byte{0x02})
+	st.SetCode(a, code)
+	st.SetCode(b, code)
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, st.Root())
+	wantHash := common.Bytes2Hash(ahash.Keccak256(code))
+	assert.HashEqual(t, st.GetCodeHash(a), wantHash)
+	assert.HashEqual(t, st.GetCodeHash(b), wantHash)
+	assert.BytesEqual(t, st.GetCode(a), code)
+	assert.Equal(t, st.GetCodeSize(b), len(code))
+	obj := st.GetStateObj(a)
+	enc, err := obj.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := common.StringDecodeMap(string(enc))
+	if _, exists := m["code"]; exists {
+		t.Fatalf("code should not be stored inline in the account")
+	}
+	count := 0
+	_ = db.PrefixForeachData(codePrefix, func(k []byte, v []byte) error {
+		count++
+		return nil
+	})
+	assert.Equal(t, count, 1)
+}
+
+func TestStateTree_CodeStoreFork(t *testing.T) {
+	db := newTestStateDB(t)
+	code := []byte("contract code")
+	addr := common.Bytes2Address([]byte{0x01})
+	record := func(st *StateTree) map[string]string {
+		val, ok := st.merkleTree.Get(ahash.SHA256(addr[:]))
+		if !ok {
+			t.Fatal("account not found")
+		}
+		return common.StringDecodeMap(string(val))
+	}
+	commit := func(st *StateTree) *StateTree {
+		st.UpdateAll()
+		if err := st.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return NewStateTree(db, st.Root())
+	}
+	// the code is inline before the fork
+	st := NewStateTree(db, nil)
+	st.SetCode(addr, code)
+	st = commit(st)
+	m := record(st)
+	assert.Equal(t, m["code"], hex.EncodeToString(code))
+	if _, exists := m["code_hash"]; exists {
+		t.Fatal("want no code hash before the fork")
+	}
+	st.AddBalance(addr, big.NewInt(1))
+	st = commit(st)
+	assert.Equal(t, record(st)["code"], hex.EncodeToString(code))
+
+	// a legacy record is migrated when the account is modified after the fork
+	st.codeStore = true
+	st.AddBalance(addr, big.NewInt(1))
+	st = commit(st)
+	m = record(st)
+	if _, exists := m["code"]; exists {
+		t.Fatal("want no inline code after the fork")
+	}
+	assert.Equal(t, m["code_hash"], hex.EncodeToString(ahash.Keccak256(code)))
+	assert.BytesEqual(t, st.GetCode(addr), code)
+}
+
+func TestStateTree_ReadKeepsRoot(t *testing.T) {
+	db := newTestStateDB(t)
+	addr := common.Bytes2Address([]byte{0x01})
+	key := ahash.SHA256Array([]byte("key"))
+	st := NewStateTree(db, nil)
+	st.SetCode(addr, []byte("contract code"))
+	st.SetState(addr, key, []byte{0x01})
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root := st.Root()
+	// the legacy record with inline code is read after the code store fork
+	st = NewStateTree(db, root)
+	st.codeStore = true
+	st.GetBalance(addr)
+	st.GetCode(addr)
+	st.GetStateValue(addr, key)
+	st.Exist(addr)
+	assert.Equal(t, len(st.journal.dirties), 0)
+	st.UpdateAll()
+	assert.BytesEqual(t, st.Root(), root)
+}
+
+func TestStateTree_RevertToSnapshot(t *testing.T) {
+	st := NewStateTree(newTestStateDB(t), nil)
+	addr := common.Bytes2Address([]byte{0x01})
+	key := ahash.SHA256Array([]byte("key"))
+	st.AddBalance(addr, big.NewInt(100))
+	st.SetState(addr, key, []byte("a"))
+	snap := st.Snapshot()
+	st.SubBalance(addr, big.NewInt(40))
+	st.AddNonce(addr, 1)
+	st.SetState(addr, key, []byte("b"))
+	st.SetCode(addr, []byte("code"))
+	st.RevertToSnapshot(snap)
+	assert.BigIntEqual(t, st.GetBalance(addr), big.NewInt(100))
+	assert.Equal(t, st.GetNonce(addr), uint64(0))
+	assert.BytesEqual(t, st.GetStateValue(addr, key), []byte("a"))
+	if st.GetCode(addr) != nil {
+		t.Fatalf("code not reverted")
+	}
+}
+
+func TestStateTree_GetCommittedState(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	addr := common.Bytes2Address([]byte{0x01})
+	key := ahash.SHA256Array([]byte("key"))
+	st.SetState(addr, key, []byte("a"))
+	if st.GetCommittedState(addr, key) != nil {
+		t.Fatalf("dirty value read as committed")
+	}
+	st.UpdateAll()
+	st.SetState(addr, key, []byte("b"))
+	assert.BytesEqual(t, st.GetStateValue(addr, key), []byte("b"))
+	assert.BytesEqual(t, st.GetCommittedState(addr, key), []byte("a"))
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, st.Root())
+	assert.BytesEqual(t, st.GetCommittedState(addr, key), []byte("b"))
+	st.SetState(addr, key, []byte("c"))
+	assert.BytesEqual(t, st.GetCommittedState(addr, key), []byte("b"))
+}
+
+func TestStateTree_RevertCreateAccount(t *testing.T) {
+	st := NewStateTree(newTestStateDB(t), nil)
+	a := common.Bytes2Address([]byte{0x01})
+	b := common.Bytes2Address([]byte{0x02})
+	st.AddBalance(a, big.NewInt(100))
+	st.UpdateAll()
+	root := st.Root()
+	snap := st.Snapshot()
+	st.AddBalance(b, big.NewInt(10))
+	if err := st.SetExtra(a, []byte("extra")); err != nil {
+		t.Fatal(err)
+	}
+	st.CreateAccount(a)
+	st.RevertToSnapshot(snap)
+	assert.Equal(t, st.HashAccount(b), false)
+	assert.BigIntEqual(t, st.GetBalance(a), big.NewInt(100))
+	if st.GetExtra(a) != nil {
+		t.Fatalf("extra not reverted")
+	}
+	st.UpdateAll()
+	assert.BytesEqual(t, st.Root(), root)
+}
+
+func TestStateTree_Suicide(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	addrs := make([]common.Address, 8)
+	for i := range addrs {
+		addrs[i] = common.Bytes2Address([]byte{byte(i + 1)})
+		st.AddBalance(addrs[i], big.NewInt(100))
+	}
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, st.Root())
+	snap := st.Snapshot()
+	assert.Equal(t, st.Suicide(addrs[2]), true)
+	st.RevertToSnapshot(snap)
+	assert.Equal(t, st.HasSuicided(addrs[2]), false)
+	assert.BigIntEqual(t, st.GetBalance(addrs[2]), big.NewInt(100))
+	for _, i := range []int{2, 5} {
+		assert.Equal(t, st.Suicide(addrs[i]), true)
+	}
+	assert.Equal(t, st.Suicide(common.Bytes2Address([]byte{0xff})), false)
+	assert.Equal(t, st.HasSuicided(addrs[2]), true)
+	assert.BigIntEqual(t, st.GetBalance(addrs[2]), big.NewInt(0))
+	st.UpdateAll()
+	assert.Equal(t, st.HashAccount(addrs[2]), false)
+	assert.Equal(t, st.HasSuicided(addrs[2]), false)
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, st.HashAccount(addrs[2]), false)
+	st = NewStateTree(db, st.Root())
+	for i, addr := range addrs {
+		exists := i != 2 && i != 5
+		assert.Equal(t, st.HashAccount(addr), exists)
+		if exists {
+			assert.BigIntEqual(t, st.GetBalance(addr), big.NewInt(100))
+		}
+	}
+}
+
+func TestStateTree_SuicideThenCredit(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	addr := common.Bytes2Address([]byte{0x01})
+	st.AddBalance(addr, big.NewInt(100))
+	st.UpdateAll()
+	assert.Equal(t, st.Suicide(addr), true)
+	st.UpdateAll()
+	// a credit after the removal by the update creates the account again
+	st.AddBalance(addr, big.NewInt(5))
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, st.Root())
+	assert.Equal(t, st.Exist(addr), true)
+	assert.BigIntEqual(t, st.GetBalance(addr), big.NewInt(5))
+}
+
+func TestStateTree_ExistEmpty(t *testing.T) {
+	st := NewStateTree(newTestStateDB(t), nil)
+	a := common.Bytes2Address([]byte{0x01})
+	b := common.Bytes2Address([]byte{0x02})
+	assert.Equal(t, st.Exist(a), false)
+	assert.Equal(t, st.Empty(a), true)
+	// reads do not create the account
+	_ = st.GetCode(a)
+	_ = st.GetStateValue(a, [32]byte{})
+	assert.Equal(t, st.Exist(a), false)
+	st.CreateAccount(a)
+	assert.Equal(t, st.Exist(a), true)
+	assert.Equal(t, st.Empty(a), true)
+	st.AddBalance(a, big.NewInt(1))
+	assert.Equal(t, st.Empty(a), false)
+	st.SetCode(b, []byte("code"))
+	assert.Equal(t, st.Empty(b), false)
+	st.SetCode(b, nil)
+	assert.Equal(t, st.Empty(b), true)
+	st.AddNonce(b, 1)
+	assert.Equal(t, st.Empty(b), false)
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(st.treeDB, st.Root())
+	assert.Equal(t, st.Exist(a), true)
+	assert.Equal(t, st.Empty(a), false)
+}
+
+func TestStateTree_AccessList(t *testing.T) {
+	st := NewStateTree(newTestStateDB(t), nil)
+	sender := common.Bytes2Address([]byte{0x01})
+	a := common.Bytes2Address([]byte{0x02})
+	b := common.Bytes2Address([]byte{0x03})
+	slot := ahash.SHA256Array([]byte("slot"))
+	st.PrepareAccessList(sender, &a)
+	assert.Equal(t, st.AddressInAccessList(sender), true)
+	assert.Equal(t, st.AddressInAccessList(a), true)
+	assert.Equal(t, st.AddressInAccessList(b), false)
+	snap := st.Snapshot()
+	st.AddSlotToAccessList(b, slot)
+	st.AddSlotToAccessList(a, slot)
+	addrOk, slotOk := st.SlotInAccessList(b, slot)
+	assert.Equal(t, addrOk && slotOk, true)
+	st.RevertToSnapshot(snap)
+	assert.Equal(t, st.AddressInAccessList(b), false)
+	addrOk, slotOk = st.SlotInAccessList(a, slot)
+	assert.Equal(t, addrOk, true)
+	assert.Equal(t, slotOk, false)
+	st.AddAddressToAccessList(b)
+	assert.Equal(t, len(st.AccessList()), 3)
+	st.PrepareAccessList(sender, nil)
+	assert.Equal(t, st.AddressInAccessList(a), false)
+}
+
+func TestStateTree_Preimages(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	a, b := []byte("a"), []byte("b")
+	hashA, hashB := common.Bytes2Hash(ahash.SHA256(a)), common.Bytes2Hash(ahash.SHA256(b))
+	st.AddPreimage(hashA, a)
+	snap := st.Snapshot()
+	st.AddPreimage(hashB, b)
+	assert.Equal(t, len(st.Preimages()), 2)
+	st.RevertToSnapshot(snap)
+	assert.Equal(t, len(st.Preimages()), 1)
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(st.Preimages()), 0)
+	assert.BytesEqual(t, ReadPreimage(db, hashA), a)
+	if ReadPreimage(db, hashB) != nil {
+		t.Fatalf("reverted preimage written")
+	}
+}
+
+func TestStateTree_AddLog(t *testing.T) {
+	st := NewStateTree(newTestStateDB(t), nil)
+	txA, txB := common.Hash{0x01}, common.Hash{0x02}
+	st.SetTxContext(txA, 0)
+	st.AddLog(&core.Log{Data: []byte("a")})
+	st.SetTxContext(txB, 1)
+	st.AddLog(&core.Log{Data: []byte("b")})
+	snap := st.Snapshot()
+	st.AddLog(&core.Log{Data: []byte("reverted")})
+	st.RevertToSnapshot(snap)
+	st.AddLog(&core.Log{Data: []byte("c")})
+
+	logs := st.GetLogs(txB, common.Hash{0xff}, 7)
+	assert.Equal(t, len(logs), 2)
+	for i, l := range logs {
+		assert.Equal(t, l.TxHash, txB)
+		assert.Equal(t, l.TxIndex, uint(1))
+		assert.Equal(t, l.Index, uint(i+1))
+		assert.Equal(t, l.BlockHash, common.Hash{0xff})
+		assert.Equal(t, l.BlockHeight, uint64(7))
+	}
+	all := st.Logs()
+	assert.Equal(t, len(all), 3)
+	assert.BytesEqual(t, all[0].Data, []byte("a"))
+	assert.BytesEqual(t, all[2].Data, []byte("c"))
+
+	// the derived fields are not part of the receipt encoding
+	receipt := NewReceipt(txA)
+	receipt.SetLogs([]*core.Log{{Data: []byte("a")}})
+	hash := receipt.Hash()
+	DeriveLogFields([]*Receipt{NewReceipt(txB), receipt}, common.Hash{0xff}, 7)
+	assert.Equal(t, receipt.Logs[0].TxIndex, uint(1))
+	assert.Equal(t, receipt.Logs[0].TxHash, txA)
+	assert.Equal(t, receipt.Hash(), hash)
+}
+
+func TestStateObj_DecodeCanonical(t *testing.T) {
+	a, zero := common.Bytes2Address([]byte{0x01}), common.Address{}
+	addr := a.B58String()
+	root := strings.Repeat("ab", 32)
+	valid := []string{
+		"address=" + addr + "&balance=10&nonce=0",
+		"balance=<nil>&nonce=1",
+		"balance=0&extra=0a&nonce=18446744073709551615&state_root=" + root,
+	}
+	for _, enc := range valid {
+		obj := new(StateObj)
+		if err := obj.Decode([]byte(enc)); err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		got, _ := obj.Encode()
+		assert.Equal(t, string(got), enc)
+	}
+	invalid := []string{
+		"nonce=0&balance=10",
+		"balance=10&balance=10&nonce=0",
+		"balance=10&nonce=0&",
+		"balance=10&nonce=0&owner=a",
+		"balance=010&nonce=0",
+		"balance=+10&nonce=0",
+		"balance=10&nonce=18446744073709551616",
+		"balance=10",
+		"balance=10&extra=0A&nonce=0",
+		"balance=10&nonce=0&state_root=" + strings.Repeat("00", 32),
+		"balance=10&nonce=0&state_root=abab",
+		"address=" + zero.B58String() + "&balance=10&nonce=0",
+	}
+	for _, enc := range invalid {
+		if err := new(StateObj).Decode([]byte(enc)); err == nil {
+			t.Fatalf("%s: want error", enc)
+		}
+	}
+}
+
+// FuzzStateObj_Decode checks every account accepted by the decoder has a single
+// encoding, only the legacy inline code is moved to the code store.
+func FuzzStateObj_Decode(f *testing.F) {
+	addr := common.Bytes2Address([]byte{0x01})
+	f.Add([]byte("address=" + addr.B58String() + "&balance=10&nonce=1"))
+	f.Add([]byte("balance=<nil>&code=00&extra=0a&nonce=0"))
+	f.Add([]byte("balance=0&code_hash=" + strings.Repeat("ab", 32) + "&nonce=0"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		obj := new(StateObj)
+		if err := obj.Decode(data); err != nil {
+			return
+		}
+		if bytes.Contains(data, []byte("code=")) {
+			return
+		}
+		enc, err := obj.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, data) {
+			t.Fatalf("non-canonical encoding accepted: %q, want %q", data, enc)
+		}
+	})
+}
+
+func TestStateObj_IterateStorage(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	addr := common.Bytes2Address([]byte{0x01})
+	for i := 0; i < 10; i++ {
+		st.SetState(addr, ahash.SHA256Array([]byte{byte(i)}), []byte{byte(i)})
+	}
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, st.Root())
+	obj := st.GetStateObj(addr)
+	assert.BytesEqual(t, obj.GetStateValue(ahash.SHA256Array([]byte{3})), []byte{3})
+	keys := make([][]byte, 0)
+	obj.IterateStorage(nil, func(key []byte, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Equal(t, len(keys), 10)
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			t.Fatalf("keys not in order")
+		}
+	}
+	page := make([][]byte, 0)
+	obj.IterateStorage(keys[4], func(key []byte, value []byte) bool {
+		page = append(page, key)
+		return len(page) < 3
+	})
+	assert.Equal(t, len(page), 3)
+	assert.BytesEqual(t, page[0], keys[4])
+	assert.BytesEqual(t, page[2], keys[6])
+}
+
+func TestStateTree_ForEachStorage(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	addr := common.Bytes2Address([]byte{0x01})
+	for i := 0; i < 6; i++ {
+		st.SetState(addr, ahash.SHA256Array([]byte{byte(i)}), []byte{byte(i)})
+	}
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, st.Root())
+	// dirty values override the committed ones and new slots are merged in order
+	st.SetState(addr, ahash.SHA256Array([]byte{2}), []byte("b"))
+	for i := 6; i < 9; i++ {
+		st.SetState(addr, ahash.SHA256Array([]byte{byte(i)}), []byte{byte(i)})
+	}
+	obj := st.GetStateObj(addr)
+	got := make(map[string][]byte)
+	keys := make([][]byte, 0)
+	st.ForEachStorage(addr, func(key []byte, value []byte) bool {
+		// the callback may read the tree
+		st.GetNonce(addr)
+		keys = append(keys, key)
+		got[string(key)] = value
+		return true
+	})
+	assert.Equal(t, len(keys), 9)
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			t.Fatalf("keys not in order")
+		}
+	}
+	for i := 0; i < 9; i++ {
+		slot := ahash.SHA256Array([]byte{byte(i)})
+		assert.BytesEqual(t, got[string(obj.makeStateKey(slot))], obj.GetStateValue(slot))
+	}
+	assert.BytesEqual(t, got[string(obj.makeStateKey(ahash.SHA256Array([]byte{2})))], []byte("b"))
+	count := 0
+	st.ForEachStorage(addr, func(key []byte, value []byte) bool {
+		count++
+		return count < 4
+	})
+	assert.Equal(t, count, 4)
+}
+
+func TestStateObj_storageTreeCached(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	addr := common.Bytes2Address([]byte{0x01})
+	key := ahash.SHA256Array([]byte("key"))
+	st.SetState(addr, key, []byte("a"))
+	st.UpdateAll()
+	obj := st.GetStateObj(addr)
+	tree := obj.getStateTree()
+	if obj.GetStateValue(ahash.SHA256Array([]byte("other"))) != nil {
+		t.Fatalf("got value of unknown key")
+	}
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st.SetState(addr, key, []byte("b"))
+	st.UpdateAll()
+	if obj.getStateTree() != tree {
+		t.Fatalf("storage tree reloaded")
+	}
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, st.Root())
+	assert.BytesEqual(t, st.GetStateValue(addr, key), []byte("b"))
+}
+
+func TestStateTree_UpdateDirtyAccounts(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	a := common.Bytes2Address([]byte{0x01})
+	b := common.Bytes2Address([]byte{0x02})
+	keyA := ahash.SHA256Array([]byte("a"))
+	keyB := ahash.SHA256Array([]byte("b"))
+	st.AddBalance(a, big.NewInt(100))
+	st.SetState(a, keyA, []byte("a"))
+	st.AddBalance(b, big.NewInt(200))
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root := st.Root()
+	st = NewStateTree(db, root)
+	objA, objB := st.GetStateObj(a), st.GetStateObj(b)
+	assert.Equal(t, objA.dirty, false)
+	assert.BigIntEqual(t, st.GetBalance(b), big.NewInt(200))
+	st.UpdateAll()
+	assert.BytesEqual(t, st.Root(), root)
+	st.SetState(a, keyB, []byte("b"))
+	assert.Equal(t, objA.dirty, true)
+	assert.Equal(t, len(objA.dirtyStorage), 1)
+	st.UpdateAll()
+	assert.Equal(t, objA.dirty, false)
+	assert.Equal(t, objB.dirty, false)
+	assert.Equal(t, len(objA.dirtyStorage), 0)
+	assert.BytesEqual(t, objA.GetStateValue(keyA), []byte("a"))
+	assert.BytesEqual(t, objA.GetStateValue(keyB), []byte("b"))
+	// the root equals the root of a tree updating every account
+	full := NewStateTree(newTestStateDB(t), nil)
+	full.AddBalance(a, big.NewInt(100))
+	full.SetState(a, keyA, []byte("a"))
+	full.SetState(a, keyB, []byte("b"))
+	full.AddBalance(b, big.NewInt(200))
+	full.UpdateAll()
+	assert.BytesEqual(t, st.Root(), full.Root())
+}
+
+func TestStateTree_ConcurrentReads(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	key := ahash.SHA256Array([]byte("key"))
+	addrs := make([]common.Address, 16)
+	for i := range addrs {
+		addrs[i] = common.Bytes2Address([]byte{byte(i + 1)})
+		st.AddBalance(addrs[i], big.NewInt(int64(i+1)))
+		st.AddNonce(addrs[i], uint64(i))
+		st.SetState(addrs[i], key, []byte{byte(i)})
+	}
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// the accounts and the nodes are loaded by the concurrent reads
+	st = NewStateTree(db, st.Root())
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, addr := range addrs {
+				if st.GetBalance(addr).Int64() != int64(i+1) || st.GetNonce(addr) != uint64(i) {
+					t.Errorf("wrong account %d", i)
+				}
+				if !bytes.Equal(st.GetStateValue(addr, key), []byte{byte(i)}) {
+					t.Errorf("wrong storage of account %d", i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestStateTree_ConcurrentReadsAndWrites(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	key := ahash.SHA256Array([]byte("key"))
+	addrs := make([]common.Address, 16)
+	for i := range addrs {
+		addrs[i] = common.Bytes2Address([]byte{byte(i + 1)})
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, addr := range addrs {
+					st.GetBalance(addr)
+					st.GetNonce(addr)
+					st.GetStateValue(addr, key)
+				}
+				st.Root()
+			}
+		}()
+	}
+	// the blocks are processed while the state is read
+	for n := 0; n < 20; n++ {
+		for i, addr := range addrs {
+			st.AddBalance(addr, big.NewInt(int64(i+1)))
+			st.AddNonce(addr, 1)
+			st.SetState(addr, key, []byte{byte(n)})
+		}
+		st.UpdateAll()
+		if err := st.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	for i, addr := range addrs {
+		assert.BigIntEqual(t, st.GetBalance(addr), big.NewInt(int64(20*(i+1))))
+		assert.Equal(t, st.GetNonce(addr), uint64(20))
+	}
+}
+
+func TestStateTree_ConcurrentLogsAndAccessList(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	addr := common.Bytes2Address([]byte{0x01})
+	slot := ahash.SHA256Array([]byte("slot"))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				st.Logs()
+				st.Preimages()
+				st.AccessList()
+				st.AddressInAccessList(addr)
+				st.SlotInAccessList(addr, slot)
+			}
+		}()
+	}
+	for n := 0; n < 100; n++ {
+		thash := common.Bytes2Hash([]byte{byte(n)})
+		st.SetTxContext(thash, n)
+		st.PrepareAccessList(addr, nil)
+		st.AddSlotToAccessList(addr, slot)
+		st.AddLog(&core.Log{Address: addr})
+		st.AddPreimage(thash, []byte{byte(n)})
+		st.GetLogs(thash, common.Hash{}, 1)
+	}
+	close(done)
+	wg.Wait()
+	assert.Equal(t, len(st.Logs()), 100)
+	assert.Equal(t, len(st.Preimages()), 100)
+}
+
+func TestStateTree_Copy(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	a := common.Bytes2Address([]byte{0x01})
+	b := common.Bytes2Address([]byte{0x02})
+	key := ahash.SHA256Array([]byte("key"))
+	st.AddBalance(a, big.NewInt(100))
+	st.SetState(a, key, []byte{0x01})
+	st.UpdateAll()
+	root := st.Root()
+	// the copy holds the changes not yet committed
+	cpy := st.Copy()
+	cpy.AddBalance(a, big.NewInt(50))
+	cpy.SetState(a, key, []byte{0x02})
+	cpy.AddBalance(b, big.NewInt(1))
+	cpy.UpdateAll()
+	assert.BigIntEqual(t, st.GetBalance(a), big.NewInt(100))
+	assert.BytesEqual(t, st.GetStateValue(a, key), []byte{0x01})
+	if st.Exist(b) {
+		t.Fatal("want account missing from the original")
+	}
+	assert.BytesEqual(t, st.Root(), root)
+	if bytes.Equal(cpy.Root(), root) {
+		t.Fatal("want root of the copy changed")
+	}
+	assert.BigIntEqual(t, cpy.GetBalance(a), big.NewInt(150))
+	assert.BytesEqual(t, cpy.GetStateValue(a, key), []byte{0x02})
+
+	// a copy can be changed while the original is read
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, root)
+	cpy = st.Copy()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 64; i++ {
+			cpy.AddBalance(common.Bytes2Address([]byte{byte(i + 2)}), big.NewInt(1))
+			cpy.UpdateAll()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 64; i++ {
+			if st.GetBalance(a).Int64() != 100 {
+				t.Errorf("wrong balance")
+			}
+		}
+	}()
+	wg.Wait()
+	assert.BytesEqual(t, st.Root(), root)
+}
+
+func TestOpenStateReader(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	a := common.Bytes2Address([]byte{0x01})
+	b := common.Bytes2Address([]byte{0x02})
+	key := ahash.SHA256Array([]byte("key"))
+	st.AddBalance(a, big.NewInt(100))
+	st.SetState(a, key, []byte("a"))
+	st.AddBalance(b, big.NewInt(200))
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenStateReader(db, common.Bytes2Hash(st.Root()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, reader.GetBalance(b), big.NewInt(200))
+	assert.BytesEqual(t, reader.GetStateValue(a, key), []byte("a"))
+	balances := make(map[common.Address]*big.Int)
+	if err = reader.ForEachAccount(func(obj *StateObj) bool {
+		balances[obj.GetAddress()] = obj.GetBalance()
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(balances), 2)
+	assert.BigIntEqual(t, balances[a], big.NewInt(100))
+	// the reader never writes the state db
+	rw := reader.(*StateTree)
+	rw.AddBalance(a, big.NewInt(1))
+	rw.UpdateAll()
+	if err = rw.Commit(); err == nil {
+		t.Fatalf("read only state committed")
+	}
+	if _, err = OpenStateReader(db, common.Hash{0x01}); err == nil {
+		t.Fatalf("unknown root opened")
+	}
+}
+
+func TestStateTree_Dump(t *testing.T) {
+	st := NewStateTree(newTestStateDB(t), nil)
+	key := ahash.SHA256Array([]byte("key"))
+	for i := byte(1); i <= 5; i++ {
+		addr := common.Bytes2Address([]byte{i})
+		st.AddBalance(addr, big.NewInt(int64(i)))
+		st.SetState(addr, key, []byte{i})
+	}
+	st.UpdateAll()
+	dump, err := st.Dump(&DumpConfig{Limit: 2, Storage: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, dump.Root, common.Bytes2Hash(st.Root()))
+	assert.Equal(t, len(dump.Accounts), 2)
+	assert.Equal(t, len(dump.Accounts[0].Storage), 1)
+	accounts := dump.Accounts
+	for dump.Next != nil {
+		if dump, err = st.Dump(&DumpConfig{Start: dump.Next, Limit: 2}); err != nil {
+			t.Fatal(err)
+		}
+		accounts = append(accounts, dump.Accounts...)
+	}
+	assert.Equal(t, len(accounts), 5)
+	for i, account := range accounts {
+		if i > 0 && bytes.Compare(accounts[i-1].Key, account.Key) >= 0 {
+			t.Fatalf("accounts not in key order")
+		}
+		addr := account.Address
+		assert.BytesEqual(t, account.Key, ahash.SHA256(addr.Bytes()))
+		assert.BigIntEqual(t, account.Balance, st.GetBalance(addr))
+	}
+}
+
+func TestStateTree_UpdateAllDeterministic(t *testing.T) {
+	addrs := make([]common.Address, 32)
+	for i := range addrs {
+		addrs[i] = common.Bytes2Address([]byte{byte(i + 1)})
+	}
+	update := func(order []int) []byte {
+		st := NewStateTree(newTestStateDB(t), nil)
+		for _, i := range order {
+			st.AddBalance(addrs[i], big.NewInt(int64(i+1)))
+			st.SetState(addrs[0], ahash.SHA256Array([]byte{byte(i)}), []byte{byte(i)})
+		}
+		assert.Equal(t, len(st.journal.dirties), len(order))
+		st.UpdateAll()
+		assert.Equal(t, len(st.journal.dirties), 0)
+		return st.Root()
+	}
+	forward, backward := make([]int, len(addrs)), make([]int, len(addrs))
+	for i := range addrs {
+		forward[i], backward[i] = i, len(addrs)-1-i
+	}
+	// the root doesn't depend on the order the accounts and slots were modified in
+	assert.BytesEqual(t, update(forward), update(backward))
+}
+
+func TestStateTree_DeleteEmpty(t *testing.T) {
+	user, touched, contract := common.Address{0x01}, common.Address{0x02}, common.Address{0x03}
+	update := func(deleteEmpty bool, touch bool) *StateTree {
+		st := NewStateTree(newTestStateDB(t), nil)
+		st.deleteEmpty = deleteEmpty
+		st.AddBalance(user, big.NewInt(100))
+		st.SetState(contract, ahash.SHA256Array([]byte("key")), []byte{0x01})
+		if touch {
+			st.AddBalance(touched, big.NewInt(0))
+		}
+		st.UpdateAll()
+		return st
+	}
+	// the empty account is kept before the fork
+	st := update(false, true)
+	if !st.Exist(touched) {
+		t.Fatal("want empty account kept")
+	}
+	if bytes.Equal(st.Root(), update(false, false).Root()) {
+		t.Fatal("want empty account in the root")
+	}
+	// and deleted after it, the accounts with storage stay
+	st = update(true, true)
+	if st.Exist(touched) {
+		t.Fatal("want empty account deleted")
+	}
+	if !st.Exist(contract) {
+		t.Fatal("want account with storage kept")
+	}
+	assert.BytesEqual(t, st.Root(), update(true, false).Root())
+	assert.Equal(t, st.Copy().deleteEmpty, true)
+
+	config := &ChainConfig{Forks: map[string]uint64{ForkDeleteEmptyAccounts: 10}}
+	assert.Equal(t, config.IsForkActive(ForkDeleteEmptyAccounts, 9), false)
+	assert.Equal(t, config.IsForkActive(ForkDeleteEmptyAccounts, 10), true)
+	assert.Equal(t, config.IsForkActive("unknown", 10), false)
+}
+
+func TestVerifyAccountProof(t *testing.T) {
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	for i := 1; i <= 20; i++ {
+		st.AddBalance(common.Bytes2Address([]byte{byte(i)}), big.NewInt(int64(i)))
+	}
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root := common.Bytes2Hash(st.Root())
+	st = NewStateTree(db, root.Bytes())
+	for i := 1; i <= 20; i++ {
+		addr := common.Bytes2Address([]byte{byte(i)})
+		proof, err := st.GetProof(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, err := VerifyAccountProof(root, addr, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.BigIntEqual(t, obj.GetBalance(), big.NewInt(int64(i)))
+		// a proof is only valid for its own account
+		other := common.Bytes2Address([]byte{byte(i%20 + 1)})
+		if obj, err = VerifyAccountProof(root, other, proof); err == nil && obj != nil {
+			t.Fatalf("proof of %d verified for another account", i)
+		}
+	}
+	missing := common.Bytes2Address([]byte{0xff})
+	proof, err := st.GetProof(missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := VerifyAccountProof(root, missing, proof)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, obj == nil, true)
+	// a tampered proof is rejected
+	proof[len(proof)-1] = append([]byte{}, proof[len(proof)-1]...)
+	proof[len(proof)-1][len(proof[len(proof)-1])-1] ^= 0xff
+	if _, err = VerifyAccountProof(root, missing, proof); err == nil {
+		t.Fatal("want error of tampered proof")
+	}
+}
@@ -59,6 +59,16 @@ const (
 	ERROR
 )
 
+// Profile selects the badger options tuned for the memory available to the node.
+type Profile int
+
+const (
+	DefaultProfile Profile = iota
+	// LowMemProfile keeps the memtables, value log files and caches small
+	// for devices with about 1GB of RAM.
+	LowMemProfile
+)
+
 var versionKey = []byte("version")
 
 type defaultLog struct {
@@ -110,11 +120,36 @@ func New(pathname string) (*Storage, error) {
 	return storage, nil
 }
 
+// NewWithProfile opens the storage with the badger options of the profile.
+func NewWithProfile(pathname string, profile Profile) (*Storage, error) {
+	return newByVersion(pathname, 0, profile)
+}
+
 func NewByVersion(pathname string, version uint32) (*Storage, error) {
+	return newByVersion(pathname, version, DefaultProfile)
+}
+
+func profileOptions(pathname string, profile Profile) badger.Options {
+	opts := badger.DefaultOptions(pathname)
+	if profile == LowMemProfile {
+		opts = opts.WithMemTableSize(8 << 20).
+			WithNumMemtables(2).
+			WithNumLevelZeroTables(2).
+			WithNumLevelZeroTablesStall(4).
+			WithBaseTableSize(2 << 20).
+			WithValueLogFileSize(64 << 20).
+			WithNumCompactors(2).
+			WithBlockCacheSize(8 << 20).
+			WithIndexCacheSize(4 << 20)
+	}
+	return opts
+}
+
+func newByVersion(pathname string, version uint32, profile Profile) (*Storage, error) {
 	storage := &Storage{
 		version: version,
 	}
-	opts := badger.DefaultOptions(pathname)
+	opts := profileOptions(pathname, profile)
 	opts.Logger = &defaultLog{}
 	var err error = nil
 	storage.db, err = badger.Open(opts)
@@ -139,7 +174,7 @@ func NewByVersion(pathname string, version uint32) (*Storage, error) {
 		if err != nil {
 			return nil, err
 		}
-		return NewByVersion(pathname, version)
+		return newByVersion(pathname, version, profile)
 	}
 	return storage, nil
 }
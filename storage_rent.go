@@ -0,0 +1,157 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rentStubLen is the length of a rent stub: the root of the evicted storage followed by
+// its number of slots.
+const rentStubLen = 32 + 8
+
+var ErrInvalidStorageRent = errors.New("invalid storage rent")
+
+// rentStubKey is the storage slot holding the stub of the evicted storage of a contract.
+var rentStubKey = ahash.SHA256Array([]byte("storage_rent_stub"))
+
+// StorageRent is an experimental rent of the contract storage for test networks. At the
+// end of every epoch from the block at Height on, the contracts pay SlotRent per slot of
+// their storage from their balance, the rent is burned. The storage of a contract whose
+// balance doesn't cover the rent is evicted, it is replaced by a stub holding the root
+// of the evicted storage. The storage is restored at the end of the first epoch whose
+// rent of the evicted slots the balance covers again, keeping the slots written since.
+type StorageRent struct {
+	Height   uint64   `json:"height"`
+	Epoch    uint64   `json:"epoch"`
+	SlotRent *big.Int `json:"slot_rent"`
+}
+
+// Verify checks that the epoch and the rent of the slots are set.
+func (r *StorageRent) Verify() error {
+	if r.Epoch == 0 || r.SlotRent == nil || r.SlotRent.Sign() <= 0 {
+		return ErrInvalidStorageRent
+	}
+	return nil
+}
+
+// epochEnd reports whether the rent is charged at the end of the block at the height.
+func (r *StorageRent) epochEnd(height uint64) bool {
+	return height >= r.Height && (height-r.Height+1)%r.Epoch == 0
+}
+
+func (r *StorageRent) cost(slots uint64) *big.Int {
+	return new(big.Int).Mul(r.SlotRent, new(big.Int).SetUint64(slots))
+}
+
+// chargeStorageRent charges the rent of the storage of the contracts at the end of an epoch.
+func chargeStorageRent(rent *StorageRent, stateTree *StateTree, height uint64) {
+	if !rent.epochEnd(height) {
+		return
+	}
+	stateTree.UpdateAll()
+	contracts := make([]common.Address, 0)
+	err := stateTree.ForEachAccount(func(obj *StateObj) bool {
+		if obj.codeHash != common.HashZ && obj.stateRoot != common.HashZ {
+			contracts = append(contracts, obj.address)
+		}
+		return true
+	})
+	if err != nil {
+		logrus.Warnf("Failed to charge storage rent: height=%d, err=%s", height, err)
+		return
+	}
+	// the objects are changed directly, the tree is locked like by its writers
+	stateTree.mu.Lock()
+	defer stateTree.mu.Unlock()
+	for _, addr := range contracts {
+		obj := stateTree.getStateObj(addr)
+		if stub := obj.GetStateValue(rentStubKey); len(stub) == rentStubLen {
+			cost := rent.cost(binary.BigEndian.Uint64(stub[32:]))
+			if obj.SubBalance(cost) == nil {
+				obj.restoreStorage(common.Bytes2Hash(stub[:32]))
+			}
+			continue
+		}
+		var slots uint64
+		obj.IterateStorage(nil, func([]byte, []byte) bool {
+			slots++
+			return true
+		})
+		if obj.SubBalance(rent.cost(slots)) == nil {
+			continue
+		}
+		if err = obj.evictStorage(slots); err != nil {
+			logrus.Warnf("Failed to evict storage: height=%d, address=%s, err=%s", height, addr.B58String(), err)
+		}
+	}
+}
+
+// evictStorage replaces the storage of the account by the stub of the evicted storage,
+// the storage must be updated. The evicted storage is committed, it is restored from the db.
+func (so *StateObj) evictStorage(slots uint64) error {
+	if err := so.commitStorage(); err != nil {
+		return err
+	}
+	stub := make([]byte, rentStubLen)
+	copy(stub, so.stateRoot[:])
+	binary.BigEndian.PutUint64(stub[32:], slots)
+	so.resetStorage(common.Hash{})
+	so.SetState(rentStubKey, stub)
+	return nil
+}
+
+// restoreStorage restores the evicted storage with the root, the slots written since the
+// eviction are written to the restored storage. The storage must be updated.
+func (so *StateObj) restoreStorage(root common.Hash) {
+	type slot struct {
+		key, value []byte
+	}
+	stubKey := so.makeStateKey(rentStubKey)
+	written := make([]slot, 0)
+	so.IterateStorage(nil, func(key []byte, value []byte) bool {
+		if !bytes.Equal(key, stubKey) {
+			written = append(written, slot{key: key, value: value})
+		}
+		return true
+	})
+	so.resetStorage(root)
+	if len(written) > 0 {
+		tree := so.getStateTree()
+		for _, s := range written {
+			tree.Put(s.key, s.value)
+		}
+		so.stateRoot = common.Bytes2Hash(tree.Checksum())
+		so.storageUpdated = true
+	}
+}
+
+func (so *StateObj) resetStorage(root common.Hash) {
+	so.stateRoot = root
+	so.storageTree = nil
+	so.storageUpdated = false
+	so.cacheStorage = make(map[[32]byte][]byte)
+	so.dirtyStorage = make(map[[32]byte]struct{})
+	so.markDirty()
+}
@@ -0,0 +1,68 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+func TestChargeStorageRent(t *testing.T) {
+	db := newTestStateDB(t)
+	rent := &StorageRent{Epoch: 2, SlotRent: big.NewInt(100)}
+	if err := rent.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	contract, user := common.Address{0x01}, common.Address{0x02}
+	keys := [][32]byte{
+		ahash.SHA256Array([]byte("a")),
+		ahash.SHA256Array([]byte("b")),
+		ahash.SHA256Array([]byte("c")),
+	}
+	st := NewStateTree(db, nil)
+	st.SetCode(contract, []byte("contract code"))
+	for i, key := range keys[:2] {
+		st.SetState(contract, key, []byte{byte(i + 1)})
+	}
+	st.AddBalance(contract, big.NewInt(150))
+	st.SetState(user, keys[0], []byte{0x01})
+	// the rent is only charged at the end of an epoch
+	chargeStorageRent(rent, st, 0)
+	assert.BigIntEqual(t, st.GetBalance(contract), big.NewInt(150))
+	chargeStorageRent(rent, st, 1)
+	assert.BigIntEqual(t, st.GetBalance(contract), big.NewInt(150))
+	if st.GetStateValue(contract, keys[0]) != nil {
+		t.Fatal("want storage evicted")
+	}
+	assert.BytesEqual(t, st.GetStateValue(user, keys[0]), []byte{0x01})
+	st.SetState(contract, keys[2], []byte{0x03})
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	st = NewStateTree(db, st.Root())
+	chargeStorageRent(rent, st, 3)
+	if st.GetStateValue(contract, keys[0]) != nil {
+		t.Fatal("want storage evicted until the rent is paid")
+	}
+	st.AddBalance(contract, big.NewInt(100))
+	chargeStorageRent(rent, st, 5)
+	assert.BigIntEqual(t, st.GetBalance(contract), big.NewInt(50))
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// the restored storage keeps the slots written while evicted
+	st = NewStateTree(db, st.Root())
+	for i, key := range keys {
+		assert.BytesEqual(t, st.GetStateValue(contract, key), []byte{byte(i + 1)})
+	}
+	if st.GetStateValue(contract, rentStubKey) != nil {
+		t.Fatal("want stub removed")
+	}
+	chargeStorageRent(rent, st, 7)
+	if st.GetStateValue(contract, keys[0]) != nil {
+		t.Fatal("want storage evicted")
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+// Package devnet runs networks of in-process nodes for integration tests. The nodes
+// are connected by in-memory links whose latency, packet loss and partitions can be
+// configured, so tests can assert the chains converge once the network heals.
+package devnet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"xfsgo"
+	"xfsgo/backend"
+	"xfsgo/common"
+	"xfsgo/crypto"
+	"xfsgo/p2p/discover"
+	"xfsgo/storage/badger"
+)
+
+const (
+	// GenesisBits is the target of the devnet genesis block, every block hash meets
+	// it so blocks are sealed with the first nonce.
+	GenesisBits     = uint32(0xffffff20)
+	protocolVersion = uint32(0)
+	networkID       = uint32(100)
+	convergePoll    = 50 * time.Millisecond
+	// handshakeTimeout is longer than the timeout of the sync protocol handshake
+	handshakeTimeout = 5 * time.Second
+)
+
+var (
+	ErrUnknownNode   = errors.New("unknown node")
+	ErrNotConnected  = errors.New("nodes not connected")
+	ErrHandshake     = errors.New("handshake not completed")
+	ErrNotConverged  = errors.New("chains not converged")
+	errSealExhausted = errors.New("no nonce meets the target")
+)
+
+// Config configures a devnet.
+type Config struct {
+	// Nodes is the number of nodes of the network.
+	Nodes int
+	// DataDir is the directory the databases of the nodes are created in.
+	DataDir string
+	// Seed seeds the random packet loss and jitter of the links.
+	Seed int64
+}
+
+// Node is a node of a devnet.
+type Node struct {
+	index    int
+	info     *discover.Node
+	coinbase common.Address
+	stateDB  *badger.Storage
+	chainDB  *badger.Storage
+	extraDB  *badger.Storage
+	eventBus *xfsgo.EventBus
+	chain    *xfsgo.BlockChain
+	txPool   *xfsgo.TxPool
+	protocol *backend.SyncProtocol
+	mineLock sync.Mutex
+}
+
+// Network is a devnet of in-process nodes.
+type Network struct {
+	mu    sync.Mutex
+	seed  int64
+	nodes []*Node
+	links map[[2]int]*link
+	// cut holds the conditions of the links cut by the partitions
+	cut     map[[2]int]LinkConfig
+	groups  map[int]int
+	dropped uint64
+}
+
+func nodeID(index int) (id discover.NodeId) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(index))
+	sum := sha256.Sum256(buf[:])
+	for off := 0; off < len(id); {
+		off += copy(id[off:], sum[:])
+	}
+	return
+}
+
+func openDB(dir, name string) (*badger.Storage, error) {
+	return badger.New(filepath.Join(dir, name))
+}
+
+func newNode(index int, dir string) (*Node, error) {
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		index:    index,
+		info:     discover.NewNode(net.IPv4(127, 0, 0, 1), uint16(30000+index), uint16(30000+index), nodeID(index)),
+		coinbase: crypto.DefaultPubKey2Addr(key.PublicKey),
+		eventBus: xfsgo.NewEventBus(),
+	}
+	if err = n.open(dir); err != nil {
+		n.close()
+		return nil, err
+	}
+	n.txPool = xfsgo.NewTxPool(n.chain.CurrentStateTree, n.chain.LatestGasLimit,
+		common.DefaultGasPrice(), n.chain.ChainConfig(), n.eventBus)
+	n.protocol = backend.NewSyncProtocol(protocolVersion, networkID, n.chain, n.eventBus, n.txPool)
+	n.protocol.Start()
+	return n, nil
+}
+
+func (n *Node) open(dir string) (err error) {
+	if n.stateDB, err = openDB(dir, "state"); err != nil {
+		return err
+	}
+	if n.chainDB, err = openDB(dir, "chain"); err != nil {
+		return err
+	}
+	if n.extraDB, err = openDB(dir, "extra"); err != nil {
+		return err
+	}
+	if _, err = xfsgo.WriteTestGenesisBlock(GenesisBits, n.stateDB, n.chainDB); err != nil {
+		return err
+	}
+	n.chain, err = xfsgo.NewBlockChainN(n.stateDB, n.chainDB, n.extraDB, n.eventBus, false)
+	return err
+}
+
+func (n *Node) close() {
+	for _, db := range []*badger.Storage{n.stateDB, n.chainDB, n.extraDB} {
+		if db != nil {
+			_ = db.Close()
+		}
+	}
+}
+
+// Index returns the index of the node in the network.
+func (n *Node) Index() int {
+	return n.index
+}
+
+func (n *Node) BlockChain() *xfsgo.BlockChain {
+	return n.chain
+}
+
+func (n *Node) TxPool() *xfsgo.TxPool {
+	return n.txPool
+}
+
+// Head returns the header of the current block of the node.
+func (n *Node) Head() *xfsgo.BlockHeader {
+	return n.chain.CurrentBHeader()
+}
+
+// MineBlocks seals count blocks on the current block of the node and announces
+// them to the peers like the miner does.
+func (n *Node) MineBlocks(count int) error {
+	n.mineLock.Lock()
+	defer n.mineLock.Unlock()
+	for i := 0; i < count; i++ {
+		block, stateTree, err := n.sealBlock(n.chain.CurrentBHeader())
+		if err != nil {
+			return err
+		}
+		if err = n.chain.WriteBlockWithState(block, stateTree); err != nil {
+			return err
+		}
+		n.eventBus.Publish(xfsgo.NewMinedBlockEvent{Block: block})
+	}
+	return nil
+}
+
+func (n *Node) sealBlock(parent *xfsgo.BlockHeader) (*xfsgo.Block, *xfsgo.StateTree, error) {
+	timestamp := uint64(time.Now().Unix())
+	if minTime := n.chain.MinimumTimestamp(parent); timestamp < minTime {
+		timestamp = minTime
+	}
+	header := &xfsgo.BlockHeader{
+		Height:        parent.Height + 1,
+		HashPrevBlock: parent.HeaderHash(),
+		Timestamp:     timestamp,
+		Coinbase:      n.coinbase,
+		GasLimit:      common.CalcGasLimit(parent.GasLimit, common.TxPoolGasLimit),
+		GasUsed:       new(big.Int),
+	}
+	var err error
+	if header.Bits, err = n.chain.CalcNextRequiredBitsByHeight(parent.Height); err != nil {
+		return nil, nil, err
+	}
+	stateTree := xfsgo.NewStateTree(n.stateDB, parent.StateRoot.Bytes())
+	n.chain.AccumulateRewards(stateTree, header)
+	stateTree.UpdateAll()
+	header.StateRoot = common.Bytes2Hash(stateTree.Root())
+	block := xfsgo.NewBlock(header, nil, nil)
+	target := xfsgo.BitsUnzip(header.Bits)
+	for nonce := uint32(0); nonce < ^uint32(0); nonce++ {
+		block.UpdateNonce(nonce)
+		hash := block.HeaderHash()
+		if new(big.Int).SetBytes(hash[:]).Cmp(target) <= 0 {
+			return block, stateTree, nil
+		}
+	}
+	return nil, nil, errSealExhausted
+}
+
+// NewNetwork creates a network of unconnected nodes sharing the devnet genesis block.
+func NewNetwork(config *Config) (*Network, error) {
+	if config.Nodes <= 0 {
+		return nil, fmt.Errorf("invalid number of nodes: %d", config.Nodes)
+	}
+	nw := &Network{
+		seed:  config.Seed,
+		links: make(map[[2]int]*link),
+		cut:   make(map[[2]int]LinkConfig),
+	}
+	for i := 0; i < config.Nodes; i++ {
+		n, err := newNode(i, filepath.Join(config.DataDir, fmt.Sprintf("node%d", i)))
+		if err != nil {
+			nw.Stop()
+			return nil, err
+		}
+		nw.nodes = append(nw.nodes, n)
+	}
+	return nw, nil
+}
+
+// Nodes returns the nodes of the network.
+func (nw *Network) Nodes() []*Node {
+	return nw.nodes
+}
+
+// Node returns the node with the given index, or nil if there is no such node.
+func (nw *Network) Node(i int) *Node {
+	if i < 0 || i >= len(nw.nodes) {
+		return nil
+	}
+	return nw.nodes[i]
+}
+
+func linkKey(i, j int) [2]int {
+	if i > j {
+		i, j = j, i
+	}
+	return [2]int{i, j}
+}
+
+// Connect links the nodes i and j and waits until the sync protocol completed the
+// handshake on both ends, connecting nodes that are already linked only updates the
+// link conditions. Nodes separated by a partition are linked when it is healed.
+func (nw *Network) Connect(i, j int, config LinkConfig) error {
+	if nw.Node(i) == nil || nw.Node(j) == nil || i == j {
+		return ErrUnknownNode
+	}
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	key := linkKey(i, j)
+	if l, exists := nw.links[key]; exists {
+		l.setConfig(config)
+		return nil
+	}
+	if nw.partitioned(i, j) {
+		nw.cut[key] = config
+		return nil
+	}
+	return nw.connect(key, config)
+}
+
+func (nw *Network) connect(key [2]int, config LinkConfig) error {
+	a, b := nw.nodes[key[0]], nw.nodes[key[1]]
+	l := newLink(a.info, b.info, config, nw.seed+int64(key[0]*len(nw.nodes)+key[1]))
+	nw.links[key] = l
+	go func() {
+		_ = a.protocol.Run(l.a)
+	}()
+	go func() {
+		_ = b.protocol.Run(l.b)
+	}()
+	deadline := time.Now().Add(handshakeTimeout)
+	for !a.protocol.HasPeer(b.info.ID) || !b.protocol.HasPeer(a.info.ID) {
+		if time.Now().After(deadline) {
+			return ErrHandshake
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+func (nw *Network) disconnect(key [2]int) {
+	l := nw.links[key]
+	l.close()
+	nw.dropped += l.droppedMessages()
+	delete(nw.links, key)
+}
+
+// ConnectAll links every pair of nodes.
+func (nw *Network) ConnectAll(config LinkConfig) error {
+	for i := range nw.nodes {
+		for j := i + 1; j < len(nw.nodes); j++ {
+			if err := nw.Connect(i, j, config); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Disconnect closes the link between the nodes i and j.
+func (nw *Network) Disconnect(i, j int) error {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	key := linkKey(i, j)
+	if _, exists := nw.cut[key]; exists {
+		delete(nw.cut, key)
+		return nil
+	}
+	if _, exists := nw.links[key]; !exists {
+		return ErrNotConnected
+	}
+	nw.disconnect(key)
+	return nil
+}
+
+// SetLink changes the conditions of the link between the nodes i and j.
+func (nw *Network) SetLink(i, j int, config LinkConfig) error {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	key := linkKey(i, j)
+	if _, exists := nw.cut[key]; exists {
+		nw.cut[key] = config
+		return nil
+	}
+	l, exists := nw.links[key]
+	if !exists {
+		return ErrNotConnected
+	}
+	l.setConfig(config)
+	return nil
+}
+
+func (nw *Network) partitioned(i, j int) bool {
+	if nw.groups == nil {
+		return false
+	}
+	gi, iok := nw.groups[i]
+	gj, jok := nw.groups[j]
+	return !iok || !jok || gi != gj
+}
+
+// Partition splits the network into the given groups of nodes. The links between
+// nodes of different groups are cut like broken connections, so the nodes drop each
+// other as peers. Nodes in none of the groups are isolated.
+func (nw *Network) Partition(groups ...[]int) error {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.groups = make(map[int]int)
+	for g, group := range groups {
+		for _, i := range group {
+			nw.groups[i] = g
+		}
+	}
+	for key, l := range nw.links {
+		if nw.partitioned(key[0], key[1]) {
+			nw.cut[key] = l.linkConfig()
+			nw.disconnect(key)
+		}
+	}
+	return nw.reconnect()
+}
+
+// Heal removes the partitions of the network and restores the cut links.
+func (nw *Network) Heal() error {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.groups = nil
+	return nw.reconnect()
+}
+
+// reconnect restores the cut links which are no longer partitioned.
+func (nw *Network) reconnect() error {
+	for key, config := range nw.cut {
+		if nw.partitioned(key[0], key[1]) {
+			continue
+		}
+		delete(nw.cut, key)
+		if err := nw.connect(key, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of messages dropped by packet loss.
+func (nw *Network) Dropped() uint64 {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	total := nw.dropped
+	for _, l := range nw.links {
+		total += l.droppedMessages()
+	}
+	return total
+}
+
+// Converged reports whether all nodes have the same current block.
+func (nw *Network) Converged() bool {
+	if len(nw.nodes) == 0 {
+		return true
+	}
+	head := nw.nodes[0].Head().HeaderHash()
+	for _, n := range nw.nodes[1:] {
+		h := n.Head().HeaderHash()
+		if !bytes.Equal(head[:], h[:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitConverged waits until all nodes have the same current block.
+func (nw *Network) WaitConverged(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !nw.Converged() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s", ErrNotConverged, nw.heads())
+		}
+		time.Sleep(convergePoll)
+	}
+	return nil
+}
+
+func (nw *Network) heads() string {
+	heads := make([]string, 0, len(nw.nodes))
+	for _, n := range nw.nodes {
+		head := n.Head()
+		hash := head.HeaderHash()
+		heads = append(heads, fmt.Sprintf("node%d=%d/%x", n.index, head.Height, hash[len(hash)-4:]))
+	}
+	return strings.Join(heads, ", ")
+}
+
+// Stop closes the links and the databases of the nodes.
+func (nw *Network) Stop() {
+	nw.mu.Lock()
+	for key := range nw.links {
+		nw.disconnect(key)
+	}
+	nw.mu.Unlock()
+	for _, n := range nw.nodes {
+		n.close()
+	}
+}
@@ -0,0 +1,116 @@
+package devnet
+
+import (
+	"testing"
+	"time"
+	"xfsgo/p2p/discover"
+)
+
+func newTestNetwork(t *testing.T, nodes int) *Network {
+	nw, err := NewNetwork(&Config{
+		Nodes:   nodes,
+		DataDir: t.TempDir(),
+		Seed:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nw.Stop)
+	return nw
+}
+
+func mine(t *testing.T, n *Node, count int) {
+	if err := n.MineBlocks(count); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitSameHead(t *testing.T, a, b *Node, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for a.Head().HeaderHash() != b.Head().HeaderHash() {
+		if time.Now().After(deadline) {
+			t.Fatalf("node%d and node%d not converged: %d, %d",
+				a.Index(), b.Index(), a.Head().Height, b.Head().Height)
+		}
+		time.Sleep(convergePoll)
+	}
+}
+
+func TestLink_delivery(t *testing.T) {
+	a := discover.NewNode(nil, 0, 0, nodeID(0))
+	b := discover.NewNode(nil, 0, 0, nodeID(1))
+	l := newLink(a, b, LinkConfig{Latency: 20 * time.Millisecond}, 1)
+	defer l.close()
+	if got := l.a.ID(); got != b.ID {
+		t.Fatalf("want peer id of remote node")
+	}
+	start := time.Now()
+	for i := uint8(0); i < 3; i++ {
+		if err := l.a.WriteMessage(i, []byte{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := uint8(0); i < 3; i++ {
+		select {
+		case msg := <-l.b.inbox:
+			if msg.Type() != i {
+				t.Fatalf("want message %d, got %d", i, msg.Type())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("message delivered before latency")
+	}
+	l.setConfig(LinkConfig{Loss: 1})
+	if err := l.a.WriteMessage(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.droppedMessages(); got != 1 {
+		t.Fatalf("want 1 dropped message, got %d", got)
+	}
+	l.close()
+	if _, err := l.a.GetProtocolMsgCh(); err == nil {
+		t.Fatal("want error of closed link")
+	}
+}
+
+func TestNetwork_PartitionConverges(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping devnet test in short mode")
+	}
+	nw := newTestNetwork(t, 4)
+	link := LinkConfig{Latency: 10 * time.Millisecond, Jitter: 5 * time.Millisecond}
+	if err := nw.ConnectAll(link); err != nil {
+		t.Fatal(err)
+	}
+	mine(t, nw.Node(0), 3)
+	if err := nw.WaitConverged(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := nw.Partition([]int{0, 1}, []int{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	mine(t, nw.Node(0), 2)
+	mine(t, nw.Node(2), 4)
+	waitSameHead(t, nw.Node(0), nw.Node(1), 30*time.Second)
+	waitSameHead(t, nw.Node(2), nw.Node(3), 30*time.Second)
+	if nw.Converged() {
+		t.Fatal("partitioned network converged")
+	}
+	if err := nw.Heal(); err != nil {
+		t.Fatal(err)
+	}
+	// the next block announces the longer chain to the other partition
+	mine(t, nw.Node(2), 1)
+	if err := nw.WaitConverged(60 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	want := nw.Node(2).Head()
+	for _, n := range nw.Nodes() {
+		if got := n.Head(); got.Height != 8 || got.HeaderHash() != want.HeaderHash() {
+			t.Fatalf("node%d: want head %d, got %d", n.Index(), want.Height, got.Height)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package devnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
+)
+
+const (
+	inboxSize = 1024
+	// idleWait is how long a peer waits for a message when its inbox is empty,
+	// the sync protocol polls the inbox and would spin on idle peers otherwise.
+	idleWait = 5 * time.Millisecond
+)
+
+// LinkConfig configures the conditions of a link between two nodes.
+type LinkConfig struct {
+	// Latency delays every message, Jitter adds a random delay up to its value.
+	Latency time.Duration
+	Jitter  time.Duration
+	// Loss is the probability a message is dropped, between 0 and 1.
+	Loss float64
+}
+
+type message struct {
+	mType     uint8
+	data      []byte
+	deliverAt time.Time
+}
+
+func (m *message) Type() uint8 {
+	return m.mType
+}
+
+func (m *message) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (m *message) ReadAll() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *message) RawReader() io.Reader {
+	return bytes.NewReader(m.data)
+}
+
+func (m *message) DataReader() io.Reader {
+	return bytes.NewReader(m.data)
+}
+
+// link connects two nodes with an in-memory transport in both directions.
+type link struct {
+	mu      sync.Mutex
+	config  LinkConfig
+	random  *rand.Rand
+	a, b    *memPeer
+	closed  chan struct{}
+	once    sync.Once
+	dropped uint64
+}
+
+func newLink(a, b *discover.Node, config LinkConfig, seed int64) *link {
+	l := &link{
+		config: config,
+		random: rand.New(rand.NewSource(seed)),
+		closed: make(chan struct{}),
+	}
+	// a peer is the local end of the connection to the remote node
+	l.a = newMemPeer(l, b)
+	l.b = newMemPeer(l, a)
+	l.a.remote, l.b.remote = l.b, l.a
+	go l.a.deliverLoop()
+	go l.b.deliverLoop()
+	return l
+}
+
+func (l *link) setConfig(config LinkConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config
+}
+
+func (l *link) linkConfig() LinkConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.config
+}
+
+// delay returns the delay of a message, ok is false if the message is dropped.
+func (l *link) delay() (d time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.config.Loss > 0 && l.random.Float64() < l.config.Loss {
+		atomic.AddUint64(&l.dropped, 1)
+		return 0, false
+	}
+	d = l.config.Latency
+	if l.config.Jitter > 0 {
+		d += time.Duration(l.random.Int63n(int64(l.config.Jitter)))
+	}
+	return d, true
+}
+
+func (l *link) droppedMessages() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+func (l *link) close() {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+}
+
+// memPeer implements p2p.Peer on one end of a link.
+type memPeer struct {
+	link   *link
+	node   *discover.Node
+	remote *memPeer
+	// outbox holds the messages sent to the remote peer until they are due
+	outbox chan *message
+	inbox  chan p2p.MessageReader
+}
+
+func newMemPeer(l *link, remote *discover.Node) *memPeer {
+	return &memPeer{
+		link:   l,
+		node:   remote,
+		outbox: make(chan *message, inboxSize),
+		inbox:  make(chan p2p.MessageReader, inboxSize),
+	}
+}
+
+func (p *memPeer) Is(flag int) bool {
+	return false
+}
+
+// ID returns the id of the remote node like the peers of the p2p server do.
+func (p *memPeer) ID() discover.NodeId {
+	return p.node.ID
+}
+
+func (p *memPeer) RemoteNode() *discover.Node {
+	return p.node
+}
+
+func (p *memPeer) RemoteAddr() *net.TCPAddr {
+	return p.node.TcpAddr()
+}
+
+func (p *memPeer) Close() {
+	p.link.close()
+}
+
+func (p *memPeer) Run() {}
+
+func (p *memPeer) WriteMessage(mType uint8, data []byte) error {
+	select {
+	case <-p.link.closed:
+		return io.EOF
+	default:
+	}
+	d, ok := p.link.delay()
+	if !ok {
+		return nil
+	}
+	msg := &message{
+		mType:     mType,
+		data:      append([]byte{}, data...),
+		deliverAt: time.Now().Add(d),
+	}
+	select {
+	case p.outbox <- msg:
+		return nil
+	case <-p.link.closed:
+		return io.EOF
+	}
+}
+
+func (p *memPeer) WriteMessageObj(mType uint8, data interface{}) error {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return p.WriteMessage(mType, bs)
+}
+
+func (p *memPeer) GetProtocolMsgCh() (chan p2p.MessageReader, error) {
+	if len(p.inbox) == 0 {
+		timer := time.NewTimer(idleWait)
+		select {
+		case <-p.link.closed:
+			timer.Stop()
+			return nil, io.EOF
+		case <-timer.C:
+		}
+	}
+	select {
+	case <-p.link.closed:
+		return nil, io.EOF
+	default:
+	}
+	return p.inbox, nil
+}
+
+// deliverLoop hands the sent messages to the remote peer in order once they are due.
+func (p *memPeer) deliverLoop() {
+	for {
+		select {
+		case <-p.link.closed:
+			return
+		case msg := <-p.outbox:
+			if wait := time.Until(msg.deliverAt); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-p.link.closed:
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+			select {
+			case p.remote.inbox <- msg:
+			case <-p.link.closed:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package vectors
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/crypto"
+)
+
+// testKey derives the key of a test account from its index, so the generated vectors
+// are the same on every run.
+func testKey(i int) *ecdsa.PrivateKey {
+	seed := ahash.SHA256([]byte(fmt.Sprintf("xfsgo test vector key %d", i)))
+	der := append([]byte{crypto.DefaultKeyPackVersion, 1}, seed...)
+	_, key, err := crypto.DecodePrivateKey(der)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func testAddr(i int) common.Address {
+	return crypto.DefaultPubKey2Addr(testKey(i).PublicKey)
+}
+
+func b58(addr common.Address) string {
+	return addr.B58String()
+}
+
+var (
+	coin        = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	vectorEnv   = &Env{Height: 1, Timestamp: 1600000000, Coinbase: common.Address{0x01}, GasLimit: common.GenesisGasLimit.Text(10), Forks: vectorForks}
+	vectorPrice = big.NewInt(10)
+	// vectorForks are the forks active in the vectors
+	vectorForks = map[string]uint64{
+		xfsgo.ForkCodeStore:      0,
+		xfsgo.ForkAccountExtra:   0,
+		xfsgo.ForkContractCall:   0,
+		xfsgo.ForkNegativeValue:  0,
+		xfsgo.ForkReceiptVMError: 0,
+		xfsgo.ForkVMFixes:        0,
+		xfsgo.ForkTxSizeLimits:   0,
+	}
+)
+
+type txParams struct {
+	key      int
+	to       common.Address
+	value    *big.Int
+	gasLimit *big.Int
+	nonce    uint64
+	data     []byte
+}
+
+func signTx(p txParams) *xfsgo.Transaction {
+	gasLimit := p.gasLimit
+	if gasLimit == nil {
+		gasLimit = common.TxGas
+	}
+	value := p.value
+	if value == nil {
+		value = new(big.Int)
+	}
+	tx := xfsgo.NewTransactionByStd(&xfsgo.StdTransaction{
+		Version:  0,
+		To:       p.to,
+		GasPrice: vectorPrice,
+		GasLimit: gasLimit,
+		Data:     p.data,
+		Nonce:    p.nonce,
+		Value:    value,
+	})
+	if err := tx.SignWithPrivateKey(testKey(p.key)); err != nil {
+		panic(err)
+	}
+	return tx
+}
+
+func funded(balance *big.Int) *Account {
+	return &Account{Balance: balance.Text(10)}
+}
+
+// cases returns the vectors without their expected results.
+func cases() []*Vector {
+	sender, receiver := testAddr(0), testAddr(1)
+	storageKey := ahash.SHA256([]byte("slot"))
+	return []*Vector{
+		{
+			Name: "transfer",
+			Pre:  map[string]*Account{b58(sender): funded(coin)},
+			Transaction: signTx(txParams{
+				to:    receiver,
+				value: big.NewInt(1000),
+			}),
+		},
+		{
+			Name: "transfer_existing_account",
+			Pre: map[string]*Account{
+				b58(sender):   {Balance: coin.Text(10), Nonce: 3},
+				b58(receiver): {Balance: "5", Extra: encodeHex([]byte("receiver"))},
+			},
+			Transaction: signTx(txParams{
+				to:    receiver,
+				value: big.NewInt(1000),
+				nonce: 3,
+			}),
+		},
+		{
+			Name: "transfer_to_contract_with_storage",
+			Pre: map[string]*Account{
+				b58(sender): funded(coin),
+				b58(receiver): {
+					Balance: "0",
+					Code:    encodeHex([]byte("hello, world")),
+					Storage: map[string]string{encodeHex(storageKey): encodeHex([]byte("value"))},
+				},
+			},
+			Transaction: signTx(txParams{
+				to:    receiver,
+				value: big.NewInt(1),
+			}),
+		},
+		{
+			Name: "transfer_value_exceeds_balance",
+			Pre: map[string]*Account{
+				b58(sender): funded(new(big.Int).Add(
+					new(big.Int).Mul(common.TxGas, vectorPrice), big.NewInt(10))),
+			},
+			Transaction: signTx(txParams{
+				to:    receiver,
+				value: big.NewInt(11),
+			}),
+		},
+		{
+			Name:        "gas_exceeds_balance",
+			Pre:         map[string]*Account{b58(sender): funded(big.NewInt(100))},
+			Transaction: signTx(txParams{to: receiver, value: big.NewInt(1)}),
+		},
+		{
+			Name: "nonce_too_high",
+			Pre:  map[string]*Account{b58(sender): funded(coin)},
+			Transaction: signTx(txParams{
+				to:    receiver,
+				value: big.NewInt(1),
+				nonce: 1,
+			}),
+		},
+		{
+			Name: "intrinsic_gas_too_low",
+			Pre:  map[string]*Account{b58(sender): funded(coin)},
+			Transaction: signTx(txParams{
+				to:       receiver,
+				value:    big.NewInt(1),
+				gasLimit: new(big.Int).Sub(common.TxGas, common.Big1),
+			}),
+		},
+		{
+			Name: "set_extra",
+			Pre:  map[string]*Account{b58(sender): funded(coin)},
+			Transaction: signTx(txParams{
+				to:       sender,
+				data:     []byte("pool tag"),
+				gasLimit: big.NewInt(100000),
+			}),
+		},
+		{
+			Name: "create_contract",
+			Pre:  map[string]*Account{b58(sender): funded(coin)},
+			Transaction: signTx(txParams{
+				data:     []byte("hello, world"),
+				gasLimit: big.NewInt(100000),
+			}),
+		},
+	}
+}
+
+// Generate returns the state transition vectors with the results of this implementation.
+func Generate() ([]*Vector, error) {
+	vectors := cases()
+	for _, v := range vectors {
+		env := *vectorEnv
+		v.Env = &env
+		expect, err := v.Execute()
+		if err != nil {
+			return nil, fmt.Errorf("vector %s: %v", v.Name, err)
+		}
+		v.Expect = expect
+	}
+	return vectors, nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+// Package vectors generates and runs JSON test vectors of the state transition function.
+// A vector holds the state before a transaction, the transaction and the state root, gas
+// and receipt expected after it, so other implementations can check they agree on
+// consensus and changes of the state transition are caught.
+package vectors
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/test"
+)
+
+// Account is an account of the state before the transaction. Extra, code, storage keys
+// and values are hex encoded.
+type Account struct {
+	Balance string            `json:"balance"`
+	Nonce   uint64            `json:"nonce,omitempty"`
+	Extra   string            `json:"extra,omitempty"`
+	Code    string            `json:"code,omitempty"`
+	Storage map[string]string `json:"storage,omitempty"`
+}
+
+// Env is the block the transaction is included in.
+type Env struct {
+	Height    uint64         `json:"height"`
+	Timestamp uint64         `json:"timestamp"`
+	Coinbase  common.Address `json:"coinbase"`
+	GasLimit  string         `json:"gas_limit"`
+	// Forks holds the activation heights of the rule changes of the chain by name.
+	Forks map[string]uint64 `json:"forks,omitempty"`
+	// Randomness is the randomness of the contracts of the block, the chain mixes it from
+	// the headers before the block.
+	Randomness common.Hash `json:"randomness"`
+}
+
+// Expect is the result of the transaction. A transaction making the block invalid has
+// an error and leaves the state unchanged.
+type Expect struct {
+	StateRoot common.Hash    `json:"state_root"`
+	GasUsed   string         `json:"gas_used"`
+	Receipt   *xfsgo.Receipt `json:"receipt,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// Vector is a test of the state transition of one transaction. The accounts of the
+// pre-state are keyed by their base58 encoded address.
+type Vector struct {
+	Name        string              `json:"name"`
+	Env         *Env                `json:"env"`
+	Pre         map[string]*Account `json:"pre"`
+	Transaction *xfsgo.Transaction  `json:"transaction"`
+	Expect      *Expect             `json:"expect"`
+}
+
+func decodeHex(s string) ([]byte, error) {
+	if len(s) > 1 && s[0] == '0' && s[1] == 'x' {
+		s = s[2:]
+	}
+	return hex.DecodeString(s)
+}
+
+func encodeHex(bs []byte) string {
+	if len(bs) == 0 {
+		return ""
+	}
+	return "0x" + hex.EncodeToString(bs)
+}
+
+// config returns the config of the chain the transaction is applied on.
+func (v *Vector) config() *xfsgo.ChainConfig {
+	return &xfsgo.ChainConfig{Forks: v.Env.Forks}
+}
+
+// preState builds the state tree of the accounts in address order.
+func (v *Vector) preState() (*xfsgo.StateTree, error) {
+	st := xfsgo.NewStateTree(test.NewMemStorage(), nil)
+	st.SetForkRules(v.config(), v.Env.Height)
+	addrs := make([]string, 0, len(v.Pre))
+	for addr := range v.Pre {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, b58 := range addrs {
+		if err := common.AddrCalibrator(b58); err != nil {
+			return nil, fmt.Errorf("pre-state address %s: %v", b58, err)
+		}
+		account := v.Pre[b58]
+		addr := common.B58ToAddress([]byte(b58))
+		balance, ok := new(big.Int).SetString(account.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("pre-state balance of %s: %s", b58, account.Balance)
+		}
+		obj := st.GetOrNewStateObj(addr)
+		obj.SetBalance(balance)
+		obj.SetNonce(account.Nonce)
+		if account.Extra != "" {
+			extra, err := decodeHex(account.Extra)
+			if err != nil {
+				return nil, err
+			}
+			if err = obj.SetExtra(extra); err != nil {
+				return nil, err
+			}
+		}
+		if account.Code != "" {
+			code, err := decodeHex(account.Code)
+			if err != nil {
+				return nil, err
+			}
+			obj.SetCode(code)
+		}
+		for k, val := range account.Storage {
+			key, err := decodeHex(k)
+			if err != nil || len(key) != 32 {
+				return nil, fmt.Errorf("pre-state storage key of %s: %s", b58, k)
+			}
+			value, err := decodeHex(val)
+			if err != nil {
+				return nil, err
+			}
+			var slot [32]byte
+			copy(slot[:], key)
+			obj.SetState(slot, value)
+		}
+	}
+	st.UpdateAll()
+	return st, nil
+}
+
+// Execute applies the transaction of the vector to its pre-state and returns the result.
+func (v *Vector) Execute() (*Expect, error) {
+	if v.Env == nil || v.Transaction == nil {
+		return nil, errors.New("vector without env or transaction")
+	}
+	gasLimit, ok := new(big.Int).SetString(v.Env.GasLimit, 10)
+	if !ok {
+		return nil, fmt.Errorf("env gas limit: %s", v.Env.GasLimit)
+	}
+	st, err := v.preState()
+	if err != nil {
+		return nil, err
+	}
+	preRoot := common.Bytes2Hash(st.Root())
+	header := &xfsgo.BlockHeader{
+		Height:    v.Env.Height,
+		Timestamp: v.Env.Timestamp,
+		Coinbase:  v.Env.Coinbase,
+		GasLimit:  gasLimit,
+		GasUsed:   new(big.Int),
+	}
+	gp := (*xfsgo.GasPool)(new(big.Int).Set(gasLimit))
+	gasUsed := new(big.Int)
+	receipt, err := xfsgo.ApplyTransaction(v.config(), v.Env.Randomness, st, header, v.Transaction, gp, gasUsed)
+	if err != nil {
+		return &Expect{
+			StateRoot: preRoot,
+			GasUsed:   "0",
+			Error:     err.Error(),
+		}, nil
+	}
+	st.UpdateAll()
+	return &Expect{
+		StateRoot: common.Bytes2Hash(st.Root()),
+		GasUsed:   gasUsed.Text(10),
+		Receipt:   receipt,
+	}, nil
+}
+
+// Check executes the vector and compares the result with the expected one.
+func (v *Vector) Check() error {
+	got, err := v.Execute()
+	if err != nil {
+		return err
+	}
+	want := v.Expect
+	if want == nil {
+		return errors.New("vector without expect")
+	}
+	if got.Error != want.Error {
+		return fmt.Errorf("error mismatch: want %q, got %q", want.Error, got.Error)
+	}
+	if got.StateRoot != want.StateRoot {
+		return fmt.Errorf("state root mismatch: want %x, got %x", want.StateRoot, got.StateRoot)
+	}
+	if got.GasUsed != want.GasUsed {
+		return fmt.Errorf("gas used mismatch: want %s, got %s", want.GasUsed, got.GasUsed)
+	}
+	gotReceipt, _ := json.Marshal(got.Receipt)
+	wantReceipt, _ := json.Marshal(want.Receipt)
+	if string(gotReceipt) != string(wantReceipt) {
+		return fmt.Errorf("receipt mismatch: want %s, got %s", wantReceipt, gotReceipt)
+	}
+	return nil
+}
+
+// Read reads the vectors of a JSON array.
+func Read(r io.Reader) ([]*Vector, error) {
+	var vectors []*Vector
+	if err := json.NewDecoder(r).Decode(&vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// Write writes the vectors as an indented JSON array.
+func Write(w io.Writer, vectors []*Vector) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(vectors)
+}
+
+// Result is the outcome of a vector run by Run.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Run checks every vector and returns the results in order.
+func Run(vectors []*Vector) []*Result {
+	results := make([]*Result, len(vectors))
+	for i, v := range vectors {
+		results[i] = &Result{Name: v.Name, Err: v.Check()}
+	}
+	return results
+}
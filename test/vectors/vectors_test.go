@@ -0,0 +1,62 @@
+package vectors
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testdataFile = "testdata/state_transition.json"
+
+func TestRun_testdata(t *testing.T) {
+	f, err := os.Open(testdataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	vectors, err := Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("no vectors")
+	}
+	for _, r := range Run(vectors) {
+		if r.Err != nil {
+			t.Errorf("vector %s: %v", r.Name, r.Err)
+		}
+	}
+}
+
+func TestGenerate_matchesTestdata(t *testing.T) {
+	vectors, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = Write(&buf, vectors); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(testdataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("generated vectors differ from %s", testdataFile)
+	}
+}
+
+func TestCheck_mismatch(t *testing.T) {
+	vectors, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := vectors[0]
+	v.Expect.GasUsed = "1"
+	if err = v.Check(); err == nil {
+		t.Fatal("want gas used mismatch")
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	otlpBatchSize     = 512
+	otlpQueueSize     = 4096
+	otlpFlushInterval = 5 * time.Second
+	otlpTracesPath    = "/v1/traces"
+	// span kinds and status codes of the OTLP protocol
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+// OTLPExporter exports spans in batches to an OTLP/HTTP collector using the JSON encoding.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	queue       chan *Span
+	quit        chan struct{}
+	done        chan struct{}
+}
+
+// NewOTLPExporter creates an exporter sending the spans to the collector at endpoint,
+// the traces path is appended if the endpoint has no path.
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.Contains(strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://"), "/") {
+		endpoint += otlpTracesPath
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "http://" + endpoint
+	}
+	e := &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan *Span, otlpQueueSize),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// Export queues the spans, spans are dropped when the queue is full.
+func (e *OTLPExporter) Export(spans []*Span) error {
+	for _, span := range spans {
+		select {
+		case e.queue <- span:
+		default:
+		}
+	}
+	return nil
+}
+
+// Stop flushes the queued spans and stops the exporter.
+func (e *OTLPExporter) Stop() {
+	close(e.quit)
+	<-e.done
+}
+
+func (e *OTLPExporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		_ = e.send(batch)
+		batch = make([]*Span, 0, otlpBatchSize)
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.quit:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []*Span) error {
+	data, err := json.Marshal(encodeOTLP(e.serviceName, spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: %s", resp.Status)
+	}
+	return nil
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func encodeAttributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, otlpAttribute{Key: k, Value: otlpValue{StringValue: attrs[k]}})
+	}
+	return result
+}
+
+func encodeOTLP(serviceName string, spans []*Span) *otlpRequest {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "xfsgo"
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        encodeAttributes(s.Attributes),
+		}
+		if s.ParentID.IsValid() {
+			span.ParentSpanID = s.ParentID.String()
+		}
+		if s.Err != nil {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+		}
+		s.mu.Unlock()
+		scope.Spans = append(scope.Spans, span)
+	}
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = encodeAttributes(map[string]string{"service.name": serviceName})
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
@@ -0,0 +1,228 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+// Package trace implements request tracing. Spans carry the trace ID of the request
+// they belong to and are handed to an exporter when they end.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// Exporter sends ended spans to a tracing backend.
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// Span is a timed operation of a trace.
+type Span struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Err        error
+	mu         sync.Mutex
+	ended      bool
+}
+
+type spanKey struct{}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter
+)
+
+// SetExporter sets the exporter ended spans are sent to, spans are only recorded
+// when an exporter is set.
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+func currentExporter() Exporter {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return exporter
+}
+
+func randomBytes(b []byte) {
+	_, _ = rand.Read(b)
+}
+
+// NewTraceID returns a random trace ID.
+func NewTraceID() (id TraceID) {
+	randomBytes(id[:])
+	return
+}
+
+func newSpanID() (id SpanID) {
+	randomBytes(id[:])
+	return
+}
+
+// Start starts a span with the given name. The span is a child of the span in ctx,
+// or of the remote parent set by ContextWithRemoteParent, otherwise a new trace is started.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	span := &Span{
+		SpanID: newSpanID(),
+		Name:   name,
+		Start:  time.Now(),
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = NewTraceID()
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the current span of ctx.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent returns a context whose spans continue the trace of a
+// remote caller.
+func ContextWithRemoteParent(ctx context.Context, traceID TraceID, parentID SpanID) context.Context {
+	return context.WithValue(ctx, spanKey{}, &Span{
+		TraceID: traceID,
+		SpanID:  parentID,
+		ended:   true,
+	})
+}
+
+// TraceIDFromContext returns the trace ID of the current span of ctx.
+func TraceIDFromContext(ctx context.Context) string {
+	if span := FromContext(ctx); span != nil {
+		return span.TraceID.String()
+	}
+	return ""
+}
+
+// SetName renames the span.
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Name = name
+}
+
+// SetAttribute sets an attribute describing the operation of the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = fmt.Sprint(value)
+}
+
+// SetError marks the operation of the span as failed.
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err
+}
+
+// Finish ends the span and exports it, ending a span again has no effect.
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	if e := currentExporter(); e != nil {
+		_ = e.Export([]*Span{s})
+	}
+}
+
+// Duration returns the duration of an ended span.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Traceparent returns the W3C trace context header value identifying the span.
+func (s *Span) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
+
+// ParseTraceparent parses a W3C trace context header value.
+func ParseTraceparent(h string) (traceID TraceID, parentID SpanID, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+	tid, err := hex.DecodeString(parts[1])
+	if err != nil || len(tid) != len(traceID) {
+		return
+	}
+	pid, err := hex.DecodeString(parts[2])
+	if err != nil || len(pid) != len(parentID) {
+		return
+	}
+	copy(traceID[:], tid)
+	copy(parentID[:], pid)
+	return traceID, parentID, traceID.IsValid() && parentID.IsValid()
+}
+
+// ParseTraceID parses a trace ID given as 32 hex characters.
+func ParseTraceID(s string) (id TraceID, ok bool) {
+	bs, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(bs) != len(id) {
+		return
+	}
+	copy(id[:], bs)
+	return id, id.IsValid()
+}
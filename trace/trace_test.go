@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"xfsgo/assert"
+)
+
+type testExporter struct {
+	spans []*Span
+}
+
+func (e *testExporter) Export(spans []*Span) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestStart(t *testing.T) {
+	exporter := new(testExporter)
+	SetExporter(exporter)
+	defer SetExporter(nil)
+	ctx, root := Start(context.Background(), "root")
+	_, child := Start(ctx, "child")
+	assert.Equal(t, child.TraceID, root.TraceID)
+	assert.Equal(t, child.ParentID, root.SpanID)
+	child.SetError(errors.New("failed"))
+	child.Finish()
+	root.Finish()
+	root.Finish()
+	assert.Equal(t, len(exporter.spans), 2)
+	assert.Equal(t, exporter.spans[0].Name, "child")
+	assert.Equal(t, TraceIDFromContext(ctx), root.TraceID.String())
+}
+
+func TestParseTraceparent(t *testing.T) {
+	_, span := Start(context.Background(), "span")
+	traceID, parentID, ok := ParseTraceparent(span.Traceparent())
+	assert.Equal(t, ok, true)
+	assert.Equal(t, traceID, span.TraceID)
+	assert.Equal(t, parentID, span.SpanID)
+	_, _, ok = ParseTraceparent("00-00000000000000000000000000000000-0000000000000000-01")
+	assert.Equal(t, ok, false)
+	_, _, ok = ParseTraceparent("invalid")
+	assert.Equal(t, ok, false)
+
+	ctx := ContextWithRemoteParent(context.Background(), traceID, parentID)
+	_, child := Start(ctx, "child")
+	assert.Equal(t, child.TraceID, traceID)
+	assert.Equal(t, child.ParentID, parentID)
+}
+
+func TestEncodeOTLP(t *testing.T) {
+	_, span := Start(context.Background(), "span")
+	span.SetAttribute("height", 1)
+	span.SetError(errors.New("failed"))
+	span.Finish()
+	req := encodeOTLP("xfsgo", []*Span{span})
+	got := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, got.TraceID, span.TraceID.String())
+	assert.Equal(t, got.ParentSpanID, "")
+	assert.Equal(t, got.Attributes[0].Value.StringValue, "1")
+	assert.Equal(t, got.Status.Code, otlpStatusError)
+}
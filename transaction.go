@@ -22,12 +22,14 @@ import (
 	"crypto/ecdsa"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"sort"
 	"strconv"
 	"xfsgo/common"
 	"xfsgo/common/ahash"
+	"xfsgo/common/rawencode"
 	"xfsgo/crypto"
 
 	"github.com/sirupsen/logrus"
@@ -45,8 +47,15 @@ type Transaction struct {
 	Nonce     uint64         `json:"nonce"`
 	Value     *big.Int       `json:"value"`
 	Signature []byte         `json:"signature"`
+	// fields added by later transaction versions
+	trailing []rawencode.Field
 }
 
+// TxEncodingVersion is the latest transaction version whose fields are all known.
+const TxEncodingVersion = version0
+
+type transactionJSON Transaction
+
 type StdTransaction struct {
 	Version   uint32         `json:"version"`
 	To        common.Address `json:"to"`
@@ -150,8 +159,35 @@ func (t *Transaction) Encode() ([]byte, error) {
 	return json.Marshal(t)
 }
 
+// Decode decodes a stored transaction, unknown fields are handled like in BlockHeader.Decode.
 func (t *Transaction) Decode(data []byte) error {
-	return json.Unmarshal(data, t)
+	return t.decode(data, true)
+}
+
+func (t *Transaction) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*transactionJSON)(t))
+	if err != nil {
+		return nil, err
+	}
+	return rawencode.AppendFields(data, t.trailing)
+}
+
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	return t.decode(data, false)
+}
+
+func (t *Transaction) decode(data []byte, strict bool) error {
+	tx := new(transactionJSON)
+	if err := json.Unmarshal(data, tx); err != nil {
+		return err
+	}
+	trailing, err := decodeTrailingFields(data, tx, tx.Version > TxEncodingVersion, strict)
+	if err != nil {
+		return err
+	}
+	*t = Transaction(*tx)
+	t.trailing = trailing
+	return nil
 }
 
 func (t *Transaction) Hash() common.Hash {
@@ -228,6 +264,29 @@ func (t *Transaction) SignHash() common.Hash {
 	return common.Bytes2Hash(ahash.SHA256([]byte(enc)))
 }
 
+// Size returns the number of bytes of the canonical encoding of the transaction.
+func (t *Transaction) Size() int {
+	data, err := t.Encode()
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// Fee returns the most the sender pays for the gas of the transaction.
+func (t *Transaction) Fee() *big.Int {
+	return new(big.Int).Mul(t.GasLimit, t.GasPrice)
+}
+
+// FeePerByte returns the fee of the transaction divided by its size.
+func (t *Transaction) FeePerByte() *big.Int {
+	size := t.Size()
+	if size == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(t.Fee(), big.NewInt(int64(size)))
+}
+
 func (t *Transaction) Cost() *big.Int {
 	i := big.NewInt(0)
 	i.Mul(t.GasLimit, t.GasPrice)
@@ -304,7 +363,77 @@ func (s *TxByPrice) Pop() interface{} {
 	return x
 }
 
+// TxByFeePerByte implements the heap interface ordering the transactions by the fee
+// paid per byte of their encoding, the sizes are computed once when pushed.
+type TxByFeePerByte struct {
+	txs   Transactions
+	sizes map[*Transaction]int64
+}
+
+func (s *TxByFeePerByte) Len() int { return len(s.txs) }
+func (s *TxByFeePerByte) Less(i, j int) bool {
+	// compare fee_i / size_i with fee_j / size_j without the rounding of a division
+	a := new(big.Int).Mul(s.txs[i].Fee(), big.NewInt(s.sizes[s.txs[j]]))
+	b := new(big.Int).Mul(s.txs[j].Fee(), big.NewInt(s.sizes[s.txs[i]]))
+	return a.Cmp(b) > 0
+}
+func (s *TxByFeePerByte) Swap(i, j int) { s.txs[i], s.txs[j] = s.txs[j], s.txs[i] }
+
+func (s *TxByFeePerByte) Push(x interface{}) {
+	tx := x.(*Transaction)
+	if s.sizes == nil {
+		s.sizes = make(map[*Transaction]int64)
+	}
+	s.sizes[tx] = int64(tx.Size())
+	s.txs = append(s.txs, tx)
+}
+
+func (s *TxByFeePerByte) Pop() interface{} {
+	old := s.txs
+	n := len(old)
+	x := old[n-1]
+	s.txs = old[0 : n-1]
+	delete(s.sizes, x)
+	return x
+}
+
+const (
+	// TxOrderGasPrice selects the transactions of a block by gas price
+	TxOrderGasPrice = "gasprice"
+	// TxOrderFeePerByte selects the transactions of a block by the fee paid per byte
+	TxOrderFeePerByte = "feeperbyte"
+)
+
+var ErrUnknownTxOrder = errors.New("unknown transaction order")
+
+// VerifyTxOrder checks the order is known, the empty order is TxOrderGasPrice.
+func VerifyTxOrder(order string) error {
+	switch order {
+	case "", TxOrderGasPrice, TxOrderFeePerByte:
+		return nil
+	}
+	return ErrUnknownTxOrder
+}
+
+// SortTransactions sorts the transactions by the order keeping the nonce order of the
+// transactions of each account.
+func SortTransactions(txs []*Transaction, order string) {
+	if order == TxOrderFeePerByte {
+		SortByFeePerByteAndNonce(txs)
+		return
+	}
+	SortByPriceAndNonce(txs)
+}
+
 func SortByPriceAndNonce(txs []*Transaction) {
+	sortByBestAndNonce(txs, new(TxByPrice))
+}
+
+func SortByFeePerByteAndNonce(txs []*Transaction) {
+	sortByBestAndNonce(txs, new(TxByFeePerByte))
+}
+
+func sortByBestAndNonce(txs []*Transaction, best heap.Interface) {
 	// Separate the transactions by account and sort by nonce
 	byNonce := make(map[common.Address][]*Transaction)
 	for _, tx := range txs {
@@ -314,27 +443,25 @@ func SortByPriceAndNonce(txs []*Transaction) {
 	for _, accTxs := range byNonce {
 		sort.Sort(TxByNonce(accTxs))
 	}
-	// Initialize a price based heap with the head transactions
-	byPrice := make(TxByPrice, 0, len(byNonce))
+	// Initialize the heap with the head transactions
 	for acc, accTxs := range byNonce {
-		byPrice = append(byPrice, accTxs[0])
+		heap.Push(best, accTxs[0])
 		byNonce[acc] = accTxs[1:]
 	}
-	heap.Init(&byPrice)
 
 	// Merge by replacing the best with the next from the same account
 	txs = txs[:0]
-	for len(byPrice) > 0 {
-		// Retrieve the next best transaction by price
-		best := heap.Pop(&byPrice).(*Transaction)
+	for best.Len() > 0 {
+		// Retrieve the next best transaction
+		tx := heap.Pop(best).(*Transaction)
 
 		// Push in its place the next transaction from the same account
-		acc, _ := best.FromAddr() // we only sort valid txs so this cannot fail
+		acc, _ := tx.FromAddr() // we only sort valid txs so this cannot fail
 		if accTxs, ok := byNonce[acc]; ok && len(accTxs) > 0 {
-			heap.Push(&byPrice, accTxs[0])
+			heap.Push(best, accTxs[0])
 			byNonce[acc] = accTxs[1:]
 		}
-		// Accumulate the best priced transaction
-		txs = append(txs, best)
+		// Accumulate the best transaction
+		txs = append(txs, tx)
 	}
 }
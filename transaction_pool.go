@@ -28,6 +28,9 @@ import (
 
 const (
 	maxQueued = 64 // max limit of queued txs per address
+	// txPriceBump is the minimum gas price increase in percent to replace a transaction
+	// of the same sender and nonce.
+	txPriceBump = 10
 )
 
 var (
@@ -38,11 +41,44 @@ var (
 	nonceErr         = errors.New("nonce too low")
 	balanceErr       = errors.New("account not enough balance")
 	gasLimitErr      = errors.New("gas limit too low")
+	extraSizeErr     = errors.New("extra data too large")
+
+	replaceUnderpricedErr = errors.New("replacement transaction underpriced")
 )
 
+// NonceTooLowError is returned for a transaction using a nonce the account already used.
+type NonceTooLowError struct {
+	Address common.Address
+	// Expected is the next nonce of the account after its pending transactions.
+	Expected uint64
+	Given    uint64
+}
+
+func (e *NonceTooLowError) Error() string {
+	return fmt.Sprintf("%s: expected %d, given %d", nonceErr, e.Expected, e.Given)
+}
+
+// InsufficientFundsError is returned for a transaction costing more than the balance
+// available to the sender.
+type InsufficientFundsError struct {
+	Address   common.Address
+	Required  *big.Int
+	Available *big.Int
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("%s: required %s, available %s", balanceErr, e.Required, e.Available)
+}
+
 type stateFn func() *StateTree
 type gasLimitFn func() *big.Int
 
+// TxValidator is an admission policy of the tx pool, like an allowlist of the senders of
+// a consortium chain. It is called with the current state for the transactions passing
+// the checks of the pool, the transaction is rejected when it returns an error. It runs
+// while the pool is locked and must not call the methods of the pool.
+type TxValidator func(tx *Transaction, state *StateTree) error
+
 // TxPool contains all currently known transactions. Transactions
 // enter the pool when they are received from the network or submitted
 // locally. They exit the pool when they are included in the blockchain.
@@ -58,24 +94,27 @@ type TxPool struct {
 	mu           sync.RWMutex
 	gasLimitFn   gasLimitFn // The current gas limit function callback
 	minGasPrice  *big.Int
+	config       *ChainConfig                 // The config of the chain of the pool
 	pending      map[common.Hash]*Transaction // processable transactions
 	queue        map[common.Address]map[common.Hash]*Transaction
+	validators   []TxValidator // admission validators run in the order they were added
 }
 
 // NewTxPool creates a new transaction pool to gather, sort and filter inbound
 // transactions from the network.
-func NewTxPool(currentStateFn stateFn, gasLimitFn gasLimitFn, gasPrice *big.Int, eventBus *EventBus) *TxPool {
+func NewTxPool(currentStateFn stateFn, gasLimitFn gasLimitFn, gasPrice *big.Int, config *ChainConfig, eventBus *EventBus) *TxPool {
 	pool := &TxPool{
 		pending:      make(map[common.Hash]*Transaction),
 		queue:        make(map[common.Address]map[common.Hash]*Transaction),
 		quit:         make(chan bool),
 		gasLimitFn:   gasLimitFn,
 		minGasPrice:  gasPrice,
+		config:       config,
 		currentState: currentStateFn,
 		pendingState: NewManageState(currentStateFn()),
 	}
 	pool.eventBus = eventBus
-	go pool.eventLoop()
+	go Supervise("txpool", DefaultRestartPolicy, pool.eventLoop)
 	return pool
 }
 
@@ -87,21 +126,110 @@ func (pool *TxPool) GetGasPrice() *big.Int {
 	return pool.minGasPrice
 }
 
+// AddValidator registers an admission validator, it is run for the transactions added
+// to the pool afterwards.
+func (pool *TxPool) AddValidator(validator TxValidator) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.validators = append(pool.validators, validator)
+}
+
+// admit runs the admission validators on the transaction with the state it was checked on.
+func (pool *TxPool) admit(tx *Transaction, state *StateTree) error {
+	for _, validator := range pool.validators {
+		if err := validator(tx, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SubscribeEvents returns a subscription to the TxPoolEvent of the pool.
+func (pool *TxPool) SubscribeEvents() *Subscription {
+	return pool.eventBus.Subscript(TxPoolEvent{})
+}
+
 func (pool *TxPool) add(tx *Transaction) error {
 	txHash := tx.Hash()
 	if pool.pending[txHash] != nil {
 		return fmt.Errorf("know transaction (%s)", txHash.Hex())
 	}
-	if err := pool.validateTx(tx); err != nil {
+	state := pool.currentState()
+	if err := pool.validateTx(tx, state); err != nil {
+		reason := TxDropInvalid
+		if err == gasPriceErr {
+			reason = TxDropUnderpriced
+		}
+		pool.postDropped(tx, reason, err)
 		return err
 	}
+	if err := pool.admit(tx, state); err != nil {
+		pool.postDropped(tx, TxDropRejected, err)
+		return err
+	}
+	from, _ := tx.FromAddr()
+	if old := pool.sameNonceTx(from, tx.Nonce); old != nil {
+		oldHash := old.Hash()
+		if oldHash == txHash {
+			return fmt.Errorf("know transaction (%s)", txHash.Hex())
+		}
+		if tx.GasPrice.Cmp(replacementPrice(old)) < 0 {
+			pool.postDropped(tx, TxDropUnderpriced, replaceUnderpricedErr)
+			return replaceUnderpricedErr
+		}
+		pool.RemoveTx(oldHash)
+		go pool.eventBus.Publish(TxPoolEvent{Kind: TxPoolReplaced, Tx: old, ReplacedBy: txHash})
+	}
 	// pool.pending[txHash] = tx
 	pool.appendQueueTx(txHash, tx)
 	go pool.eventBus.Publish(TxPreEvent{Tx: tx})
+	go pool.eventBus.Publish(TxPoolEvent{Kind: TxPoolAccepted, Tx: tx})
+	return nil
+}
+
+// replacementPrice returns the minimum gas price of a transaction replacing the old one.
+func replacementPrice(old *Transaction) *big.Int {
+	threshold := new(big.Int).Mul(old.GasPrice, big.NewInt(100+txPriceBump))
+	return threshold.Div(threshold, big.NewInt(100))
+}
+
+// sameNonceTx returns the pending or queued transaction of the sender using the nonce.
+func (pool *TxPool) sameNonceTx(from common.Address, nonce uint64) *Transaction {
+	for _, tx := range pool.queue[from] {
+		if tx.Nonce == nonce {
+			return tx
+		}
+	}
+	for _, tx := range pool.pending {
+		if tx.Nonce != nonce {
+			continue
+		}
+		if addr, err := tx.FromAddr(); err == nil && addr.Equals(from) {
+			return tx
+		}
+	}
 	return nil
 }
 
-func (pool *TxPool) validateTx(tx *Transaction) error {
+// postDropped notifies the subscribers the transaction was dropped for the reason.
+func (pool *TxPool) postDropped(tx *Transaction, reason string, err error) {
+	event := TxPoolEvent{Kind: TxPoolDropped, Tx: tx, Reason: reason}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	go pool.eventBus.Publish(event)
+}
+
+// postExpired notifies the subscribers the transaction was dropped because its nonce
+// was used, unless it is one of the included transactions.
+func (pool *TxPool) postExpired(hash common.Hash, tx *Transaction, included map[common.Hash]struct{}) {
+	if _, ok := included[hash]; ok {
+		return
+	}
+	pool.postDropped(tx, TxDropExpired, nonceErr)
+}
+
+func (pool *TxPool) validateTx(tx *Transaction, state *StateTree) error {
 	var (
 		from common.Address
 		err  error
@@ -114,13 +242,13 @@ func (pool *TxPool) validateTx(tx *Transaction) error {
 		return invalidSenderErr
 	}
 	logrus.Debugf("Validation transaction: hash=%x, from=%s", tx.Hash(), from.B58String())
-	if !pool.currentState().HashAccount(from) {
-		return balanceErr
+	if !state.HashAccount(from) {
+		return &InsufficientFundsError{Address: from, Required: tx.Cost(), Available: new(big.Int)}
 	}
 
 	// Last but not least check for nonce errors
-	if pool.currentState().GetNonce(from) > tx.Nonce {
-		return nonceErr
+	if state.GetNonce(from) > tx.Nonce {
+		return &NonceTooLowError{Address: from, Expected: pool.pendingState.GetNonce(from), Given: tx.Nonce}
 	}
 
 	// Check the transaction doesn't exceed the current
@@ -132,10 +260,20 @@ func (pool *TxPool) validateTx(tx *Transaction) error {
 	if tx.Value.Sign() < 0 {
 		return valueErr
 	}
-	if pool.currentState().GetBalance(from).Cmp(tx.Cost()) < 0 {
-		return balanceErr
+	if err = pool.config.VerifyTxSize(tx); err != nil {
+		return err
+	}
+	if balance := state.GetBalance(from); balance.Cmp(tx.Cost()) < 0 {
+		return &InsufficientFundsError{Address: from, Required: tx.Cost(), Available: new(big.Int).Set(balance)}
+	}
+	intrGas := common.CalcTxInitialCost(tx.Data)
+	if TxSetsExtra(tx, from) {
+		if len(tx.Data) > common.MaxExtraSize {
+			return extraSizeErr
+		}
+		intrGas.Add(intrGas, common.CalcExtraGas(tx.Data))
 	}
-	if tx.GasLimit.Cmp(common.CalcTxInitialCost(tx.Data)) < 0 {
+	if tx.GasLimit.Cmp(intrGas) < 0 {
 		return gasLimitErr
 	}
 	return nil
@@ -144,8 +282,9 @@ func (pool *TxPool) validateTx(tx *Transaction) error {
 // validatePool checks entire the pending trsactions in the tx pool
 // whether they are valid according to the consensus
 // rules and adheres to some limits of the local node (price and size).
-
-func (pool *TxPool) validatePool() {
+// The included transactions are the ones of the new head block, they leave the
+// pool without being reported as dropped.
+func (pool *TxPool) validatePool(included map[common.Hash]struct{}) {
 	//get the current state of the  tx pool
 	state := pool.currentState()
 	// traversals all peeding transactions
@@ -154,11 +293,12 @@ func (pool *TxPool) validatePool() {
 		from, _ := tx.FromAddr()
 		if state.GetNonce(from) > tx.Nonce {
 			delete(pool.pending, hash)
+			pool.postExpired(hash, tx, included)
 		}
 	}
 }
 
-func (pool *TxPool) checkQueue() {
+func (pool *TxPool) checkQueue(included map[common.Hash]struct{}) {
 	state := pool.pendingState
 
 	var addq txQueue
@@ -173,6 +313,7 @@ func (pool *TxPool) checkQueue() {
 				// Drop queued transactions whose nonce is lower than
 				// the account nonce because they have been processed.
 				delete(txs, hash)
+				pool.postExpired(hash, tx, included)
 			} else {
 				// Collect the remaining transactions for the next pass.
 				addq = append(addq, txQueueEntry{hash, address, tx})
@@ -185,6 +326,7 @@ func (pool *TxPool) checkQueue() {
 			// start deleting the transactions from the queue if they exceed the limit
 			if i > maxQueued {
 				delete(pool.queue[address], e.hash)
+				pool.postDropped(e.Transaction, TxDropQueueFull, nil)
 				continue
 			}
 
@@ -192,6 +334,7 @@ func (pool *TxPool) checkQueue() {
 				if len(addq)-i > maxQueued {
 					for j := i + maxQueued; j < len(addq); j++ {
 						delete(txs, addq[j].hash)
+						pool.postDropped(addq[j].Transaction, TxDropQueueFull, nil)
 					}
 				}
 				break
@@ -230,12 +373,12 @@ func (pool *TxPool) addTx(hash common.Hash, addr common.Address, tx *Transaction
 	}
 }
 
-func (pool *TxPool) resetState() {
+func (pool *TxPool) resetState(included map[common.Hash]struct{}) {
 	// reset state manager of peeding transactions
 	pool.pendingState = NewManageState(pool.currentState())
 
 	// check tx pool and update peeding queue
-	pool.validatePool()
+	pool.validatePool(included)
 
 	// Loop over the pending transactions and base the nonce of the new
 	// pending transaction set.
@@ -252,7 +395,7 @@ func (pool *TxPool) resetState() {
 
 	// Check the queue and move transactions over to the pending if possible
 	// or remove those that have become invalid
-	pool.checkQueue()
+	pool.checkQueue(included)
 }
 
 func (pool *TxPool) Add(tx *Transaction) error {
@@ -261,7 +404,7 @@ func (pool *TxPool) Add(tx *Transaction) error {
 	err := pool.add(tx)
 	if err == nil {
 		// check and validate the queueue
-		pool.checkQueue()
+		pool.checkQueue(nil)
 	}
 	return err
 }
@@ -278,14 +421,9 @@ func (pool *TxPool) eventLoop() {
 	for {
 		select {
 		case e := <-chainHeadEventSub.Chan():
-			pool.mu.Lock()
 			// handle ChainHeadEvent
 			// update the state of tx pool when receive blockchain event to update the latest state
-			event := e.(ChainHeadEvent)
-			block := event.Block
-			_ = block
-			pool.resetState()
-			pool.mu.Unlock()
+			pool.handleChainHead(e.(ChainHeadEvent))
 		case e := <-GasPriceChangedSub.Chan():
 			event := e.(GasPriceChanged)
 			pool.mu.Lock()
@@ -296,11 +434,25 @@ func (pool *TxPool) eventLoop() {
 	}
 }
 
+// handleChainHead resets the pool on the state of the new head, the lock is released by
+// a deferred call so that a panic leaves the pool usable for the restarted event loop.
+func (pool *TxPool) handleChainHead(event ChainHeadEvent) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	included := make(map[common.Hash]struct{})
+	if block := event.Block; block != nil {
+		for _, tx := range block.Transactions {
+			included[tx.Hash()] = struct{}{}
+		}
+	}
+	pool.resetState(included)
+}
+
 func (pool *TxPool) GetTransactions() []*Transaction {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
-	pool.checkQueue()
-	pool.validatePool()
+	pool.checkQueue(nil)
+	pool.validatePool(nil)
 	txs := make([]*Transaction, 0)
 	for _, v := range pool.pending {
 		txs = append(txs, v)
@@ -323,8 +475,8 @@ func (pool *TxPool) GetQueues() []*Transaction {
 func (pool *TxPool) GetTransaction(tranHash string) *Transaction {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
-	pool.checkQueue()
-	pool.validatePool()
+	pool.checkQueue(nil)
+	pool.validatePool(nil)
 	for _, v := range pool.pending {
 		txhash := v.Hash()
 		tx := txhash.Hex()
@@ -341,6 +493,14 @@ func (pool *TxPool) State() *ManagedState {
 	return pool.pendingState
 }
 
+// PendingNonce returns the next nonce of the address after its pending transactions.
+func (pool *TxPool) PendingNonce(addr common.Address) uint64 {
+	// reading the managed state caches accounts, so readers are serialized
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.pendingState.GetNonce(addr)
+}
+
 // func (pool *TxPool) ModifyTranGas(gasLimit, gasPrice *big.Int, hash string) error {
 // 	tran := pool.GetTransaction(hash)
 // 	tran.GasLimit = gasLimit
@@ -348,6 +508,87 @@ func (pool *TxPool) State() *ManagedState {
 // 	return pool.Add(tran)
 // }
 
+// PendingCost returns the value and the maximum gas cost of the pending and queued
+// transactions sent by the address.
+func (pool *TxPool) PendingCost(addr common.Address) *big.Int {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	cost := new(big.Int)
+	for _, tx := range pool.pending {
+		if from, err := tx.FromAddr(); err == nil && from.Equals(addr) {
+			cost.Add(cost, tx.Cost())
+		}
+	}
+	for _, tx := range pool.queue[addr] {
+		cost.Add(cost, tx.Cost())
+	}
+	return cost
+}
+
+// PendingIncoming returns the value the pending transactions send to the address.
+func (pool *TxPool) PendingIncoming(addr common.Address) *big.Int {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	value := new(big.Int)
+	for _, tx := range pool.pending {
+		if tx.To.Equals(addr) {
+			value.Add(value, tx.Value)
+		}
+	}
+	return value
+}
+
+// SenderTx is a transaction of a sender waiting in the pool, with the gas price a
+// replacement of the same nonce has to pay.
+type SenderTx struct {
+	Tx *Transaction
+	// Queued transactions wait for a transaction of a lower nonce
+	Queued       bool
+	ReplacePrice *big.Int
+	// Replaceable reports whether the balance of the sender covers the replacement
+	// next to its other transactions
+	Replaceable bool
+}
+
+// GetPendingBySender returns the pending and queued transactions sent by the address
+// ordered by nonce.
+func (pool *TxPool) GetPendingBySender(addr common.Address) []*SenderTx {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	txs := make([]*SenderTx, 0)
+	for _, tx := range pool.pending {
+		if from, err := tx.FromAddr(); err == nil && from.Equals(addr) {
+			txs = append(txs, &SenderTx{Tx: tx})
+		}
+	}
+	for _, tx := range pool.queue[addr] {
+		txs = append(txs, &SenderTx{Tx: tx, Queued: true})
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].Tx.Nonce < txs[j].Tx.Nonce
+	})
+	var balance *big.Int
+	if pool.currentState != nil {
+		balance = pool.currentState().GetBalance(addr)
+	}
+	cost := new(big.Int)
+	for _, stx := range txs {
+		cost.Add(cost, stx.Tx.Cost())
+	}
+	for _, stx := range txs {
+		stx.ReplacePrice = replacementPrice(stx.Tx)
+		if balance == nil {
+			continue
+		}
+		replacement := new(big.Int).Mul(stx.Tx.GasLimit, stx.ReplacePrice)
+		replacement.Add(replacement, stx.Tx.Value)
+		required := new(big.Int).Sub(cost, stx.Tx.Cost())
+		required.Add(required, replacement)
+		stx.Replaceable = balance.Cmp(required) >= 0
+	}
+	return txs
+}
+
 func (pool *TxPool) GetTransactionsSize() int {
 	return len(pool.GetTransactions())
 }
@@ -358,6 +599,18 @@ func (pool *TxPool) RemoveTransactions(txs []*Transaction) {
 		pool.RemoveTx(tx.Hash())
 	}
 }
+
+// DropTransactions removes the transactions and notifies the subscribers they were
+// dropped for the reason.
+func (pool *TxPool) DropTransactions(txs []*Transaction, reason string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, tx := range txs {
+		pool.RemoveTx(tx.Hash())
+		pool.postDropped(tx, reason, nil)
+	}
+}
+
 func (pool *TxPool) RemoveTx(hash common.Hash) {
 	// delete from pending pool
 
@@ -387,3 +640,68 @@ type txQueueEntry struct {
 func (q txQueue) Len() int           { return len(q) }
 func (q txQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
 func (q txQueue) Less(i, j int) bool { return q[i].Nonce < q[j].Nonce }
+
+// FeeBucket groups the pending transactions paying the same gas price.
+type FeeBucket struct {
+	GasPrice *big.Int
+	Count    int
+	Gas      *big.Int
+	// CumulativeGas is the gas of this bucket and all the buckets paying more
+	CumulativeGas *big.Int
+}
+
+// FeeHistogram returns the pending transactions bucketed by gas price, from the highest
+// price to the lowest, together with the gas price a transaction using the given gas
+// needs to pay to fit in the next block.
+func (pool *TxPool) FeeHistogram(gas *big.Int) ([]*FeeBucket, *big.Int) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	buckets := make(map[string]*FeeBucket)
+	for _, tx := range pool.pending {
+		key := tx.GasPrice.Text(10)
+		bucket, exists := buckets[key]
+		if !exists {
+			bucket = &FeeBucket{
+				GasPrice: new(big.Int).Set(tx.GasPrice),
+				Gas:      new(big.Int),
+			}
+			buckets[key] = bucket
+		}
+		bucket.Count += 1
+		bucket.Gas.Add(bucket.Gas, tx.GasLimit)
+	}
+	histogram := make([]*FeeBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		histogram = append(histogram, bucket)
+	}
+	sort.Slice(histogram, func(i, j int) bool {
+		return histogram[i].GasPrice.Cmp(histogram[j].GasPrice) > 0
+	})
+	cumulative := new(big.Int)
+	for _, bucket := range histogram {
+		cumulative.Add(cumulative, bucket.Gas)
+		bucket.CumulativeGas = new(big.Int).Set(cumulative)
+	}
+	return histogram, pool.estimateGasPrice(histogram, gas)
+}
+
+// estimateGasPrice returns the lowest gas price for which the pending transactions paying
+// at least as much leave room for gas in the next block. Transactions paying the same price
+// are assumed to be included first.
+func (pool *TxPool) estimateGasPrice(histogram []*FeeBucket, gas *big.Int) *big.Int {
+	space := new(big.Int).Set(pool.gasLimitFn())
+	if gas != nil {
+		space.Sub(space, gas)
+	}
+	price := new(big.Int).Set(pool.minGasPrice)
+	for _, bucket := range histogram {
+		if bucket.CumulativeGas.Cmp(space) > 0 {
+			next := new(big.Int).Add(bucket.GasPrice, common.Big1)
+			if next.Cmp(price) > 0 {
+				price = next
+			}
+			break
+		}
+	}
+	return price
+}
@@ -4,6 +4,10 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+	"xfsgo/assert"
 	"xfsgo/common"
 	"xfsgo/crypto"
 	"xfsgo/test"
@@ -50,7 +54,7 @@ func setupTxPool() (*TxPool, *ecdsa.PrivateKey) {
 		return nil, nil
 	}
 
-	txPool := NewTxPool(bc.CurrentStateTree, bc.LatestGasLimit, test.TestTxPoolGasPrice, event)
+	txPool := NewTxPool(bc.CurrentStateTree, bc.LatestGasLimit, test.TestTxPoolGasPrice, bc.ChainConfig(), event)
 	return txPool, key
 }
 
@@ -188,3 +192,331 @@ func setupTxPool() (*TxPool, *ecdsa.PrivateKey) {
 //		t.Errorf("expected nonce to be %d, got %d", n+1, fn)
 //	}
 //}
+
+func TestTxPool_FeeHistogram(t *testing.T) {
+	pool := &TxPool{
+		pending:     make(map[common.Hash]*Transaction),
+		minGasPrice: big.NewInt(1),
+		gasLimitFn: func() *big.Int {
+			return big.NewInt(100000)
+		},
+	}
+	prices := []int64{10, 30, 20, 30, 10}
+	for i, price := range prices {
+		tx := NewTransactionByStd(&StdTransaction{
+			GasPrice: big.NewInt(price),
+			GasLimit: big.NewInt(25000),
+			Value:    new(big.Int),
+			Nonce:    uint64(i),
+		})
+		pool.pending[tx.Hash()] = tx
+	}
+	histogram, price := pool.FeeHistogram(big.NewInt(25000))
+	if len(histogram) != 3 {
+		t.Fatalf("got %d buckets, want 3", len(histogram))
+	}
+	wants := []struct {
+		price, count, cumulative int64
+	}{
+		{30, 2, 50000},
+		{20, 1, 75000},
+		{10, 2, 125000},
+	}
+	for i, want := range wants {
+		bucket := histogram[i]
+		if bucket.GasPrice.Int64() != want.price || int64(bucket.Count) != want.count ||
+			bucket.CumulativeGas.Int64() != want.cumulative {
+			t.Fatalf("bucket %d: got price=%s count=%d cumulative=%s", i,
+				bucket.GasPrice, bucket.Count, bucket.CumulativeGas)
+		}
+	}
+	if price.Int64() != 11 {
+		t.Fatalf("got price %s, want 11", price)
+	}
+	if _, price = pool.FeeHistogram(big.NewInt(75000)); price.Int64() != 31 {
+		t.Fatalf("got price %s, want 31", price)
+	}
+	pool.pending = make(map[common.Hash]*Transaction)
+	if _, price = pool.FeeHistogram(big.NewInt(25000)); price.Int64() != 1 {
+		t.Fatalf("got price %s, want 1", price)
+	}
+}
+
+func TestTxPool_PendingCost(t *testing.T) {
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	pool := &TxPool{
+		pending: make(map[common.Hash]*Transaction),
+		queue:   make(map[common.Address]map[common.Hash]*Transaction),
+	}
+	a := transaction("1", 0, nil, key)
+	b := transaction("2", 1, nil, key)
+	pool.pending[a.Hash()] = a
+	pool.appendQueueTx(b.Hash(), b)
+	want := new(big.Int).Add(a.Cost(), b.Cost())
+	if got := pool.PendingCost(addr); got.Cmp(want) != 0 {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got := pool.PendingCost(common.Address{}); got.Sign() != 0 {
+		t.Fatalf("got %s, want 0", got)
+	}
+	// the queued transaction is not counted as incoming
+	if got := pool.PendingIncoming(common.Address{}); got.Cmp(a.Value) != 0 {
+		t.Fatalf("got %s, want %s", got, a.Value)
+	}
+}
+
+func TestTxPool_GetPendingBySender(t *testing.T) {
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	newTx := func(nonce uint64) *Transaction {
+		tx := NewTransactionByStd(&StdTransaction{
+			To:       common.Address{},
+			GasPrice: big.NewInt(100),
+			GasLimit: common.TxGas,
+			Value:    big.NewInt(1000),
+			Nonce:    nonce,
+		})
+		_ = tx.SignWithPrivateKey(key)
+		return tx
+	}
+	st := NewStateTree(newTestStateDB(t), nil)
+	pool := &TxPool{
+		currentState: func() *StateTree { return st },
+		pending:      make(map[common.Hash]*Transaction),
+		queue:        make(map[common.Address]map[common.Hash]*Transaction),
+	}
+	a, b, c := newTx(0), newTx(1), newTx(3)
+	pool.pending[b.Hash()] = b
+	pool.pending[a.Hash()] = a
+	pool.appendQueueTx(c.Hash(), c)
+	// the balance covers the three transactions and a single speed-up
+	bump := new(big.Int).Mul(common.TxGas, big.NewInt(10))
+	balance := new(big.Int).Mul(a.Cost(), big.NewInt(3))
+	st.AddBalance(addr, balance.Add(balance, bump))
+
+	txs := pool.GetPendingBySender(addr)
+	if len(txs) != 3 {
+		t.Fatalf("got %d transactions, want 3", len(txs))
+	}
+	for i, want := range []*Transaction{a, b, c} {
+		if txs[i].Tx != want {
+			t.Fatalf("transaction %d: got nonce %d, want %d", i, txs[i].Tx.Nonce, want.Nonce)
+		}
+		assert.Equal(t, txs[i].Queued, want == c)
+		assert.BigIntEqual(t, txs[i].ReplacePrice, big.NewInt(110))
+		assert.Equal(t, txs[i].Replaceable, true)
+	}
+	st.SubBalance(addr, common.Big1)
+	if txs = pool.GetPendingBySender(addr); txs[0].Replaceable {
+		t.Fatalf("replacement beyond the balance reported replaceable")
+	}
+	if txs = pool.GetPendingBySender(common.Address{}); len(txs) != 0 {
+		t.Fatalf("got %d transactions, want 0", len(txs))
+	}
+}
+
+func TestTxPool_events(t *testing.T) {
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	db := newTestStateDB(t)
+	var root []byte
+	update := func(fn func(st *StateTree)) {
+		st := NewStateTree(db, root)
+		fn(st)
+		st.UpdateAll()
+		if err := st.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		root = st.Root()
+	}
+	update(func(st *StateTree) {
+		st.AddBalance(addr, common.NanoCoin2Atto(big.NewInt(1000000)))
+	})
+	// the state is reloaded since the managed state of the pool shares its objects
+	pool := NewTxPool(func() *StateTree { return NewStateTree(db, root) }, func() *big.Int {
+		return big.NewInt(1000000)
+	}, big.NewInt(10), MainNetChainConfig, NewEventBus())
+	sub := pool.SubscribeEvents()
+	defer sub.Unsubscribe()
+	newTx := func(price int64) *Transaction {
+		tx := NewTransactionByStd(&StdTransaction{
+			GasPrice: big.NewInt(price),
+			GasLimit: common.TxGas,
+			Value:    big.NewInt(1),
+		})
+		_ = tx.SignWithPrivateKey(key)
+		return tx
+	}
+	events := func(n int) map[string]TxPoolEvent {
+		got := make(map[string]TxPoolEvent)
+		for i := 0; i < n; i++ {
+			select {
+			case e := <-sub.Chan():
+				event := e.(TxPoolEvent)
+				got[event.Kind] = event
+			case <-time.After(time.Second):
+				t.Fatalf("got %d events, want %d", i, n)
+			}
+		}
+		return got
+	}
+	a := newTx(100)
+	if err = pool.Add(a); err != nil {
+		t.Fatal(err)
+	}
+	got := events(1)
+	assert.Equal(t, got[TxPoolAccepted].Tx, a)
+
+	if err = pool.Add(newTx(105)); err != replaceUnderpricedErr {
+		t.Fatalf("got err %v, want %v", err, replaceUnderpricedErr)
+	}
+	got = events(1)
+	assert.Equal(t, got[TxPoolDropped].Reason, TxDropUnderpriced)
+
+	b := newTx(110)
+	if err = pool.Add(b); err != nil {
+		t.Fatal(err)
+	}
+	got = events(2)
+	assert.Equal(t, got[TxPoolReplaced].Tx, a)
+	assert.Equal(t, got[TxPoolReplaced].ReplacedBy, b.Hash())
+	assert.Equal(t, got[TxPoolAccepted].Tx, b)
+	if txs := pool.GetTransactions(); len(txs) != 1 || txs[0] != b {
+		t.Fatalf("want replacement pending")
+	}
+
+	if err = pool.Add(newTx(5)); err != gasPriceErr {
+		t.Fatalf("got err %v, want %v", err, gasPriceErr)
+	}
+	got = events(1)
+	assert.Equal(t, got[TxPoolDropped].Reason, TxDropUnderpriced)
+
+	update(func(st *StateTree) {
+		st.AddNonce(addr, 1)
+	})
+	pool.mu.Lock()
+	pool.resetState(nil)
+	pool.mu.Unlock()
+	got = events(1)
+	assert.Equal(t, got[TxPoolDropped].Tx, b)
+	assert.Equal(t, got[TxPoolDropped].Reason, TxDropExpired)
+
+	err = pool.Add(newTx(100))
+	assert.Equal(t, err, error(&NonceTooLowError{Address: addr, Expected: 1, Given: 0}))
+	costly := NewTransactionByStd(&StdTransaction{
+		GasPrice: big.NewInt(100),
+		GasLimit: common.TxGas,
+		Value:    common.NanoCoin2Atto(big.NewInt(1000000)),
+		Nonce:    1,
+	})
+	_ = costly.SignWithPrivateKey(key)
+	err = pool.Add(costly)
+	fundsErr, ok := err.(*InsufficientFundsError)
+	if !ok {
+		t.Fatalf("got err %v, want insufficient funds", err)
+	}
+	assert.BigIntEqual(t, fundsErr.Required, costly.Cost())
+	assert.BigIntEqual(t, fundsErr.Available, common.NanoCoin2Atto(big.NewInt(1000000)))
+}
+
+func TestTxPool_AddValidator(t *testing.T) {
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	db := newTestStateDB(t)
+	st := NewStateTree(db, nil)
+	st.AddBalance(addr, common.NanoCoin2Atto(big.NewInt(1000000)))
+	st.UpdateAll()
+	if err = st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root := st.Root()
+	var states int32
+	pool := NewTxPool(func() *StateTree {
+		atomic.AddInt32(&states, 1)
+		return NewStateTree(db, root)
+	}, func() *big.Int {
+		return big.NewInt(1000000)
+	}, big.NewInt(10), MainNetChainConfig, NewEventBus())
+	errNotAllowed := fmt.Errorf("sender not allowed")
+	allowed := make(map[common.Address]bool)
+	pool.AddValidator(func(tx *Transaction, state *StateTree) error {
+		return nil
+	})
+	pool.AddValidator(func(tx *Transaction, state *StateTree) error {
+		from, _ := tx.FromAddr()
+		if !allowed[from] || state.GetBalance(from).Sign() == 0 {
+			return errNotAllowed
+		}
+		return nil
+	})
+	sub := pool.SubscribeEvents()
+	defer sub.Unsubscribe()
+	tx := NewTransactionByStd(&StdTransaction{
+		GasPrice: big.NewInt(100),
+		GasLimit: common.TxGas,
+		Value:    big.NewInt(1),
+	})
+	_ = tx.SignWithPrivateKey(key)
+	// the checks and the validators share the state read once per add
+	before := atomic.LoadInt32(&states)
+	if err = pool.Add(tx); err != errNotAllowed {
+		t.Fatalf("got err %v, want %v", err, errNotAllowed)
+	}
+	assert.Equal(t, atomic.LoadInt32(&states)-before, int32(1))
+	select {
+	case e := <-sub.Chan():
+		assert.Equal(t, e.(TxPoolEvent).Reason, TxDropRejected)
+	case <-time.After(time.Second):
+		t.Fatal("no dropped event")
+	}
+	allowed[addr] = true
+	if err = pool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSortByFeePerByteAndNonce(t *testing.T) {
+	keyA, _ := crypto.GenPrvKey()
+	keyB, _ := crypto.GenPrvKey()
+	newTx := func(key *ecdsa.PrivateKey, nonce uint64, price int64, data []byte) *Transaction {
+		tx := NewTransactionByStd(&StdTransaction{
+			GasPrice: big.NewInt(price),
+			GasLimit: big.NewInt(25000),
+			Value:    new(big.Int),
+			Nonce:    nonce,
+			Data:     data,
+		})
+		_ = tx.SignWithPrivateKey(key)
+		return tx
+	}
+	// a pays the higher gas price but its data makes it much larger
+	a0 := newTx(keyA, 0, 20, make([]byte, 1024))
+	a1 := newTx(keyA, 1, 30, nil)
+	b0 := newTx(keyB, 0, 10, nil)
+	if a0.Size() <= b0.Size() {
+		t.Fatalf("got size %d, want more than %d", a0.Size(), b0.Size())
+	}
+	if want := new(big.Int).Div(big.NewInt(10*25000), big.NewInt(int64(b0.Size()))); b0.FeePerByte().Cmp(want) != 0 {
+		t.Fatalf("got fee per byte %s, want %s", b0.FeePerByte(), want)
+	}
+	txs := []*Transaction{a1, b0, a0}
+	SortTransactions(txs, TxOrderGasPrice)
+	assert.Equal(t, txs, []*Transaction{a0, a1, b0})
+	SortTransactions(txs, TxOrderFeePerByte)
+	assert.Equal(t, txs, []*Transaction{b0, a0, a1})
+	assert.Equal(t, VerifyTxOrder(""), nil)
+	assert.Equal(t, VerifyTxOrder("size"), ErrUnknownTxOrder)
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"time"
+	"xfsgo/common"
+)
+
+// BalanceDelta is the change of the balance of an account by a transaction.
+type BalanceDelta struct {
+	Address common.Address
+	Before  *big.Int
+	After   *big.Int
+}
+
+// TxPreview is the outcome of a transaction applied to a copy of the pending state.
+type TxPreview struct {
+	Receipt *Receipt
+	// Fee is the gas used by the transaction at its gas price.
+	Fee *big.Int
+	// Deltas holds the accounts whose balance the transaction changes, sorted by address.
+	Deltas []*BalanceDelta
+}
+
+// PreviewTransaction applies the transaction to a copy of the pending state and returns
+// the receipt it would produce in the next block. The pending state is the state of the
+// current block with the pending transactions of the sender applied in nonce order, so a
+// transaction following them can be previewed. Nothing is written to the chain state.
+func (bc *BlockChain) PreviewTransaction(tx *Transaction, pending []*Transaction) (*TxPreview, error) {
+	from, err := tx.FromAddr()
+	if err != nil {
+		return nil, err
+	}
+	parent := bc.CurrentBHeader()
+	header := &BlockHeader{
+		Height:        parent.Height + 1,
+		HashPrevBlock: parent.HeaderHash(),
+		Timestamp:     uint64(time.Now().Unix()),
+		Coinbase:      parent.Coinbase,
+		GasLimit:      parent.GasLimit,
+	}
+	if min := bc.MinimumTimestamp(parent); header.Timestamp < min {
+		header.Timestamp = min
+	}
+	committed := bc.CommittedState()
+	stateTree := bc.CommittedState()
+	gp := (*GasPool)(new(big.Int).Set(header.GasLimit))
+	totalGas := new(big.Int)
+	sends := make([]*Transaction, 0)
+	for _, p := range pending {
+		if sender, err := p.FromAddr(); err == nil && sender == from && p.Nonce < tx.Nonce {
+			sends = append(sends, p)
+		}
+	}
+	sort.Slice(sends, func(i, j int) bool {
+		return sends[i].Nonce < sends[j].Nonce
+	})
+	for _, p := range sends {
+		if p.Nonce != stateTree.GetNonce(from) {
+			continue
+		}
+		if _, err = bc.ApplyTransaction(stateTree, header, p, gp, totalGas); err != nil {
+			return nil, err
+		}
+	}
+	before := make(map[common.Address]*big.Int, len(stateTree.objs))
+	for addr := range stateTree.objs {
+		before[addr] = new(big.Int).Set(stateTree.GetBalance(addr))
+	}
+	receipt, err := bc.ApplyTransaction(stateTree, header, tx, gp, totalGas)
+	if err != nil {
+		return nil, err
+	}
+	preview := &TxPreview{
+		Receipt: receipt,
+		Fee:     new(big.Int).Mul(receipt.GasUsed, tx.GasPrice),
+		Deltas:  make([]*BalanceDelta, 0),
+	}
+	for addr := range stateTree.objs {
+		prev, exists := before[addr]
+		if !exists {
+			// accounts not touched by the pending transactions are as committed
+			prev = committed.GetBalance(addr)
+		}
+		after := stateTree.GetBalance(addr)
+		if prev.Cmp(after) != 0 {
+			preview.Deltas = append(preview.Deltas, &BalanceDelta{
+				Address: addr,
+				Before:  new(big.Int).Set(prev),
+				After:   new(big.Int).Set(after),
+			})
+		}
+	}
+	sort.Slice(preview.Deltas, func(i, j int) bool {
+		return bytes.Compare(preview.Deltas[i].Address[:], preview.Deltas[j].Address[:]) < 0
+	})
+	return preview, nil
+}
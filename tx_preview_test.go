@@ -0,0 +1,67 @@
+package xfsgo
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+func TestBlockChain_PreviewTransaction(t *testing.T) {
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.DefaultPubKey2Addr(key.PublicKey)
+	recipient := common.Address{0x02}
+	stateDb, chainDb := newTestStateDB(t), newTestStateDB(t)
+	genesis := fmt.Sprintf(`{"bits": 4278190109, "accounts": {"%s": {"balance": "1000000000"}}}`, sender.B58String())
+	if _, err = WriteGenesisBlock(stateDb, chainDb, strings.NewReader(genesis)); err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, newTestStateDB(t), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasPrice := big.NewInt(10)
+	newTx := func(nonce uint64, value int64) *Transaction {
+		tx := NewTransaction(recipient, common.TxGas, gasPrice, big.NewInt(value))
+		tx.Nonce = nonce
+		if err := tx.SignWithPrivateKey(key); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	fee := new(big.Int).Mul(common.TxGas, gasPrice)
+	// the preview follows the pending transaction of the sender
+	preview, err := bc.PreviewTransaction(newTx(1, 50), []*Transaction{newTx(0, 100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, preview.Receipt.Status, uint32(1))
+	assert.BigIntEqual(t, preview.Receipt.GasUsed, common.TxGas)
+	assert.BigIntEqual(t, preview.Fee, fee)
+	assert.Equal(t, len(preview.Deltas), 2)
+	var senderDelta, recipientDelta *BalanceDelta
+	for _, delta := range preview.Deltas {
+		switch delta.Address {
+		case sender:
+			senderDelta = delta
+		case recipient:
+			recipientDelta = delta
+		}
+	}
+	before := new(big.Int).Sub(big.NewInt(1000000000), new(big.Int).Add(fee, big.NewInt(100)))
+	assert.BigIntEqual(t, senderDelta.Before, before)
+	assert.BigIntEqual(t, senderDelta.After, new(big.Int).Sub(before, new(big.Int).Add(fee, big.NewInt(50))))
+	assert.BigIntEqual(t, recipientDelta.Before, big.NewInt(100))
+	assert.BigIntEqual(t, recipientDelta.After, big.NewInt(150))
+	// nothing is written to the chain state
+	assert.BigIntEqual(t, bc.CommittedState().GetBalance(recipient), big.NewInt(0))
+	if _, err = bc.PreviewTransaction(newTx(0, 2000000000), nil); err == nil {
+		t.Fatal("want err of a transfer above the balance")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package vm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+const (
+	// maxAnchorMetadataSize is the maximum size of the metadata of an anchored document.
+	maxAnchorMetadataSize = 256
+	// anchorRecordSize is the size of a stored anchor without the metadata, the owner,
+	// the block height, the block timestamp and the size of the metadata.
+	anchorRecordSize = 25 + 8 + 8 + 4
+)
+
+var (
+	errAnchorExists   = errors.New("document hash already anchored")
+	errAnchorNotFound = errors.New("document hash not anchored")
+	errAnchorEmpty    = errors.New("empty document hash")
+	errAnchorMetadata = errors.New("anchor metadata too large")
+	errAnchorRecord   = errors.New("invalid anchor record")
+	anchorStoreTopic  = common.Bytes2Hash(ahash.SHA256([]byte("Store")))
+	anchorSlotPre     = []byte("anchor.record")
+)
+
+// anchorContract records document hashes, a notarization of the existence of a
+// document at the time of the block it is anchored in. The first sender anchoring a
+// hash owns it, the anchor can not be overwritten.
+//
+// Every anchor is kept in a storage slot of its own.
+type anchorContract struct {
+	BuiltinContract
+}
+
+// AnchorRecord is an anchored document hash.
+type AnchorRecord struct {
+	Hash      common.Hash    `json:"hash"`
+	Owner     common.Address `json:"owner"`
+	Height    uint64         `json:"height"`
+	Timestamp uint64         `json:"timestamp"`
+	Metadata  string         `json:"metadata"`
+}
+
+func (a *anchorContract) BuiltinId() uint8 {
+	return 0x04
+}
+
+func (a *anchorContract) anchorSlot(hash CTypeUint256) common.Hash {
+	return a.StorageSlot(anchorSlotPre, hash[:])
+}
+
+// DecodeAnchorRecord decodes the anchor of the hash returned by Verify, the return data
+// is padded to a whole number of rows.
+func DecodeAnchorRecord(hash common.Hash, data []byte) (*AnchorRecord, error) {
+	if len(data) < anchorRecordSize {
+		return nil, errAnchorRecord
+	}
+	size := int(binary.BigEndian.Uint32(data[41:anchorRecordSize]))
+	if len(data) < anchorRecordSize+size {
+		return nil, errAnchorRecord
+	}
+	var owner common.Address
+	copy(owner[:], data[:25])
+	return &AnchorRecord{
+		Hash:      hash,
+		Owner:     owner,
+		Height:    binary.BigEndian.Uint64(data[25:33]),
+		Timestamp: binary.BigEndian.Uint64(data[33:41]),
+		Metadata:  string(data[anchorRecordSize : anchorRecordSize+size]),
+	}, nil
+}
+
+func (a *anchorContract) Create() error {
+	return nil
+}
+
+// Store anchors the document hash under the caller with the height and timestamp of
+// the current block.
+func (a *anchorContract) Store(hash CTypeUint256, metadata CTypeString) error {
+	if hash == (CTypeUint256{}) {
+		return errAnchorEmpty
+	}
+	if len(metadata) > maxAnchorMetadataSize {
+		return errAnchorMetadata
+	}
+	slot := a.anchorSlot(hash)
+	if len(a.GetStorage(slot)) > 0 {
+		return errAnchorExists
+	}
+	owner := a.Caller()
+	data := make([]byte, 0, anchorRecordSize+len(metadata))
+	data = append(data, owner[:]...)
+	data = append(data, heightKey(a.BlockHeight())...)
+	data = append(data, heightKey(a.BlockTimestamp())...)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(metadata)))
+	data = append(data, size[:]...)
+	data = append(data, metadata...)
+	if err := a.SetStorage(slot, data); err != nil {
+		return err
+	}
+	event, err := json.Marshal(&AnchorRecord{
+		Hash:      common.Hash(hash),
+		Owner:     owner,
+		Height:    a.BlockHeight(),
+		Timestamp: a.BlockTimestamp(),
+		Metadata:  metadata.String(),
+	})
+	if err != nil {
+		return err
+	}
+	return a.Emit([]common.Hash{anchorStoreTopic, common.Hash(hash)}, event)
+}
+
+// Verify returns the anchor of the document hash, the owner followed by the big endian
+// block height, block timestamp, size of the metadata and the metadata.
+func (a *anchorContract) Verify(hash CTypeUint256) ([]byte, error) {
+	data := a.GetStorage(a.anchorSlot(hash))
+	if len(data) < anchorRecordSize {
+		return nil, errAnchorNotFound
+	}
+	return data, nil
+}
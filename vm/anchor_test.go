@@ -0,0 +1,69 @@
+package vm
+
+import (
+	"encoding/json"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/crypto"
+)
+
+func createTestAnchor(t *testing.T, vm *xvm, sender common.Address) common.Address {
+	input := append([]byte{0xd0, 0x23, 0x04}, mustEncodeCall("Create")...)
+	caddr := crypto.CreateAddress(sender.Hash(), vm.stateTree.GetNonce(sender))
+	if err := vm.Create(sender, input); err != nil {
+		t.Fatal(err)
+	}
+	vm.stateTree.AddNonce(sender, 1)
+	return caddr
+}
+
+func TestAnchorContract_StoreVerify(t *testing.T) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Height: 7, Timestamp: 1000, Builtins: testBuiltins})
+	vm.SetGas(1000000)
+	owner := common.Address{0x01}
+	anchor := createTestAnchor(t, vm, owner)
+	var hash CTypeUint256
+	copy(hash[:], ahash.SHA256([]byte("document")))
+	if err := vm.StaticCall(owner, anchor, mustEncodeCall("Verify", hash)); err != errAnchorNotFound {
+		t.Fatalf("want errAnchorNotFound, got %v", err)
+	}
+	if err := vm.Call(owner, anchor, nil, mustEncodeCall("Store", hash, CTypeString("contract.pdf"))); err != nil {
+		t.Fatal(err)
+	}
+	// the first anchor of a hash can not be overwritten by anyone
+	if err := vm.Call(common.Address{0x02}, anchor, nil, mustEncodeCall("Store", hash, CTypeString(""))); err != errAnchorExists {
+		t.Fatalf("want errAnchorExists, got %v", err)
+	}
+	if err := vm.Call(owner, anchor, nil, mustEncodeCall("Store", CTypeUint256{}, CTypeString(""))); err != errAnchorEmpty {
+		t.Fatalf("want errAnchorEmpty, got %v", err)
+	}
+	large := make(CTypeString, maxAnchorMetadataSize+1)
+	if err := vm.Call(owner, anchor, nil, mustEncodeCall("Store", CTypeUint256{0x01}, large)); err != errAnchorMetadata {
+		t.Fatalf("want errAnchorMetadata, got %v", err)
+	}
+	if err := vm.StaticCall(common.Address{0x03}, anchor, mustEncodeCall("Verify", hash)); err != nil {
+		t.Fatal(err)
+	}
+	record, err := DecodeAnchorRecord(common.Hash(hash), vm.ReturnData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &AnchorRecord{
+		Hash:      common.Hash(hash),
+		Owner:     owner,
+		Height:    7,
+		Timestamp: 1000,
+		Metadata:  "contract.pdf",
+	}
+	assert.Equal(t, record, want)
+	logs := vm.Logs()
+	assert.Equal(t, len(logs), 1)
+	assert.Equal(t, logs[0].Topics[1], common.Hash(hash))
+	var event AnchorRecord
+	if err = json.Unmarshal(logs[0].Data, &event); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &event, want)
+}
@@ -0,0 +1,275 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package vm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"xfsgo/bridge"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+// maxForeignAddressSize is the maximum size of a recipient address on the foreign chain.
+const maxForeignAddressSize = 64
+
+var (
+	errBridgeHeaderKnown   = errors.New("foreign header already known")
+	errBridgeNotCanonical  = errors.New("foreign header not on the bridge main chain")
+	errBridgeNotConfirmed  = errors.New("foreign header not confirmed")
+	errBridgeTransferPaid  = errors.New("foreign transfer already paid")
+	errBridgeNoValue       = errors.New("no value locked")
+	errBridgeBadRecipient  = errors.New("invalid foreign recipient")
+	errBridgeFundsTooLow   = errors.New("bridge balance not enough")
+	bridgeHeaderTopic      = common.Bytes2Hash(ahash.SHA256([]byte("Header")))
+	bridgeLockTopic        = common.Bytes2Hash(ahash.SHA256([]byte("Lock")))
+	bridgeUnlockTopic      = common.Bytes2Hash(ahash.SHA256([]byte("Unlock")))
+	bridgeHeaderSlotPre    = []byte("bridge.header")
+	bridgeCanonicalSlotPre = []byte("bridge.canonical")
+	bridgePaidSlotPre      = []byte("bridge.paid")
+)
+
+// bridgeContract is a light client of a foreign chain. Relayers submit the headers of the
+// foreign chain which are checked by the verifier of its consensus, the longest chain of
+// valid headers is the main chain of the bridge. Value locked in the bridge is moved to
+// the foreign chain, transfers from the foreign chain are paid out of the locked value
+// with a proof against a header of the main chain with enough confirmations.
+//
+// The headers, the main chain and the paid transfers are kept in storage slots of their
+// own, the storage fields only hold the configuration and the head.
+type bridgeContract struct {
+	BuiltinContract
+	Verifier      CTypeString  `contract:"storage"`
+	Config        CTypeString  `contract:"storage"`
+	Confirmations CTypeUint64  `contract:"storage"`
+	HeadHeight    CTypeUint64  `contract:"storage"`
+	HeadHash      CTypeUint256 `contract:"storage"`
+	LockNonce     CTypeUint64  `contract:"storage"`
+}
+
+// BridgeLock is the data of the event of value locked for a foreign recipient.
+type BridgeLock struct {
+	Nonce     uint64         `json:"nonce"`
+	Sender    common.Address `json:"sender"`
+	Recipient string         `json:"recipient"`
+	Amount    *big.Int       `json:"amount"`
+}
+
+func (b *bridgeContract) BuiltinId() uint8 {
+	return 0x02
+}
+
+func heightKey(height uint64) []byte {
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], height)
+	return numBuf[:]
+}
+
+func (b *bridgeContract) verifier() (bridge.Verifier, error) {
+	return bridge.NewVerifier(b.Verifier.String(), b.Config)
+}
+
+func (b *bridgeContract) header(hash common.Hash) (*bridge.Header, error) {
+	data := b.GetStorage(b.StorageSlot(bridgeHeaderSlotPre, hash[:]))
+	if data == nil {
+		return nil, nil
+	}
+	return bridge.DecodeHeader(data)
+}
+
+func (b *bridgeContract) putHeader(header *bridge.Header) error {
+	data, err := header.Encode()
+	if err != nil {
+		return err
+	}
+	hash := header.Hash()
+	return b.SetStorage(b.StorageSlot(bridgeHeaderSlotPre, hash[:]), data)
+}
+
+func (b *bridgeContract) canonicalHash(height uint64) common.Hash {
+	return common.Bytes2Hash(b.GetStorage(b.StorageSlot(bridgeCanonicalSlotPre, heightKey(height))))
+}
+
+// setHead makes the header the head, the main chain is rewritten down to the header it
+// shares with the previous main chain.
+func (b *bridgeContract) setHead(header *bridge.Header) error {
+	b.HeadHeight = NewUint64(header.Height)
+	b.HeadHash = CTypeUint256(header.Hash())
+	for h := header; h != nil; {
+		hash := h.Hash()
+		if b.canonicalHash(h.Height) == hash {
+			return nil
+		}
+		if err := b.SetStorage(b.StorageSlot(bridgeCanonicalSlotPre, heightKey(h.Height)), hash[:]); err != nil {
+			return err
+		}
+		parent, err := b.header(h.ParentHash)
+		if err != nil {
+			return err
+		}
+		h = parent
+	}
+	return nil
+}
+
+// Create sets the verifier of the foreign chain and the trusted header the bridge starts
+// from. A transfer can be paid out once its header has confirmations headers on top.
+func (b *bridgeContract) Create(
+	verifier CTypeString,
+	config CTypeString,
+	genesis CTypeString,
+	confirmations CTypeUint64) error {
+	b.Verifier = verifier
+	b.Config = config
+	b.Confirmations = confirmations
+	if _, err := b.verifier(); err != nil {
+		return err
+	}
+	header, err := bridge.DecodeHeader(genesis)
+	if err != nil {
+		return err
+	}
+	if err = b.putHeader(header); err != nil {
+		return err
+	}
+	return b.setHead(header)
+}
+
+// SubmitHeader adds a header of the foreign chain extending a known header.
+func (b *bridgeContract) SubmitHeader(data CTypeString) error {
+	header, err := bridge.DecodeHeader(data)
+	if err != nil {
+		return err
+	}
+	hash := header.Hash()
+	if known, err := b.header(hash); err != nil {
+		return err
+	} else if known != nil {
+		return errBridgeHeaderKnown
+	}
+	parent, err := b.header(header.ParentHash)
+	if err != nil {
+		return err
+	}
+	v, err := b.verifier()
+	if err != nil {
+		return err
+	}
+	if err = bridge.VerifyChild(v, parent, header); err != nil {
+		return err
+	}
+	if err = b.putHeader(header); err != nil {
+		return err
+	}
+	if header.Height > b.HeadHeight.Uint64() {
+		if err = b.setHead(header); err != nil {
+			return err
+		}
+	}
+	return b.Emit([]common.Hash{bridgeHeaderTopic, hash}, heightKey(header.Height))
+}
+
+// Lock locks the value of the call to be minted for the recipient on the foreign chain.
+func (b *bridgeContract) Lock(recipient CTypeString) error {
+	value := b.CallValue()
+	if value.Sign() <= 0 {
+		return errBridgeNoValue
+	}
+	if len(recipient) == 0 || len(recipient) > maxForeignAddressSize {
+		return errBridgeBadRecipient
+	}
+	nonce := b.LockNonce.Uint64()
+	b.LockNonce = NewUint64(nonce + 1)
+	data, err := json.Marshal(&BridgeLock{
+		Nonce:     nonce,
+		Sender:    b.Caller(),
+		Recipient: recipient.String(),
+		Amount:    value,
+	})
+	if err != nil {
+		return err
+	}
+	return b.Emit([]common.Hash{bridgeLockTopic, common.Bytes2Hash(heightKey(nonce))}, data)
+}
+
+// Unlock pays out a transfer from the foreign chain proven against a confirmed header of
+// the bridge main chain.
+func (b *bridgeContract) Unlock(data CTypeString) error {
+	proof, err := bridge.DecodeTransferProof(data)
+	if err != nil {
+		return err
+	}
+	header, err := b.header(proof.Header)
+	if err != nil {
+		return err
+	}
+	if header == nil || b.canonicalHash(header.Height) != proof.Header {
+		return errBridgeNotCanonical
+	}
+	if header.Height+b.Confirmations.Uint64() > b.HeadHeight.Uint64() {
+		return errBridgeNotConfirmed
+	}
+	if err = proof.Verify(header.TransfersRoot); err != nil {
+		return err
+	}
+	transfer := proof.Transfer
+	paidSlot := b.StorageSlot(bridgePaidSlotPre, transfer.ID[:])
+	if b.GetStorage(paidSlot) != nil {
+		return errBridgeTransferPaid
+	}
+	if b.ExtBalance(b.GetAddress()).Cmp(transfer.Amount) < 0 {
+		return errBridgeFundsTooLow
+	}
+	if err = b.SetStorage(paidSlot, []byte{1}); err != nil {
+		return err
+	}
+	if _, err = b.CallContract(transfer.Recipient, transfer.Amount, 0, nil); err != nil {
+		return err
+	}
+	return b.Emit([]common.Hash{bridgeUnlockTopic, transfer.ID}, transfer.Recipient[:])
+}
+
+func (b *bridgeContract) GetHeadHeight() CTypeUint64 {
+	return b.HeadHeight
+}
+
+func (b *bridgeContract) GetHeadHash() CTypeUint256 {
+	return b.HeadHash
+}
+
+// GetCanonicalHash returns the hash of the header with the height on the main chain.
+func (b *bridgeContract) GetCanonicalHash(height CTypeUint64) CTypeUint256 {
+	return CTypeUint256(b.canonicalHash(height.Uint64()))
+}
+
+// HasHeader returns whether the header with the hash was submitted.
+func (b *bridgeContract) HasHeader(hash CTypeUint256) CTypeBool {
+	if b.GetStorage(b.StorageSlot(bridgeHeaderSlotPre, hash[:])) != nil {
+		return CTypeBool{1}
+	}
+	return CTypeBool{}
+}
+
+// IsPaid returns whether the foreign transfer with the id was paid out.
+func (b *bridgeContract) IsPaid(id CTypeUint256) CTypeBool {
+	if b.GetStorage(b.StorageSlot(bridgePaidSlotPre, id[:])) != nil {
+		return CTypeBool{1}
+	}
+	return CTypeBool{}
+}
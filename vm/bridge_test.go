@@ -0,0 +1,186 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/bridge"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+const testBridgeBits = uint32(0x7fffff20)
+
+func mustEncodeCall(method string, args ...interface{}) []byte {
+	input, err := EncodeCall(method, args...)
+	if err != nil {
+		panic(err)
+	}
+	return input
+}
+
+func mineBridgeHeader(parent *bridge.Header, root common.Hash) *bridge.Header {
+	h := &bridge.Header{
+		Height:        parent.Height + 1,
+		ParentHash:    parent.Hash(),
+		TransfersRoot: root,
+		Timestamp:     parent.Timestamp + 1,
+		Bits:          testBridgeBits,
+	}
+	target := bridge.BitsToTarget(testBridgeBits)
+	for {
+		hash := h.Hash()
+		if new(big.Int).SetBytes(hash[:]).Cmp(target) <= 0 {
+			return h
+		}
+		h.Nonce++
+	}
+}
+
+func encodeBridgeHeader(t *testing.T, h *bridge.Header) CTypeString {
+	data, err := h.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func createTestBridge(t *testing.T, vm *xvm, sender common.Address, genesis *bridge.Header) common.Address {
+	config, _ := json.Marshal(&bridge.PoWConfig{MaxBits: testBridgeBits})
+	input := bytes.NewBuffer(nil)
+	input.Write([]byte{0xd0, 0x23, 0x02})
+	input.Write(mustEncodeCall("Create",
+		CTypeString(bridge.PoWVerifier), CTypeString(config), encodeBridgeHeader(t, genesis), NewUint64(2)))
+	caddr := crypto.CreateAddress(sender.Hash(), vm.stateTree.GetNonce(sender))
+	if err := vm.Create(sender, input.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	vm.stateTree.AddNonce(sender, 1)
+	return caddr
+}
+
+func bridgeHead(t *testing.T, vm *xvm, addr common.Address) uint64 {
+	c, err := vm.GetBuiltinContract(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*bridgeContract).HeadHeight.Uint64()
+}
+
+func TestBridgeContract_LockUnlock(t *testing.T) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Builtins: testBuiltins})
+	vm.SetGas(1000000)
+	sender := common.Address{0x01}
+	recipient := common.Address{0x02}
+	vm.stateTree.AddBalance(sender, big.NewInt(1000))
+	genesis := &bridge.Header{Bits: testBridgeBits}
+	addr := createTestBridge(t, vm, sender, genesis)
+
+	// value locked for a foreign recipient
+	if err := vm.Call(sender, addr, nil, mustEncodeCall("Lock", CTypeString("foreign"))); err != errBridgeNoValue {
+		t.Fatalf("want errBridgeNoValue, got %v", err)
+	}
+	if err := vm.Call(sender, addr, big.NewInt(500), mustEncodeCall("Lock", CTypeString("foreign"))); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(addr), big.NewInt(500))
+	logs := vm.Logs()
+	assert.Equal(t, len(logs), 1)
+	var lock BridgeLock
+	if err := json.Unmarshal(logs[0].Data, &lock); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, lock.Recipient, "foreign")
+	assert.BigIntEqual(t, lock.Amount, big.NewInt(500))
+
+	// a foreign transfer paid out once its header is confirmed
+	transfers := []*bridge.Transfer{
+		{ID: common.Hash{0x01}, Recipient: recipient, Amount: big.NewInt(100)},
+		{ID: common.Hash{0x02}, Recipient: recipient, Amount: big.NewInt(1000)},
+	}
+	headers := []*bridge.Header{genesis}
+	headers = append(headers, mineBridgeHeader(genesis, bridge.TransfersRoot(transfers)))
+	submit := func(h *bridge.Header) error {
+		return vm.Call(sender, addr, nil, mustEncodeCall("SubmitHeader", encodeBridgeHeader(t, h)))
+	}
+	if err := submit(headers[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := submit(headers[1]); err != errBridgeHeaderKnown {
+		t.Fatalf("want errBridgeHeaderKnown, got %v", err)
+	}
+	proof, err := bridge.ProveTransfer(headers[1].Hash(), transfers, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofData, _ := proof.Encode()
+	unlock := mustEncodeCall("Unlock", CTypeString(proofData))
+	if err = vm.Call(sender, addr, nil, unlock); err != errBridgeNotConfirmed {
+		t.Fatalf("want errBridgeNotConfirmed, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		h := mineBridgeHeader(headers[len(headers)-1], common.Hash{})
+		headers = append(headers, h)
+		if err = submit(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, bridgeHead(t, vm, addr), uint64(3))
+	if err = vm.Call(sender, addr, nil, unlock); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(recipient), big.NewInt(100))
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(addr), big.NewInt(400))
+	if err = vm.Call(sender, addr, nil, unlock); err != errBridgeTransferPaid {
+		t.Fatalf("want errBridgeTransferPaid, got %v", err)
+	}
+	if err = vm.Call(sender, addr, nil, mustEncodeCall("IsPaid", CTypeUint256(transfers[0].ID))); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, vm.ReturnData()[0], byte(1))
+
+	// a transfer larger than the locked value is not paid
+	proof, _ = bridge.ProveTransfer(headers[1].Hash(), transfers, 1)
+	proofData, _ = proof.Encode()
+	if err = vm.Call(sender, addr, nil, mustEncodeCall("Unlock", CTypeString(proofData))); err != errBridgeFundsTooLow {
+		t.Fatalf("want errBridgeFundsTooLow, got %v", err)
+	}
+}
+
+func TestBridgeContract_Reorg(t *testing.T) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Builtins: testBuiltins})
+	vm.SetGas(1000000)
+	sender := common.Address{0x01}
+	genesis := &bridge.Header{Bits: testBridgeBits}
+	addr := createTestBridge(t, vm, sender, genesis)
+	submit := func(h *bridge.Header) {
+		if err := vm.Call(sender, addr, nil, mustEncodeCall("SubmitHeader", encodeBridgeHeader(t, h))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a1 := mineBridgeHeader(genesis, common.Hash{0x0a})
+	a2 := mineBridgeHeader(a1, common.Hash{0x0a})
+	submit(a1)
+	submit(a2)
+	b1 := mineBridgeHeader(genesis, common.Hash{0x0b})
+	b2 := mineBridgeHeader(b1, common.Hash{0x0b})
+	b3 := mineBridgeHeader(b2, common.Hash{0x0b})
+	submit(b1)
+	submit(b2)
+	assert.Equal(t, bridgeHead(t, vm, addr), uint64(2))
+	submit(b3)
+	assert.Equal(t, bridgeHead(t, vm, addr), uint64(3))
+	c, _ := vm.GetBuiltinContract(addr)
+	bc := c.(*bridgeContract)
+	for _, h := range []*bridge.Header{genesis, b1, b2, b3} {
+		want := h.Hash()
+		got := bc.GetCanonicalHash(NewUint64(h.Height))
+		assert.Equal(t, common.Hash(got), want)
+	}
+	orphan := mineBridgeHeader(&bridge.Header{Height: 5}, common.Hash{})
+	if err := vm.Call(sender, addr, nil, mustEncodeCall("SubmitHeader", encodeBridgeHeader(t, orphan))); err == nil {
+		t.Fatal("want error of unknown parent")
+	}
+}
@@ -0,0 +1,320 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/core"
+	"xfsgo/crypto"
+)
+
+var errTestFail = errors.New("test fail")
+
+// testRelay is a builtin contract calling other contracts.
+type testRelay struct {
+	BuiltinContract
+	Count CTypeUint8 `contract:"storage"`
+}
+
+func (r *testRelay) BuiltinId() uint8 {
+	return 0xf0
+}
+
+func (r *testRelay) Create() error {
+	return nil
+}
+
+func (r *testRelay) Incr() error {
+	r.Count = NewUint8(r.Count.uint8() + 1)
+	return nil
+}
+
+func (r *testRelay) Fail() error {
+	r.Count = NewUint8(r.Count.uint8() + 1)
+	return errTestFail
+}
+
+// TryRelay calls the target with a value of 10 and ignores a failure of the call.
+func (r *testRelay) TryRelay(target CTypeString, input CTypeString) error {
+	r.Count = NewUint8(r.Count.uint8() + 1)
+	_, _ = r.CallContract(common.Bytes2Address(target), big.NewInt(10), 0, input)
+	return nil
+}
+
+// Peek returns the counter without modifying the state.
+func (r *testRelay) Peek() CTypeUint8 {
+	return r.Count
+}
+
+func (r *testRelay) StaticRelay(target CTypeString, input CTypeString) ([]byte, error) {
+	return r.StaticCallContract(common.Bytes2Address(target), 0, input)
+}
+
+func (r *testRelay) Notify(data CTypeString) error {
+	return r.Emit([]common.Hash{common.Bytes2Hash(ahash.SHA256([]byte("Notify")))}, data)
+}
+
+func (r *testRelay) NotifyFail(data CTypeString) error {
+	if err := r.Notify(data); err != nil {
+		return err
+	}
+	return errTestFail
+}
+
+// RelayFail calls the target and fails afterwards.
+func (r *testRelay) RelayFail(target CTypeString, input CTypeString) error {
+	_, _ = r.CallContract(common.Bytes2Address(target), nil, 0, input)
+	return errTestFail
+}
+
+func (r *testRelay) Loop() error {
+	_, err := r.CallContract(r.GetAddress(), nil, 0, ahash.SHA256([]byte("Loop")))
+	return err
+}
+
+func padRows(bs []byte) []byte {
+	if mod := len(bs) % rowlen; mod != 0 {
+		bs = append(bs, make([]byte, rowlen-mod)...)
+	}
+	return bs
+}
+
+func writeRowString(w Buffer, s []byte) {
+	var slenbuf [8]byte
+	slenbuf[0] = byte(len(s))
+	_, _ = w.Write(slenbuf[:])
+	_, _ = w.Write(padRows(s))
+}
+
+func relayMethod(name string, args ...[]byte) []byte {
+	buf := NewBuffer(nil)
+	_, _ = buf.Write(ahash.SHA256([]byte(name)))
+	for _, arg := range args {
+		writeRowString(buf, arg)
+	}
+	return buf.Bytes()
+}
+
+func createTestRelay(t *testing.T, vm *xvm, sender common.Address) common.Address {
+	input := bytes.NewBuffer(nil)
+	input.Write([]byte{0xd0, 0x23, 0xf0})
+	input.Write(relayMethod("Create"))
+	caddr := crypto.CreateAddress(sender.Hash(), vm.stateTree.GetNonce(sender))
+	if err := vm.Create(sender, input.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	vm.stateTree.AddNonce(sender, 1)
+	return caddr
+}
+
+func relayCount(t *testing.T, vm *xvm, addr common.Address) uint8 {
+	c, err := vm.GetBuiltinContract(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*testRelay).Count.uint8()
+}
+
+func newTestRelayVM() *xvm {
+	vm := NewXVM(newTestStateTree())
+	vm.registerBuiltinId(new(testRelay))
+	vm.SetGas(1000000)
+	return vm
+}
+
+func TestXvm_InnerCall(t *testing.T) {
+	vm := newTestRelayVM()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	b := createTestRelay(t, vm, sender)
+	vm.stateTree.AddBalance(a, big.NewInt(100))
+	if err := vm.Call(sender, a, nil, relayMethod("TryRelay", b[:], relayMethod("Incr"))); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, relayCount(t, vm, a), uint8(1))
+	assert.Equal(t, relayCount(t, vm, b), uint8(1))
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(b), big.NewInt(10))
+	assert.Equal(t, vm.GasLeft() < 1000000, true)
+}
+
+func TestXvm_CreateRevert(t *testing.T) {
+	vm := newTestRelayVM()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	input := bytes.NewBuffer(nil)
+	input.Write([]byte{0xd0, 0x23, 0xf0})
+	input.Write(relayMethod("RelayFail", a[:], relayMethod("Notify", []byte("created"))))
+	caddr := crypto.CreateAddress(sender.Hash(), vm.stateTree.GetNonce(sender))
+	if err := vm.Create(sender, input.Bytes()); err != errTestFail {
+		t.Fatalf("got err %v, want %v", err, errTestFail)
+	}
+	// the logs of the contracts called by a failed creation are dropped with its state
+	assert.Equal(t, len(vm.Logs()), 0)
+	assert.Equal(t, vm.stateTree.GetCodeSize(caddr), 0)
+	input.Reset()
+	input.Write([]byte{0xd0, 0x23, 0xf0})
+	input.Write(relayMethod("RelayFail", a[:], relayMethod("Incr")))
+	if err := vm.Create(sender, input.Bytes()); err != errTestFail {
+		t.Fatalf("got err %v, want %v", err, errTestFail)
+	}
+	assert.Equal(t, relayCount(t, vm, a), uint8(0))
+}
+
+func TestXvm_InnerCallRevert(t *testing.T) {
+	vm := newTestRelayVM()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	b := createTestRelay(t, vm, sender)
+	vm.stateTree.AddBalance(a, big.NewInt(100))
+	if err := vm.Call(sender, a, nil, relayMethod("TryRelay", b[:], relayMethod("Fail"))); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, relayCount(t, vm, a), uint8(1))
+	assert.Equal(t, relayCount(t, vm, b), uint8(0))
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(a), big.NewInt(100))
+	if vm.stateTree.GetBalance(b) != nil {
+		t.Fatalf("value transfer of failed call not reverted")
+	}
+}
+
+func TestXvm_CallDepth(t *testing.T) {
+	vm := newTestRelayVM()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	err := vm.Call(sender, a, nil, relayMethod("Loop"))
+	if err != errCallDepth {
+		t.Fatalf("want err %v, got %v", errCallDepth, err)
+	}
+}
+
+func TestXvm_Emit(t *testing.T) {
+	vm := newTestRelayVM()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	b := createTestRelay(t, vm, sender)
+	if err := vm.Call(sender, a, nil, relayMethod("Notify", []byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Call(sender, a, nil, relayMethod("TryRelay", b[:], relayMethod("NotifyFail", []byte("dropped")))); err != nil {
+		t.Fatal(err)
+	}
+	logs := vm.Logs()
+	assert.Equal(t, len(logs), 1)
+	assert.AddressEq(t, logs[0].Address, a)
+	assert.BytesEqual(t, logs[0].Data, []byte("hello"))
+	bloom := core.CreateBloom(logs)
+	if !bloom.Test(a[:]) || !bloom.Test(logs[0].Topics[0][:]) {
+		t.Fatalf("bloom does not contain log address or topic")
+	}
+	if bloom.Test(b[:]) {
+		t.Fatalf("bloom contains address of reverted log")
+	}
+}
+
+func TestXvm_ErrorCode(t *testing.T) {
+	vm := newTestRelayVM()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	tests := []struct {
+		input []byte
+		want  int
+	}{
+		{relayMethod("Incr"), ErrCodeNone},
+		{relayMethod("Fail"), ErrCodeRevert},
+		{relayMethod("Loop"), ErrCodeStackOverflow},
+		{relayMethod("Unknown"), ErrCodeInvalidOpcode},
+	}
+	for _, tt := range tests {
+		err := vm.Call(sender, a, nil, tt.input)
+		assert.Equal(t, ErrorCode(err), tt.want)
+	}
+	vm.SetGas(0)
+	err := vm.Call(sender, a, nil, relayMethod("Loop"))
+	assert.Equal(t, ErrorCode(err), ErrCodeOutOfGas)
+	err = vm.Call(sender, a, big.NewInt(1), relayMethod("Incr"))
+	assert.Equal(t, ErrorCode(err), ErrCodeInsufficientBalance)
+}
+
+func TestXvm_StaticCall(t *testing.T) {
+	vm := newTestRelayVM()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	b := createTestRelay(t, vm, sender)
+	if err := vm.Call(sender, b, nil, relayMethod("Incr")); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.StaticCall(sender, b, relayMethod("Peek")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, vm.ReturnData()[0], byte(1))
+	if err := vm.StaticCall(sender, a, relayMethod("StaticRelay", b[:], relayMethod("Peek"))); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, vm.ReturnData()[0], byte(1))
+	tests := [][]byte{
+		relayMethod("Incr"),
+		relayMethod("Notify", []byte("static")),
+		relayMethod("StaticRelay", b[:], relayMethod("Incr")),
+	}
+	for _, input := range tests {
+		if err := vm.StaticCall(sender, b, input); err != errWriteProtection {
+			t.Fatalf("want err %v, got %v", errWriteProtection, err)
+		}
+	}
+	if err := vm.Call(sender, a, nil, relayMethod("StaticRelay", b[:], relayMethod("Incr"))); err != errWriteProtection {
+		t.Fatalf("want err %v, got %v", errWriteProtection, err)
+	}
+	assert.Equal(t, relayCount(t, vm, b), uint8(1))
+	assert.Equal(t, len(vm.Logs()), 0)
+	if vm.ctx.static {
+		t.Fatalf("static flag not cleared")
+	}
+}
+
+func TestXvm_CallTrace(t *testing.T) {
+	vm := newTestRelayVM()
+	vm.TraceCalls()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	b := createTestRelay(t, vm, sender)
+	vm.stateTree.AddBalance(a, big.NewInt(100))
+	if err := vm.Call(sender, a, nil, relayMethod("TryRelay", b[:], relayMethod("Fail"))); err != nil {
+		t.Fatal(err)
+	}
+	trace := vm.CallTrace()
+	assert.Equal(t, len(trace), 3)
+	assert.Equal(t, trace[0].Type, CallTypeCreate)
+	root := trace[2]
+	assert.Equal(t, root.Type, CallTypeCall)
+	assert.AddressEq(t, root.To, a)
+	assert.Equal(t, root.Err, nil)
+	assert.Equal(t, len(root.Calls), 1)
+	inner := root.Calls[0]
+	assert.AddressEq(t, inner.From, a)
+	assert.AddressEq(t, inner.To, b)
+	assert.BigIntEqual(t, inner.Value, big.NewInt(10))
+	assert.Equal(t, inner.Err, errTestFail)
+	assert.Equal(t, inner.GasUsed, inner.Gas)
+	assert.Equal(t, root.GasUsed, root.Gas-vm.GasLeft())
+	assert.Equal(t, root.GasUsed, callGas+callValueGas+inner.GasUsed)
+}
+
+func TestXvm_Abort(t *testing.T) {
+	vm := newTestRelayVM()
+	sender := common.Address{0x01}
+	a := createTestRelay(t, vm, sender)
+	done := make(chan struct{})
+	vm.SetDone(done)
+	if err := vm.Call(sender, a, nil, relayMethod("Incr")); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	err := vm.Call(sender, a, nil, relayMethod("Incr"))
+	assert.Equal(t, ErrorCode(err), ErrCodeAborted)
+	vm.SetDone(nil)
+	assert.Equal(t, relayCount(t, vm, a), uint8(1))
+}
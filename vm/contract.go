@@ -1,7 +1,9 @@
 package vm
 
 import (
+	"math/big"
 	"xfsgo/common"
+	"xfsgo/common/ahash"
 	"xfsgo/core"
 )
 
@@ -11,14 +13,38 @@ type ContractHelper interface {
 	GetAddress() (addr common.Address)
 	SetAddress(addr common.Address)
 }
+
+// ContractHost exposes read only information about the chain state and the
+// executing call to builtin contracts.
+type ContractHost interface {
+	ExtBalance(addr common.Address) *big.Int
+	ExtCodeHash(addr common.Address) common.Hash
+	ExtCodeSize(addr common.Address) int
+	BlockHeight() uint64
+	BlockTimestamp() uint64
+	BlockCoinbase() common.Address
+	BlockRandomness() common.Hash
+	Caller() common.Address
+	CallerChain() []common.Address
+	CallValue() *big.Int
+	CallContract(addr common.Address, value *big.Int, gas uint64, input []byte) ([]byte, error)
+	StaticCallContract(addr common.Address, gas uint64, input []byte) ([]byte, error)
+	Emit(topics []common.Hash, data []byte) error
+	GetStorage(key common.Hash) []byte
+	SetStorage(key common.Hash, val []byte) error
+	StorageSlot(prefix []byte, key []byte) common.Hash
+}
+
 type BuiltinContract interface {
 	ContractHelper
+	ContractHost
 	BuiltinId() (id uint8)
 }
 
 type absBuiltinContract struct {
 	st   core.StateTree
 	addr common.Address
+	vm   *xvm
 }
 
 func StdBuiltinContract() *absBuiltinContract {
@@ -51,3 +77,180 @@ func (abs *absBuiltinContract) BuiltinId() (id uint8) {
 func (abs *absBuiltinContract) Create(func()) (err error) {
 	return
 }
+
+func (abs *absBuiltinContract) ExtBalance(addr common.Address) *big.Int {
+	if abs.st == nil {
+		return new(big.Int)
+	}
+	if balance := abs.st.GetBalance(addr); balance != nil {
+		return new(big.Int).Set(balance)
+	}
+	return new(big.Int)
+}
+
+func (abs *absBuiltinContract) ExtCodeHash(addr common.Address) common.Hash {
+	if abs.st == nil {
+		return common.Hash{}
+	}
+	return abs.st.GetCodeHash(addr)
+}
+
+func (abs *absBuiltinContract) ExtCodeSize(addr common.Address) int {
+	if abs.st == nil {
+		return 0
+	}
+	return abs.st.GetCodeSize(addr)
+}
+
+func (abs *absBuiltinContract) BlockHeight() uint64 {
+	if abs.vm == nil {
+		return 0
+	}
+	return abs.vm.ctx.block.Height
+}
+
+func (abs *absBuiltinContract) BlockTimestamp() uint64 {
+	if abs.vm == nil {
+		return 0
+	}
+	return abs.vm.ctx.block.Timestamp
+}
+
+func (abs *absBuiltinContract) BlockCoinbase() common.Address {
+	if abs.vm == nil {
+		return common.Address{}
+	}
+	return abs.vm.ctx.block.Coinbase
+}
+
+// BlockRandomness returns the randomness of the block, the miners can bias it by choosing
+// the blocks they publish, so it only suits low stakes uses.
+func (abs *absBuiltinContract) BlockRandomness() common.Hash {
+	if abs.vm == nil {
+		return common.Hash{}
+	}
+	return abs.vm.ctx.block.Randomness
+}
+
+// Caller returns the address which invoked the current contract.
+func (abs *absBuiltinContract) Caller() common.Address {
+	if abs.vm == nil || len(abs.vm.ctx.callers) == 0 {
+		return common.Address{}
+	}
+	callers := abs.vm.ctx.callers
+	return callers[len(callers)-1]
+}
+
+// CallerChain returns the callers of the current contract, starting with the transaction sender.
+func (abs *absBuiltinContract) CallerChain() []common.Address {
+	if abs.vm == nil {
+		return nil
+	}
+	chain := make([]common.Address, len(abs.vm.ctx.callers))
+	copy(chain, abs.vm.ctx.callers)
+	return chain
+}
+
+// CallContract calls the contract at addr on behalf of the current contract, transferring
+// value from the current contract. A gas of zero forwards all the gas allowed.
+// CallValue returns the value transferred to the contract by the current call.
+func (abs *absBuiltinContract) CallValue() *big.Int {
+	if abs.vm == nil || len(abs.vm.ctx.values) == 0 {
+		return new(big.Int)
+	}
+	values := abs.vm.ctx.values
+	if value := values[len(values)-1]; value != nil {
+		return new(big.Int).Set(value)
+	}
+	return new(big.Int)
+}
+
+func (abs *absBuiltinContract) CallContract(addr common.Address, value *big.Int, gas uint64, input []byte) ([]byte, error) {
+	if abs.vm == nil {
+		return nil, errUnknownContractExec
+	}
+	return abs.vm.innerCall(abs.addr, addr, value, gas, input)
+}
+
+// StaticCallContract calls the contract at addr on behalf of the current contract, the
+// call fails when it tries to modify the state.
+func (abs *absBuiltinContract) StaticCallContract(addr common.Address, gas uint64, input []byte) ([]byte, error) {
+	if abs.vm == nil {
+		return nil, errUnknownContractExec
+	}
+	return abs.vm.innerStaticCall(abs.addr, addr, gas, input)
+}
+
+// Emit appends a log with the given topics and data to the transaction receipt. The logs
+// of a call are dropped when the call fails.
+func (abs *absBuiltinContract) Emit(topics []common.Hash, data []byte) error {
+	if abs.vm == nil {
+		return errUnknownContractExec
+	}
+	return abs.vm.emit(abs.addr, topics, data)
+}
+
+// GetStorage reads a storage slot of the contract directly, contracts keeping a growing
+// number of entries use it instead of loading a whole storage field on every call.
+func (abs *absBuiltinContract) GetStorage(key common.Hash) []byte {
+	if abs.st == nil {
+		return nil
+	}
+	accessSlot(abs.st, abs.addr, key)
+	return abs.st.GetStateValue(abs.addr, key)
+}
+
+// SetStorage writes a storage slot of the contract, it fails in a read only call.
+func (abs *absBuiltinContract) SetStorage(key common.Hash, val []byte) error {
+	if abs.st == nil {
+		return errUnknownContractExec
+	}
+	if abs.vm != nil && abs.vm.ctx.static {
+		return errWriteProtection
+	}
+	accessSlot(abs.st, abs.addr, key)
+	abs.st.SetState(abs.addr, key, val)
+	return nil
+}
+
+func storageSlotPreimage(prefix []byte, key []byte) []byte {
+	buf := make([]byte, 0, len(prefix)+len(key))
+	buf = append(buf, prefix...)
+	return append(buf, key...)
+}
+
+// storageSlot returns the slot of the entry with the key in the set of entries with the prefix.
+func storageSlot(prefix []byte, key []byte) common.Hash {
+	return common.Bytes2Hash(ahash.SHA256(storageSlotPreimage(prefix, key)))
+}
+
+// StorageSlot returns the slot like storageSlot does, the preimage of the slot is
+// recorded by the state tree.
+func (abs *absBuiltinContract) StorageSlot(prefix []byte, key []byte) common.Hash {
+	preimage := storageSlotPreimage(prefix, key)
+	slot := common.Bytes2Hash(ahash.SHA256(preimage))
+	addPreimage(abs.st, slot, preimage)
+	return slot
+}
+
+// addPreimage records the preimage of the hash if the state tree records preimages.
+func addPreimage(st core.StateTree, hash common.Hash, preimage []byte) {
+	if recorder, ok := st.(core.PreimageState); ok {
+		recorder.AddPreimage(hash, preimage)
+	}
+}
+
+// accessAddress adds the address to the access list if the state tree tracks one.
+func accessAddress(st core.StateTree, addr common.Address) {
+	if al, ok := st.(core.AccessListState); ok {
+		al.AddAddressToAccessList(addr)
+	}
+}
+
+// accessSlot adds the storage slot of the address to the access list if the state tree
+// tracks one.
+func accessSlot(st core.StateTree, addr common.Address, slot [32]byte) {
+	if al, ok := st.(core.AccessListState); ok {
+		al.AddSlotToAccessList(addr, slot)
+	}
+}
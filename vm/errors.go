@@ -0,0 +1,60 @@
+package vm
+
+import "errors"
+
+// Error codes of a failed contract execution, they are recorded in the
+// receipt of the transaction and returned by the RPC.
+const (
+	ErrCodeNone                = 0
+	ErrCodeOutOfGas            = 1
+	ErrCodeStackOverflow       = 2
+	ErrCodeInvalidOpcode       = 3
+	ErrCodeRevert              = 4
+	ErrCodeWriteProtection     = 5
+	ErrCodeInsufficientBalance = 6
+	ErrCodeAborted             = 7
+)
+
+var errWriteProtection = errors.New("write protection")
+
+var errorCodeNames = map[int]string{
+	ErrCodeNone:                "none",
+	ErrCodeOutOfGas:            "out of gas",
+	ErrCodeStackOverflow:       "stack overflow",
+	ErrCodeInvalidOpcode:       "invalid opcode",
+	ErrCodeRevert:              "revert",
+	ErrCodeWriteProtection:     "write protection",
+	ErrCodeInsufficientBalance: "insufficient balance",
+	ErrCodeAborted:             "aborted",
+}
+
+// ErrorCode returns the error code of an error returned by the vm. Errors returned
+// by the contract itself are reported as ErrCodeRevert.
+func ErrorCode(err error) int {
+	switch err {
+	case nil:
+		return ErrCodeNone
+	case errOutOfGas:
+		return ErrCodeOutOfGas
+	case errCallDepth, errStackOverflow:
+		return ErrCodeStackOverflow
+	case errUnknownMagicNumber, errUnknownContractId, errUnknownContractExec,
+		errInvalidContractCode, errInvalidOpcode, errNotfoundCreateFn, errNotfoundMethod, errUnsupportedType:
+		return ErrCodeInvalidOpcode
+	case errWriteProtection:
+		return ErrCodeWriteProtection
+	case errInsufficientBalance:
+		return ErrCodeInsufficientBalance
+	case errExecutionAborted:
+		return ErrCodeAborted
+	}
+	return ErrCodeRevert
+}
+
+// ErrorCodeName returns a readable name of the error code.
+func ErrorCodeName(code int) string {
+	if name, exists := errorCodeNames[code]; exists {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,236 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+// states of an escrow
+const (
+	escrowCreated uint8 = iota
+	escrowFunded
+	escrowDisputed
+	escrowReleased
+	escrowRefunded
+)
+
+var (
+	errEscrowParties   = errors.New("invalid escrow parties")
+	errEscrowDeadline  = errors.New("invalid escrow deadline")
+	errEscrowNotParty  = errors.New("caller is not allowed to settle the escrow")
+	errEscrowState     = errors.New("invalid escrow state")
+	errEscrowNoValue   = errors.New("no value funded")
+	errEscrowValue     = errors.New("escrow method does not accept value")
+	escrowFundTopic    = common.Bytes2Hash(ahash.SHA256([]byte("Fund")))
+	escrowDisputeTopic = common.Bytes2Hash(ahash.SHA256([]byte("Dispute")))
+	escrowReleaseTopic = common.Bytes2Hash(ahash.SHA256([]byte("Release")))
+	escrowRefundTopic  = common.Bytes2Hash(ahash.SHA256([]byte("Refund")))
+	escrowSettledSlot  = storageSlot([]byte("escrow.settled"), nil)
+)
+
+// escrowContract holds the value paid by a buyer to a seller until the deal is settled,
+// a settlement needs the consent of two of the buyer, the seller and the arbiter. The
+// consent of the party receiving the value is implied: the buyer releases the value to
+// the seller, the seller refunds it to the buyer, and the arbiter settles a dispute
+// either way.
+//
+// The buyer may dispute the escrow until the deadline, the seller may dispute it any
+// time before it is settled. An escrow not disputed by the deadline is released to the
+// seller on its own request. Only Fund accepts value, the other calls transferring value
+// fail so it can't be locked in the contract.
+type escrowContract struct {
+	BuiltinContract
+	Buyer    CTypeAddress `contract:"storage"`
+	Seller   CTypeAddress `contract:"storage"`
+	Arbiter  CTypeAddress `contract:"storage"`
+	Deadline CTypeUint64  `contract:"storage"`
+	Amount   CTypeUint256 `contract:"storage"`
+	State    CTypeUint8   `contract:"storage"`
+}
+
+// EscrowSettlement is the data of the events of an escrow.
+type EscrowSettlement struct {
+	Caller    common.Address `json:"caller"`
+	Recipient common.Address `json:"recipient"`
+	Amount    *big.Int       `json:"amount"`
+}
+
+func (e *escrowContract) BuiltinId() uint8 {
+	return 0x05
+}
+
+// Create opens an escrow of the caller as buyer with the seller and the arbiter, the
+// deadline is a block timestamp.
+func (e *escrowContract) Create(
+	seller CTypeAddress,
+	arbiter CTypeAddress,
+	deadline CTypeUint64) error {
+	if e.CallValue().Sign() != 0 {
+		return errEscrowValue
+	}
+	buyer := CTypeAddress(e.Caller())
+	if seller == buyer || arbiter == buyer || arbiter == seller {
+		return errEscrowParties
+	}
+	if seller == (CTypeAddress{}) || arbiter == (CTypeAddress{}) {
+		return errEscrowParties
+	}
+	if deadline.Uint64() <= e.BlockTimestamp() {
+		return errEscrowDeadline
+	}
+	e.Buyer = buyer
+	e.Seller = seller
+	e.Arbiter = arbiter
+	e.Deadline = deadline
+	e.State = NewUint8(escrowCreated)
+	return nil
+}
+
+func (e *escrowContract) emit(topic common.Hash, recipient common.Address, amount *big.Int) error {
+	event, err := json.Marshal(&EscrowSettlement{
+		Caller:    e.Caller(),
+		Recipient: recipient,
+		Amount:    amount,
+	})
+	if err != nil {
+		return err
+	}
+	return e.Emit([]common.Hash{topic}, event)
+}
+
+// Fund locks the value of the call in the escrow, only the buyer may fund it once.
+func (e *escrowContract) Fund() error {
+	if e.Caller() != e.Buyer.Address() {
+		return errEscrowNotParty
+	}
+	if e.State.uint8() != escrowCreated {
+		return errEscrowState
+	}
+	value := e.CallValue()
+	if value.Sign() <= 0 {
+		return errEscrowNoValue
+	}
+	e.Amount = uint256Of(value)
+	e.State = NewUint8(escrowFunded)
+	return e.emit(escrowFundTopic, e.GetAddress(), value)
+}
+
+// Dispute leaves the settlement of the escrow to the arbiter.
+func (e *escrowContract) Dispute() error {
+	if e.CallValue().Sign() != 0 {
+		return errEscrowValue
+	}
+	if e.State.uint8() != escrowFunded {
+		return errEscrowState
+	}
+	switch e.Caller() {
+	case e.Buyer.Address():
+		if e.BlockTimestamp() > e.Deadline.Uint64() {
+			return errEscrowDeadline
+		}
+	case e.Seller.Address():
+	default:
+		return errEscrowNotParty
+	}
+	e.State = NewUint8(escrowDisputed)
+	return e.emit(escrowDisputeTopic, e.Arbiter.Address(), e.Amount.BigInt())
+}
+
+// settle pays out the escrow. The storage fields are only written when the call
+// returns, the settlement is marked in a slot of its own before the payment so a call
+// back from the recipient can not settle it again.
+func (e *escrowContract) settle(state uint8, topic common.Hash, recipient common.Address) error {
+	if e.GetStorage(escrowSettledSlot) != nil {
+		return errEscrowState
+	}
+	if err := e.SetStorage(escrowSettledSlot, []byte{state}); err != nil {
+		return err
+	}
+	amount := e.Amount.BigInt()
+	e.State = NewUint8(state)
+	e.Amount = CTypeUint256{}
+	if _, err := e.CallContract(recipient, amount, 0, nil); err != nil {
+		return err
+	}
+	return e.emit(topic, recipient, amount)
+}
+
+// Release pays the value of the escrow to the seller. The buyer may release it any
+// time, the arbiter once it is disputed and the seller after the deadline unless it
+// is disputed.
+func (e *escrowContract) Release() error {
+	if e.CallValue().Sign() != 0 {
+		return errEscrowValue
+	}
+	state := e.State.uint8()
+	if state != escrowFunded && state != escrowDisputed {
+		return errEscrowState
+	}
+	switch e.Caller() {
+	case e.Buyer.Address():
+	case e.Arbiter.Address():
+		if state != escrowDisputed {
+			return errEscrowNotParty
+		}
+	case e.Seller.Address():
+		if state != escrowFunded || e.BlockTimestamp() <= e.Deadline.Uint64() {
+			return errEscrowNotParty
+		}
+	default:
+		return errEscrowNotParty
+	}
+	return e.settle(escrowReleased, escrowReleaseTopic, e.Seller.Address())
+}
+
+// Refund pays the value of the escrow back to the buyer. The seller may refund it any
+// time, the arbiter once it is disputed.
+func (e *escrowContract) Refund() error {
+	if e.CallValue().Sign() != 0 {
+		return errEscrowValue
+	}
+	state := e.State.uint8()
+	if state != escrowFunded && state != escrowDisputed {
+		return errEscrowState
+	}
+	switch e.Caller() {
+	case e.Seller.Address():
+	case e.Arbiter.Address():
+		if state != escrowDisputed {
+			return errEscrowNotParty
+		}
+	default:
+		return errEscrowNotParty
+	}
+	return e.settle(escrowRefunded, escrowRefundTopic, e.Buyer.Address())
+}
+
+func (e *escrowContract) GetState() CTypeUint8 {
+	return e.State
+}
+
+func (e *escrowContract) GetAmount() CTypeUint256 {
+	return e.Amount
+}
+
+func (e *escrowContract) GetDeadline() CTypeUint64 {
+	return e.Deadline
+}
@@ -0,0 +1,158 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+var (
+	testBuyer   = common.Address{0x01}
+	testSeller  = common.Address{0x02}
+	testArbiter = common.Address{0x03}
+)
+
+func createTestEscrow(t *testing.T, vm *xvm, deadline uint64) common.Address {
+	input := bytes.NewBuffer(nil)
+	input.Write([]byte{0xd0, 0x23, 0x05})
+	input.Write(mustEncodeCall("Create",
+		CTypeAddress(testSeller), CTypeAddress(testArbiter), NewUint64(deadline)))
+	caddr := crypto.CreateAddress(testBuyer.Hash(), vm.stateTree.GetNonce(testBuyer))
+	if err := vm.Create(testBuyer, input.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	vm.stateTree.AddNonce(testBuyer, 1)
+	return caddr
+}
+
+func newTestEscrow(t *testing.T, funds int64) (*xvm, common.Address) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Timestamp: 1000, Builtins: testBuiltins})
+	vm.SetGas(1000000)
+	vm.stateTree.AddBalance(testBuyer, big.NewInt(100))
+	escrow := createTestEscrow(t, vm, 2000)
+	if funds > 0 {
+		if err := vm.Call(testBuyer, escrow, big.NewInt(funds), mustEncodeCall("Fund")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vm, escrow
+}
+
+func escrowState(t *testing.T, vm *xvm, escrow common.Address) uint8 {
+	if err := vm.StaticCall(testBuyer, escrow, mustEncodeCall("GetState")); err != nil {
+		t.Fatal(err)
+	}
+	return vm.ReturnData()[0]
+}
+
+func TestEscrowContract_Create(t *testing.T) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Timestamp: 1000, Builtins: testBuiltins})
+	input := append([]byte{0xd0, 0x23, 0x05}, mustEncodeCall("Create",
+		CTypeAddress(testSeller), CTypeAddress(testBuyer), NewUint64(2000))...)
+	if err := vm.Create(testBuyer, input); err != errEscrowParties {
+		t.Fatalf("want errEscrowParties, got %v", err)
+	}
+	input = append([]byte{0xd0, 0x23, 0x05}, mustEncodeCall("Create",
+		CTypeAddress(testSeller), CTypeAddress(testArbiter), NewUint64(1000))...)
+	if err := vm.Create(testBuyer, input); err != errEscrowDeadline {
+		t.Fatalf("want errEscrowDeadline, got %v", err)
+	}
+}
+
+func TestEscrowContract_Release(t *testing.T) {
+	vm, escrow := newTestEscrow(t, 0)
+	if err := vm.Call(testSeller, escrow, nil, mustEncodeCall("Release")); err != errEscrowState {
+		t.Fatalf("want errEscrowState of unfunded escrow, got %v", err)
+	}
+	if err := vm.Call(testBuyer, escrow, nil, mustEncodeCall("Fund")); err != errEscrowNoValue {
+		t.Fatalf("want errEscrowNoValue, got %v", err)
+	}
+	if err := vm.Call(testBuyer, escrow, big.NewInt(60), mustEncodeCall("Fund")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, escrowState(t, vm, escrow), escrowFunded)
+	if err := vm.Call(testBuyer, escrow, big.NewInt(10), mustEncodeCall("Fund")); err != errEscrowState {
+		t.Fatalf("want errEscrowState of funded escrow, got %v", err)
+	}
+	// neither the seller before the deadline nor the arbiter without a dispute release it
+	if err := vm.Call(testSeller, escrow, nil, mustEncodeCall("Release")); err != errEscrowNotParty {
+		t.Fatalf("want errEscrowNotParty, got %v", err)
+	}
+	if err := vm.Call(testArbiter, escrow, nil, mustEncodeCall("Release")); err != errEscrowNotParty {
+		t.Fatalf("want errEscrowNotParty, got %v", err)
+	}
+	if err := vm.Call(testBuyer, escrow, nil, mustEncodeCall("Release")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, escrowState(t, vm, escrow), escrowReleased)
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(testSeller), big.NewInt(60))
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(escrow), big.NewInt(0))
+	if err := vm.Call(testSeller, escrow, nil, mustEncodeCall("Refund")); err != errEscrowState {
+		t.Fatalf("want errEscrowState of settled escrow, got %v", err)
+	}
+	assert.Equal(t, len(vm.Logs()), 2)
+}
+
+func TestEscrowContract_Refund(t *testing.T) {
+	vm, escrow := newTestEscrow(t, 60)
+	if err := vm.Call(testBuyer, escrow, nil, mustEncodeCall("Refund")); err != errEscrowNotParty {
+		t.Fatalf("want errEscrowNotParty, got %v", err)
+	}
+	if err := vm.Call(testSeller, escrow, nil, mustEncodeCall("Refund")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, escrowState(t, vm, escrow), escrowRefunded)
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(testBuyer), big.NewInt(100))
+}
+
+func TestEscrowContract_Value(t *testing.T) {
+	vm, escrow := newTestEscrow(t, 60)
+	// only the funding of the escrow accepts value
+	for _, call := range []struct {
+		sender common.Address
+		method string
+	}{{testBuyer, "Dispute"}, {testBuyer, "Release"}, {testSeller, "Refund"}} {
+		vm.stateTree.AddBalance(call.sender, big.NewInt(1))
+		if err := vm.Call(call.sender, escrow, big.NewInt(1), mustEncodeCall(call.method)); err != errEscrowValue {
+			t.Fatalf("%s: want errEscrowValue, got %v", call.method, err)
+		}
+	}
+	assert.Equal(t, escrowState(t, vm, escrow), escrowFunded)
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(escrow), big.NewInt(60))
+}
+
+func TestEscrowContract_Dispute(t *testing.T) {
+	vm, escrow := newTestEscrow(t, 60)
+	if err := vm.Call(testArbiter, escrow, nil, mustEncodeCall("Dispute")); err != errEscrowNotParty {
+		t.Fatalf("want errEscrowNotParty, got %v", err)
+	}
+	if err := vm.Call(testBuyer, escrow, nil, mustEncodeCall("Dispute")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, escrowState(t, vm, escrow), escrowDisputed)
+	// a disputed escrow is not released to the seller after the deadline
+	vm.ctx.block.Timestamp = 2001
+	if err := vm.Call(testSeller, escrow, nil, mustEncodeCall("Release")); err != errEscrowNotParty {
+		t.Fatalf("want errEscrowNotParty, got %v", err)
+	}
+	if err := vm.Call(testArbiter, escrow, nil, mustEncodeCall("Refund")); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(testBuyer), big.NewInt(100))
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(escrow), big.NewInt(0))
+}
+
+func TestEscrowContract_Deadline(t *testing.T) {
+	vm, escrow := newTestEscrow(t, 60)
+	vm.ctx.block.Timestamp = 2001
+	if err := vm.Call(testBuyer, escrow, nil, mustEncodeCall("Dispute")); err != errEscrowDeadline {
+		t.Fatalf("want errEscrowDeadline, got %v", err)
+	}
+	if err := vm.Call(testSeller, escrow, nil, mustEncodeCall("Release")); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(testSeller), big.NewInt(60))
+}
@@ -24,7 +24,7 @@ const contractStorage = "storage"
 
 type ContractExec interface {
 	Create(input []byte) (err error)
-	Call(input []byte) (err error)
+	Call(input []byte) (ret []byte, err error)
 }
 
 type builtinContractExec struct {
@@ -32,24 +32,44 @@ type builtinContractExec struct {
 	stateTree core.StateTree
 	address   common.Address
 	contractT reflect.Type
+	vm        *xvm
 	resultBuf Buffer
 }
 
+var builtinContractT = reflect.TypeOf((*BuiltinContract)(nil)).Elem()
+
+// isHelperMethod reports whether the method is provided by the vm to the
+// contract, such methods are not callable by transactions.
+func isHelperMethod(name string) bool {
+	_, exists := builtinContractT.MethodByName(name)
+	return exists
+}
+
 type stv struct {
 	reflect.StructField
 	nameHash [32]byte
 	val      reflect.Value
 }
 
+var errorT = reflect.TypeOf((*error)(nil)).Elem()
+
 func (ce *builtinContractExec) goReturn(vs []reflect.Value) error {
 	for i := 0; i < len(vs); i++ {
-		if vs[i].IsNil() {
+		v := vs[i]
+		if v.Type() == errorT {
+			if !v.IsNil() {
+				return v.Interface().(error)
+			}
 			continue
 		}
-		if err, ok := vs[i].Interface().(error); ok {
-			return err
+		switch {
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			_, _ = ce.resultBuf.Write(v.Bytes())
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+			bs := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(bs), v)
+			_, _ = ce.resultBuf.Write(bs)
 		}
-		_, _ = ce.resultBuf.Write(vs[i].Bytes())
 	}
 	return nil
 }
@@ -63,6 +83,7 @@ func (ce *builtinContractExec) buildContract() (bc BuiltinContract, err error) {
 }
 func (ce *builtinContractExec) call(fn reflect.Method, fnv reflect.Value, input []byte) error {
 	buf := NewBuffer(input)
+	buf.legacy = ce.vm != nil && ce.vm.ctx.block.Legacy
 	mType := fn.Type
 	n := mType.NumIn()
 
@@ -92,12 +113,78 @@ func (ce *builtinContractExec) call(fn reflect.Method, fnv reflect.Value, input
 				return err
 			}
 			args = append(args, reflect.ValueOf(m))
+		case reflect.TypeOf(CTypeBool{}):
+			m, err := buf.ReadUint8()
+			if err != nil {
+				return err
+			}
+			args = append(args, reflect.ValueOf(CTypeBool(m)))
+		case reflect.TypeOf(CTypeUint16{}):
+			m, err := buf.ReadUint16()
+			if err != nil {
+				return err
+			}
+			args = append(args, reflect.ValueOf(m))
+		case reflect.TypeOf(CTypeUint32{}):
+			m, err := buf.ReadUint32()
+			if err != nil {
+				return err
+			}
+			args = append(args, reflect.ValueOf(m))
+		case reflect.TypeOf(CTypeUint64{}):
+			m, err := buf.ReadUint64()
+			if err != nil {
+				return err
+			}
+			args = append(args, reflect.ValueOf(m))
+		case reflect.TypeOf(CTypeAddress{}):
+			s, err := buf.ReadString(len(CTypeAddress{}))
+			if err != nil {
+				return err
+			}
+			var m CTypeAddress
+			copy(m[:], s)
+			args = append(args, reflect.ValueOf(m))
+		default:
+			return errUnsupportedType
 		}
 	}
 	r := fnv.Call(args)
 	return ce.goReturn(r)
 }
 
+// EncodeCall returns the input calling the method of a builtin contract with the
+// arguments, which are encoded the way call decodes them. Every argument starts a new row.
+func EncodeCall(method string, args ...interface{}) ([]byte, error) {
+	buf := NewBuffer(nil)
+	_, _ = buf.Write(ahash.SHA256([]byte(method)))
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case CTypeString:
+			size := NewUint32(uint32(len(v)))
+			_, _ = buf.Write(size[:])
+			_, _ = buf.Write(v)
+		case CTypeUint8:
+			_, _ = buf.Write(v[:])
+		case CTypeUint16:
+			_, _ = buf.Write(v[:])
+		case CTypeUint32:
+			_, _ = buf.Write(v[:])
+		case CTypeUint64:
+			_, _ = buf.Write(v[:])
+		case CTypeUint256:
+			_, _ = buf.Write(v[:])
+		case CTypeBool:
+			_, _ = buf.Write(v[:])
+		case CTypeAddress:
+			_, _ = buf.Write(v[:])
+		default:
+			return nil, errUnsupportedType
+		}
+	}
+	return buf.Bytes(), nil
+}
+
 func (ce *builtinContractExec) updateContractState(stvs []*stv) (err error) {
 	for i := 0; i < len(stvs); i++ {
 		st := stvs[i]
@@ -109,6 +196,14 @@ func (ce *builtinContractExec) updateContractState(stvs []*stv) (err error) {
 		if err != nil {
 			return err
 		}
+		accessSlot(ce.stateTree, ce.address, st.nameHash)
+		if ce.vm != nil && ce.vm.ctx.static {
+			if !bytes.Equal(ce.stateTree.GetStateValue(ce.address, st.nameHash), jb) {
+				return errWriteProtection
+			}
+			continue
+		}
+		addPreimage(ce.stateTree, st.nameHash, []byte(st.Name))
 		ce.stateTree.SetState(ce.address, st.nameHash, jb)
 		//fmt.Printf("name: %s, hash: %x, type: %v, val: %s\n", st.Name, st.nameHash[:], st.Type, string(jb))
 	}
@@ -121,6 +216,9 @@ func (ce *builtinContractExec) callFn(c BuiltinContract, stvs []*stv, fn common.
 			sf := ce.contractT.Method(i)
 			aname := sf.Name
 			namehash := ahash.SHA256([]byte(aname))
+			if isHelperMethod(aname) {
+				continue
+			}
 			if sf.Type.Kind() == reflect.Func && bytes.Equal(hash[:], namehash) {
 				mv := cv.MethodByName(aname)
 				return sf, mv, true
@@ -163,8 +261,11 @@ func (ce *builtinContractExec) exec(input []byte) error {
 	}
 	return ce.callFn(bc, stvs, fn, buf.Bytes())
 }
-func (ce *builtinContractExec) Call(input []byte) error {
-	return ce.exec(input)
+func (ce *builtinContractExec) Call(input []byte) ([]byte, error) {
+	if err := ce.exec(input); err != nil {
+		return nil, err
+	}
+	return ce.resultBuf.Bytes(), nil
 }
 
 func (ce *builtinContractExec) Create(input []byte) error {
@@ -198,6 +299,7 @@ func (ce *builtinContractExec) setupContract(c interface{}, stvs []*stv) (err er
 	buf.WriteString("{")
 	for i := 0; i < len(stvs); i++ {
 		st := stvs[i]
+		accessSlot(ce.stateTree, ce.address, st.nameHash)
 		data := ce.stateTree.GetStateValue(ce.address, st.nameHash)
 		if data == nil {
 			continue
@@ -214,8 +316,24 @@ func (ce *builtinContractExec) setupContract(c interface{}, stvs []*stv) (err er
 	err = json.Unmarshal([]byte(bs), &c)
 	return
 }
+
+// setupHelper fills the embedded BuiltinContract of the contract with the vm provided helper.
+func (ce *builtinContractExec) setupHelper(cve reflect.Value) {
+	field := cve.FieldByName("BuiltinContract")
+	if !field.IsValid() || !field.CanSet() || field.Type() != builtinContractT {
+		return
+	}
+	helper := &absBuiltinContract{
+		st:   ce.stateTree,
+		addr: ce.address,
+		vm:   ce.vm,
+	}
+	field.Set(reflect.ValueOf(helper))
+}
+
 func (ce *builtinContractExec) MakeBuiltinContract() (BuiltinContract, []*stv, error) {
 	cv := reflect.New(ce.contractT.Elem())
+	ce.setupHelper(cv.Elem())
 
 	stvs := ce.findContractStorageValue(cv.Elem())
 	if err := ce.setupContract(cv.Interface(), stvs); err != nil {
@@ -0,0 +1,260 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/crypto"
+)
+
+const (
+	// maxOracleReporters is the maximum number of reporters of an oracle.
+	maxOracleReporters = 32
+	// maxOracleKeySize is the maximum size of the key of a data feed.
+	maxOracleKeySize = 64
+	// maxOracleDrift is how far in seconds the timestamp of a data point may be ahead
+	// of the block timestamp.
+	maxOracleDrift = 15 * 60
+	// oracleReportSize is the size of a stored data point, the value and the timestamp.
+	oracleReportSize = 32 + 8
+)
+
+var (
+	errOracleNotOwner    = errors.New("caller is not the oracle owner")
+	errOracleReporters   = errors.New("invalid oracle reporters")
+	errOracleNotReporter = errors.New("signer is not an oracle reporter")
+	errOracleBadKey      = errors.New("invalid data feed key")
+	errOracleStale       = errors.New("data point older than the last one of the reporter")
+	errOracleFuture      = errors.New("data point timestamp too far in the future")
+	errOracleNoQuorum    = errors.New("not enough fresh data points")
+	oracleReportTopic    = common.Bytes2Hash(ahash.SHA256([]byte("Report")))
+	oracleReportSlotPre  = []byte("oracle.report")
+	oracleDataHashPrefix = []byte("xfsgo oracle data point")
+)
+
+// oracleContract is a data feed of signed external data points. Whitelisted reporters
+// sign (key, value, timestamp) data points off chain, anyone may submit a signed data
+// point. The value of a feed is the median of the fresh data points of the reporters,
+// other contracts read it with a static call of Value.
+//
+// The last data point of every reporter of a feed is kept in a storage slot of its own.
+type oracleContract struct {
+	BuiltinContract
+	Owner      CTypeAddress               `contract:"storage"`
+	Reporters  map[CTypeAddress]CTypeBool `contract:"storage"`
+	MinReports CTypeUint8                 `contract:"storage"`
+	// MaxAge is the age in seconds after which a data point is not used, 0 disables it.
+	MaxAge CTypeUint64 `contract:"storage"`
+}
+
+// OracleReport is the data of the event of a submitted data point.
+type OracleReport struct {
+	Key       string         `json:"key"`
+	Reporter  common.Address `json:"reporter"`
+	Value     *big.Int       `json:"value"`
+	Timestamp uint64         `json:"timestamp"`
+}
+
+func (o *oracleContract) BuiltinId() uint8 {
+	return 0x03
+}
+
+// OracleDataHash returns the hash a reporter signs for a data point of the oracle at
+// the address.
+func OracleDataHash(oracle common.Address, key []byte, value *big.Int, timestamp uint64) common.Hash {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(oracleDataHashPrefix)
+	buf.Write(oracle[:])
+	v := uint256Of(value)
+	buf.Write(v[:])
+	buf.Write(heightKey(timestamp))
+	buf.Write(key)
+	return common.Bytes2Hash(ahash.SHA256(buf.Bytes()))
+}
+
+// uint256Of returns the value as a big endian CTypeUint256, the value must fit in 256 bits.
+func uint256Of(v *big.Int) (m CTypeUint256) {
+	v.FillBytes(m[:])
+	return
+}
+
+func (o *oracleContract) onlyOwner() error {
+	if o.Caller() != o.Owner.Address() {
+		return errOracleNotOwner
+	}
+	return nil
+}
+
+func (o *oracleContract) reportSlot(key []byte, reporter CTypeAddress) common.Hash {
+	return o.StorageSlot(oracleReportSlotPre, append(reporter[:], key...))
+}
+
+// report returns the last data point of the reporter for the feed.
+func (o *oracleContract) report(key []byte, reporter CTypeAddress) (value *big.Int, timestamp uint64, ok bool) {
+	data := o.GetStorage(o.reportSlot(key, reporter))
+	if len(data) != oracleReportSize {
+		return nil, 0, false
+	}
+	var ts CTypeUint64
+	copy(ts[:], data[32:])
+	return new(big.Int).SetBytes(data[:32]), ts.Uint64(), true
+}
+
+// Create sets the reporters given as a JSON list of addresses and the number of fresh
+// data points a feed needs to have a value. The creator owns the oracle.
+func (o *oracleContract) Create(
+	reporters CTypeString,
+	minReports CTypeUint8,
+	maxAge CTypeUint64) error {
+	var addrs []string
+	if err := json.Unmarshal(reporters, &addrs); err != nil {
+		return errOracleReporters
+	}
+	if len(addrs) == 0 || len(addrs) > maxOracleReporters {
+		return errOracleReporters
+	}
+	o.Owner = CTypeAddress(o.Caller())
+	o.Reporters = make(map[CTypeAddress]CTypeBool)
+	for _, addr := range addrs {
+		if err := common.AddrCalibrator(addr); err != nil {
+			return errOracleReporters
+		}
+		o.Reporters[CTypeAddress(common.StrB58ToAddress(addr))] = CTypeBool{1}
+	}
+	if minReports.uint8() == 0 || int(minReports.uint8()) > len(o.Reporters) {
+		return errOracleReporters
+	}
+	o.MinReports = minReports
+	o.MaxAge = maxAge
+	return nil
+}
+
+// AddReporter whitelists the reporter, only the owner may call it.
+func (o *oracleContract) AddReporter(reporter CTypeAddress) error {
+	if err := o.onlyOwner(); err != nil {
+		return err
+	}
+	if _, exists := o.Reporters[reporter]; !exists && len(o.Reporters) >= maxOracleReporters {
+		return errOracleReporters
+	}
+	o.Reporters[reporter] = CTypeBool{1}
+	return nil
+}
+
+// RemoveReporter removes the reporter from the whitelist, its data points are no longer
+// used. Only the owner may call it.
+func (o *oracleContract) RemoveReporter(reporter CTypeAddress) error {
+	if err := o.onlyOwner(); err != nil {
+		return err
+	}
+	if _, exists := o.Reporters[reporter]; !exists {
+		return errOracleNotReporter
+	}
+	if len(o.Reporters)-1 < int(o.MinReports.uint8()) {
+		return errOracleReporters
+	}
+	delete(o.Reporters, reporter)
+	return nil
+}
+
+// Submit stores a data point signed by a reporter. The data point replaces the last one
+// of the reporter for the feed and must be newer.
+func (o *oracleContract) Submit(
+	key CTypeString,
+	value CTypeUint256,
+	timestamp CTypeUint64,
+	sig CTypeString) error {
+	if len(key) == 0 || len(key) > maxOracleKeySize {
+		return errOracleBadKey
+	}
+	ts := timestamp.Uint64()
+	if ts > o.BlockTimestamp()+maxOracleDrift {
+		return errOracleFuture
+	}
+	hash := OracleDataHash(o.GetAddress(), key, value.BigInt(), ts)
+	pub, err := crypto.SigToPub(hash[:], sig)
+	if err != nil {
+		return errOracleNotReporter
+	}
+	signer := crypto.DefaultPubKey2Addr(*pub)
+	reporter := CTypeAddress(signer)
+	if _, exists := o.Reporters[reporter]; !exists {
+		return errOracleNotReporter
+	}
+	if _, last, ok := o.report(key, reporter); ok && ts <= last {
+		return errOracleStale
+	}
+	data := make([]byte, 0, oracleReportSize)
+	data = append(data, value[:]...)
+	data = append(data, timestamp[:]...)
+	if err = o.SetStorage(o.reportSlot(key, reporter), data); err != nil {
+		return err
+	}
+	event, err := json.Marshal(&OracleReport{
+		Key:       key.String(),
+		Reporter:  signer,
+		Value:     value.BigInt(),
+		Timestamp: ts,
+	})
+	if err != nil {
+		return err
+	}
+	return o.Emit([]common.Hash{oracleReportTopic, common.Bytes2Hash(ahash.SHA256(key))}, event)
+}
+
+// Value returns the median of the fresh data points of the reporters for the feed, with
+// an even number of data points it is the mean of the two middle ones.
+func (o *oracleContract) Value(key CTypeString) (CTypeUint256, error) {
+	now := o.BlockTimestamp()
+	maxAge := o.MaxAge.Uint64()
+	values := make([]*big.Int, 0, len(o.Reporters))
+	for reporter := range o.Reporters {
+		value, ts, ok := o.report(key, reporter)
+		if !ok || (maxAge > 0 && ts+maxAge < now) {
+			continue
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 || len(values) < int(o.MinReports.uint8()) {
+		return CTypeUint256{}, errOracleNoQuorum
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Cmp(values[j]) < 0
+	})
+	mid := len(values) / 2
+	if len(values)%2 == 1 {
+		return uint256Of(values[mid]), nil
+	}
+	median := new(big.Int).Add(values[mid-1], values[mid])
+	return uint256Of(median.Rsh(median, 1)), nil
+}
+
+// GetReport returns the last data point of the reporter for the feed, the big endian
+// value followed by the timestamp.
+func (o *oracleContract) GetReport(key CTypeString, reporter CTypeAddress) []byte {
+	return o.GetStorage(o.reportSlot(key, reporter))
+}
+
+func (o *oracleContract) IsReporter(addr CTypeAddress) CTypeBool {
+	return o.Reporters[addr]
+}
@@ -0,0 +1,168 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+type testReporter struct {
+	key  *ecdsa.PrivateKey
+	addr common.Address
+}
+
+func newTestReporters(t *testing.T, n int) []*testReporter {
+	reporters := make([]*testReporter, n)
+	for i := range reporters {
+		key, err := crypto.GenPrvKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reporters[i] = &testReporter{key: key, addr: crypto.DefaultPubKey2Addr(key.PublicKey)}
+	}
+	return reporters
+}
+
+func (r *testReporter) submitInput(t *testing.T, oracle common.Address, key string, value int64, ts uint64) []byte {
+	hash := OracleDataHash(oracle, []byte(key), big.NewInt(value), ts)
+	sig, err := crypto.ECDSASign(hash[:], r.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mustEncodeCall("Submit", CTypeString(key), uint256Of(big.NewInt(value)), NewUint64(ts), CTypeString(sig))
+}
+
+func createTestOracle(t *testing.T, vm *xvm, sender common.Address, reporters []*testReporter, minReports uint8) common.Address {
+	addrs := make([]string, len(reporters))
+	for i, r := range reporters {
+		addrs[i] = r.addr.B58String()
+	}
+	list, _ := json.Marshal(addrs)
+	input := bytes.NewBuffer(nil)
+	input.Write([]byte{0xd0, 0x23, 0x03})
+	input.Write(mustEncodeCall("Create", CTypeString(list), NewUint8(minReports), NewUint64(100)))
+	caddr := crypto.CreateAddress(sender.Hash(), vm.stateTree.GetNonce(sender))
+	if err := vm.Create(sender, input.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	vm.stateTree.AddNonce(sender, 1)
+	return caddr
+}
+
+func oracleValue(vm *xvm, sender, oracle common.Address, key string) (*big.Int, error) {
+	if err := vm.StaticCall(sender, oracle, mustEncodeCall("Value", CTypeString(key))); err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(vm.ReturnData()), nil
+}
+
+func TestOracleContract_Value(t *testing.T) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Timestamp: 1000, Builtins: testBuiltins})
+	vm.registerBuiltinId(new(testRelay))
+	vm.SetGas(1000000)
+	sender := common.Address{0x01}
+	reporters := newTestReporters(t, 4)
+	oracle := createTestOracle(t, vm, sender, reporters[:3], 2)
+	submit := func(r *testReporter, value int64, ts uint64) error {
+		return vm.Call(sender, oracle, nil, r.submitInput(t, oracle, "XFS/USD", value, ts))
+	}
+	if err := submit(reporters[0], 10, 990); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oracleValue(vm, sender, oracle, "XFS/USD"); err != errOracleNoQuorum {
+		t.Fatalf("want errOracleNoQuorum, got %v", err)
+	}
+	if err := submit(reporters[3], 10, 990); err != errOracleNotReporter {
+		t.Fatalf("want errOracleNotReporter, got %v", err)
+	}
+	if err := submit(reporters[0], 11, 990); err != errOracleStale {
+		t.Fatalf("want errOracleStale, got %v", err)
+	}
+	if err := submit(reporters[1], 11, 1000+maxOracleDrift+1); err != errOracleFuture {
+		t.Fatalf("want errOracleFuture, got %v", err)
+	}
+	// a signature of another value does not recover to the reporter
+	input := reporters[1].submitInput(t, oracle, "XFS/USD", 20, 995)
+	tampered := reporters[1].submitInput(t, oracle, "XFS/USD", 21, 995)
+	copy(tampered[:len(tampered)-72], input[:len(input)-72])
+	if err := vm.Call(sender, oracle, nil, tampered); err != errOracleNotReporter {
+		t.Fatalf("want errOracleNotReporter of tampered data point, got %v", err)
+	}
+	if err := submit(reporters[1], 20, 995); err != nil {
+		t.Fatal(err)
+	}
+	// the mean of the two middle data points
+	value, err := oracleValue(vm, sender, oracle, "XFS/USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, value, big.NewInt(15))
+	if err = submit(reporters[2], 100, 1000); err != nil {
+		t.Fatal(err)
+	}
+	value, _ = oracleValue(vm, sender, oracle, "XFS/USD")
+	assert.BigIntEqual(t, value, big.NewInt(20))
+
+	// other contracts read the value with a static call
+	relay := createTestRelay(t, vm, sender)
+	readInput := mustEncodeCall("Value", CTypeString("XFS/USD"))
+	if err = vm.Call(sender, relay, nil, relayMethod("StaticRelay", oracle[:], readInput)); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, new(big.Int).SetBytes(vm.ReturnData()), big.NewInt(20))
+
+	// data points older than the max age are not used
+	vm.ctx.block.Timestamp = 1095
+	value, _ = oracleValue(vm, sender, oracle, "XFS/USD")
+	assert.BigIntEqual(t, value, big.NewInt(60))
+	vm.ctx.block.Timestamp = 1101
+	if _, err = oracleValue(vm, sender, oracle, "XFS/USD"); err != errOracleNoQuorum {
+		t.Fatalf("want errOracleNoQuorum of stale data points, got %v", err)
+	}
+	logs := vm.Logs()
+	assert.Equal(t, len(logs), 3)
+	var report OracleReport
+	if err = json.Unmarshal(logs[2].Data, &report); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, report.Reporter, reporters[2].addr)
+	assert.BigIntEqual(t, report.Value, big.NewInt(100))
+}
+
+func TestOracleContract_Reporters(t *testing.T) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Timestamp: 1000, Builtins: testBuiltins})
+	vm.SetGas(1000000)
+	owner := common.Address{0x01}
+	reporters := newTestReporters(t, 3)
+	oracle := createTestOracle(t, vm, owner, reporters[:2], 2)
+	added := CTypeAddress(reporters[2].addr)
+	if err := vm.Call(common.Address{0x02}, oracle, nil, mustEncodeCall("AddReporter", added)); err != errOracleNotOwner {
+		t.Fatalf("want errOracleNotOwner, got %v", err)
+	}
+	if err := vm.Call(owner, oracle, nil, mustEncodeCall("AddReporter", added)); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.StaticCall(owner, oracle, mustEncodeCall("IsReporter", added)); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, vm.ReturnData()[0], byte(1))
+	if err := vm.Call(owner, oracle, nil, reporters[2].submitInput(t, oracle, "k", 1, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Call(owner, oracle, nil, mustEncodeCall("RemoveReporter", added)); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Call(owner, oracle, nil, reporters[2].submitInput(t, oracle, "k", 2, 1001)); err != errOracleNotReporter {
+		t.Fatalf("want errOracleNotReporter of removed reporter, got %v", err)
+	}
+	// the oracle keeps at least MinReports reporters
+	removed := CTypeAddress(reporters[1].addr)
+	if err := vm.Call(owner, oracle, nil, mustEncodeCall("RemoveReporter", removed)); err != errOracleReporters {
+		t.Fatalf("want errOracleReporters, got %v", err)
+	}
+}
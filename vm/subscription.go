@@ -0,0 +1,251 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package vm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+)
+
+// subscriptionPeriodSize is the size of the stored collection period, the start of the
+// period, the amount collected in it and whether the gas of the payee was sponsored.
+const subscriptionPeriodSize = 8 + 32 + 1
+
+var (
+	errSubscriptionParties   = errors.New("invalid subscription parties")
+	errSubscriptionTerms     = errors.New("invalid subscription terms")
+	errSubscriptionNotParty  = errors.New("caller is not a subscription party")
+	errSubscriptionCancelled = errors.New("subscription cancelled")
+	errSubscriptionLimit     = errors.New("amount exceeds the allowance of the period")
+	errSubscriptionFunds     = errors.New("subscription balance not enough")
+	errSubscriptionNoValue   = errors.New("no value deposited")
+	errSubscriptionValue     = errors.New("subscription method does not accept value")
+	subscriptionCollectTopic = common.Bytes2Hash(ahash.SHA256([]byte("Collect")))
+	subscriptionCancelTopic  = common.Bytes2Hash(ahash.SHA256([]byte("Cancel")))
+	subscriptionPeriodSlot   = storageSlot([]byte("subscription.period"), nil)
+	subscriptionCancelSlot   = storageSlot([]byte("subscription.cancelled"), nil)
+)
+
+// subscriptionContract authorizes a payee to pull payments of at most MaxAmount per
+// interval out of the value the payer deposits in the contract. The payee sends the
+// collecting transactions and pays their gas, the payer may sponsor it with a fixed
+// amount paid to the payee on top of the first collection of every interval. Either
+// side may cancel the subscription, the remaining value is refunded to the payer. Only
+// Deposit accepts value, the other calls transferring value fail.
+//
+// The storage fields only hold the terms, the collection period and the cancellation
+// are kept in slots of their own which are written before any value is paid out.
+type subscriptionContract struct {
+	BuiltinContract
+	Payer     CTypeAddress `contract:"storage"`
+	Payee     CTypeAddress `contract:"storage"`
+	MaxAmount CTypeUint256 `contract:"storage"`
+	Interval  CTypeUint64  `contract:"storage"`
+	Sponsor   CTypeUint256 `contract:"storage"`
+}
+
+// SubscriptionPayment is the data of the events of a subscription.
+type SubscriptionPayment struct {
+	Recipient common.Address `json:"recipient"`
+	Amount    *big.Int       `json:"amount"`
+	Sponsored *big.Int       `json:"sponsored"`
+}
+
+type subscriptionPeriod struct {
+	start     uint64
+	collected *big.Int
+	sponsored bool
+}
+
+func (s *subscriptionContract) BuiltinId() uint8 {
+	return 0x06
+}
+
+// Create authorizes the payee to collect at most maxAmount per interval in seconds
+// from the caller, sponsor is paid to the payee for the gas of its collections.
+func (s *subscriptionContract) Create(
+	payee CTypeAddress,
+	maxAmount CTypeUint256,
+	interval CTypeUint64,
+	sponsor CTypeUint256) error {
+	if s.CallValue().Sign() != 0 {
+		return errSubscriptionValue
+	}
+	payer := CTypeAddress(s.Caller())
+	if payee == payer || payee == (CTypeAddress{}) {
+		return errSubscriptionParties
+	}
+	if maxAmount.BigInt().Sign() == 0 || interval.Uint64() == 0 {
+		return errSubscriptionTerms
+	}
+	s.Payer = payer
+	s.Payee = payee
+	s.MaxAmount = maxAmount
+	s.Interval = interval
+	s.Sponsor = sponsor
+	return s.setPeriod(&subscriptionPeriod{
+		start:     s.BlockTimestamp(),
+		collected: new(big.Int),
+	})
+}
+
+func (s *subscriptionContract) cancelled() bool {
+	return s.GetStorage(subscriptionCancelSlot) != nil
+}
+
+// period returns the collection period of the current block.
+func (s *subscriptionContract) period() *subscriptionPeriod {
+	p := &subscriptionPeriod{collected: new(big.Int)}
+	if data := s.GetStorage(subscriptionPeriodSlot); len(data) == subscriptionPeriodSize {
+		p.start = binary.BigEndian.Uint64(data[:8])
+		p.collected.SetBytes(data[8:40])
+		p.sponsored = data[40] == 1
+	}
+	interval := s.Interval.Uint64()
+	if now := s.BlockTimestamp(); interval > 0 && now >= p.start+interval {
+		p.start += (now - p.start) / interval * interval
+		p.collected = new(big.Int)
+		p.sponsored = false
+	}
+	return p
+}
+
+func (s *subscriptionContract) setPeriod(p *subscriptionPeriod) error {
+	data := make([]byte, 0, subscriptionPeriodSize)
+	data = append(data, heightKey(p.start)...)
+	collected := uint256Of(p.collected)
+	data = append(data, collected[:]...)
+	if p.sponsored {
+		data = append(data, 1)
+	} else {
+		data = append(data, 0)
+	}
+	return s.SetStorage(subscriptionPeriodSlot, data)
+}
+
+func (s *subscriptionContract) emit(topic common.Hash, recipient common.Address, amount, sponsored *big.Int) error {
+	event, err := json.Marshal(&SubscriptionPayment{
+		Recipient: recipient,
+		Amount:    amount,
+		Sponsored: sponsored,
+	})
+	if err != nil {
+		return err
+	}
+	return s.Emit([]common.Hash{topic}, event)
+}
+
+// Deposit adds the value of the call to the balance the payee collects from.
+func (s *subscriptionContract) Deposit() error {
+	if s.Caller() != s.Payer.Address() {
+		return errSubscriptionNotParty
+	}
+	if s.cancelled() {
+		return errSubscriptionCancelled
+	}
+	if s.CallValue().Sign() <= 0 {
+		return errSubscriptionNoValue
+	}
+	return nil
+}
+
+// Collect pays the amount to the payee, the amounts collected in an interval may not
+// exceed MaxAmount. The first collection of an interval is paid the sponsor amount too.
+func (s *subscriptionContract) Collect(amount CTypeUint256) error {
+	if s.CallValue().Sign() != 0 {
+		return errSubscriptionValue
+	}
+	if s.Caller() != s.Payee.Address() {
+		return errSubscriptionNotParty
+	}
+	if s.cancelled() {
+		return errSubscriptionCancelled
+	}
+	value := amount.BigInt()
+	p := s.period()
+	collected := new(big.Int).Add(p.collected, value)
+	if value.Sign() == 0 || collected.Cmp(s.MaxAmount.BigInt()) > 0 {
+		return errSubscriptionLimit
+	}
+	sponsored := new(big.Int)
+	if !p.sponsored {
+		sponsored.Set(s.Sponsor.BigInt())
+	}
+	total := new(big.Int).Add(value, sponsored)
+	if s.ExtBalance(s.GetAddress()).Cmp(total) < 0 {
+		return errSubscriptionFunds
+	}
+	p.collected = collected
+	p.sponsored = true
+	if err := s.setPeriod(p); err != nil {
+		return err
+	}
+	payee := s.Payee.Address()
+	if _, err := s.CallContract(payee, total, 0, nil); err != nil {
+		return err
+	}
+	return s.emit(subscriptionCollectTopic, payee, value, sponsored)
+}
+
+// Cancel ends the subscription and refunds the balance of the contract to the payer,
+// the payer and the payee may cancel it.
+func (s *subscriptionContract) Cancel() error {
+	if s.CallValue().Sign() != 0 {
+		return errSubscriptionValue
+	}
+	caller := s.Caller()
+	if caller != s.Payer.Address() && caller != s.Payee.Address() {
+		return errSubscriptionNotParty
+	}
+	if s.cancelled() {
+		return errSubscriptionCancelled
+	}
+	if err := s.SetStorage(subscriptionCancelSlot, []byte{1}); err != nil {
+		return err
+	}
+	payer := s.Payer.Address()
+	refund := s.ExtBalance(s.GetAddress())
+	if refund.Sign() > 0 {
+		if _, err := s.CallContract(payer, refund, 0, nil); err != nil {
+			return err
+		}
+	}
+	return s.emit(subscriptionCancelTopic, payer, refund, new(big.Int))
+}
+
+// GetCollectable returns the amount the payee may still collect in the current interval.
+func (s *subscriptionContract) GetCollectable() CTypeUint256 {
+	if s.cancelled() {
+		return CTypeUint256{}
+	}
+	left := new(big.Int).Sub(s.MaxAmount.BigInt(), s.period().collected)
+	if left.Sign() < 0 {
+		return CTypeUint256{}
+	}
+	return uint256Of(left)
+}
+
+func (s *subscriptionContract) IsCancelled() CTypeBool {
+	if s.cancelled() {
+		return CTypeBool{1}
+	}
+	return CTypeBool{}
+}
@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+var (
+	testPayer = common.Address{0x01}
+	testPayee = common.Address{0x02}
+)
+
+func newTestSubscription(t *testing.T, deposit int64) (*xvm, common.Address) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Timestamp: 1000, Builtins: testBuiltins})
+	vm.SetGas(1000000)
+	vm.stateTree.AddBalance(testPayer, big.NewInt(1000))
+	input := bytes.NewBuffer(nil)
+	input.Write([]byte{0xd0, 0x23, 0x06})
+	input.Write(mustEncodeCall("Create", CTypeAddress(testPayee),
+		uint256Of(big.NewInt(50)), NewUint64(100), uint256Of(big.NewInt(2))))
+	caddr := crypto.CreateAddress(testPayer.Hash(), vm.stateTree.GetNonce(testPayer))
+	if err := vm.Create(testPayer, input.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	vm.stateTree.AddNonce(testPayer, 1)
+	if err := vm.Call(testPayer, caddr, big.NewInt(deposit), mustEncodeCall("Deposit")); err != nil {
+		t.Fatal(err)
+	}
+	return vm, caddr
+}
+
+func collect(vm *xvm, sender, subscription common.Address, amount int64) error {
+	return vm.Call(sender, subscription, nil, mustEncodeCall("Collect", uint256Of(big.NewInt(amount))))
+}
+
+func collectable(t *testing.T, vm *xvm, subscription common.Address) *big.Int {
+	if err := vm.StaticCall(testPayee, subscription, mustEncodeCall("GetCollectable")); err != nil {
+		t.Fatal(err)
+	}
+	return new(big.Int).SetBytes(vm.ReturnData())
+}
+
+func TestSubscriptionContract_Collect(t *testing.T) {
+	vm, subscription := newTestSubscription(t, 150)
+	if err := collect(vm, testPayer, subscription, 10); err != errSubscriptionNotParty {
+		t.Fatalf("want errSubscriptionNotParty, got %v", err)
+	}
+	if err := collect(vm, testPayee, subscription, 30); err != nil {
+		t.Fatal(err)
+	}
+	// the gas of the payee is sponsored once per interval
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(testPayee), big.NewInt(32))
+	if err := collect(vm, testPayee, subscription, 21); err != errSubscriptionLimit {
+		t.Fatalf("want errSubscriptionLimit, got %v", err)
+	}
+	if err := collect(vm, testPayee, subscription, 20); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(testPayee), big.NewInt(52))
+	assert.BigIntEqual(t, collectable(t, vm, subscription), big.NewInt(0))
+
+	// the allowance of an interval does not add up to the next ones
+	vm.ctx.block.Timestamp = 1250
+	assert.BigIntEqual(t, collectable(t, vm, subscription), big.NewInt(50))
+	if err := collect(vm, testPayee, subscription, 50); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(testPayee), big.NewInt(104))
+	vm.ctx.block.Timestamp = 1299
+	if err := collect(vm, testPayee, subscription, 1); err != errSubscriptionLimit {
+		t.Fatalf("want errSubscriptionLimit, got %v", err)
+	}
+	vm.ctx.block.Timestamp = 1300
+	if err := collect(vm, testPayee, subscription, 50); err != errSubscriptionFunds {
+		t.Fatalf("want errSubscriptionFunds, got %v", err)
+	}
+	assert.Equal(t, len(vm.Logs()), 3)
+}
+
+func TestSubscriptionContract_Cancel(t *testing.T) {
+	vm, subscription := newTestSubscription(t, 200)
+	if err := vm.Call(common.Address{0x03}, subscription, nil, mustEncodeCall("Cancel")); err != errSubscriptionNotParty {
+		t.Fatalf("want errSubscriptionNotParty, got %v", err)
+	}
+	if err := collect(vm, testPayee, subscription, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Call(testPayee, subscription, nil, mustEncodeCall("Cancel")); err != nil {
+		t.Fatal(err)
+	}
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(testPayer), big.NewInt(988))
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(subscription), big.NewInt(0))
+	if err := collect(vm, testPayee, subscription, 10); err != errSubscriptionCancelled {
+		t.Fatalf("want errSubscriptionCancelled, got %v", err)
+	}
+	if err := vm.Call(testPayer, subscription, big.NewInt(10), mustEncodeCall("Deposit")); err != errSubscriptionCancelled {
+		t.Fatalf("want errSubscriptionCancelled, got %v", err)
+	}
+	if err := vm.StaticCall(testPayer, subscription, mustEncodeCall("IsCancelled")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, vm.ReturnData()[0], byte(1))
+}
+
+func TestSubscriptionContract_Value(t *testing.T) {
+	vm, subscription := newTestSubscription(t, 150)
+	// only the deposits accept value
+	vm.stateTree.AddBalance(testPayee, big.NewInt(1))
+	if err := vm.Call(testPayee, subscription, big.NewInt(1),
+		mustEncodeCall("Collect", uint256Of(big.NewInt(10)))); err != errSubscriptionValue {
+		t.Fatalf("want errSubscriptionValue, got %v", err)
+	}
+	if err := vm.Call(testPayer, subscription, big.NewInt(1), mustEncodeCall("Cancel")); err != errSubscriptionValue {
+		t.Fatalf("want errSubscriptionValue, got %v", err)
+	}
+	assert.BigIntEqual(t, vm.stateTree.GetBalance(subscription), big.NewInt(150))
+	assert.BigIntEqual(t, collectable(t, vm, subscription), big.NewInt(50))
+}
@@ -0,0 +1,78 @@
+package vm
+
+import (
+	"math/big"
+	"xfsgo/common"
+)
+
+// Types of the recorded call frames.
+const (
+	CallTypeCall       = "call"
+	CallTypeStaticCall = "staticcall"
+	CallTypeCreate     = "create"
+)
+
+// CallFrame is a call recorded by the call tracer. Gas is the gas available to the call
+// and GasUsed includes the gas used by its nested calls, a failed nested call uses all
+// the gas forwarded to it.
+type CallFrame struct {
+	Type    string
+	From    common.Address
+	To      common.Address
+	Value   *big.Int
+	Gas     uint64
+	GasUsed uint64
+	Err     error
+	Calls   []*CallFrame
+}
+
+// CallTracer is implemented by vms which can record the calls of an execution.
+type CallTracer interface {
+	// TraceCalls enables the recording of the calls executed afterwards.
+	TraceCalls()
+	// CallTrace returns the recorded calls made to the vm, with their nested calls.
+	CallTrace() []*CallFrame
+}
+
+func (vm *xvm) TraceCalls() {
+	vm.tracing = true
+}
+
+func (vm *xvm) CallTrace() []*CallFrame {
+	return vm.trace
+}
+
+func (vm *xvm) enterFrame(typ string, from, to common.Address, value *big.Int) *CallFrame {
+	if !vm.tracing {
+		return nil
+	}
+	frame := &CallFrame{
+		Type:  typ,
+		From:  from,
+		To:    to,
+		Value: value,
+		Gas:   vm.gas,
+	}
+	vm.frames = append(vm.frames, frame)
+	return frame
+}
+
+func (vm *xvm) exitFrame(frame *CallFrame, err error) {
+	if frame == nil {
+		return
+	}
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	frame.Err = err
+	if frame.Gas > vm.gas {
+		frame.GasUsed = frame.Gas - vm.gas
+	}
+	if len(vm.frames) == 0 {
+		vm.trace = append(vm.trace, frame)
+		return
+	}
+	if err != nil {
+		frame.GasUsed = frame.Gas
+	}
+	parent := vm.frames[len(vm.frames)-1]
+	parent.Calls = append(parent.Calls, frame)
+}
@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+var errInvalidBuiltinVersion = errors.New("invalid builtin contract version")
+
+// builtinVersion identifies an implementation of a builtin contract.
+type builtinVersion struct {
+	id      uint8
+	version uint8
+}
+
+var (
+	builtinUpgradesMu sync.RWMutex
+	builtinUpgrades   = make(map[builtinVersion]reflect.Type)
+)
+
+// The builtin contracts added after the token have no implementation the vm is created
+// with, they are activated as version 1 of their ids by the builtin upgrades of the
+// chain config.
+func init() {
+	for _, b := range []BuiltinContract{
+		new(bridgeContract),
+		new(oracleContract),
+		new(anchorContract),
+		new(escrowContract),
+		new(subscriptionContract),
+	} {
+		_ = RegisterBuiltinUpgrade(1, b)
+	}
+}
+
+// RegisterBuiltinUpgrade registers a new version of the implementation of a builtin
+// contract. The contracts with its builtin id run it from the block the chain config
+// activates the version at, at the same address and with the same storage, so it must
+// declare the storage fields of the version it replaces with the same names and types.
+// Version 0 is the implementation the vm is created with and can't be replaced.
+func RegisterBuiltinUpgrade(version uint8, b BuiltinContract) error {
+	if version == 0 {
+		return errInvalidBuiltinVersion
+	}
+	builtinUpgradesMu.Lock()
+	defer builtinUpgradesMu.Unlock()
+	builtinUpgrades[builtinVersion{id: b.BuiltinId(), version: version}] = reflect.TypeOf(b)
+	return nil
+}
+
+// HasBuiltinVersion reports whether the version of the builtin contract is registered.
+func HasBuiltinVersion(id, version uint8) bool {
+	if version == 0 {
+		return true
+	}
+	builtinUpgradesMu.RLock()
+	defer builtinUpgradesMu.RUnlock()
+	_, exists := builtinUpgrades[builtinVersion{id: id, version: version}]
+	return exists
+}
+
+// upgradeBuiltin switches the builtin contracts with the id to the version. The calls of
+// the contracts fail if the version is unknown, rather than running the old version.
+func (vm *xvm) upgradeBuiltin(id, version uint8) {
+	if version == 0 {
+		return
+	}
+	builtinUpgradesMu.RLock()
+	rt, exists := builtinUpgrades[builtinVersion{id: id, version: version}]
+	builtinUpgradesMu.RUnlock()
+	if !exists {
+		delete(vm.builtins, id)
+		return
+	}
+	vm.builtins[id] = rt
+}
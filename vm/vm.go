@@ -3,6 +3,7 @@ package vm
 import (
 	"encoding/binary"
 	"errors"
+	"math/big"
 	"reflect"
 	"xfsgo/common"
 	"xfsgo/core"
@@ -12,11 +13,62 @@ import (
 type VM interface {
 	Run(common.Address, []byte, []byte) error
 	Create(common.Address, []byte) error
-	Call(common.Address, []byte) error
+	Call(common.Address, common.Address, *big.Int, []byte) error
+	StaticCall(common.Address, common.Address, []byte) error
+	SetGas(uint64)
+	GasLeft() uint64
+	ReturnData() []byte
+	Logs() []*core.Log
+}
+
+// Interrupter is implemented by vms whose execution can be aborted, the calls made
+// after the done channel is closed fail with an aborted error and are reverted.
+type Interrupter interface {
+	SetDone(done <-chan struct{})
+}
+
+// BlockContext holds the values of the block a contract is executed in.
+type BlockContext struct {
+	Height    uint64
+	Timestamp uint64
+	Coinbase  common.Address
+	// Builtins maps the ids of the builtin contracts upgraded at the block to the
+	// version of their implementation.
+	Builtins map[uint8]uint8
+	// Randomness is mixed from the headers of the previous blocks, it can be biased by
+	// the miners.
+	Randomness common.Hash
+	// Legacy runs the rules of the blocks before the vm fixes: the builtin contracts
+	// decode the arguments by the old row padding, and a contract creation neither
+	// checks its address for a collision nor reverts the state of a failure.
+	Legacy bool
+}
+
+type callContext struct {
+	block   BlockContext
+	callers []common.Address
+	// values holds the value transferred by each call of callers
+	values []*big.Int
+	// static is set while executing a read only call, any state mutation fails
+	// with errWriteProtection.
+	static bool
 }
 
 const (
 	magicNumberXVM = uint16(9168)
+	// maxCallDepth is the maximum depth of nested contract calls.
+	maxCallDepth = 64
+	// callGas is charged to a contract for every call it makes to another contract,
+	// callValueGas is charged in addition when the call transfers value.
+	callGas      = uint64(700)
+	callValueGas = uint64(9000)
+	// limits and gas costs of the logs emitted by contracts
+	maxLogTopics  = 4
+	maxTxLogs     = 64
+	maxTxLogsSize = 16 * 1024
+	logGas        = uint64(375)
+	logTopicGas   = uint64(375)
+	logDataGas    = uint64(8)
 )
 
 var (
@@ -24,21 +76,49 @@ var (
 	errUnknownContractId   = errors.New("unknown contract type")
 	errUnknownContractExec = errors.New("unknown contract exec")
 	errInvalidContractCode = errors.New("invalid contract code")
+	errCallDepth           = errors.New("max call depth exceeded")
+	errOutOfGas            = errors.New("out of gas")
+	errInsufficientBalance = errors.New("insufficient balance for transfer")
+	errTooManyTopics       = errors.New("too many log topics")
+	errTooManyLogs         = errors.New("too many logs")
+	errLogsTooLarge        = errors.New("logs too large")
+	errExecutionAborted    = errors.New("execution aborted")
+	errAddressCollision    = errors.New("contract address collision")
 )
 
 type xvm struct {
 	stateTree core.StateTree
 	builtins  map[uint8]reflect.Type
 	returnBuf Buffer
+	ctx       *callContext
+	gas       uint64
+	logs      []*core.Log
+	logsSize  int
+	// tracing enables the call tracer, frames holds the calls in progress and trace
+	// the finished calls made to the vm.
+	tracing bool
+	frames  []*CallFrame
+	trace   []*CallFrame
+	// done aborts the execution when closed
+	done <-chan struct{}
 }
 
 func NewXVM(st core.StateTree) *xvm {
+	return NewXVMWithContext(st, BlockContext{})
+}
+
+// NewXVMWithContext creates a vm which executes contracts in the given block.
+func NewXVMWithContext(st core.StateTree, block BlockContext) *xvm {
 	vm := &xvm{
 		stateTree: st,
 		builtins:  make(map[uint8]reflect.Type),
 		returnBuf: NewBuffer(nil),
+		ctx:       &callContext{block: block},
 	}
 	vm.registerBuiltinId(new(token))
+	for id, version := range block.Builtins {
+		vm.upgradeBuiltin(id, version)
+	}
 	return vm
 }
 func (vm *xvm) newBuiltinContractExec(id uint8, address common.Address, code []byte) (*builtinContractExec, error) {
@@ -48,6 +128,7 @@ func (vm *xvm) newBuiltinContractExec(id uint8, address common.Address, code []b
 			stateTree: vm.stateTree,
 			address:   address,
 			code:      code,
+			vm:        vm,
 			resultBuf: NewBuffer(nil),
 		}, nil
 	}
@@ -77,14 +158,19 @@ func readXVMCode(code []byte, input []byte) (c []byte, id uint8, err error) {
 	return
 }
 func (vm *xvm) Run(addr common.Address, code []byte, input []byte) (err error) {
+	_, err = vm.run(addr, code, input)
+	return
+}
+
+func (vm *xvm) run(addr common.Address, code []byte, input []byte) (ret []byte, err error) {
 	var create = code == nil
 	code, id, err := readXVMCode(code, input)
 	if err != nil && create {
 		vm.stateTree.AddNonce(addr, 1)
 		vm.stateTree.SetCode(addr, input)
-		return nil
+		return nil, nil
 	} else if err != nil {
-		return nil
+		return nil, nil
 	}
 	var exec ContractExec
 	if id != 0 {
@@ -93,39 +179,251 @@ func (vm *xvm) Run(addr common.Address, code []byte, input []byte) (err error) {
 		}
 	}
 	if exec == nil {
-		return errUnknownContractExec
+		return nil, errUnknownContractExec
 	}
 	if create {
 		var realInput = make([]byte, len(input)-3)
 		copy(realInput[:], input[3:])
 		if err = exec.Create(realInput); err != nil {
-			return err
+			return nil, err
 		}
 		vm.stateTree.AddNonce(addr, 1)
 		vm.stateTree.SetCode(addr, code)
-		return nil
+		return nil, nil
 	}
-	if err = exec.Call(input); err != nil {
-		return err
+	return exec.Call(input)
+}
+
+func (vm *xvm) SetDone(done <-chan struct{}) {
+	vm.done = done
+}
+
+func (vm *xvm) aborted() bool {
+	select {
+	case <-vm.done:
+		return true
+	default:
+		return false
 	}
+}
+
+// SetGas sets the gas available for contract calls made during the execution.
+func (vm *xvm) SetGas(gas uint64) {
+	vm.gas = gas
+}
+
+// GasLeft returns the gas remaining after the execution.
+func (vm *xvm) GasLeft() uint64 {
+	return vm.gas
+}
+
+// Logs returns the logs emitted by the contracts during the execution.
+func (vm *xvm) Logs() []*core.Log {
+	return vm.logs
+}
+
+func (vm *xvm) emit(addr common.Address, topics []common.Hash, data []byte) error {
+	if vm.ctx.static {
+		return errWriteProtection
+	}
+	if len(topics) > maxLogTopics {
+		return errTooManyTopics
+	}
+	if len(vm.logs) >= maxTxLogs {
+		return errTooManyLogs
+	}
+	if vm.logsSize+len(data) > maxTxLogsSize {
+		return errLogsTooLarge
+	}
+	cost := logGas + uint64(len(topics))*logTopicGas + uint64(len(data))*logDataGas
+	if vm.gas < cost {
+		return errOutOfGas
+	}
+	vm.gas -= cost
+	l := &core.Log{
+		Address: addr,
+		Topics:  make([]common.Hash, len(topics)),
+		Data:    make([]byte, len(data)),
+	}
+	copy(l.Topics, topics)
+	copy(l.Data, data)
+	vm.logs = append(vm.logs, l)
+	vm.logsSize += len(data)
 	return nil
 }
+
+func (vm *xvm) revertLogs(n, size int) {
+	for i := n; i < len(vm.logs); i++ {
+		vm.logs[i] = nil
+	}
+	vm.logs = vm.logs[:n]
+	vm.logsSize = size
+}
+
+// ReturnData returns the data returned by the last call.
+func (vm *xvm) ReturnData() []byte {
+	return vm.returnBuf.Bytes()
+}
+
+func (vm *xvm) pushCaller(caller common.Address, value *big.Int) {
+	vm.ctx.callers = append(vm.ctx.callers, caller)
+	vm.ctx.values = append(vm.ctx.values, value)
+}
+
+func (vm *xvm) popCaller() {
+	vm.ctx.callers = vm.ctx.callers[:len(vm.ctx.callers)-1]
+	vm.ctx.values = vm.ctx.values[:len(vm.ctx.values)-1]
+}
+
 func (vm *xvm) Create(addr common.Address, input []byte) error {
 	nonce := vm.stateTree.GetNonce(addr)
 	caddr := crypto.CreateAddress(addr.Hash(), nonce)
-	if err := vm.Run(caddr, nil, input); err != nil {
+	frame := vm.enterFrame(CallTypeCreate, addr, caddr, nil)
+	if vm.aborted() {
+		vm.exitFrame(frame, errExecutionAborted)
+		return errExecutionAborted
+	}
+	legacy := vm.ctx.block.Legacy
+	// an account with a nonce or code can not be replaced by a new contract,
+	// accounts holding only a balance can
+	if !legacy && (vm.stateTree.GetNonce(caddr) != 0 || vm.stateTree.GetCodeSize(caddr) > 0) {
+		vm.exitFrame(frame, errAddressCollision)
+		return errAddressCollision
+	}
+	snapshot := vm.stateTree.Snapshot()
+	logsN, logsSize := len(vm.logs), vm.logsSize
+	accessAddress(vm.stateTree, caddr)
+	vm.pushCaller(addr, nil)
+	err := vm.Run(caddr, nil, input)
+	vm.popCaller()
+	if err != nil && !legacy {
+		vm.stateTree.RevertToSnapshot(snapshot)
+		vm.revertLogs(logsN, logsSize)
+	}
+	vm.exitFrame(frame, err)
+	return err
+}
+
+// Call executes the contract at address with the given input, value is transferred
+// from the caller to the contract before the execution. All state changes of the
+// call are reverted when it fails.
+func (vm *xvm) Call(caller, address common.Address, value *big.Int, input []byte) error {
+	ret, err := vm.call(caller, address, value, input)
+	if err != nil {
 		return err
 	}
+	vm.returnBuf = NewBuffer(ret)
 	return nil
 }
 
-func (vm *xvm) Call(address common.Address, input []byte) error {
-	code := vm.stateTree.GetCode(address)
-	if err := vm.Run(address, code, input); err != nil {
+// StaticCall executes the contract at address like Call, but fails with a write protection
+// error as soon as the contract or any contract it calls tries to modify the state.
+func (vm *xvm) StaticCall(caller, address common.Address, input []byte) error {
+	ret, err := vm.staticCall(caller, address, input)
+	if err != nil {
 		return err
 	}
+	vm.returnBuf = NewBuffer(ret)
 	return nil
 }
+
+func (vm *xvm) staticCall(caller, address common.Address, input []byte) ([]byte, error) {
+	if vm.ctx.static {
+		return vm.call(caller, address, nil, input)
+	}
+	vm.ctx.static = true
+	defer func() { vm.ctx.static = false }()
+	return vm.call(caller, address, nil, input)
+}
+
+func (vm *xvm) call(caller, address common.Address, value *big.Int, input []byte) (ret []byte, err error) {
+	typ := CallTypeCall
+	if vm.ctx.static {
+		typ = CallTypeStaticCall
+	}
+	frame := vm.enterFrame(typ, caller, address, value)
+	defer func() {
+		vm.exitFrame(frame, err)
+	}()
+	if len(vm.ctx.callers) >= maxCallDepth {
+		return nil, errCallDepth
+	}
+	if vm.aborted() {
+		return nil, errExecutionAborted
+	}
+	if vm.ctx.static && value != nil && value.Sign() > 0 {
+		return nil, errWriteProtection
+	}
+	snapshot := vm.stateTree.Snapshot()
+	logsN, logsSize := len(vm.logs), vm.logsSize
+	accessAddress(vm.stateTree, address)
+	if value != nil && value.Sign() > 0 {
+		balance := vm.stateTree.GetBalance(caller)
+		if balance == nil || balance.Cmp(value) < 0 {
+			return nil, errInsufficientBalance
+		}
+		if err = vm.stateTree.SubBalance(caller, value); err == nil {
+			err = vm.stateTree.AddBalance(address, value)
+		}
+		if err != nil {
+			vm.stateTree.RevertToSnapshot(snapshot)
+			return nil, err
+		}
+	}
+	code := vm.stateTree.GetCode(address)
+	vm.pushCaller(caller, value)
+	ret, err = vm.run(address, code, input)
+	vm.popCaller()
+	if err == nil && vm.aborted() {
+		err = errExecutionAborted
+	}
+	if err != nil {
+		vm.stateTree.RevertToSnapshot(snapshot)
+		vm.revertLogs(logsN, logsSize)
+		return nil, err
+	}
+	return ret, nil
+}
+
+// innerCall executes a call made by a contract. The caller pays callGas and may forward
+// at most all but one 64th of its remaining gas, the gas not used by the callee is
+// returned to the caller unless the call fails.
+func (vm *xvm) innerCall(caller, address common.Address, value *big.Int, gas uint64, input []byte) ([]byte, error) {
+	return vm.forwardCall(gas, func() ([]byte, error) {
+		return vm.call(caller, address, value, input)
+	}, value != nil && value.Sign() > 0)
+}
+
+// innerStaticCall executes a read only call made by a contract, it is charged like innerCall.
+func (vm *xvm) innerStaticCall(caller, address common.Address, gas uint64, input []byte) ([]byte, error) {
+	return vm.forwardCall(gas, func() ([]byte, error) {
+		return vm.staticCall(caller, address, input)
+	}, false)
+}
+
+func (vm *xvm) forwardCall(gas uint64, fn func() ([]byte, error), transfer bool) ([]byte, error) {
+	cost := callGas
+	if transfer {
+		cost += callValueGas
+	}
+	if vm.gas < cost {
+		return nil, errOutOfGas
+	}
+	vm.gas -= cost
+	available := vm.gas - vm.gas/64
+	if gas == 0 || gas > available {
+		gas = available
+	}
+	parentGas := vm.gas - gas
+	vm.gas = gas
+	ret, err := fn()
+	if err != nil {
+		vm.gas = parentGas
+		return nil, err
+	}
+	vm.gas += parentGas
+	return ret, nil
+}
 func (vm *xvm) GetBuiltinContract(address common.Address) (c interface{}, err error) {
 	code := vm.stateTree.GetCode(address)
 	code, id, err := readXVMCode(code, nil)
@@ -13,9 +13,11 @@ import (
 )
 
 type testStateTree struct {
-	data  map[[32]byte][]byte
-	codes map[[32]byte][]byte
-	nonce map[[32]byte]uint64
+	data      map[[32]byte][]byte
+	codes     map[[32]byte][]byte
+	nonce     map[[32]byte]uint64
+	balances  map[[32]byte]*big.Int
+	snapshots []*testStateTree
 }
 
 func (t *testStateTree) GetNonce(addr common.Address) uint64 {
@@ -24,16 +26,65 @@ func (t *testStateTree) GetNonce(addr common.Address) uint64 {
 	}
 	return 0
 }
-func (t *testStateTree) GetBalance(common.Address) *big.Int {
+func (t *testStateTree) GetBalance(addr common.Address) *big.Int {
+	return t.balances[ahash.SHA256Array(addr[:])]
+}
+
+func (t *testStateTree) AddBalance(addr common.Address, val *big.Int) error {
+	old := t.GetBalance(addr)
+	if old == nil {
+		old = new(big.Int)
+	}
+	t.balances[ahash.SHA256Array(addr[:])] = new(big.Int).Add(old, val)
 	return nil
 }
 
+func (t *testStateTree) SubBalance(addr common.Address, val *big.Int) error {
+	t.balances[ahash.SHA256Array(addr[:])] = new(big.Int).Sub(t.GetBalance(addr), val)
+	return nil
+}
+
+func (t *testStateTree) Snapshot() int {
+	cpy := newTestStateTree()
+	for k, v := range t.data {
+		cpy.data[k] = v
+	}
+	for k, v := range t.codes {
+		cpy.codes[k] = v
+	}
+	for k, v := range t.nonce {
+		cpy.nonce[k] = v
+	}
+	for k, v := range t.balances {
+		cpy.balances[k] = v
+	}
+	t.snapshots = append(t.snapshots, cpy)
+	return len(t.snapshots) - 1
+}
+
+func (t *testStateTree) RevertToSnapshot(id int) {
+	snap := t.snapshots[id]
+	t.data, t.codes, t.nonce, t.balances = snap.data, snap.codes, snap.nonce, snap.balances
+	t.snapshots = t.snapshots[:id]
+}
+
 func (t *testStateTree) GetCode(addr common.Address) []byte {
 	if code, ok := t.codes[ahash.SHA256Array(addr[:])]; ok {
 		return code
 	}
 	return nil
 }
+func (t *testStateTree) GetCodeHash(addr common.Address) common.Hash {
+	if code := t.GetCode(addr); code != nil {
+		return common.Bytes2Hash(ahash.Keccak256(code))
+	}
+	return common.Hash{}
+}
+
+func (t *testStateTree) GetCodeSize(addr common.Address) int {
+	return len(t.GetCode(addr))
+}
+
 func (t *testStateTree) SetState(addr common.Address, key [32]byte, v []byte) {
 	k := ahash.SHA256Array(append(addr[:], key[:]...))
 	t.data[k] = v
@@ -55,9 +106,10 @@ func (t *testStateTree) AddNonce(addr common.Address, val uint64) {
 }
 func newTestStateTree() *testStateTree {
 	return &testStateTree{
-		data:  make(map[[32]byte][]byte),
-		codes: make(map[[32]byte][]byte),
-		nonce: make(map[[32]byte]uint64),
+		data:     make(map[[32]byte][]byte),
+		codes:    make(map[[32]byte][]byte),
+		nonce:    make(map[[32]byte]uint64),
+		balances: make(map[[32]byte]*big.Int),
 	}
 }
 
@@ -124,6 +176,11 @@ func TestXvm_Create(t *testing.T) {
 	c1addr := crypto.CreateAddress(addr.Hash(), nonce1)
 	c1code := vm.stateTree.GetCode(c1addr)
 	assert.Equal(t, c1code, simpleCode)
+	if err := vm.Create(addr, simpleCode); err != errAddressCollision {
+		t.Fatalf("got err %v, want %v", err, errAddressCollision)
+	}
+	// the nonce of the sender is increased by the transaction
+	vm.stateTree.AddNonce(addr, 1)
 	if err := vm.Create(addr, inputBuf.Bytes()); err != nil {
 		t.Fatal(err)
 	}
@@ -146,6 +203,119 @@ func TestXvm_Create(t *testing.T) {
 	assert.Equal(t, gotobj, testACToken)
 }
 
+func TestXvm_CreateLegacy(t *testing.T) {
+	vm := NewXVMWithContext(newTestStateTree(), BlockContext{Legacy: true})
+	addr := common.Address{0x01}
+	simpleCode := []byte("hello, world")
+	// the creations before the vm fixes replace the contract at the address
+	for i := 0; i < 2; i++ {
+		if err := vm.Create(addr, simpleCode); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestXvm_ContractHost(t *testing.T) {
+	st := newTestStateTree()
+	block := BlockContext{
+		Height:    10,
+		Timestamp: 1600000000,
+		Coinbase:  common.Address{0x02},
+		// the randomness is mixed by the chain
+		Randomness: common.Hash{0x03},
+	}
+	vm := NewXVMWithContext(st, block)
+	inputBuf := bytes.NewBuffer(nil)
+	inputBuf.Write(tokenCode)
+	inputBuf.Write(tokenCreateFnHash)
+	inputBuf.Write(testAbTokenCreateParams)
+	addr := common.Address{0x01}
+	if err := vm.Create(addr, inputBuf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	caddr := crypto.CreateAddress(addr.Hash(), vm.stateTree.GetNonce(addr))
+	c, err := vm.GetBuiltinContract(caddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, ok := c.(BuiltinContract)
+	if !ok {
+		t.Fatalf("cover builtin contract err")
+	}
+	assert.Equal(t, bc.BlockHeight(), block.Height)
+	assert.Equal(t, bc.BlockTimestamp(), block.Timestamp)
+	assert.AddressEq(t, bc.BlockCoinbase(), block.Coinbase)
+	assert.HashEqual(t, bc.BlockRandomness(), block.Randomness)
+	assert.Equal(t, bc.ExtCodeSize(caddr), len(tokenCode))
+	assert.HashEqual(t, bc.ExtCodeHash(caddr), common.Bytes2Hash(ahash.Keccak256(tokenCode)))
+	assert.Equal(t, len(bc.CallerChain()), 0)
+}
+
+// tokenV1 is an upgrade of the token keeping its storage.
+type tokenV1 struct {
+	BuiltinContract
+	Name        CTypeString                   `contract:"storage"`
+	Symbol      CTypeString                   `contract:"storage"`
+	Decimals    CTypeUint8                    `contract:"storage"`
+	TotalSupply CTypeUint256                  `contract:"storage"`
+	Balances    map[CTypeAddress]CTypeUint256 `contract:"storage"`
+}
+
+func (t *tokenV1) BuiltinId() uint8 {
+	return 0x01
+}
+
+func TestXvm_BuiltinUpgrade(t *testing.T) {
+	if err := RegisterBuiltinUpgrade(0, new(tokenV1)); err != errInvalidBuiltinVersion {
+		t.Fatalf("got err %v, want %v", err, errInvalidBuiltinVersion)
+	}
+	if err := RegisterBuiltinUpgrade(1, new(tokenV1)); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, HasBuiltinVersion(0x01, 1), true)
+	assert.Equal(t, HasBuiltinVersion(0x01, 2), false)
+	st := newTestStateTree()
+	inputBuf := bytes.NewBuffer(nil)
+	inputBuf.Write(tokenCode)
+	inputBuf.Write(tokenCreateFnHash)
+	inputBuf.Write(testAbTokenCreateParams)
+	addr := common.Address{0x01}
+	if err := NewXVM(st).Create(addr, inputBuf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	caddr := crypto.CreateAddress(addr.Hash(), st.GetNonce(addr))
+	upgraded := NewXVMWithContext(st, BlockContext{Builtins: map[uint8]uint8{0x01: 1}})
+	c, err := upgraded.GetBuiltinContract(caddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc, ok := c.(*tokenV1)
+	if !ok {
+		t.Fatalf("want upgraded token contract")
+	}
+	// the upgraded contract keeps the storage of the token
+	assert.Equal(t, tc.Name, testACToken.name)
+	assert.Equal(t, tc.TotalSupply, testACToken.totalSupply)
+	unknown := NewXVMWithContext(st, BlockContext{Builtins: map[uint8]uint8{0x01: 2}})
+	if _, err = unknown.GetBuiltinContract(caddr); err != errUnknownContractId {
+		t.Fatalf("got err %v, want %v", err, errUnknownContractId)
+	}
+}
+
+// testBuiltins activates the builtin contracts added after the token.
+var testBuiltins = map[uint8]uint8{0x02: 1, 0x03: 1, 0x04: 1, 0x05: 1, 0x06: 1}
+
+func TestXvm_BuiltinActivation(t *testing.T) {
+	st := newTestStateTree()
+	addr := common.Address{0x01}
+	// an escrow contract can only be created once the chain activates it
+	input := append([]byte{0xd0, 0x23, 0x05}, ahash.SHA256([]byte("Create"))...)
+	if err := NewXVM(st).Create(addr, input); err != errUnknownContractId {
+		t.Fatalf("got err %v, want %v", err, errUnknownContractId)
+	}
+	assert.Equal(t, HasBuiltinVersion(0x05, 1), true)
+}
+
 func TestXvm_Run(t *testing.T) {
 
 }
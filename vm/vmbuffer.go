@@ -15,6 +15,7 @@ type Buffer interface {
 	ReadUint8() (CTypeUint8, error)
 	ReadUint16() (CTypeUint16, error)
 	ReadUint32() (CTypeUint32, error)
+	ReadUint64() (CTypeUint64, error)
 	ReadString(size int) (CTypeString, error)
 	ReadUint256() (CTypeUint256, error)
 	Write(p []byte) (n int, err error)
@@ -24,6 +25,9 @@ type Buffer interface {
 type buffer struct {
 	buf []byte
 	off int
+	// legacy drops the padding of the last row from the end of the rows read, which
+	// reads a value of a single row as empty
+	legacy bool
 }
 type row [8]byte
 
@@ -159,32 +163,33 @@ func (b *buffer) ReadUint32() (n CTypeUint32, e error) {
 	copy(n[:], r[:4])
 	return
 }
-func (b *buffer) ReadUint256() (n CTypeUint256, e error) {
-	var r []row
-	var m int
-	r, m, e = b.ReadRows(len(n))
+func (b *buffer) ReadUint64() (n CTypeUint64, e error) {
+	var r row
+	r, e = b.ReadRow()
 	if e != nil {
 		return
 	}
-	buf := make([]byte, len(r)*rowlen)
-	for i := 0; i < len(r); i++ {
-		start := i * rowlen
-		end := (i * rowlen) + rowlen
-		copy(buf[start:end], r[i][:])
-	}
-	if len(buf) > rowlen {
-		copy(n[:], buf[:len(buf)-m])
+	copy(n[:], r[:])
+	return
+}
+
+func (b *buffer) ReadUint256() (n CTypeUint256, e error) {
+	var s []byte
+	s, e = b.readBytes(len(n))
+	if e != nil {
 		return
 	}
-	copy(n[:], buf[:m])
+	copy(n[:], s)
 	return
 }
 func (b *buffer) ReadString(size int) (n CTypeString, e error) {
-	var r []row
-	var m int
-	r, m, e = b.ReadRows(size)
+	return b.readBytes(size)
+}
+
+func (b *buffer) readBytes(size int) ([]byte, error) {
+	r, m, e := b.ReadRows(size)
 	if e != nil {
-		return
+		return nil, e
 	}
 	buf := make([]byte, len(r)*rowlen)
 	for i := 0; i < len(r); i++ {
@@ -192,12 +197,13 @@ func (b *buffer) ReadString(size int) (n CTypeString, e error) {
 		end := (i * rowlen) + rowlen
 		copy(buf[start:end], r[i][:])
 	}
+	if !b.legacy {
+		return buf[:size], nil
+	}
 	if len(buf) > rowlen {
-		n = buf[:len(buf)-m]
-		return
+		return buf[:len(buf)-m], nil
 	}
-	n = buf[:m]
-	return
+	return buf[:m], nil
 }
 
 func NewBuffer(data []byte) *buffer {
@@ -39,3 +39,56 @@ func TestBuffer_ReadString(t *testing.T) {
 		t.Fatalf("want=%x, got=%x", want, []byte(r))
 	}
 }
+
+func TestBuffer_ReadStringSizes(t *testing.T) {
+	// the string is padded to whole rows, only the requested bytes are read back
+	for _, size := range []int{1, 5, rowlen - 1, rowlen, rowlen + 1, 13, 2 * rowlen, 3*rowlen + 3} {
+		want := bytes.Repeat([]byte{0x61}, size)
+		blocks := (size + rowlen - 1) / rowlen
+		data := make([]byte, blocks*rowlen)
+		copy(data, want)
+		r, err := NewBuffer(data).ReadString(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, r) {
+			t.Fatalf("size %d: want=%x, got=%x", size, want, []byte(r))
+		}
+	}
+}
+
+func TestBuffer_ReadStringLegacy(t *testing.T) {
+	// the legacy decoding drops the padding of the last row from the end of the rows
+	for _, tt := range []struct{ size, want int }{{rowlen, 0}, {rowlen + 2, 2*rowlen - 2}, {2 * rowlen, 2 * rowlen}} {
+		data := bytes.Repeat([]byte{0x61}, (tt.size+rowlen-1)/rowlen*rowlen)
+		buf := NewBuffer(data)
+		buf.legacy = true
+		r, err := buf.ReadString(tt.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r) != tt.want {
+			t.Fatalf("size %d: want %d bytes, got %d", tt.size, tt.want, len(r))
+		}
+	}
+}
+
+func TestBuffer_ReadUint256(t *testing.T) {
+	var want CTypeUint256
+	for i := range want {
+		want[i] = byte(i + 1)
+	}
+	data := append(want[:], testRow...)
+	buf := NewBuffer(data)
+	r, err := buf.ReadUint256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != want {
+		t.Fatalf("want=%x, got=%x", want, r)
+	}
+	// the following rows are left in the buffer
+	if _, err = buf.ReadRow(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -19,6 +19,7 @@ type OpNum [8]byte
 
 var (
 	errStackOverflow = errors.New("stack overflow")
+	errInvalidOpcode = errors.New("unknown op_code")
 )
 
 type vmstack struct {
@@ -83,7 +84,7 @@ out:
 			//b := vm.stack.popUint64()
 			//vm.stack.pushUint64(a + b)
 		default:
-			return errors.New("unknown op_code")
+			return errInvalidOpcode
 		}
 	}
 	return nil
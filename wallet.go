@@ -26,6 +26,13 @@ import (
 	"xfsgo/storage/badger"
 )
 
+var (
+	// ErrWatchOnly is returned for the private key of a watch-only address, the wallet
+	// can not sign for it.
+	ErrWatchOnly       = errors.New("address is watch-only")
+	ErrWatchOnlyExists = errors.New("address is already in the wallet")
+)
+
 // Wallet represents a software wallet that has a default address derived from private key.
 type Wallet struct {
 	db          *keyStoreDB
@@ -33,13 +40,24 @@ type Wallet struct {
 	cacheMu     sync.RWMutex
 	defaultAddr common.Address
 	cache       map[common.Address]*ecdsa.PrivateKey
+	backup      *KeyBackupConfig
+
+	resMu        sync.Mutex
+	spendable    SpendableFn
+	reservations map[string]*Reservation
+
+	histMu sync.Mutex
+
+	auditMu  sync.Mutex
+	auditKey []byte
 }
 
 // NewWallet constructs and returns a new Wallet instance with badger db.
 func NewWallet(storage *badger.Storage) *Wallet {
 	w := &Wallet{
-		db:    newKeyStoreDB(storage),
-		cache: make(map[common.Address]*ecdsa.PrivateKey),
+		db:           newKeyStoreDB(storage),
+		cache:        make(map[common.Address]*ecdsa.PrivateKey),
+		reservations: make(map[string]*Reservation),
 	}
 	w.defaultAddr, _ = w.db.GetDefaultAddress()
 	return w
@@ -58,8 +76,13 @@ func (w *Wallet) GetWalletNewTime(addr common.Address) ([]byte, error) {
 	return w.db.GetAddressNewTime(addr)
 }
 
+// AddWallet adds the private key to the wallet. If the key backup is enabled the key
+// is not added unless its archive is written.
 func (w *Wallet) AddWallet(key *ecdsa.PrivateKey) (common.Address, error) {
 	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	if err := w.backupKey(addr, key); err != nil {
+		return noneAddress, err
+	}
 	if err := w.db.PutPrivateKey(addr, key); err != nil {
 		return noneAddress, err
 	}
@@ -79,6 +102,8 @@ func (w *Wallet) All() map[common.Address]*ecdsa.PrivateKey {
 	return data
 }
 
+// GetKeyByAddress returns the private key of the address, ErrWatchOnly is returned
+// for a watch-only address.
 func (w *Wallet) GetKeyByAddress(address common.Address) (*ecdsa.PrivateKey, error) {
 	w.cacheMu.RLock()
 	if pk, has := w.cache[address]; has {
@@ -88,6 +113,9 @@ func (w *Wallet) GetKeyByAddress(address common.Address) (*ecdsa.PrivateKey, err
 	w.cacheMu.RUnlock()
 	key, err := w.db.GetPrivateKey(address)
 	if err != nil {
+		if w.db.HasWatchAddress(address) {
+			return nil, ErrWatchOnly
+		}
 		return nil, err
 	}
 	w.cacheMu.Lock()
@@ -101,6 +129,9 @@ func (w *Wallet) SetDefault(address common.Address) error {
 		return nil
 	}
 	k, err := w.GetKeyByAddress(address)
+	if err == ErrWatchOnly {
+		return err
+	}
 	if err != nil || k == nil {
 		return fmt.Errorf("not found address %s", address.B58String())
 	}
@@ -133,8 +164,12 @@ func (w *Wallet) Remove(address common.Address) error {
 
 		// w.mu.Unlock()
 	}
+	if w.db.HasWatchAddress(address) {
+		return w.db.RemoveWatchAddress(address)
+	}
 	w.mu.Lock()
 	if err := w.db.RemoveAddress(address); err != nil {
+		w.mu.Unlock()
 		return err
 	}
 	w.mu.Unlock()
@@ -162,3 +197,47 @@ func (w *Wallet) Import(der []byte) (common.Address, error) {
 	}
 	return w.AddWallet(pKey)
 }
+
+// AddWatchOnly adds the address without a private key, it is listed and watched like
+// the other accounts but the wallet refuses to sign for it.
+func (w *Wallet) AddWatchOnly(address common.Address) error {
+	if w.IsWatchOnly(address) {
+		return ErrWatchOnlyExists
+	}
+	if _, err := w.db.GetPrivateKey(address); err == nil {
+		return ErrWatchOnlyExists
+	}
+	return w.db.PutWatchAddress(address)
+}
+
+// IsWatchOnly reports whether the address is a watch-only address of the wallet.
+func (w *Wallet) IsWatchOnly(address common.Address) bool {
+	return w.db.HasWatchAddress(address)
+}
+
+// WatchOnly returns the watch-only addresses of the wallet.
+func (w *Wallet) WatchOnly() []common.Address {
+	addrs := make([]common.Address, 0)
+	w.db.ForeachWatchAddress(func(address common.Address) {
+		addrs = append(addrs, address)
+	})
+	return addrs
+}
+
+// Accounts returns the addresses of the wallet, the watch-only addresses included.
+func (w *Wallet) Accounts() []common.Address {
+	addrs := make([]common.Address, 0)
+	w.db.Foreach(func(address common.Address, _ *ecdsa.PrivateKey) {
+		addrs = append(addrs, address)
+	})
+	return append(addrs, w.WatchOnly()...)
+}
+
+// Owns reports whether the address is an account of the wallet, watch-only or not.
+func (w *Wallet) Owns(address common.Address) bool {
+	if w.IsWatchOnly(address) {
+		return true
+	}
+	_, err := w.GetKeyByAddress(address)
+	return err == nil
+}
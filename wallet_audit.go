@@ -0,0 +1,216 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"time"
+	"xfsgo/common"
+)
+
+var (
+	auditEntryPre = []byte("audit:")
+	auditHeadKey  = []byte("audithead")
+	auditKeyKey   = []byte("auditkey")
+)
+
+// ErrAuditLogCorrupt is returned when an entry of the signing log fails to decrypt or
+// does not link to the entry before it.
+var ErrAuditLogCorrupt = errors.New("signing log corrupt")
+
+// SigningRecord is an entry of the signing log of the wallet. Origin names the operation
+// that requested the signature, Prev is the hash of the stored entry before it, which chains
+// the entries so removed or reordered entries are detected.
+type SigningRecord struct {
+	Seq    uint64         `json:"seq"`
+	Time   int64          `json:"time"`
+	Origin string         `json:"origin"`
+	Signer common.Address `json:"signer"`
+	To     common.Address `json:"to"`
+	Value  *big.Int       `json:"value"`
+	Hash   common.Hash    `json:"hash"`
+	Prev   common.Hash    `json:"prev"`
+}
+
+func auditEntryKey(seq uint64) []byte {
+	// audit:<seq> -> <nonce><sealed record>
+	key := make([]byte, len(auditEntryPre)+8)
+	copy(key, auditEntryPre)
+	binary.BigEndian.PutUint64(key[len(auditEntryPre):], seq)
+	return key
+}
+
+// getAuditHead returns the sequence of the next entry and the hash of the last one.
+func (db *keyStoreDB) getAuditHead() (uint64, common.Hash) {
+	data, err := db.storage.GetData(auditHeadKey)
+	if err != nil || len(data) != 8+len(common.Hash{}) {
+		return 0, common.Hash{}
+	}
+	return binary.BigEndian.Uint64(data[:8]), common.Bytes2Hash(data[8:])
+}
+
+func (db *keyStoreDB) putAuditEntry(seq uint64, sealed []byte) error {
+	head := make([]byte, 8, 8+len(common.Hash{}))
+	binary.BigEndian.PutUint64(head, seq+1)
+	sum := sha256.Sum256(sealed)
+	head = append(head, sum[:]...)
+	batch := db.storage.NewWriteBatch()
+	defer batch.Destroy()
+	if err := batch.Put(auditEntryKey(seq), sealed); err != nil {
+		return err
+	}
+	if err := batch.Put(auditHeadKey, head); err != nil {
+		return err
+	}
+	return db.storage.CommitWriteBatch(batch)
+}
+
+func (db *keyStoreDB) getAuditEntry(seq uint64) ([]byte, error) {
+	return db.storage.GetData(auditEntryKey(seq))
+}
+
+// SetAuditSecret sets the secret the signing log is encrypted with. Without a secret the
+// log is encrypted with a random key stored in the keys database.
+func (w *Wallet) SetAuditSecret(secret []byte) {
+	w.auditMu.Lock()
+	defer w.auditMu.Unlock()
+	if len(secret) == 0 {
+		w.auditKey = nil
+		return
+	}
+	sum := sha256.Sum256(secret)
+	w.auditKey = sum[:]
+}
+
+func (w *Wallet) auditCipher() (cipher.AEAD, error) {
+	if w.auditKey == nil {
+		key, err := w.db.storage.GetData(auditKeyKey)
+		if err != nil {
+			key = make([]byte, 32)
+			if _, err = io.ReadFull(rand.Reader, key); err != nil {
+				return nil, err
+			}
+			if err = w.db.storage.SetData(auditKeyKey, key); err != nil {
+				return nil, err
+			}
+		}
+		w.auditKey = key
+	}
+	block, err := aes.NewCipher(w.auditKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// RecordSigning appends the signature of the hash by the signer to the signing log. It must
+// succeed before the signed data is used, so that no signature of the wallet is unaccounted.
+func (w *Wallet) RecordSigning(origin string, signer, to common.Address, value *big.Int, hash common.Hash) error {
+	w.auditMu.Lock()
+	defer w.auditMu.Unlock()
+	aead, err := w.auditCipher()
+	if err != nil {
+		return err
+	}
+	seq, prev := w.db.getAuditHead()
+	record := &SigningRecord{
+		Seq:    seq,
+		Time:   time.Now().Unix(),
+		Origin: origin,
+		Signer: signer,
+		To:     to,
+		Value:  new(big.Int),
+		Hash:   hash,
+		Prev:   prev,
+	}
+	if value != nil {
+		record.Value.Set(value)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	// the sequence is the additional data, an entry moved to another sequence fails to open
+	sealed := aead.Seal(nonce, nonce, data, auditEntryKey(seq))
+	return w.db.putAuditEntry(seq, sealed)
+}
+
+// SigningLogLen returns the number of entries of the signing log.
+func (w *Wallet) SigningLogLen() uint64 {
+	w.auditMu.Lock()
+	defer w.auditMu.Unlock()
+	n, _ := w.db.getAuditHead()
+	return n
+}
+
+// SigningLog returns up to limit entries of the signing log starting at the sequence start,
+// it returns ErrAuditLogCorrupt if an entry is missing, fails to decrypt or is not linked
+// to the entry before it.
+func (w *Wallet) SigningLog(start uint64, limit int) ([]*SigningRecord, error) {
+	w.auditMu.Lock()
+	defer w.auditMu.Unlock()
+	aead, err := w.auditCipher()
+	if err != nil {
+		return nil, err
+	}
+	n, last := w.db.getAuditHead()
+	var prev common.Hash
+	if start > 0 && start <= n {
+		sealed, err := w.db.getAuditEntry(start - 1)
+		if err != nil {
+			return nil, ErrAuditLogCorrupt
+		}
+		prev = common.Hash(sha256.Sum256(sealed))
+	}
+	records := make([]*SigningRecord, 0)
+	for seq := start; seq < n && len(records) < limit; seq++ {
+		sealed, err := w.db.getAuditEntry(seq)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			return nil, ErrAuditLogCorrupt
+		}
+		nonce := sealed[:aead.NonceSize()]
+		data, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], auditEntryKey(seq))
+		if err != nil {
+			return nil, ErrAuditLogCorrupt
+		}
+		record := new(SigningRecord)
+		if err = json.Unmarshal(data, record); err != nil {
+			return nil, ErrAuditLogCorrupt
+		}
+		if record.Seq != seq || record.Prev != prev {
+			return nil, ErrAuditLogCorrupt
+		}
+		prev = common.Hash(sha256.Sum256(sealed))
+		if seq == n-1 && prev != last {
+			return nil, ErrAuditLogCorrupt
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,53 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+func TestWallet_SigningLog(t *testing.T) {
+	db := newTestStateDB(t)
+	w := NewWallet(db)
+	w.SetAuditSecret([]byte("secret"))
+	signer := common.Address{0x01}
+	for i := 0; i < 5; i++ {
+		err := w.RecordSigning("Wallet.SendTransaction", signer, common.Address{0x02},
+			big.NewInt(int64(i)), common.Hash{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, w.SigningLogLen(), uint64(5))
+	page, err := w.SigningLog(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(page), 2)
+	assert.Equal(t, page[0].Seq, uint64(1))
+	assert.Equal(t, page[1].Hash, common.Hash{2})
+	assert.BigIntEqual(t, page[1].Value, big.NewInt(2))
+	all, err := w.SigningLog(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(all), 5)
+
+	// the log does not open with another secret
+	other := NewWallet(db)
+	other.SetAuditSecret([]byte("other"))
+	_, err = other.SigningLog(0, 10)
+	assert.Equal(t, err, ErrAuditLogCorrupt)
+
+	// an entry replaced with another one of the log breaks the chain
+	sealed, err := db.GetData(auditEntryKey(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.SetData(auditEntryKey(2), sealed); err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.SigningLog(0, 10)
+	assert.Equal(t, err, ErrAuditLogCorrupt)
+}
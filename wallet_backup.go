@@ -0,0 +1,304 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"xfsgo/common"
+	"xfsgo/crypto"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keyBackupVersion = 1
+	keyBackupExt     = ".xfskey"
+
+	// scrypt parameters of the backup archives
+	keyBackupScryptN = 1 << 15
+	keyBackupScryptR = 8
+	keyBackupScryptP = 1
+)
+
+var (
+	ErrKeyBackupPassphrase = errors.New("key backup passphrase not be empty")
+	ErrKeyBackupDecrypt    = errors.New("could not decrypt key backup")
+)
+
+// KeyBackupConfig configures the backup archives written when a key is created or imported.
+// The archives are written to the directory Dir, the S3 compatible bucket S3, or both.
+type KeyBackupConfig struct {
+	// Passphrase is the passphrase the archives are encrypted with.
+	Passphrase string
+	Dir        string
+	S3         *S3BackupConfig
+}
+
+// S3BackupConfig is an S3 compatible bucket the archives are uploaded to, the requests are
+// signed with AWS signature version 4.
+type S3BackupConfig struct {
+	// Endpoint is the base url of the service, the archives are put to
+	// <endpoint>/<bucket>/<prefix><name>.
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Timeout   time.Duration
+}
+
+// KeyBackupArchive is a passphrase encrypted private key of the wallet.
+type KeyBackupArchive struct {
+	Version    int    `json:"version"`
+	Address    string `json:"address"`
+	Created    int64  `json:"created"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// SealKeyBackup encrypts the private key with the passphrase and returns the encoded archive.
+func SealKeyBackup(key *ecdsa.PrivateKey, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrKeyBackupPassphrase
+	}
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	archive := &KeyBackupArchive{
+		Version: keyBackupVersion,
+		Created: time.Now().Unix(),
+		KDF:     "scrypt",
+		N:       keyBackupScryptN,
+		R:       keyBackupScryptR,
+		P:       keyBackupScryptP,
+		Salt:    hex.EncodeToString(salt),
+	}
+	addr := crypto.DefaultPubKey2Addr(key.PublicKey)
+	archive.Address = addr.B58String()
+	aead, err := archive.cipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	archive.Nonce = hex.EncodeToString(nonce)
+	sealed := aead.Seal(nil, nonce, crypto.DefaultEncodePrivateKey(key), []byte(archive.Address))
+	archive.Ciphertext = hex.EncodeToString(sealed)
+	return json.MarshalIndent(archive, "", "  ")
+}
+
+// OpenKeyBackup decrypts the archive with the passphrase and returns the private key.
+func OpenKeyBackup(data []byte, passphrase string) (*ecdsa.PrivateKey, error) {
+	archive := new(KeyBackupArchive)
+	if err := json.Unmarshal(data, archive); err != nil {
+		return nil, err
+	}
+	if archive.Version != keyBackupVersion || archive.KDF != "scrypt" {
+		return nil, fmt.Errorf("unknown key backup version %d", archive.Version)
+	}
+	salt, err := hex.DecodeString(archive.Salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(archive.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := hex.DecodeString(archive.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := archive.cipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrKeyBackupDecrypt
+	}
+	der, err := aead.Open(nil, nonce, sealed, []byte(archive.Address))
+	if err != nil {
+		return nil, ErrKeyBackupDecrypt
+	}
+	_, key, err := crypto.DecodePrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (archive *KeyBackupArchive) cipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	dk, err := scrypt.Key([]byte(passphrase), salt, archive.N, archive.R, archive.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyBackupName returns the name of the archive of the address, archives are never
+// overwritten so every creation or import of a key gets a new name.
+func keyBackupName(addr common.Address) string {
+	return fmt.Sprintf("%s-%d%s", addr.B58String(), time.Now().UnixNano(), keyBackupExt)
+}
+
+// SetKeyBackup enables the backup of the keys created or imported afterwards, nil
+// disables it.
+func (w *Wallet) SetKeyBackup(config *KeyBackupConfig) error {
+	if config != nil && config.Passphrase == "" {
+		return ErrKeyBackupPassphrase
+	}
+	if config != nil && config.Dir != "" {
+		if err := os.MkdirAll(config.Dir, 0700); err != nil {
+			return err
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.backup = config
+	return nil
+}
+
+// backupKey writes the archive of the key to the configured locations.
+func (w *Wallet) backupKey(addr common.Address, key *ecdsa.PrivateKey) error {
+	w.mu.RLock()
+	config := w.backup
+	w.mu.RUnlock()
+	if config == nil {
+		return nil
+	}
+	data, err := SealKeyBackup(key, config.Passphrase)
+	if err != nil {
+		return err
+	}
+	name := keyBackupName(addr)
+	if config.Dir != "" {
+		if err = writeKeyBackupFile(filepath.Join(config.Dir, name), data); err != nil {
+			return err
+		}
+	}
+	if config.S3 != nil {
+		if err = config.S3.put(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeKeyBackupFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (c *S3BackupConfig) put(name string, data []byte) error {
+	url := strings.TrimRight(c.Endpoint, "/") + "/" + c.Bucket + "/" + c.Prefix + name
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.sign(req, data, time.Now().UTC())
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("key backup upload: %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds the AWS signature version 4 of the request to its headers.
+func (c *S3BackupConfig) sign(req *http.Request, payload []byte, now time.Time) {
+	region := c.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + hex.EncodeToString(payloadHash[:]),
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	hmacSHA256 := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		_, _ = h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKey, scope, signedHeaders, signature))
+}
@@ -0,0 +1,77 @@
+package xfsgo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/crypto"
+)
+
+func TestWallet_KeyBackup(t *testing.T) {
+	uploads := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		uploads[r.URL.Path] = data
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	w := NewWallet(newTestStateDB(t))
+	assert.Equal(t, w.SetKeyBackup(&KeyBackupConfig{Dir: dir}), ErrKeyBackupPassphrase)
+	err := w.SetKeyBackup(&KeyBackupConfig{
+		Passphrase: "passphrase",
+		Dir:        dir,
+		S3: &S3BackupConfig{
+			Endpoint:  server.URL,
+			Bucket:    "keys",
+			Prefix:    "node/",
+			AccessKey: "access",
+			SecretKey: "secret",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := w.AddByRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+keyBackupExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, len(uploads), 1)
+	for path := range uploads {
+		assert.Equal(t, strings.HasPrefix(path, "/keys/node/"+addr.B58String()), true)
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := OpenKeyBackup(data, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, crypto.DefaultPubKey2Addr(key.PublicKey), addr)
+	_, err = OpenKeyBackup(data, "wrong")
+	assert.Equal(t, err, ErrKeyBackupDecrypt)
+
+	// the key is not added without its backup
+	server.Close()
+	if err = w.SetKeyBackup(&KeyBackupConfig{Passphrase: "passphrase", S3: &S3BackupConfig{Endpoint: server.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.AddByRandom(); err == nil {
+		t.Fatal("want error of failed backup")
+	}
+	assert.Equal(t, len(w.Accounts()), 1)
+}
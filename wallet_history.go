@@ -0,0 +1,248 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"encoding/json"
+	"math/big"
+	"sort"
+	"time"
+	"xfsgo/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+var walletTxPre = []byte("wtx:")
+
+// Status of the transactions sent by the wallet.
+const (
+	WalletTxPending   = "pending"
+	WalletTxConfirmed = "confirmed"
+	WalletTxReplaced  = "replaced"
+	WalletTxDropped   = "dropped"
+)
+
+// WalletTxTransition is a change of the status of a transaction sent by the wallet,
+// Reason is the reason code of the pool for dropped transactions.
+type WalletTxTransition struct {
+	Status string `json:"status"`
+	Time   int64  `json:"time"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// WalletTx is the local metadata of a transaction sent by the wallet.
+type WalletTx struct {
+	Hash        common.Hash           `json:"hash"`
+	From        common.Address        `json:"from"`
+	To          common.Address        `json:"to"`
+	Value       *big.Int              `json:"value"`
+	Nonce       uint64                `json:"nonce"`
+	GasPrice    *big.Int              `json:"gas_price"`
+	Submitted   int64                 `json:"submitted"`
+	Status      string                `json:"status"`
+	Transitions []*WalletTxTransition `json:"transitions"`
+	// Replaces and ReplacedBy link the transactions of a replacement chain, a transaction
+	// replaced in the pool by another one of the same sender and nonce.
+	Replaces   common.Hash `json:"replaces"`
+	ReplacedBy common.Hash `json:"replaced_by"`
+}
+
+func (wtx *WalletTx) setStatus(status string, reason string, now int64) {
+	if wtx.Status == status {
+		return
+	}
+	wtx.Status = status
+	wtx.Transitions = append(wtx.Transitions, &WalletTxTransition{
+		Status: status,
+		Time:   now,
+		Reason: reason,
+	})
+}
+
+func walletTxKey(from common.Address, hash common.Hash) []byte {
+	// wtx:<from><hash> -> <wallet tx>
+	key := make([]byte, 0, len(walletTxPre)+len(from)+len(hash))
+	key = append(key, walletTxPre...)
+	key = append(key, from[:]...)
+	return append(key, hash[:]...)
+}
+
+func (db *keyStoreDB) GetWalletTx(from common.Address, hash common.Hash) (*WalletTx, error) {
+	data, err := db.storage.GetData(walletTxKey(from, hash))
+	if err != nil {
+		return nil, err
+	}
+	wtx := new(WalletTx)
+	if err = json.Unmarshal(data, wtx); err != nil {
+		return nil, err
+	}
+	return wtx, nil
+}
+
+func (db *keyStoreDB) PutWalletTx(wtx *WalletTx) error {
+	data, err := json.Marshal(wtx)
+	if err != nil {
+		return err
+	}
+	return db.storage.SetData(walletTxKey(wtx.From, wtx.Hash), data)
+}
+
+func (db *keyStoreDB) ForeachWalletTx(from common.Address, fn func(wtx *WalletTx) error) error {
+	prefix := make([]byte, 0, len(walletTxPre)+len(from))
+	prefix = append(prefix, walletTxPre...)
+	prefix = append(prefix, from[:]...)
+	return db.storage.PrefixForeachData(prefix, func(k []byte, v []byte) error {
+		wtx := new(WalletTx)
+		if err := json.Unmarshal(v, wtx); err != nil {
+			return err
+		}
+		return fn(wtx)
+	})
+}
+
+// RecordTransaction stores the transaction submitted by the wallet as pending.
+func (w *Wallet) RecordTransaction(tx *Transaction) error {
+	from, err := tx.FromAddr()
+	if err != nil {
+		return err
+	}
+	w.histMu.Lock()
+	defer w.histMu.Unlock()
+	now := time.Now().Unix()
+	wtx := &WalletTx{
+		Hash:      tx.Hash(),
+		From:      from,
+		To:        tx.To,
+		Value:     new(big.Int).Set(tx.Value),
+		Nonce:     tx.Nonce,
+		GasPrice:  new(big.Int).Set(tx.GasPrice),
+		Submitted: now,
+	}
+	wtx.setStatus(WalletTxPending, "", now)
+	// the pool reports the replacement before the send returns
+	err = w.db.ForeachWalletTx(from, func(old *WalletTx) error {
+		if old.ReplacedBy == wtx.Hash {
+			wtx.Replaces = old.Hash
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.db.PutWalletTx(wtx)
+}
+
+// updateWalletTx applies fn to the stored transaction sent by the wallet, it does nothing
+// for transactions not sent by the wallet.
+func (w *Wallet) updateWalletTx(tx *Transaction, fn func(wtx *WalletTx)) {
+	from, err := tx.FromAddr()
+	if err != nil {
+		return
+	}
+	w.histMu.Lock()
+	defer w.histMu.Unlock()
+	wtx, err := w.db.GetWalletTx(from, tx.Hash())
+	if err != nil {
+		return
+	}
+	fn(wtx)
+	if err = w.db.PutWalletTx(wtx); err != nil {
+		logrus.Warnf("Failed to write wallet transaction: hash=%x, err=%s", wtx.Hash, err)
+	}
+}
+
+func (w *Wallet) handleTxPoolEvent(event TxPoolEvent, now int64) {
+	switch event.Kind {
+	case TxPoolReplaced:
+		w.updateWalletTx(event.Tx, func(wtx *WalletTx) {
+			wtx.ReplacedBy = event.ReplacedBy
+			wtx.setStatus(WalletTxReplaced, "", now)
+		})
+		from, err := event.Tx.FromAddr()
+		if err != nil {
+			return
+		}
+		w.histMu.Lock()
+		defer w.histMu.Unlock()
+		if wtx, err := w.db.GetWalletTx(from, event.ReplacedBy); err == nil {
+			wtx.Replaces = event.Tx.Hash()
+			_ = w.db.PutWalletTx(wtx)
+		}
+	case TxPoolDropped:
+		w.updateWalletTx(event.Tx, func(wtx *WalletTx) {
+			if wtx.Status == WalletTxPending {
+				wtx.setStatus(WalletTxDropped, event.Reason, now)
+			}
+		})
+	}
+}
+
+// TrackTransactions follows the transactions sent by the wallet through the pool and
+// the chain and records their status transitions.
+func (w *Wallet) TrackTransactions(eventBus *EventBus) {
+	go w.historyLoop(eventBus)
+}
+
+func (w *Wallet) historyLoop(eventBus *EventBus) {
+	txPoolEventSub := eventBus.Subscript(TxPoolEvent{})
+	chainHeadEventSub := eventBus.Subscript(ChainHeadEvent{})
+	defer func() {
+		chainHeadEventSub.Unsubscribe()
+		txPoolEventSub.Unsubscribe()
+	}()
+	for {
+		select {
+		case e := <-txPoolEventSub.Chan():
+			w.handleTxPoolEvent(e.(TxPoolEvent), time.Now().Unix())
+		case e := <-chainHeadEventSub.Chan():
+			event := e.(ChainHeadEvent)
+			if event.Block != nil {
+				w.confirmWalletTxs(event.Block.Transactions, time.Now().Unix())
+			}
+		}
+	}
+}
+
+func (w *Wallet) confirmWalletTxs(txs []*Transaction, now int64) {
+	for _, tx := range txs {
+		w.updateWalletTx(tx, func(wtx *WalletTx) {
+			wtx.setStatus(WalletTxConfirmed, "", now)
+		})
+	}
+}
+
+// GetTransactionHistory returns the transactions sent by the wallet from the address
+// ordered by submission time.
+func (w *Wallet) GetTransactionHistory(addr common.Address) ([]*WalletTx, error) {
+	w.histMu.Lock()
+	defer w.histMu.Unlock()
+	txs := make([]*WalletTx, 0)
+	err := w.db.ForeachWalletTx(addr, func(wtx *WalletTx) error {
+		txs = append(txs, wtx)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].Submitted != txs[j].Submitted {
+			return txs[i].Submitted < txs[j].Submitted
+		}
+		return txs[i].Nonce < txs[j].Nonce
+	})
+	return txs, nil
+}
@@ -0,0 +1,68 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+func TestWallet_GetTransactionHistory(t *testing.T) {
+	w := NewWallet(newTestStateDB(t))
+	addr, err := w.AddByRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := w.GetKeyByAddress(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTx := func(nonce uint64, price int64) *Transaction {
+		tx := NewTransactionByStd(&StdTransaction{
+			GasPrice: big.NewInt(price),
+			GasLimit: common.TxGas,
+			Value:    big.NewInt(1),
+			Nonce:    nonce,
+		})
+		_ = tx.SignWithPrivateKey(key)
+		return tx
+	}
+	a, b, c := newTx(0, 10), newTx(0, 20), newTx(1, 10)
+	if err = w.RecordTransaction(a); err != nil {
+		t.Fatal(err)
+	}
+	// the pool reports the replacement before the replacing send is recorded
+	w.handleTxPoolEvent(TxPoolEvent{Kind: TxPoolReplaced, Tx: a, ReplacedBy: b.Hash()}, 1)
+	if err = w.RecordTransaction(b); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.RecordTransaction(c); err != nil {
+		t.Fatal(err)
+	}
+	w.confirmWalletTxs([]*Transaction{b}, 2)
+	w.handleTxPoolEvent(TxPoolEvent{Kind: TxPoolDropped, Tx: c, Reason: TxDropExpired}, 3)
+
+	txs, err := w.GetTransactionHistory(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[common.Hash]*WalletTx)
+	for _, wtx := range txs {
+		status[wtx.Hash] = wtx
+	}
+	assert.Equal(t, len(status), 3)
+	ra, rb, rc := status[a.Hash()], status[b.Hash()], status[c.Hash()]
+	assert.Equal(t, ra.Status, WalletTxReplaced)
+	assert.Equal(t, ra.ReplacedBy, b.Hash())
+	assert.Equal(t, len(ra.Transitions), 2)
+	assert.Equal(t, rb.Status, WalletTxConfirmed)
+	assert.Equal(t, rb.Replaces, a.Hash())
+	assert.Equal(t, rc.Status, WalletTxDropped)
+	assert.Equal(t, rc.Transitions[1], &WalletTxTransition{Status: WalletTxDropped, Time: 3, Reason: TxDropExpired})
+
+	other, err := w.GetTransactionHistory(common.Address{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(other), 0)
+}
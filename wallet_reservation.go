@@ -0,0 +1,246 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+	"xfsgo/common"
+)
+
+// reservationIDLen is the number of random bytes of a reservation id.
+const reservationIDLen = 16
+
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationUsed     = errors.New("reservation already used")
+	ErrReservationTooSmall = errors.New("transaction cost exceeds reservation")
+	ErrInvalidReservation  = errors.New("invalid reservation amount or ttl")
+	ErrFundsReserved       = errors.New("balance not enough or reserved")
+)
+
+// SpendableFn returns the balance of an address which is not spent by pending transactions.
+type SpendableFn func(addr common.Address) *big.Int
+
+// Reservation earmarks funds of a wallet address. Reserved funds can only be spent by
+// a transaction sent with the reservation, the reservation is consumed when that
+// transaction is confirmed and released when it expires.
+type Reservation struct {
+	ID      string         `json:"id"`
+	Address common.Address `json:"address"`
+	Amount  *big.Int       `json:"amount"`
+	Expires int64          `json:"expires"`
+	// TxHash is the hash of the transaction spending the reservation, the amount
+	// is then covered by the pending cost of the address.
+	TxHash common.Hash `json:"tx_hash"`
+}
+
+func (r *Reservation) used() bool {
+	return r.TxHash != common.Hash{}
+}
+
+func (r *Reservation) copy() *Reservation {
+	cpy := *r
+	cpy.Amount = new(big.Int).Set(r.Amount)
+	return &cpy
+}
+
+func newReservationID() string {
+	var id [reservationIDLen]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// EnableReservations makes Reserve check the spendable balance of the addresses and
+// consumes the reservations of transactions included in new chain heads.
+func (w *Wallet) EnableReservations(spendable SpendableFn, eventBus *EventBus) {
+	w.resMu.Lock()
+	w.spendable = spendable
+	w.resMu.Unlock()
+	if eventBus != nil {
+		go w.reservationLoop(eventBus)
+	}
+}
+
+func (w *Wallet) reservationLoop(eventBus *EventBus) {
+	chainHeadEventSub := eventBus.Subscript(ChainHeadEvent{})
+	defer chainHeadEventSub.Unsubscribe()
+	for e := range chainHeadEventSub.Chan() {
+		event := e.(ChainHeadEvent)
+		if event.Block != nil {
+			w.ConfirmTransactions(event.Block.Transactions)
+		}
+	}
+}
+
+// pruneReservations removes the expired reservations, it must be called with resMu held.
+func (w *Wallet) pruneReservations(now time.Time) {
+	for id, r := range w.reservations {
+		if now.Unix() >= r.Expires {
+			delete(w.reservations, id)
+		}
+	}
+}
+
+// reserved returns the amount reserved and not yet spent for the address, it must be
+// called with resMu held.
+func (w *Wallet) reserved(addr common.Address) *big.Int {
+	amount := new(big.Int)
+	for _, r := range w.reservations {
+		if r.Address == addr && !r.used() {
+			amount.Add(amount, r.Amount)
+		}
+	}
+	return amount
+}
+
+// available returns the spendable balance of the address which is not reserved, it
+// returns nil if reservations are not enabled. It must be called with resMu held.
+func (w *Wallet) available(addr common.Address) *big.Int {
+	if w.spendable == nil {
+		return nil
+	}
+	balance := w.spendable(addr)
+	if balance == nil {
+		balance = new(big.Int)
+	}
+	available := new(big.Int).Sub(balance, w.reserved(addr))
+	if available.Sign() < 0 {
+		available.SetInt64(0)
+	}
+	return available
+}
+
+// Available returns the spendable balance of the address which is not reserved, or nil
+// if reservations are not enabled.
+func (w *Wallet) Available(addr common.Address) *big.Int {
+	w.resMu.Lock()
+	defer w.resMu.Unlock()
+	w.pruneReservations(time.Now())
+	return w.available(addr)
+}
+
+// Reserve earmarks amount of the funds of the address for ttl.
+func (w *Wallet) Reserve(addr common.Address, amount *big.Int, ttl time.Duration) (*Reservation, error) {
+	if amount == nil || amount.Sign() <= 0 || ttl <= 0 {
+		return nil, ErrInvalidReservation
+	}
+	if _, err := w.GetKeyByAddress(addr); err != nil {
+		return nil, err
+	}
+	w.resMu.Lock()
+	defer w.resMu.Unlock()
+	now := time.Now()
+	w.pruneReservations(now)
+	if available := w.available(addr); available != nil && available.Cmp(amount) < 0 {
+		return nil, ErrFundsReserved
+	}
+	r := &Reservation{
+		ID:      newReservationID(),
+		Address: addr,
+		Amount:  new(big.Int).Set(amount),
+		Expires: now.Add(ttl).Unix(),
+	}
+	w.reservations[r.ID] = r
+	return r.copy(), nil
+}
+
+// Release removes a reservation which is not needed anymore.
+func (w *Wallet) Release(id string) error {
+	w.resMu.Lock()
+	defer w.resMu.Unlock()
+	if _, has := w.reservations[id]; !has {
+		return ErrReservationNotFound
+	}
+	delete(w.reservations, id)
+	return nil
+}
+
+// Reservations returns the reservations of the address ordered by expiry, or of all
+// addresses if addr is the zero address.
+func (w *Wallet) Reservations(addr common.Address) []*Reservation {
+	w.resMu.Lock()
+	defer w.resMu.Unlock()
+	w.pruneReservations(time.Now())
+	list := make([]*Reservation, 0)
+	for _, r := range w.reservations {
+		if addr.Equals(noneAddress) || r.Address == addr {
+			list = append(list, r.copy())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Expires != list[j].Expires {
+			return list[i].Expires < list[j].Expires
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Spend sends a transaction of the address costing cost. Without a reservation id the
+// cost must be covered by the funds which are not reserved, otherwise by the reservation
+// which is then bound to the transaction. Sends of the wallet are serialized so
+// concurrent callers cannot spend the same funds twice.
+func (w *Wallet) Spend(addr common.Address, id string, cost *big.Int, send func() (common.Hash, error)) (common.Hash, error) {
+	w.resMu.Lock()
+	defer w.resMu.Unlock()
+	w.pruneReservations(time.Now())
+	if id == "" {
+		if available := w.available(addr); available != nil && available.Cmp(cost) < 0 {
+			return common.Hash{}, ErrFundsReserved
+		}
+		return send()
+	}
+	r, has := w.reservations[id]
+	if !has || r.Address != addr {
+		return common.Hash{}, ErrReservationNotFound
+	}
+	if r.used() {
+		return common.Hash{}, ErrReservationUsed
+	}
+	if r.Amount.Cmp(cost) < 0 {
+		return common.Hash{}, ErrReservationTooSmall
+	}
+	hash, err := send()
+	if err != nil {
+		return hash, err
+	}
+	r.TxHash = hash
+	return hash, nil
+}
+
+// ConfirmTransactions consumes the reservations spent by the transactions.
+func (w *Wallet) ConfirmTransactions(txs []*Transaction) {
+	if len(txs) == 0 {
+		return
+	}
+	confirmed := make(map[common.Hash]struct{}, len(txs))
+	for _, tx := range txs {
+		confirmed[tx.Hash()] = struct{}{}
+	}
+	w.resMu.Lock()
+	defer w.resMu.Unlock()
+	for id, r := range w.reservations {
+		if _, has := confirmed[r.TxHash]; has && r.used() {
+			delete(w.reservations, id)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package xfsgo
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+func newTestReservationWallet(t *testing.T, balance int64) (*Wallet, common.Address) {
+	w := NewWallet(newTestStateDB(t))
+	addr, err := w.AddByRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.EnableReservations(func(common.Address) *big.Int {
+		return big.NewInt(balance)
+	}, nil)
+	return w, addr
+}
+
+func TestWallet_Reserve(t *testing.T) {
+	w, addr := newTestReservationWallet(t, 100)
+	r, err := w.Reserve(addr, big.NewInt(60), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, w.Available(addr), big.NewInt(40))
+	if _, err = w.Reserve(addr, big.NewInt(41), time.Minute); err != ErrFundsReserved {
+		t.Fatalf("want ErrFundsReserved, got %v", err)
+	}
+	tx := NewTransactionByStd(&StdTransaction{
+		GasLimit: common.TxGas,
+		GasPrice: common.Big1,
+		Value:    common.Big1,
+	})
+	sent := tx.Hash()
+	send := func() (common.Hash, error) {
+		return sent, nil
+	}
+	// unreserved sends cannot spend the reserved funds
+	if _, err = w.Spend(addr, "", big.NewInt(50), send); err != ErrFundsReserved {
+		t.Fatalf("want ErrFundsReserved, got %v", err)
+	}
+	if _, err = w.Spend(addr, r.ID, big.NewInt(61), send); err != ErrReservationTooSmall {
+		t.Fatalf("want ErrReservationTooSmall, got %v", err)
+	}
+	if _, err = w.Spend(addr, r.ID, big.NewInt(60), send); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Spend(addr, r.ID, big.NewInt(60), send); err != ErrReservationUsed {
+		t.Fatalf("want ErrReservationUsed, got %v", err)
+	}
+	list := w.Reservations(addr)
+	assert.Equal(t, len(list), 1)
+	assert.Equal(t, list[0].TxHash, sent)
+	w.ConfirmTransactions([]*Transaction{tx})
+	assert.Equal(t, len(w.Reservations(addr)), 0)
+	assert.Equal(t, w.Release(r.ID), ErrReservationNotFound)
+}
+
+func TestWallet_ReserveExpires(t *testing.T) {
+	w, addr := newTestReservationWallet(t, 100)
+	r, err := w.Reserve(addr, big.NewInt(100), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.resMu.Lock()
+	w.reservations[r.ID].Expires = time.Now().Unix() - 1
+	w.resMu.Unlock()
+	assert.Equal(t, w.Available(addr), big.NewInt(100))
+	assert.Equal(t, len(w.Reservations(addr)), 0)
+	if r, err = w.Reserve(addr, big.NewInt(100), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Release(r.ID); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, w.Available(addr), big.NewInt(100))
+}
+
+func TestWallet_ReserveConcurrent(t *testing.T) {
+	w, addr := newTestReservationWallet(t, 100)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := w.Reserve(addr, big.NewInt(30), time.Minute); err == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, ok, 3)
+}
@@ -0,0 +1,35 @@
+package xfsgo
+
+import (
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+)
+
+func TestWallet_WatchOnly(t *testing.T) {
+	w := NewWallet(newTestStateDB(t))
+	owned, err := w.AddByRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cold := common.Address{0x01, 0x02}
+	assert.Equal(t, w.AddWatchOnly(cold), nil)
+	assert.Equal(t, w.AddWatchOnly(cold), ErrWatchOnlyExists)
+	assert.Equal(t, w.AddWatchOnly(owned), ErrWatchOnlyExists)
+	assert.Equal(t, w.IsWatchOnly(cold), true)
+	assert.Equal(t, w.IsWatchOnly(owned), false)
+	assert.Equal(t, w.Owns(cold), true)
+	assert.Equal(t, len(w.Accounts()), 2)
+	assert.Equal(t, w.WatchOnly(), []common.Address{cold})
+
+	// signing for the watch-only address is refused
+	_, err = w.GetKeyByAddress(cold)
+	assert.Equal(t, err, ErrWatchOnly)
+	_, err = w.Export(cold)
+	assert.Equal(t, err, ErrWatchOnly)
+	assert.Equal(t, w.SetDefault(cold), ErrWatchOnly)
+
+	assert.Equal(t, w.Remove(cold), nil)
+	assert.Equal(t, w.Owns(cold), false)
+	assert.Equal(t, len(w.Accounts()), 1)
+}
@@ -0,0 +1,325 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+package xfsgo
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+	"xfsgo/common"
+	"xfsgo/storage/badger"
+)
+
+var (
+	ErrWitnessBlock      = errors.New("block or parent of the witness not found")
+	ErrWitnessMismatch   = errors.New("state root of the witness execution mismatch")
+	ErrWitnessIncomplete = errors.New("witness misses state read by the block")
+	errWitnessReadOnly   = errors.New("witness storage is read only")
+)
+
+// WitnessNode is a node of the state read during the execution of a block,
+// it is a state tree node or a contract code keyed the way the state db stores it.
+type WitnessNode struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// StateWitness holds every state node read while executing a block on the state of
+// its parent, the block can be re-executed against the witness only. The randomness of
+// the contracts of the block is mixed from the headers before it, which the witness
+// doesn't hold, it is kept with the nodes.
+type StateWitness struct {
+	Block      common.Hash    `json:"block"`
+	Root       common.Hash    `json:"root"`
+	Randomness common.Hash    `json:"randomness"`
+	Nodes      []*WitnessNode `json:"nodes"`
+}
+
+// Size returns the total size of the keys and values of the witness.
+func (w *StateWitness) Size() int {
+	size := 0
+	for _, node := range w.Nodes {
+		size += len(node.Key) + len(node.Value)
+	}
+	return size
+}
+
+// witnessRecorder wraps the state db and records the values read through it.
+type witnessRecorder struct {
+	badger.IStorage
+	mu    sync.Mutex
+	nodes map[string][]byte
+}
+
+func newWitnessRecorder(db badger.IStorage) *witnessRecorder {
+	return &witnessRecorder{
+		IStorage: db,
+		nodes:    make(map[string][]byte),
+	}
+}
+
+func (r *witnessRecorder) record(key, val []byte) {
+	if val == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.nodes[string(key)]; !exists {
+		r.nodes[string(key)] = append([]byte{}, val...)
+	}
+}
+
+func (r *witnessRecorder) Get(key string) ([]byte, error) {
+	val, err := r.IStorage.Get(key)
+	if err == nil {
+		r.record([]byte(key), val)
+	}
+	return val, err
+}
+
+func (r *witnessRecorder) GetData(key []byte) ([]byte, error) {
+	val, err := r.IStorage.GetData(key)
+	if err == nil {
+		r.record(key, val)
+	}
+	return val, err
+}
+
+// witness returns the recorded nodes sorted by key.
+func (r *witnessRecorder) witness(block, root, randomness common.Hash) *StateWitness {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := &StateWitness{
+		Block:      block,
+		Root:       root,
+		Randomness: randomness,
+		Nodes:      make([]*WitnessNode, 0, len(r.nodes)),
+	}
+	for k, v := range r.nodes {
+		w.Nodes = append(w.Nodes, &WitnessNode{Key: []byte(k), Value: v})
+	}
+	sort.Slice(w.Nodes, func(i, j int) bool {
+		return bytes.Compare(w.Nodes[i].Key, w.Nodes[j].Key) < 0
+	})
+	return w
+}
+
+// witnessStorage is the read only state db served from the nodes of a witness,
+// the nodes written by the execution are kept in memory and never committed.
+type witnessStorage struct {
+	nodes map[string][]byte
+}
+
+func newWitnessStorage(w *StateWitness) *witnessStorage {
+	st := &witnessStorage{
+		nodes: make(map[string][]byte, len(w.Nodes)),
+	}
+	for _, node := range w.Nodes {
+		st.nodes[string(node.Key)] = node.Value
+	}
+	return st
+}
+
+func (st *witnessStorage) GetDBPath() string { return "" }
+
+func (st *witnessStorage) Set(key string, val []byte) error {
+	return st.SetData([]byte(key), val)
+}
+
+func (st *witnessStorage) SetData(key []byte, val []byte) error {
+	st.nodes[string(key)] = val
+	return nil
+}
+
+func (st *witnessStorage) NewWriteBatch() *badger.StorageWriteBatch { return nil }
+
+func (st *witnessStorage) CommitWriteBatch(_ *badger.StorageWriteBatch) error {
+	return errWitnessReadOnly
+}
+
+func (st *witnessStorage) Get(key string) ([]byte, error) {
+	return st.GetData([]byte(key))
+}
+
+func (st *witnessStorage) GetData(key []byte) ([]byte, error) {
+	return st.nodes[string(key)], nil
+}
+
+func (st *witnessStorage) Del(key string) error {
+	return st.DelData([]byte(key))
+}
+
+func (st *witnessStorage) DelData(key []byte) error {
+	delete(st.nodes, string(key))
+	return nil
+}
+
+func (st *witnessStorage) Close() error { return nil }
+
+func (st *witnessStorage) Foreach(_ func(k string, v []byte) error) error { return errWitnessReadOnly }
+
+func (st *witnessStorage) ForeachData(_ func(k []byte, v []byte) error) error {
+	return errWitnessReadOnly
+}
+
+func (st *witnessStorage) For(_ func(k []byte, v []byte)) {}
+
+func (st *witnessStorage) ForIndex(_ func(n int, k []byte, v []byte)) {}
+
+func (st *witnessStorage) ForIndexStar(_ int, _ func(n int, k []byte, v []byte)) {}
+
+func (st *witnessStorage) PrefixForeach(_ string, _ func(k string, v []byte) error) error {
+	return errWitnessReadOnly
+}
+
+func (st *witnessStorage) PrefixForeachData(_ []byte, _ func(k []byte, v []byte) error) error {
+	return errWitnessReadOnly
+}
+
+func (st *witnessStorage) NewIterator() badger.Iterator { return nil }
+
+func (st *witnessStorage) GetVersion() uint32 { return 0 }
+
+// executeBlock applies the transactions and the rewards of the block to the state at the
+// root read from the db, with the config of the chain and the randomness of the block, and
+// returns the resulting state root, the state is not committed.
+func executeBlock(config *ChainConfig, db badger.IStorage, root common.Hash, block *Block, randomness common.Hash) (common.Hash, error) {
+	stateTree, err := NewStateTreeN(db, root.Bytes())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	header := block.GetHeader()
+	gas, _, err := (&BlockChain{config: config, randomness: randomness}).ApplyTransactions(stateTree, header, block.Transactions)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if gas.Cmp(header.GasUsed) != 0 {
+		return common.Hash{}, ErrBadBlock
+	}
+	AccumulateRewards(config, stateTree, header)
+	stateTree.UpdateAll()
+	return common.Bytes2Hash(stateTree.Root()), nil
+}
+
+// GenerateWitness executes the block by the config on the state of its parent at the root
+// with the randomness of the block and returns the witness of the state read.
+func GenerateWitness(config *ChainConfig, db badger.IStorage, root common.Hash, block *Block, randomness common.Hash) (*StateWitness, error) {
+	recorder := newWitnessRecorder(db)
+	got, err := executeBlock(config, recorder, root, block, randomness)
+	if err != nil {
+		return nil, err
+	}
+	if got != block.StateRoot() {
+		return nil, ErrWitnessMismatch
+	}
+	return recorder.witness(block.HeaderHash(), root, randomness), nil
+}
+
+// VerifyWitness re-executes the block by the config against the nodes of the witness only
+// and checks the resulting state root is the state root of the block.
+func VerifyWitness(config *ChainConfig, w *StateWitness, block *Block) (err error) {
+	if w.Block != block.HeaderHash() {
+		return ErrWitnessBlock
+	}
+	// the execution assumes the state read exists, a missing account
+	// of the witness leaves nil values behind
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrWitnessIncomplete
+		}
+	}()
+	got, err := executeBlock(config, newWitnessStorage(w), w.Root, block, w.Randomness)
+	if err != nil {
+		return err
+	}
+	if got != block.StateRoot() {
+		return ErrWitnessMismatch
+	}
+	return nil
+}
+
+// witnessCache keeps the witnesses of the last accepted blocks.
+type witnessCache struct {
+	mu        sync.Mutex
+	limit     int
+	order     []common.Hash
+	witnesses map[common.Hash]*StateWitness
+}
+
+func newWitnessCache(limit int) *witnessCache {
+	return &witnessCache{
+		limit:     limit,
+		witnesses: make(map[common.Hash]*StateWitness),
+	}
+}
+
+func (c *witnessCache) add(w *StateWitness) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.witnesses[w.Block]; exists {
+		return
+	}
+	c.witnesses[w.Block] = w
+	c.order = append(c.order, w.Block)
+	for len(c.order) > c.limit {
+		delete(c.witnesses, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func (c *witnessCache) get(hash common.Hash) *StateWitness {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.witnesses[hash]
+}
+
+// SetWitnessRecording records the witnesses of the state read while accepting blocks and
+// keeps the last n of them, recording stops if n is 0.
+func (bc *BlockChain) SetWitnessRecording(n int) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if n <= 0 {
+		bc.witnesses = nil
+		return
+	}
+	bc.witnesses = newWitnessCache(n)
+}
+
+func (bc *BlockChain) witnessCache() *witnessCache {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.witnesses
+}
+
+// GetBlockWitness returns the witness recorded while accepting the block, otherwise
+// the witness is generated by executing the block on the state of its parent.
+func (bc *BlockChain) GetBlockWitness(hash common.Hash) (*StateWitness, error) {
+	if cache := bc.witnessCache(); cache != nil {
+		if w := cache.get(hash); w != nil {
+			return w, nil
+		}
+	}
+	block := bc.GetBlockByHash(hash)
+	if block == nil || block.Height() == 0 {
+		return nil, ErrWitnessBlock
+	}
+	parent := bc.GetBlockHeaderByBHash(block.HashPrevBlock())
+	if parent == nil {
+		return nil, ErrWitnessBlock
+	}
+	return GenerateWitness(bc.ChainConfig(), bc.stateDB, parent.StateRoot, block, bc.CalcRandomness(parent))
+}
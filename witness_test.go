@@ -0,0 +1,85 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+	"xfsgo/assert"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+func newTestWitnessBlock(t *testing.T) (*StateTree, *Block) {
+	key := crypto.MustGenPrvKey()
+	st := NewStateTree(newTestStateDB(t), nil)
+	st.AddBalance(crypto.DefaultPubKey2Addr(key.PublicKey), common.NanoCoin2Atto(big.NewInt(1000000)))
+	st.AddBalance(common.Address{0x02}, big.NewInt(1))
+	st.UpdateAll()
+	if err := st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	tx := NewTransactionByStd(&StdTransaction{
+		To:       common.Address{0x01},
+		GasPrice: big.NewInt(10),
+		GasLimit: big.NewInt(100000),
+		Value:    big.NewInt(100),
+	})
+	_ = tx.SignWithPrivateKey(key)
+	header := &BlockHeader{
+		Height:   1,
+		Coinbase: common.Address{0x03},
+		GasLimit: big.NewInt(1000000),
+	}
+	// the state root and gas of the block are taken from executing it on the parent state
+	exec := NewStateTree(st.treeDB, st.Root())
+	gas, receipts, err := (&BlockChain{config: MainNetChainConfig}).ApplyTransactions(exec, header, []*Transaction{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AccumulateRewards(MainNetChainConfig, exec, header)
+	exec.UpdateAll()
+	header.GasUsed = gas
+	header.StateRoot = common.Bytes2Hash(exec.Root())
+	return st, NewBlock(header, []*Transaction{tx}, receipts)
+}
+
+func TestVerifyWitness(t *testing.T) {
+	st, block := newTestWitnessBlock(t)
+	root := common.Bytes2Hash(st.Root())
+	witness, err := GenerateWitness(MainNetChainConfig, st.treeDB, root, block, common.Hash{0x04})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, witness.Block, block.HeaderHash())
+	assert.Equal(t, witness.Root, root)
+	assert.Equal(t, witness.Randomness, common.Hash{0x04})
+	if len(witness.Nodes) == 0 {
+		t.Fatal("want witness nodes")
+	}
+	assert.Equal(t, VerifyWitness(MainNetChainConfig, witness, block), nil)
+
+	// an incomplete witness can not reproduce the state root
+	incomplete := &StateWitness{Block: witness.Block, Root: witness.Root, Nodes: witness.Nodes[1:]}
+	if err = VerifyWitness(MainNetChainConfig, incomplete, block); err == nil {
+		t.Fatal("want error of incomplete witness")
+	}
+	// the witness of the sender alone is not enough
+	sender := &StateWitness{Block: witness.Block, Root: witness.Root, Nodes: witness.Nodes[:1]}
+	if err = VerifyWitness(MainNetChainConfig, sender, block); err == nil {
+		t.Fatal("want error of incomplete witness")
+	}
+	header := *block.GetHeader()
+	header.StateRoot = common.Hash{0x01}
+	_, err = GenerateWitness(MainNetChainConfig, st.treeDB, root, NewBlock(&header, block.Transactions, nil), common.Hash{})
+	assert.Equal(t, err, ErrWitnessMismatch)
+}
+
+func TestWitnessCache(t *testing.T) {
+	c := newWitnessCache(2)
+	for i := byte(1); i <= 3; i++ {
+		c.add(&StateWitness{Block: common.Hash{i}})
+	}
+	if c.get(common.Hash{1}) != nil {
+		t.Fatal("want oldest witness evicted")
+	}
+	assert.Equal(t, c.get(common.Hash{3}).Block, common.Hash{3})
+}